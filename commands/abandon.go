@@ -0,0 +1,70 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/google/git-appraise/review/comment"
+)
+
+var abandonFlagSet = flag.NewFlagSet("abandon", flag.ExitOnError)
+
+var (
+	abandonMessage = abandonFlagSet.String("m", "", "Reason for abandoning the review")
+)
+
+// abandonReview closes a review without submitting it.
+//
+// The reason, if given, is added to the review as a comment.
+func abandonReview(args []string) error {
+	abandonFlagSet.Parse(args)
+	r, err := loadReview(abandonFlagSet.Args())
+	if err != nil {
+		return err
+	}
+	if r.Submitted {
+		return errors.New("The review has already been submitted.")
+	}
+	if r.Abandoned {
+		return errors.New("The review has already been abandoned.")
+	}
+
+	if *abandonMessage != "" {
+		c := comment.New("Abandoned: " + *abandonMessage)
+		if err := r.AddComment(&c); err != nil {
+			return err
+		}
+	}
+	abandoned := r.Request
+	abandoned.Abandoned = true
+	return r.UpdateRequest(abandoned)
+}
+
+// abandonCmd defines the "abandon" subcommand.
+var abandonCmd = &Command{
+	Usage: func(arg0 string) {
+		fmt.Printf("Usage: %s abandon <option>... [<commit>]\n\nOptions:\n", arg0)
+		abandonFlagSet.PrintDefaults()
+	},
+	RunMethod: func(args []string) error {
+		return abandonReview(args)
+	},
+	Mutates: true,
+}
@@ -17,9 +17,9 @@ limitations under the License.
 package commands
 
 import (
-	"errors"
 	"flag"
 	"fmt"
+
 	"github.com/google/git-appraise/repository"
 	"github.com/google/git-appraise/review"
 	"github.com/google/git-appraise/review/comment"
@@ -28,22 +28,30 @@ import (
 var acceptFlagSet = flag.NewFlagSet("accept", flag.ExitOnError)
 
 var (
-	acceptMessage = acceptFlagSet.String("m", "", "Message to attach to the review")
+	acceptMessage    = acceptFlagSet.String("m", "", "Message to attach to the review")
+	acceptJsonOutput = acceptFlagSet.Bool("json", false, "Format the output as JSON")
+	acceptVerify     = acceptFlagSet.Bool("verify-signatures", false, "Refuse to accept the review unless every commit in it has a valid signature.")
 )
 
 // acceptReview adds an LGTM comment to the current code review.
 func acceptReview(args []string) error {
 	acceptFlagSet.Parse(args)
 
-	r, err := review.GetCurrent()
+	r, err := loadReview(acceptFlagSet.Args())
 	if err != nil {
-		return fmt.Errorf("Failed to load the current review: %v\n", err)
+		return err
 	}
-	if r == nil {
-		return errors.New("There is no current review.")
+	// Adding the comment checks the signatures if the repository requires them.
+	if *acceptVerify && repository.GetConfig(review.RequireSignaturesConfig) != "true" {
+		if err := r.CheckCommitSignatures(true, "accepting"); err != nil {
+			return err
+		}
 	}
 
-	acceptedCommit := repository.GetCommitHash(r.Request.ReviewRef)
+	acceptedCommit, err := r.HeadCommit()
+	if err != nil {
+		return err
+	}
 	location := comment.Location{
 		Commit: acceptedCommit,
 	}
@@ -51,16 +59,17 @@ func acceptReview(args []string) error {
 	c := comment.New(*acceptMessage)
 	c.Location = &location
 	c.Resolved = &resolved
-	return r.AddComment(c)
+	return addComment(r, c, *acceptJsonOutput)
 }
 
 // acceptCmd defines the "accept" subcommand.
 var acceptCmd = &Command{
 	Usage: func(arg0 string) {
-		fmt.Printf("Usage: %s accept <option>...\n\nOptions:\n", arg0)
+		fmt.Printf("Usage: %s accept <option>... [<review>]\n\nOptions:\n", arg0)
 		acceptFlagSet.PrintDefaults()
 	},
 	RunMethod: func(args []string) error {
 		return acceptReview(args)
 	},
+	Mutates: true,
 }
@@ -0,0 +1,79 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/git-appraise/repository"
+	"github.com/google/git-appraise/review"
+	"github.com/google/git-appraise/review/comment"
+)
+
+const (
+	// defaultAck is the acknowledgement used when none is given.
+	defaultAck = "done"
+	// maxAckLength is the longest acknowledgement allowed, to keep them compact.
+	maxAckLength = 20
+)
+
+// ackComment acknowledges a comment on the current review.
+func ackComment(args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return errors.New("The hash of the comment, and optionally the acknowledgement, must be given.")
+	}
+	hash := args[0]
+	ack := defaultAck
+	if len(args) == 2 {
+		ack = strings.TrimSpace(args[1])
+	}
+	if ack == "" || len(ack) > maxAckLength || strings.ContainsAny(ack, "\n\r") {
+		return fmt.Errorf("An acknowledgement must be a single line of at most %d characters.", maxAckLength)
+	}
+
+	r, err := review.GetCurrent()
+	if err != nil {
+		return fmt.Errorf("Failed to load the current review: %v\n", err)
+	}
+	if r == nil {
+		return errors.New("There is no current review.")
+	}
+	if !hasThread(r.Comments, hash) {
+		return fmt.Errorf("There is no comment %q on the current review.", hash)
+	}
+
+	c := comment.New("")
+	c.Location = &comment.Location{
+		Commit: repository.GetCommitHash(r.Request.ReviewRef),
+	}
+	c.Parent = hash
+	c.Ack = ack
+	return r.AddComment(&c)
+}
+
+// ackCmd defines the "ack" subcommand.
+var ackCmd = &Command{
+	Usage: func(arg0 string) {
+		fmt.Printf("Usage: %s ack <comment hash> [<acknowledgement>]\n\nAcknowledges a comment with a short note, such as \"+1\", which defaults to %q.\n", arg0, defaultAck)
+	},
+	RunMethod: func(args []string) error {
+		return ackComment(args)
+	},
+	Mutates: true,
+}
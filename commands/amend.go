@@ -0,0 +1,116 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/google/git-appraise/repository"
+	"github.com/google/git-appraise/review"
+	"github.com/google/git-appraise/review/request"
+)
+
+var amendFlagSet = flag.NewFlagSet("amend", flag.ExitOnError)
+
+var (
+	amendMessage   = amendFlagSet.String("m", "", "New description of the review")
+	amendTarget    = amendFlagSet.String("target", "", "New ref into which the review should be merged")
+	amendReviewers = amendFlagSet.String("r", "", "New comma-separated list of reviewers, replacing the existing ones")
+	amendPriority  = amendFlagSet.String("priority", "", "New priority of the review, from P0 (most urgent) to P4, or \"none\" to clear it")
+)
+
+// amendReview updates the description, target, reviewers, or priority of a review.
+//
+// The original request is preserved, as the updated one is appended after it.
+func amendReview(args []string) error {
+	amendFlagSet.Parse(args)
+	r, err := loadReview(amendFlagSet.Args())
+	if err != nil {
+		return err
+	}
+	if r.Request.Requester != repository.GetUserEmail() {
+		return fmt.Errorf("Only the author of the review, %s, can amend it.", r.Request.Requester)
+	}
+
+	updated := r.Request
+	flagsGiven := false
+	amendFlagSet.Visit(func(*flag.Flag) { flagsGiven = true })
+	if !flagsGiven {
+		if !isInteractive() {
+			return errors.New("At least one of -m, --target, -r, or --priority must be specified.")
+		}
+		context := fmt.Sprintf("Amending the description of the review %s.", r.Revision)
+		if updated.Description, err = editMessage(r.Request.Description, context); err != nil {
+			return err
+		}
+	}
+	if *amendMessage != "" {
+		updated.Description = *amendMessage
+	}
+	if *amendTarget != "" {
+		updated.TargetRef = qualifyRef(*amendTarget)
+		if _, err := repository.ResolveCommit(updated.TargetRef); err != nil {
+			return fmt.Errorf("Unknown target ref %q", *amendTarget)
+		}
+	}
+	if *amendReviewers != "" {
+		updated.Reviewers = nil
+		for _, reviewer := range strings.Split(*amendReviewers, ",") {
+			if reviewer = strings.TrimSpace(reviewer); reviewer != "" {
+				updated.Reviewers = append(updated.Reviewers, reviewer)
+			}
+		}
+	}
+	switch *amendPriority {
+	case "":
+	case "none":
+		updated.Priority = ""
+	default:
+		if err := request.ValidatePriority(*amendPriority); err != nil {
+			return err
+		}
+		updated.Priority = *amendPriority
+	}
+	if updated.Description != r.Request.Description {
+		updated.UpdateMentions()
+	}
+	if reflect.DeepEqual(updated, r.Request) {
+		return errors.New("The review already has the given details.")
+	}
+	changes := review.RequestChanges(r.Request, updated)
+	if err := r.UpdateRequest(updated); err != nil {
+		return err
+	}
+	fmt.Printf("Updated the %s of the review %s\n", strings.Join(changes, ", "), r.Revision)
+	return nil
+}
+
+// amendCmd defines the "amend" subcommand.
+var amendCmd = &Command{
+	Usage: func(arg0 string) {
+		fmt.Printf("Usage: %s amend <option>... [<commit>]\n\nWithout any options, the description is opened in an editor.\n\nOptions:\n", arg0)
+		amendFlagSet.PrintDefaults()
+	},
+	RunMethod: func(args []string) error {
+		return amendReview(args)
+	},
+	Mutates: true,
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"time"
+
+	"github.com/google/git-appraise/repository"
+	"github.com/google/git-appraise/review/analyses"
+)
+
+var analyzeFlagSet = flag.NewFlagSet("analyze", flag.ExitOnError)
+
+var (
+	analyzeSarif = analyzeFlagSet.String("sarif", "", "SARIF file holding the results of a static analyzer")
+	analyzeURL   = analyzeFlagSet.String("url", "", "URL of the analyzer's complete results, to link from the review")
+	analyzeAll   = analyzeFlagSet.Bool("all", false, "Keep findings in files that the review does not change")
+)
+
+// anchorNotes returns the findings that are located in the given files, along with the number left out.
+func anchorNotes(notes []analyses.Note, files []string) ([]analyses.Note, int) {
+	changed := make(map[string]bool)
+	for _, file := range files {
+		changed[file] = true
+	}
+	var anchored []analyses.Note
+	for _, note := range notes {
+		if note.Location != nil && changed[note.Location.Path] {
+			anchored = append(anchored, note)
+		}
+	}
+	return anchored, len(notes) - len(anchored)
+}
+
+// analyze records the results of static analyzers as analysis reports on the current revision of a review.
+func analyze(args []string) error {
+	analyzeFlagSet.Parse(args)
+	args = analyzeFlagSet.Args()
+	if *analyzeSarif == "" {
+		return errors.New("The results to record must be given with --sarif.")
+	}
+	r, err := loadReview(args)
+	if err != nil {
+		return err
+	}
+	revision, err := repository.ResolveCommit(r.Request.ReviewRef)
+	if err != nil {
+		return fmt.Errorf("Cannot resolve the review ref %q: %v", r.Request.ReviewRef, err)
+	}
+	changedFiles, err := r.ChangedFiles()
+	if err != nil {
+		return err
+	}
+	root, err := repository.GetRepoRoot()
+	if err != nil {
+		return err
+	}
+	data, err := ioutil.ReadFile(*analyzeSarif)
+	if err != nil {
+		return err
+	}
+	reports, err := analyses.FromSARIF(data, filepath.ToSlash(root))
+	if err != nil {
+		return err
+	}
+	timestamp := fmt.Sprintf("%010d", time.Now().Unix())
+	for _, report := range reports {
+		var skipped int
+		if !*analyzeAll {
+			report.Notes, skipped = anchorNotes(report.Notes, changedFiles)
+		}
+		report.Timestamp = timestamp
+		report.URL = *analyzeURL
+		note, err := report.Write()
+		if err != nil {
+			return err
+		}
+		repository.AppendNote(analyses.Ref, revision, note)
+		fmt.Printf("Recorded %d findings from %s", len(report.Notes), report.Agent)
+		if skipped > 0 {
+			fmt.Printf(", leaving out %d outside of the files changed by the review", skipped)
+		}
+		fmt.Println()
+	}
+	return nil
+}
+
+// analyzeCmd defines the "analyze" subcommand.
+var analyzeCmd = &Command{
+	Usage: func(arg0 string) {
+		fmt.Printf("Usage: %s analyze <option>... [<commit>]\n\nOptions:\n", arg0)
+		analyzeFlagSet.PrintDefaults()
+	},
+	RunMethod: func(args []string) error {
+		return analyze(args)
+	},
+	Mutates: true,
+}
@@ -0,0 +1,281 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/google/git-appraise/repository"
+	"github.com/google/git-appraise/review"
+	"github.com/google/git-appraise/review/comment"
+)
+
+// annotationsSuffix is appended to the path of each source file to get the path of its sidecar file.
+const annotationsSuffix = ".annotations"
+
+// annotation is a single comment in a sidecar file.
+//
+// Sidecar files contain one annotation per line, encoded as JSON. Editors
+// add new comments by appending annotations without a hash, which are then
+// turned into review comments by "annotations import".
+type annotation struct {
+	Hash      string `json:"hash,omitempty"`
+	Parent    string `json:"parent,omitempty"`
+	Line      uint32 `json:"line,omitempty"`
+	Author    string `json:"author,omitempty"`
+	Timestamp string `json:"timestamp,omitempty"`
+	Text      string `json:"text"`
+}
+
+var annotationsFlagSet = flag.NewFlagSet("annotations", flag.ExitOnError)
+
+var (
+	annotationsDir = annotationsFlagSet.String("dir", "", "Directory holding the sidecar files. Defaults to \"appraise/annotations\" under the .git directory")
+)
+
+// collectAnnotations groups the file comments in the given threads by path.
+func collectAnnotations(threads []review.CommentThread, byPath map[string][]annotation) {
+	for _, thread := range threads {
+		c := thread.Comment
+		if c.Location != nil && c.Location.Path != "" {
+			a := annotation{
+				Hash:      thread.Hash,
+				Parent:    c.Parent,
+				Author:    c.Author,
+				Timestamp: c.Timestamp,
+				Text:      c.Description,
+			}
+			if c.Location.Range != nil {
+				a.Line = c.Location.Range.StartLine
+			}
+			byPath[c.Location.Path] = append(byPath[c.Location.Path], a)
+		}
+		collectAnnotations(thread.Children, byPath)
+	}
+}
+
+// exportedList is the file, within the sidecar directory, that lists the
+// sidecar files written by the latest export.
+const exportedList = ".exported"
+
+// sidecarPath returns the path of the sidecar file for the given source file.
+//
+// The path comes from the comments, which anyone can write, so paths that
+// would point outside of the directory are rejected.
+func sidecarPath(dir, path string) (string, error) {
+	cleaned := filepath.Clean(filepath.FromSlash(path))
+	if filepath.IsAbs(cleaned) || strings.HasPrefix(path, "/") || cleaned == ".." || strings.HasPrefix(cleaned, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("Invalid path %q: it must be relative to the root of the repository.", path)
+	}
+	return filepath.Join(dir, cleaned+annotationsSuffix), nil
+}
+
+// removeExported removes the sidecar files written by the previous export to
+// the directory, leaving any other files alone.
+func removeExported(dir string) error {
+	contents, err := ioutil.ReadFile(filepath.Join(dir, exportedList))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	for _, path := range strings.Split(string(contents), "\n") {
+		if path == "" {
+			continue
+		}
+		sidecar, err := sidecarPath(dir, path)
+		if err != nil {
+			continue
+		}
+		if err := os.Remove(sidecar); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// exportAnnotations writes one sidecar file for every file that has comments in the review.
+//
+// The sidecar files written by the previous export are replaced.
+func exportAnnotations(r *review.Review, dir string) error {
+	if err := removeExported(dir); err != nil {
+		return err
+	}
+	byPath := make(map[string][]annotation)
+	collectAnnotations(r.Comments, byPath)
+	var exported []string
+	for path, annotations := range byPath {
+		sidecar, err := sidecarPath(dir, path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Skipping comments:", err)
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(sidecar), 0755); err != nil {
+			return err
+		}
+		file, err := os.Create(sidecar)
+		if err != nil {
+			return err
+		}
+		encoder := json.NewEncoder(file)
+		for _, a := range annotations {
+			if err := encoder.Encode(a); err != nil {
+				file.Close()
+				return err
+			}
+		}
+		if err := file.Close(); err != nil {
+			return err
+		}
+		exported = append(exported, path)
+	}
+	sort.Strings(exported)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	list := strings.Join(exported, "\n") + "\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, exportedList), []byte(list), 0644); err != nil {
+		return err
+	}
+	fmt.Printf("Exported comments on %d files to %s\n", len(exported), dir)
+	return nil
+}
+
+// readSidecar reads the annotations from a single sidecar file.
+func readSidecar(sidecar string) ([]annotation, error) {
+	file, err := os.Open(sidecar)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var annotations []annotation
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var a annotation
+		if err := json.Unmarshal([]byte(line), &a); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", sidecar, lineNumber, err)
+		}
+		annotations = append(annotations, a)
+	}
+	return annotations, scanner.Err()
+}
+
+// importAnnotations adds a comment to the review for every new annotation in the sidecar files.
+func importAnnotations(r *review.Review, dir string) error {
+	commentedUponCommit, err := r.HeadCommit()
+	if err != nil {
+		return err
+	}
+	var imported int
+	err = filepath.Walk(dir, func(sidecar string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || !strings.HasSuffix(sidecar, annotationsSuffix) {
+			return err
+		}
+		relative, err := filepath.Rel(dir, sidecar)
+		if err != nil {
+			return err
+		}
+		path := filepath.ToSlash(strings.TrimSuffix(relative, annotationsSuffix))
+		annotations, err := readSidecar(sidecar)
+		if err != nil {
+			return err
+		}
+		for _, a := range annotations {
+			if a.Hash != "" {
+				continue
+			}
+			location := comment.Location{
+				Commit: commentedUponCommit,
+				Path:   path,
+			}
+			if a.Line > 0 {
+				location.Range = &comment.Range{StartLine: a.Line}
+			}
+			c := comment.New(a.Text)
+			c.Location = &location
+			c.Parent = a.Parent
+			if err := r.AddComment(&c); err != nil {
+				return err
+			}
+			imported++
+		}
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	fmt.Printf("Imported %d new comments\n", imported)
+	return nil
+}
+
+// annotations exports review comments to, or imports them from, per-file sidecar files.
+func annotations(args []string) error {
+	annotationsFlagSet.Parse(args)
+	args = annotationsFlagSet.Args()
+	if len(args) == 0 {
+		return errors.New("Either \"export\" or \"import\" must be specified.")
+	}
+	action := args[0]
+	r, err := loadReview(args[1:])
+	if err != nil {
+		return err
+	}
+	dir := *annotationsDir
+	if dir == "" {
+		dir = filepath.Join(repository.GetGitDir(), "appraise", "annotations")
+	}
+
+	switch action {
+	case "export":
+		return exportAnnotations(r, dir)
+	case "import":
+		if err := importAnnotations(r, dir); err != nil {
+			return err
+		}
+		// Re-export, so that the imported comments get their hashes and authors filled in.
+		if r = review.Get(r.Revision); r == nil {
+			return errors.New("Failed to reload the review.")
+		}
+		return exportAnnotations(r, dir)
+	}
+	return fmt.Errorf("Unknown action %q; must be \"export\" or \"import\".", action)
+}
+
+// annotationsCmd defines the "annotations" subcommand.
+var annotationsCmd = &Command{
+	Usage: func(arg0 string) {
+		fmt.Printf("Usage: %s annotations <option>... (export|import) [<commit>]\n\nOptions:\n", arg0)
+		annotationsFlagSet.PrintDefaults()
+	},
+	RunMethod: func(args []string) error {
+		return annotations(args)
+	},
+	Mutates: true,
+}
@@ -0,0 +1,39 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestSidecarPath(t *testing.T) {
+	dir := filepath.Join("work", "annotations")
+	sidecar, err := sidecarPath(dir, "src/main.go")
+	if err != nil || sidecar != filepath.Join(dir, "src", "main.go.annotations") {
+		t.Fatalf("Unexpected sidecar path: %q, %v", sidecar, err)
+	}
+	sidecar, err = sidecarPath(dir, "src/../docs/..dots.md")
+	if err != nil || sidecar != filepath.Join(dir, "docs", "..dots.md.annotations") {
+		t.Fatalf("Unexpected sidecar path for a path with dots: %q, %v", sidecar, err)
+	}
+	for _, invalid := range []string{"/etc/passwd", "..", "../outside.go", "src/../../outside.go"} {
+		if sidecar, err := sidecarPath(dir, invalid); err == nil {
+			t.Errorf("Expected an error for %q, got %q", invalid, sidecar)
+		}
+	}
+}
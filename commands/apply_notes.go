@@ -0,0 +1,97 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/google/git-appraise/repository"
+	"github.com/google/git-appraise/review/comment"
+	"github.com/google/git-appraise/review/transport"
+)
+
+// devtoolsNotesPrefix is the prefix shared by every notes ref that holds review data.
+const devtoolsNotesPrefix = "refs/notes/devtools/"
+
+// mergeKey returns the function identifying the notes under the given ref when
+// merging them, so that copies of the same comment are only merged once.
+func mergeKey(notesRef string) func(repository.Note) string {
+	if notesRef == comment.Ref {
+		return comment.NoteKey
+	}
+	return nil
+}
+
+// applyNotesFrom merges the notes in the patches read from the given reader into the local notes.
+func applyNotesFrom(r io.Reader) error {
+	patches, err := transport.Parse(r)
+	if err != nil {
+		return err
+	}
+	// Check every patch before applying any, so that invalid ones are rejected as a whole.
+	for _, patch := range patches {
+		if !strings.HasPrefix(patch.Ref, devtoolsNotesPrefix) {
+			return fmt.Errorf("Refusing to apply notes to %q, which is not a review notes ref", patch.Ref)
+		}
+		for object := range patch.Notes {
+			if !repository.HasObject(object) {
+				return fmt.Errorf("Refusing to apply notes to %s in %q, as that object does not exist locally; fetch it first", object, patch.Ref)
+			}
+		}
+	}
+	for _, patch := range patches {
+		added, err := repository.MergeNotes(patch.Ref, patch.Notes, "Notes added by 'git appraise apply-notes'", mergeKey(patch.Ref))
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Added %d notes to %s\n", added, patch.Ref)
+	}
+	return nil
+}
+
+// applyNotes merges notes written by "format-notes" into the local notes.
+func applyNotes(args []string) error {
+	if len(args) == 0 {
+		return applyNotesFrom(os.Stdin)
+	}
+	for _, path := range args {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		err = applyNotesFrom(file)
+		file.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyNotesCmd defines the "apply-notes" subcommand.
+var applyNotesCmd = &Command{
+	Usage: func(arg0 string) {
+		fmt.Printf("Usage: %s apply-notes [<mbox>...]\n\nReads from stdin if no files are given.\n", arg0)
+	},
+	RunMethod: func(args []string) error {
+		return applyNotes(args)
+	},
+	Mutates: true,
+}
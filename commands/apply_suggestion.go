@@ -0,0 +1,106 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/google/git-appraise/repository"
+	"github.com/google/git-appraise/review"
+)
+
+var applySuggestionFlagSet = flag.NewFlagSet("apply-suggestion", flag.ExitOnError)
+
+var applySuggestionFixup = applySuggestionFlagSet.Bool("fixup", false, "Commit the edit as a fixup of the commented upon commit, to be squashed by \"git rebase --autosquash\"")
+
+// applySuggestion applies the edit suggested by a comment on the current review to the working tree.
+func applySuggestion(args []string) error {
+	applySuggestionFlagSet.Parse(args)
+	args = applySuggestionFlagSet.Args()
+	if len(args) != 1 {
+		return errors.New("Exactly one comment must be given.")
+	}
+	r, err := review.GetCurrent()
+	if err != nil {
+		return fmt.Errorf("Failed to load the current review: %v\n", err)
+	}
+	if r == nil {
+		return errors.New("There is no current review.")
+	}
+	thread := findThread(r.Comments, args[0])
+	if thread == nil {
+		return fmt.Errorf("There is no comment %q on the current review.", args[0])
+	}
+	c := thread.Comment
+	if c.Suggestion == nil || c.Retracted || c.Location == nil || c.Location.Commit == "" {
+		return errors.New("The comment does not suggest an edit.")
+	}
+	location := c.Location
+	original, err := repository.GetFileContents(location.Commit, location.Path)
+	if err != nil {
+		return fmt.Errorf("Cannot read %s as it was commented upon: %v", location.Path, err)
+	}
+	root, err := repository.GetRepoRoot()
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(root, filepath.FromSlash(location.Path))
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	current, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if *applySuggestionFixup && repository.HasUncommittedChangesIn(path) {
+		return fmt.Errorf("%s has uncommitted changes, which would be included in the fixup.", location.Path)
+	}
+	edited, err := review.ApplySuggestion(c, original, string(current))
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(path, []byte(edited), info.Mode()); err != nil {
+		return err
+	}
+	if *applySuggestionFixup {
+		if err := repository.CommitFixup(location.Commit, path); err != nil {
+			return err
+		}
+		fmt.Printf("Committed the suggested edit to %s as a fixup of %s\n", location.Path, location.Commit)
+		return nil
+	}
+	fmt.Printf("Applied the suggested edit to %s\n", location.Path)
+	return nil
+}
+
+// applySuggestionCmd defines the "apply-suggestion" subcommand.
+var applySuggestionCmd = &Command{
+	Usage: func(arg0 string) {
+		fmt.Printf("Usage: %s apply-suggestion <option>... <comment-hash>\n\nOptions:\n", arg0)
+		applySuggestionFlagSet.PrintDefaults()
+	},
+	RunMethod: func(args []string) error {
+		return applySuggestion(args)
+	},
+	Mutates: true,
+}
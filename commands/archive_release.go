@@ -0,0 +1,105 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/google/git-appraise/repository"
+	"github.com/google/git-appraise/review"
+	"github.com/google/git-appraise/review/manifest"
+)
+
+// manifestTagPrefix is prepended to the release tag name to get the name of the manifest tag.
+const manifestTagPrefix = "appraise/"
+
+var archiveReleaseFlagSet = flag.NewFlagSet("archive-release", flag.ExitOnError)
+
+var (
+	archiveReleaseSign            = archiveReleaseFlagSet.Bool("s", false, "GPG-sign the manifest tag using the default key")
+	archiveReleaseHTML            = archiveReleaseFlagSet.String("html", "", "Also write an HTML version of the manifest to the given file")
+	archiveReleaseAllowUnapproved = archiveReleaseFlagSet.Bool("allow-unapproved", false, "Write the manifest even if some of the included reviews were not accepted")
+)
+
+// archiveRelease records a manifest of all of the reviews whose commits are included in a release tag.
+func archiveRelease(args []string) error {
+	archiveReleaseFlagSet.Parse(args)
+	args = archiveReleaseFlagSet.Args()
+	if len(args) != 1 {
+		return errors.New("Exactly one release tag must be specified.")
+	}
+	tag := args[0]
+	tagCommit := repository.GetCommitHash(tag + "^{commit}")
+
+	var included []review.Review
+	for _, r := range append(review.ListAll(), review.ListArchived()...) {
+		if repository.IsAncestor(r.Revision, tagCommit) {
+			included = append(included, r)
+		}
+	}
+	m := manifest.New(tag, tagCommit, included)
+	if unapproved := m.Unapproved(); len(unapproved) > 0 {
+		for _, entry := range unapproved {
+			fmt.Printf("Review %s was not approved\n", entry.Revision)
+		}
+		if !*archiveReleaseAllowUnapproved {
+			return fmt.Errorf("%d of the reviews in %q were not approved. Use --allow-unapproved to archive the release anyway.", len(unapproved), tag)
+		}
+	}
+
+	contents, err := m.Write()
+	if err != nil {
+		return err
+	}
+	blob, err := repository.StoreBlob(contents)
+	if err != nil {
+		return fmt.Errorf("Failed to store the manifest: %v", err)
+	}
+	manifestTag := manifestTagPrefix + tag
+	message := fmt.Sprintf("Review manifest for %s\n\nIncludes %d reviews of commits reachable from %s.\n", tag, len(m.Reviews), tagCommit)
+	if err := repository.CreateTag(manifestTag, blob, message, *archiveReleaseSign); err != nil {
+		return err
+	}
+
+	if *archiveReleaseHTML != "" {
+		out, err := os.Create(*archiveReleaseHTML)
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+		if err := m.WriteHTML(out); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("Archived %d reviews in the tag %q\n", len(m.Reviews), manifestTag)
+	return nil
+}
+
+// archiveReleaseCmd defines the "archive-release" subcommand.
+var archiveReleaseCmd = &Command{
+	Usage: func(arg0 string) {
+		fmt.Printf("Usage: %s archive-release <option>... <tag>\n\nOptions:\n", arg0)
+		archiveReleaseFlagSet.PrintDefaults()
+	},
+	RunMethod: func(args []string) error {
+		return archiveRelease(args)
+	},
+	Mutates: true,
+}
@@ -0,0 +1,109 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+)
+
+var assignFlagSet = flag.NewFlagSet("assign", flag.ExitOnError)
+
+var (
+	assignAdd    = assignFlagSet.Bool("add", false, "Add the given reviewers (the default)")
+	assignRemove = assignFlagSet.Bool("remove", false, "Remove the given reviewers")
+	assignReview = assignFlagSet.String("review", "", "Commit of the review to update, instead of the current review")
+)
+
+// updateList returns the values (e.g. reviewers) after adding or removing the given ones, keeping the existing order.
+func updateList(values, changed []string, remove bool) []string {
+	isChanged := make(map[string]bool)
+	for _, value := range changed {
+		isChanged[value] = true
+	}
+	var updated []string
+	for _, value := range values {
+		if remove && isChanged[value] {
+			continue
+		}
+		updated = append(updated, value)
+		delete(isChanged, value)
+	}
+	if !remove {
+		for _, value := range changed {
+			if isChanged[value] {
+				updated = append(updated, value)
+				delete(isChanged, value)
+			}
+		}
+	}
+	return updated
+}
+
+// assignReviewers adds or removes reviewers of an existing review.
+func assignReviewers(args []string) error {
+	assignFlagSet.Parse(args)
+	if *assignAdd && *assignRemove {
+		return errors.New("Only one of --add or --remove is allowed.")
+	}
+	var emails []string
+	for _, arg := range assignFlagSet.Args() {
+		for _, email := range strings.Split(arg, ",") {
+			if email = strings.TrimSpace(email); email != "" {
+				emails = append(emails, email)
+			}
+		}
+	}
+	if len(emails) == 0 {
+		return errors.New("At least one reviewer must be given.")
+	}
+
+	var reviewArgs []string
+	if *assignReview != "" {
+		reviewArgs = []string{*assignReview}
+	}
+	r, err := loadReview(reviewArgs)
+	if err != nil {
+		return err
+	}
+
+	updated := r.Request
+	updated.Reviewers = updateList(r.Request.Reviewers, emails, *assignRemove)
+	if err := r.UpdateRequest(updated); err != nil {
+		return err
+	}
+	if len(updated.Reviewers) == 0 {
+		fmt.Println("The review has no reviewers.")
+	} else {
+		fmt.Printf("Reviewers: %s\n", strings.Join(updated.Reviewers, ", "))
+	}
+	return nil
+}
+
+// assignCmd defines the "assign" subcommand.
+var assignCmd = &Command{
+	Usage: func(arg0 string) {
+		fmt.Printf("Usage: %s assign <option>... <email>...\n\nOptions:\n", arg0)
+		assignFlagSet.PrintDefaults()
+	},
+	RunMethod: func(args []string) error {
+		return assignReviewers(args)
+	},
+	Mutates: true,
+}
@@ -0,0 +1,35 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUpdateList(t *testing.T) {
+	current := []string{"a", "b"}
+	if added := updateList(current, []string{"c", "a", "c"}, false); !reflect.DeepEqual(added, []string{"a", "b", "c"}) {
+		t.Errorf("Unexpected reviewers after adding: %v", added)
+	}
+	if removed := updateList(current, []string{"a", "z"}, true); !reflect.DeepEqual(removed, []string{"b"}) {
+		t.Errorf("Unexpected reviewers after removing: %v", removed)
+	}
+	if removed := updateList(current, current, true); removed != nil {
+		t.Errorf("Expected no reviewers to remain, got %v", removed)
+	}
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/google/git-appraise/review"
+	"github.com/google/git-appraise/review/attestation"
+)
+
+var attestFlagSet = flag.NewFlagSet("attest", flag.ExitOnError)
+
+var (
+	attestSign   = attestFlagSet.Bool("s", false, "Sign each attestation with your GPG key, wrapping it in a DSSE envelope")
+	attestOutput = attestFlagSet.String("o", "", "Write the attestations to the given file instead of stdout")
+)
+
+// attest writes an in-toto attestation for each of the given reviews, one per line.
+//
+// If no reviews are given, then attestations are written for every submitted review.
+func attest(args []string) error {
+	attestFlagSet.Parse(args)
+	args = attestFlagSet.Args()
+
+	var reviews []review.Review
+	if len(args) == 0 {
+		for _, r := range append(review.ListAll(), review.ListArchived()...) {
+			if r.Submitted {
+				reviews = append(reviews, r)
+			}
+		}
+	}
+	for _, arg := range args {
+		r, err := loadReview([]string{arg})
+		if err != nil {
+			return fmt.Errorf("%q: %v", arg, err)
+		}
+		reviews = append(reviews, *r)
+	}
+
+	var out io.Writer = os.Stdout
+	if *attestOutput != "" {
+		file, err := os.Create(*attestOutput)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		out = file
+	}
+	encoder := json.NewEncoder(out)
+	for i := range reviews {
+		statement := attestation.New(&reviews[i])
+		if !*attestSign {
+			if err := encoder.Encode(statement); err != nil {
+				return err
+			}
+			continue
+		}
+		envelope, err := statement.Sign()
+		if err != nil {
+			return err
+		}
+		if err := encoder.Encode(envelope); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// attestCmd defines the "attest" subcommand.
+var attestCmd = &Command{
+	Usage: func(arg0 string) {
+		fmt.Printf("Usage: %s attest <option>... [<review>...]\n\nOptions:\n", arg0)
+		attestFlagSet.PrintDefaults()
+	},
+	RunMethod: func(args []string) error {
+		return attest(args)
+	},
+}
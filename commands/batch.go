@@ -0,0 +1,241 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/google/git-appraise/repository"
+	"github.com/google/git-appraise/review"
+	"github.com/google/git-appraise/review/comment"
+	"github.com/google/git-appraise/review/gpg"
+	"github.com/google/git-appraise/review/request"
+)
+
+// The operations supported by the "batch" subcommand.
+const (
+	batchComment = "comment"
+	batchAccept  = "accept"
+	batchReject  = "reject"
+	batchRequest = "request"
+)
+
+// batchOperation is a single operation read by the "batch" subcommand.
+type batchOperation struct {
+	Op string `json:"op"`
+	// Review is the commit that identifies the review.
+	Review  string           `json:"review"`
+	Comment *comment.Comment `json:"comment,omitempty"`
+	Request *request.Request `json:"request,omitempty"`
+}
+
+// batchNotes collects the notes written by a batch, so that they can all be appended at the end.
+type batchNotes struct {
+	// reviews caches the reviews that have been loaded, keyed by their revision.
+	reviews map[string]*review.Review
+	// notes holds the notes to append to each revision, keyed by the notes ref.
+	notes map[string]map[string][]repository.Note
+	count int
+}
+
+// getReview returns the full revision of the given commit, and the review it identifies (if any).
+func (b *batchNotes) getReview(commit string) (string, *review.Review, error) {
+	revision, err := repository.ResolveCommit(commit)
+	if err != nil {
+		return "", nil, fmt.Errorf("Unknown commit %q", commit)
+	}
+	r, ok := b.reviews[revision]
+	if !ok {
+		r = review.Get(revision)
+		b.reviews[revision] = r
+	}
+	return revision, r, nil
+}
+
+func (b *batchNotes) add(notesRef, revision string, note repository.Note) {
+	if b.notes[notesRef] == nil {
+		b.notes[notesRef] = make(map[string][]repository.Note)
+	}
+	b.notes[notesRef][revision] = append(b.notes[notesRef][revision], note)
+	b.count++
+}
+
+// addComment queues the comment that an operation adds to an existing review.
+func (b *batchNotes) addComment(op batchOperation) error {
+	_, r, err := b.getReview(op.Review)
+	if err != nil {
+		return err
+	}
+	if r == nil {
+		return fmt.Errorf("There is no review for the commit %q", op.Review)
+	}
+	var c comment.Comment
+	if op.Comment != nil {
+		c = *op.Comment
+	}
+	if op.Op != batchComment {
+		resolved := op.Op == batchAccept
+		c.Resolved = &resolved
+		if c.Location == nil {
+			commit, err := repository.ResolveCommit(r.Request.ReviewRef)
+			if err != nil {
+				commit = r.Revision
+			}
+			c.Location = &comment.Location{Commit: commit}
+		}
+	}
+	if err := r.CheckAcceptance(c); err != nil {
+		return err
+	}
+	if c.Timestamp == "" {
+		c.Timestamp = strconv.FormatInt(time.Now().Unix(), 10)
+	}
+	if c.Author == "" {
+		c.Author = repository.GetUserEmail()
+	}
+	c.Signature = ""
+	if gpg.Enabled() {
+		if err := c.Sign(); err != nil {
+			return err
+		}
+	}
+	note, err := c.Write()
+	if err != nil {
+		return err
+	}
+	b.add(comment.Ref, r.Revision, note)
+	return nil
+}
+
+// addRequest queues a request that either starts a review, or updates an existing one.
+func (b *batchNotes) addRequest(op batchOperation) error {
+	if op.Request == nil {
+		return errors.New("The request operation requires a request")
+	}
+	revision, r, err := b.getReview(op.Review)
+	if err != nil {
+		return err
+	}
+	requestRef := request.Ref
+	if r != nil && r.Archived {
+		requestRef = request.ArchiveRef
+	}
+	req := *op.Request
+	if req.TargetRef == "" {
+		return errors.New("The request must include a target ref")
+	}
+	if req.Timestamp == "" {
+		req.Timestamp = strconv.FormatInt(time.Now().Unix(), 10)
+	}
+	if req.Requester == "" {
+		req.Requester = repository.GetUserEmail()
+	}
+	req.Signature = ""
+	if gpg.Enabled() {
+		if err := req.Sign(); err != nil {
+			return err
+		}
+	}
+	note, err := req.Write()
+	if err != nil {
+		return err
+	}
+	b.add(requestRef, revision, note)
+	if r == nil {
+		// Later operations in the batch may comment on the new review.
+		b.reviews[revision] = &review.Review{Revision: revision, Request: req}
+	}
+	return nil
+}
+
+// readBatch reads the operations from the given input, and queues the notes they write.
+//
+// Nothing is written unless every operation is valid.
+func readBatch(input io.Reader) (*batchNotes, error) {
+	b := &batchNotes{
+		reviews: make(map[string]*review.Review),
+		notes:   make(map[string]map[string][]repository.Note),
+	}
+	decoder := json.NewDecoder(input)
+	for i := 1; ; i++ {
+		var op batchOperation
+		if err := decoder.Decode(&op); err == io.EOF {
+			return b, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("Failed to read operation %d: %v", i, err)
+		}
+		var err error
+		switch op.Op {
+		case batchComment, batchAccept, batchReject:
+			err = b.addComment(op)
+		case batchRequest:
+			err = b.addRequest(op)
+		default:
+			err = fmt.Errorf("Unknown operation %q", op.Op)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Invalid operation %d: %v", i, err)
+		}
+	}
+}
+
+// applyBatch reads a stream of JSON operations from stdin, and applies them all at once.
+func applyBatch(args []string) error {
+	if len(args) > 0 {
+		return errors.New("The batch command does not take any arguments.")
+	}
+	b, err := readBatch(os.Stdin)
+	if err != nil {
+		return err
+	}
+	for notesRef, notes := range b.notes {
+		if err := repository.AppendNotes(notesRef, notes); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("Applied %d operations.\n", b.count)
+	return nil
+}
+
+// batchCmd defines the "batch" subcommand.
+var batchCmd = &Command{
+	Usage: func(arg0 string) {
+		fmt.Printf(`Usage: %s batch < <operations>
+
+Reads JSON operations from stdin, and applies them all at once. Each operation
+is an object of one of the following forms:
+
+  {"op": "comment", "review": "<commit>", "comment": {<comment>}}
+  {"op": "accept", "review": "<commit>", "comment": {<comment>}}
+  {"op": "reject", "review": "<commit>", "comment": {<comment>}}
+  {"op": "request", "review": "<commit>", "request": {<request>}}
+
+The comments and requests use the same format as the notes that store them.
+Nothing is written if any of the operations is invalid.
+`, arg0)
+	},
+	RunMethod: func(args []string) error {
+		return applyBatch(args)
+	},
+	Mutates: true,
+}
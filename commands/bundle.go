@@ -0,0 +1,64 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/git-appraise/repository"
+)
+
+// bundleRemoteName is the name under which notes read from a bundle are tracked.
+const bundleRemoteName = "bundle"
+
+// bundleNotes writes the local review notes to a bundle file.
+func bundleNotes(args []string) error {
+	if len(args) != 1 {
+		return errors.New("Exactly one bundle file must be specified.")
+	}
+	return repository.CreateNotesBundle(args[0], notesRefPattern)
+}
+
+// unbundleNotes merges the review notes from a bundle file into the local notes.
+func unbundleNotes(args []string) error {
+	if len(args) != 1 {
+		return errors.New("Exactly one bundle file must be specified.")
+	}
+	return repository.ImportNotes(args[0], bundleRemoteName, notesRefPattern)
+}
+
+// bundleCmd defines the "bundle" subcommand.
+var bundleCmd = &Command{
+	Usage: func(arg0 string) {
+		fmt.Printf("Usage: %s bundle <file>\n", arg0)
+	},
+	RunMethod: func(args []string) error {
+		return bundleNotes(args)
+	},
+}
+
+// unbundleCmd defines the "unbundle" subcommand.
+var unbundleCmd = &Command{
+	Usage: func(arg0 string) {
+		fmt.Printf("Usage: %s unbundle <file>\n", arg0)
+	},
+	RunMethod: func(args []string) error {
+		return unbundleNotes(args)
+	},
+	Mutates: true,
+}
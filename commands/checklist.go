@@ -0,0 +1,209 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+
+	"github.com/google/git-appraise/repository"
+	"github.com/google/git-appraise/review"
+	"github.com/google/git-appraise/review/checklist"
+)
+
+var checklistFlagSet = flag.NewFlagSet("checklist", flag.ExitOnError)
+
+var (
+	checklistReview     = checklistFlagSet.String("review", "", "Commit of the review whose checklist to use, instead of the current review")
+	checklistJsonOutput = checklistFlagSet.Bool("json", false, "Format the checklist as JSON")
+)
+
+// findChecklistItem returns the item of the checklist that the given argument
+// refers to, either by its text or by its (1-based) number.
+func findChecklistItem(items []string, arg string) (string, error) {
+	for _, item := range items {
+		if item == arg {
+			return item, nil
+		}
+	}
+	if n, err := strconv.Atoi(arg); err == nil && n >= 1 && n <= len(items) {
+		return items[n-1], nil
+	}
+	return "", fmt.Errorf("The review's checklist has no item %q.", arg)
+}
+
+// updateChecklist records a new version of the review request with the given checklist items.
+func updateChecklist(r *review.Review, items []string) error {
+	updated := r.Request
+	updated.Checklist = items
+	return r.UpdateRequest(updated)
+}
+
+// addChecklistItems adds the given items to the end of the review's checklist, skipping any that it already has.
+func addChecklistItems(r *review.Review, newItems []string) error {
+	items := append([]string(nil), r.Request.Checklist...)
+	existing := make(map[string]bool)
+	for _, item := range items {
+		existing[item] = true
+	}
+	for _, item := range newItems {
+		if err := checklist.ValidateItem(item); err != nil {
+			return err
+		}
+		if !existing[item] {
+			existing[item] = true
+			items = append(items, item)
+		}
+	}
+	added := len(items) - len(r.Request.Checklist)
+	if added == 0 {
+		return errors.New("The review's checklist already has the given items.")
+	}
+	if err := updateChecklist(r, items); err != nil {
+		return err
+	}
+	fmt.Printf("Added %d items to the checklist of the review %s\n", added, r.Revision)
+	return nil
+}
+
+// removeChecklistItems removes the given items from the review's checklist.
+func removeChecklistItems(r *review.Review, args []string) error {
+	removed := make(map[string]bool)
+	for _, arg := range args {
+		item, err := findChecklistItem(r.Request.Checklist, arg)
+		if err != nil {
+			return err
+		}
+		removed[item] = true
+	}
+	var items []string
+	for _, item := range r.Request.Checklist {
+		if !removed[item] {
+			items = append(items, item)
+		}
+	}
+	if err := updateChecklist(r, items); err != nil {
+		return err
+	}
+	fmt.Printf("Removed %d items from the checklist of the review %s\n", len(removed), r.Revision)
+	return nil
+}
+
+// markChecklistItems checks off the given items of the review's checklist, or unchecks them.
+func markChecklistItems(r *review.Review, args []string, unchecked bool) error {
+	var notes []repository.Note
+	for _, arg := range args {
+		item, err := findChecklistItem(r.Request.Checklist, arg)
+		if err != nil {
+			return err
+		}
+		mark := checklist.New(item, unchecked)
+		note, err := mark.Write()
+		if err != nil {
+			return err
+		}
+		notes = append(notes, note)
+	}
+	return repository.AppendNotes(checklist.Ref, map[string][]repository.Note{r.Revision: notes})
+}
+
+// printChecklist prints the items of the review's checklist, and whether each has been checked off.
+func printChecklist(r *review.Review) error {
+	status := r.ChecklistStatus()
+	if *checklistJsonOutput {
+		if status == nil {
+			status = []checklist.Item{}
+		}
+		return printJson(status)
+	}
+	if len(status) == 0 {
+		fmt.Println("The review has no checklist.")
+		return nil
+	}
+	for i, item := range status {
+		if item.Checked {
+			fmt.Printf("%d. [x] %s (%s)\n", i+1, item.Text, item.CheckedBy)
+		} else {
+			fmt.Printf("%d. [ ] %s\n", i+1, item.Text)
+		}
+	}
+	return nil
+}
+
+// checklists attaches checklists to reviews, edits them, checks their items off, or shows their completion state.
+func checklists(args []string) error {
+	action := ""
+	if len(args) > 0 {
+		switch args[0] {
+		case "attach", "add", "remove", "check", "uncheck":
+			action = args[0]
+			args = args[1:]
+		}
+	}
+	checklistFlagSet.Parse(args)
+	args = checklistFlagSet.Args()
+
+	var reviewArgs []string
+	if *checklistReview != "" {
+		reviewArgs = []string{*checklistReview}
+	}
+	r, err := loadReview(reviewArgs)
+	if err != nil {
+		return err
+	}
+
+	switch action {
+	case "attach":
+		if len(args) != 0 {
+			return errors.New("The attach action takes no arguments; use \"add\" to add items.")
+		}
+		items := loadChecklistTemplate(r.Request.TargetRef)
+		if items == nil {
+			return fmt.Errorf("There is no checklist template in %s.", r.Request.TargetRef)
+		}
+		return addChecklistItems(r, items)
+	case "add", "remove", "check", "uncheck":
+		if len(args) == 0 {
+			return errors.New("At least one checklist item must be given.")
+		}
+		switch action {
+		case "add":
+			return addChecklistItems(r, args)
+		case "remove":
+			return removeChecklistItems(r, args)
+		}
+		return markChecklistItems(r, args, action == "uncheck")
+	}
+	if len(args) != 0 {
+		return errors.New("The action must be \"attach\", \"add\", \"remove\", \"check\", or \"uncheck\".")
+	}
+	return printChecklist(r)
+}
+
+// checklistCmd defines the "checklist" subcommand.
+var checklistCmd = &Command{
+	Usage: func(arg0 string) {
+		fmt.Printf("Usage: %s checklist [attach|add|remove|check|uncheck] <option>... [<item>...]\n\nWithout an action, shows the review's checklist. Items can be given by their text or their number.\n\nOptions:\n", arg0)
+		checklistFlagSet.PrintDefaults()
+	},
+	RunMethod: func(args []string) error {
+		return checklists(args)
+	},
+	Mutates: true,
+}
@@ -0,0 +1,146 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/git-appraise/repository"
+	"github.com/google/git-appraise/review/ci"
+)
+
+var ciReportFlagSet = flag.NewFlagSet("ci-report", flag.ExitOnError)
+
+var (
+	ciReportStatus   = ciReportFlagSet.String("status", "", "Result of the check: \"pass\" or \"fail\"")
+	ciReportCheck    = ciReportFlagSet.String("check", "", "Name of the check that was run, e.g. \"build\" or \"unit tests\"")
+	ciReportURL      = ciReportFlagSet.String("url", "", "URL of the build's results")
+	ciReportAgent    = ciReportFlagSet.String("agent", "", "Name of the CI system; detected from the environment by default")
+	ciReportDuration = ciReportFlagSet.Duration("duration", 0, "How long the check took to run, e.g. \"3m20s\"")
+	ciReportRequired = ciReportFlagSet.Bool("required", false, "Require the check to pass before reviews of the commit can be submitted")
+	ciReportCommit   = ciReportFlagSet.String("commit", "HEAD", "Commit that was built")
+	ciReportRemote   = ciReportFlagSet.String("remote", "", "Remote to push the CI notes to; defaults to the \"appraise.remote\" config setting, or \"origin\"")
+	ciReportNoPush   = ciReportFlagSet.Bool("no-push", false, "Only record the report locally, without pushing it")
+	ciReportRetries  = ciReportFlagSet.Int("retries", defaultPushRetries, "Number of times to merge and retry a rejected push")
+)
+
+// ciAgentEnvironment maps environment variables set by CI systems to the names of those systems.
+var ciAgentEnvironment = []struct {
+	Variable string
+	Agent    string
+}{
+	{"JENKINS_URL", "jenkins"},
+	{"GITHUB_ACTIONS", "github-actions"},
+	{"GITLAB_CI", "gitlab-ci"},
+	{"BUILDKITE", "buildkite"},
+	{"CIRCLECI", "circleci"},
+	{"TRAVIS", "travis-ci"},
+	{"TEAMCITY_VERSION", "teamcity"},
+	{"TF_BUILD", "azure-pipelines"},
+}
+
+// detectCIAgent returns the name of the CI system running the command, or an empty string if it is not known.
+func detectCIAgent() string {
+	for _, candidate := range ciAgentEnvironment {
+		if os.Getenv(candidate.Variable) != "" {
+			return candidate.Agent
+		}
+	}
+	return ""
+}
+
+// parseCIStatus returns the status of a CI report for the given result of a check.
+func parseCIStatus(status string) (string, error) {
+	switch strings.ToLower(status) {
+	case "pass", "passed", ci.StatusSuccess:
+		return ci.StatusSuccess, nil
+	case "fail", "failed", ci.StatusFailure:
+		return ci.StatusFailure, nil
+	}
+	return "", fmt.Errorf("Invalid status %q; it must be \"pass\" or \"fail\"", status)
+}
+
+// pushCIReports pushes the local CI notes to the given remote, leaving the other review notes alone.
+func pushCIReports(remote string, retries int) error {
+	remoteNotesRefPattern, err := getRemoteNotesRefPattern(remote)
+	if err != nil {
+		return err
+	}
+	remoteRef := strings.TrimSuffix(remoteNotesRefPattern, "*") + strings.TrimPrefix(ci.Ref, devtoolsNotesPrefix)
+	return repository.PushNotesWithRetry(remote, ci.Ref, remoteRef, retries)
+}
+
+// ciReport records the result of a CI check on a commit, and pushes it.
+func ciReport(args []string) error {
+	ciReportFlagSet.Parse(args)
+	if len(ciReportFlagSet.Args()) > 0 {
+		return errors.New("Unexpected arguments; the commit is given with --commit.")
+	}
+	status, err := parseCIStatus(*ciReportStatus)
+	if err != nil {
+		return err
+	}
+	commit, err := repository.ResolveCommit(*ciReportCommit)
+	if err != nil {
+		return fmt.Errorf("Cannot resolve the commit %q: %v", *ciReportCommit, err)
+	}
+	agent := *ciReportAgent
+	if agent == "" {
+		agent = detectCIAgent()
+	}
+	report := ci.Report{
+		Timestamp: strconv.FormatInt(time.Now().Unix(), 10),
+		URL:       *ciReportURL,
+		Status:    status,
+		Agent:     agent,
+		Name:      *ciReportCheck,
+		Duration:  int64(ciReportDuration.Seconds()),
+		Required:  *ciReportRequired,
+		Version:   ci.FormatVersion,
+	}
+	note, err := report.Write()
+	if err != nil {
+		return err
+	}
+	repository.AppendNote(ci.Ref, commit, note)
+	if *ciReportNoPush {
+		return nil
+	}
+	var remoteArgs []string
+	if *ciReportRemote != "" {
+		remoteArgs = []string{*ciReportRemote}
+	}
+	return pushCIReports(getRemote(remoteArgs), *ciReportRetries)
+}
+
+// ciReportCmd defines the "ci-report" subcommand.
+var ciReportCmd = &Command{
+	Usage: func(arg0 string) {
+		fmt.Printf("Usage: %s ci-report --status pass|fail <option>...\n\nOptions:\n", arg0)
+		ciReportFlagSet.PrintDefaults()
+	},
+	RunMethod: func(args []string) error {
+		return ciReport(args)
+	},
+	Mutates: true,
+}
@@ -0,0 +1,51 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/google/git-appraise/repository"
+	"github.com/google/git-appraise/review"
+)
+
+// colorConfig is the git config setting that controls whether the output is colored.
+//
+// Like git's own "color.<command>" settings, it may be "auto", "always",
+// "never", "true", or "false", and falls back to the "color.ui" setting.
+const colorConfig = "color.appraise"
+
+// ColorMode is the value of the "--color" flag, which overrides the colorConfig setting when set.
+var ColorMode string
+
+// setUpColor enables colored output if the "--color" flag or the git config asks for it.
+func setUpColor() error {
+	switch ColorMode {
+	case "always":
+		review.EnableColor(true)
+	case "never":
+		review.EnableColor(false)
+	case "auto":
+		review.EnableColor(isTerminal(os.Stdout))
+	case "":
+		review.EnableColor(repository.GetColorBool(colorConfig, isTerminal(os.Stdout)))
+	default:
+		return fmt.Errorf("Invalid value %q for --color: it must be \"auto\", \"always\", or \"never\"", ColorMode)
+	}
+	return nil
+}
@@ -17,12 +17,46 @@ limitations under the License.
 // Package commands contains the assorted sub commands supported by the git-appraise tool.
 package commands
 
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/google/git-appraise/repository"
+)
+
 const notesRefPattern = "refs/notes/devtools/*"
 
 // Command represents the definition of a single command.
 type Command struct {
 	Usage     func(string)
 	RunMethod func([]string) error
+
+	// Mutates indicates that the command modifies the repository, and so
+	// must not run concurrently with other such commands.
+	Mutates bool
+
+	// OutsideRepo indicates that the command can be run outside of a git repository.
+	OutsideRepo bool
+
+	// Paged indicates that the command's output may be long, and so should be
+	// sent through the user's pager when written to a terminal.
+	Paged bool
+}
+
+// lockRepository acquires the lock that serializes modifications of the
+// repository, and marks the hooks that git runs while it is held as nested.
+func lockRepository() (func(), error) {
+	unlock, err := repository.Lock()
+	if err != nil {
+		return nil, err
+	}
+	os.Setenv(hookEnv, "1")
+	return func() {
+		os.Unsetenv(hookEnv)
+		unlock()
+	}, nil
 }
 
 // Run executes a command, given its arguments.
@@ -30,17 +64,101 @@ type Command struct {
 // The args parameter is all of the command line args that followed the
 // subcommand.
 func (cmd *Command) Run(args []string) error {
+	if cmd.Mutates {
+		unlock, err := lockRepository()
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+	// Whether to use color depends on whether the output is a terminal, so
+	// that must be decided before the output is redirected to the pager.
+	if err := setUpColor(); err != nil {
+		return err
+	}
+	if cmd.Paged && !NoPager {
+		stopPager, err := startPager()
+		if err != nil {
+			return err
+		}
+		defer stopPager()
+	}
 	return cmd.RunMethod(args)
 }
 
+// printJson prints the given value as indented JSON.
+func printJson(v interface{}) error {
+	jsonBytes, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	var prettyBytes bytes.Buffer
+	if err := json.Indent(&prettyBytes, jsonBytes, "", "  "); err != nil {
+		return err
+	}
+	fmt.Println(prettyBytes.String())
+	return nil
+}
+
 // CommandMap defines all of the available (sub)commands.
 var CommandMap = map[string]*Command{
-	"accept":  acceptCmd,
-	"comment": commentCmd,
-	"list":    listCmd,
-	"pull":    pullCmd,
-	"push":    pushCmd,
-	"request": requestCmd,
-	"show":    showCmd,
-	"submit":  submitCmd,
+	"abandon":          abandonCmd,
+	"ack":              ackCmd,
+	"accept":           acceptCmd,
+	"amend":            amendCmd,
+	"analyze":          analyzeCmd,
+	"annotations":      annotationsCmd,
+	"apply-notes":      applyNotesCmd,
+	"apply-suggestion": applySuggestionCmd,
+	"archive-release":  archiveReleaseCmd,
+	"assign":           assignCmd,
+	"attest":           attestCmd,
+	"batch":            batchCmd,
+	"bundle":           bundleCmd,
+	"checklist":        checklistCmd,
+	"ci-report":        ciReportCmd,
+	"comment":          commentCmd,
+	"conflicts":        conflictsCmd,
+	"completion":       completionCmd,
+	"daemon":           daemonCmd,
+	"diff":             diffCmd,
+	"events":           eventsCmd,
+	"export":           exportCmd,
+	"export-site":      exportSiteCmd,
+	"format-notes":     formatNotesCmd,
+	"gc":               gcCmd,
+	"hook":             hookCmd,
+	"import":           importCmd,
+	"import-patches":   importPatchesCmd,
+	"ingest-mail":      ingestMailCmd,
+	"init-hooks":       initHooksCmd,
+	"label":            labelCmd,
+	"lint":             lintCmd,
+	"list":             listCmd,
+	"migrate":          migrateCmd,
+	"milestone":        milestoneCmd,
+	"migrate-notes":    migrateNotesCmd,
+	"mirror":           mirrorCmd,
+	"nudge":            nudgeCmd,
+	"prune":            pruneCmd,
+	"publish":          publishCmd,
+	"pull":             pullCmd,
+	"push":             pushCmd,
+	"rebase":           rebaseCmd,
+	"reject":           rejectCmd,
+	"reopen":           reopenCmd,
+	"request":          requestCmd,
+	"resolve":          resolveCmd,
+	"schedule":         scheduleCmd,
+	"search":           searchCmd,
+	"show":             showCmd,
+	"stats":            statsCmd,
+	"status":           statusCmd,
+	"submit":           submitCmd,
+	"sync":             syncCmd,
+	"tui":              tuiCmd,
+	"unbundle":         unbundleCmd,
+	"viewed":           viewedCmd,
+	"watch":            watchCmd,
+	"web":              webCmd,
 }
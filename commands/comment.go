@@ -23,7 +23,10 @@ import (
 	"github.com/google/git-appraise/repository"
 	"github.com/google/git-appraise/review"
 	"github.com/google/git-appraise/review/comment"
+	"io/ioutil"
+	"os"
 	"strconv"
+	"strings"
 )
 
 var commentFlagSet = flag.NewFlagSet("comment", flag.ExitOnError)
@@ -31,10 +34,136 @@ var commentFlagSet = flag.NewFlagSet("comment", flag.ExitOnError)
 var (
 	commentMessage = commentFlagSet.String("m", "", "Message to attach to the review")
 	parent         = commentFlagSet.String("p", "", "Parent comment")
+	commentFile    = commentFlagSet.String("f", "", "File being commented upon")
+	commentLines   = commentFlagSet.String("l", "", "Line, or range of lines (e.g. 10-12), being commented upon. This requires -f or -commit-message")
+	commentOnMsg   = commentFlagSet.Bool("commit-message", false, "Comment upon the commit message rather than a file")
 	lgtm           = commentFlagSet.Bool("lgtm", false, "'Looks Good To Me'. Set this to express your approval. This cannot be combined with nmw")
 	nmw            = commentFlagSet.Bool("nmw", false, "'Needs More Work'. Set this to express your disapproval. This cannot be combined with lgtm")
+	commentJson    = commentFlagSet.Bool("json", false, "Format the output as JSON")
+	commentDraft   = commentFlagSet.Bool("draft", false, "Save the comment as a draft, to be published later with the \"publish\" command")
+	commentEdit    = commentFlagSet.String("edit", "", "Hash of one of your earlier comments, whose message to replace")
+	commentRetract = commentFlagSet.String("retract", "", "Hash of one of your earlier comments, to retract")
+	commentSuggest = commentFlagSet.Bool("suggest", false, "Suggest an edit to the commented lines, which is written in the editor (or read from stdin)")
+	severity       = commentFlagSet.String("severity", "", "Severity of a new thread: \"blocking\" (prevents submitting the review until resolved), \"suggestion\", or \"nit\"")
+	commentReview  = commentFlagSet.String("review", "", "Review to comment on, given by its commit, branch, or a unique part of its description, instead of the current review")
 )
 
+func init() {
+	commentFlagSet.StringVar(parent, "parent", "", "Parent comment, when replying to it")
+}
+
+// parseLineRange parses a line number (e.g. "10") or an inclusive range of lines (e.g. "10-12").
+func parseLineRange(lines string) (*comment.Range, error) {
+	parts := strings.SplitN(lines, "-", 2)
+	startLine, err := strconv.ParseUint(parts[0], 0, 32)
+	if err != nil || startLine == 0 {
+		return nil, fmt.Errorf("Invalid line %q", lines)
+	}
+	lineRange := &comment.Range{StartLine: uint32(startLine)}
+	if len(parts) == 2 {
+		endLine, err := strconv.ParseUint(parts[1], 0, 32)
+		if err != nil || endLine < startLine {
+			return nil, fmt.Errorf("Invalid range of lines %q", lines)
+		}
+		if endLine > startLine {
+			lineRange.EndLine = uint32(endLine)
+		}
+	}
+	return lineRange, nil
+}
+
+// findThread returns the comment thread with the given hash, or nil if there is none.
+func findThread(threads []review.CommentThread, hash string) *review.CommentThread {
+	for i := range threads {
+		if threads[i].Hash == hash {
+			return &threads[i]
+		}
+		if thread := findThread(threads[i].Children, hash); thread != nil {
+			return thread
+		}
+	}
+	return nil
+}
+
+// hasThread reports whether the given comment threads include one with the given hash.
+func hasThread(threads []review.CommentThread, hash string) bool {
+	return findThread(threads, hash) != nil
+}
+
+// amendComment edits or retracts one of the user's earlier comments on the review.
+func amendComment(r *review.Review, hash string, retract bool) error {
+	thread := findThread(r.Comments, hash)
+	if thread == nil {
+		return fmt.Errorf("There is no comment %q on the current review.", hash)
+	}
+	if thread.Comment.Author != repository.GetUserEmail() {
+		return errors.New("Only the author of a comment can edit or retract it.")
+	}
+	if thread.Comment.Retracted {
+		return errors.New("The comment has already been retracted.")
+	}
+	message := *commentMessage
+	if !retract && message == "" {
+		if !isInteractive() {
+			return errors.New("The new message must be given with -m.")
+		}
+		var err error
+		message, err = editMessage(thread.Comment.Description, "Editing the comment "+hash)
+		if err != nil {
+			return err
+		}
+	}
+	c := comment.New(message)
+	c.Original = hash
+	c.Retracted = retract
+	return addComment(r, c, *commentJson)
+}
+
+// readSuggestion reads the replacement for the lines at the given location
+// of the commit, either from the editor, which starts out with those lines, or
+// from stdin if there is no terminal.
+func readSuggestion(commit string, location comment.Location) (string, error) {
+	contents, err := repository.GetFileContents(commit, location.Path)
+	if err != nil {
+		return "", fmt.Errorf("Cannot read %s: %v", location.Path, err)
+	}
+	lines, err := review.SuggestedLines(&location, contents)
+	if err != nil {
+		return "", err
+	}
+	original := strings.Join(lines, "\n")
+	var suggestion string
+	if isInteractive() {
+		suggestion, err = editText(original + "\n")
+	} else {
+		var input []byte
+		input, err = ioutil.ReadAll(os.Stdin)
+		suggestion = string(input)
+	}
+	if err != nil {
+		return "", err
+	}
+	suggestion = strings.TrimSuffix(suggestion, "\n")
+	if suggestion == original {
+		return "", errors.New("The suggested edit does not change the lines.")
+	}
+	return suggestion, nil
+}
+
+// hasDraft reports whether the review has a draft comment with the given hash.
+func hasDraft(r *review.Review, hash string) (bool, error) {
+	drafts, err := r.Drafts()
+	if err != nil {
+		return false, err
+	}
+	for _, draft := range drafts {
+		if draftHash, err := draft.Comment.Hash(); err == nil && draftHash == hash {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
 // commentOnReview adds a comment to the current code review.
 func commentOnReview(args []string) error {
 	commentFlagSet.Parse(args)
@@ -43,48 +172,161 @@ func commentOnReview(args []string) error {
 		return errors.New("You cannot combine the flags -lgtm and -nmw.")
 	}
 
-	r, err := review.GetCurrent()
-	if err != nil {
-		return fmt.Errorf("Failed to load the current review: %v\n", err)
+	var r *review.Review
+	var err error
+	if *commentReview != "" {
+		if r, err = loadReview([]string{*commentReview}); err != nil {
+			return err
+		}
+	} else {
+		r, err = review.GetCurrent()
+		if err != nil {
+			return fmt.Errorf("Failed to load the current review: %v\n", err)
+		}
+		if r == nil {
+			return errors.New("There is no current review.")
+		}
 	}
-	if r == nil {
-		return errors.New("There is no current review.")
+
+	if *commentEdit != "" || *commentRetract != "" {
+		if *commentEdit != "" && *commentRetract != "" {
+			return errors.New("A comment cannot be both edited and retracted at once.")
+		}
+		if *parent != "" || *commentFile != "" || *commentOnMsg || len(args) > 0 || *lgtm || *nmw || *commentDraft || *commentSuggest || *severity != "" {
+			return errors.New("Only -m and -json can be combined with -edit or -retract.")
+		}
+		if *commentRetract != "" {
+			return amendComment(r, *commentRetract, true)
+		}
+		return amendComment(r, *commentEdit, false)
 	}
 
-	commentedUponCommit := repository.GetCommitHash(r.Request.ReviewRef)
+	commentedUponCommit, err := r.HeadCommit()
+	if err != nil {
+		return err
+	}
 	location := comment.Location{
 		Commit: commentedUponCommit,
 	}
+	if *commentOnMsg {
+		if *commentFile != "" || len(args) > 0 {
+			return errors.New("A comment cannot be about both the commit message and a file.")
+		}
+		location.CommitMessage = true
+		if *commentLines != "" {
+			lineRange, err := parseLineRange(*commentLines)
+			if err != nil {
+				return err
+			}
+			messageLines := len(strings.Split(repository.GetCommitMessage(commentedUponCommit), "\n"))
+			if lineRange.StartLine > uint32(messageLines) || lineRange.EndLine > uint32(messageLines) {
+				return fmt.Errorf("The range of lines %q is past the end of the commit message.", *commentLines)
+			}
+			location.Range = lineRange
+		}
+	} else if *commentLines != "" && *commentFile == "" {
+		return errors.New("The -l flag requires -f or -commit-message.")
+	}
+	if *commentFile != "" {
+		if len(args) > 0 {
+			return errors.New("The file and line cannot be given both as flags and as arguments.")
+		}
+		args = []string{*commentFile}
+		if *commentLines != "" {
+			args = append(args, *commentLines)
+		}
+	}
 	if len(args) > 0 {
 		location.Path = args[0]
 		if len(args) > 1 {
-			startLine, err := strconv.ParseUint(args[1], 0, 32)
+			lineRange, err := parseLineRange(args[1])
 			if err != nil {
 				return err
 			}
-			location.Range = &comment.Range{
-				StartLine: uint32(startLine),
+			location.Range = lineRange
+		}
+	}
+	if *parent != "" && !hasThread(r.Comments, *parent) {
+		// Drafts may reply to other drafts, since they will be published together.
+		isDraft, err := hasDraft(r, *parent)
+		if err != nil {
+			return err
+		}
+		if !*commentDraft || !isDraft {
+			return fmt.Errorf("There is no comment %q on the current review.", *parent)
+		}
+	}
+
+	if *severity != "" {
+		if err := comment.ValidateSeverity(*severity); err != nil {
+			return err
+		}
+		if *parent != "" {
+			return errors.New("Only the first comment of a thread can have a severity.")
+		}
+		if (*lgtm || *nmw) && location.IsWholeCommit() {
+			return errors.New("A vote on the review as a whole cannot have a severity.")
+		}
+	}
+
+	var suggestion *string
+	if *commentSuggest {
+		if location.Path == "" || location.Range == nil {
+			return errors.New("A suggested edit requires the file and lines that it replaces.")
+		}
+		s, err := readSuggestion(commentedUponCommit, location)
+		if err != nil {
+			return err
+		}
+		suggestion = &s
+	}
+
+	message := *commentMessage
+	if message == "" && isInteractive() {
+		context := fmt.Sprintf("Commenting on the review of %s:\n%q", r.Revision, r.Request.Description)
+		if location.Path != "" {
+			context += "\nFile: " + location.Path
+			if location.Range != nil {
+				context += fmt.Sprintf(", line %d", location.Range.StartLine)
 			}
+		} else if location.CommitMessage {
+			context += "\nThe commit message of " + commentedUponCommit
+			if location.Range != nil {
+				context += fmt.Sprintf(", line %d", location.Range.StartLine)
+			}
+		}
+		if *parent != "" {
+			context += "\nIn reply to: " + *parent
+		}
+		message, err = editMessage("", context)
+		if err != nil {
+			return err
 		}
 	}
 
-	c := comment.New(*commentMessage)
+	c := comment.New(message)
 	c.Location = &location
 	c.Parent = *parent
+	c.Suggestion = suggestion
+	c.Severity = *severity
 	if *lgtm || *nmw {
 		resolved := *lgtm
 		c.Resolved = &resolved
 	}
-	return r.AddComment(c)
+	if *commentDraft {
+		return addDraft(r, c, *commentJson)
+	}
+	return addComment(r, c, *commentJson)
 }
 
 // commentCmd defines the "comment" subcommand.
 var commentCmd = &Command{
 	Usage: func(arg0 string) {
-		fmt.Printf("Usage: %s comment <option>... [<file> [<line>]]\n\nOptions:\n", arg0)
+		fmt.Printf("Usage: %s comment <option>... [<file> [<line>[-<end line>]]]\n\nOptions:\n", arg0)
 		commentFlagSet.PrintDefaults()
 	},
 	RunMethod: func(args []string) error {
 		return commentOnReview(args)
 	},
+	Mutates: true,
 }
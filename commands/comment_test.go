@@ -0,0 +1,43 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"testing"
+)
+
+func TestParseLineRange(t *testing.T) {
+	valid := map[string][2]uint32{
+		"10":    {10, 0},
+		"10-12": {10, 12},
+		"7-7":   {7, 0},
+	}
+	for lines, expected := range valid {
+		lineRange, err := parseLineRange(lines)
+		if err != nil {
+			t.Fatalf("Unexpected error parsing %q: %v", lines, err)
+		}
+		if lineRange.StartLine != expected[0] || lineRange.EndLine != expected[1] {
+			t.Errorf("Unexpected range for %q: %+v", lines, *lineRange)
+		}
+	}
+	for _, lines := range []string{"", "0", "x", "12-10", "10-", "-3"} {
+		if _, err := parseLineRange(lines); err == nil {
+			t.Errorf("Expected %q to be rejected", lines)
+		}
+	}
+}
@@ -0,0 +1,362 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/git-appraise/repository"
+	"github.com/google/git-appraise/review"
+)
+
+// completionFlagSets maps the name of every subcommand to its flags, or nil if it has none.
+//
+// This cannot be derived from the CommandMap, since that includes the completion command itself.
+var completionFlagSets = map[string]*flag.FlagSet{
+	"abandon":          abandonFlagSet,
+	"ack":              nil,
+	"accept":           acceptFlagSet,
+	"amend":            amendFlagSet,
+	"analyze":          analyzeFlagSet,
+	"annotations":      annotationsFlagSet,
+	"apply-notes":      nil,
+	"apply-suggestion": applySuggestionFlagSet,
+	"archive-release":  archiveReleaseFlagSet,
+	"assign":           assignFlagSet,
+	"attest":           attestFlagSet,
+	"batch":            nil,
+	"bundle":           nil,
+	"checklist":        checklistFlagSet,
+	"ci-report":        ciReportFlagSet,
+	"comment":          commentFlagSet,
+	"conflicts":        conflictsFlagSet,
+	"completion":       nil,
+	"daemon":           daemonFlagSet,
+	"diff":             diffFlagSet,
+	"events":           eventsFlagSet,
+	"export":           exportFlagSet,
+	"export-site":      exportSiteFlagSet,
+	"format-notes":     formatNotesFlagSet,
+	"gc":               gcFlagSet,
+	"hook":             nil,
+	"import":           nil,
+	"import-patches":   importPatchesFlagSet,
+	"ingest-mail":      ingestMailFlagSet,
+	"init-hooks":       initHooksFlagSet,
+	"label":            labelFlagSet,
+	"lint":             lintFlagSet,
+	"list":             listFlagSet,
+	"migrate":          migrateFlagSet,
+	"milestone":        milestoneFlagSet,
+	"migrate-notes":    nil,
+	"mirror":           mirrorFlagSet,
+	"nudge":            nudgeFlagSet,
+	"prune":            pruneFlagSet,
+	"publish":          publishFlagSet,
+	"pull":             pullFlagSet,
+	"push":             pushFlagSet,
+	"rebase":           nil,
+	"reject":           rejectFlagSet,
+	"reopen":           reopenFlagSet,
+	"request":          requestFlagSet,
+	"resolve":          resolveFlagSet,
+	"schedule":         scheduleFlagSet,
+	"search":           searchFlagSet,
+	"show":             showFlagSet,
+	"stats":            statsFlagSet,
+	"status":           statusFlagSet,
+	"submit":           submitFlagSet,
+	"sync":             syncFlagSet,
+	"tui":              nil,
+	"unbundle":         nil,
+	"viewed":           viewedFlagSet,
+	"watch":            watchFlagSet,
+	"web":              webFlagSet,
+}
+
+// reviewArgCommands are the subcommands that take the hash of a review as an argument.
+var reviewArgCommands = []string{"abandon", "amend", "analyze", "attest", "diff", "export", "reopen", "schedule", "show"}
+
+// completionFlag is a single flag offered by the completion scripts.
+type completionFlag struct {
+	Name  string
+	Usage string
+}
+
+// completionCommandNames returns the sorted names of all of the subcommands.
+func completionCommandNames() []string {
+	var names []string
+	for name := range completionFlagSets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// completionFlags returns the flags of the given subcommand, in the form they are usually typed.
+func completionFlags(command string) []completionFlag {
+	var flags []completionFlag
+	if flagSet := completionFlagSets[command]; flagSet != nil {
+		flagSet.VisitAll(func(f *flag.Flag) {
+			name := "--" + f.Name
+			if len(f.Name) == 1 {
+				name = "-" + f.Name
+			}
+			flags = append(flags, completionFlag{name, f.Usage})
+		})
+	}
+	return flags
+}
+
+// shellQuote quotes a string for use as a single argument in bash or zsh.
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// fishQuote quotes a string for use as a single argument in fish, which escapes quotes with a backslash.
+func fishQuote(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	return "'" + strings.Replace(s, "'", `\'`, -1) + "'"
+}
+
+const bashCompletionTemplate = `# bash completion for git-appraise.
+#
+# To enable it, add the following to your ~/.bashrc:
+#   source <(git appraise completion bash)
+
+_git_appraise() {
+	local cur="${COMP_WORDS[COMP_CWORD]}"
+	local cmd i
+	for ((i = 1; i < COMP_CWORD; i++)); do
+		case "${COMP_WORDS[i]}" in
+		appraise) ;;
+		-C|--git-dir) ((i++)) ;;
+		-*) ;;
+		*) cmd="${COMP_WORDS[i]}"; break ;;
+		esac
+	done
+	if [ -z "$cmd" ]; then
+		COMPREPLY=($(compgen -W %s -- "$cur"))
+		return
+	fi
+	if [[ "$cur" == -* ]]; then
+		local flags
+		case "$cmd" in
+%s		esac
+		COMPREPLY=($(compgen -W "$flags" -- "$cur"))
+		return
+	fi
+	case "$cmd" in
+	%s)
+		COMPREPLY=($(compgen -W "$(git appraise completion reviews 2>/dev/null | cut -f1)" -- "$cur"))
+		;;
+	*)
+		COMPREPLY=($(compgen -f -- "$cur"))
+		;;
+	esac
+}
+
+complete -o default -F _git_appraise git-appraise
+`
+
+// bashCompletion generates the completion script for bash.
+func bashCompletion() string {
+	var flagCases bytes.Buffer
+	for _, command := range completionCommandNames() {
+		var names []string
+		for _, f := range completionFlags(command) {
+			names = append(names, f.Name)
+		}
+		if len(names) > 0 {
+			fmt.Fprintf(&flagCases, "\t\t%s) flags=%s ;;\n", command, shellQuote(strings.Join(names, " ")))
+		}
+	}
+	return fmt.Sprintf(bashCompletionTemplate,
+		shellQuote(strings.Join(completionCommandNames(), " ")),
+		flagCases.String(),
+		strings.Join(reviewArgCommands, "|"))
+}
+
+const zshCompletionTemplate = `#compdef git-appraise
+# zsh completion for git-appraise.
+#
+# To enable it, add the following to your ~/.zshrc (after running compinit):
+#   source <(git appraise completion zsh)
+
+_git-appraise() {
+	local -a commands flags reviews
+	local cmd i
+	for ((i = 2; i < CURRENT; i++)); do
+		case "${words[i]}" in
+		appraise) ;;
+		-C|--git-dir) ((i++)) ;;
+		-*) ;;
+		*) cmd="${words[i]}"; break ;;
+		esac
+	done
+	if [[ -z "$cmd" ]]; then
+		commands=(%s)
+		compadd -a commands
+		return
+	fi
+	if [[ "$PREFIX" == -* ]]; then
+		case "$cmd" in
+%s		esac
+		_describe -t flags 'flag' flags
+		return
+	fi
+	case "$cmd" in
+	%s)
+		reviews=(${(f)"$(git appraise completion reviews 2>/dev/null | sed -e 's/:/\\:/g' -e 's/	/:/')"})
+		_describe -t reviews 'review' reviews
+		;;
+	*)
+		_files
+		;;
+	esac
+}
+
+compdef _git-appraise git-appraise
+`
+
+// zshCompletion generates the completion script for zsh.
+func zshCompletion() string {
+	var quotedCommands []string
+	for _, command := range completionCommandNames() {
+		quotedCommands = append(quotedCommands, shellQuote(command))
+	}
+	var flagCases bytes.Buffer
+	for _, command := range completionCommandNames() {
+		var described []string
+		for _, f := range completionFlags(command) {
+			described = append(described, shellQuote(f.Name+":"+f.Usage))
+		}
+		if len(described) > 0 {
+			fmt.Fprintf(&flagCases, "\t\t%s) flags=(%s) ;;\n", command, strings.Join(described, " "))
+		}
+	}
+	return fmt.Sprintf(zshCompletionTemplate,
+		strings.Join(quotedCommands, " "),
+		flagCases.String(),
+		strings.Join(reviewArgCommands, "|"))
+}
+
+const fishCompletionHeader = `# fish completion for git-appraise.
+#
+# To enable it, run:
+#   git appraise completion fish > ~/.config/fish/completions/git-appraise.fish
+
+function __git_appraise_command
+	set -l skip 0
+	for token in (commandline -opc)[2..-1]
+		if test $skip = 1
+			set skip 0
+			continue
+		end
+		switch $token
+			case appraise
+			case -C --git-dir
+				set skip 1
+			case '-*'
+			case '*'
+				echo $token
+				return 0
+		end
+	end
+	return 1
+end
+
+function __git_appraise_needs_command
+	set -l cmd (__git_appraise_command)
+	test -z "$cmd"
+end
+
+function __git_appraise_using_command
+	set -l cmd (__git_appraise_command)
+	contains -- "$cmd" $argv
+end
+
+`
+
+// fishCompletion generates the completion script for fish.
+func fishCompletion() string {
+	var script bytes.Buffer
+	script.WriteString(fishCompletionHeader)
+	fmt.Fprintf(&script, "complete -c git-appraise -f -n __git_appraise_needs_command -a %s\n",
+		fishQuote(strings.Join(completionCommandNames(), " ")))
+	fmt.Fprintf(&script, "complete -c git-appraise -f -n %s -a '(git appraise completion reviews 2>/dev/null)'\n",
+		fishQuote("__git_appraise_using_command "+strings.Join(reviewArgCommands, " ")))
+	for _, command := range completionCommandNames() {
+		condition := fishQuote("__git_appraise_using_command " + command)
+		for _, f := range completionFlags(command) {
+			option := "-l " + strings.TrimPrefix(f.Name, "--")
+			if !strings.HasPrefix(f.Name, "--") {
+				option = "-s " + strings.TrimPrefix(f.Name, "-")
+			}
+			fmt.Fprintf(&script, "complete -c git-appraise -n %s %s -d %s\n", condition, option, fishQuote(f.Usage))
+		}
+	}
+	return script.String()
+}
+
+// printOpenReviews prints the hash and description of each open review, for use by the completion scripts.
+func printOpenReviews() error {
+	if !repository.IsGitRepo() {
+		return nil
+	}
+	for _, r := range review.ListOpen() {
+		description := strings.SplitN(r.Request.Description, "\n", 2)[0]
+		fmt.Printf("%s\t%s\n", r.Revision, description)
+	}
+	return nil
+}
+
+// printCompletion prints the completion script for the given shell.
+func printCompletion(args []string) error {
+	if len(args) != 1 {
+		return errors.New("Exactly one shell must be specified: bash, zsh, or fish.")
+	}
+	switch args[0] {
+	case "bash":
+		fmt.Print(bashCompletion())
+	case "zsh":
+		fmt.Print(zshCompletion())
+	case "fish":
+		fmt.Print(fishCompletion())
+	case "reviews":
+		return printOpenReviews()
+	default:
+		return fmt.Errorf("Unsupported shell %q: it must be bash, zsh, or fish.", args[0])
+	}
+	return nil
+}
+
+// completionCmd defines the "completion" subcommand.
+var completionCmd = &Command{
+	Usage: func(arg0 string) {
+		fmt.Printf("Usage: %s completion (bash|zsh|fish)\n\nPrints a script that completes the subcommands, flags, and open reviews in the given shell.\n", arg0)
+	},
+	RunMethod: func(args []string) error {
+		return printCompletion(args)
+	},
+	OutsideRepo: true,
+}
@@ -0,0 +1,43 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"testing"
+)
+
+func TestCompletionCoversAllCommands(t *testing.T) {
+	for name := range CommandMap {
+		if _, ok := completionFlagSets[name]; !ok {
+			t.Errorf("Command %q is missing from the completion flag sets", name)
+		}
+	}
+	for name := range completionFlagSets {
+		if _, ok := CommandMap[name]; !ok {
+			t.Errorf("Completion flag sets include the unknown command %q", name)
+		}
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	if quoted := shellQuote("it's"); quoted != `'it'\''s'` {
+		t.Errorf("Unexpected shell quoting: %s", quoted)
+	}
+	if quoted := fishQuote(`it's a \`); quoted != `'it\'s a \\'` {
+		t.Errorf("Unexpected fish quoting: %s", quoted)
+	}
+}
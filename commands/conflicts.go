@@ -0,0 +1,229 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/google/git-appraise/repository"
+	"github.com/google/git-appraise/review"
+	"github.com/google/git-appraise/review/comment"
+	"github.com/google/git-appraise/review/request"
+)
+
+var conflictsFlagSet = flag.NewFlagSet("conflicts", flag.ExitOnError)
+
+var conflictsList = conflictsFlagSet.Bool("list", false, "Only list the conflicts, without resolving them.")
+
+// conflictedReviews returns the reviews that have conflicting updates.
+func conflictedReviews() ([]review.Review, error) {
+	var conflicted []review.Review
+	err := review.ForEach(func(r review.Review) error {
+		if len(r.Conflicts()) > 0 {
+			conflicted = append(conflicted, r)
+		}
+		return nil
+	})
+	return conflicted, err
+}
+
+// printConflict describes the numbered alternatives of a conflict.
+func printConflict(conflict review.Conflict) {
+	if conflict.Comment == "" {
+		fmt.Println("  Conflicting updates to the review request:")
+	} else {
+		fmt.Printf("  Conflicting edits of the comment %s:\n", conflict.Comment)
+	}
+	for i, alternative := range conflict.Alternatives() {
+		fmt.Printf("    %d) %s\n", i+1, alternative)
+	}
+}
+
+// promptChoice asks the user to pick one of count alternatives, or to merge
+// them or skip the conflict, and returns the number picked (starting at one),
+// or "m" or "s".
+func promptChoice(input *bufio.Reader, count int) (string, error) {
+	for {
+		fmt.Printf("  Keep which one? [1-%d], m to merge them, or s to skip: ", count)
+		answer, err := input.ReadString('\n')
+		answer = strings.TrimSpace(answer)
+		if n, convErr := strconv.Atoi(answer); convErr == nil && n >= 1 && n <= count {
+			return answer, nil
+		}
+		if answer == "m" || answer == "s" {
+			return answer, nil
+		}
+		if err == io.EOF {
+			return "s", nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+}
+
+// mergeLists returns the union of the given lists, in the order in which the values first appear.
+func mergeLists(lists ...[]string) []string {
+	var merged []string
+	seen := make(map[string]bool)
+	for _, list := range lists {
+		for _, value := range list {
+			if !seen[value] {
+				seen[value] = true
+				merged = append(merged, value)
+			}
+		}
+	}
+	return merged
+}
+
+// mergeDescriptions opens the editor with each of the differing descriptions, for the user to merge them.
+func mergeDescriptions(descriptions []string, context string) (string, error) {
+	distinct := mergeLists(descriptions)
+	if len(distinct) == 1 {
+		return distinct[0], nil
+	}
+	return editMessage(strings.Join(distinct, "\n\n"), context)
+}
+
+// mergeRequests combines conflicting versions of a request: the list fields
+// are combined, the descriptions are merged in the editor, and the other
+// fields are taken from the first version.
+func mergeRequests(versions []request.Request) (request.Request, error) {
+	merged := versions[0]
+	var descriptions []string
+	for _, version := range versions {
+		descriptions = append(descriptions, version.Description)
+		merged.Reviewers = mergeLists(merged.Reviewers, version.Reviewers)
+		merged.Labels = mergeLists(merged.Labels, version.Labels)
+		merged.Checklist = mergeLists(merged.Checklist, version.Checklist)
+		merged.DependsOn = mergeLists(merged.DependsOn, version.DependsOn)
+	}
+	description, err := mergeDescriptions(descriptions, "Merging the conflicting descriptions of the review.")
+	if err != nil {
+		return request.Request{}, err
+	}
+	if description != merged.Description {
+		merged.Description = description
+		merged.UpdateMentions()
+	}
+	return merged, nil
+}
+
+// resolveConflict asks the user how to resolve the given conflict, and records the resolution.
+func resolveConflict(r *review.Review, conflict review.Conflict, input *bufio.Reader) error {
+	count := len(conflict.Requests) + len(conflict.Amendments)
+	if conflict.Comment != "" && conflict.Amendments[0].Author != repository.GetUserEmail() {
+		fmt.Printf("  Only %s can resolve this conflict, as the author of the comment.\n", conflict.Amendments[0].Author)
+		return nil
+	}
+	choice, err := promptChoice(input, count)
+	if err != nil || choice == "s" {
+		return err
+	}
+	if conflict.Comment == "" {
+		var resolved request.Request
+		if choice == "m" {
+			if resolved, err = mergeRequests(conflict.Requests); err != nil {
+				return err
+			}
+		} else {
+			n, _ := strconv.Atoi(choice)
+			resolved = conflict.Requests[n-1]
+		}
+		return r.UpdateRequest(resolved)
+	}
+	var resolved comment.Comment
+	if choice == "m" {
+		var descriptions []string
+		for _, amendment := range conflict.Amendments {
+			if !amendment.Retracted {
+				descriptions = append(descriptions, amendment.Description)
+			}
+		}
+		if len(descriptions) == 0 {
+			return errors.New("All of the conflicting edits retract the comment, so there is nothing to merge.")
+		}
+		description, err := mergeDescriptions(descriptions, "Merging the conflicting edits of the comment "+conflict.Comment)
+		if err != nil {
+			return err
+		}
+		resolved = comment.New(description)
+	} else {
+		n, _ := strconv.Atoi(choice)
+		resolved = comment.New(conflict.Amendments[n-1].Description)
+		resolved.Retracted = conflict.Amendments[n-1].Retracted
+	}
+	resolved.Original = conflict.Comment
+	return r.AddComment(&resolved)
+}
+
+// conflicts lists, and interactively resolves, the conflicting updates to reviews.
+func conflicts(args []string) error {
+	conflictsFlagSet.Parse(args)
+	var reviews []review.Review
+	if conflictsFlagSet.NArg() > 0 {
+		r, err := loadReview(conflictsFlagSet.Args())
+		if err != nil {
+			return err
+		}
+		reviews = []review.Review{*r}
+	} else {
+		var err error
+		if reviews, err = conflictedReviews(); err != nil {
+			return err
+		}
+	}
+	interactive := !*conflictsList && isInteractive()
+	input := bufio.NewReader(os.Stdin)
+	found := false
+	for i := range reviews {
+		r := &reviews[i]
+		for _, conflict := range r.Conflicts() {
+			found = true
+			fmt.Printf("%s %q\n", r.Revision, strings.SplitN(r.Request.Description, "\n", 2)[0])
+			printConflict(conflict)
+			if interactive {
+				if err := resolveConflict(r, conflict, input); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if !found {
+		fmt.Println("There are no conflicting updates.")
+	}
+	return nil
+}
+
+var conflictsCmd = &Command{
+	Usage: func(arg0 string) {
+		fmt.Printf("Usage: %s conflicts <option>... [<review>]\n\nWithout a review, every review with conflicting updates is listed.\n\nOptions:\n", arg0)
+		conflictsFlagSet.PrintDefaults()
+	},
+	RunMethod: func(args []string) error {
+		return conflicts(args)
+	},
+	Mutates: true,
+}
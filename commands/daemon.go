@@ -0,0 +1,82 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/google/git-appraise/daemon"
+	"github.com/google/git-appraise/repository"
+)
+
+// daemonSocketName is the name of the daemon's default socket within the git directory.
+const daemonSocketName = "appraise.sock"
+
+var daemonFlagSet = flag.NewFlagSet("daemon", flag.ExitOnError)
+
+var daemonSocket = daemonFlagSet.String("socket", "", "Path of the Unix socket to listen on; defaults to \".git/"+daemonSocketName+"\"")
+
+// runDaemon serves the reviews over JSON-RPC on a Unix socket until it is interrupted.
+func runDaemon(args []string) error {
+	daemonFlagSet.Parse(args)
+	if len(daemonFlagSet.Args()) > 0 {
+		return errors.New("The daemon command does not take any arguments.")
+	}
+	path := *daemonSocket
+	if path == "" {
+		path = filepath.Join(repository.GetGitDir(), daemonSocketName)
+	}
+	listener, err := daemon.Listen(path)
+	if err != nil {
+		return err
+	}
+	// Closing the listener removes the socket.
+	interrupted := make(chan os.Signal, 1)
+	signal.Notify(interrupted, os.Interrupt, syscall.SIGTERM)
+	stopped := make(chan struct{})
+	go func() {
+		<-interrupted
+		close(stopped)
+		listener.Close()
+	}()
+	fmt.Printf("Serving the reviews at %s\n", path)
+	server := &daemon.Server{OnComment: notifyComment}
+	err = server.Serve(listener)
+	select {
+	case <-stopped:
+		return nil
+	default:
+		return err
+	}
+}
+
+// daemonCmd defines the "daemon" subcommand.
+var daemonCmd = &Command{
+	Usage: func(arg0 string) {
+		fmt.Printf("Usage: %s daemon <option>...\n\nServes the reviews to editor plugins over JSON-RPC 2.0; see the README for the protocol.\n\nOptions:\n", arg0)
+		daemonFlagSet.PrintDefaults()
+	},
+	RunMethod: func(args []string) error {
+		return runDaemon(args)
+	},
+}
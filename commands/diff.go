@@ -0,0 +1,98 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/google/git-appraise/repository"
+	"github.com/google/git-appraise/review"
+)
+
+var diffFlagSet = flag.NewFlagSet("diff", flag.ExitOnError)
+
+var (
+	diffFromRevision = diffFlagSet.String("from-revision", "", "Version of the review to compare from (defaults to the one you last commented on)")
+	diffToRevision   = diffFlagSet.String("to-revision", "", "Version of the review to compare to (defaults to the current one)")
+	diffList         = diffFlagSet.Bool("list", false, "List the known versions of the review instead")
+)
+
+// diffRevisions shows what changed between two versions of a review.
+func diffRevisions(args []string) error {
+	diffFlagSet.Parse(args)
+	r, err := loadReview(diffFlagSet.Args())
+	if err != nil {
+		return err
+	}
+	if *diffList {
+		for _, revision := range r.Revisions() {
+			subject := strings.SplitN(repository.GetCommitMessage(revision), "\n", 2)[0]
+			fmt.Printf("%s %s\n", revision, subject)
+		}
+		return nil
+	}
+
+	from := *diffFromRevision
+	if from == "" {
+		from = r.LastReviewedRevision(repository.GetUserEmail())
+		if from == "" {
+			return errors.New("You have not commented on any version of the review, so --from-revision must be given.")
+		}
+	}
+	to := *diffToRevision
+	if to == "" {
+		to = r.Request.ReviewRef
+	}
+	var revisions []string
+	for _, revision := range []string{from, to} {
+		commit, err := repository.ResolveCommit(revision)
+		if err != nil {
+			return fmt.Errorf("Unknown revision %q", revision)
+		}
+		revisions = append(revisions, commit)
+	}
+
+	diff, rangeDiff, err := r.GetInterdiff(revisions[0], revisions[1])
+	if err != nil {
+		return err
+	}
+	if rangeDiff {
+		fmt.Println("The older version could not be replayed onto the newer one's base, so the commits are compared instead.")
+	}
+	if diff != "" && !rangeDiff {
+		diff = review.ColorizeDiff(diff)
+	}
+	if diff != "" {
+		fmt.Println(diff)
+	}
+	return nil
+}
+
+// diffCmd defines the "diff" subcommand.
+var diffCmd = &Command{
+	Usage: func(arg0 string) {
+		fmt.Printf("Usage: %s diff <option>... [<commit>]\n\nShows the changes between two versions of a review, leaving out those due to rebasing it.\n\nOptions:\n", arg0)
+		diffFlagSet.PrintDefaults()
+	},
+	RunMethod: func(args []string) error {
+		return diffRevisions(args)
+	},
+	Paged: true,
+}
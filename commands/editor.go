@@ -0,0 +1,109 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/git-appraise/repository"
+)
+
+// editMessageFile is the name of the file, within the git directory, in which messages are edited.
+const editMessageFile = "APPRAISE_EDITMSG"
+
+// editTextFile is the name of the file, within the git directory, in which other text (e.g. code) is edited.
+const editTextFile = "APPRAISE_EDITTEXT"
+
+// isInteractive reports whether the tool is being run from a terminal, in which case an editor can be launched.
+func isInteractive() bool {
+	info, err := os.Stdin.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// stripComments removes the lines starting with "#" from an edited message, and trims the remaining whitespace.
+func stripComments(message string) string {
+	var lines []string
+	for _, line := range strings.Split(message, "\n") {
+		if !strings.HasPrefix(line, "#") {
+			lines = append(lines, line)
+		}
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// editMessage opens the user's editor with the given initial message, followed
+// by the given context as commented-out lines, and returns the edited message.
+//
+// Like "git commit", an empty message aborts the operation.
+func editMessage(initial, context string) (string, error) {
+	editor, err := repository.GetEditor()
+	if err != nil {
+		return "", fmt.Errorf("Failed to determine the editor to use: %v", err)
+	}
+	var contents strings.Builder
+	contents.WriteString(initial + "\n\n")
+	for _, line := range strings.Split(strings.TrimSpace(context), "\n") {
+		contents.WriteString(strings.TrimSpace("# "+line) + "\n")
+	}
+	contents.WriteString("#\n# Lines starting with '#' will be ignored, and an empty message aborts.\n")
+
+	edited, err := editFile(editor, editMessageFile, contents.String())
+	if err != nil {
+		return "", err
+	}
+	message := stripComments(edited)
+	if message == "" {
+		return "", errors.New("Aborting due to an empty message.")
+	}
+	return message, nil
+}
+
+// editText opens the user's editor with the given text, and returns the edited text unchanged.
+//
+// Unlike editMessage, no lines are ignored, so this is suited to editing code.
+func editText(initial string) (string, error) {
+	editor, err := repository.GetEditor()
+	if err != nil {
+		return "", fmt.Errorf("Failed to determine the editor to use: %v", err)
+	}
+	return editFile(editor, editTextFile, initial)
+}
+
+// editFile writes the given contents to the named file within the git
+// directory, opens it in the given editor, and returns the edited contents.
+func editFile(editor, name, contents string) (string, error) {
+	path := filepath.Join(repository.GetGitDir(), name)
+	if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+		return "", err
+	}
+	// The editor setting is a shell command, which may include arguments.
+	cmd := exec.Command("sh", "-c", editor+` "$@"`, editor, path)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("The editor %q failed: %v", editor, err)
+	}
+	edited, err := ioutil.ReadFile(path)
+	return string(edited), err
+}
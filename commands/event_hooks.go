@@ -0,0 +1,79 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// The environment variables that describe an event to the hook commands run
+// by "watch", "nudge", the mention hook, and exec notifiers, which also get
+// the whole event as JSON on their standard input. The variables that do not
+// apply to an event are left unset.
+const (
+	// eventKindEnv holds the kind of the event, such as "comment" for watch,
+	// "review.accepted" for notifiers, or "nudge".
+	eventKindEnv = "APPRAISE_EVENT_KIND"
+	// eventRevisionEnv holds the revision of the review.
+	eventRevisionEnv = "APPRAISE_EVENT_REVISION"
+	// eventHashEnv holds the hash of the comment, for comment events.
+	eventHashEnv = "APPRAISE_EVENT_HASH"
+	// eventAuthorEnv holds the email address of the user who caused the event.
+	eventAuthorEnv = "APPRAISE_EVENT_AUTHOR"
+	// eventUsersEnv holds the space-separated email addresses of the users that
+	// the event is addressed to, such as those mentioned or nudged.
+	eventUsersEnv = "APPRAISE_EVENT_USERS"
+)
+
+// hookEvent holds the fields of an event that are given to hook commands in
+// environment variables.
+type hookEvent struct {
+	Kind     string
+	Revision string
+	Hash     string
+	Author   string
+	Users    []string
+}
+
+// environment returns the environment variables describing the event.
+func (e hookEvent) environment() []string {
+	env := []string{eventKindEnv + "=" + e.Kind, eventRevisionEnv + "=" + e.Revision}
+	if e.Hash != "" {
+		env = append(env, eventHashEnv+"="+e.Hash)
+	}
+	if e.Author != "" {
+		env = append(env, eventAuthorEnv+"="+e.Author)
+	}
+	if len(e.Users) > 0 {
+		env = append(env, eventUsersEnv+"="+strings.Join(e.Users, " "))
+	}
+	return env
+}
+
+// runHook runs a hook command with the shell, adding the given variables to
+// its environment and passing it the payload on its standard input.
+func runHook(command string, env []string, payload []byte) error {
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdin = bytes.NewReader(payload)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
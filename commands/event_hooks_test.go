@@ -0,0 +1,53 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHookEnvironment(t *testing.T) {
+	env := hookEvent{Kind: "nudge", Revision: "abc", Users: []string{"a@example.com", "b@example.com"}}.environment()
+	expected := []string{
+		"APPRAISE_EVENT_KIND=nudge",
+		"APPRAISE_EVENT_REVISION=abc",
+		"APPRAISE_EVENT_USERS=a@example.com b@example.com",
+	}
+	if !reflect.DeepEqual(env, expected) {
+		t.Errorf("Unexpected environment: %q", env)
+	}
+}
+
+func TestRunHook(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out")
+	env := hookEvent{Kind: "comment", Revision: "abc", Hash: "def", Author: "a@example.com"}.environment()
+	command := `{ cat; echo " $APPRAISE_EVENT_KIND $APPRAISE_EVENT_REVISION $APPRAISE_EVENT_HASH $APPRAISE_EVENT_AUTHOR"; } > "$OUT"`
+	if err := runHook(command, append(env, "OUT="+out), []byte(`{"kind":"comment"}`)); err != nil {
+		t.Fatal(err)
+	}
+	contents, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(string(contents)); got != `{"kind":"comment"} comment abc def a@example.com` {
+		t.Errorf("Unexpected hook output: %q", got)
+	}
+}
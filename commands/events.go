@@ -0,0 +1,174 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/google/git-appraise/repository"
+	"github.com/google/git-appraise/review"
+)
+
+var eventsFlagSet = flag.NewFlagSet("events", flag.ExitOnError)
+
+var eventsSince = eventsFlagSet.String("since", "", "Only emit the events added since the state printed by an earlier run")
+
+// eventsDir is the directory, within the git directory, holding the keys of the events seen at each state.
+const eventsDir = "appraise-events"
+
+// maxEventCursors is the number of states whose events are remembered.
+const maxEventCursors = 100
+
+// eventCursor is the last line of the stream, which is passed to "--since" to continue from it.
+type eventCursor struct {
+	Kind  string `json:"kind"`
+	State string `json:"state"`
+}
+
+// loadEvents returns the events of every review, including archived ones, in chronological order.
+func loadEvents() ([]review.Activity, error) {
+	var events []review.Activity
+	collect := func(r review.Review) error {
+		events = append(events, r.ListEvents()...)
+		return nil
+	}
+	if err := review.ForEach(collect); err != nil {
+		return nil, err
+	}
+	if err := review.ForEachArchived(collect); err != nil {
+		return nil, err
+	}
+	review.SortActivity(events)
+	return events, nil
+}
+
+func eventsPath(state string) string {
+	return filepath.Join(repository.GetGitDir(), eventsDir, state)
+}
+
+// readSeenEvents returns the keys of the events that existed at the given state.
+func readSeenEvents(state string) (map[string]bool, error) {
+	if strings.ContainsAny(state, "/.") {
+		return nil, fmt.Errorf("Invalid state %q", state)
+	}
+	file, err := os.Open(eventsPath(state))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("Unknown state %q; it must be one printed by an earlier run in this repository", state)
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		seen[scanner.Text()] = true
+	}
+	return seen, scanner.Err()
+}
+
+// writeSeenEvents records the keys of the events at the given state, and
+// forgets the oldest states once there are more than maxEventCursors.
+func writeSeenEvents(state string, events []review.Activity) error {
+	dir := filepath.Join(repository.GetGitDir(), eventsDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	var keys strings.Builder
+	for _, event := range events {
+		keys.WriteString(event.Key + "\n")
+	}
+	file, err := ioutil.TempFile(dir, "tmp-")
+	if err != nil {
+		return err
+	}
+	_, err = file.WriteString(keys.String())
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), eventsPath(state))
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil || len(infos) <= maxEventCursors {
+		return err
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ModTime().After(infos[j].ModTime()) })
+	for _, info := range infos[maxEventCursors:] {
+		os.Remove(filepath.Join(dir, info.Name()))
+	}
+	return nil
+}
+
+// events writes the review events as newline-delimited JSON, followed by the
+// cursor from which a later run can continue.
+func events(args []string) error {
+	eventsFlagSet.Parse(args)
+	if len(eventsFlagSet.Args()) > 0 {
+		return errors.New("The events command does not take any arguments.")
+	}
+	var seen map[string]bool
+	if *eventsSince != "" {
+		var err error
+		if seen, err = readSeenEvents(*eventsSince); err != nil {
+			return err
+		}
+	}
+
+	state := repository.GetRepoStateHash()
+	all, err := loadEvents()
+	if err != nil {
+		return err
+	}
+	if err := writeSeenEvents(state, all); err != nil {
+		return fmt.Errorf("Cannot record the events at the current state: %v", err)
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	for _, event := range all {
+		if seen[event.Key] {
+			continue
+		}
+		if err := encoder.Encode(event); err != nil {
+			return err
+		}
+	}
+	return encoder.Encode(eventCursor{Kind: "cursor", State: state})
+}
+
+// eventsCmd defines the "events" subcommand.
+var eventsCmd = &Command{
+	Usage: func(arg0 string) {
+		fmt.Printf("Usage: %s events [--since <state>]\n\nOptions:\n", arg0)
+		eventsFlagSet.PrintDefaults()
+	},
+	RunMethod: func(args []string) error {
+		return events(args)
+	},
+}
@@ -0,0 +1,201 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/google/git-appraise/repository"
+	"github.com/google/git-appraise/review"
+	"github.com/google/git-appraise/review/export"
+)
+
+var exportFlagSet = flag.NewFlagSet("export", flag.ExitOnError)
+
+var (
+	exportArchived = exportFlagSet.Bool("archived", false, "Include reviews that have been moved to the archive")
+	exportAuthor   = exportFlagSet.String("author", "", "Only export reviews requested by the given email address")
+	exportStatus   = exportFlagSet.String("status", "", "Only export reviews with the given status: \""+review.StatusOpen+"\", \""+review.StatusSubmitted+"\", or \""+review.StatusAbandoned+"\"")
+	exportOutput   = exportFlagSet.String("o", "", "Write the bundle to the given file instead of stdout")
+)
+
+// collectReviewNotes reads the notes belonging to a review from every review notes ref.
+//
+// Those are the notes on each of the review's commits, which covers the
+// request and comments on its first commit as well as CI reports on later ones.
+func collectReviewNotes(r review.Review, notesRefs []string) map[string]map[string][]repository.Note {
+	notes := make(map[string]map[string][]repository.Note)
+	for _, notesRef := range notesRefs {
+		for _, commit := range r.Commits() {
+			if commitNotes := repository.GetNotes(notesRef, commit); len(commitNotes) > 0 {
+				if notes[notesRef] == nil {
+					notes[notesRef] = make(map[string][]repository.Note)
+				}
+				notes[notesRef][commit] = commitNotes
+			}
+		}
+	}
+	return notes
+}
+
+// exportReviews writes the selected reviews to a JSON bundle.
+//
+// If review commits are given, then only those reviews are exported;
+// otherwise every review matching the flags is.
+func exportReviews(args []string) error {
+	exportFlagSet.Parse(args)
+	filter := review.Filter{Author: *exportAuthor, Status: *exportStatus}
+	if err := filter.Validate(); err != nil {
+		return err
+	}
+
+	var reviews []review.Review
+	if exportFlagSet.NArg() > 0 {
+		for _, arg := range exportFlagSet.Args() {
+			revision, err := repository.ResolveCommit(arg)
+			if err != nil {
+				return fmt.Errorf("Unknown commit %q", arg)
+			}
+			r := review.Get(revision)
+			if r == nil {
+				return fmt.Errorf("There is no review for %q", arg)
+			}
+			reviews = append(reviews, *r)
+		}
+	} else {
+		collect := func(r review.Review) error {
+			if filter.Matches(r) {
+				reviews = append(reviews, r)
+			}
+			return nil
+		}
+		if err := review.ForEach(collect); err != nil {
+			return err
+		}
+		if *exportArchived {
+			if err := review.ForEachArchived(collect); err != nil {
+				return err
+			}
+		}
+	}
+
+	notesRefs := repository.ListRefs(notesRefPattern)
+	bundle := export.New()
+	var exported int
+	for _, r := range reviews {
+		exported += bundle.Add(r.Revision, collectReviewNotes(r, notesRefs))
+	}
+
+	var out io.Writer = os.Stdout
+	if *exportOutput != "" {
+		file, err := os.Create(*exportOutput)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		out = file
+	}
+	if err := bundle.Write(out); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Exported %d notes from %d reviews\n", exported, len(reviews))
+	return nil
+}
+
+// importReviewsFrom merges the notes in the bundle read from the given reader into the local notes.
+func importReviewsFrom(r io.Reader) error {
+	bundle, err := export.Read(r)
+	if err != nil {
+		return err
+	}
+	notes, err := bundle.NotesByRef()
+	if err != nil {
+		return err
+	}
+	var notesRefs []string
+	for notesRef := range notes {
+		if !strings.HasPrefix(notesRef, devtoolsNotesPrefix) {
+			return fmt.Errorf("Refusing to import notes to %q, which is not a review notes ref", notesRef)
+		}
+		notesRefs = append(notesRefs, notesRef)
+	}
+	sort.Strings(notesRefs)
+	for _, notesRef := range notesRefs {
+		added, err := repository.MergeNotes(notesRef, notes[notesRef], "Notes added by 'git appraise import'", mergeKey(notesRef))
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Added %d notes to %s\n", added, notesRef)
+	}
+	var missing []string
+	for _, entry := range bundle.Reviews {
+		if _, err := repository.ResolveCommit(entry.Revision); err != nil {
+			missing = append(missing, entry.Revision)
+		}
+	}
+	if missing != nil {
+		fmt.Printf("Warning: the commits of %d of the imported reviews are not in this repository, so they will not be shown until those are fetched:\n  %s\n",
+			len(missing), strings.Join(missing, "\n  "))
+	}
+	return nil
+}
+
+// importReviews merges reviews written by "export" into the local notes.
+func importReviews(args []string) error {
+	if len(args) == 0 {
+		return importReviewsFrom(os.Stdin)
+	}
+	for _, path := range args {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		err = importReviewsFrom(file)
+		file.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exportCmd defines the "export" subcommand.
+var exportCmd = &Command{
+	Usage: func(arg0 string) {
+		fmt.Printf("Usage: %s export <option>... [<review commit>...]\n\nOptions:\n", arg0)
+		exportFlagSet.PrintDefaults()
+	},
+	RunMethod: func(args []string) error {
+		return exportReviews(args)
+	},
+}
+
+// importCmd defines the "import" subcommand.
+var importCmd = &Command{
+	Usage: func(arg0 string) {
+		fmt.Printf("Usage: %s import [<bundle>...]\n\nReads from stdin if no files are given.\n", arg0)
+	},
+	RunMethod: func(args []string) error {
+		return importReviews(args)
+	},
+	Mutates: true,
+}
@@ -0,0 +1,57 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/google/git-appraise/web"
+)
+
+var exportSiteFlagSet = flag.NewFlagSet("export-site", flag.ExitOnError)
+
+var exportSiteOut = exportSiteFlagSet.String("out", "", "Directory to write the site to")
+
+// exportSite renders every review into a static HTML site.
+func exportSite(args []string) error {
+	exportSiteFlagSet.Parse(args)
+	if len(exportSiteFlagSet.Args()) > 0 {
+		return errors.New("The export-site command does not take any arguments.")
+	}
+	if *exportSiteOut == "" {
+		return errors.New("The directory to write the site to must be given with --out.")
+	}
+	count, err := web.ExportSite(*exportSiteOut)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Exported %d reviews to %s\n", count, *exportSiteOut)
+	return nil
+}
+
+// exportSiteCmd defines the "export-site" subcommand.
+var exportSiteCmd = &Command{
+	Usage: func(arg0 string) {
+		fmt.Printf("Usage: %s export-site --out <dir>\n\nOptions:\n", arg0)
+		exportSiteFlagSet.PrintDefaults()
+	},
+	RunMethod: func(args []string) error {
+		return exportSite(args)
+	},
+}
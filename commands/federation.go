@@ -0,0 +1,72 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/google/git-appraise/repository"
+	"github.com/google/git-appraise/review"
+)
+
+// federatedRepoConfig is the multi-valued git config setting listing the
+// paths of other local repositories (or mirrors) to include in federated views.
+const federatedRepoConfig = "appraise.federatedRepo"
+
+// forEachRepo runs the given function against the current repository, and
+// then (if federated is true) against each of the federated repositories.
+//
+// The function is passed the path of the repository, which is empty for the
+// current one. Repositories that cannot be read are reported on stderr and skipped.
+func forEachRepo(federated bool, f func(repoPath string) error) error {
+	if err := f(""); err != nil {
+		return err
+	}
+	if !federated {
+		return nil
+	}
+	for _, repoPath := range repository.GetConfigAll(federatedRepoConfig) {
+		err := repository.InRepo(repoPath, func() error {
+			return f(repoPath)
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Skipping %s: %v\n", repoPath, err)
+		}
+	}
+	return nil
+}
+
+// loadFederated runs the given function to load reviews against each
+// repository, as forEachRepo does, and returns all of the loaded reviews.
+//
+// The Repository field of each review is set to the path of its repository.
+func loadFederated(federated bool, load func() ([]review.Review, error)) ([]review.Review, error) {
+	var all []review.Review
+	err := forEachRepo(federated, func(repoPath string) error {
+		reviews, err := load()
+		if err != nil {
+			return err
+		}
+		for i := range reviews {
+			reviews[i].Repository = repoPath
+		}
+		all = append(all, reviews...)
+		return nil
+	})
+	return all, err
+}
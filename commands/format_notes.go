@@ -0,0 +1,99 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/google/git-appraise/repository"
+	"github.com/google/git-appraise/review/transport"
+)
+
+var formatNotesFlagSet = flag.NewFlagSet("format-notes", flag.ExitOnError)
+
+var (
+	formatNotesRemote = formatNotesFlagSet.String("remote", "", "Only include notes that were not in the last pull from this remote")
+	formatNotesOutput = formatNotesFlagSet.String("o", "", "Write the patches to the given file instead of stdout")
+)
+
+// buildNotesPatch collects the notes under the given ref that are missing from the given remote-tracking ref.
+//
+// If the remote-tracking ref is empty, then all of the notes are included.
+func buildNotesPatch(notesRef, remoteNotesRef string) transport.Patch {
+	patch := transport.Patch{
+		Ref:   notesRef,
+		Notes: make(map[string][]repository.Note),
+	}
+	for _, object := range repository.ListNotedObjects(notesRef) {
+		present := make(map[string]bool)
+		if remoteNotesRef != "" {
+			for _, note := range repository.GetNotes(remoteNotesRef, object) {
+				present[string(note)] = true
+			}
+		}
+		for _, note := range repository.GetNotes(notesRef, object) {
+			if strings.TrimSpace(string(note)) != "" && !present[string(note)] {
+				patch.Notes[object] = append(patch.Notes[object], note)
+			}
+		}
+	}
+	return patch
+}
+
+// formatNotes writes the local review notes as a series of mail messages.
+func formatNotes(args []string) error {
+	formatNotesFlagSet.Parse(args)
+	if len(formatNotesFlagSet.Args()) > 0 {
+		return errors.New("The format-notes command does not take any arguments.")
+	}
+
+	var patches []transport.Patch
+	for _, notesRef := range repository.ListRefs(notesRefPattern) {
+		remoteNotesRef := ""
+		if *formatNotesRemote != "" {
+			remoteNotesRef = repository.GetRemoteNotesRef(*formatNotesRemote, notesRef)
+		}
+		patches = append(patches, buildNotesPatch(notesRef, remoteNotesRef))
+	}
+
+	var out io.Writer = os.Stdout
+	if *formatNotesOutput != "" {
+		file, err := os.Create(*formatNotesOutput)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		out = file
+	}
+	return transport.Format(out, repository.GetUserEmail(), patches)
+}
+
+// formatNotesCmd defines the "format-notes" subcommand.
+var formatNotesCmd = &Command{
+	Usage: func(arg0 string) {
+		fmt.Printf("Usage: %s format-notes <option>...\n\nOptions:\n", arg0)
+		formatNotesFlagSet.PrintDefaults()
+	},
+	RunMethod: func(args []string) error {
+		return formatNotes(args)
+	},
+}
@@ -0,0 +1,64 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/google/git-appraise/review/gc"
+)
+
+var gcFlagSet = flag.NewFlagSet("gc", flag.ExitOnError)
+
+var (
+	gcDryRun = gcFlagSet.Bool("dry-run", false, "Only report the duplicates that would be removed")
+)
+
+// collectGarbage removes duplicate entries from the git-notes used for reviews.
+func collectGarbage(args []string) error {
+	gcFlagSet.Parse(args)
+	if len(gcFlagSet.Args()) > 0 {
+		return errors.New("The gc command does not take any arguments.")
+	}
+
+	results, err := gc.Collect(notesRefPattern, *gcDryRun)
+	for _, result := range results {
+		if result.RewrittenNotes == 0 {
+			continue
+		}
+		verb := "Removed"
+		if *gcDryRun {
+			verb = "Would remove"
+		}
+		fmt.Printf("%s %d redundant lines from %d notes in %s\n", verb, result.RemovedLines, result.RewrittenNotes, result.Ref)
+	}
+	return err
+}
+
+// gcCmd defines the "gc" subcommand.
+var gcCmd = &Command{
+	Usage: func(arg0 string) {
+		fmt.Printf("Usage: %s gc <option>...\n\nOptions:\n", arg0)
+		gcFlagSet.PrintDefaults()
+	},
+	RunMethod: func(args []string) error {
+		return collectGarbage(args)
+	},
+	Mutates: true,
+}
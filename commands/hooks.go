@@ -0,0 +1,268 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/git-appraise/repository"
+	"github.com/google/git-appraise/review"
+	"github.com/google/git-appraise/review/ci"
+)
+
+const (
+	// hookMarker identifies the git hooks installed by "init-hooks", which it may overwrite or remove.
+	hookMarker = "# Installed by \"git appraise init-hooks\"."
+	// hookEnv is set while the tool holds the repository's lock, so that the
+	// hooks that git runs meanwhile (e.g. when the notes are pushed, or a
+	// review is submitted) are skipped rather than waiting for the lock.
+	hookEnv = "GIT_APPRAISE_HOOK"
+	// hookAgent is the agent of the placeholder CI reports added by the post-commit hook.
+	hookAgent = "git-appraise"
+)
+
+// hookNames are the git hooks that "init-hooks" installs.
+var hookNames = []string{"post-commit", "post-merge", "post-rewrite", "pre-push"}
+
+// hookScript returns the script of an installed git hook, which runs the "hook" subcommand.
+func hookScript(name string) string {
+	return fmt.Sprintf("#!/bin/sh\n%s\n# Remove this file, or run \"git appraise init-hooks --uninstall\", to disable it.\nexec git appraise hook %s \"$@\"\n", hookMarker, name)
+}
+
+// isAppraiseHook reports whether the hook at the given path was installed by "init-hooks".
+func isAppraiseHook(path string) bool {
+	contents, err := ioutil.ReadFile(path)
+	return err == nil && strings.Contains(string(contents), hookMarker)
+}
+
+var initHooksFlagSet = flag.NewFlagSet("init-hooks", flag.ExitOnError)
+
+var (
+	initHooksForce     = initHooksFlagSet.Bool("force", false, "Replace existing hooks that were not installed by this command")
+	initHooksUninstall = initHooksFlagSet.Bool("uninstall", false, "Remove the hooks installed by this command")
+)
+
+// initHooks installs (or removes) the git hooks that run the "hook" subcommand.
+func initHooks(args []string) error {
+	initHooksFlagSet.Parse(args)
+	if len(initHooksFlagSet.Args()) > 0 {
+		return errors.New("init-hooks takes no arguments.")
+	}
+	dir, err := repository.GetHooksDir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	var skipped []string
+	for _, name := range hookNames {
+		path := filepath.Join(dir, name)
+		_, statErr := os.Stat(path)
+		exists := statErr == nil
+		ours := exists && isAppraiseHook(path)
+		if *initHooksUninstall {
+			if ours {
+				if err := os.Remove(path); err != nil {
+					return err
+				}
+				fmt.Printf("Removed the %s hook\n", name)
+			}
+			continue
+		}
+		if exists && !ours && !*initHooksForce {
+			skipped = append(skipped, name)
+			continue
+		}
+		if err := ioutil.WriteFile(path, []byte(hookScript(name)), 0755); err != nil {
+			return err
+		}
+		fmt.Printf("Installed the %s hook\n", name)
+	}
+	if len(skipped) > 0 {
+		return fmt.Errorf("Not replacing the existing hooks %q; add \"git appraise hook <name>\" to them, or use --force.", skipped)
+	}
+	return nil
+}
+
+// initHooksCmd defines the "init-hooks" subcommand.
+var initHooksCmd = &Command{
+	Usage: func(arg0 string) {
+		fmt.Printf("Usage: %s init-hooks <option>...\n\nInstalls the %s git hooks.\n\nOptions:\n", arg0, strings.Join(hookNames, ", "))
+		initHooksFlagSet.PrintDefaults()
+	},
+	RunMethod: func(args []string) error {
+		return initHooks(args)
+	},
+	Mutates: true,
+}
+
+// pushedBranches reads the refs being pushed, as given to the pre-push hook
+// on its standard input, and returns the branches among them that are not being deleted.
+func pushedBranches() (map[string]bool, error) {
+	branches := make(map[string]bool)
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 4 || !strings.HasPrefix(fields[0], "refs/heads/") || strings.Trim(fields[1], "0") == "" {
+			continue
+		}
+		branches[fields[0]] = true
+	}
+	return branches, scanner.Err()
+}
+
+// prePushHook warns about pushing branches whose reviews still have blocking
+// comment threads open, and then syncs the review notes with the remote.
+func prePushHook(args []string) error {
+	if len(args) < 1 {
+		return errors.New("The pre-push hook expects the name of the remote.")
+	}
+	remote := args[0]
+	branches, err := pushedBranches()
+	if err != nil {
+		return err
+	}
+	if len(branches) == 0 {
+		// Pushing only the notes, e.g. with "git appraise push".
+		return nil
+	}
+	unlock, err := lockRepository()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	for _, r := range review.ListOpen() {
+		if branches[r.Request.ReviewRef] && r.Threads.Blocking > 0 {
+			fmt.Fprintf(os.Stderr, "Warning: the review of %s (%.12s) still has %d blocking comment threads open.\n",
+				r.Request.ReviewRef, r.Revision, r.Threads.Blocking)
+		}
+	}
+	// A failure to sync the notes should not prevent pushing the branches.
+	if err := syncWithRemotes([]string{remote}); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+	return nil
+}
+
+// postMergeHook pulls the review notes after the branches were pulled.
+func postMergeHook() error {
+	unlock, err := lockRepository()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	remote := getRemote(nil)
+	if err := pullFromRemote(remote); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to pull the review notes from %q: %v\n", remote, err)
+	}
+	return nil
+}
+
+// postCommitHook adds a pending CI report on the new commit for each required
+// check, so that the checks show up as pending until CI reports on them.
+func postCommitHook() error {
+	required := repository.GetConfigAll(requiredCheckConfig)
+	if len(required) == 0 {
+		return nil
+	}
+	commit, err := repository.ResolveCommit("HEAD")
+	if err != nil {
+		return err
+	}
+	unlock, err := lockRepository()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	reported := make(map[string]bool)
+	for _, report := range ci.ParseAllValid(repository.GetNotes(ci.Ref, commit)) {
+		reported[report.Name] = true
+	}
+	for _, name := range required {
+		if reported[name] {
+			continue
+		}
+		report := ci.Report{
+			Timestamp: strconv.FormatInt(time.Now().Unix(), 10),
+			Agent:     hookAgent,
+			Name:      name,
+			Required:  true,
+			Version:   ci.FormatVersion,
+		}
+		note, err := report.Write()
+		if err != nil {
+			return err
+		}
+		repository.AppendNote(ci.Ref, commit, note)
+	}
+	return nil
+}
+
+// postRewriteHook records the commits that were amended or rebased as the
+// first commits of their reviews, so that the reviews follow them.
+func postRewriteHook() error {
+	unlock, err := lockRepository()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return recordRewrites(os.Stdin)
+}
+
+// runGitHook runs the part of a git hook installed by "init-hooks" that this tool implements.
+func runGitHook(args []string) error {
+	if len(args) == 0 {
+		return errors.New("The name of the hook to run is required.")
+	}
+	if os.Getenv(hookEnv) != "" {
+		return nil
+	}
+	switch args[0] {
+	case "pre-push":
+		return prePushHook(args[1:])
+	case "post-merge":
+		return postMergeHook()
+	case "post-commit":
+		return postCommitHook()
+	case "post-rewrite":
+		return postRewriteHook()
+	}
+	return fmt.Errorf("Unknown hook %q", args[0])
+}
+
+// hookCmd defines the "hook" subcommand, which is run by the installed git hooks.
+//
+// The hooks only take the repository's lock once they find that they have
+// something to do, as git runs them while other commands hold it.
+var hookCmd = &Command{
+	Usage: func(arg0 string) {
+		fmt.Printf("Usage: %s hook <name> [<argument>...]\n\nRuns the git hook with the given name, as installed by \"init-hooks\".\n", arg0)
+	},
+	RunMethod: func(args []string) error {
+		return runGitHook(args)
+	},
+}
@@ -0,0 +1,223 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/google/git-appraise/repository"
+	"github.com/google/git-appraise/review/mail"
+	"github.com/google/git-appraise/review/mirror"
+	"github.com/google/git-appraise/review/request"
+)
+
+var importPatchesFlagSet = flag.NewFlagSet("import-patches", flag.ExitOnError)
+
+var (
+	importPatchesTarget = importPatchesFlagSet.String("target", "", "Ref that the series are to be merged into; defaults to the default target ref")
+	importPatchesBase   = importPatchesFlagSet.String("base", "", "Commit to apply the series to; defaults to the target ref")
+	importPatchesPrefix = importPatchesFlagSet.String("prefix", "patches/", "Prefix of the branches created for the series")
+	importPatchesDryRun = importPatchesFlagSet.Bool("n", false, "Only report the series that would be imported, without creating branches or notes")
+)
+
+var slugPattern = regexp.MustCompile(`[^a-z0-9]+`)
+
+// seriesBranch returns the branch created for a series.
+func seriesBranch(prefix string, series mail.Series) string {
+	slug := strings.Trim(slugPattern.ReplaceAllString(strings.ToLower(series.Title()), "-"), "-")
+	if len(slug) > 50 {
+		slug = strings.TrimRight(slug[:50], "-")
+	}
+	if series.Subject.Version > 1 {
+		slug = fmt.Sprintf("%s-v%d", slug, series.Subject.Version)
+	}
+	return "refs/heads/" + prefix + slug
+}
+
+// commitSeries creates a commit for each patch of the series, starting from the given base commit.
+func commitSeries(series mail.Series, base string) ([]string, error) {
+	var commits []string
+	parent := base
+	for _, patch := range series.Patches {
+		author, body, err := mail.PatchAuthor(patch)
+		if err != nil {
+			return nil, fmt.Errorf("Cannot parse the author of %q: %v", patch.Subject, err)
+		}
+		description, diff := mail.SplitPatch(body)
+		subject, _ := mail.ParsePatchSubject(patch.Subject)
+		message := subject.Title
+		if description != "" {
+			message += "\n\n" + description
+		}
+		commit, err := repository.CommitPatch(parent, diff, message, author.Name, author.Address, patch.Date)
+		if err != nil {
+			return nil, fmt.Errorf("Cannot apply %q: %v", patch.Subject, err)
+		}
+		commits = append(commits, commit)
+		parent = commit
+	}
+	return commits, nil
+}
+
+// seriesRequest returns the review request for a series, which is sent by the
+// sender of its cover letter (or first patch) to that message's recipients.
+func seriesRequest(series mail.Series, targetRef, reviewRef string) request.Request {
+	root := series.Patches[0]
+	text := ""
+	if series.Cover != nil {
+		root = *series.Cover
+		text = mail.CoverText(root.Body)
+	} else if _, body, err := mail.PatchAuthor(root); err == nil {
+		text, _ = mail.SplitPatch(body)
+	}
+	requester := root.From
+	if author, _, err := mail.PatchAuthor(mail.Message{From: root.From}); err == nil {
+		requester = author.Address
+	}
+	var reviewers []string
+	seen := map[string]bool{requester: true}
+	for _, recipient := range append(append([]string{}, root.To...), root.Cc...) {
+		if !seen[recipient] {
+			seen[recipient] = true
+			reviewers = append(reviewers, recipient)
+		}
+	}
+	r := request.Request{
+		Timestamp:   mirror.Timestamp(root.Date),
+		ReviewRef:   reviewRef,
+		TargetRef:   targetRef,
+		Requester:   requester,
+		Reviewers:   reviewers,
+		Description: strings.TrimSpace(series.Title() + "\n\n" + text),
+	}
+	r.UpdateMentions()
+	return r
+}
+
+// importPatches creates a review for each patch series in the given mbox
+// files, with the replies to the series as comments.
+func importPatches(args []string) error {
+	importPatchesFlagSet.Parse(args)
+	args = importPatchesFlagSet.Args()
+
+	var messages []mail.Message
+	if len(args) == 0 {
+		parsed, err := mail.Parse(os.Stdin)
+		if err != nil {
+			return err
+		}
+		messages = parsed
+	}
+	for _, path := range args {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		parsed, err := mail.Parse(file)
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("Cannot parse %q: %v", path, err)
+		}
+		messages = append(messages, parsed...)
+	}
+	allSeries, replies := mail.FindSeries(messages)
+	if len(allSeries) == 0 {
+		return errors.New("There are no patches to import.")
+	}
+
+	targetRef := *importPatchesTarget
+	if targetRef == "" {
+		targetRef = getDefaultTarget()
+	}
+	baseRef := *importPatchesBase
+	if baseRef == "" {
+		baseRef = targetRef
+	}
+	base, err := repository.ResolveCommit(baseRef)
+	if err != nil {
+		return fmt.Errorf("Cannot resolve the base %q: %v", baseRef, err)
+	}
+
+	batch := mirror.NewBatch()
+	targets := make(map[string]mailTarget)
+	var imported int
+	for _, series := range allSeries {
+		title := series.Title()
+		if !series.Complete() {
+			fmt.Printf("Skipping the series %q, which has %d of its %d patches\n", title, len(series.Patches), series.Subject.Total)
+			continue
+		}
+		commits, err := commitSeries(series, base)
+		if err != nil {
+			fmt.Printf("Skipping the series %q: %v\n", title, err)
+			continue
+		}
+		branch := seriesBranch(*importPatchesPrefix, series)
+		head := commits[len(commits)-1]
+		if existing, err := repository.ResolveCommit(branch); err == nil && existing != head {
+			fmt.Printf("Skipping the series %q, as %s already exists\n", title, branch)
+			continue
+		} else if err != nil && !*importPatchesDryRun {
+			if err := repository.CreateRef(branch, head); err != nil {
+				return err
+			}
+		}
+		revision := commits[0]
+		if err := batch.AddRequest(revision, seriesRequest(series, targetRef, branch)); err != nil {
+			return err
+		}
+		if series.Cover != nil && series.Cover.MessageID != "" {
+			targets[series.Cover.MessageID] = mailTarget{Revision: revision}
+		}
+		for i, patch := range series.Patches {
+			if patch.MessageID != "" {
+				targets[patch.MessageID] = mailTarget{Revision: revision, Commit: commits[i]}
+			}
+		}
+		fmt.Printf("%s: %q, %d patches\n", strings.TrimPrefix(branch, "refs/heads/"), title, len(commits))
+		imported++
+	}
+	if err := ingestReplies(replies, targets, batch); err != nil {
+		return err
+	}
+	if *importPatchesDryRun {
+		fmt.Printf("Would import %d series, adding %d notes\n", imported, batch.Len())
+		return nil
+	}
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	fmt.Printf("Imported %d series, adding %d notes\n", imported, batch.Len())
+	return nil
+}
+
+// importPatchesCmd defines the "import-patches" subcommand.
+var importPatchesCmd = &Command{
+	Usage: func(arg0 string) {
+		fmt.Printf("Usage: %s import-patches <option>... [<mbox or patch file>...]\n\nReads from stdin if no files are given.\n\nOptions:\n", arg0)
+		importPatchesFlagSet.PrintDefaults()
+	},
+	RunMethod: func(args []string) error {
+		return importPatches(args)
+	},
+	Mutates: true,
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"fmt"
+
+	"github.com/google/git-appraise/review"
+	"github.com/google/git-appraise/review/comment"
+)
+
+// The types below define the JSON output of the subcommands that support the
+// "--json" flag, other than "list" and "show" which print the reviews
+// themselves. They are documented in the README, and so fields should only
+// ever be added to them.
+
+// commentResult is the JSON output of the "comment", "accept", and "reject" subcommands.
+type commentResult struct {
+	// Revision is the commit that identifies the review.
+	Revision string `json:"revision"`
+	// Hash is the hash of the new comment, which replies use as their parent.
+	Hash    string          `json:"hash"`
+	Comment comment.Comment `json:"comment"`
+}
+
+// submitResult is the JSON output of the "submit" subcommand.
+type submitResult struct {
+	Revision    string `json:"revision"`
+	ReviewRef   string `json:"reviewRef"`
+	TargetRef   string `json:"targetRef"`
+	Strategy    string `json:"strategy"`
+	SubmittedAs string `json:"submittedAs"`
+}
+
+// remoteResult is the JSON output of the "pull" and "push" subcommands.
+type remoteResult struct {
+	Remote          string `json:"remote"`
+	NotesRefs       string `json:"notesRefs"`
+	RemoteNotesRefs string `json:"remoteNotesRefs"`
+}
+
+// addComment adds the comment to the review, notifies the notifiers of it, and
+// prints the result as JSON if requested.
+func addComment(r *review.Review, c comment.Comment, jsonOutput bool) error {
+	if err := r.AddComment(&c); err != nil {
+		return err
+	}
+	hash, err := c.Hash()
+	if err != nil {
+		return err
+	}
+	notifyComment(r, hash, c)
+	if !jsonOutput {
+		return nil
+	}
+	return printJson(commentResult{r.Revision, hash, c})
+}
+
+// addDraft saves the comment as a draft on the review, and prints the result as JSON if requested.
+func addDraft(r *review.Review, c comment.Comment, jsonOutput bool) error {
+	if err := r.AddDraft(c); err != nil {
+		return err
+	}
+	drafts, err := r.Drafts()
+	if err != nil {
+		return err
+	}
+	saved := drafts[len(drafts)-1].Comment
+	hash, err := saved.Hash()
+	if err != nil {
+		return err
+	}
+	if jsonOutput {
+		return printJson(commentResult{r.Revision, hash, saved})
+	}
+	fmt.Printf("Saved the draft comment %s; there are %d drafts to publish.\n", hash, len(drafts))
+	return nil
+}
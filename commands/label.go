@@ -0,0 +1,101 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/google/git-appraise/review/request"
+)
+
+var labelFlagSet = flag.NewFlagSet("label", flag.ExitOnError)
+
+var labelReview = labelFlagSet.String("review", "", "Commit of the review to label, instead of the current review")
+
+// splitLabels splits a comma-separated list of labels, dropping any empty ones.
+func splitLabels(list string) []string {
+	var labels []string
+	for _, label := range strings.Split(list, ",") {
+		if label = strings.TrimSpace(label); label != "" {
+			labels = append(labels, label)
+		}
+	}
+	return labels
+}
+
+// updateLabels adds labels to, or removes them from, a review, or lists the review's labels.
+func updateLabels(args []string) error {
+	action := ""
+	if len(args) > 0 && (args[0] == "add" || args[0] == "remove") {
+		action = args[0]
+		args = args[1:]
+	}
+	labelFlagSet.Parse(args)
+	var labels []string
+	for _, arg := range labelFlagSet.Args() {
+		labels = append(labels, splitLabels(arg)...)
+	}
+	if action == "" && len(labels) > 0 {
+		return errors.New("The labels must follow \"add\" or \"remove\".")
+	}
+	if action != "" && len(labels) == 0 {
+		return errors.New("At least one label must be given.")
+	}
+	for _, label := range labels {
+		if err := request.ValidateLabel(label); err != nil {
+			return err
+		}
+	}
+
+	var reviewArgs []string
+	if *labelReview != "" {
+		reviewArgs = []string{*labelReview}
+	}
+	r, err := loadReview(reviewArgs)
+	if err != nil {
+		return err
+	}
+
+	updated := r.Request
+	if action != "" {
+		updated.Labels = updateList(r.Request.Labels, labels, action == "remove")
+		if err := r.UpdateRequest(updated); err != nil {
+			return err
+		}
+	}
+	if len(updated.Labels) == 0 {
+		fmt.Println("The review has no labels.")
+	} else {
+		fmt.Printf("Labels: %s\n", strings.Join(updated.Labels, ", "))
+	}
+	return nil
+}
+
+// labelCmd defines the "label" subcommand.
+var labelCmd = &Command{
+	Usage: func(arg0 string) {
+		fmt.Printf("Usage: %s label [add|remove] <option>... [<label>...]\n\nWithout \"add\" or \"remove\", lists the labels of the review.\n\nOptions:\n", arg0)
+		labelFlagSet.PrintDefaults()
+	},
+	RunMethod: func(args []string) error {
+		return updateLabels(args)
+	},
+	Mutates: true,
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/google/git-appraise/repository"
+)
+
+var lintFlagSet = flag.NewFlagSet("lint", flag.ExitOnError)
+
+// lintNotes reports every note under the given ref that is not a valid note of the expected format.
+func lintNotes(v versionedRef) (invalid int, err error) {
+	var revision string
+	index := 0
+	err = repository.ForEachNote(v.ref, func(noteRevision string, note repository.Note) error {
+		if noteRevision != revision {
+			revision, index = noteRevision, 0
+		}
+		if len(bytes.TrimSpace(note)) == 0 {
+			return nil
+		}
+		index++
+		if err := v.format.Validate(note, v.decoded()); err != nil {
+			fmt.Printf("%s %s (note %d): %v\n", v.ref, noteRevision, index, err)
+			invalid++
+		}
+		return nil
+	})
+	return invalid, err
+}
+
+// lint checks every note in the notes refs used by the tool, and reports the invalid ones.
+func lint(args []string) error {
+	lintFlagSet.Parse(args)
+	if lintFlagSet.NArg() > 0 {
+		return errors.New("The lint command does not take any arguments.")
+	}
+	total := 0
+	for _, v := range versionedRefs {
+		if len(repository.ListRefs(v.ref)) == 0 {
+			continue
+		}
+		invalid, err := lintNotes(v)
+		if err != nil {
+			return err
+		}
+		total += invalid
+	}
+	if total > 0 {
+		return fmt.Errorf("Found %d invalid notes.", total)
+	}
+	return nil
+}
+
+var lintCmd = &Command{
+	Usage: func(arg0 string) {
+		fmt.Printf("Usage: %s lint\n\nOptions:\n", arg0)
+		lintFlagSet.PrintDefaults()
+	},
+	RunMethod: func(args []string) error {
+		return lint(args)
+	},
+}
@@ -17,27 +17,237 @@ limitations under the License.
 package commands
 
 import (
+	"errors"
+	"flag"
 	"fmt"
+	"github.com/google/git-appraise/repository"
 	"github.com/google/git-appraise/review"
+	"github.com/google/git-appraise/review/request"
+	"os"
+	"strings"
+	"time"
 )
 
+var listFlagSet = flag.NewFlagSet("list", flag.ExitOnError)
+
+var (
+	listArchived         = listFlagSet.Bool("archived", false, "Include reviews that have been moved to the archive")
+	listVerifySignatures = listFlagSet.Bool("verify-signatures", false, "Check the GPG signatures on the review requests")
+	listTriage           = listFlagSet.Bool("triage", false, "Only list open reviews, with overdue and high priority reviews first")
+	listLimit            = listFlagSet.Int("limit", 0, "Maximum number of reviews to list, or 0 for no limit")
+	listSkip             = listFlagSet.Int("skip", 0, "Number of reviews to skip before listing the rest")
+	listSort             = listFlagSet.String("sort", "", "Sort the reviews by \""+strings.Join(review.SortKeys, "\", \"")+"\"")
+	listFederated        = listFlagSet.Bool("federated", false, "Also list the reviews in every repository named by the \""+federatedRepoConfig+"\" config setting")
+	listJsonOutput       = listFlagSet.Bool("json", false, "Format the output as JSON")
+	listPorcelain        = listFlagSet.Bool("porcelain", false, "Format the output in the stable, line-oriented porcelain format for scripts")
+	listAuthor           = listFlagSet.String("author", "", "Only list reviews requested by the given email address")
+	listReviewer         = listFlagSet.String("reviewer", "", "Only list reviews with the given email address as a reviewer")
+	listStatus           = listFlagSet.String("status", "", "Only list reviews with the given status: \""+review.StatusOpen+"\", \""+review.StatusSubmitted+"\", or \""+review.StatusAbandoned+"\"")
+	listTarget           = listFlagSet.String("target", "", "Only list reviews targeting the given ref or branch")
+	listPriority         = listFlagSet.String("priority", "", "Only list reviews with the given priority (e.g. P1) or a more urgent one")
+	listAttention        = listFlagSet.String("attention", "", "Only list open reviews where it is the given email address's turn to act")
+	listLabel            = listFlagSet.String("label", "", "Only list reviews with the given label")
+	listMilestone        = listFlagSet.String("milestone", "", "Only list reviews attached to the given milestone")
+	listSince            = listFlagSet.String("since", "", "Only list reviews with activity since the given date (YYYY-MM-DD) or within the given age (e.g. 7d)")
+	listStale            = listFlagSet.String("stale", "", "Only list open reviews with no activity within the given age (e.g. 7d)")
+	listOverdue          = listFlagSet.Bool("overdue", false, "Only list open reviews whose due date has passed")
+)
+
+func init() {
+	listFlagSet.IntVar(listLimit, "n", 0, "Shorthand for --limit")
+}
+
+// buildFilterFromFlags builds the filter for selecting reviews from the parsed flag values.
+func buildFilterFromFlags(now time.Time) (review.Filter, error) {
+	filter := review.Filter{
+		Author:    *listAuthor,
+		Reviewer:  *listReviewer,
+		Status:    *listStatus,
+		Target:    *listTarget,
+		Label:     *listLabel,
+		Milestone: *listMilestone,
+		Priority:  *listPriority,
+		Attention: *listAttention,
+	}
+	if *listSince != "" {
+		since, err := parseSince(*listSince, now)
+		if err != nil {
+			return filter, err
+		}
+		filter.Since = since
+	}
+	if *listStale != "" {
+		age, err := parseAge(*listStale)
+		if err != nil {
+			return filter, err
+		}
+		filter.IdleSince = now.Add(-age)
+	}
+	if *listOverdue {
+		filter.OverdueAt = now
+	}
+	return filter, filter.Validate()
+}
+
+// parseSince parses the value of a --since flag, which is either a date or an age relative to now.
+func parseSince(value string, now time.Time) (time.Time, error) {
+	if since, err := time.ParseInLocation(request.DueDateFormat, value, time.Local); err == nil {
+		return since, nil
+	}
+	age, err := parseAge(value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Invalid value for --since: it must be a date (YYYY-MM-DD) or an age (e.g. 7d)")
+	}
+	return now.Add(-age), nil
+}
+
 // listReviews lists all extant reviews.
-// TODO(ojarjur): Add flags for filtering the output (e.g. to just open reviews).
-func listReviews(args []string) {
-	reviews := review.ListAll()
+func listReviews(args []string) error {
+	listFlagSet.Parse(args)
+	filter, err := buildFilterFromFlags(time.Now())
+	if err != nil {
+		return err
+	}
+	if *listTriage && *listSort != "" {
+		return errors.New("The --triage and --sort flags cannot be combined.")
+	}
+	if *listLimit < 0 || *listSkip < 0 {
+		return errors.New("The --limit and --skip flags must not be negative.")
+	}
+	if *listJsonOutput && *listPorcelain {
+		return errors.New("The --json and --porcelain flags cannot be combined.")
+	}
+	if *listPorcelain {
+		reviews, err := loadFederated(*listFederated, func() ([]review.Review, error) {
+			return loadListedReviews(filter, false)
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Println(review.PorcelainHeader)
+		for _, r := range reviews {
+			if err := r.WritePorcelainSummary(os.Stdout); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if *listJsonOutput {
+		reviews, err := loadFederated(*listFederated, func() ([]review.Review, error) {
+			return loadListedReviews(filter, true)
+		})
+		if err != nil {
+			return err
+		}
+		if reviews == nil {
+			reviews = []review.Review{}
+		}
+		now := time.Now()
+		for i := range reviews {
+			reviews[i].Overdue = reviews[i].IsOverdue(now)
+		}
+		return printJson(reviews)
+	}
+	return forEachRepo(*listFederated, func(repoPath string) error {
+		if repoPath != "" {
+			fmt.Printf("\nRepository %s\n", repoPath)
+		}
+		return listRepoReviews(filter)
+	})
+}
+
+// listRepoReviews lists the reviews in the current repository.
+func listRepoReviews(filter review.Filter) error {
+	reviews, err := loadListedReviews(filter, false)
+	if err != nil {
+		return err
+	}
 	fmt.Printf("Loaded %d reviews:\n", len(reviews))
-	for _, review := range review.ListAll() {
+	for _, review := range reviews {
 		review.PrintSummary()
 	}
+	warnIfIncomplete(reviews)
+	return nil
+}
+
+// loadListedReviews loads the reviews in the current repository that are selected by the list flags.
+//
+// Unless the full reviews are needed, only their summaries are loaded, so the
+// returned reviews do not have their comments.
+func loadListedReviews(filter review.Filter, full bool) ([]review.Review, error) {
+	if err := prepareHistory(); err != nil {
+		return nil, err
+	}
+	// Unless the reviews have to be sorted, we can stop loading them as soon
+	// as we have enough.
+	needAll := *listTriage || *listSort != ""
+	wanted := *listSkip + *listLimit
+	var reviews []review.Review
+	collect := func(r review.Review) error {
+		if !filter.Matches(r) {
+			return nil
+		}
+		reviews = append(reviews, r)
+		if !needAll && *listLimit > 0 && len(reviews) >= wanted {
+			return repository.ErrStopIteration
+		}
+		return nil
+	}
+	forEach, forEachArchived := review.ForEach, review.ForEachArchived
+	if !full {
+		forEach = func(f func(review.Review) error) error {
+			return review.ForEachSummary(func(s review.Summary) error { return f(s.Review()) })
+		}
+		forEachArchived = func(f func(review.Review) error) error {
+			return review.ForEachArchivedSummary(func(s review.Summary) error { return f(s.Review()) })
+		}
+	}
+	if err := forEach(collect); err != nil {
+		return nil, err
+	}
+	if *listArchived && (needAll || *listLimit == 0 || len(reviews) < wanted) {
+		if err := forEachArchived(collect); err != nil {
+			return nil, err
+		}
+	}
+	if *listTriage {
+		var open []review.Review
+		for _, r := range reviews {
+			if !r.IsClosed() {
+				open = append(open, r)
+			}
+		}
+		reviews = open
+		review.SortByUrgency(reviews, time.Now())
+	} else if *listSort != "" {
+		if err := review.Sort(reviews, *listSort); err != nil {
+			return nil, err
+		}
+	}
+	if *listSkip >= len(reviews) {
+		reviews = nil
+	} else {
+		reviews = reviews[*listSkip:]
+	}
+	if *listLimit > 0 && len(reviews) > *listLimit {
+		reviews = reviews[:*listLimit]
+	}
+	if *listVerifySignatures {
+		for i := range reviews {
+			reviews[i].SignatureStatus = reviews[i].Request.VerifySignature()
+		}
+	}
+	return reviews, nil
 }
 
 // listCmd defines the "list" subcommand.
 var listCmd = &Command{
 	Usage: func(arg0 string) {
-		fmt.Printf("Usage: %s list\n", arg0)
+		fmt.Printf("Usage: %s list <option>...\n\nOptions:\n", arg0)
+		listFlagSet.PrintDefaults()
 	},
 	RunMethod: func(args []string) error {
-		listReviews(args)
-		return nil
+		return listReviews(args)
 	},
+	Paged: true,
 }
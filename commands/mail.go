@@ -0,0 +1,315 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	netmail "net/mail"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/git-appraise/repository"
+	"github.com/google/git-appraise/review/comment"
+	"github.com/google/git-appraise/review/mail"
+	"github.com/google/git-appraise/review/mirror"
+	"github.com/google/git-appraise/review/request"
+)
+
+// mailConfig is the git config setting that, when "true", emails new review
+// requests and comments when the notes are pushed. The recipients are taken
+// from the "sendemail.to" setting used by "git send-email", and the reviewers
+// of a review are also copied on its request.
+const mailConfig = "appraise.mail"
+
+// mailEnabled reports whether new review requests and comments are emailed when they are pushed.
+func mailEnabled() bool {
+	return repository.GetConfig(mailConfig) == "true"
+}
+
+// latestRequest returns the latest version of the review request on a revision, if there is one.
+func latestRequest(revision string) (request.Request, bool) {
+	requests := request.ParseAllValid(repository.GetNotes(request.Ref, revision))
+	if len(requests) == 0 {
+		return request.Request{}, false
+	}
+	return requests[len(requests)-1], true
+}
+
+// commentedLines returns the lines of a file that a comment is about, if it is about any.
+func commentedLines(revision string, c comment.Comment) []string {
+	if c.Location == nil || c.Location.Path == "" || c.Location.Range == nil {
+		return nil
+	}
+	commit := c.Location.Commit
+	if commit == "" {
+		commit = revision
+	}
+	contents, err := repository.GetFileContents(commit, c.Location.Path)
+	if err != nil {
+		return nil
+	}
+	lines := strings.Split(contents, "\n")
+	start, end := int(c.Location.Range.StartLine), int(c.Location.Range.EndLine)
+	if end < start {
+		end = start
+	}
+	if start < 1 || end > len(lines) {
+		return nil
+	}
+	return lines[start-1 : end]
+}
+
+// outgoingMail returns the messages for the new review requests and comments
+// by the local user in the given outgoing notes.
+//
+// Only reviews whose request notes are all outgoing are new, and amendments
+// of comments are not emailed. Notes by other users, such as the ones
+// imported by "ingest-mail" or the mirror command, are not emailed either,
+// so that they are not echoed back to where they came from.
+func outgoingMail(differences []repository.NotesDifference) []mail.Message {
+	user := repository.GetUserEmail()
+	var requests, comments []mail.Message
+	for _, difference := range differences {
+		for revision, notes := range difference.Outgoing {
+			switch difference.Ref {
+			case request.Ref:
+				if len(notes) < len(repository.GetNotes(request.Ref, revision)) {
+					continue
+				}
+				if r, ok := latestRequest(revision); ok && r.Requester == user {
+					requests = append(requests, mail.RequestMessage(revision, r))
+				}
+			case comment.Ref:
+				r, ok := latestRequest(revision)
+				if !ok {
+					continue
+				}
+				for hash, c := range comment.ParseAllValid(notes) {
+					if c.Original != "" || c.Author != user {
+						continue
+					}
+					comments = append(comments, mail.CommentMessage(revision, r, hash, c, commentedLines(revision, c)))
+				}
+			}
+		}
+	}
+	// Requests are sent before the comments replying to them, and each in the order they were made.
+	byDate := func(messages []mail.Message) {
+		sort.SliceStable(messages, func(i, j int) bool {
+			if messages[i].Date.Equal(messages[j].Date) {
+				return messages[i].MessageID < messages[j].MessageID
+			}
+			return messages[i].Date.Before(messages[j].Date)
+		})
+	}
+	byDate(requests)
+	byDate(comments)
+	return append(requests, comments...)
+}
+
+// sendOutgoingMail emails the new review requests and comments in the given
+// outgoing notes that are not in the notified set, and adds them to it.
+//
+// The notes have already been pushed by the time this is called, so failing
+// to send them is reported rather than treated as an error.
+func sendOutgoingMail(differences []repository.NotesDifference, notified map[string]bool) {
+	var messages []mail.Message
+	for _, m := range outgoingMail(differences) {
+		if notified[m.MessageID] {
+			continue
+		}
+		notified[m.MessageID] = true
+		messages = append(messages, m)
+	}
+	if len(messages) == 0 {
+		return
+	}
+	if err := sendMail(messages); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to email %d review messages: %v\n", len(messages), err)
+	}
+}
+
+// sendMail sends the given messages with "git send-email".
+func sendMail(messages []mail.Message) error {
+	file, err := ioutil.TempFile("", "git-appraise-mail")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	err = mail.Format(file, messages)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return repository.SendEmail(file.Name())
+}
+
+var ingestMailFlagSet = flag.NewFlagSet("ingest-mail", flag.ExitOnError)
+
+var ingestMailDryRun = ingestMailFlagSet.Bool("n", false, "Only report the number of comments that would be added")
+
+// mailVote returns the vote cast by the trailers of a reply, if any.
+//
+// "Reviewed-by" and "Acked-by" accept the review, and "Nacked-by" asks for more work.
+func mailVote(text string) *bool {
+	var vote *bool
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.ToLower(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(line, "reviewed-by:"), strings.HasPrefix(line, "acked-by:"):
+			accepted := true
+			vote = &accepted
+		case strings.HasPrefix(line, "nacked-by:"):
+			rejected := false
+			vote = &rejected
+		}
+	}
+	return vote
+}
+
+// mailTarget identifies the review request or comment that a message is about.
+type mailTarget struct {
+	Revision string
+	// Hash is the hash of the comment, and is empty for the review request.
+	Hash string
+	// Commit is the commit that the message is about, for patches and the replies to them.
+	Commit string
+}
+
+// ingestReplies adds the given replies as comments to the batch, threaded
+// under the review requests and comments they reply to. Those are either the
+// messages sent for reviews, or the messages in the given targets, to which
+// the replies are added.
+func ingestReplies(messages []mail.Message, targets map[string]mailTarget, batch *mirror.Batch) error {
+	// Replies are added after the messages they reply to, so that they can be threaded under them.
+	sort.SliceStable(messages, func(i, j int) bool {
+		return messages[i].Date.Before(messages[j].Date)
+	})
+	lookup := func(id string) (mailTarget, bool) {
+		if revision, hash, ok := mail.ParseID(id); ok {
+			_, exists := latestRequest(revision)
+			return mailTarget{Revision: revision, Hash: hash}, exists
+		}
+		target, ok := targets[id]
+		return target, ok
+	}
+	for _, m := range messages {
+		if _, _, ok := mail.ParseID(m.MessageID); ok {
+			// This is one of the messages sent for a review, rather than a reply.
+			continue
+		}
+		target, ok := lookup(mail.ReplyTarget(m))
+		for i := len(m.References) - 1; !ok && i >= 0; i-- {
+			target, ok = lookup(m.References[i])
+		}
+		if !ok {
+			continue
+		}
+		author := m.From
+		if address, err := netmail.ParseAddress(m.From); err == nil {
+			author = address.Address
+		}
+		date := m.Date
+		if date.IsZero() {
+			date = time.Now()
+		}
+		text := mail.ReplyText(m.Body)
+		vote := mailVote(text)
+		if text == "" && vote == nil {
+			continue
+		}
+		c := mirror.NewComment(mirror.Timestamp(date), author, text)
+		c.Resolved = vote
+		// Votes apply to the whole review, while other replies stay in their thread.
+		if vote == nil {
+			c.Parent = target.Hash
+			if target.Commit != "" {
+				c.Location = &comment.Location{Commit: target.Commit}
+			}
+		}
+		hash, err := batch.AddComment(target.Revision, c)
+		if err != nil {
+			return err
+		}
+		if m.MessageID != "" {
+			targets[m.MessageID] = mailTarget{target.Revision, hash, target.Commit}
+		}
+	}
+	return nil
+}
+
+// ingestMailFrom adds the replies in the mbox read from the given reader as
+// comments to the batch, threaded under the review requests and comments they reply to.
+func ingestMailFrom(r io.Reader, batch *mirror.Batch) error {
+	messages, err := mail.Parse(r)
+	if err != nil {
+		return err
+	}
+	return ingestReplies(messages, make(map[string]mailTarget), batch)
+}
+
+// ingestMail adds the replies in mbox files to the review emails as comments.
+func ingestMail(args []string) error {
+	ingestMailFlagSet.Parse(args)
+	args = ingestMailFlagSet.Args()
+
+	batch := mirror.NewBatch()
+	if len(args) == 0 {
+		if err := ingestMailFrom(os.Stdin, batch); err != nil {
+			return err
+		}
+	}
+	for _, path := range args {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		err = ingestMailFrom(file, batch)
+		file.Close()
+		if err != nil {
+			return err
+		}
+	}
+	if *ingestMailDryRun {
+		fmt.Printf("Would add %d comments\n", batch.Len())
+		return nil
+	}
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	fmt.Printf("Added %d comments\n", batch.Len())
+	return nil
+}
+
+// ingestMailCmd defines the "ingest-mail" subcommand.
+var ingestMailCmd = &Command{
+	Usage: func(arg0 string) {
+		fmt.Printf("Usage: %s ingest-mail <option>... [<mbox>...]\n\nReads from stdin if no files are given.\n\nOptions:\n", arg0)
+		ingestMailFlagSet.PrintDefaults()
+	},
+	RunMethod: func(args []string) error {
+		return ingestMail(args)
+	},
+	Mutates: true,
+}
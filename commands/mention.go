@@ -0,0 +1,179 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/google/git-appraise/repository"
+	"github.com/google/git-appraise/review/comment"
+	"github.com/google/git-appraise/review/mention"
+	"github.com/google/git-appraise/review/request"
+)
+
+// mentionHookConfig is the git config setting holding the command, or the
+// URL of the webhook, that is notified of each mention when the notes are pushed.
+const mentionHookConfig = "appraise.mentionHook"
+
+// mentionEvent describes a user being mentioned in a review request or comment.
+type mentionEvent struct {
+	// Kind is either "request" or "comment".
+	Kind     string `json:"kind"`
+	Revision string `json:"revision"`
+	// Hash is the hash of the comment, for comments.
+	Hash      string `json:"hash,omitempty"`
+	Author    string `json:"author"`
+	Mentioned string `json:"mentioned"`
+	Text      string `json:"text"`
+}
+
+// key identifies the mention, so that it is only notified once per push.
+func (event mentionEvent) key() string {
+	return event.Revision + ":" + event.Hash + ":" + event.Mentioned
+}
+
+// requestMentions returns the mentions added by the given new request notes on a revision.
+//
+// Mentions that were already in an earlier version of the request are not repeated.
+func requestMentions(revision string, outgoing []repository.Note) []mentionEvent {
+	isOutgoing := make(map[string]bool)
+	for _, note := range outgoing {
+		isOutgoing[string(note)] = true
+	}
+	var earlier []string
+	for _, note := range repository.GetNotes(request.Ref, revision) {
+		if isOutgoing[string(note)] {
+			continue
+		}
+		if r, err := request.Parse(note); err == nil {
+			earlier = append(earlier, r.Mentions...)
+		}
+	}
+	var events []mentionEvent
+	for _, r := range request.ParseAllValid(outgoing) {
+		for _, user := range mention.Added(r.Mentions, earlier) {
+			events = append(events, mentionEvent{"request", revision, "", r.Requester, user, r.Description})
+		}
+		earlier = append(earlier, r.Mentions...)
+	}
+	return events
+}
+
+// commentMentions returns the mentions in the given new comment notes on a revision.
+//
+// An amended comment only notifies the users that the original did not already mention.
+func commentMentions(revision string, outgoing []repository.Note) []mentionEvent {
+	comments := comment.ParseAllValid(repository.GetNotes(comment.Ref, revision))
+	var events []mentionEvent
+	for hash, c := range comment.ParseAllValid(outgoing) {
+		var earlier []string
+		if c.Original != "" {
+			earlier = comments[c.Original].Mentions
+		}
+		for _, user := range mention.Added(c.Mentions, earlier) {
+			events = append(events, mentionEvent{"comment", revision, hash, c.Author, user, c.Description})
+		}
+	}
+	return events
+}
+
+// outgoingNotes returns the review notes that pushing to the given remote would add to it.
+//
+// This is only done when a mention hook, the email gateway, or a webhook is
+// configured, as it requires fetching the remote's notes.
+func outgoingNotes(remote string) ([]repository.NotesDifference, error) {
+	if repository.GetConfig(mentionHookConfig) == "" && !mailEnabled() && len(webhookURLs()) == 0 {
+		return nil, nil
+	}
+	remoteNotesRefPattern, err := getRemoteNotesRefPattern(remote)
+	if err != nil {
+		return nil, err
+	}
+	return repository.CompareRemoteNotes(remote, notesRefPattern, remoteNotesRefPattern)
+}
+
+// outgoingMentions returns the mentions in the given outgoing review notes.
+func outgoingMentions(differences []repository.NotesDifference) []mentionEvent {
+	if repository.GetConfig(mentionHookConfig) == "" {
+		return nil
+	}
+	var events []mentionEvent
+	for _, difference := range differences {
+		for revision, notes := range difference.Outgoing {
+			switch difference.Ref {
+			case request.Ref:
+				events = append(events, requestMentions(revision, notes)...)
+			case comment.Ref:
+				events = append(events, commentMentions(revision, notes)...)
+			}
+		}
+	}
+	return events
+}
+
+// notifyOutgoing notifies the mention hook of the mentions in the given
+// outgoing notes, emails their new review requests and comments, and sends
+// their review events to the webhooks, once they have been pushed. The notified set keeps track of what was already
+// notified, so that pushing to several remotes only notifies it once.
+func notifyOutgoing(differences []repository.NotesDifference, notified map[string]bool) {
+	notifyMentions(outgoingMentions(differences), notified)
+	if mailEnabled() {
+		sendOutgoingMail(differences, notified)
+	}
+	if len(webhookURLs()) > 0 {
+		sendWebhooks(differences, notified)
+	}
+}
+
+// runMentionHook notifies the mention hook of a mention.
+//
+// A hook that is an http or https URL gets the mention POSTed to it as JSON,
+// signed in the same way as the webhooks. Otherwise, the hook is a shell
+// command, which gets the mention as JSON on its standard input, and also in
+// environment variables.
+func runMentionHook(hook string, event mentionEvent) error {
+	eventJson, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if strings.HasPrefix(hook, "http://") || strings.HasPrefix(hook, "https://") {
+		return postPayload(hook, webhookSecret(), eventMention, eventJson)
+	}
+	env := hookEvent{Kind: event.Kind, Revision: event.Revision, Hash: event.Hash, Author: event.Author, Users: []string{event.Mentioned}}.environment()
+	return runHook(hook, env, eventJson)
+}
+
+// notifyMentions notifies the mention hook of each of the given mentions that
+// is not in the notified set, and adds them to it.
+//
+// The notes have already been pushed by the time this is called, so a failed
+// notification is reported rather than treated as an error.
+func notifyMentions(events []mentionEvent, notified map[string]bool) {
+	hook := repository.GetConfig(mentionHookConfig)
+	for _, event := range events {
+		if notified[event.key()] {
+			continue
+		}
+		notified[event.key()] = true
+		if err := runMentionHook(hook, event); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to notify %s of the mention in %s: %v\n", event.Mentioned, event.Revision, err)
+		}
+	}
+}
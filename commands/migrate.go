@@ -0,0 +1,221 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+
+	"github.com/google/git-appraise/repository"
+	"github.com/google/git-appraise/review/analyses"
+	"github.com/google/git-appraise/review/checklist"
+	"github.com/google/git-appraise/review/ci"
+	"github.com/google/git-appraise/review/comment"
+	"github.com/google/git-appraise/review/milestone"
+	"github.com/google/git-appraise/review/nudge"
+	"github.com/google/git-appraise/review/request"
+	"github.com/google/git-appraise/review/schema"
+	"github.com/google/git-appraise/review/viewed"
+)
+
+var migrateFlagSet = flag.NewFlagSet("migrate", flag.ExitOnError)
+
+var migrateDryRun = migrateFlagSet.Bool("dry-run", false, "Only report the notes that would be upgraded")
+
+// versionedRef is a notes ref holding one kind of versioned note.
+type versionedRef struct {
+	ref    string
+	format *schema.Format
+	// rewrite writes an upgraded note in the same way that the tool writes new notes.
+	rewrite func(repository.Note) (repository.Note, error)
+	// decoded returns a new value of the type that the notes are decoded into.
+	decoded func() interface{}
+}
+
+var versionedRefs = []versionedRef{
+	{request.Ref, request.Format, rewriteRequest, func() interface{} { return new(request.Request) }},
+	{request.ArchiveRef, request.Format, rewriteRequest, func() interface{} { return new(request.Request) }},
+	{comment.Ref, comment.Format, rewriteComment, func() interface{} { return new(comment.Comment) }},
+	{ci.Ref, ci.Format, rewriteReport, func() interface{} { return new(ci.Report) }},
+	{analyses.Ref, analyses.Format, rewriteAnalysis, func() interface{} { return new(analyses.Report) }},
+	{milestone.Ref, milestone.Format, rewriteMilestone, func() interface{} { return new(milestone.Milestone) }},
+	{viewed.Ref, viewed.Format, rewriteMarker, func() interface{} { return new(viewed.Marker) }},
+	{nudge.Ref, nudge.Format, rewriteNudge, func() interface{} { return new(nudge.Nudge) }},
+	{checklist.Ref, checklist.Format, rewriteMark, func() interface{} { return new(checklist.Mark) }},
+}
+
+func rewriteRequest(note repository.Note) (repository.Note, error) {
+	r, err := request.Parse(note)
+	if err != nil {
+		return nil, err
+	}
+	return r.Write()
+}
+
+func rewriteComment(note repository.Note) (repository.Note, error) {
+	c, err := comment.Parse(note)
+	if err != nil {
+		return nil, err
+	}
+	return c.Write()
+}
+
+func rewriteReport(note repository.Note) (repository.Note, error) {
+	report, err := ci.Parse(note)
+	if err != nil {
+		return nil, err
+	}
+	bytes, err := json.Marshal(report)
+	return repository.Note(bytes), err
+}
+
+func rewriteAnalysis(note repository.Note) (repository.Note, error) {
+	report, err := analyses.Parse(note)
+	if err != nil {
+		return nil, err
+	}
+	return report.Write()
+}
+
+func rewriteMilestone(note repository.Note) (repository.Note, error) {
+	m, err := milestone.Parse(note)
+	if err != nil {
+		return nil, err
+	}
+	return m.Write()
+}
+
+func rewriteMarker(note repository.Note) (repository.Note, error) {
+	marker, err := viewed.Parse(note)
+	if err != nil {
+		return nil, err
+	}
+	return marker.Write()
+}
+
+func rewriteNudge(note repository.Note) (repository.Note, error) {
+	n, err := nudge.Parse(note)
+	if err != nil {
+		return nil, err
+	}
+	return n.Write()
+}
+
+func rewriteMark(note repository.Note) (repository.Note, error) {
+	mark, err := checklist.Parse(note)
+	if err != nil {
+		return nil, err
+	}
+	return mark.Write()
+}
+
+// migrationCounts summarizes the notes in a ref by how they compare to the latest version of their format.
+type migrationCounts struct {
+	upgraded, newer int
+}
+
+// upgradeNotes upgrades the notes under the given ref that use an older
+// version of their format, and returns the notes of every object with
+// upgraded notes, as they should be rewritten.
+//
+// Notes that are not in the expected format are left alone, as notes refs may hold other kinds of notes too.
+func upgradeNotes(v versionedRef) (map[string][]repository.Note, migrationCounts, error) {
+	var counts migrationCounts
+	rewritten := make(map[string][]repository.Note)
+	var revision string
+	var notes []repository.Note
+	changed := false
+	flush := func() {
+		if changed {
+			rewritten[revision] = notes
+		}
+		notes, changed = nil, false
+	}
+	err := repository.ForEachNote(v.ref, func(noteRevision string, note repository.Note) error {
+		if noteRevision != revision {
+			flush()
+			revision = noteRevision
+		}
+		version, err := schema.Version(note)
+		switch {
+		case err != nil || version == v.format.Latest():
+		case version > v.format.Latest():
+			counts.newer++
+		default:
+			upgraded, err := v.format.Upgrade(note)
+			if err == nil {
+				upgraded, err = v.rewrite(upgraded)
+			}
+			if err != nil {
+				return fmt.Errorf("Failed to upgrade a note on %s in %s: %v", noteRevision, v.ref, err)
+			}
+			note = upgraded
+			counts.upgraded++
+			changed = true
+		}
+		notes = append(notes, note)
+		return nil
+	})
+	flush()
+	return rewritten, counts, err
+}
+
+// migrateSchema rewrites the notes that use older versions of their formats in the latest versions.
+func migrateSchema(args []string) error {
+	migrateFlagSet.Parse(args)
+	for _, v := range versionedRefs {
+		if len(repository.ListRefs(v.ref)) == 0 {
+			continue
+		}
+		rewritten, counts, err := upgradeNotes(v)
+		if err != nil {
+			return err
+		}
+		if counts.newer > 0 {
+			fmt.Printf("%d notes in %s use a newer format than this tool supports, and were left alone.\n", counts.newer, v.ref)
+		}
+		if counts.upgraded == 0 {
+			if counts.newer == 0 {
+				fmt.Printf("All of the notes in %s are in the latest format (version %d).\n", v.ref, v.format.Latest())
+			}
+			continue
+		}
+		if *migrateDryRun {
+			fmt.Printf("Would upgrade %d notes in %s to version %d.\n", counts.upgraded, v.ref, v.format.Latest())
+			continue
+		}
+		message := fmt.Sprintf("Upgraded %d notes to version %d by 'git appraise migrate'", counts.upgraded, v.format.Latest())
+		if err := repository.RewriteNotes(v.ref, rewritten, message); err != nil {
+			return err
+		}
+		fmt.Printf("Upgraded %d notes in %s to version %d.\n", counts.upgraded, v.ref, v.format.Latest())
+	}
+	return nil
+}
+
+// migrateCmd defines the "migrate" subcommand.
+var migrateCmd = &Command{
+	Usage: func(arg0 string) {
+		fmt.Printf("Usage: %s migrate <option>...\n\nRewrites the notes written in older versions of their formats in the latest versions.\n\nOptions:\n", arg0)
+		migrateFlagSet.PrintDefaults()
+	},
+	RunMethod: func(args []string) error {
+		return migrateSchema(args)
+	},
+	Mutates: true,
+}
@@ -0,0 +1,171 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/google/git-appraise/repository"
+	"github.com/google/git-appraise/review"
+	"github.com/google/git-appraise/review/analyses"
+	"github.com/google/git-appraise/review/ci"
+)
+
+const (
+	// rewriteRefConfig is the git config setting that tells "git commit --amend"
+	// and "git rebase" which notes to copy onto the rewritten commits.
+	rewriteRefConfig = "notes.rewriteRef"
+
+	// rewriteNotesConfig is the git config setting that, when set to "false",
+	// prevents us from adding our notes to the rewriteRefConfig setting.
+	rewriteNotesConfig = "appraise.rewriteNotes"
+)
+
+// rewrittenNotesRefs are the notes that are copied onto rewritten commits.
+//
+// These are the reports on individual commits. The notes of a review stay on
+// its first commit, which records the rewritten commit as its alias instead,
+// as copying them would make a second copy of the review.
+var rewrittenNotesRefs = []string{ci.Ref, analyses.Ref}
+
+// rewriteRefPattern returns the value of rewriteRefConfig that selects the given notes ref.
+//
+// This is a glob, since git warns about every rewrite when a notes ref that is
+// named exactly does not exist yet, which is the case until the first report.
+func rewriteRefPattern(notesRef string) string {
+	return notesRef + "*"
+}
+
+// configureNotesRewrite makes sure that the reports on commits follow them when those are amended or rebased.
+func configureNotesRewrite() error {
+	if repository.GetConfig(rewriteNotesConfig) == "false" {
+		return nil
+	}
+	configured := make(map[string]bool)
+	for _, rewriteRef := range repository.GetConfigAll(rewriteRefConfig) {
+		configured[rewriteRef] = true
+	}
+	if configured[notesRefPattern] {
+		// Added by earlier releases, and copies the review requests too.
+		if err := repository.RemoveConfig(rewriteRefConfig, notesRefPattern); err != nil {
+			return err
+		}
+	}
+	for _, notesRef := range rewrittenNotesRefs {
+		if rewriteRef := rewriteRefPattern(notesRef); !configured[rewriteRef] {
+			if err := repository.AddConfig(rewriteRefConfig, rewriteRef); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// recordRewrite makes the open review whose first commit is oldCommit, if
+// any, record newCommit as its first commit.
+//
+// This returns whether there was such a review.
+func recordRewrite(oldCommit, newCommit string) (bool, error) {
+	for _, r := range review.ListOpen() {
+		if r.FirstCommit() != oldCommit {
+			continue
+		}
+		updated := r.Request
+		updated.Alias = newCommit
+		if updated.Alias == r.Revision {
+			updated.Alias = ""
+		}
+		return true, r.UpdateRequest(updated)
+	}
+	return false, nil
+}
+
+// recordRewrites reads the rewritten commits, as given to the post-rewrite
+// hook on its standard input, and records them in the reviews of those commits.
+func recordRewrites(input io.Reader) error {
+	scanner := bufio.NewScanner(input)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		if _, err := recordRewrite(fields[0], fields[1]); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// migrateNotes moves the review notes from one commit onto another.
+//
+// The reports on the old commit are copied, and a review of the old commit
+// records the new one as its first commit.
+func migrateNotes(args []string) error {
+	if len(args) != 2 {
+		return errors.New("The migrate-notes command takes exactly two arguments: the old and new commits.")
+	}
+	oldCommit, err := repository.ResolveCommit(args[0])
+	if err != nil {
+		return err
+	}
+	newCommit, err := repository.ResolveCommit(args[1])
+	if err != nil {
+		return err
+	}
+
+	message := fmt.Sprintf("Notes migrated from %s to %s by 'git appraise migrate-notes'", oldCommit, newCommit)
+	var migrated int
+	for _, notesRef := range rewrittenNotesRefs {
+		notes := repository.GetNotes(notesRef, oldCommit)
+		if notes == nil {
+			continue
+		}
+		added, err := repository.MergeNotes(notesRef, map[string][]repository.Note{newCommit: notes}, message, mergeKey(notesRef))
+		if err != nil {
+			return err
+		}
+		if added > 0 {
+			fmt.Printf("Copied %d notes in %s\n", added, notesRef)
+		}
+		migrated += added
+	}
+	moved, err := recordRewrite(oldCommit, newCommit)
+	if err != nil {
+		return err
+	}
+	if moved {
+		fmt.Printf("Moved the review of %s to %s\n", oldCommit, newCommit)
+	} else if migrated == 0 {
+		fmt.Printf("There were no new notes to copy from %s\n", oldCommit)
+	}
+	return configureNotesRewrite()
+}
+
+// migrateNotesCmd defines the "migrate-notes" subcommand.
+var migrateNotesCmd = &Command{
+	Usage: func(arg0 string) {
+		fmt.Printf("Usage: %s migrate-notes <old-commit> <new-commit>\n", arg0)
+	},
+	RunMethod: func(args []string) error {
+		return migrateNotes(args)
+	},
+	Mutates: true,
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/google/git-appraise/repository"
+	"github.com/google/git-appraise/review"
+	"github.com/google/git-appraise/review/ci"
+	"github.com/google/git-appraise/review/request"
+)
+
+// git runs the given git command in the current directory, failing the test if it fails.
+func git(t *testing.T, args ...string) string {
+	out, err := exec.Command("git", args...).CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// initTestRepo creates a repository with a single commit in a temporary
+// directory, and makes it the current one for the rest of the test.
+func initTestRepo(t *testing.T) {
+	t.Chdir(t.TempDir())
+	// Restored after the test by Setenv.
+	t.Setenv("GIT_DIR", "")
+	os.Unsetenv("GIT_DIR")
+	t.Setenv("GIT_CONFIG_GLOBAL", "/dev/null")
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	git(t, "init", "--quiet", "--initial-branch=master")
+	git(t, "config", "user.name", "Test User")
+	git(t, "config", "user.email", "test@example.com")
+	git(t, "commit", "--quiet", "--allow-empty", "-m", "Initial commit")
+}
+
+func TestAmendReviewedCommit(t *testing.T) {
+	initTestRepo(t)
+	git(t, "checkout", "--quiet", "-b", "feature")
+	git(t, "commit", "--quiet", "--allow-empty", "-m", "Reviewed change")
+	reviewed := git(t, "rev-parse", "HEAD")
+	r := request.New(nil, "refs/heads/feature", "refs/heads/master", "Reviewed change")
+	note, err := r.Write()
+	if err != nil {
+		t.Fatal(err)
+	}
+	repository.AppendNote(request.Ref, reviewed, note)
+	repository.AppendNote(ci.Ref, reviewed, repository.Note(`{"agent":"test","status":"success","v":0}`))
+	if err := configureNotesRewrite(); err != nil {
+		t.Fatal(err)
+	}
+
+	git(t, "commit", "--quiet", "--amend", "--allow-empty", "-m", "Amended change")
+	amended := git(t, "rev-parse", "HEAD")
+	if err := recordRewrites(strings.NewReader(reviewed + " " + amended + "\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	if notes := repository.GetNotes(request.Ref, amended); len(notes) != 0 {
+		t.Errorf("The review request was copied onto the amended commit: %q", notes)
+	}
+	if notes := repository.GetNotes(ci.Ref, amended); len(notes) != 1 {
+		t.Errorf("The CI report was not copied onto the amended commit: %q", notes)
+	}
+	reviews := review.ListAll()
+	if len(reviews) != 1 {
+		t.Fatalf("Expected a single review after amending its commit, got %d", len(reviews))
+	}
+	if r := reviews[0]; r.Revision != reviewed || r.FirstCommit() != amended {
+		t.Fatalf("Unexpected review of %q with the first commit %q", r.Revision, r.FirstCommit())
+	}
+
+	// Submitting the amended commit submits the review.
+	git(t, "checkout", "--quiet", "master")
+	git(t, "merge", "--quiet", "--ff-only", "feature")
+	if r := review.Get(reviewed); r == nil || !r.Submitted {
+		t.Fatalf("The review was not submitted along with its amended commit: %+v", r)
+	}
+}
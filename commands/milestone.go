@@ -0,0 +1,159 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/google/git-appraise/review"
+	"github.com/google/git-appraise/review/milestone"
+)
+
+var milestoneFlagSet = flag.NewFlagSet("milestone", flag.ExitOnError)
+
+var (
+	milestoneDue        = milestoneFlagSet.String("due", "", "Target date of the milestone being created, as YYYY-MM-DD")
+	milestoneReview     = milestoneFlagSet.String("review", "", "Commit of the review to attach or detach, instead of the current review")
+	milestoneJsonOutput = milestoneFlagSet.Bool("json", false, "Format the progress summary as JSON")
+)
+
+// printMilestoneProgress prints a table of the reviews of each milestone.
+func printMilestoneProgress(progress []review.MilestoneProgress) {
+	if len(progress) == 0 {
+		fmt.Println("There are no milestones.")
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "MILESTONE\tDUE\tOPEN\tSUBMITTED\tABANDONED")
+	for _, p := range progress {
+		due := p.Milestone.Due
+		if due == "" {
+			due = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\n", p.Milestone.Name, due, p.Open, p.Submitted, p.Abandoned)
+	}
+	w.Flush()
+}
+
+// checkMilestoneExists returns an error if there is no milestone with the given name.
+func checkMilestoneExists(name string) error {
+	if milestone.Get(name) == nil {
+		return fmt.Errorf("There is no milestone %q; create it with \"milestone create\" first.", name)
+	}
+	return nil
+}
+
+// createMilestone creates a milestone, or changes the target date of an existing one.
+func createMilestone(name string) error {
+	existing := milestone.Get(name)
+	if err := milestone.Save(milestone.New(name, *milestoneDue)); err != nil {
+		return err
+	}
+	if existing != nil {
+		fmt.Printf("Updated the milestone %q\n", name)
+	} else {
+		fmt.Printf("Created the milestone %q\n", name)
+	}
+	return nil
+}
+
+// setMilestone attaches a review to the named milestone, or detaches it from its milestone if the name is empty.
+func setMilestone(name string) error {
+	if name != "" {
+		if err := checkMilestoneExists(name); err != nil {
+			return err
+		}
+	}
+	var reviewArgs []string
+	if *milestoneReview != "" {
+		reviewArgs = []string{*milestoneReview}
+	}
+	r, err := loadReview(reviewArgs)
+	if err != nil {
+		return err
+	}
+	previous := r.Request.Milestone
+	if previous == name {
+		return nil
+	}
+	updated := r.Request
+	updated.Milestone = name
+	if err := r.UpdateRequest(updated); err != nil {
+		return err
+	}
+	if name == "" {
+		fmt.Printf("Detached the review %s from the milestone %q\n", r.Revision, previous)
+	} else {
+		fmt.Printf("Attached the review %s to the milestone %q\n", r.Revision, name)
+	}
+	return nil
+}
+
+// milestones creates milestones, attaches reviews to them, or summarizes their progress.
+func milestones(args []string) error {
+	action := ""
+	if len(args) > 0 && (args[0] == "create" || args[0] == "attach" || args[0] == "detach") {
+		action = args[0]
+		args = args[1:]
+	}
+	milestoneFlagSet.Parse(args)
+	args = milestoneFlagSet.Args()
+
+	switch action {
+	case "create", "attach":
+		if len(args) != 1 {
+			return errors.New("Exactly one milestone must be given.")
+		}
+		if action == "create" {
+			return createMilestone(args[0])
+		}
+		return setMilestone(args[0])
+	case "detach":
+		if len(args) != 0 {
+			return errors.New("No milestone may be given, since reviews have at most one.")
+		}
+		return setMilestone("")
+	}
+	if len(args) != 0 {
+		return errors.New("The action must be \"create\", \"attach\", or \"detach\".")
+	}
+	progress := review.SummarizeMilestones(milestone.List(), append(review.ListAll(), review.ListArchived()...))
+	if *milestoneJsonOutput {
+		if progress == nil {
+			progress = []review.MilestoneProgress{}
+		}
+		return printJson(progress)
+	}
+	printMilestoneProgress(progress)
+	return nil
+}
+
+// milestoneCmd defines the "milestone" subcommand.
+var milestoneCmd = &Command{
+	Usage: func(arg0 string) {
+		fmt.Printf("Usage: %s milestone [create|attach|detach] <option>... [<milestone>]\n\nWithout an action, summarizes the progress of every milestone.\n\nOptions:\n", arg0)
+		milestoneFlagSet.PrintDefaults()
+	},
+	RunMethod: func(args []string) error {
+		return milestones(args)
+	},
+	Mutates: true,
+}
@@ -0,0 +1,519 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/google/git-appraise/repository"
+	"github.com/google/git-appraise/review"
+	"github.com/google/git-appraise/review/mirror"
+	"github.com/google/git-appraise/review/mirror/bitbucket"
+	"github.com/google/git-appraise/review/mirror/gerrit"
+	"github.com/google/git-appraise/review/mirror/github"
+	"github.com/google/git-appraise/review/mirror/gitlab"
+	"github.com/google/git-appraise/review/mirror/phabricator"
+)
+
+const (
+	// githubURLConfig is the git config setting holding the URL of the GitHub API.
+	githubURLConfig = "appraise.github.url"
+	// githubRepoConfig is the git config setting holding the GitHub repository, as "owner/name".
+	githubRepoConfig = "appraise.github.repo"
+	// githubTokenConfig is the git config setting holding the GitHub access token.
+	githubTokenConfig = "appraise.github.token"
+	// githubTokenEnv is the environment variable used when the access token is not configured.
+	githubTokenEnv = "GITHUB_TOKEN"
+
+	// gitlabURLConfig is the git config setting holding the URL of the GitLab instance.
+	gitlabURLConfig = "appraise.gitlab.url"
+	// gitlabProjectConfig is the git config setting holding the path of the GitLab project.
+	gitlabProjectConfig = "appraise.gitlab.project"
+	// gitlabTokenConfig is the git config setting holding the GitLab access token.
+	gitlabTokenConfig = "appraise.gitlab.token"
+	// gitlabTokenEnv is the environment variable used when the access token is not configured.
+	gitlabTokenEnv = "GITLAB_TOKEN"
+
+	// gerritURLConfig is the git config setting holding the URL of the Gerrit server.
+	gerritURLConfig = "appraise.gerrit.url"
+	// gerritProjectConfig is the git config setting holding the name of the Gerrit project.
+	gerritProjectConfig = "appraise.gerrit.project"
+	// gerritUserConfig is the git config setting holding the Gerrit username.
+	gerritUserConfig = "appraise.gerrit.user"
+	// gerritPasswordConfig is the git config setting holding the Gerrit HTTP password.
+	gerritPasswordConfig = "appraise.gerrit.password"
+	// gerritPasswordEnv is the environment variable used when the HTTP password is not configured.
+	gerritPasswordEnv = "GERRIT_PASSWORD"
+
+	// bitbucketURLConfig is the git config setting holding the URL of the Bitbucket Server, if not using Bitbucket Cloud.
+	bitbucketURLConfig = "appraise.bitbucket.url"
+	// bitbucketRepoConfig is the git config setting holding the Bitbucket repository.
+	bitbucketRepoConfig = "appraise.bitbucket.repo"
+	// bitbucketUserConfig is the git config setting holding the Bitbucket username.
+	bitbucketUserConfig = "appraise.bitbucket.user"
+	// bitbucketTokenConfig is the git config setting holding the Bitbucket access token or password.
+	bitbucketTokenConfig = "appraise.bitbucket.token"
+	// bitbucketTokenEnv is the environment variable used when the access token is not configured.
+	bitbucketTokenEnv = "BITBUCKET_TOKEN"
+	// bitbucketLastSyncConfig is the git config setting recording when the pull requests were last synchronized.
+	bitbucketLastSyncConfig = "appraise.bitbucket.lastSync"
+
+	// phabricatorURLConfig is the git config setting holding the URL of the Phabricator instance.
+	phabricatorURLConfig = "appraise.phabricator.url"
+	// phabricatorRepositoryConfig is the git config setting holding the Phabricator repository.
+	phabricatorRepositoryConfig = "appraise.phabricator.repository"
+	// phabricatorTokenConfig is the git config setting holding the Conduit API token.
+	phabricatorTokenConfig = "appraise.phabricator.token"
+	// phabricatorTokenEnv is the environment variable used when the API token is not configured.
+	phabricatorTokenEnv = "CONDUIT_TOKEN"
+)
+
+var mirrorFlagSet = flag.NewFlagSet("mirror", flag.ExitOnError)
+
+var (
+	mirrorRemote = mirrorFlagSet.String("remote", "", "Git remote to fetch the reviewed commits from. Defaults to the \""+remoteConfig+"\" config setting, or "+defaultRemote)
+	mirrorID     = mirrorFlagSet.Int("id", 0, "Only mirror the pull request, merge request, change, or revision with this number")
+	mirrorExport = mirrorFlagSet.Bool("export", false, "Also post your comments and votes that are not on the host yet")
+	mirrorSince  = mirrorFlagSet.String("since", "", "Only mirror the Bitbucket pull requests updated since this date (YYYY-MM-DD) or age (e.g. 7d). Defaults to the time of the last synchronization")
+	mirrorDryRun = mirrorFlagSet.Bool("n", false, "Only report what would be imported, without fetching, writing notes, or posting anything")
+)
+
+// mirrorGithub mirrors the pull requests of a GitHub repository.
+func mirrorGithub(remote string) error {
+	url := repository.GetConfig(githubURLConfig)
+	if url == "" {
+		url = github.DefaultURL
+	}
+	repo := repository.GetConfig(githubRepoConfig)
+	if repo == "" {
+		if repo = github.RepoFromURL(repository.GetRemoteURL(remote)); repo == "" {
+			return fmt.Errorf("The remote %q is not on GitHub; set the \"%s\" config setting to the repository's \"owner/name\".", remote, githubRepoConfig)
+		}
+	}
+	token := repository.GetConfig(githubTokenConfig)
+	if token == "" {
+		token = os.Getenv(githubTokenEnv)
+	}
+	if *mirrorExport && token == "" {
+		return fmt.Errorf("Exporting requires an access token, in the \"%s\" config setting or the %s environment variable.", githubTokenConfig, githubTokenEnv)
+	}
+	m := github.New(url, token, repo, remote)
+
+	var prs []github.PullRequest
+	if *mirrorID != 0 {
+		pr, err := m.GetPullRequest(*mirrorID)
+		if err != nil {
+			return err
+		}
+		prs = append(prs, pr)
+	} else {
+		var err error
+		if prs, err = m.ListPullRequests(); err != nil {
+			return err
+		}
+	}
+	if !*mirrorDryRun {
+		if err := m.FetchHeads(); err != nil {
+			return err
+		}
+	}
+
+	batch := mirror.NewBatch()
+	imported := make(map[int]*github.Imported)
+	for _, pr := range prs {
+		i, err := m.Import(pr, batch)
+		if err != nil {
+			return fmt.Errorf("Failed to import the pull request #%d: %v", pr.Number, err)
+		}
+		imported[pr.Number] = i
+	}
+	if *mirrorDryRun {
+		fmt.Printf("Would import %d notes from %d pull requests\n", batch.Len(), len(prs))
+		return nil
+	}
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	fmt.Printf("Imported %d notes from %d pull requests\n", batch.Len(), len(prs))
+	if !*mirrorExport {
+		return nil
+	}
+
+	var exported int
+	for _, pr := range prs {
+		posted, err := m.Export(pr, imported[pr.Number])
+		exported += posted
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to export to the pull request #%d: %v\n", pr.Number, err)
+		}
+	}
+	fmt.Printf("Exported %d comments\n", exported)
+	return nil
+}
+
+// mirrorGitlab synchronizes the merge requests of a GitLab project.
+func mirrorGitlab(remote string) error {
+	instanceURL := repository.GetConfig(gitlabURLConfig)
+	if instanceURL == "" {
+		instanceURL = gitlab.DefaultURL
+	}
+	project := repository.GetConfig(gitlabProjectConfig)
+	if project == "" {
+		if project = gitlab.ProjectFromURL(instanceURL, repository.GetRemoteURL(remote)); project == "" {
+			return fmt.Errorf("The remote %q is not on %s; set the \"%s\" config setting to the project's path, and \"%s\" to the URL of its GitLab instance.", remote, instanceURL, gitlabProjectConfig, gitlabURLConfig)
+		}
+	}
+	token := repository.GetConfig(gitlabTokenConfig)
+	if token == "" {
+		token = os.Getenv(gitlabTokenEnv)
+	}
+	if *mirrorExport && token == "" {
+		return fmt.Errorf("Exporting requires an access token, in the \"%s\" config setting or the %s environment variable.", gitlabTokenConfig, gitlabTokenEnv)
+	}
+	m := gitlab.New(instanceURL, token, project, remote)
+
+	var mrs []gitlab.MergeRequest
+	if *mirrorID != 0 {
+		mr, err := m.GetMergeRequest(*mirrorID)
+		if err != nil {
+			return err
+		}
+		mrs = append(mrs, mr)
+	} else {
+		var err error
+		if mrs, err = m.ListMergeRequests(); err != nil {
+			return err
+		}
+	}
+	if !*mirrorDryRun {
+		if err := m.FetchHeads(); err != nil {
+			return err
+		}
+	}
+
+	batch := mirror.NewBatch()
+	imported := make(map[int]*gitlab.Imported)
+	for _, mr := range mrs {
+		i, err := m.Import(mr, batch)
+		if err != nil {
+			return fmt.Errorf("Failed to import the merge request !%d: %v", mr.IID, err)
+		}
+		imported[mr.IID] = i
+	}
+	if *mirrorDryRun {
+		fmt.Printf("Would import %d notes from %d merge requests\n", batch.Len(), len(mrs))
+		return nil
+	}
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	fmt.Printf("Imported %d notes from %d merge requests\n", batch.Len(), len(mrs))
+	if !*mirrorExport {
+		return nil
+	}
+
+	var exported int
+	for _, mr := range mrs {
+		posted, err := m.Export(mr, imported[mr.IID])
+		exported += posted
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to export to the merge request !%d: %v\n", mr.IID, err)
+		}
+	}
+	fmt.Printf("Exported %d comments\n", exported)
+	return nil
+}
+
+// mirrorGerrit imports the changes of a Gerrit project.
+func mirrorGerrit(remote string) error {
+	if *mirrorExport {
+		return errors.New("Gerrit changes can only be imported.")
+	}
+	serverURL := repository.GetConfig(gerritURLConfig)
+	if serverURL == "" {
+		return fmt.Errorf("Set the \"%s\" config setting to the URL of the Gerrit server.", gerritURLConfig)
+	}
+	project := repository.GetConfig(gerritProjectConfig)
+	if project == "" {
+		if project = gerrit.ProjectFromURL(serverURL, repository.GetRemoteURL(remote)); project == "" {
+			return fmt.Errorf("The remote %q is not on %s; set the \"%s\" config setting to the project's name.", remote, serverURL, gerritProjectConfig)
+		}
+	}
+	password := repository.GetConfig(gerritPasswordConfig)
+	if password == "" {
+		password = os.Getenv(gerritPasswordEnv)
+	}
+	importer := gerrit.New(serverURL, repository.GetConfig(gerritUserConfig), password, project, remote)
+
+	var changes []gerrit.Change
+	if *mirrorID != 0 {
+		change, err := importer.GetChange(*mirrorID)
+		if err != nil {
+			return err
+		}
+		changes = append(changes, change)
+	} else {
+		var err error
+		if changes, err = importer.ListChanges(); err != nil {
+			return err
+		}
+	}
+	if !*mirrorDryRun {
+		if err := importer.FetchPatchSets(); err != nil {
+			return err
+		}
+	}
+
+	batch := mirror.NewBatch()
+	for _, change := range changes {
+		if _, err := importer.Import(change, batch); err != nil {
+			return fmt.Errorf("Failed to import the change %d: %v", change.Number, err)
+		}
+	}
+	if *mirrorDryRun {
+		fmt.Printf("Would import %d notes from %d changes\n", batch.Len(), len(changes))
+		return nil
+	}
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	fmt.Printf("Imported %d notes from %d changes\n", batch.Len(), len(changes))
+	return nil
+}
+
+// newBitbucketMirror returns the mirror of the configured Bitbucket repository.
+func newBitbucketMirror(remote string) (*bitbucket.Mirror, error) {
+	serverURL := repository.GetConfig(bitbucketURLConfig)
+	repo := repository.GetConfig(bitbucketRepoConfig)
+	if repo == "" {
+		if repo = bitbucket.RepoFromURL(serverURL, repository.GetRemoteURL(remote)); repo == "" {
+			return nil, fmt.Errorf("The remote %q is not on Bitbucket; set the \"%s\" config setting to the repository, and \"%s\" to the URL of its Bitbucket Server, if any.", remote, bitbucketRepoConfig, bitbucketURLConfig)
+		}
+	}
+	token := repository.GetConfig(bitbucketTokenConfig)
+	if token == "" {
+		token = os.Getenv(bitbucketTokenEnv)
+	}
+	if *mirrorExport && token == "" {
+		return nil, fmt.Errorf("Exporting requires an access token, in the \"%s\" config setting or the %s environment variable.", bitbucketTokenConfig, bitbucketTokenEnv)
+	}
+	user := repository.GetConfig(bitbucketUserConfig)
+	if bitbucket.IsCloud(serverURL) {
+		return bitbucket.NewCloud(bitbucket.CloudURL, user, token, repo, remote), nil
+	}
+	return bitbucket.NewServer(serverURL, user, token, repo, remote), nil
+}
+
+// mirrorBitbucket synchronizes the pull requests of a Bitbucket repository.
+//
+// Unless a single pull request is given, only the pull requests updated since
+// the last synchronization are imported, along with, when exporting, those
+// whose reviews have local activity since then.
+func mirrorBitbucket(remote string) error {
+	m, err := newBitbucketMirror(remote)
+	if err != nil {
+		return err
+	}
+	startedAt := time.Now()
+	var since time.Time
+	if *mirrorSince != "" {
+		if since, err = parseSince(*mirrorSince, startedAt); err != nil {
+			return err
+		}
+	} else if lastSync, err := strconv.ParseInt(repository.GetConfig(bitbucketLastSyncConfig), 10, 64); err == nil {
+		since = time.Unix(lastSync, 0)
+	}
+
+	var prs []bitbucket.PullRequest
+	if *mirrorID != 0 {
+		pr, err := m.GetPullRequest(*mirrorID)
+		if err != nil {
+			return err
+		}
+		prs = append(prs, pr)
+	} else {
+		if prs, err = m.ListPullRequests(since); err != nil {
+			return err
+		}
+		if *mirrorExport && !since.IsZero() {
+			listed := make(map[int]bool)
+			for _, pr := range prs {
+				listed[pr.ID] = true
+			}
+			for _, r := range review.ListAll() {
+				id, ok := bitbucket.PullRequestID(r.Request.ReviewRef)
+				if !ok || listed[id] || r.LastActivity().Before(since) {
+					continue
+				}
+				pr, err := m.GetPullRequest(id)
+				if err != nil {
+					return err
+				}
+				listed[id] = true
+				prs = append(prs, pr)
+			}
+		}
+	}
+	if !*mirrorDryRun {
+		if err := m.FetchHeads(prs); err != nil {
+			return err
+		}
+	}
+
+	batch := mirror.NewBatch()
+	imported := make(map[int]*bitbucket.Imported)
+	for _, pr := range prs {
+		i, err := m.Import(pr, batch)
+		if err != nil {
+			return fmt.Errorf("Failed to import the pull request #%d: %v", pr.ID, err)
+		}
+		imported[pr.ID] = i
+	}
+	if *mirrorDryRun {
+		fmt.Printf("Would import %d notes from %d pull requests\n", batch.Len(), len(prs))
+		return nil
+	}
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	fmt.Printf("Imported %d notes from %d pull requests\n", batch.Len(), len(prs))
+
+	failed := false
+	if *mirrorExport {
+		var exported int
+		for _, pr := range prs {
+			posted, err := m.Export(pr, imported[pr.ID])
+			exported += posted
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to export to the pull request #%d: %v\n", pr.ID, err)
+				failed = true
+			}
+		}
+		fmt.Printf("Exported %d comments\n", exported)
+	}
+	// Failed exports are retried by the next synchronization only if it starts from before them.
+	if *mirrorID == 0 && !failed {
+		return repository.SetConfig(bitbucketLastSyncConfig, strconv.FormatInt(startedAt.Unix(), 10))
+	}
+	return nil
+}
+
+// mirrorPhabricator imports the reviews of the landed Differential revisions of a Phabricator repository.
+func mirrorPhabricator() error {
+	if *mirrorExport {
+		return errors.New("Phabricator revisions can only be imported.")
+	}
+	serverURL := repository.GetConfig(phabricatorURLConfig)
+	if serverURL == "" {
+		return fmt.Errorf("Set the \"%s\" config setting to the URL of the Phabricator instance.", phabricatorURLConfig)
+	}
+	token := repository.GetConfig(phabricatorTokenConfig)
+	if token == "" {
+		token = os.Getenv(phabricatorTokenEnv)
+	}
+	if token == "" {
+		return fmt.Errorf("Importing requires a Conduit API token, in the \"%s\" config setting or the %s environment variable.", phabricatorTokenConfig, phabricatorTokenEnv)
+	}
+	importer := phabricator.New(serverURL, token)
+
+	var repositoryPHID string
+	if name := repository.GetConfig(phabricatorRepositoryConfig); name != "" {
+		var err error
+		if repositoryPHID, err = importer.RepositoryPHID(name); err != nil {
+			return err
+		}
+	}
+	revisions, err := importer.ListRevisions(repositoryPHID, *mirrorID)
+	if err != nil {
+		return err
+	}
+	landed, err := importer.LandedCommits(revisions)
+	if err != nil {
+		return err
+	}
+
+	targetRef := getDefaultTarget()
+	batch := mirror.NewBatch()
+	var imported, skipped int
+	for _, r := range revisions {
+		commit, ok := landed[r.PHID]
+		if !ok {
+			skipped++
+			continue
+		}
+		if err := importer.Import(r, commit, targetRef, batch); err != nil {
+			return fmt.Errorf("Failed to import the revision D%d: %v", r.ID, err)
+		}
+		imported++
+	}
+	if *mirrorDryRun {
+		fmt.Printf("Would import %d notes from %d revisions\n", batch.Len(), imported)
+	} else {
+		if err := batch.Write(); err != nil {
+			return err
+		}
+		fmt.Printf("Imported %d notes from %d revisions\n", batch.Len(), imported)
+	}
+	if skipped > 0 {
+		fmt.Printf("Skipped %d revisions that did not land as commits present locally\n", skipped)
+	}
+	return nil
+}
+
+// mirrorReviews mirrors the reviews of a code hosting service into git-appraise.
+func mirrorReviews(args []string) error {
+	mirrorFlagSet.Parse(args)
+	args = mirrorFlagSet.Args()
+	if len(args) != 1 {
+		return errors.New("The mirror command takes the name of the host to mirror.")
+	}
+	remote := *mirrorRemote
+	if remote == "" {
+		remote = getRemote(nil)
+	}
+	switch args[0] {
+	case "github":
+		return mirrorGithub(remote)
+	case "gitlab":
+		return mirrorGitlab(remote)
+	case "gerrit":
+		return mirrorGerrit(remote)
+	case "bitbucket":
+		return mirrorBitbucket(remote)
+	case "phabricator":
+		return mirrorPhabricator()
+	default:
+		return fmt.Errorf("Unknown host %q; the supported hosts are: bitbucket, gerrit, github, gitlab, phabricator", args[0])
+	}
+}
+
+// mirrorCmd defines the "mirror" subcommand.
+var mirrorCmd = &Command{
+	Usage: func(arg0 string) {
+		fmt.Printf("Usage: %s mirror <option>... (bitbucket|gerrit|github|gitlab|phabricator)\n\nOptions:\n", arg0)
+		mirrorFlagSet.PrintDefaults()
+	},
+	RunMethod: func(args []string) error {
+		return mirrorReviews(args)
+	},
+	Mutates: true,
+}
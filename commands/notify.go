@@ -0,0 +1,256 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/git-appraise/repository"
+	"github.com/google/git-appraise/review"
+	"github.com/google/git-appraise/review/comment"
+)
+
+// notifierSection is the git config section holding the notifiers, each of
+// which is configured in a subsection named after it, e.g.
+// "appraise.notifier.team.type".
+const notifierSection = "appraise.notifier"
+
+// notifier delivers the events of reviews that happen locally, such as a
+// comment being posted or a review being accepted.
+type notifier interface {
+	Notify(event webhookEvent) error
+}
+
+// notifierTypes maps the values of the "type" setting of a notifier to the
+// constructors of that kind of notifier, which read the rest of its settings.
+var notifierTypes = map[string]func(name string) (notifier, error){
+	"exec":  newExecNotifier,
+	"irc":   newIRCNotifier,
+	"slack": newSlackNotifier,
+}
+
+// notifierConfig returns the value of a setting of the notifier with the given name.
+func notifierConfig(name, key string) string {
+	return repository.GetConfig(notifierSection + "." + name + "." + key)
+}
+
+// describeEvent returns a one-line, human readable description of an event.
+func describeEvent(event webhookEvent) string {
+	summary := strings.SplitN(strings.TrimSpace(event.Request.Description), "\n", 2)[0]
+	review := fmt.Sprintf("%q (%.7s)", summary, event.Revision)
+	switch event.Event {
+	case eventReviewRequested:
+		return fmt.Sprintf("%s requested a review of %s", event.Request.Requester, review)
+	case eventReviewSubmitted:
+		return fmt.Sprintf("%s was submitted to %s", review, event.Request.TargetRef)
+	case eventReviewAccepted:
+		return fmt.Sprintf("%s accepted %s", event.Comment.Author, review)
+	case eventCommentAdded:
+		text := strings.SplitN(strings.TrimSpace(event.Comment.Description), "\n", 2)[0]
+		return fmt.Sprintf("%s commented on %s: %s", event.Comment.Author, review, text)
+	}
+	return fmt.Sprintf("%s on %s", event.Event, review)
+}
+
+// execNotifier runs a command for each event, with the event as JSON on its standard input.
+type execNotifier struct {
+	command string
+}
+
+func newExecNotifier(name string) (notifier, error) {
+	command := notifierConfig(name, "command")
+	if command == "" {
+		return nil, fmt.Errorf("The %q notifier has no command", name)
+	}
+	return &execNotifier{command}, nil
+}
+
+// Notify runs the notifier's shell command, which also gets the event's
+// name, revision, comment hash, and author in environment variables.
+func (n *execNotifier) Notify(event webhookEvent) error {
+	eventJson, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	fields := hookEvent{Kind: event.Event, Revision: event.Revision, Hash: event.Hash, Author: event.Request.Requester}
+	if event.Comment != nil {
+		fields.Author = event.Comment.Author
+	}
+	return runHook(n.command, fields.environment(), eventJson)
+}
+
+// slackNotifier posts a message for each event to a Slack incoming webhook.
+type slackNotifier struct {
+	url     string
+	channel string
+}
+
+func newSlackNotifier(name string) (notifier, error) {
+	webhook := notifierConfig(name, "url")
+	if webhook == "" {
+		return nil, fmt.Errorf("The %q notifier has no Slack webhook URL", name)
+	}
+	return &slackNotifier{webhook, notifierConfig(name, "channel")}, nil
+}
+
+func (n *slackNotifier) Notify(event webhookEvent) error {
+	message := map[string]string{"text": describeEvent(event)}
+	if n.channel != "" {
+		message["channel"] = n.channel
+	}
+	payload, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	resp, err := http.Post(n.url, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("Slack responded with %q", resp.Status)
+	}
+	return nil
+}
+
+// ircTimeout bounds how long delivering a message to an IRC channel may take.
+const ircTimeout = 30 * time.Second
+
+// ircNotifier sends a message for each event to an IRC channel.
+type ircNotifier struct {
+	server  string
+	channel string
+	nick    string
+}
+
+// newIRCNotifier returns the notifier for an "irc://host[:port]/channel" URL.
+func newIRCNotifier(name string) (notifier, error) {
+	parsed, err := url.Parse(notifierConfig(name, "url"))
+	if err != nil || parsed.Scheme != "irc" || parsed.Host == "" {
+		return nil, fmt.Errorf("The %q notifier needs an \"irc://host[:port]/channel\" URL", name)
+	}
+	server := parsed.Host
+	if parsed.Port() == "" {
+		server += ":6667"
+	}
+	channel := strings.TrimPrefix(parsed.Path, "/")
+	if parsed.Fragment != "" {
+		channel = parsed.Fragment
+	}
+	if channel == "" {
+		return nil, fmt.Errorf("The %q notifier's URL has no channel", name)
+	}
+	if !strings.HasPrefix(channel, "#") {
+		channel = "#" + channel
+	}
+	nick := notifierConfig(name, "nick")
+	if nick == "" {
+		nick = "git-appraise"
+	}
+	return &ircNotifier{server, channel, nick}, nil
+}
+
+// Notify connects to the server, joins the channel, sends the message, and quits.
+func (n *ircNotifier) Notify(event webhookEvent) error {
+	conn, err := net.DialTimeout("tcp", n.server, ircTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(ircTimeout))
+	fmt.Fprintf(conn, "NICK %s\r\nUSER %s 0 * :git-appraise\r\n", n.nick, n.nick)
+	reader := bufio.NewReader(conn)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("The IRC server closed the connection before registering: %v", err)
+		}
+		fields := strings.Fields(line)
+		if len(fields) > 0 && fields[0] == "PING" {
+			fmt.Fprintf(conn, "PONG %s\r\n", strings.Join(fields[1:], " "))
+			continue
+		}
+		if len(fields) > 1 && fields[1] == "001" {
+			break
+		}
+		if len(fields) > 1 && strings.HasPrefix(fields[1], "4") {
+			return fmt.Errorf("The IRC server refused the connection: %s", strings.TrimSpace(line))
+		}
+	}
+	_, err = fmt.Fprintf(conn, "JOIN %s\r\nPRIVMSG %s :%s\r\nQUIT\r\n", n.channel, n.channel, describeEvent(event))
+	return err
+}
+
+// notifierWants reports whether the notifier with the given name is notified
+// of an event, which is all of them unless its "events" setting lists some.
+func notifierWants(name, event string) bool {
+	events := repository.GetConfigAll(notifierSection + "." + name + ".events")
+	if len(events) == 0 {
+		return true
+	}
+	for _, wanted := range events {
+		if wanted == event {
+			return true
+		}
+	}
+	return false
+}
+
+// notifyLocal delivers the given events to the configured notifiers.
+//
+// The notes have already been written by the time this is called, so a
+// failed notification is reported rather than treated as an error.
+func notifyLocal(events []webhookEvent) {
+	if len(events) == 0 {
+		return
+	}
+	for _, name := range repository.GetConfigSubsections(notifierSection) {
+		kind := notifierConfig(name, "type")
+		newNotifier, ok := notifierTypes[kind]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Unknown type %q of the %q notifier\n", kind, name)
+			continue
+		}
+		n, err := newNotifier(name)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			continue
+		}
+		for _, event := range events {
+			if !notifierWants(name, event.Event) {
+				continue
+			}
+			if err := n.Notify(event); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to notify %q of the %s event for %s: %v\n", name, event.Event, event.Revision, err)
+			}
+		}
+	}
+}
+
+// notifyComment notifies the notifiers of a comment that was added to a review.
+func notifyComment(r *review.Review, hash string, c comment.Comment) {
+	notifyLocal(commentEvents(r.Revision, r.Request, map[string]comment.Comment{hash: c}))
+}
@@ -0,0 +1,42 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"testing"
+
+	"github.com/google/git-appraise/review/comment"
+	"github.com/google/git-appraise/review/request"
+)
+
+func TestDescribeEvent(t *testing.T) {
+	r := request.Request{Requester: "alice", TargetRef: "refs/heads/master", Description: "Fix the frobnicator\n\nDetails."}
+	c := &comment.Comment{Author: "bob", Description: "Why?\nJust asking."}
+	revision := "0123456789abcdef0123456789abcdef01234567"
+	tests := map[string]string{
+		eventReviewRequested: `alice requested a review of "Fix the frobnicator" (0123456)`,
+		eventCommentAdded:    `bob commented on "Fix the frobnicator" (0123456): Why?`,
+		eventReviewAccepted:  `bob accepted "Fix the frobnicator" (0123456)`,
+		eventReviewSubmitted: `"Fix the frobnicator" (0123456) was submitted to refs/heads/master`,
+	}
+	for event, want := range tests {
+		got := describeEvent(webhookEvent{Event: event, Revision: revision, Request: r, Comment: c})
+		if got != want {
+			t.Errorf("describeEvent(%s) = %q, want %q", event, got, want)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/git-appraise/repository"
+	"github.com/google/git-appraise/review"
+	"github.com/google/git-appraise/review/nudge"
+)
+
+// staleAgeConfig is the git config setting used when the nudge age is not given on the command line.
+const staleAgeConfig = "appraise.staleAge"
+
+// defaultStaleAge is the age used when neither the flag nor the config setting are set.
+const defaultStaleAge = "7d"
+
+// nudgeHookConfig is the git config setting holding the command run for each nudge.
+const nudgeHookConfig = "appraise.nudgeHook"
+
+var nudgeFlagSet = flag.NewFlagSet("nudge", flag.ExitOnError)
+
+var (
+	nudgeStale  = nudgeFlagSet.String("stale", "", "Only nudge open reviews with no activity for this long (e.g. \"7d\" or \"12h\"). Defaults to the \""+staleAgeConfig+"\" config setting, or "+defaultStaleAge)
+	nudgeExec   = nudgeFlagSet.String("exec", "", "Shell command to run for each nudge. Defaults to the \""+nudgeHookConfig+"\" config setting")
+	nudgeDryRun = nudgeFlagSet.Bool("n", false, "Only report the reviews that would be nudged")
+)
+
+// nudgeEvent is the description of a nudge passed to the notification hook.
+type nudgeEvent struct {
+	Revision   string   `json:"revision"`
+	Summary    string   `json:"summary,omitempty"`
+	Recipients []string `json:"recipients,omitempty"`
+	Idle       int64    `json:"idle"`
+}
+
+// nudgeRecipients returns the users who should be reminded about a stale review.
+//
+// These are the users whose turn it is to act on the review, or, if that is
+// not known, its reviewers.
+func nudgeRecipients(r review.Review) []string {
+	if len(r.Attention) > 0 {
+		return r.Attention
+	}
+	if len(r.Request.Reviewers) > 0 {
+		return r.Request.Reviewers
+	}
+	return []string{r.Request.Requester}
+}
+
+// nudgeIdleEnv is the environment variable holding the number of seconds
+// that a nudged review has been idle, in addition to those of every hook.
+const nudgeIdleEnv = "APPRAISE_EVENT_IDLE"
+
+// runNudgeHook runs the notification hook for a nudge.
+//
+// The hook gets the nudge as JSON on its standard input, and also in environment variables.
+func runNudgeHook(hook string, event nudgeEvent) error {
+	eventJson, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	env := hookEvent{Kind: "nudge", Revision: event.Revision, Users: event.Recipients}.environment()
+	env = append(env, fmt.Sprintf("%s=%d", nudgeIdleEnv, event.Idle))
+	return runHook(hook, env, eventJson)
+}
+
+// nudgeReviews reminds the users whose turn it is to act on stale reviews about them.
+//
+// A review is nudged at most once per stale period, so that running the command
+// regularly does not keep reminding the same users about the same review.
+func nudgeReviews(args []string) error {
+	nudgeFlagSet.Parse(args)
+	if len(nudgeFlagSet.Args()) > 0 {
+		return errors.New("The nudge command does not take any arguments.")
+	}
+
+	age := *nudgeStale
+	if age == "" {
+		age = repository.GetConfig(staleAgeConfig)
+	}
+	if age == "" {
+		age = defaultStaleAge
+	}
+	maxAge, err := parseAge(age)
+	if err != nil {
+		return err
+	}
+	if maxAge == 0 {
+		return errors.New("The stale age must be positive.")
+	}
+	hook := *nudgeExec
+	if hook == "" {
+		hook = repository.GetConfig(nudgeHookConfig)
+	}
+	now := time.Now()
+	cutoff := now.Add(-maxAge)
+
+	var nudged int
+	for _, r := range review.ListOpen() {
+		if !r.IsStale(cutoff) {
+			continue
+		}
+		if nudge.LastNudged(nudge.ParseAllValid(repository.GetNotes(nudge.Ref, r.Revision))).After(cutoff) {
+			continue
+		}
+		recipients := nudgeRecipients(r)
+		idle := now.Sub(r.LastActivity()).Truncate(time.Second)
+		if *nudgeDryRun {
+			fmt.Printf("Would nudge %s (idle for %s): %s\n", r.Revision, idle, strings.Join(recipients, " "))
+			continue
+		}
+		n := nudge.New(recipients, now, idle)
+		note, err := n.Write()
+		if err != nil {
+			return err
+		}
+		repository.AppendNote(nudge.Ref, r.Revision, note)
+		if hook != "" {
+			event := nudgeEvent{
+				Revision:   r.Revision,
+				Summary:    strings.SplitN(r.Request.Description, "\n", 2)[0],
+				Recipients: recipients,
+				Idle:       n.Idle,
+			}
+			if err := runNudgeHook(hook, event); err != nil {
+				return fmt.Errorf("The nudge hook failed for %s: %v", r.Revision, err)
+			}
+		} else {
+			fmt.Printf("Nudged %s (idle for %s): %s\n", r.Revision, idle, strings.Join(recipients, " "))
+		}
+		nudged++
+	}
+	if !*nudgeDryRun {
+		fmt.Printf("Nudged %d reviews\n", nudged)
+	}
+	return nil
+}
+
+// nudgeCmd defines the "nudge" subcommand.
+var nudgeCmd = &Command{
+	Usage: func(arg0 string) {
+		fmt.Printf("Usage: %s nudge <option>...\n\nOptions:\n", arg0)
+		nudgeFlagSet.PrintDefaults()
+	},
+	RunMethod: func(args []string) error {
+		return nudgeReviews(args)
+	},
+	Mutates: true,
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/google/git-appraise/repository"
+)
+
+// NoPager disables paging the output of commands, as the "--no-pager" flag does.
+var NoPager bool
+
+// isTerminal reports whether the given file is a terminal.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// startPager redirects standard output through the user's pager, if it is a terminal.
+//
+// As with git, the pager is chosen by GIT_PAGER, the "core.pager" config
+// setting, or PAGER, and defaults to "less" with the options "FRX" so that it
+// exits immediately when the output fits on one screen.
+//
+// The returned function restores standard output and waits for the pager to exit.
+func startPager() (func(), error) {
+	if !isTerminal(os.Stdout) {
+		return func() {}, nil
+	}
+	pager, err := repository.GetPager()
+	if err != nil || pager == "" || pager == "cat" {
+		return func() {}, nil
+	}
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	// The pager setting is a shell command, which may include arguments.
+	cmd := exec.Command("sh", "-c", pager)
+	cmd.Stdin = reader
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = os.Environ()
+	if os.Getenv("LESS") == "" {
+		cmd.Env = append(cmd.Env, "LESS=FRX")
+	}
+	if os.Getenv("LV") == "" {
+		cmd.Env = append(cmd.Env, "LV=-c")
+	}
+	if err := cmd.Start(); err != nil {
+		reader.Close()
+		writer.Close()
+		return nil, fmt.Errorf("The pager %q failed: %v", pager, err)
+	}
+	reader.Close()
+	stdout := os.Stdout
+	os.Stdout = writer
+	return func() {
+		os.Stdout = stdout
+		writer.Close()
+		cmd.Wait()
+	}, nil
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/google/git-appraise/repository"
+)
+
+// pluginPrefix is the prefix of the executables that provide additional subcommands.
+//
+// As with git itself, running "git appraise foo" for an unknown command "foo"
+// runs the "git-appraise-foo" executable found on the PATH.
+const pluginPrefix = "git-appraise-"
+
+// FindPlugin returns the path of the executable implementing the given
+// subcommand, or an empty string if there is none.
+func FindPlugin(name string) string {
+	if name == "" || strings.ContainsRune(name, filepath.Separator) {
+		return ""
+	}
+	path, err := exec.LookPath(pluginPrefix + name)
+	if err != nil {
+		return ""
+	}
+	return path
+}
+
+// ListPlugins returns the names of the subcommands provided by executables on the PATH.
+func ListPlugins() []string {
+	seen := make(map[string]bool)
+	var plugins []string
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		matches, _ := filepath.Glob(filepath.Join(dir, pluginPrefix+"*"))
+		for _, match := range matches {
+			name := strings.TrimPrefix(filepath.Base(match), pluginPrefix)
+			if _, builtin := CommandMap[name]; builtin || seen[name] {
+				continue
+			}
+			if info, err := os.Stat(match); err == nil && !info.IsDir() && info.Mode()&0111 != 0 {
+				seen[name] = true
+				plugins = append(plugins, name)
+			}
+		}
+	}
+	sort.Strings(plugins)
+	return plugins
+}
+
+// pluginEnv returns the environment passed to plugins.
+//
+// On top of the settings used when running git (so that "git" commands run by
+// the plugin use the same repository), this includes:
+//
+//	GIT_APPRAISE: the path of this tool, for running its own subcommands
+//	GIT_APPRAISE_GIT_DIR: the repository's .git directory, if run within one
+//	GIT_APPRAISE_TOPLEVEL: the root of the repository's working tree, if it has one
+func pluginEnv() []string {
+	env := repository.DefaultRunner.Environ()
+	if self, err := os.Executable(); err == nil {
+		env = append(env, "GIT_APPRAISE="+self)
+	}
+	if repository.IsGitRepo() {
+		env = append(env, "GIT_APPRAISE_GIT_DIR="+repository.GetGitDir())
+		if toplevel, err := repository.DefaultRunner.Run("rev-parse", "--show-toplevel"); err == nil {
+			env = append(env, "GIT_APPRAISE_TOPLEVEL="+toplevel)
+		}
+	}
+	return env
+}
+
+// RunPlugin runs the plugin executable at the given path with the given arguments.
+//
+// The plugin shares the tool's stdin, stdout, and stderr. If it exits with a
+// non-zero status, then the returned error is an *exec.ExitError.
+func RunPlugin(path string, args []string) error {
+	cmd := exec.Command(path, args...)
+	cmd.Env = pluginEnv()
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
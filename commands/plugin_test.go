@@ -0,0 +1,51 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFindPlugins(t *testing.T) {
+	dir := t.TempDir()
+	for name, mode := range map[string]os.FileMode{
+		pluginPrefix + "hello":  0755,
+		pluginPrefix + "list":   0755,
+		pluginPrefix + "readme": 0644,
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"), mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", dir)
+	if plugins := ListPlugins(); !reflect.DeepEqual(plugins, []string{"hello"}) {
+		t.Errorf("Unexpected plugins: %v", plugins)
+	}
+	if path := FindPlugin("hello"); path != filepath.Join(dir, pluginPrefix+"hello") {
+		t.Errorf("Unexpected plugin path: %q", path)
+	}
+	if path := FindPlugin("readme"); path != "" {
+		t.Errorf("Expected a non-executable file not to be a plugin, got %q", path)
+	}
+	if path := FindPlugin("../hello"); path != "" {
+		t.Errorf("Expected a path not to be a plugin name, got %q", path)
+	}
+}
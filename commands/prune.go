@@ -0,0 +1,111 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/git-appraise/repository"
+	"github.com/google/git-appraise/review"
+)
+
+// pruneAgeConfig is the git config setting used when the age is not given on the command line.
+const pruneAgeConfig = "appraise.pruneAge"
+
+// defaultPruneAge is the age used when neither the flag nor the config setting are set.
+const defaultPruneAge = "30d"
+
+var pruneFlagSet = flag.NewFlagSet("prune", flag.ExitOnError)
+
+var (
+	pruneOlderThan = pruneFlagSet.String("older-than", "", "Only archive reviews with no activity for this long (e.g. \"30d\" or \"12h\"). Defaults to the \""+pruneAgeConfig+"\" config setting, or "+defaultPruneAge)
+	pruneDryRun    = pruneFlagSet.Bool("n", false, "Only report the reviews that would be archived")
+)
+
+// parseAge parses an age given either as a number of days (e.g. "30d") or as a Go duration (e.g. "12h").
+func parseAge(age string) (time.Duration, error) {
+	if strings.HasSuffix(age, "d") {
+		days, err := strconv.ParseUint(strings.TrimSuffix(age, "d"), 10, 32)
+		if err != nil {
+			return 0, fmt.Errorf("Invalid age %q: %v", age, err)
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	duration, err := time.ParseDuration(age)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid age %q: %v", age, err)
+	}
+	if duration < 0 {
+		return 0, errors.New("The age must not be negative.")
+	}
+	return duration, nil
+}
+
+// prune moves closed reviews that have been idle for long enough into the archive.
+func prune(args []string) error {
+	pruneFlagSet.Parse(args)
+	if len(pruneFlagSet.Args()) > 0 {
+		return errors.New("The prune command does not take any arguments.")
+	}
+
+	age := *pruneOlderThan
+	if age == "" {
+		age = repository.GetConfig(pruneAgeConfig)
+	}
+	if age == "" {
+		age = defaultPruneAge
+	}
+	maxAge, err := parseAge(age)
+	if err != nil {
+		return err
+	}
+	cutoff := time.Now().Add(-maxAge)
+
+	var pruned int
+	for _, r := range review.ListAll() {
+		if !r.IsClosed() || r.LastActivity().After(cutoff) {
+			continue
+		}
+		if *pruneDryRun {
+			fmt.Printf("Would archive %s\n", r.Revision)
+		} else {
+			r.Archive()
+		}
+		pruned++
+	}
+	if !*pruneDryRun {
+		fmt.Printf("Archived %d reviews\n", pruned)
+	}
+	return nil
+}
+
+// pruneCmd defines the "prune" subcommand.
+var pruneCmd = &Command{
+	Usage: func(arg0 string) {
+		fmt.Printf("Usage: %s prune <option>...\n\nOptions:\n", arg0)
+		pruneFlagSet.PrintDefaults()
+	},
+	RunMethod: func(args []string) error {
+		return prune(args)
+	},
+	Mutates: true,
+}
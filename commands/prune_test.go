@@ -0,0 +1,38 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseAge(t *testing.T) {
+	age, err := parseAge("30d")
+	if err != nil || age != 30*24*time.Hour {
+		t.Fatalf("Unexpected result parsing a number of days: %v, %v", age, err)
+	}
+	age, err = parseAge("12h")
+	if err != nil || age != 12*time.Hour {
+		t.Fatalf("Unexpected result parsing a duration: %v, %v", age, err)
+	}
+	for _, invalid := range []string{"", "d", "-5d", "soon", "-1h"} {
+		if _, err := parseAge(invalid); err == nil {
+			t.Fatalf("Expected an error parsing %q", invalid)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/google/git-appraise/review"
+	"github.com/google/git-appraise/review/comment"
+)
+
+var publishFlagSet = flag.NewFlagSet("publish", flag.ExitOnError)
+
+var (
+	publishMessage = publishFlagSet.String("m", "", "Summary message to publish along with the drafts")
+	publishDiscard = publishFlagSet.Bool("discard", false, "Delete the draft comments instead of publishing them")
+)
+
+// publishDrafts publishes all of the draft comments on the current review.
+func publishDrafts(args []string) error {
+	publishFlagSet.Parse(args)
+	if len(publishFlagSet.Args()) > 0 {
+		return errors.New("The publish command does not take any arguments.")
+	}
+
+	r, err := review.GetCurrent()
+	if err != nil {
+		return fmt.Errorf("Failed to load the current review: %v\n", err)
+	}
+	if r == nil {
+		return errors.New("There is no current review.")
+	}
+	drafts, err := r.Drafts()
+	if err != nil {
+		return err
+	}
+	if len(drafts) == 0 {
+		return errors.New("There are no draft comments on the current review.")
+	}
+	if *publishDiscard {
+		if err := r.DiscardDrafts(); err != nil {
+			return err
+		}
+		fmt.Printf("Discarded %d draft comments.\n", len(drafts))
+		return nil
+	}
+
+	message := *publishMessage
+	if message == "" {
+		message = fmt.Sprintf("Published %d comments.", len(drafts))
+	}
+	commit, err := r.HeadCommit()
+	if err != nil {
+		return err
+	}
+	summary := comment.New(message)
+	summary.Location = &comment.Location{
+		Commit: commit,
+	}
+	if err := r.PublishDrafts(summary); err != nil {
+		return err
+	}
+	fmt.Printf("Published %d draft comments.\n", len(drafts))
+	return nil
+}
+
+// publishCmd defines the "publish" subcommand.
+var publishCmd = &Command{
+	Usage: func(arg0 string) {
+		fmt.Printf("Usage: %s publish <option>...\n\nPublishes the draft comments on the current review.\n\nOptions:\n", arg0)
+		publishFlagSet.PrintDefaults()
+	},
+	RunMethod: func(args []string) error {
+		return publishDrafts(args)
+	},
+	Mutates: true,
+}
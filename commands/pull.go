@@ -18,30 +18,51 @@ package commands
 
 import (
 	"errors"
+	"flag"
 	"fmt"
 	"github.com/google/git-appraise/repository"
+	"os"
+)
+
+var pullFlagSet = flag.NewFlagSet("pull", flag.ExitOnError)
+
+var (
+	pullJsonOutput = pullFlagSet.Bool("json", false, "Format the output as JSON")
 )
 
 // pull updates the local git-notes used for reviews with those from a remote repo.
 func pull(args []string) error {
+	pullFlagSet.Parse(args)
+	args = pullFlagSet.Args()
 	if len(args) > 1 {
 		return errors.New("Only pulling from one remote at a time is supported.")
 	}
 
-	remote := "origin"
-	if len(args) == 1 {
-		remote = args[0]
+	remote := getRemote(args)
+	remoteNotesRefPattern, err := getRemoteNotesRefPattern(remote)
+	if err != nil {
+		return err
 	}
 
-	repository.PullNotes(remote, notesRefPattern)
+	if err := repository.PullNotes(remote, notesRefPattern, remoteNotesRefPattern); err != nil {
+		return err
+	}
+	if conflicted, err := conflictedReviews(); err == nil && len(conflicted) > 0 {
+		fmt.Fprintf(os.Stderr, "%d reviews have conflicting updates; run \"git appraise conflicts\" to resolve them.\n", len(conflicted))
+	}
+	if *pullJsonOutput {
+		return printJson(remoteResult{remote, notesRefPattern, remoteNotesRefPattern})
+	}
 	return nil
 }
 
 var pullCmd = &Command{
 	Usage: func(arg0 string) {
-		fmt.Printf("Usage: %s pull [<remote>]", arg0)
+		fmt.Printf("Usage: %s pull <option>... [<remote>]\n\nThe remote defaults to the \"appraise.remote\" config setting, or \"origin\".\n\nOptions:\n", arg0)
+		pullFlagSet.PrintDefaults()
 	},
 	RunMethod: func(args []string) error {
 		return pull(args)
 	},
+	Mutates: true,
 }
@@ -18,29 +18,54 @@ package commands
 
 import (
 	"errors"
+	"flag"
 	"fmt"
-	"github.com/google/git-appraise/repository"
+)
+
+// defaultPushRetries is the number of times a rejected push is retried after merging the remote's notes.
+const defaultPushRetries = 3
+
+var pushFlagSet = flag.NewFlagSet("push", flag.ExitOnError)
+
+var (
+	pushRetries    = pushFlagSet.Int("retries", defaultPushRetries, "Number of times to merge and retry a rejected push")
+	pushJsonOutput = pushFlagSet.Bool("json", false, "Format the output as JSON")
 )
 
 // push pushes the local git-notes used for reviews to a remote repo.
 func push(args []string) error {
+	pushFlagSet.Parse(args)
+	args = pushFlagSet.Args()
 	if len(args) > 1 {
 		return errors.New("Only pushing to one remote at a time is supported.")
 	}
 
-	remote := "origin"
-	if len(args) == 1 {
-		remote = args[0]
+	remote := getRemote(args)
+	outgoing, err := outgoingNotes(remote)
+	if err != nil {
+		return err
 	}
-
-	return repository.PushNotes(remote, notesRefPattern)
+	if err := pushToRemote(remote, *pushRetries); err != nil {
+		return err
+	}
+	notifyOutgoing(outgoing, make(map[string]bool))
+	if *pushJsonOutput {
+		remoteNotesRefPattern, err := getRemoteNotesRefPattern(remote)
+		if err != nil {
+			return err
+		}
+		return printJson(remoteResult{remote, notesRefPattern, remoteNotesRefPattern})
+	}
+	return nil
 }
 
 var pushCmd = &Command{
 	Usage: func(arg0 string) {
-		fmt.Printf("Usage: %s push [<remote>]", arg0)
+		fmt.Printf("Usage: %s push <option>... [<remote>]\n\nThe remote defaults to the \"appraise.remote\" config setting, or \"origin\".\n\nOptions:\n", arg0)
+		pushFlagSet.PrintDefaults()
 	},
 	RunMethod: func(args []string) error {
 		return push(args)
 	},
+	Mutates: true,
 }
@@ -0,0 +1,75 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/git-appraise/repository"
+	"github.com/google/git-appraise/review"
+)
+
+// rebaseReview rebases the current review onto its target, keeping the review's history.
+//
+// The review stays attached to its original first commit, so that existing
+// comments remain associated with the revisions they were made on, and the
+// request records the new first commit as its alias.
+func rebaseReview(args []string) error {
+	if len(args) > 0 {
+		return errors.New("The rebase command does not take any arguments.")
+	}
+	if repository.HasUncommittedChanges() {
+		return errors.New("You have uncommitted or untracked files. Commit or stash them before rebasing.")
+	}
+	r, err := review.GetCurrent()
+	if err != nil {
+		return fmt.Errorf("Failed to load the current review: %v\n", err)
+	}
+	if r == nil {
+		return errors.New("There is no current review.")
+	}
+
+	if err := repository.RebaseBranch(r.Request.ReviewRef, r.Request.TargetRef); err != nil {
+		return err
+	}
+	reviewCommits := repository.ListCommitsBetween(r.Request.TargetRef, r.Request.ReviewRef)
+	if reviewCommits == nil {
+		return errors.New("After rebasing, there are no commits left in the review.")
+	}
+	if reviewCommits[0] == r.FirstCommit() {
+		fmt.Println("The review is already up to date with its target.")
+		return nil
+	}
+	rebased := r.Request
+	rebased.Alias = reviewCommits[0]
+	if rebased.Alias == r.Revision {
+		rebased.Alias = ""
+	}
+	return r.UpdateRequest(rebased)
+}
+
+// rebaseCmd defines the "rebase" subcommand.
+var rebaseCmd = &Command{
+	Usage: func(arg0 string) {
+		fmt.Printf("Usage: %s rebase\n\nRebases the current review onto its target ref, keeping its comments.\n", arg0)
+	},
+	RunMethod: func(args []string) error {
+		return rebaseReview(args)
+	},
+	Mutates: true,
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"flag"
+	"fmt"
+	"github.com/google/git-appraise/review/comment"
+)
+
+var rejectFlagSet = flag.NewFlagSet("reject", flag.ExitOnError)
+
+var (
+	rejectMessage    = rejectFlagSet.String("m", "", "Message to attach to the review")
+	rejectJsonOutput = rejectFlagSet.Bool("json", false, "Format the output as JSON")
+)
+
+// rejectReview adds an NMW comment to the current code review.
+func rejectReview(args []string) error {
+	rejectFlagSet.Parse(args)
+
+	r, err := loadReview(rejectFlagSet.Args())
+	if err != nil {
+		return err
+	}
+
+	rejectedCommit, err := r.HeadCommit()
+	if err != nil {
+		return err
+	}
+	location := comment.Location{
+		Commit: rejectedCommit,
+	}
+	resolved := false
+	c := comment.New(*rejectMessage)
+	c.Location = &location
+	c.Resolved = &resolved
+	return addComment(r, c, *rejectJsonOutput)
+}
+
+// rejectCmd defines the "reject" subcommand.
+var rejectCmd = &Command{
+	Usage: func(arg0 string) {
+		fmt.Printf("Usage: %s reject <option>... [<review>]\n\nOptions:\n", arg0)
+		rejectFlagSet.PrintDefaults()
+	},
+	RunMethod: func(args []string) error {
+		return rejectReview(args)
+	},
+	Mutates: true,
+}
@@ -0,0 +1,63 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/git-appraise/repository"
+)
+
+const (
+	// defaultRemote is the remote used when none is given or configured.
+	defaultRemote = "origin"
+	// remoteConfig is the git config setting that overrides the default remote.
+	remoteConfig = "appraise.remote"
+	// remoteNotesRefConfigTemplate is the per-remote git config setting for
+	// the pattern under which that remote stores the review notes.
+	remoteNotesRefConfigTemplate = "remote.%s.appraiseNotesRef"
+)
+
+// getRemote returns the remote to sync notes with.
+//
+// This is the remote named on the command line if there is one, followed by
+// the "appraise.remote" config setting, and finally "origin".
+func getRemote(args []string) string {
+	if len(args) > 0 {
+		return args[0]
+	}
+	if remote := repository.GetConfig(remoteConfig); remote != "" {
+		return remote
+	}
+	return defaultRemote
+}
+
+// getRemoteNotesRefPattern returns the pattern under which the given remote stores the review notes.
+//
+// This defaults to the same pattern used locally, but can be overridden with
+// the "remote.<name>.appraiseNotesRef" config setting.
+func getRemoteNotesRefPattern(remote string) (string, error) {
+	pattern := repository.GetConfig(fmt.Sprintf(remoteNotesRefConfigTemplate, remote))
+	if pattern == "" {
+		return notesRefPattern, nil
+	}
+	if !strings.HasPrefix(pattern, "refs/") || !strings.HasSuffix(pattern, "/*") {
+		return "", fmt.Errorf("Invalid notes ref pattern %q for the remote %q; it must be of the form \"refs/.../*\"", pattern, remote)
+	}
+	return pattern, nil
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/google/git-appraise/review/comment"
+)
+
+var reopenFlagSet = flag.NewFlagSet("reopen", flag.ExitOnError)
+
+var (
+	reopenMessage = reopenFlagSet.String("m", "", "Reason for reopening the review")
+)
+
+// reopenReview returns an abandoned or submitted review to the set of open reviews.
+//
+// A submitted review stays open until it is submitted again, which is meant
+// for changes that were reverted and need to be reviewed once more. The
+// reason, if given, is added to the review as a comment.
+func reopenReview(args []string) error {
+	reopenFlagSet.Parse(args)
+	args = reopenFlagSet.Args()
+	if len(args) != 1 {
+		return errors.New("The commit of the review to reopen must be given.")
+	}
+	r, err := loadReview(args)
+	if err != nil {
+		return err
+	}
+	if !r.IsClosed() && !r.Archived {
+		return errors.New("The review is already open.")
+	}
+
+	reopened := r.Request
+	reopened.Abandoned = false
+	if r.Submitted {
+		reopened.Reopened = true
+		reopened.SubmitStrategy = ""
+		reopened.SubmittedAs = ""
+	}
+	r.Unarchive()
+	if *reopenMessage != "" {
+		c := comment.New("Reopened: " + *reopenMessage)
+		if err := r.AddComment(&c); err != nil {
+			return err
+		}
+	}
+	return r.UpdateRequest(reopened)
+}
+
+// reopenCmd defines the "reopen" subcommand.
+var reopenCmd = &Command{
+	Usage: func(arg0 string) {
+		fmt.Printf("Usage: %s reopen <option>... <commit>\n\nOptions:\n", arg0)
+		reopenFlagSet.PrintDefaults()
+	},
+	RunMethod: func(args []string) error {
+		return reopenReview(args)
+	},
+	Mutates: true,
+}
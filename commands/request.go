@@ -21,6 +21,8 @@ import (
 	"flag"
 	"fmt"
 	"github.com/google/git-appraise/repository"
+	"github.com/google/git-appraise/review"
+	"github.com/google/git-appraise/review/gpg"
 	"github.com/google/git-appraise/review/request"
 	"strings"
 )
@@ -33,15 +35,26 @@ Review Ref: %s
 Message: "%s"
 `
 
+// targetConfig is the git config setting for the default target ref of review requests.
+const targetConfig = "appraise.target"
+
+// defaultTargetRef is the target ref used when no other default can be determined.
+const defaultTargetRef = "refs/heads/master"
+
 var requestFlagSet = flag.NewFlagSet("request", flag.ExitOnError)
 
 var (
 	requestMessage          = requestFlagSet.String("m", "", "Message to attach to the review")
 	requestReviewers        = requestFlagSet.String("r", "", "Comma-separated list of reviewers")
 	requestSource           = requestFlagSet.String("source", "HEAD", "Revision to review")
-	requestTarget           = requestFlagSet.String("target", "refs/heads/master", "Revision against which to review")
+	requestTarget           = requestFlagSet.String("target", "", "Revision against which to review (defaults to the \""+targetConfig+"\" config setting, or the remote's default branch, or master)")
 	requestQuiet            = requestFlagSet.Bool("quiet", false, "Suppress review summary output")
 	requestAllowUncommitted = requestFlagSet.Bool("allow-uncommitted", false, "Allow uncommitted local changes.")
+	requestPriority         = requestFlagSet.String("priority", "", "Priority of the review, from P0 (most urgent) to P4")
+	requestDue              = requestFlagSet.String("due", "", "Date by which the review should be completed, as YYYY-MM-DD")
+	requestDependsOn        = requestFlagSet.String("depends-on", "", "Comma-separated list of the reviews that must be submitted before this one")
+	requestLabels           = requestFlagSet.String("label", "", "Comma-separated list of labels with which to categorize the review")
+	requestMilestone        = requestFlagSet.String("milestone", "", "Milestone to attach the review to")
 )
 
 // Build the template review request based solely on the parsed flag values.
@@ -53,7 +66,73 @@ func buildRequestFromFlags() request.Request {
 		}
 	}
 
-	return request.New(reviewers, *requestSource, *requestTarget, *requestMessage)
+	r := request.New(reviewers, *requestSource, *requestTarget, *requestMessage)
+	r.Priority = *requestPriority
+	r.Due = *requestDue
+	r.Labels = splitLabels(*requestLabels)
+	r.Milestone = *requestMilestone
+	return r
+}
+
+// getDefaultTarget returns the target ref to use when none is given.
+func getDefaultTarget() string {
+	if target := repository.GetConfig(targetConfig); target != "" {
+		return target
+	}
+	if target := repository.GetDefaultBranch(getRemote(nil)); target != "" {
+		return target
+	}
+	return defaultTargetRef
+}
+
+// qualifyRef expands a short ref name (e.g. "master") to its full name, leaving anything else (e.g. a commit hash) as is.
+func qualifyRef(ref string) string {
+	if fullName, err := repository.GetFullRefName(ref); err == nil {
+		return fullName
+	}
+	return ref
+}
+
+// loadDependencies loads the reviews named by a comma-separated list of revisions.
+//
+// Abandoned reviews are rejected, since they will never be submitted.
+func loadDependencies(list string) ([]review.Review, error) {
+	var dependencies []review.Review
+	for _, arg := range strings.Split(list, ",") {
+		if arg = strings.TrimSpace(arg); arg == "" {
+			continue
+		}
+		revision, err := repository.ResolveCommit(arg)
+		if err != nil {
+			return nil, fmt.Errorf("Unknown revision %q", arg)
+		}
+		dependency := review.Get(revision)
+		if dependency == nil {
+			return nil, fmt.Errorf("There is no review for %q.", arg)
+		}
+		if dependency.Abandoned {
+			return nil, fmt.Errorf("The review %s has been abandoned.", revision)
+		}
+		dependencies = append(dependencies, *dependency)
+	}
+	return dependencies, nil
+}
+
+// excludeCommits returns the given commits, leaving out those in the given reviews.
+func excludeCommits(commits []string, reviews []review.Review) []string {
+	excluded := make(map[string]bool)
+	for _, r := range reviews {
+		for _, commit := range r.Commits() {
+			excluded[commit] = true
+		}
+	}
+	var remaining []string
+	for _, commit := range commits {
+		if !excluded[commit] {
+			remaining = append(remaining, commit)
+		}
+	}
+	return remaining
 }
 
 // Create a new code review request.
@@ -71,26 +150,92 @@ func requestReview(args []string) error {
 	}
 
 	r := buildRequestFromFlags()
+	if r.Priority != "" {
+		if err := request.ValidatePriority(r.Priority); err != nil {
+			return err
+		}
+	}
+	if r.Due != "" {
+		if _, err := request.ParseDueDate(r.Due); err != nil {
+			return err
+		}
+	}
+	for _, label := range r.Labels {
+		if err := request.ValidateLabel(label); err != nil {
+			return err
+		}
+	}
+	if r.Milestone != "" {
+		if err := checkMilestoneExists(r.Milestone); err != nil {
+			return err
+		}
+	}
+	dependencies, err := loadDependencies(*requestDependsOn)
+	if err != nil {
+		return err
+	}
+	for _, dependency := range dependencies {
+		r.DependsOn = append(r.DependsOn, dependency.Revision)
+	}
+	if r.TargetRef == "" {
+		r.TargetRef = getDefaultTarget()
+	}
+	r.TargetRef = qualifyRef(r.TargetRef)
 	if r.ReviewRef == "HEAD" {
 		r.ReviewRef = repository.GetHeadRef()
+	} else {
+		r.ReviewRef = qualifyRef(r.ReviewRef)
 	}
 	repository.VerifyGitRefOrDie(r.TargetRef)
 	repository.VerifyGitRefOrDie(r.ReviewRef)
 
-	reviewCommits := repository.ListCommitsBetween(r.TargetRef, r.ReviewRef)
+	if err := repository.CheckCommitsBetween(r.TargetRef, r.ReviewRef); err != nil {
+		return fmt.Errorf("Cannot determine the first commit to review: %v Run \"git fetch --unshallow\" first.", err)
+	}
+	// The commits of the reviews this one depends on are reviewed there, so they are left out.
+	reviewCommits := excludeCommits(repository.ListCommitsBetween(r.TargetRef, r.ReviewRef), dependencies)
 	if reviewCommits == nil {
 		return errors.New("There are no commits included in the review request")
 	}
 
+	requireTemplate := repository.GetConfig(requireTemplateConfig) == "true"
 	if r.Description == "" {
 		r.Description = repository.GetCommitMessage(reviewCommits[0])
+		template := loadRequestTemplate(r.TargetRef)
+		if template != "" && (isInteractive() || requireTemplate) {
+			r.Description = strings.TrimSpace(r.Description) + "\n\n" + template
+		}
+		if isInteractive() {
+			context := fmt.Sprintf("Requesting a review of %d commits from %s, to be merged into %s.", len(reviewCommits), r.ReviewRef, r.TargetRef)
+			description, err := editMessage(r.Description, context)
+			if err != nil {
+				return err
+			}
+			r.Description = description
+		}
+	}
+	if requireTemplate {
+		if placeholders := unfilledPlaceholders(r.Description); placeholders != nil {
+			return fmt.Errorf("The description still has the template placeholders %s, which must be filled in.", strings.Join(placeholders, ", "))
+		}
 	}
 
+	r.Checklist = loadChecklistTemplate(r.TargetRef)
+	r.UpdateMentions()
+	if gpg.Enabled() {
+		if err := r.Sign(); err != nil {
+			return err
+		}
+	}
 	note, err := r.Write()
 	if err != nil {
 		return err
 	}
 	repository.AppendNote(request.Ref, reviewCommits[0], note)
+	notifyLocal(requestEvents(reviewCommits[0], []request.Request{r}, r, true))
+	if err := configureNotesRewrite(); err != nil {
+		return err
+	}
 	if !*requestQuiet {
 		fmt.Printf(requestSummaryTemplate, reviewCommits[0], r.TargetRef, r.ReviewRef, r.Description)
 	}
@@ -106,4 +251,5 @@ var requestCmd = &Command{
 	RunMethod: func(args []string) error {
 		return requestReview(args)
 	},
+	Mutates: true,
 }
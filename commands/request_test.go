@@ -31,3 +31,14 @@ func TestBuildRequestFromFlags(t *testing.T) {
 		t.Fatalf("Unexpected reviewers list: '%v'", r.Reviewers)
 	}
 }
+
+func TestUnfilledPlaceholders(t *testing.T) {
+	description := "Fix the bug\n\nTest plan: {{How was this tested?}}\nBug: {{}}\nNot a placeholder: {x}"
+	placeholders := unfilledPlaceholders(description)
+	if len(placeholders) != 2 || placeholders[0] != "{{How was this tested?}}" || placeholders[1] != "{{}}" {
+		t.Errorf("Unexpected placeholders: %v", placeholders)
+	}
+	if placeholders := unfilledPlaceholders("Fix the bug\n\nTest plan: ran the tests"); placeholders != nil {
+		t.Errorf("Expected no placeholders, got %v", placeholders)
+	}
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/google/git-appraise/repository"
+	"github.com/google/git-appraise/review"
+	"github.com/google/git-appraise/review/comment"
+)
+
+var resolveFlagSet = flag.NewFlagSet("resolve", flag.ExitOnError)
+
+var (
+	resolveMessage    = resolveFlagSet.String("m", "", "Message to attach to the reply")
+	resolveUnresolve  = resolveFlagSet.Bool("unresolve", false, "Reopen the thread, marking it as blocking the submission of the review (unless it is a suggestion or nit)")
+	resolveJsonOutput = resolveFlagSet.Bool("json", false, "Format the output as JSON")
+)
+
+// resolveThread replies to a comment on the current review, marking its thread as resolved or unresolved.
+func resolveThread(args []string) error {
+	resolveFlagSet.Parse(args)
+	args = resolveFlagSet.Args()
+	if len(args) != 1 {
+		return errors.New("The hash of the comment to resolve must be given.")
+	}
+	parentHash := args[0]
+
+	r, err := review.GetCurrent()
+	if err != nil {
+		return fmt.Errorf("Failed to load the current review: %v\n", err)
+	}
+	if r == nil {
+		return errors.New("There is no current review.")
+	}
+	if !hasThread(r.Comments, parentHash) {
+		return fmt.Errorf("There is no comment %q on the current review.", parentHash)
+	}
+
+	location := comment.Location{
+		Commit: repository.GetCommitHash(r.Request.ReviewRef),
+	}
+	resolved := !*resolveUnresolve
+	c := comment.New(*resolveMessage)
+	c.Location = &location
+	c.Parent = parentHash
+	c.Resolved = &resolved
+	return addComment(r, c, *resolveJsonOutput)
+}
+
+// resolveCmd defines the "resolve" subcommand.
+var resolveCmd = &Command{
+	Usage: func(arg0 string) {
+		fmt.Printf("Usage: %s resolve <option>... <comment hash>\n\nOptions:\n", arg0)
+		resolveFlagSet.PrintDefaults()
+	},
+	RunMethod: func(args []string) error {
+		return resolveThread(args)
+	},
+	Mutates: true,
+}
@@ -0,0 +1,49 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/git-appraise/review"
+)
+
+// loadReview returns the review identified by the given argument, or the current review if none is given.
+//
+// The review may be identified in any of the ways understood by review.Find.
+func loadReview(args []string) (*review.Review, error) {
+	if len(args) > 1 {
+		return nil, errors.New("Only updating a single review is supported.")
+	}
+	var r *review.Review
+	var err error
+	if len(args) == 1 {
+		if r, err = review.Find(args[0]); r != nil {
+			r.LoadReports()
+		}
+	} else {
+		r, err = review.GetCurrent()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load the review: %v\n", err)
+	}
+	if r == nil {
+		return nil, errors.New("There is no matching review.")
+	}
+	return r, nil
+}
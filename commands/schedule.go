@@ -0,0 +1,79 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/google/git-appraise/review/request"
+)
+
+var scheduleFlagSet = flag.NewFlagSet("schedule", flag.ExitOnError)
+
+var (
+	schedulePriority = scheduleFlagSet.String("priority", "", "New priority of the review, from P0 (most urgent) to P4, or \"none\" to clear it")
+	scheduleDue      = scheduleFlagSet.String("due", "", "New due date of the review, as YYYY-MM-DD, or \"none\" to clear it")
+)
+
+// scheduleReview updates the priority and due date of a review.
+func scheduleReview(args []string) error {
+	scheduleFlagSet.Parse(args)
+	if *schedulePriority == "" && *scheduleDue == "" {
+		return errors.New("At least one of --priority or --due must be specified.")
+	}
+	r, err := loadReview(scheduleFlagSet.Args())
+	if err != nil {
+		return err
+	}
+
+	updated := r.Request
+	switch *schedulePriority {
+	case "":
+	case "none":
+		updated.Priority = ""
+	default:
+		if err := request.ValidatePriority(*schedulePriority); err != nil {
+			return err
+		}
+		updated.Priority = *schedulePriority
+	}
+	switch *scheduleDue {
+	case "":
+	case "none":
+		updated.Due = ""
+	default:
+		if _, err := request.ParseDueDate(*scheduleDue); err != nil {
+			return err
+		}
+		updated.Due = *scheduleDue
+	}
+	return r.UpdateRequest(updated)
+}
+
+// scheduleCmd defines the "schedule" subcommand.
+var scheduleCmd = &Command{
+	Usage: func(arg0 string) {
+		fmt.Printf("Usage: %s schedule <option>... [<commit>]\n\nOptions:\n", arg0)
+		scheduleFlagSet.PrintDefaults()
+	},
+	RunMethod: func(args []string) error {
+		return scheduleReview(args)
+	},
+	Mutates: true,
+}
@@ -0,0 +1,119 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/google/git-appraise/review"
+)
+
+var searchFlagSet = flag.NewFlagSet("search", flag.ExitOnError)
+
+var (
+	searchOpen       = searchFlagSet.Bool("open", false, "Only search open reviews")
+	searchAuthor     = searchFlagSet.String("author", "", "Only match text written by the given email address")
+	searchPath       = searchFlagSet.String("path", "", "Only match comments on, and reviews changing, the given file or directory")
+	searchJsonOutput = searchFlagSet.Bool("json", false, "Format the output as JSON")
+)
+
+// searchSnippet returns the first line of the text that contains the query, for showing a hit on a single line.
+func searchSnippet(text, query string) string {
+	lines := strings.Split(text, "\n")
+	for _, line := range lines {
+		if strings.Contains(strings.ToLower(line), strings.ToLower(query)) {
+			return strings.TrimSpace(line)
+		}
+	}
+	return strings.TrimSpace(lines[0])
+}
+
+// searchReviews searches the text of every review, including archived ones.
+func searchReviews(args []string) error {
+	searchFlagSet.Parse(args)
+	if searchFlagSet.NArg() == 0 {
+		return errors.New("The text to search for must be given.")
+	}
+	query := review.SearchQuery{
+		Text:   strings.Join(searchFlagSet.Args(), " "),
+		Author: *searchAuthor,
+		Path:   *searchPath,
+	}
+	if err := prepareHistory(); err != nil {
+		return err
+	}
+
+	hits := []review.SearchHit{}
+	search := func(r review.Review) error {
+		if *searchOpen && r.IsClosed() {
+			return nil
+		}
+		reviewHits := r.Search(query)
+		if len(reviewHits) == 0 {
+			return nil
+		}
+		hits = append(hits, reviewHits...)
+		if !*searchJsonOutput {
+			r.PrintSummary()
+			for _, hit := range reviewHits {
+				switch hit.Kind {
+				case review.HitDescription:
+					fmt.Printf("    description: %s\n", searchSnippet(hit.Text, query.Text))
+				case review.HitCommit:
+					fmt.Printf("    commit %s: %s\n", hit.Hash, searchSnippet(hit.Text, query.Text))
+				default:
+					location := ""
+					if hit.Path != "" {
+						location = " on " + hit.Path
+					}
+					fmt.Printf("    comment %s by %s%s: %s\n", hit.Hash, hit.Author, location, searchSnippet(hit.Text, query.Text))
+				}
+			}
+		}
+		return nil
+	}
+	if err := review.ForEach(search); err != nil {
+		return err
+	}
+	if !*searchOpen {
+		if err := review.ForEachArchived(search); err != nil {
+			return err
+		}
+	}
+	if *searchJsonOutput {
+		return printJson(hits)
+	}
+	if len(hits) == 0 {
+		fmt.Println("No matches found.")
+	}
+	return nil
+}
+
+// searchCmd defines the "search" subcommand.
+var searchCmd = &Command{
+	Usage: func(arg0 string) {
+		fmt.Printf("Usage: %s search <option>... <text>\n\nSearches the descriptions, commit messages, and comments of every review.\n\nOptions:\n", arg0)
+		searchFlagSet.PrintDefaults()
+	},
+	RunMethod: func(args []string) error {
+		return searchReviews(args)
+	},
+	Paged: true,
+}
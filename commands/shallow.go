@@ -0,0 +1,56 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"fmt"
+
+	"github.com/google/git-appraise/repository"
+	"github.com/google/git-appraise/review"
+)
+
+// deepenShallowConfig is the git config setting that makes the tool fetch the
+// complete history when run in a shallow clone, rather than working with the
+// incomplete history.
+const deepenShallowConfig = "appraise.deepenShallow"
+
+// shallowWarning is printed when the status of some reviews could not be determined.
+const shallowWarning = `Warning: this repository is a shallow clone, so whether %d of the reviews were
+submitted could not be determined. Run "git fetch --unshallow" or set the
+"` + deepenShallowConfig + `" config setting to fetch the complete history.
+`
+
+// prepareHistory fetches the complete history of a shallow clone if the user has asked for that.
+func prepareHistory() error {
+	if repository.IsShallow() && repository.GetConfig(deepenShallowConfig) == "true" {
+		return repository.Unshallow(getRemote(nil))
+	}
+	return nil
+}
+
+// warnIfIncomplete reports any reviews whose status could not be determined due to a shallow clone.
+func warnIfIncomplete(reviews []review.Review) {
+	var incomplete int
+	for _, r := range reviews {
+		if r.Incomplete {
+			incomplete++
+		}
+	}
+	if incomplete > 0 {
+		fmt.Printf(shallowWarning, incomplete)
+	}
+}
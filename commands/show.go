@@ -20,11 +20,19 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"github.com/google/git-appraise/repository"
 	"github.com/google/git-appraise/review"
+	"github.com/google/git-appraise/review/viewed"
+	"os"
 )
 
 var showFlagSet = flag.NewFlagSet("show", flag.ExitOnError)
 var showJsonOutput = showFlagSet.Bool("json", false, "Format the output as JSON")
+var showDiff = showFlagSet.Bool("diff", false, "Show the diff of the changes under review (including the changes within submodules), with comments inline")
+var showPorcelain = showFlagSet.Bool("porcelain", false, "Format the output in the stable, line-oriented porcelain format for scripts")
+var showVerifySignatures = showFlagSet.Bool("verify-signatures", false, "Check the GPG signatures on the review request and comments")
+var showViewed = showFlagSet.Bool("show-viewed", false, "With --diff, also show the changes to the files you have marked as viewed in the current revision")
+var showRaw = showFlagSet.Bool("raw", false, "Print the description and comments as they were written, instead of rendering them as Markdown")
 
 // showReview prints the current code review.
 func showReview(args []string) error {
@@ -36,9 +44,15 @@ func showReview(args []string) error {
 	if len(args) > 1 {
 		return errors.New("Only showing a single review is supported.")
 	}
+	if err := prepareHistory(); err != nil {
+		return err
+	}
 
 	if len(args) == 1 {
-		r = review.Get(args[0])
+		r, err = review.Find(args[0])
+		if r != nil {
+			r.LoadReports()
+		}
 	} else {
 		r, err = review.GetCurrent()
 	}
@@ -49,18 +63,44 @@ func showReview(args []string) error {
 	if r == nil {
 		return errors.New("There is no matching review.")
 	}
+	if *showVerifySignatures {
+		r.VerifySignatures()
+	}
+	if *showJsonOutput && *showPorcelain {
+		return errors.New("The --json and --porcelain flags cannot be combined.")
+	}
 	if *showJsonOutput {
 		return r.PrintJson()
 	}
-	return r.PrintDetails()
+	if *showPorcelain {
+		fmt.Println(review.PorcelainHeader)
+		return r.WritePorcelainDetails(os.Stdout)
+	}
+	review.EnableMarkdown(!*showRaw)
+	if *showDiff {
+		r.PrintSummary()
+		var collapsed []string
+		if revision, err := repository.ResolveCommit(r.Request.ReviewRef); err == nil && !*showViewed {
+			collapsed = viewed.Load(revision, repository.GetUserEmail())
+		}
+		if err := r.PrintDiff(collapsed); err != nil {
+			return err
+		}
+	} else if err := r.PrintDetails(); err != nil {
+		return err
+	}
+	warnIfIncomplete([]review.Review{*r})
+	return nil
 }
 
 // showCmd defines the "show" subcommand.
 var showCmd = &Command{
 	Usage: func(arg0 string) {
-		fmt.Printf("Usage: %s show (<commit>)\n", arg0)
+		fmt.Printf("Usage: %s show <option>... [<review>]\n\nThe review is given by its commit (or an abbreviated hash of it), its branch, or a unique part of its description.\n\nOptions:\n", arg0)
+		showFlagSet.PrintDefaults()
 	},
 	RunMethod: func(args []string) error {
 		return showReview(args)
 	},
+	Paged: true,
 }
@@ -0,0 +1,134 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/git-appraise/review"
+)
+
+var statsFlagSet = flag.NewFlagSet("stats", flag.ExitOnError)
+
+var (
+	statsSince      = statsFlagSet.String("since", "", "Only include reviews requested since the given date (YYYY-MM-DD) or within the given age (e.g. 30d)")
+	statsJsonOutput = statsFlagSet.Bool("json", false, "Format the output as JSON")
+	statsFederated  = statsFlagSet.Bool("federated", false, "Also include the reviews in every repository named by the \""+federatedRepoConfig+"\" config setting")
+)
+
+// formatSeconds formats a duration given in seconds as days, hours, and minutes.
+func formatSeconds(seconds int64) string {
+	d := time.Duration(seconds) * time.Second
+	days := d / (24 * time.Hour)
+	hours := (d % (24 * time.Hour)) / time.Hour
+	minutes := (d % time.Hour) / time.Minute
+	switch {
+	case days > 0:
+		return fmt.Sprintf("%dd %dh", days, hours)
+	case hours > 0:
+		return fmt.Sprintf("%dh %dm", hours, minutes)
+	}
+	return fmt.Sprintf("%dm", minutes)
+}
+
+// printStats prints the review statistics as a table.
+func printStats(stats review.Stats) {
+	fmt.Printf("Reviews: %d (%d open, %d submitted, %d abandoned)\n", stats.Reviews, stats.Open, stats.Submitted, stats.Abandoned)
+	if stats.Approved > 0 {
+		fmt.Printf("Median turnaround: %s (over %d approved reviews)\n", formatSeconds(stats.MedianTurnaround), stats.Approved)
+	}
+	if stats.Commented > 0 {
+		fmt.Printf("Median time to first comment: %s (over %d reviews)\n", formatSeconds(stats.MedianTimeToFirstComment), stats.Commented)
+	}
+	fmt.Printf("Revisions per review: %.1f\n", stats.AverageRevisions)
+	if len(stats.Reviewers) == 0 {
+		return
+	}
+	fmt.Println()
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "Reviewer\tAssigned\tPending\tComments")
+	for _, load := range stats.Reviewers {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\n", load.Reviewer, load.Assigned, load.Pending, load.Comments)
+	}
+	w.Flush()
+}
+
+// showStats reports how quickly reviews, including archived ones, progress, and the load of each reviewer.
+func showStats(args []string) error {
+	statsFlagSet.Parse(args)
+	if statsFlagSet.NArg() > 0 {
+		return errors.New("The stats command does not take any arguments.")
+	}
+	var since time.Time
+	if *statsSince != "" {
+		var err error
+		if since, err = parseSince(*statsSince, time.Now()); err != nil {
+			return err
+		}
+	}
+
+	// The revisions of each review are counted while in its repository.
+	var reviews []review.Review
+	revisions := make(map[string]int)
+	err := forEachRepo(*statsFederated, func(repoPath string) error {
+		if err := prepareHistory(); err != nil {
+			return err
+		}
+		collect := func(r review.Review) error {
+			if !since.IsZero() && r.RequestTime().Before(since) {
+				return nil
+			}
+			r.Repository = repoPath
+			reviews = append(reviews, r)
+			revisions[repoPath+" "+r.Revision] = len(r.Revisions())
+			return nil
+		}
+		if err := review.ForEach(collect); err != nil {
+			return err
+		}
+		return review.ForEachArchived(collect)
+	})
+	if err != nil {
+		return err
+	}
+
+	stats := review.ComputeStats(reviews, func(r review.Review) int {
+		return revisions[r.Repository+" "+r.Revision]
+	})
+	if *statsJsonOutput {
+		return printJson(stats)
+	}
+	printStats(stats)
+	warnIfIncomplete(reviews)
+	return nil
+}
+
+// statsCmd defines the "stats" subcommand.
+var statsCmd = &Command{
+	Usage: func(arg0 string) {
+		fmt.Printf("Usage: %s stats <option>...\n\nOptions:\n", arg0)
+		statsFlagSet.PrintDefaults()
+	},
+	RunMethod: func(args []string) error {
+		return showStats(args)
+	},
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/git-appraise/repository"
+	"github.com/google/git-appraise/review"
+)
+
+var statusFlagSet = flag.NewFlagSet("status", flag.ExitOnError)
+
+var (
+	statusUser      = statusFlagSet.String("user", "", "Email address of the user whose reviews to show (defaults to user.email)")
+	statusFederated = statusFlagSet.Bool("federated", false, "Also show the reviews in every repository named by the \""+federatedRepoConfig+"\" config setting")
+)
+
+// printDashboardSection prints one group of reviews from the dashboard.
+func printDashboardSection(title string, reviews []review.Review, details func(review.Review) string) {
+	fmt.Printf("%s (%d):\n", title, len(reviews))
+	for _, r := range reviews {
+		r.PrintSummary()
+		if details != nil {
+			if detail := details(r); detail != "" {
+				fmt.Printf("  %s\n", detail)
+			}
+		}
+	}
+}
+
+// showStatus shows the open reviews that are waiting on, or for, the current user.
+func showStatus(args []string) error {
+	statusFlagSet.Parse(args)
+	if len(statusFlagSet.Args()) > 0 {
+		return errors.New("The status command does not take any arguments.")
+	}
+	email := *statusUser
+	if email == "" {
+		email = repository.GetUserEmail()
+	}
+	return forEachRepo(*statusFederated, func(repoPath string) error {
+		if repoPath != "" {
+			fmt.Printf("\nRepository %s\n\n", repoPath)
+		}
+		return showRepoStatus(email)
+	})
+}
+
+// showRepoStatus shows the open reviews in the current repository that are waiting on, or for, the given user.
+func showRepoStatus(email string) error {
+	if err := prepareHistory(); err != nil {
+		return err
+	}
+	dashboard := review.BuildDashboard(review.ListOpen(), email, time.Now())
+	if len(dashboard.Overdue) > 0 {
+		printDashboardSection("Overdue reviews involving you", dashboard.Overdue, nil)
+		fmt.Println()
+	}
+	printDashboardSection("Reviews waiting on you", dashboard.Attention, nil)
+	fmt.Println()
+	printDashboardSection("Your reviews awaiting reviewers", dashboard.Authored, func(r review.Review) string {
+		if pending := r.PendingReviewers(); len(pending) > 0 {
+			return "waiting for: " + strings.Join(pending, ", ")
+		}
+		return ""
+	})
+	fmt.Println()
+	printDashboardSection("Reviews requesting your feedback", dashboard.Requested, nil)
+	fmt.Println()
+	printDashboardSection("Reviews blocked on your unresolved comments", dashboard.Blocking, nil)
+	return nil
+}
+
+// statusCmd defines the "status" subcommand.
+var statusCmd = &Command{
+	Usage: func(arg0 string) {
+		fmt.Printf("Usage: %s status <option>...\n\nShows the open reviews that need your attention.\n\nOptions:\n", arg0)
+		statusFlagSet.PrintDefaults()
+	},
+	RunMethod: func(args []string) error {
+		return showStatus(args)
+	},
+}
@@ -22,14 +22,29 @@ import (
 	"fmt"
 	"github.com/google/git-appraise/repository"
 	"github.com/google/git-appraise/review"
+	"github.com/google/git-appraise/review/checklist"
+	"github.com/google/git-appraise/review/ci"
+	"github.com/google/git-appraise/review/policy"
+	"github.com/google/git-appraise/review/request"
+	"os"
+	"strings"
 )
 
+// requiredCheckConfig is the multi-valued git config setting naming the CI
+// checks that must succeed before a review can be submitted, in addition to
+// those whose reports mark themselves as required.
+const requiredCheckConfig = "appraise.requiredCheck"
+
 var submitFlagSet = flag.NewFlagSet("submit", flag.ExitOnError)
 
 var (
 	submitMerge  = submitFlagSet.Bool("merge", false, "Create a merge of the source and target refs.")
 	submitRebase = submitFlagSet.Bool("rebase", false, "Rebase the source ref onto the target ref.")
-	submitTBR    = submitFlagSet.Bool("tbr", false, "(To be reviewed) Force the submission of a review that has not been accepted.")
+	submitSquash = submitFlagSet.Bool("squash", false, "Squash the source ref into a single commit on the target ref, described by the review.")
+	submitTBR    = submitFlagSet.Bool("tbr", false, "(To be reviewed) Force the submission of a review that has not been accepted, or that has blocking comment threads open.")
+	submitJson   = submitFlagSet.Bool("json", false, "Format the output as JSON")
+	submitDeps   = submitFlagSet.Bool("include-deps", false, "First submit the unsubmitted reviews that the review depends on, in order.")
+	submitVerify = submitFlagSet.Bool("verify-signatures", false, "Refuse to submit the review unless every commit in it has a valid signature.")
 )
 
 // Submit the current code review request.
@@ -38,21 +53,119 @@ var (
 func submitReview(args []string) error {
 	submitFlagSet.Parse(args)
 
-	if *submitMerge && *submitRebase {
-		return errors.New("Only one of --merge or --rebase is allowed.")
+	var strategies []string
+	if *submitMerge {
+		strategies = append(strategies, request.SubmitMerge)
+	}
+	if *submitRebase {
+		strategies = append(strategies, request.SubmitRebase)
+	}
+	if *submitSquash {
+		strategies = append(strategies, request.SubmitSquash)
+	}
+	if len(strategies) > 1 {
+		return errors.New("Only one of --merge, --rebase, or --squash is allowed.")
+	}
+	strategy := request.SubmitFastForward
+	if len(strategies) == 1 {
+		strategy = strategies[0]
 	}
 
-	r, err := review.GetCurrent()
-	if err != nil {
+	var r *review.Review
+	var err error
+	if args := submitFlagSet.Args(); len(args) > 0 {
+		if r, err = loadReview(args); err != nil {
+			return err
+		}
+	} else if r, err = review.GetCurrent(); err != nil {
 		return err
 	}
 	if r == nil {
 		return errors.New("There is nothing to submit")
 	}
+	if *submitDeps {
+		dependencies, err := unsubmittedDependencies(r)
+		if err != nil {
+			return err
+		}
+		for i := range dependencies {
+			if err := submit(&dependencies[i], strategy, *submitTBR, *submitVerify, *submitJson); err != nil {
+				return fmt.Errorf("Failed to submit the review %s, which this one depends on: %v", dependencies[i].Revision, err)
+			}
+		}
+	}
+	return submit(r, strategy, *submitTBR, *submitVerify, *submitJson)
+}
 
-	if !*submitTBR && (r.Resolved == nil || !*r.Resolved) {
+// unsubmittedDependencies returns the reviews that the given one depends on
+// and which have not been submitted yet, in the order they must be submitted.
+func unsubmittedDependencies(r *review.Review) ([]review.Review, error) {
+	dependencies, err := r.Dependencies()
+	if err != nil {
+		return nil, err
+	}
+	var unsubmitted []review.Review
+	for _, dependency := range dependencies {
+		if dependency.Submitted {
+			continue
+		}
+		if dependency.Abandoned {
+			return nil, fmt.Errorf("The review depends on %s, which has been abandoned.", dependency.Revision)
+		}
+		unsubmitted = append(unsubmitted, dependency)
+	}
+	return unsubmitted, nil
+}
+
+// submit incorporates the given review into its target ref using the given strategy.
+//
+// Unless tbr is set, the review must have been accepted, have no blocking
+// threads open, meet the approval policy of its target, and have passed its
+// required CI checks. Every review that it
+// depends on must already be submitted. If verify is set (or signatures are
+// required), then every commit in the review must have a valid signature,
+// even with tbr.
+func submit(r *review.Review, strategy string, tbr, verify, jsonOutput bool) error {
+	dependencies, err := unsubmittedDependencies(r)
+	if err != nil {
+		return err
+	}
+	if len(dependencies) > 0 {
+		return fmt.Errorf("Not submitting as the review depends on %d unsubmitted reviews, starting with %s. Submit those first, or use --include-deps.", len(dependencies), dependencies[0].Revision)
+	}
+	if err := r.CheckCommitSignatures(verify, "submitting"); err != nil {
+		return err
+	}
+	if !tbr && (r.Resolved == nil || !*r.Resolved) {
 		return errors.New("Not submitting as the review has not yet been accepted.")
 	}
+	if !tbr && r.Threads.Blocking > 0 {
+		return fmt.Errorf("Not submitting as %d blocking comment threads are still open.", r.Threads.Blocking)
+	}
+	if !tbr {
+		requirements, err := r.PolicyRequirements()
+		if err != nil {
+			return fmt.Errorf("Cannot check the approval policy: %v", err)
+		}
+		if unmet := policy.Unmet(requirements); len(unmet) > 0 {
+			var explanations []string
+			for _, req := range unmet {
+				explanations = append(explanations, "  "+req.String())
+			}
+			return fmt.Errorf("Not submitting as the approval policy requires:\n%s", strings.Join(explanations, "\n"))
+		}
+		if r.Reports == nil {
+			r.LoadReports()
+		}
+		if unsatisfied := ci.UnsatisfiedChecks(r.Reports, repository.GetConfigAll(requiredCheckConfig)); len(unsatisfied) > 0 {
+			return fmt.Errorf("Not submitting as the required CI checks %q have not succeeded.", unsatisfied)
+		}
+		if repository.GetConfig(requireChecklistConfig) == "true" {
+			if unchecked := checklist.Unchecked(r.ChecklistStatus()); len(unchecked) > 0 {
+				return fmt.Errorf("Not submitting as the checklist items %q have not been checked off.", unchecked)
+			}
+		}
+	}
 
 	target := r.Request.TargetRef
 	source := r.Request.ReviewRef
@@ -63,24 +176,46 @@ func submitReview(args []string) error {
 		return errors.New("Refusing to submit a non-fast-forward review. First merge the target ref.")
 	}
 
+	if jsonOutput {
+		// Keep the output of git separate from the JSON result.
+		repository.DefaultRunner.InlineOutput = os.Stderr
+	}
 	repository.SwitchToRef(target)
-	if *submitMerge {
+	switch strategy {
+	case request.SubmitMerge:
 		repository.MergeRef(source, false)
-	} else if *submitRebase {
+	case request.SubmitRebase:
 		repository.RebaseRef(source)
-	} else {
+	case request.SubmitSquash:
+		if err := repository.SquashRef(source, r.SquashMessage()); err != nil {
+			return err
+		}
+	default:
 		repository.MergeRef(source, true)
 	}
+
+	// Record how the review was submitted.
+	submitted := r.Request
+	submitted.SubmitStrategy = strategy
+	submitted.SubmittedAs = repository.GetCommitHash("HEAD")
+	if err := r.UpdateRequest(submitted); err != nil {
+		return err
+	}
+	notifyLocal(requestEvents(r.Revision, []request.Request{submitted}, submitted, false))
+	if jsonOutput {
+		return printJson(submitResult{r.Revision, source, target, strategy, submitted.SubmittedAs})
+	}
 	return nil
 }
 
 // submitCmd defines the "submit" subcommand.
 var submitCmd = &Command{
 	Usage: func(arg0 string) {
-		fmt.Printf("Usage: %s submit <option>...\n\nOptions:\n", arg0)
+		fmt.Printf("Usage: %s submit <option>... [<review>]\n\nOptions:\n", arg0)
 		submitFlagSet.PrintDefaults()
 	},
 	RunMethod: func(args []string) error {
 		return submitReview(args)
 	},
+	Mutates: true,
 }
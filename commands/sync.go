@@ -0,0 +1,164 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/google/git-appraise/repository"
+)
+
+var syncFlagSet = flag.NewFlagSet("sync", flag.ExitOnError)
+
+var (
+	syncAllRemotes = syncFlagSet.Bool("all-remotes", false, "Sync with every configured remote")
+	syncDryRun     = syncFlagSet.Bool("dry-run", false, "Only report the notes that would be pulled and pushed")
+	syncRetries    = syncFlagSet.Int("retries", defaultPushRetries, "Number of times to merge and retry a rejected push")
+)
+
+// pullFromRemote merges the review notes from the given remote into the local notes.
+func pullFromRemote(remote string) error {
+	remoteNotesRefPattern, err := getRemoteNotesRefPattern(remote)
+	if err != nil {
+		return err
+	}
+	return repository.PullNotes(remote, notesRefPattern, remoteNotesRefPattern)
+}
+
+// pushToRemote pushes the local review notes to the given remote.
+//
+// If the push is rejected because the remote's notes have changed since they
+// were last pulled, then they are pulled and merged again before retrying.
+func pushToRemote(remote string, retries int) error {
+	remoteNotesRefPattern, err := getRemoteNotesRefPattern(remote)
+	if err != nil {
+		return err
+	}
+	return repository.PushNotesWithRetry(remote, notesRefPattern, remoteNotesRefPattern, retries)
+}
+
+// countNotes returns the number of notes, and the number of objects they annotate.
+func countNotes(notes map[string][]repository.Note) (int, int) {
+	var count int
+	for _, objectNotes := range notes {
+		count += len(objectNotes)
+	}
+	return count, len(notes)
+}
+
+// reportSync prints the notes that syncing with the given remotes would pull and push, without changing either side.
+func reportSync(remotes []string) error {
+	var failed []string
+	for _, remote := range remotes {
+		remoteNotesRefPattern, err := getRemoteNotesRefPattern(remote)
+		if err == nil {
+			var differences []repository.NotesDifference
+			differences, err = repository.CompareRemoteNotes(remote, notesRefPattern, remoteNotesRefPattern)
+			for _, difference := range differences {
+				incoming, incomingObjects := countNotes(difference.Incoming)
+				outgoing, outgoingObjects := countNotes(difference.Outgoing)
+				if incoming == 0 && outgoing == 0 {
+					fmt.Printf("%s %s: up to date\n", remote, difference.Ref)
+					continue
+				}
+				fmt.Printf("%s %s: would pull %d notes on %d objects, and push %d notes on %d objects\n",
+					remote, difference.Ref, incoming, incomingObjects, outgoing, outgoingObjects)
+			}
+		}
+		if err != nil {
+			fmt.Println(err)
+			failed = append(failed, remote)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("Failed to compare with the remotes: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// syncWithRemotes merges the review notes from all of the given remotes, and then pushes the result to each of them.
+//
+// A remote that cannot be reached does not prevent syncing with the others.
+func syncWithRemotes(remotes []string) error {
+	var failed, pulled []string
+	for _, remote := range remotes {
+		if err := pullFromRemote(remote); err != nil {
+			fmt.Println(err)
+			failed = append(failed, remote)
+			continue
+		}
+		pulled = append(pulled, remote)
+	}
+	// Notes that are pushed to several remotes are only notified once.
+	notified := make(map[string]bool)
+	for _, remote := range pulled {
+		outgoing, err := outgoingNotes(remote)
+		if err == nil {
+			err = pushToRemote(remote, *syncRetries)
+		}
+		if err != nil {
+			fmt.Println(err)
+			failed = append(failed, remote)
+			continue
+		}
+		notifyOutgoing(outgoing, notified)
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("Failed to sync with the remotes: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// syncNotes syncs the review notes with one or all remotes.
+func syncNotes(args []string) error {
+	syncFlagSet.Parse(args)
+	args = syncFlagSet.Args()
+	if len(args) > 1 {
+		return errors.New("Only syncing with one remote at a time is supported; use --all-remotes to sync with every remote.")
+	}
+	var remotes []string
+	if *syncAllRemotes {
+		if len(args) > 0 {
+			return errors.New("A remote cannot be combined with --all-remotes.")
+		}
+		remotes = repository.ListRemotes()
+		if remotes == nil {
+			return errors.New("There are no remotes configured.")
+		}
+	} else {
+		remotes = []string{getRemote(args)}
+	}
+	if *syncDryRun {
+		return reportSync(remotes)
+	}
+	return syncWithRemotes(remotes)
+}
+
+// syncCmd defines the "sync" subcommand.
+var syncCmd = &Command{
+	Usage: func(arg0 string) {
+		fmt.Printf("Usage: %s sync <option>... [<remote>]\n\nOptions:\n", arg0)
+		syncFlagSet.PrintDefaults()
+	},
+	RunMethod: func(args []string) error {
+		return syncNotes(args)
+	},
+	Mutates: true,
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/google/git-appraise/repository"
+	"github.com/google/git-appraise/review/checklist"
+)
+
+const (
+	// defaultRequestTemplate is the path, within the target ref, of the template for review descriptions.
+	defaultRequestTemplate = ".appraise/request-template.md"
+	// requestTemplateConfig is the git config setting that overrides the path of the template.
+	requestTemplateConfig = "appraise.requestTemplate"
+	// requireTemplateConfig is the git config setting that, when "true", requires
+	// the template's placeholders to be filled in before a review is requested.
+	requireTemplateConfig = "appraise.requireTemplate"
+
+	// defaultChecklistTemplate is the path, within the target ref, of the template for review checklists.
+	defaultChecklistTemplate = ".appraise/checklist"
+	// checklistTemplateConfig is the git config setting that overrides the path of the checklist template.
+	checklistTemplateConfig = "appraise.checklistTemplate"
+	// requireChecklistConfig is the git config setting that, when "true",
+	// prevents submitting reviews whose checklist has unchecked items.
+	requireChecklistConfig = "appraise.requireChecklist"
+)
+
+// placeholderPattern matches the placeholders in a template, such as "{{How was this tested?}}".
+var placeholderPattern = regexp.MustCompile(`\{\{[^{}]*\}\}`)
+
+// loadRequestTemplate returns the template for review descriptions checked in to the given target ref, if there is one.
+//
+// The template is read from the target rather than from the working tree, so
+// that it reflects the policy of the branch the changes are headed for.
+func loadRequestTemplate(targetRef string) string {
+	path := repository.GetConfig(requestTemplateConfig)
+	if path == "" {
+		path = defaultRequestTemplate
+	}
+	template, err := repository.GetFileContents(targetRef, path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(template)
+}
+
+// loadChecklistTemplate returns the items of the checklist template checked in to the given target ref, if there is one.
+func loadChecklistTemplate(targetRef string) []string {
+	path := repository.GetConfig(checklistTemplateConfig)
+	if path == "" {
+		path = defaultChecklistTemplate
+	}
+	template, err := repository.GetFileContents(targetRef, path)
+	if err != nil {
+		return nil
+	}
+	return checklist.ParseTemplate(template)
+}
+
+// unfilledPlaceholders returns the template placeholders that remain in a description.
+func unfilledPlaceholders(description string) []string {
+	return placeholderPattern.FindAllString(description, -1)
+}
@@ -0,0 +1,54 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/git-appraise/repository"
+	"github.com/google/git-appraise/review"
+	"github.com/google/git-appraise/review/request"
+	"github.com/google/git-appraise/tui"
+)
+
+// runTui shows a full-screen view of the reviews on the terminal.
+func runTui(args []string) error {
+	if len(args) > 0 {
+		return errors.New("The tui command does not take any arguments.")
+	}
+	return tui.Run(tui.Actions{
+		Submit: func(r *review.Review) error {
+			unlock, err := repository.Lock()
+			if err != nil {
+				return err
+			}
+			defer unlock()
+			return submit(r, request.SubmitFastForward, false, false, false)
+		},
+	})
+}
+
+// tuiCmd defines the "tui" subcommand.
+var tuiCmd = &Command{
+	Usage: func(arg0 string) {
+		fmt.Printf("Usage: %s tui\n\nShows a full-screen view of the reviews, for browsing and commenting on them.\nPress \"q\" to go back or quit.\n", arg0)
+	},
+	RunMethod: func(args []string) error {
+		return runTui(args)
+	},
+}
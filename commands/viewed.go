@@ -0,0 +1,96 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/google/git-appraise/repository"
+	"github.com/google/git-appraise/review/viewed"
+)
+
+var viewedFlagSet = flag.NewFlagSet("viewed", flag.ExitOnError)
+
+var (
+	viewedUnmark = viewedFlagSet.Bool("unmark", false, "Mark the files as not viewed, so that they are shown again")
+	viewedReview = viewedFlagSet.String("review", "", "Commit of the review whose files to mark, instead of the current review")
+)
+
+// markViewed marks files of the current revision of a review as viewed by the
+// current user, or lists the files that they have already viewed.
+func markViewed(args []string) error {
+	viewedFlagSet.Parse(args)
+	args = viewedFlagSet.Args()
+
+	var reviewArgs []string
+	if *viewedReview != "" {
+		reviewArgs = []string{*viewedReview}
+	}
+	r, err := loadReview(reviewArgs)
+	if err != nil {
+		return err
+	}
+	revision, err := repository.ResolveCommit(r.Request.ReviewRef)
+	if err != nil {
+		return fmt.Errorf("Cannot resolve the review ref %q: %v", r.Request.ReviewRef, err)
+	}
+	if len(args) == 0 {
+		if *viewedUnmark {
+			return errors.New("The files to unmark must be given.")
+		}
+		for _, path := range viewed.Load(revision, repository.GetUserEmail()) {
+			fmt.Println(path)
+		}
+		return nil
+	}
+
+	changedFiles, err := r.ChangedFiles()
+	if err != nil {
+		return err
+	}
+	changed := make(map[string]bool)
+	for _, file := range changedFiles {
+		changed[file] = true
+	}
+	var notes []repository.Note
+	for _, path := range args {
+		if !changed[path] {
+			return fmt.Errorf("The review does not change %q.", path)
+		}
+		marker := viewed.New(path, *viewedUnmark)
+		note, err := marker.Write()
+		if err != nil {
+			return err
+		}
+		notes = append(notes, note)
+	}
+	return repository.AppendNotes(viewed.Ref, map[string][]repository.Note{revision: notes})
+}
+
+// viewedCmd defines the "viewed" subcommand.
+var viewedCmd = &Command{
+	Usage: func(arg0 string) {
+		fmt.Printf("Usage: %s viewed <option>... [<file>...]\n\nWithout any files, lists the files you have viewed in the current revision of the review.\n\nOptions:\n", arg0)
+		viewedFlagSet.PrintDefaults()
+	},
+	RunMethod: func(args []string) error {
+		return markViewed(args)
+	},
+	Mutates: true,
+}
@@ -0,0 +1,149 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/git-appraise/repository"
+	"github.com/google/git-appraise/review"
+)
+
+var watchFlagSet = flag.NewFlagSet("watch", flag.ExitOnError)
+
+var (
+	watchInterval = watchFlagSet.Duration("interval", time.Minute, "How long to wait between pulls")
+	watchUser     = watchFlagSet.String("user", "", "Report the activity relevant to the given email address instead of your own")
+	watchExec     = watchFlagSet.String("exec", "", "Shell command to run for each new event, instead of printing it")
+	watchAll      = watchFlagSet.Bool("all", false, "Report the activity on every review, not just those relevant to the user")
+)
+
+// loadWatchedActivity returns the activity, by others, on the open reviews that are relevant to the given user.
+func loadWatchedActivity(email string) ([]review.Activity, error) {
+	var activity []review.Activity
+	err := review.ForEach(func(r review.Review) error {
+		if r.IsClosed() || !(*watchAll || r.IsRelevantTo(email)) {
+			return nil
+		}
+		for _, event := range r.ListActivity() {
+			if !strings.EqualFold(event.Author, email) {
+				activity = append(activity, event)
+			}
+		}
+		return nil
+	})
+	return activity, err
+}
+
+// pullForWatch pulls the review notes from the given remote, holding the lock only while doing so.
+func pullForWatch(remote string) error {
+	unlock, err := repository.Lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return pullFromRemote(remote)
+}
+
+// reportActivity prints a new event, or runs the hook command for it.
+//
+// The hook receives the event as JSON on its stdin, and its kind, revision,
+// hash, and author in environment variables.
+func reportActivity(event review.Activity) error {
+	if *watchExec == "" {
+		location := event.Revision
+		if event.Hash != "" {
+			location += " " + event.Hash
+		}
+		text := strings.TrimSpace(strings.SplitN(strings.TrimSpace(event.Text), "\n", 2)[0])
+		fmt.Printf("[%s] %s by %s: %s\n", location, event.Kind, event.Author, text)
+		return nil
+	}
+	eventJson, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	env := hookEvent{Kind: event.Kind, Revision: event.Revision, Hash: event.Hash, Author: event.Author}.environment()
+	return runHook(*watchExec, env, eventJson)
+}
+
+// watch periodically pulls the review notes, and reports any new activity.
+//
+// Activity that is already present when the command starts is not reported.
+func watch(args []string) error {
+	watchFlagSet.Parse(args)
+	args = watchFlagSet.Args()
+	if len(args) > 1 {
+		return errors.New("Only watching one remote at a time is supported.")
+	}
+	if *watchInterval <= 0 {
+		return errors.New("The interval must be positive.")
+	}
+	remote := getRemote(args)
+	email := *watchUser
+	if email == "" {
+		email = repository.GetUserEmail()
+	}
+
+	seen := make(map[string]bool)
+	activity, err := loadWatchedActivity(email)
+	if err != nil {
+		return err
+	}
+	for _, event := range activity {
+		seen[event.Key] = true
+	}
+	fmt.Fprintf(os.Stderr, "Watching %s for review activity every %v...\n", remote, *watchInterval)
+	for {
+		time.Sleep(*watchInterval)
+		if err := pullForWatch(remote); err != nil {
+			// Network failures are expected from time to time, so keep going.
+			fmt.Fprintf(os.Stderr, "Failed to pull from %s: %v\n", remote, err)
+			continue
+		}
+		activity, err := loadWatchedActivity(email)
+		if err != nil {
+			return err
+		}
+		for _, event := range activity {
+			if seen[event.Key] {
+				continue
+			}
+			seen[event.Key] = true
+			if err := reportActivity(event); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to report %s %s: %v\n", event.Kind, event.Key, err)
+			}
+		}
+	}
+}
+
+// watchCmd defines the "watch" subcommand.
+var watchCmd = &Command{
+	Usage: func(arg0 string) {
+		fmt.Printf("Usage: %s watch <option>... [<remote>]\n\nThe remote defaults to the \"appraise.remote\" config setting, or \"origin\".\n\nOptions:\n", arg0)
+		watchFlagSet.PrintDefaults()
+	},
+	RunMethod: func(args []string) error {
+		return watch(args)
+	},
+}
@@ -0,0 +1,54 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/google/git-appraise/web"
+)
+
+var webFlagSet = flag.NewFlagSet("web", flag.ExitOnError)
+
+var (
+	webPort = webFlagSet.Int("port", 8080, "Port on which to serve the reviews")
+)
+
+// serveWeb serves a browser-based view of the reviews on the local machine.
+func serveWeb(args []string) error {
+	webFlagSet.Parse(args)
+	if len(webFlagSet.Args()) > 0 {
+		return errors.New("The web command does not take any arguments.")
+	}
+	// Since the pages allow posting comments, they are only served locally.
+	addr := fmt.Sprintf("localhost:%d", *webPort)
+	fmt.Printf("Serving the reviews at http://%s/\n", addr)
+	return web.Serve(addr)
+}
+
+// webCmd defines the "web" subcommand.
+var webCmd = &Command{
+	Usage: func(arg0 string) {
+		fmt.Printf("Usage: %s web <option>...\n\nOptions:\n", arg0)
+		webFlagSet.PrintDefaults()
+	},
+	RunMethod: func(args []string) error {
+		return serveWeb(args)
+	},
+}
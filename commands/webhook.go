@@ -0,0 +1,222 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+
+	"github.com/google/git-appraise/repository"
+	"github.com/google/git-appraise/review/comment"
+	"github.com/google/git-appraise/review/request"
+)
+
+const (
+	// webhookURLConfig is the multi-valued git config setting holding the URLs
+	// that review events are POSTed to when the notes are pushed.
+	webhookURLConfig = "appraise.webhook.url"
+	// webhookSecretConfig is the git config setting holding the secret used to sign the webhook payloads.
+	webhookSecretConfig = "appraise.webhook.secret"
+	// webhookSecretEnv is the environment variable that overrides the webhook secret.
+	webhookSecretEnv = "APPRAISE_WEBHOOK_SECRET"
+
+	// webhookEventHeader is the HTTP header naming the event of a webhook payload.
+	webhookEventHeader = "X-Appraise-Event"
+	// webhookSignatureHeader is the HTTP header holding the "sha256=" prefixed
+	// hex HMAC-SHA256 of a webhook payload, when a secret is configured.
+	webhookSignatureHeader = "X-Appraise-Signature"
+)
+
+// The events that are sent to webhooks.
+const (
+	eventReviewRequested = "review.requested"
+	eventReviewAccepted  = "review.accepted"
+	eventReviewSubmitted = "review.submitted"
+	eventCommentAdded    = "comment.added"
+	// eventMention is only sent to the mention hook.
+	eventMention = "mention"
+)
+
+// webhookEventOrder ranks the events that happen at the same time, e.g. a
+// review that is requested and then commented upon within a second.
+var webhookEventOrder = map[string]int{
+	eventReviewRequested: 0,
+	eventCommentAdded:    1,
+	eventReviewAccepted:  2,
+	eventReviewSubmitted: 3,
+}
+
+// webhookEvent describes a change to a review, as sent to webhooks.
+type webhookEvent struct {
+	Event     string `json:"event"`
+	Revision  string `json:"revision"`
+	Timestamp string `json:"timestamp,omitempty"`
+	// Request is the latest version of the review's request.
+	Request request.Request `json:"request"`
+	// Hash and Comment are the comment that was added, for comment events and acceptances.
+	Hash    string           `json:"hash,omitempty"`
+	Comment *comment.Comment `json:"comment,omitempty"`
+}
+
+// key identifies the event, so that it is only sent once per push.
+func (event webhookEvent) key() string {
+	return "webhook:" + event.Event + ":" + event.Revision + ":" + event.Hash + ":" + event.Timestamp
+}
+
+// webhookURLs returns the URLs that review events are sent to.
+func webhookURLs() []string {
+	return repository.GetConfigAll(webhookURLConfig)
+}
+
+// requestEvents returns the events for the given new versions of the request
+// on a revision, which are the first versions of the review if isNew is set.
+func requestEvents(revision string, outgoing []request.Request, latest request.Request, isNew bool) []webhookEvent {
+	var events []webhookEvent
+	for i, r := range outgoing {
+		if i == 0 && isNew {
+			events = append(events, webhookEvent{eventReviewRequested, revision, r.Timestamp, latest, "", nil})
+		}
+		if r.SubmittedAs != "" {
+			events = append(events, webhookEvent{eventReviewSubmitted, revision, r.Timestamp, latest, "", nil})
+		}
+	}
+	return events
+}
+
+// commentEvents returns the events for the given new comments on the review of a revision.
+//
+// Amendments of earlier comments are left out, and comments accepting the
+// review also count as acceptances.
+func commentEvents(revision string, latest request.Request, comments map[string]comment.Comment) []webhookEvent {
+	var events []webhookEvent
+	for hash, c := range comments {
+		if c.Original != "" {
+			continue
+		}
+		c := c
+		events = append(events, webhookEvent{eventCommentAdded, revision, c.Timestamp, latest, hash, &c})
+		if c.Parent == "" && c.Resolved != nil && *c.Resolved {
+			events = append(events, webhookEvent{eventReviewAccepted, revision, c.Timestamp, latest, hash, &c})
+		}
+	}
+	return events
+}
+
+// outgoingEvents returns the review events for the given outgoing notes, in the order they happened.
+func outgoingEvents(differences []repository.NotesDifference) []webhookEvent {
+	var events []webhookEvent
+	for _, difference := range differences {
+		for revision, notes := range difference.Outgoing {
+			latest, ok := latestRequest(revision)
+			if !ok {
+				continue
+			}
+			switch difference.Ref {
+			case request.Ref:
+				isNew := len(notes) >= len(repository.GetNotes(request.Ref, revision))
+				events = append(events, requestEvents(revision, request.ParseAllValid(notes), latest, isNew)...)
+			case comment.Ref:
+				events = append(events, commentEvents(revision, latest, comment.ParseAllValid(notes))...)
+			}
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		if events[i].Timestamp != events[j].Timestamp {
+			return events[i].Timestamp < events[j].Timestamp
+		}
+		if events[i].Event != events[j].Event {
+			return webhookEventOrder[events[i].Event] < webhookEventOrder[events[j].Event]
+		}
+		return events[i].key() < events[j].key()
+	})
+	return events
+}
+
+// signWebhookPayload returns the value of the signature header for a payload signed with the given secret.
+func signWebhookPayload(payload []byte, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookSecret returns the secret used to sign the webhook payloads, if any.
+func webhookSecret() string {
+	if secret := os.Getenv(webhookSecretEnv); secret != "" {
+		return secret
+	}
+	return repository.GetConfig(webhookSecretConfig)
+}
+
+// postWebhook POSTs an event to a webhook, signing it if there is a secret.
+func postWebhook(url, secret string, event webhookEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return postPayload(url, secret, event.Event, payload)
+}
+
+// postPayload POSTs the JSON payload of the named event to a webhook,
+// signing it if there is a secret.
+func postPayload(url, secret, event string, payload []byte) error {
+	req, err := http.NewRequest("POST", url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(webhookEventHeader, event)
+	if secret != "" {
+		req.Header.Set(webhookSignatureHeader, signWebhookPayload(payload, secret))
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("The webhook responded with %q", resp.Status)
+	}
+	return nil
+}
+
+// sendWebhooks sends the review events in the given outgoing notes that are
+// not in the notified set to every webhook, and adds them to it.
+//
+// The notes have already been pushed by the time this is called, so a failed
+// delivery is reported rather than treated as an error.
+func sendWebhooks(differences []repository.NotesDifference, notified map[string]bool) {
+	urls := webhookURLs()
+	secret := webhookSecret()
+	for _, event := range outgoingEvents(differences) {
+		if notified[event.key()] {
+			continue
+		}
+		notified[event.key()] = true
+		for _, url := range urls {
+			if err := postWebhook(url, secret, event); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to send the %s event for %s to %s: %v\n", event.Event, event.Revision, url, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,77 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"testing"
+
+	"github.com/google/git-appraise/review/comment"
+	"github.com/google/git-appraise/review/request"
+)
+
+func TestSignWebhookPayload(t *testing.T) {
+	// The expected value is the HMAC-SHA256 of the payload, as computed by "openssl dgst -sha256 -hmac secret".
+	want := "sha256=77325902caca812dc259733aacd046b73817372c777b8d95b402647474516e13"
+	got := signWebhookPayload([]byte("{}"), "secret")
+	if got != want {
+		t.Errorf("signWebhookPayload() = %q, want %q", got, want)
+	}
+}
+
+func TestRequestEvents(t *testing.T) {
+	latest := request.Request{Description: "Latest"}
+	outgoing := []request.Request{
+		{Timestamp: "1"},
+		{Timestamp: "2", SubmittedAs: "abc"},
+	}
+	events := requestEvents("rev", outgoing, latest, true)
+	if len(events) != 2 || events[0].Event != eventReviewRequested || events[1].Event != eventReviewSubmitted {
+		t.Fatalf("Unexpected events for a new review: %+v", events)
+	}
+	if events[0].Request.Description != "Latest" || events[1].Timestamp != "2" {
+		t.Errorf("Unexpected event contents: %+v", events)
+	}
+	if events := requestEvents("rev", outgoing[:1], latest, false); len(events) != 0 {
+		t.Errorf("Unexpected events for an updated review: %+v", events)
+	}
+}
+
+func TestCommentEvents(t *testing.T) {
+	accepted := true
+	comments := map[string]comment.Comment{
+		"a": {Description: "LGTM", Resolved: &accepted},
+		"b": {Description: "Done", Parent: "c", Resolved: &accepted},
+		"d": {Description: "Edited", Original: "b"},
+	}
+	counts := make(map[string]int)
+	for _, event := range commentEvents("rev", request.Request{}, comments) {
+		counts[event.Event+":"+event.Hash]++
+	}
+	want := map[string]int{
+		eventCommentAdded + ":a":   1,
+		eventReviewAccepted + ":a": 1,
+		eventCommentAdded + ":b":   1,
+	}
+	if len(counts) != len(want) {
+		t.Fatalf("Unexpected events: %v", counts)
+	}
+	for key, count := range want {
+		if counts[key] != count {
+			t.Errorf("Unexpected events: %v", counts)
+		}
+	}
+}
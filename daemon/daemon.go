@@ -0,0 +1,362 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package daemon serves the code reviews in a repository to editor plugins
+// over JSON-RPC 2.0, so that they do not need to run the tool for every query.
+//
+// Each request and response is a JSON object on a line of its own. The
+// methods are:
+//
+//	list {"all": bool} -> [review]
+//	show {"revision": string} -> review
+//	comment {"revision", "message", "path", "line", "parent", "resolved"} -> {"revision", "hash", "comment"}
+//	resolve {"revision", "hash", "message", "unresolve"} -> {"revision", "hash", "comment"}
+//
+// Reviews have the same form as in the output of "list --json" and "show --json".
+package daemon
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/git-appraise/repository"
+	"github.com/google/git-appraise/review"
+	"github.com/google/git-appraise/review/comment"
+)
+
+// The error codes defined by JSON-RPC 2.0, along with the one used for errors of the methods themselves.
+const (
+	codeParseError     = -32700
+	codeInvalidRequest = -32600
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+	codeMethodFailed   = -32000
+)
+
+// maxRequestSize bounds the length of a request line.
+const maxRequestSize = 16 * 1024 * 1024
+
+// rpcRequest is a JSON-RPC 2.0 request, which is a notification if it has no ID.
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// rpcError is the error of a failed request.
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string {
+	return e.Message
+}
+
+// rpcResponse is a JSON-RPC 2.0 response.
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+// CommentResult is the result of the methods that add a comment.
+type CommentResult struct {
+	Revision string          `json:"revision"`
+	Hash     string          `json:"hash"`
+	Comment  comment.Comment `json:"comment"`
+}
+
+// Server answers the requests of the clients connected to it.
+type Server struct {
+	// OnComment, if set, is called after a comment is added to a review.
+	OnComment func(r *review.Review, hash string, c comment.Comment)
+
+	// mu serializes the handling of requests, as they read and write the repository.
+	mu sync.Mutex
+	// stateHash identifies the state of the repository that the reviews were loaded from.
+	stateHash string
+	reviews   []review.Review
+}
+
+// Serve accepts connections on the listener, and answers the requests on each
+// of them, until the listener is closed.
+func (s *Server) Serve(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go s.serveConn(conn)
+	}
+}
+
+// serveConn answers the requests on a connection until the client closes it.
+func (s *Server) serveConn(conn io.ReadWriteCloser) {
+	defer conn.Close()
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 64*1024), maxRequestSize)
+	encoder := json.NewEncoder(conn)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		response := s.handle(scanner.Bytes())
+		if response == nil {
+			continue
+		}
+		if err := encoder.Encode(response); err != nil {
+			log.Print(err)
+			return
+		}
+	}
+}
+
+// handle answers a single request, returning nil for notifications.
+func (s *Server) handle(line []byte) *rpcResponse {
+	var req rpcRequest
+	if err := json.Unmarshal(line, &req); err != nil {
+		return &rpcResponse{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &rpcError{codeParseError, err.Error()}}
+	}
+	id := req.ID
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		return &rpcResponse{JSONRPC: "2.0", ID: id, Error: &rpcError{codeInvalidRequest, "Not a JSON-RPC 2.0 request"}}
+	}
+	result, err := s.call(req.Method, req.Params)
+	if req.ID == nil {
+		return nil
+	}
+	response := &rpcResponse{JSONRPC: "2.0", ID: id, Result: result}
+	if err != nil {
+		rpcErr, ok := err.(*rpcError)
+		if !ok {
+			rpcErr = &rpcError{codeMethodFailed, err.Error()}
+		}
+		response.Result = nil
+		response.Error = rpcErr
+	}
+	return response
+}
+
+// decodeParams decodes the parameters of a request.
+func decodeParams(params json.RawMessage, v interface{}) error {
+	if len(params) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(params, v); err != nil {
+		return &rpcError{codeInvalidParams, err.Error()}
+	}
+	return nil
+}
+
+// call runs a method with the given parameters.
+func (s *Server) call(method string, params json.RawMessage) (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch method {
+	case "list":
+		var p struct {
+			All bool `json:"all"`
+		}
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		return s.list(p.All), nil
+	case "show":
+		var p struct {
+			Revision string `json:"revision"`
+		}
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		r, err := getReview(p.Revision)
+		if err != nil {
+			return nil, err
+		}
+		r.Overdue = r.IsOverdue(time.Now())
+		return r, nil
+	case "comment":
+		var p struct {
+			Revision string `json:"revision"`
+			Message  string `json:"message"`
+			Path     string `json:"path"`
+			Line     uint32 `json:"line"`
+			Parent   string `json:"parent"`
+			Resolved *bool  `json:"resolved"`
+		}
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		r, err := getReview(p.Revision)
+		if err != nil {
+			return nil, err
+		}
+		if p.Message == "" && p.Resolved == nil {
+			return nil, &rpcError{codeInvalidParams, "The comment is empty"}
+		}
+		if p.Parent != "" && findThread(r.Comments, p.Parent) == nil {
+			return nil, fmt.Errorf("There is no comment %q on the review", p.Parent)
+		}
+		c := newComment(r, p.Message)
+		if p.Path != "" {
+			c.Location.Path = p.Path
+			if p.Line > 0 {
+				c.Location.Range = &comment.Range{StartLine: p.Line}
+			}
+		}
+		c.Parent = p.Parent
+		c.Resolved = p.Resolved
+		return s.addComment(r, c)
+	case "resolve":
+		var p struct {
+			Revision  string `json:"revision"`
+			Hash      string `json:"hash"`
+			Message   string `json:"message"`
+			Unresolve bool   `json:"unresolve"`
+		}
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		r, err := getReview(p.Revision)
+		if err != nil {
+			return nil, err
+		}
+		if findThread(r.Comments, p.Hash) == nil {
+			return nil, fmt.Errorf("There is no comment %q on the review", p.Hash)
+		}
+		resolved := !p.Unresolve
+		c := newComment(r, p.Message)
+		c.Parent = p.Hash
+		c.Resolved = &resolved
+		return s.addComment(r, c)
+	}
+	return nil, &rpcError{codeMethodNotFound, fmt.Sprintf("Unknown method %q", method)}
+}
+
+// list returns the open reviews, or all of them, reloading them only when the repository has changed.
+func (s *Server) list(all bool) []review.Review {
+	if stateHash := repository.GetRepoStateHash(); stateHash != s.stateHash || s.reviews == nil {
+		s.reviews = review.ListAll()
+		s.stateHash = stateHash
+	}
+	now := time.Now()
+	reviews := []review.Review{}
+	for _, r := range s.reviews {
+		if all || !r.IsClosed() {
+			r.Overdue = r.IsOverdue(now)
+			reviews = append(reviews, r)
+		}
+	}
+	return reviews
+}
+
+// getReview returns the review of the given revision.
+func getReview(revision string) (*review.Review, error) {
+	if revision == "" {
+		return nil, &rpcError{codeInvalidParams, "The revision of the review is required"}
+	}
+	r := review.Get(revision)
+	if r == nil {
+		return nil, fmt.Errorf("There is no review of %q", revision)
+	}
+	return r, nil
+}
+
+// findThread returns the thread of the comment with the given hash, searching the replies too.
+func findThread(threads []review.CommentThread, hash string) *review.CommentThread {
+	for i := range threads {
+		if threads[i].Hash == hash {
+			return &threads[i]
+		}
+		if thread := findThread(threads[i].Children, hash); thread != nil {
+			return thread
+		}
+	}
+	return nil
+}
+
+// newComment returns a comment on the current revision of the review.
+func newComment(r *review.Review, message string) comment.Comment {
+	c := comment.New(message)
+	c.Location = &comment.Location{Commit: repository.GetCommitHash(r.Request.ReviewRef)}
+	return c
+}
+
+// addComment adds the comment to the review, holding the repository's lock as other commands may be running.
+func (s *Server) addComment(r *review.Review, c comment.Comment) (*CommentResult, error) {
+	unlock, err := repository.Lock()
+	if err != nil {
+		return nil, err
+	}
+	err = r.AddComment(&c)
+	unlock()
+	if err != nil {
+		return nil, err
+	}
+	hash, err := c.Hash()
+	if err != nil {
+		return nil, err
+	}
+	if s.OnComment != nil {
+		s.OnComment(r, hash, c)
+	}
+	return &CommentResult{r.Revision, hash, c}, nil
+}
+
+// ErrAlreadyRunning is returned by Listen when another daemon is serving the socket.
+var ErrAlreadyRunning = errors.New("Another daemon is already serving the socket.")
+
+// Listen listens on the Unix socket with the given path, replacing the socket
+// left behind by a daemon that is no longer running.
+func Listen(path string) (net.Listener, error) {
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return nil, ErrAlreadyRunning
+	}
+	listener, err := net.Listen("unix", path)
+	if err == nil {
+		return listener, nil
+	}
+	if removeErr := removeSocket(path); removeErr != nil {
+		return nil, err
+	}
+	return net.Listen("unix", path)
+}
+
+// removeSocket removes the Unix socket at the given path, but nothing else.
+func removeSocket(path string) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%q is not a socket", path)
+	}
+	return os.Remove(path)
+}
@@ -0,0 +1,50 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package daemon
+
+import (
+	"testing"
+)
+
+func TestHandleErrors(t *testing.T) {
+	s := &Server{}
+	tests := map[string]int{
+		`{bad`:                        codeParseError,
+		`{"id": 1, "method": "list"}`: codeInvalidRequest,
+		`{"jsonrpc": "2.0", "id": 1, "method": "frob"}`:                 codeMethodNotFound,
+		`{"jsonrpc": "2.0", "id": 1, "method": "show", "params": []}`:   codeInvalidParams,
+		`{"jsonrpc": "2.0", "id": 1, "method": "show", "params": {}}`:   codeInvalidParams,
+		`{"jsonrpc": "2.0", "id": 1, "method": "resolve", "params": 3}`: codeInvalidParams,
+	}
+	for request, code := range tests {
+		response := s.handle([]byte(request))
+		if response == nil || response.Error == nil || response.Error.Code != code {
+			t.Errorf("handle(%s) = %+v, want the error code %d", request, response, code)
+		}
+	}
+}
+
+func TestHandleNotification(t *testing.T) {
+	s := &Server{}
+	if response := s.handle([]byte(`{"jsonrpc": "2.0", "method": "frob"}`)); response != nil {
+		t.Errorf("Expected no response to a notification, got %+v", response)
+	}
+	response := s.handle([]byte(`{"jsonrpc": "2.0", "id": "a", "method": "frob"}`))
+	if response == nil || string(response.ID) != `"a"` {
+		t.Errorf("Expected the response to keep the request's ID, got %+v", response)
+	}
+}
@@ -26,15 +26,17 @@ limitations under the License.
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"os/exec"
 	"sort"
 	"github.com/google/git-appraise/commands"
 	"github.com/google/git-appraise/repository"
 	"strings"
 )
 
-const usageMessageTemplate = `Usage: %s <command>
+const usageMessageTemplate = `Usage: %s [-C <path>] [--git-dir=<path>] [--no-pager] [--color=<when>] [--verbose] [--log-file=<path>] <command>
 
 Where <command> is one of:
   %s
@@ -43,6 +45,11 @@ For individual command usage, run:
   %s help <command>
 `
 
+const pluginsMessageTemplate = `
+Commands provided by "git-appraise-<command>" executables on the PATH:
+  %s
+`
+
 func usage() {
 	command := os.Args[0]
 	var subcommands []string
@@ -51,6 +58,22 @@ func usage() {
 	}
 	sort.Strings(subcommands)
 	fmt.Printf(usageMessageTemplate, command, strings.Join(subcommands, "\n  "), command)
+	if plugins := commands.ListPlugins(); len(plugins) > 0 {
+		fmt.Printf(pluginsMessageTemplate, strings.Join(plugins, "\n  "))
+	}
+}
+
+// runPlugin runs the executable implementing the given subcommand, and exits with its status.
+func runPlugin(path string, args []string) {
+	err := commands.RunPlugin(path, args)
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		os.Exit(exitErr.ExitCode())
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
 }
 
 func help() {
@@ -60,6 +83,10 @@ func help() {
 	}
 	subcommand, ok := commands.CommandMap[os.Args[2]]
 	if !ok {
+		if path := commands.FindPlugin(os.Args[2]); path != "" {
+			runPlugin(path, []string{"--help"})
+			return
+		}
 		fmt.Printf("Unknown command %q\n", os.Args[2])
 		usage()
 		return
@@ -67,7 +94,112 @@ func help() {
 	subcommand.Usage(os.Args[0])
 }
 
+// Tracing options set by the global flags.
+var (
+	verbose bool
+	logFile string
+)
+
+// parseGlobalFlags handles the flags that precede the subcommand, and removes them from os.Args.
+//
+// Like git, "-C <path>" runs as if the tool was started in the given path
+// (and may be repeated), and "--git-dir=<path>" sets the repository to use.
+// "--verbose" prints each git command run, with its timing, to stderr, and
+// "--log-file=<path>" appends a JSON line about each of them to the given file.
+// "--no-pager" stops long output from being sent through the user's pager, and
+// "--color=auto|always|never" overrides the "color.appraise" config setting.
+func parseGlobalFlags() error {
+	args := os.Args[1:]
+	for len(args) > 0 {
+		switch {
+		case args[0] == "--no-pager":
+			commands.NoPager = true
+			args = args[1:]
+		case args[0] == "--color":
+			commands.ColorMode = "always"
+			args = args[1:]
+		case strings.HasPrefix(args[0], "--color="):
+			commands.ColorMode = strings.TrimPrefix(args[0], "--color=")
+			args = args[1:]
+		case args[0] == "--verbose":
+			verbose = true
+			args = args[1:]
+		case args[0] == "--log-file":
+			if len(args) < 2 {
+				return fmt.Errorf("Option %q requires a path", args[0])
+			}
+			logFile = args[1]
+			args = args[2:]
+		case strings.HasPrefix(args[0], "--log-file="):
+			logFile = strings.TrimPrefix(args[0], "--log-file=")
+			args = args[1:]
+		case args[0] == "-C" || args[0] == "--git-dir":
+			if len(args) < 2 {
+				return fmt.Errorf("Option %q requires a path", args[0])
+			}
+			if err := applyGlobalFlag(args[0], args[1]); err != nil {
+				return err
+			}
+			args = args[2:]
+		case strings.HasPrefix(args[0], "--git-dir="):
+			if err := applyGlobalFlag("--git-dir", strings.TrimPrefix(args[0], "--git-dir=")); err != nil {
+				return err
+			}
+			args = args[1:]
+		default:
+			os.Args = append(os.Args[:1], args...)
+			return nil
+		}
+	}
+	os.Args = os.Args[:1]
+	return nil
+}
+
+func applyGlobalFlag(flag, path string) error {
+	if flag == "-C" {
+		if path == "" {
+			return nil
+		}
+		return os.Chdir(path)
+	}
+	repository.DefaultRunner.GitDir = path
+	return nil
+}
+
+// setUpTracing installs the tracer for git commands requested by the global flags.
+//
+// The returned function closes the log file, if one was opened.
+func setUpTracing() (func(), error) {
+	var tracers []repository.Tracer
+	if verbose {
+		tracers = append(tracers, repository.NewTextTracer(os.Stderr))
+	}
+	closeLog := func() {}
+	if logFile != "" {
+		file, err := os.OpenFile(logFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to open the log file: %v", err)
+		}
+		tracers = append(tracers, repository.NewJSONTracer(file))
+		closeLog = func() { file.Close() }
+	}
+	if len(tracers) > 0 {
+		repository.DefaultRunner.Tracer = repository.MultiTracer(tracers...)
+	}
+	return closeLog, nil
+}
+
 func main() {
+	if err := parseGlobalFlags(); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	closeLog, err := setUpTracing()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	defer closeLog()
 	if len(os.Args) < 2 {
 		usage()
 		return
@@ -76,18 +208,22 @@ func main() {
 		help()
 		return
 	}
-	if !repository.IsGitRepo() {
-		fmt.Printf("%s must be run from within a git repo.", os.Args[0])
-		return
-	}
 	subcommand, ok := commands.CommandMap[os.Args[1]]
 	if !ok {
+		if path := commands.FindPlugin(os.Args[1]); path != "" {
+			runPlugin(path, os.Args[2:])
+			return
+		}
 		fmt.Printf("Unknown command %q", os.Args[1])
 		usage()
 		return
 	}
+	if !subcommand.OutsideRepo && !repository.IsGitRepo() {
+		fmt.Printf("%s must be run from within a git repo.", os.Args[0])
+		return
+	}
 	if err := subcommand.Run(os.Args[2:]); err != nil {
-		fmt.Println(err.Error())
+		fmt.Fprintln(os.Stderr, err.Error())
 		os.Exit(1)
 	}
 }
@@ -18,12 +18,21 @@ limitations under the License.
 package repository
 
 import (
+	"bufio"
 	"crypto/sha1"
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 const branchRefPrefix = "refs/heads/"
@@ -33,18 +42,22 @@ type Note []byte
 
 // Run the given git command and return its stdout, or an error if the command fails.
 func runGitCommand(args ...string) (string, error) {
-	cmd := exec.Command("git", args...)
-	out, err := cmd.Output()
-	return strings.Trim(string(out), "\n"), err
+	return DefaultRunner.Run(args...)
+}
+
+// Run the given git command with the given input on stdin, and return its stdout.
+func runGitCommandWithInput(input string, args ...string) (string, error) {
+	return DefaultRunner.RunWithInput(strings.NewReader(input), args...)
+}
+
+// Run the given git command with additional environment variables, and return its stdout.
+func runGitCommandWithEnv(env []string, args ...string) (string, error) {
+	return DefaultRunner.WithEnv(env...).Run(args...)
 }
 
 // Run the given git command using the same stdin, stdout, and stderr as the review tool.
 func runGitCommandInline(args ...string) error {
-	cmd := exec.Command("git", args...)
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	return cmd.Run()
+	return DefaultRunner.RunInline(args...)
 }
 
 // Run the given git command using the same stdin, stdout, and stderr as the review tool.
@@ -60,8 +73,7 @@ func runGitCommandInlineOrDie(args ...string) {
 func runGitCommandOrDie(args ...string) string {
 	out, err := runGitCommand(args...)
 	if err != nil {
-		log.Print("git", args)
-		log.Fatal(out)
+		log.Fatal(err)
 	}
 	return out
 }
@@ -72,19 +84,179 @@ func IsGitRepo() bool {
 	if err == nil {
 		return true
 	}
-	if _, ok := err.(*exec.ExitError); ok {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
 		return false
 	}
 	log.Fatal(err)
 	return false
 }
 
+// GetGitDir returns the path of the repository's .git directory.
+func GetGitDir() string {
+	return runGitCommandOrDie("rev-parse", "--absolute-git-dir")
+}
+
+// GetHooksDir returns the absolute path of the directory holding the repository's git hooks.
+//
+// This honors the "core.hooksPath" config setting.
+func GetHooksDir() (string, error) {
+	dir, err := runGitCommand("rev-parse", "--git-path", "hooks")
+	if err != nil {
+		return "", err
+	}
+	return filepath.Abs(dir)
+}
+
+// GetRepoRoot returns the path of the top-level directory of the repository's working tree.
+func GetRepoRoot() (string, error) {
+	return runGitCommand("rev-parse", "--show-toplevel")
+}
+
 // GetRepoStateHash returns a hash which embodies the entire current state of a repository.
 func GetRepoStateHash() string {
 	stateSummary := runGitCommandOrDie("show-ref")
 	return fmt.Sprintf("%x", sha1.Sum([]byte(stateSummary)))
 }
 
+// GetConfig returns the value of the given git config setting.
+//
+// If the setting is not defined, then the empty string is returned.
+func GetConfig(key string) string {
+	out, err := runGitCommand("config", key)
+	if err != nil {
+		return ""
+	}
+	return out
+}
+
+// GetConfigAll returns all of the values of the given multi-valued git config setting.
+func GetConfigAll(key string) []string {
+	out, err := runGitCommand("config", "--get-all", key)
+	if err != nil || out == "" {
+		return nil
+	}
+	return strings.Split(out, "\n")
+}
+
+// GetConfigSubsections returns the names of the subsections of the given git
+// config section that have any settings, e.g. "foo" for "section.foo.key".
+func GetConfigSubsections(section string) []string {
+	out, err := runGitCommand("config", "--name-only", "--get-regexp", "^"+regexp.QuoteMeta(section)+"\\.")
+	if err != nil || out == "" {
+		return nil
+	}
+	seen := make(map[string]bool)
+	var subsections []string
+	for _, name := range strings.Split(out, "\n") {
+		name = strings.TrimPrefix(name, section+".")
+		lastDot := strings.LastIndex(name, ".")
+		if lastDot < 0 || seen[name[:lastDot]] {
+			continue
+		}
+		seen[name[:lastDot]] = true
+		subsections = append(subsections, name[:lastDot])
+	}
+	return subsections
+}
+
+// GetColor returns the terminal escape sequence for the color named by the
+// given git config setting, or for the given default color if it is not set.
+//
+// Colors are specified as for git's own "color.*" settings (e.g. "bold red").
+func GetColor(key, defaultColor string) string {
+	out, err := runGitCommand("config", "--get-color", key, defaultColor)
+	if err != nil {
+		return ""
+	}
+	return out
+}
+
+// GetColorBool reports whether the given git config setting (falling back to
+// "color.ui") enables color, given whether the output is going to a terminal.
+func GetColorBool(key string, isTerminal bool) bool {
+	out, err := runGitCommand("config", "--get-colorbool", key, strconv.FormatBool(isTerminal))
+	return err == nil && out == "true"
+}
+
+// AddConfig adds a value to the given (possibly multi-valued) git config setting in the current repository.
+func AddConfig(key, value string) error {
+	_, err := runGitCommand("config", "--add", key, value)
+	return err
+}
+
+// RemoveConfig removes the given value of the given (possibly multi-valued) git config setting in the current repository.
+func RemoveConfig(key, value string) error {
+	_, err := runGitCommand("config", "--unset", key, "^"+regexp.QuoteMeta(value)+"$")
+	return err
+}
+
+// SetConfig sets the given git config setting in the current repository, replacing any previous value.
+func SetConfig(key, value string) error {
+	_, err := runGitCommand("config", key, value)
+	return err
+}
+
+// repoSwitchHooks are the functions registered with OnRepoSwitch.
+var repoSwitchHooks []func()
+
+// OnRepoSwitch registers a function to run whenever InRepo switches
+// repositories, so that packages can forget what they cached about the
+// previous one. It must only be called during initialization.
+func OnRepoSwitch(f func()) {
+	repoSwitchHooks = append(repoSwitchHooks, f)
+}
+
+// switchedRepo forgets everything cached about the previous repository.
+func switchedRepo() {
+	resetShallowCommits()
+	for _, f := range repoSwitchHooks {
+		f()
+	}
+}
+
+// InRepo runs the given function against the repository at the given path,
+// and then switches back to the current repository.
+func InRepo(path string, f func() error) error {
+	previous, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	if err := os.Chdir(path); err != nil {
+		return err
+	}
+	// An explicit git directory would override the change of directory.
+	gitDir, hasGitDir := os.LookupEnv("GIT_DIR")
+	runnerGitDir := DefaultRunner.GitDir
+	os.Unsetenv("GIT_DIR")
+	DefaultRunner.GitDir = ""
+	switchedRepo()
+	defer func() {
+		os.Chdir(previous)
+		if hasGitDir {
+			os.Setenv("GIT_DIR", gitDir)
+		}
+		DefaultRunner.GitDir = runnerGitDir
+		switchedRepo()
+	}()
+	if !IsGitRepo() {
+		return fmt.Errorf("%q is not a git repository", path)
+	}
+	return f()
+}
+
+// GetEditor returns the command for the user's configured editor, following the same rules as git.
+func GetEditor() (string, error) {
+	return runGitCommand("var", "GIT_EDITOR")
+}
+
+// GetPager returns the command for the user's configured pager, following the same rules as git.
+//
+// An empty result, or "cat", means that output should not be paged.
+func GetPager() (string, error) {
+	return runGitCommand("var", "GIT_PAGER")
+}
+
 // GetUserEmail returns the email address that the user has used to configure git.
 func GetUserEmail() string {
 	return runGitCommandOrDie("config", "user.email")
@@ -99,6 +271,19 @@ func HasUncommittedChanges() bool {
 	return false
 }
 
+// HasUncommittedChangesIn reports whether there are uncommitted changes to the given path.
+func HasUncommittedChangesIn(path string) bool {
+	return runGitCommandOrDie("status", "--porcelain", "--", path) != ""
+}
+
+// CommitFixup commits the current contents of the given paths as a fixup of the given commit.
+//
+// The fixup is squashed into that commit by "git rebase --autosquash".
+func CommitFixup(commit string, paths ...string) error {
+	args := append([]string{"commit", "--quiet", "--fixup=" + commit, "--"}, paths...)
+	return runGitCommandInline(args...)
+}
+
 // VerifyGitRefOrDie verifies that the supplied ref points to a known commit.
 func VerifyGitRefOrDie(ref string) {
 	runGitCommandOrDie("show-ref", "--verify", ref)
@@ -109,29 +294,216 @@ func GetHeadRef() string {
 	return runGitCommandOrDie("symbolic-ref", "HEAD")
 }
 
+// GetFullRefName returns the full name (e.g. "refs/heads/master") of the given ref.
+//
+// If the name is ambiguous, or does not name a ref, then an error is returned.
+func GetFullRefName(ref string) (string, error) {
+	fullName, err := runGitCommand("rev-parse", "--symbolic-full-name", ref)
+	if err != nil {
+		return "", err
+	}
+	if fullName == "" {
+		return "", fmt.Errorf("%q is not a ref", ref)
+	}
+	return fullName, nil
+}
+
+// GetDefaultBranch returns the local branch corresponding to the default branch of the given remote.
+//
+// If the remote's default branch is not known, or there is no local branch
+// with the same name, then an empty string is returned.
+func GetDefaultBranch(remote string) string {
+	remoteHead, err := runGitCommand("symbolic-ref", "refs/remotes/"+remote+"/HEAD")
+	if err != nil {
+		return ""
+	}
+	branch := branchRefPrefix + strings.TrimPrefix(remoteHead, "refs/remotes/"+remote+"/")
+	if _, err := runGitCommand("show-ref", "--verify", "--quiet", branch); err != nil {
+		return ""
+	}
+	return branch
+}
+
 // GetCommitHash returns the hash of the commit pointed to by the given ref.
 func GetCommitHash(ref string) string {
 	return runGitCommandOrDie("show", "-s", "--format=%H", ref)
 }
 
+// ResolveCommit returns the hash of the commit pointed to by the given ref, or an error if it does not exist.
+func ResolveCommit(ref string) (string, error) {
+	return runGitCommand("rev-parse", "--verify", "--quiet", ref+"^{commit}")
+}
+
+// HasChanges reports whether anything at the given path differs between the two revisions.
+func HasChanges(from, to, path string) bool {
+	_, err := runGitCommand("diff", "--quiet", from, to, "--", path)
+	var exitErr *exec.ExitError
+	return errors.As(err, &exitErr) && exitErr.ExitCode() == 1
+}
+
+// ListChangedFiles returns the paths of the files that differ between the two revisions.
+func ListChangedFiles(from, to string) ([]string, error) {
+	out, err := runGitCommand("diff", "--name-only", "--no-renames", from, to)
+	if err != nil || out == "" {
+		return nil, err
+	}
+	return strings.Split(out, "\n"), nil
+}
+
+// GetFileContents returns the contents of the file at the given path within the given revision.
+func GetFileContents(ref, path string) (string, error) {
+	return runGitCommand("show", ref+":"+path)
+}
+
+// GetCommitTime returns the time at which the given commit was committed.
+func GetCommitTime(ref string) (time.Time, error) {
+	out, err := runGitCommand("show", "-s", "--format=%ct", ref)
+	if err != nil {
+		return time.Time{}, err
+	}
+	seconds, err := strconv.ParseInt(out, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(seconds, 0), nil
+}
+
 // GetCommitMessage returns the message stored in the commit pointed to by the given ref.
 func GetCommitMessage(ref string) string {
 	return runGitCommandOrDie("show", "-s", "--format=%B", ref)
 }
 
+// StoreBlob writes the given contents to the object database as a blob, and returns its hash.
+func StoreBlob(contents string) (string, error) {
+	return runGitCommandWithInput(contents, "hash-object", "-w", "--stdin")
+}
+
+// CreateTag creates an annotated tag with the given name, pointing to the given object.
+//
+// If sign is true, then the tag is signed using the user's default GPG key.
+func CreateTag(name, object, message string, sign bool) error {
+	args := []string{"tag", "-F", "-"}
+	if sign {
+		args = append(args, "-s")
+	}
+	args = append(args, name, object)
+	if _, err := runGitCommandWithInput(message, args...); err != nil {
+		return fmt.Errorf("Failed to create the tag %q: %v", name, err)
+	}
+	return nil
+}
+
 // IsAncestor determins if the first argument points to a commit that is an ancestor of the second.
 func IsAncestor(ancestor, descendant string) bool {
 	_, err := runGitCommand("merge-base", "--is-ancestor", ancestor, descendant)
 	if err == nil {
 		return true
 	}
-	if _, ok := err.(*exec.ExitError); ok {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
 		return false
 	}
 	log.Fatal(err)
 	return false
 }
 
+// ErrShallowHistory is returned when a question about the commit graph cannot
+// be answered because the repository is a shallow clone, and the commits needed
+// to answer it have not been fetched.
+var ErrShallowHistory = errors.New("The repository is a shallow clone, and is missing the history needed to determine this.")
+
+// shallowCommits caches the set of commits at the boundary of a shallow clone.
+var (
+	shallowCommits map[string]bool
+	shallowMutex   sync.Mutex
+)
+
+// resetShallowCommits forgets the cached set of shallow commits, e.g. after switching repositories.
+func resetShallowCommits() {
+	shallowMutex.Lock()
+	shallowCommits = nil
+	shallowMutex.Unlock()
+}
+
+// getShallowCommits returns the set of commits at the boundary of a shallow clone.
+//
+// The set is empty if the repository is not a shallow clone.
+func getShallowCommits() map[string]bool {
+	shallowMutex.Lock()
+	defer shallowMutex.Unlock()
+	if shallowCommits != nil {
+		return shallowCommits
+	}
+	shallowCommits = make(map[string]bool)
+	contents, err := ioutil.ReadFile(filepath.Join(GetGitDir(), "shallow"))
+	if err != nil {
+		// There is no shallow file, so this is a complete clone.
+		return shallowCommits
+	}
+	for _, commit := range strings.Split(string(contents), "\n") {
+		if commit = strings.TrimSpace(commit); commit != "" {
+			shallowCommits[commit] = true
+		}
+	}
+	return shallowCommits
+}
+
+// IsShallow returns true if the repository is a shallow clone.
+func IsShallow() bool {
+	return len(getShallowCommits()) > 0
+}
+
+// Unshallow fetches the complete history from the given remote, converting a shallow clone into a complete one.
+func Unshallow(remote string) error {
+	if err := runGitCommandInline("fetch", "--unshallow", remote); err != nil {
+		return fmt.Errorf("Failed to fetch the complete history from '%s': %v", remote, err)
+	}
+	resetShallowCommits()
+	return nil
+}
+
+// reachesShallowBoundary returns true if walking the history of the given
+// revision range (in the syntax accepted by "git rev-list") runs into the
+// boundary of a shallow clone, meaning that the walk may have been cut short.
+func reachesShallowBoundary(revisions ...string) bool {
+	shallow := getShallowCommits()
+	if len(shallow) == 0 {
+		return false
+	}
+	out, err := runGitCommand(append([]string{"rev-list"}, revisions...)...)
+	if err != nil {
+		// One of the revisions does not exist, which is not due to the clone being shallow.
+		return false
+	}
+	for _, commit := range strings.Split(out, "\n") {
+		if shallow[commit] {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckAncestor determines if the first argument points to a commit that is an ancestor of the second.
+//
+// Unlike IsAncestor, this reports an ErrShallowHistory error rather than a
+// (possibly wrong) negative answer when the repository is a shallow clone
+// and the commits needed to confirm the answer are missing.
+func CheckAncestor(ancestor, descendant string) (bool, error) {
+	if IsAncestor(ancestor, descendant) {
+		return true, nil
+	}
+	if !IsShallow() {
+		return false, nil
+	}
+	if _, err := runGitCommand("cat-file", "-e", ancestor+"^{commit}"); err != nil {
+		return false, ErrShallowHistory
+	}
+	if reachesShallowBoundary(descendant, "--not", ancestor) {
+		return false, ErrShallowHistory
+	}
+	return false, nil
+}
+
 // SwitchToRef changes the currently-checked-out ref.
 func SwitchToRef(ref string) {
 	// If the ref starts with "refs/heads/", then we have to trim that prefix,
@@ -157,6 +529,28 @@ func MergeRef(ref string, fastForward bool) {
 	runGitCommandInlineOrDie(args...)
 }
 
+// SquashRef squashes the changes in the given ref into a single new commit on the current one.
+func SquashRef(ref, message string) error {
+	if err := runGitCommandInline("merge", "--squash", ref); err != nil {
+		return fmt.Errorf("Failed to squash %q: %v", ref, err)
+	}
+	if _, err := runGitCommandWithInput(message, "commit", "--file=-"); err != nil {
+		return fmt.Errorf("Failed to commit the squashed changes: %v", err)
+	}
+	return nil
+}
+
+// RebaseBranch rebases the given branch onto the given ref, leaving the branch checked out.
+//
+// Notes are not copied to the rebased commits, even if "notes.rewriteRef" is set.
+func RebaseBranch(branch, onto string) error {
+	branch = strings.TrimPrefix(branch, branchRefPrefix)
+	if err := DefaultRunner.WithEnv("GIT_NOTES_REWRITE_REF=").RunInline("rebase", onto, branch); err != nil {
+		return fmt.Errorf("Failed to rebase %q onto %q: %v", branch, onto, err)
+	}
+	return nil
+}
+
 // RebaseRef rebases the given ref into the current one.
 func RebaseRef(ref string) {
 	runGitCommandInlineOrDie("rebase", "-i", ref)
@@ -170,6 +564,9 @@ func RebaseRef(ref string) {
 // merge base of the two is used as the starting point.
 //
 // The generated list is in chronological order (with the oldest commit first).
+//
+// In a shallow clone, the list may be cut short at the boundary of the
+// fetched history; use CheckCommitsBetween to detect that.
 func ListCommitsBetween(from, to string) []string {
 	out := runGitCommandOrDie("rev-list", "--reverse", "--ancestry-path", from+".."+to)
 	if out == "" {
@@ -178,6 +575,30 @@ func ListCommitsBetween(from, to string) []string {
 	return strings.Split(out, "\n")
 }
 
+// HasObject reports whether the object with the given hash exists in the repository.
+func HasObject(hash string) bool {
+	_, err := runGitCommand("cat-file", "-e", hash)
+	return err == nil
+}
+
+// VerifyCommit checks the GPG or SSH signature of the given commit with "git
+// verify-commit", returning an error if the commit is unsigned or its
+// signature is not valid.
+func VerifyCommit(commit string) error {
+	_, err := runGitCommand("verify-commit", commit)
+	return err
+}
+
+// CheckCommitsBetween returns an ErrShallowHistory error if the list of
+// commits returned by ListCommitsBetween for the same arguments could be
+// incomplete because the repository is a shallow clone.
+func CheckCommitsBetween(from, to string) error {
+	if reachesShallowBoundary(to, "--not", from) {
+		return ErrShallowHistory
+	}
+	return nil
+}
+
 // GetNotes uses the "git" command-line tool to read the notes from the given ref for a given revision.
 func GetNotes(notesRef, revision string) []Note {
 	var notes []Note
@@ -197,6 +618,27 @@ func AppendNote(notesRef, revision string, note Note) {
 	runGitCommandOrDie("notes", "--ref", notesRef, "append", "-m", string(note), revision)
 }
 
+// AppendNotes appends several notes to each of the given revisions under the given ref.
+//
+// The notes for each revision are appended together, with a single git command.
+func AppendNotes(notesRef string, notes map[string][]Note) error {
+	for revision, revisionNotes := range notes {
+		var lines []string
+		for _, note := range revisionNotes {
+			lines = append(lines, string(note))
+		}
+		if _, err := runGitCommand("notes", "--ref", notesRef, "append", "-m", strings.Join(lines, "\n"), revision); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RemoveNotes removes all of the notes from a revision under the given ref.
+func RemoveNotes(notesRef, revision string) {
+	runGitCommandOrDie("notes", "--ref", notesRef, "remove", revision)
+}
+
 // ListNotedRevisions returns the collection of revisions that are annotated by notes in the given ref.
 func ListNotedRevisions(notesRef string) []string {
 	var revisions []string
@@ -216,20 +658,376 @@ func ListNotedRevisions(notesRef string) []string {
 	return revisions
 }
 
+// ErrStopIteration may be returned by the callback passed to ForEachNote in
+// order to stop the iteration early without reporting an error.
+var ErrStopIteration = errors.New("Iteration stopped")
+
+// ForEachNote calls the given function on each of the notes stored under the given ref.
+//
+// Notes are streamed from git as they are read rather than being loaded into
+// memory up front. Only notes on commits are included, and all of the notes
+// for a revision are passed consecutively, in the order in which they are stored.
+//
+// If the function returns an error, the iteration stops and that error is
+// returned, unless it is ErrStopIteration, in which case nil is returned.
+func ForEachNote(notesRef string, f func(revision string, note Note) error) error {
+	listArgs := []string{"notes", "--ref", notesRef, "list"}
+	list := DefaultRunner.Command(listArgs...)
+	listOut, err := list.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	if err := list.Start(); err != nil {
+		return err
+	}
+	defer func() {
+		DefaultRunner.trace(listArgs, start, list.Wait())
+	}()
+	defer listOut.Close()
+
+	batch, err := newCatFileBatch()
+	if err != nil {
+		return err
+	}
+	defer batch.Close()
+
+	notePairs := bufio.NewScanner(listOut)
+	for notePairs.Scan() {
+		noteParts := strings.SplitN(notePairs.Text(), " ", 2)
+		if len(noteParts) != 2 {
+			continue
+		}
+		// If a note points to an object that we do not know about (yet), then we
+		// can safely just ignore it, just like ListNotedRevisions does.
+		objType, _, err := batch.Read(noteParts[1])
+		if err != nil {
+			return err
+		}
+		if objType != "commit" {
+			continue
+		}
+		_, contents, err := batch.Read(noteParts[0])
+		if err != nil {
+			return err
+		}
+		for _, line := range strings.Split(strings.TrimRight(string(contents), "\n"), "\n") {
+			if err := f(noteParts[1], Note(line)); err != nil {
+				if err == ErrStopIteration {
+					return nil
+				}
+				return err
+			}
+		}
+	}
+	return notePairs.Err()
+}
+
+// GetAllNotes returns all of the notes in the given ref, keyed by the revision they annotate.
+//
+// Unlike calling GetNotes for each revision, this only runs one "git notes
+// list" and one "git cat-file --batch" process. Notes on objects other than
+// commits are skipped.
+func GetAllNotes(notesRef string) (map[string][]Note, error) {
+	notes := make(map[string][]Note)
+	err := ForEachNote(notesRef, func(revision string, note Note) error {
+		notes[revision] = append(notes[revision], note)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return notes, nil
+}
+
+// catFileBatch reads git objects using a long-running "git cat-file --batch" process.
+type catFileBatch struct {
+	cmd    *exec.Cmd
+	input  io.WriteCloser
+	output *bufio.Reader
+	start  time.Time
+}
+
+func newCatFileBatch() (*catFileBatch, error) {
+	cmd := DefaultRunner.Command("cat-file", "--batch")
+	input, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	output, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &catFileBatch{cmd, input, bufio.NewReader(output), time.Now()}, nil
+}
+
+// Read returns the type and contents of the given object.
+//
+// If the object does not exist, then the returned type is empty.
+func (b *catFileBatch) Read(object string) (string, []byte, error) {
+	if _, err := fmt.Fprintln(b.input, object); err != nil {
+		return "", nil, err
+	}
+	header, err := b.output.ReadString('\n')
+	if err != nil {
+		return "", nil, err
+	}
+	headerParts := strings.Fields(header)
+	if len(headerParts) != 3 {
+		// The object is missing.
+		return "", nil, nil
+	}
+	size, err := strconv.Atoi(headerParts[2])
+	if err != nil {
+		return "", nil, err
+	}
+	// The contents are followed by a newline.
+	contents := make([]byte, size+1)
+	if _, err := io.ReadFull(b.output, contents); err != nil {
+		return "", nil, err
+	}
+	return headerParts[1], contents[:size], nil
+}
+
+// Close stops the underlying git process.
+func (b *catFileBatch) Close() error {
+	b.input.Close()
+	err := b.cmd.Wait()
+	DefaultRunner.trace(b.cmd.Args[1:], b.start, err)
+	return err
+}
+
+// ListRefs returns the names of all of the refs matching the given pattern.
+func ListRefs(pattern string) []string {
+	out := runGitCommandOrDie("for-each-ref", "--format=%(refname)", pattern)
+	if out == "" {
+		return nil
+	}
+	return strings.Split(out, "\n")
+}
+
+// ListNotedObjects returns the hashes of all objects (of any type) that are annotated by notes in the given ref.
+func ListNotedObjects(notesRef string) []string {
+	var objects []string
+	for _, notePair := range strings.Split(runGitCommandOrDie("notes", "--ref", notesRef, "list"), "\n") {
+		noteParts := strings.SplitN(notePair, " ", 2)
+		if len(noteParts) == 2 {
+			objects = append(objects, noteParts[1])
+		}
+	}
+	return objects
+}
+
+// GetNoteBlobs returns the hash of the blob holding the notes of each object
+// annotated in the given ref, keyed by the object.
+//
+// The blob changes whenever the object's notes do, so it identifies them
+// without reading them.
+func GetNoteBlobs(notesRef string) (map[string]string, error) {
+	out, err := runGitCommand("notes", "--ref", notesRef, "list")
+	if err != nil {
+		return nil, err
+	}
+	blobs := make(map[string]string)
+	for _, notePair := range strings.Split(out, "\n") {
+		noteParts := strings.SplitN(notePair, " ", 2)
+		if len(noteParts) == 2 {
+			blobs[noteParts[1]] = noteParts[0]
+		}
+	}
+	return blobs, nil
+}
+
+// RewriteNotes replaces the notes for the given objects under the given ref.
+//
+// All of the replacements are recorded in a single commit on top of the
+// existing notes history (creating the ref if it does not yet exist), and
+// the ref is only updated if it has not moved while the new commit was
+// being built.
+func RewriteNotes(notesRef string, notes map[string][]Note, message string) error {
+	if len(notes) == 0 {
+		return nil
+	}
+	indexFile, err := ioutil.TempFile("", "appraise-index")
+	if err != nil {
+		return err
+	}
+	indexFile.Close()
+	defer os.Remove(indexFile.Name())
+	env := []string{"GIT_INDEX_FILE=" + indexFile.Name()}
+
+	// Notes trees may split object hashes into fanout directories, so we need
+	// to look up the existing path for each annotated object.
+	paths := make(map[string]string)
+	parent, err := runGitCommand("rev-parse", "--verify", "--quiet", notesRef)
+	if err == nil {
+		entries, err := runGitCommand("ls-tree", "-r", "--full-tree", parent)
+		if err != nil {
+			return err
+		}
+		for _, entry := range strings.Split(entries, "\n") {
+			entryParts := strings.SplitN(entry, "\t", 2)
+			if len(entryParts) == 2 {
+				paths[strings.Replace(entryParts[1], "/", "", -1)] = entryParts[1]
+			}
+		}
+		if _, err := runGitCommandWithEnv(env, "read-tree", parent); err != nil {
+			return err
+		}
+	} else {
+		parent = ""
+		if _, err := runGitCommandWithEnv(env, "read-tree", "--empty"); err != nil {
+			return err
+		}
+	}
+
+	for object, objectNotes := range notes {
+		path, ok := paths[object]
+		if !ok {
+			path = object
+		}
+		var lines []string
+		for _, note := range objectNotes {
+			lines = append(lines, string(note))
+		}
+		blob, err := StoreBlob(strings.Join(lines, "\n") + "\n")
+		if err != nil {
+			return err
+		}
+		if _, err := runGitCommandWithEnv(env, "update-index", "--add", "--cacheinfo", "100644,"+blob+","+path); err != nil {
+			return err
+		}
+	}
+	tree, err := runGitCommandWithEnv(env, "write-tree")
+	if err != nil {
+		return err
+	}
+	commitArgs := []string{"commit-tree", tree}
+	if parent != "" {
+		commitArgs = append(commitArgs, "-p", parent)
+	}
+	commit, err := runGitCommandWithInput(message, commitArgs...)
+	if err != nil {
+		return err
+	}
+	if _, err := runGitCommand("update-ref", notesRef, commit, parent); err != nil {
+		return fmt.Errorf("Failed to update the notes ref %q: %v", notesRef, err)
+	}
+	return nil
+}
+
+// MergeNotes adds the given notes to the ones already stored for each object under the given ref.
+//
+// Notes that are already present are skipped, mirroring the "cat_sort_uniq"
+// merge strategy. If a key function is given, then notes with the same key are
+// considered the same, and otherwise notes are compared by their contents.
+// The number of notes that were added is returned.
+func MergeNotes(notesRef string, notes map[string][]Note, message string, key func(Note) string) (int, error) {
+	if key == nil {
+		key = func(note Note) string { return string(note) }
+	}
+	var added int
+	updated := make(map[string][]Note)
+	for object, objectNotes := range notes {
+		existing := GetNotes(notesRef, object)
+		present := make(map[string]bool)
+		for _, note := range existing {
+			present[key(note)] = true
+		}
+		merged := existing
+		for _, note := range objectNotes {
+			if !present[key(note)] {
+				present[key(note)] = true
+				merged = append(merged, note)
+				added++
+			}
+		}
+		if len(merged) > len(existing) {
+			updated[object] = merged
+		}
+	}
+	return added, RewriteNotes(notesRef, updated, message)
+}
+
+// CreateNotesBundle writes all of the notes refs matching the given pattern to a bundle file.
+func CreateNotesBundle(bundleFile, notesRefPattern string) error {
+	refs := ListRefs(notesRefPattern)
+	if refs == nil {
+		return fmt.Errorf("There are no notes matching %q to bundle", notesRefPattern)
+	}
+	args := append([]string{"bundle", "create", bundleFile}, refs...)
+	if err := runGitCommandInline(args...); err != nil {
+		return fmt.Errorf("Failed to create the bundle %q: %v", bundleFile, err)
+	}
+	return nil
+}
+
+// mapRef translates a ref matching one pattern into the corresponding ref matching another.
+//
+// Both patterns are expected to end with a single trailing "*".
+func mapRef(ref, fromPattern, toPattern string) string {
+	return strings.TrimSuffix(toPattern, "*") + strings.TrimPrefix(ref, strings.TrimSuffix(fromPattern, "*"))
+}
+
+// ErrNotesPushRejected is returned when pushing notes fails because the remote's
+// notes have changed since they were last pulled.
+var ErrNotesPushRejected = errors.New("The remote's notes have changed since they were last pulled")
+
 // PushNotes pushes git notes to a remote repo.
-func PushNotes(remote, notesRefPattern string) error {
-	refspec := fmt.Sprintf("%s:%s", notesRefPattern, notesRefPattern)
+//
+// The notes refs matching the local pattern are pushed to the corresponding
+// refs matching the remote pattern, which allows the remote to store them
+// under a different namespace.
+//
+// If the push was rejected because it was not a fast-forward, then
+// ErrNotesPushRejected is returned.
+func PushNotes(remote, notesRefPattern, remoteNotesRefPattern string) error {
+	refspec := fmt.Sprintf("%s:%s", notesRefPattern, remoteNotesRefPattern)
 
 	// The push is liable to fail if the user forgot to do a pull first, so
 	// we treat errors as user errors rather than fatal errors.
-	err := runGitCommandInline("push", remote, refspec)
-	if err != nil {
-		return fmt.Errorf("Failed to push to the remote '%s': %v", remote, err)
+	args := []string{"-c", "advice.pushUpdateRejected=false", "push", "--porcelain", remote, refspec}
+	cmd := DefaultRunner.Command(args...)
+	cmd.Stderr = os.Stderr
+	start := time.Now()
+	out, err := cmd.Output()
+	DefaultRunner.trace(args, start, err)
+	if err == nil {
+		return nil
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		if strings.HasPrefix(line, "!") && (strings.Contains(line, "non-fast-forward") || strings.Contains(line, "fetch first")) {
+			return ErrNotesPushRejected
+		}
+	}
+	return fmt.Errorf("Failed to push to the remote '%s': %v", remote, err)
+}
+
+// PushNotesWithRetry pushes git notes to a remote repo, and if the push is
+// rejected, pulls and merges the remote's notes before trying again.
+//
+// At most the given number of retries are attempted.
+func PushNotesWithRetry(remote, notesRefPattern, remoteNotesRefPattern string, retries int) error {
+	for attempt := 0; ; attempt++ {
+		err := PushNotes(remote, notesRefPattern, remoteNotesRefPattern)
+		if err != ErrNotesPushRejected {
+			return err
+		}
+		if attempt >= retries {
+			return fmt.Errorf("Failed to push to the remote '%s' after %d retries: %v", remote, retries, err)
+		}
+		fmt.Fprintf(os.Stderr, "The notes in '%s' have changed; merging them and retrying the push.\n", remote)
+		if err := PullNotes(remote, notesRefPattern, remoteNotesRefPattern); err != nil {
+			return err
+		}
 	}
-	return nil
 }
 
-func getRemoteNotesRef(remote, localNotesRef string) string {
+// GetRemoteNotesRef returns the local ref used to track the given notes ref from a remote.
+func GetRemoteNotesRef(remote, localNotesRef string) string {
 	relativeNotesRef := strings.TrimPrefix(localNotesRef, "refs/notes/")
 	return "refs/notes/" + remote + "/" + relativeNotesRef
 }
@@ -237,18 +1035,231 @@ func getRemoteNotesRef(remote, localNotesRef string) string {
 // PullNotes fetches the contents of the given notes ref from a remote repo,
 // and then merges them with the corresponding local notes using the
 // "cat_sort_uniq" strategy.
-func PullNotes(remote, notesRefPattern string) {
-	remoteNotesRefPattern := getRemoteNotesRef(remote, notesRefPattern)
-	fetchRefSpec := fmt.Sprintf("+%s:%s", notesRefPattern, remoteNotesRefPattern)
-	runGitCommandInlineOrDie("fetch", remote, fetchRefSpec)
+//
+// The remote pattern specifies where the remote stores the notes that
+// correspond to the local pattern.
+func PullNotes(remote, notesRefPattern, remoteNotesRefPattern string) error {
+	return importNotes(remote, remote, notesRefPattern, remoteNotesRefPattern)
+}
 
-	remoteRefs := runGitCommandOrDie("ls-remote", remote, notesRefPattern)
+// ImportNotes fetches the contents of the given notes ref from any location
+// understood by "git fetch" (such as a remote name, a URL, or a bundle file),
+// and then merges them with the corresponding local notes using the
+// "cat_sort_uniq" strategy.
+//
+// The fetched notes are tracked locally under the given name, as if it was a remote.
+func ImportNotes(location, name, notesRefPattern string) error {
+	return importNotes(location, name, notesRefPattern, notesRefPattern)
+}
+
+func importNotes(location, name, notesRefPattern, remoteNotesRefPattern string) error {
+	refs, err := fetchNotes(location, name, notesRefPattern, remoteNotesRefPattern)
+	if err != nil {
+		return err
+	}
+	for _, ref := range refs {
+		trackingRef := GetRemoteNotesRef(name, ref)
+		if IsAncestor(trackingRef, ref) {
+			// The notes were already merged after an earlier fetch.
+			continue
+		}
+		if _, err := runGitCommand("notes", "--ref", ref, "merge", trackingRef, "-s", "cat_sort_uniq"); err != nil {
+			return fmt.Errorf("Failed to merge the notes from %q into %q: %v", trackingRef, ref, err)
+		}
+	}
+	return nil
+}
+
+// GetRefTips returns the commit that each ref matching the given pattern points to, keyed by the ref.
+func GetRefTips(pattern string) map[string]string {
+	tips := make(map[string]string)
+	out, err := runGitCommand("for-each-ref", "--format=%(objectname) %(refname)", pattern)
+	if err != nil || out == "" {
+		return tips
+	}
+	for _, line := range strings.Split(out, "\n") {
+		if parts := strings.SplitN(line, " ", 2); len(parts) == 2 {
+			tips[parts[1]] = parts[0]
+		}
+	}
+	return tips
+}
+
+// fetchNotes fetches the notes matching the given pattern into the refs used to track them locally.
+//
+// The tracking refs record the tips of the remote refs as of the last fetch,
+// so only the remote refs whose tips have changed since then are fetched, and
+// nothing is fetched if none of them have.
+//
+// The local notes refs corresponding to all of the remote ones are returned.
+func fetchNotes(location, name, notesRefPattern, remoteNotesRefPattern string) ([]string, error) {
+	remoteRefs, err := runGitCommand("ls-remote", location, remoteNotesRefPattern)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list the notes in '%s': %v", location, err)
+	}
+	trackingTips := GetRefTips(GetRemoteNotesRef(name, notesRefPattern))
+	var refs, fetchRefSpecs []string
 	for _, line := range strings.Split(remoteRefs, "\n") {
 		lineParts := strings.Split(line, "\t")
-		if len(lineParts) == 2 {
-			ref := lineParts[1]
-			remoteRef := getRemoteNotesRef(remote, ref)
-			runGitCommandOrDie("notes", "--ref", ref, "merge", remoteRef, "-s", "cat_sort_uniq")
+		if len(lineParts) != 2 {
+			continue
+		}
+		ref := mapRef(lineParts[1], remoteNotesRefPattern, notesRefPattern)
+		refs = append(refs, ref)
+		trackingRef := GetRemoteNotesRef(name, ref)
+		if trackingTips[trackingRef] != lineParts[0] {
+			fetchRefSpecs = append(fetchRefSpecs, fmt.Sprintf("+%s:%s", lineParts[1], trackingRef))
+		}
+	}
+	if len(fetchRefSpecs) > 0 {
+		args := append([]string{"fetch", location}, fetchRefSpecs...)
+		if err := runGitCommandInline(args...); err != nil {
+			return nil, fmt.Errorf("Failed to fetch from '%s': %v", location, err)
 		}
 	}
+	return refs, nil
+}
+
+// NotesDifference describes how the notes in a local ref differ from those fetched from a remote.
+type NotesDifference struct {
+	Ref string
+	// Incoming and Outgoing hold, for each annotated object, the notes only
+	// present in the remote and only present locally, respectively.
+	Incoming map[string][]Note
+	Outgoing map[string][]Note
+}
+
+// diffNotes returns the notes that are in the first ref but not in the second, grouped by object.
+//
+// Either ref may be empty, which stands for a ref without any notes.
+func diffNotes(notesRef, otherNotesRef string) map[string][]Note {
+	diff := make(map[string][]Note)
+	if notesRef == "" {
+		return diff
+	}
+	for _, object := range ListNotedObjects(notesRef) {
+		present := make(map[string]bool)
+		if otherNotesRef != "" {
+			for _, note := range GetNotes(otherNotesRef, object) {
+				present[string(note)] = true
+			}
+		}
+		for _, note := range GetNotes(notesRef, object) {
+			// "git notes append" separates notes with blank lines, which carry no data.
+			if len(note) > 0 && !present[string(note)] {
+				present[string(note)] = true
+				diff[object] = append(diff[object], note)
+			}
+		}
+	}
+	return diff
+}
+
+// CompareRemoteNotes fetches the notes from a remote repo, and reports how
+// they differ from the local notes without modifying the local notes.
+func CompareRemoteNotes(remote, notesRefPattern, remoteNotesRefPattern string) ([]NotesDifference, error) {
+	remoteRefs, err := fetchNotes(remote, remote, notesRefPattern, remoteNotesRefPattern)
+	if err != nil {
+		return nil, err
+	}
+	refs := ListRefs(notesRefPattern)
+	local := make(map[string]bool)
+	for _, ref := range refs {
+		local[ref] = true
+	}
+	fetched := make(map[string]bool)
+	for _, ref := range remoteRefs {
+		fetched[ref] = true
+		if !local[ref] {
+			refs = append(refs, ref)
+		}
+	}
+	var differences []NotesDifference
+	for _, ref := range refs {
+		// Tracking refs are not removed when the remote ref is, so we ignore
+		// the ones that the remote no longer has.
+		trackingRef := ""
+		if fetched[ref] {
+			trackingRef = GetRemoteNotesRef(remote, ref)
+		}
+		localRef := ""
+		if local[ref] {
+			localRef = ref
+		}
+		differences = append(differences, NotesDifference{
+			Ref:      ref,
+			Incoming: diffNotes(trackingRef, localRef),
+			Outgoing: diffNotes(localRef, trackingRef),
+		})
+	}
+	return differences, nil
+}
+
+// ListRemotes returns the names of all of the remotes configured for the repository.
+func ListRemotes() []string {
+	out := runGitCommandOrDie("remote")
+	if out == "" {
+		return nil
+	}
+	return strings.Split(out, "\n")
+}
+
+// FetchRefs fetches the given refspecs from a remote repo.
+func FetchRefs(remote string, refspecs ...string) error {
+	args := append([]string{"fetch", "--quiet", remote}, refspecs...)
+	_, err := runGitCommand(args...)
+	return err
+}
+
+// GetRemoteURL returns the URL of the given remote, or an empty string if it has none.
+func GetRemoteURL(remote string) string {
+	return GetConfig("remote." + remote + ".url")
+}
+
+// SendEmail sends the messages in the given mbox file with "git send-email",
+// which uses the repository's "sendemail.*" config settings.
+func SendEmail(mboxPath string) error {
+	return runGitCommandInline("send-email", "--confirm=never", "--quiet", mboxPath)
+}
+
+// CommitPatch creates a commit applying the given patch to the parent commit,
+// with the given message, author, and date, and returns its hash.
+//
+// The patch is applied using a temporary index, so that the working tree and
+// the real index are left alone. The commit date is also the given date, so
+// that committing the same patch again yields the same commit.
+func CommitPatch(parent, patch, message, authorName, authorEmail string, date time.Time) (string, error) {
+	indexFile, err := ioutil.TempFile(GetGitDir(), "appraise-index")
+	if err != nil {
+		return "", err
+	}
+	indexPath := indexFile.Name()
+	indexFile.Close()
+	defer os.Remove(indexPath)
+	timestamp := fmt.Sprintf("%d %s", date.Unix(), date.Format("-0700"))
+	runner := DefaultRunner.WithEnv(
+		"GIT_INDEX_FILE="+indexPath,
+		"GIT_AUTHOR_NAME="+authorName,
+		"GIT_AUTHOR_EMAIL="+authorEmail,
+		"GIT_AUTHOR_DATE="+timestamp,
+		"GIT_COMMITTER_DATE="+timestamp)
+	if _, err := runner.Run("read-tree", parent); err != nil {
+		return "", err
+	}
+	if _, err := runner.RunWithInput(strings.NewReader(patch), "apply", "--cached", "-"); err != nil {
+		return "", fmt.Errorf("The patch does not apply: %v", err)
+	}
+	tree, err := runner.Run("write-tree")
+	if err != nil {
+		return "", err
+	}
+	return runner.RunWithInput(strings.NewReader(message+"\n"), "commit-tree", tree, "-p", parent)
+}
+
+// CreateRef creates a ref pointing to the given commit, failing if the ref already exists.
+func CreateRef(ref, commit string) error {
+	if _, err := runGitCommand("update-ref", ref, commit, ""); err != nil {
+		return fmt.Errorf("Failed to create the ref %q: %v", ref, err)
+	}
+	return nil
 }
@@ -0,0 +1,154 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// testNotesRef is the notes ref that the tests annotate commits under.
+const testNotesRef = "refs/notes/devtools/test"
+
+// git runs the given git command in the current directory, failing the test if it fails.
+func git(t *testing.T, input string, args ...string) string {
+	cmd := exec.Command("git", args...)
+	cmd.Stdin = strings.NewReader(input)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// initTestRepo creates an empty repository in a temporary directory, and
+// makes it the current one for the rest of the test.
+func initTestRepo(t *testing.T) {
+	t.Chdir(t.TempDir())
+	// Restored after the test by Setenv.
+	t.Setenv("GIT_DIR", "")
+	os.Unsetenv("GIT_DIR")
+	t.Setenv("GIT_CONFIG_GLOBAL", "/dev/null")
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	git(t, "", "init", "--quiet")
+	git(t, "", "config", "user.name", "Test")
+	git(t, "", "config", "user.email", "test@example.com")
+}
+
+// addNotedCommits adds a history of the given number of commits, each with a
+// note under testNotesRef, and returns the commits in order.
+//
+// The notes are written with "git fast-import", which splits the notes tree
+// into fanout directories once there are enough notes, as "git notes" does.
+func addNotedCommits(t *testing.T, count int) []string {
+	var stream strings.Builder
+	for i := 1; i <= count; i++ {
+		fmt.Fprintf(&stream, "commit refs/heads/master\nmark :%d\ncommitter Test <test@example.com> %d +0000\ndata <<EOF\nCommit %d\nEOF\n", i, i, i)
+		if i > 1 {
+			fmt.Fprintf(&stream, "from :%d\n", i-1)
+		}
+	}
+	fmt.Fprintf(&stream, "commit %s\ncommitter Test <test@example.com> 0 +0000\ndata <<EOF\nNotes\nEOF\n", testNotesRef)
+	for i := 1; i <= count; i++ {
+		fmt.Fprintf(&stream, "N inline :%d\ndata <<EOF\nnote %d\nEOF\n", i, i)
+	}
+	git(t, stream.String(), "fast-import", "--quiet")
+	commits := strings.Split(git(t, "", "rev-list", "--reverse", "master"), "\n")
+	if len(commits) != count {
+		t.Fatalf("Expected %d commits, got %d", count, len(commits))
+	}
+	return commits
+}
+
+func TestForEachNoteStopsEarly(t *testing.T) {
+	initTestRepo(t)
+	// Enough notes that listing them fills the pipe from "git notes list".
+	addNotedCommits(t, 2000)
+
+	var calls int
+	err := ForEachNote(testNotesRef, func(revision string, note Note) error {
+		calls++
+		return ErrStopIteration
+	})
+	if err != nil || calls != 1 {
+		t.Fatalf("Expected the iteration to stop after the first note without an error, got %d calls and %v", calls, err)
+	}
+
+	failure := errors.New("failure")
+	calls = 0
+	err = ForEachNote(testNotesRef, func(revision string, note Note) error {
+		calls++
+		if calls == 3 {
+			return failure
+		}
+		return nil
+	})
+	if err != failure || calls != 3 {
+		t.Fatalf("Expected the iteration to stop with the callback's error after 3 notes, got %d calls and %v", calls, err)
+	}
+}
+
+func TestFanoutNotes(t *testing.T) {
+	initTestRepo(t)
+	commits := addNotedCommits(t, 500)
+	if tree := git(t, "", "ls-tree", testNotesRef); !strings.HasPrefix(tree, "040000 tree ") {
+		t.Fatalf("Expected the notes to be split into fanout directories, got:\n%s", tree)
+	}
+
+	notes := make(map[string]string)
+	err := ForEachNote(testNotesRef, func(revision string, note Note) error {
+		notes[revision] = string(note)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(notes) != len(commits) {
+		t.Fatalf("Expected a note on each of the %d commits, got %d", len(commits), len(notes))
+	}
+	for i, commit := range commits {
+		if expected := fmt.Sprintf("note %d", i+1); notes[commit] != expected {
+			t.Fatalf("Unexpected note on commit %d: %q", i+1, notes[commit])
+		}
+	}
+	blobs, err := GetNoteBlobs(testNotesRef)
+	if err != nil || len(blobs) != len(commits) {
+		t.Fatalf("Expected a note blob for each commit, got %d, %v", len(blobs), err)
+	}
+
+	// Rewriting the notes of a commit replaces them in its fanout directory.
+	if err := RewriteNotes(testNotesRef, map[string][]Note{commits[0]: {Note("rewritten")}}, "Rewrite"); err != nil {
+		t.Fatal(err)
+	}
+	if notes := GetNotes(testNotesRef, commits[0]); len(notes) != 1 || string(notes[0]) != "rewritten" {
+		t.Fatalf("Unexpected notes after rewriting them: %q", notes)
+	}
+	var entries int
+	err = ForEachNote(testNotesRef, func(revision string, note Note) error {
+		if revision == commits[0] {
+			entries++
+		}
+		return nil
+	})
+	if err != nil || entries != 1 {
+		t.Fatalf("Expected the rewritten notes to replace the old ones, got %d entries, %v", entries, err)
+	}
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package repository
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// ErrInterdiffConflict is returned when the changes of one version of a series
+// of commits cannot be replayed onto the base of the other version.
+var ErrInterdiffConflict = errors.New("the changes conflict with those made to the base")
+
+// MergeBase returns the best common ancestor of the two given revisions.
+func MergeBase(first, second string) (string, error) {
+	return runGitCommand("merge-base", first, second)
+}
+
+// GetInterdiff returns the difference between two versions of a series of commits.
+//
+// The from and to parameters are the heads of the two versions, and fromBase
+// and toBase are the commits that they were each based on. If those differ
+// (e.g. because the commits were rebased), then the changes made between the
+// bases are excluded by first replaying the older version onto the newer base.
+func GetInterdiff(fromBase, from, toBase, to string) (string, error) {
+	if fromBase == toBase {
+		return GetDiff(from, to)
+	}
+	patch, err := runGitCommand("diff", "--binary", "--full-index", fromBase, from)
+	if err != nil {
+		return "", err
+	}
+	if patch == "" {
+		return GetDiff(toBase, to)
+	}
+
+	// Replay the older changes using a temporary index, so that the
+	// working tree and the real index are left alone.
+	indexFile, err := ioutil.TempFile(GetGitDir(), "appraise-index")
+	if err != nil {
+		return "", err
+	}
+	indexPath := indexFile.Name()
+	indexFile.Close()
+	defer os.Remove(indexPath)
+	runner := DefaultRunner.WithEnv("GIT_INDEX_FILE=" + indexPath)
+	if _, err := runner.Run("read-tree", toBase); err != nil {
+		return "", err
+	}
+	if _, err := runner.RunWithInput(strings.NewReader(patch+"\n"), "apply", "--cached", "-"); err != nil {
+		return "", ErrInterdiffConflict
+	}
+	replayed, err := runner.Run("write-tree")
+	if err != nil {
+		return "", err
+	}
+	return GetDiff(replayed, to)
+}
+
+// GetRangeDiff compares two versions of a series of commits, commit by commit, using "git range-diff".
+func GetRangeDiff(fromBase, from, toBase, to string) (string, error) {
+	return runGitCommand("range-diff", fromBase+".."+from, toBase+".."+to)
+}
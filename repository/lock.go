@@ -0,0 +1,110 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// lockFileName is the name of the advisory lock file within the git directory.
+	lockFileName = "appraise.lock"
+
+	// lockTimeout is how long to wait for another process to release the lock.
+	lockTimeout = 10 * time.Second
+
+	// lockPollInterval is how often to check whether the lock has been released.
+	lockPollInterval = 100 * time.Millisecond
+
+	// lockMaxAge is the age after which a lock held by a process on another
+	// host, whose liveness cannot be checked, is considered stale.
+	lockMaxAge = time.Hour
+)
+
+// Lock acquires the advisory lock that serializes modifications made by concurrent invocations of the tool.
+//
+// If another process holds the lock, then this waits for it to be released.
+// Locks left behind by processes that are no longer running are removed.
+// The returned function releases the lock.
+func Lock() (func(), error) {
+	lockPath := filepath.Join(GetGitDir(), lockFileName)
+	hostname, _ := os.Hostname()
+	contents := fmt.Sprintf("%d %s\n", os.Getpid(), hostname)
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		lockFile, err := os.OpenFile(lockPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			_, err = lockFile.WriteString(contents)
+			lockFile.Close()
+			if err != nil {
+				os.Remove(lockPath)
+				return nil, err
+			}
+			return func() { os.Remove(lockPath) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		if isStaleLock(lockPath, hostname) {
+			os.Remove(lockPath)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("Another git-appraise process is running. If that is not the case, remove %q.", lockPath)
+		}
+		time.Sleep(lockPollInterval)
+	}
+}
+
+// isStaleLock reports whether the given lock file was left behind by a process that is no longer running.
+func isStaleLock(lockPath, hostname string) bool {
+	info, err := os.Stat(lockPath)
+	if err != nil {
+		// The lock was released while we were looking at it.
+		return false
+	}
+	contents, err := ioutil.ReadFile(lockPath)
+	if err != nil {
+		return false
+	}
+	fields := strings.Fields(string(contents))
+	if len(fields) != 2 {
+		// The owner may not have finished writing the file yet.
+		return time.Since(info.ModTime()) > lockTimeout
+	}
+	pid, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return true
+	}
+	if fields[1] != hostname {
+		return time.Since(info.ModTime()) > lockMaxAge
+	}
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return true
+	}
+	err = process.Signal(syscall.Signal(0))
+	return errors.Is(err, os.ErrProcessDone) || errors.Is(err, syscall.ESRCH)
+}
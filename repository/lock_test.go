@@ -0,0 +1,109 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package repository
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeLock writes a lock file held by the given process on the given host.
+func writeLock(t *testing.T, lockPath string, pid int, hostname string) {
+	if err := ioutil.WriteFile(lockPath, []byte(fmt.Sprintf("%d %s\n", pid, hostname)), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// deadPid returns the pid of a process that has exited.
+func deadPid(t *testing.T) int {
+	cmd := exec.Command("true")
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	return cmd.Process.Pid
+}
+
+func TestLock(t *testing.T) {
+	initTestRepo(t)
+	lockPath := filepath.Join(GetGitDir(), lockFileName)
+	hostname, _ := os.Hostname()
+
+	unlock, err := Lock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(lockPath); err != nil {
+		t.Fatalf("The lock file was not created: %v", err)
+	}
+	unlock()
+	if _, err := os.Stat(lockPath); !os.IsNotExist(err) {
+		t.Fatalf("The lock file was not removed: %v", err)
+	}
+
+	// A lock left behind by a process that is no longer running is reclaimed at once.
+	writeLock(t, lockPath, deadPid(t), hostname)
+	start := time.Now()
+	unlock, err = Lock()
+	if err != nil {
+		t.Fatalf("The stale lock was not reclaimed: %v", err)
+	}
+	if waited := time.Since(start); waited >= lockTimeout {
+		t.Errorf("Reclaiming the stale lock took %v", waited)
+	}
+	unlock()
+}
+
+func TestIsStaleLock(t *testing.T) {
+	initTestRepo(t)
+	lockPath := filepath.Join(GetGitDir(), lockFileName)
+	hostname, _ := os.Hostname()
+
+	writeLock(t, lockPath, os.Getpid(), hostname)
+	if isStaleLock(lockPath, hostname) {
+		t.Errorf("A lock held by a running process was considered stale")
+	}
+	writeLock(t, lockPath, deadPid(t), hostname)
+	if !isStaleLock(lockPath, hostname) {
+		t.Errorf("A lock held by a process that has exited was not considered stale")
+	}
+
+	// The liveness of processes on other hosts cannot be checked, so their locks only expire with age.
+	writeLock(t, lockPath, os.Getpid(), "other-"+hostname)
+	if isStaleLock(lockPath, hostname) {
+		t.Errorf("A recent lock from another host was considered stale")
+	}
+	old := time.Now().Add(-2 * lockMaxAge)
+	if err := os.Chtimes(lockPath, old, old); err != nil {
+		t.Fatal(err)
+	}
+	if !isStaleLock(lockPath, hostname) {
+		t.Errorf("An old lock from another host was not considered stale")
+	}
+
+	// A lock file that is still being written is given time to be finished.
+	if err := ioutil.WriteFile(lockPath, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if isStaleLock(lockPath, hostname) {
+		t.Errorf("A lock file that is being written was considered stale")
+	}
+}
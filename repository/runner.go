@@ -0,0 +1,147 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package repository
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// GitRunner runs git commands, optionally overriding parts of their environment.
+//
+// Empty fields leave the corresponding setting to be inherited from the
+// environment of the review tool.
+type GitRunner struct {
+	// GitDir and WorkTree set GIT_DIR and GIT_WORK_TREE respectively.
+	GitDir   string
+	WorkTree string
+
+	// ConfigFile sets GIT_CONFIG, which is the file read and written by "git config".
+	ConfigFile string
+
+	// The identity used for any commits (including notes commits) that are created.
+	AuthorName     string
+	AuthorEmail    string
+	CommitterName  string
+	CommitterEmail string
+
+	// Env holds any additional "KEY=value" environment variables.
+	Env []string
+
+	// InlineOutput receives the stdout of inline commands, instead of the review tool's stdout.
+	InlineOutput io.Writer
+
+	// Tracer, if set, is called after each git command finishes.
+	Tracer Tracer
+}
+
+// DefaultRunner is the runner used for all of the git commands run by this package.
+var DefaultRunner = &GitRunner{}
+
+// GitError is returned when a git command fails, and includes what the command wrote to stderr.
+type GitError struct {
+	Args   []string
+	Stderr string
+	Err    error
+}
+
+func (e *GitError) Error() string {
+	if e.Stderr == "" {
+		return fmt.Sprintf("git %s: %v", strings.Join(e.Args, " "), e.Err)
+	}
+	return fmt.Sprintf("git %s: %v: %s", strings.Join(e.Args, " "), e.Err, e.Stderr)
+}
+
+// Unwrap returns the underlying error, which is an *exec.ExitError if git ran but failed.
+func (e *GitError) Unwrap() error {
+	return e.Err
+}
+
+// WithEnv returns a copy of the runner with the given additional environment variables.
+func (r *GitRunner) WithEnv(env ...string) *GitRunner {
+	withEnv := *r
+	withEnv.Env = append(append([]string(nil), r.Env...), env...)
+	return &withEnv
+}
+
+// Environ returns the complete environment for running git commands, or any
+// other program that runs git commands on the same repository.
+func (r *GitRunner) Environ() []string {
+	env := os.Environ()
+	overrides := []struct{ name, value string }{
+		{"GIT_DIR", r.GitDir},
+		{"GIT_WORK_TREE", r.WorkTree},
+		{"GIT_CONFIG", r.ConfigFile},
+		{"GIT_AUTHOR_NAME", r.AuthorName},
+		{"GIT_AUTHOR_EMAIL", r.AuthorEmail},
+		{"GIT_COMMITTER_NAME", r.CommitterName},
+		{"GIT_COMMITTER_EMAIL", r.CommitterEmail},
+	}
+	for _, override := range overrides {
+		if override.value != "" {
+			env = append(env, override.name+"="+override.value)
+		}
+	}
+	return append(env, r.Env...)
+}
+
+// Command returns the (not yet started) command for running git with the given arguments.
+func (r *GitRunner) Command(args ...string) *exec.Cmd {
+	cmd := exec.Command("git", args...)
+	cmd.Env = r.Environ()
+	return cmd
+}
+
+// Run runs the given git command and returns its stdout, or an error if the command fails.
+func (r *GitRunner) Run(args ...string) (string, error) {
+	return r.RunWithInput(nil, args...)
+}
+
+// RunWithInput runs the given git command with the given input on stdin, and returns its stdout.
+func (r *GitRunner) RunWithInput(input io.Reader, args ...string) (string, error) {
+	cmd := r.Command(args...)
+	cmd.Stdin = input
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	start := time.Now()
+	out, err := cmd.Output()
+	if err != nil {
+		err = &GitError{Args: args, Stderr: strings.TrimSpace(stderr.String()), Err: err}
+	}
+	r.trace(args, start, err)
+	return strings.Trim(string(out), "\n"), err
+}
+
+// RunInline runs the given git command using the same stdin, stdout, and stderr as the review tool.
+func (r *GitRunner) RunInline(args ...string) error {
+	cmd := r.Command(args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	if r.InlineOutput != nil {
+		cmd.Stdout = r.InlineOutput
+	}
+	cmd.Stderr = os.Stderr
+	start := time.Now()
+	err := cmd.Run()
+	r.trace(args, start, err)
+	return err
+}
@@ -0,0 +1,99 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package repository
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// submoduleMode is the file mode git uses for submodule (gitlink) entries.
+	submoduleMode = "160000"
+
+	// nullCommit is the hash git reports for the missing side of an added or deleted entry.
+	nullCommit = "0000000000000000000000000000000000000000"
+)
+
+// SubmoduleChange describes a submodule whose pointer differs between two commits.
+//
+// OldCommit is empty if the submodule was added, and NewCommit is empty if it was removed.
+type SubmoduleChange struct {
+	Path      string
+	OldCommit string
+	NewCommit string
+}
+
+// ListSubmoduleChanges returns the submodules whose pointers differ between the two given commits.
+func ListSubmoduleChanges(from, to string) ([]SubmoduleChange, error) {
+	out, err := runGitCommand("diff-tree", "-r", "--no-commit-id", from, to)
+	if err != nil {
+		return nil, err
+	}
+	var changes []SubmoduleChange
+	for _, line := range strings.Split(out, "\n") {
+		// Each line is of the form ":<old mode> <new mode> <old hash> <new hash> <status>\t<path>".
+		lineParts := strings.SplitN(line, "\t", 2)
+		if len(lineParts) != 2 {
+			continue
+		}
+		fields := strings.Fields(strings.TrimPrefix(lineParts[0], ":"))
+		if len(fields) != 5 || (fields[0] != submoduleMode && fields[1] != submoduleMode) {
+			continue
+		}
+		change := SubmoduleChange{Path: lineParts[1]}
+		if fields[0] == submoduleMode && fields[2] != nullCommit {
+			change.OldCommit = fields[2]
+		}
+		if fields[1] == submoduleMode && fields[3] != nullCommit {
+			change.NewCommit = fields[3]
+		}
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
+
+// ListSubmoduleCommits returns the one-line summaries of the commits added to a submodule by the given change.
+//
+// This requires the submodule to be checked out, and for its history to
+// include both commits. Otherwise, an error is returned.
+func ListSubmoduleCommits(change SubmoduleChange) ([]string, error) {
+	if change.NewCommit == "" {
+		return nil, nil
+	}
+	revisions := change.NewCommit
+	if change.OldCommit != "" {
+		revisions = change.OldCommit + ".." + change.NewCommit
+	}
+	topLevel, err := runGitCommand("rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, err
+	}
+	out, err := runGitCommand("-C", filepath.Join(topLevel, change.Path), "log", "--oneline", revisions)
+	if err != nil || out == "" {
+		return nil, err
+	}
+	return strings.Split(out, "\n"), nil
+}
+
+// GetDiff returns the diff between the two given commits.
+//
+// Changes to submodules are shown as the diff of the changes made within the
+// submodule when it is checked out, and as the range of commits otherwise.
+func GetDiff(from, to string) (string, error) {
+	return runGitCommand("diff", "--submodule=diff", from, to)
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package repository
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Tracer is notified of each git command run, with how long it took and how it failed (if it did).
+type Tracer func(args []string, duration time.Duration, err error)
+
+// trace reports a finished command to the runner's tracer, if there is one.
+func (r *GitRunner) trace(args []string, start time.Time, err error) {
+	if r.Tracer != nil {
+		r.Tracer(args, time.Since(start), err)
+	}
+}
+
+// NewTextTracer returns a tracer that writes a human-readable line for each command.
+func NewTextTracer(w io.Writer) Tracer {
+	var mu sync.Mutex
+	return func(args []string, duration time.Duration, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		status := ""
+		if err != nil {
+			status = fmt.Sprintf(" failed: %v", err)
+		}
+		fmt.Fprintf(w, "trace: git %s (%v)%s\n", strings.Join(args, " "), duration.Round(time.Microsecond), status)
+	}
+}
+
+// traceEntry is a single line of the structured log.
+type traceEntry struct {
+	Time       string   `json:"time"`
+	Args       []string `json:"args"`
+	DurationMs float64  `json:"durationMs"`
+	ExitCode   int      `json:"exitCode"`
+	Error      string   `json:"error,omitempty"`
+}
+
+// NewJSONTracer returns a tracer that writes a JSON object per line for each command.
+func NewJSONTracer(w io.Writer) Tracer {
+	var mu sync.Mutex
+	return func(args []string, duration time.Duration, err error) {
+		entry := traceEntry{
+			Time:       time.Now().Format(time.RFC3339Nano),
+			Args:       args,
+			DurationMs: float64(duration) / float64(time.Millisecond),
+		}
+		if err != nil {
+			entry.Error = err.Error()
+			entry.ExitCode = -1
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) {
+				entry.ExitCode = exitErr.ExitCode()
+			}
+		}
+		line, marshalErr := json.Marshal(entry)
+		if marshalErr != nil {
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		w.Write(append(line, '\n'))
+	}
+}
+
+// MultiTracer returns a tracer that notifies each of the given tracers in turn.
+func MultiTracer(tracers ...Tracer) Tracer {
+	return func(args []string, duration time.Duration, err error) {
+		for _, tracer := range tracers {
+			tracer(args, duration, err)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package review
+
+import (
+	"sort"
+
+	"github.com/google/git-appraise/review/ci"
+	"github.com/google/git-appraise/review/request"
+)
+
+// The kinds of review activity reported by ListActivity.
+const (
+	ActivityRequest   = "request"
+	ActivityComment   = "comment"
+	ActivityApproval  = "approval"
+	ActivityRejection = "rejection"
+	// ActivityCI and ActivitySubmit are only reported by ListEvents.
+	ActivityCI     = "ci"
+	ActivitySubmit = "submit"
+)
+
+// Activity is a single event in a review: a request, a comment, a vote, a CI
+// result, or a submission.
+type Activity struct {
+	// Key uniquely identifies the event, so that it is only reported once.
+	Key      string `json:"key"`
+	Revision string `json:"revision"`
+	// Kind is one of the Activity* constants.
+	Kind      string `json:"kind"`
+	Timestamp string `json:"timestamp,omitempty"`
+	// Hash is the hash of the comment, for comments and votes.
+	Hash string `json:"hash,omitempty"`
+	// Author is empty for submissions, as who submitted a review is not recorded.
+	Author string `json:"author"`
+	Text   string `json:"text"`
+	// Report is the CI report, for CI results.
+	Report *ci.Report `json:"report,omitempty"`
+}
+
+// IsRelevantTo reports whether the user with the given email address
+// requested the review, was asked to review it, or has commented on it.
+func (r *Review) IsRelevantTo(email string) bool {
+	if identities().Same(r.Request.Requester, email) {
+		return true
+	}
+	for _, reviewer := range r.Request.Reviewers {
+		if identities().Same(reviewer, email) {
+			return true
+		}
+	}
+	return hasCommented(r.Comments, email)
+}
+
+// threadActivity returns the comments and votes in the given threads.
+func (r *Review) threadActivity(threads []CommentThread, topLevel bool) []Activity {
+	var activity []Activity
+	for _, thread := range threads {
+		c := thread.Comment
+		if !c.Retracted {
+			kind := ActivityComment
+			if topLevel && isVote(thread) {
+				kind = ActivityRejection
+				if *c.Resolved {
+					kind = ActivityApproval
+				}
+			}
+			activity = append(activity, Activity{
+				Key:       r.Revision + ":" + thread.Hash,
+				Revision:  r.Revision,
+				Kind:      kind,
+				Timestamp: c.Timestamp,
+				Hash:      thread.Hash,
+				Author:    c.Author,
+				Text:      c.Description,
+			})
+		}
+		activity = append(activity, r.threadActivity(thread.Children, false)...)
+	}
+	return activity
+}
+
+// ListActivity returns every event in the review, oldest comment first.
+//
+// The request is keyed by its timestamp, so that updating the request (e.g.
+// to add a reviewer) is reported as a new event.
+func (r *Review) ListActivity() []Activity {
+	activity := []Activity{Activity{
+		Key:       r.Revision + ":request:" + r.Request.Timestamp,
+		Revision:  r.Revision,
+		Kind:      ActivityRequest,
+		Timestamp: r.Request.Timestamp,
+		Author:    r.Request.Requester,
+		Text:      r.Request.Description,
+	}}
+	return append(activity, r.threadActivity(r.Comments, true)...)
+}
+
+// ListEvents returns the history of the review in chronological order: its
+// original request, its comments and votes, the CI results for its latest
+// commit, and its submission.
+//
+// Unlike with ListActivity, each event keeps its key as the review is updated.
+// The CI reports are loaded if they have not been already.
+func (r *Review) ListEvents() []Activity {
+	original := r.Request
+	if len(r.History) > 0 {
+		original = r.History[0]
+	}
+	events := []Activity{Activity{
+		Key:       r.Revision + ":request",
+		Revision:  r.Revision,
+		Kind:      ActivityRequest,
+		Timestamp: original.Timestamp,
+		Author:    original.Requester,
+		Text:      original.Description,
+	}}
+	events = append(events, r.threadActivity(r.Comments, true)...)
+
+	if r.Reports == nil {
+		r.LoadReports()
+	}
+	for i := range r.Reports {
+		report := r.Reports[i]
+		events = append(events, Activity{
+			Key:       r.Revision + ":ci:" + report.Name + ":" + report.Timestamp,
+			Revision:  r.Revision,
+			Kind:      ActivityCI,
+			Timestamp: report.Timestamp,
+			Author:    report.Agent,
+			Text:      report.Status,
+			Report:    &report,
+		})
+	}
+
+	for _, version := range append(append([]request.Request(nil), r.History...), r.Request) {
+		if version.SubmittedAs != "" {
+			events = append(events, Activity{
+				Key:       r.Revision + ":submit:" + version.SubmittedAs,
+				Revision:  r.Revision,
+				Kind:      ActivitySubmit,
+				Timestamp: version.Timestamp,
+				Text:      version.SubmittedAs,
+			})
+			break
+		}
+	}
+	SortActivity(events)
+	return events
+}
+
+// SortActivity sorts the given events by their timestamps, keeping events with the same timestamp in order.
+func SortActivity(events []Activity) {
+	sort.SliceStable(events, func(i, j int) bool {
+		a, _ := parseTimestamp(events[i].Timestamp)
+		b, _ := parseTimestamp(events[j].Timestamp)
+		return a.Before(b)
+	})
+}
@@ -0,0 +1,138 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package analyses defines the internal representation of static analysis reports.
+package analyses
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/google/git-appraise/repository"
+	"github.com/google/git-appraise/review/schema"
+)
+
+const (
+	// Ref defines the git-notes ref that we expect to contain analysis reports.
+	Ref = "refs/notes/devtools/analyses"
+
+	// StatusLooksGoodToMe is the status string representing that analysis reported no findings.
+	StatusLooksGoodToMe = "lgtm"
+	// StatusForYourInformation is the status string representing that analysis reported only advisory findings.
+	StatusForYourInformation = "fyi"
+	// StatusNeedsMoreWork is the status string representing that analysis reported errors.
+	StatusNeedsMoreWork = "nmw"
+
+	// FormatVersion defines the latest version of the report format supported by the tool.
+	FormatVersion = 0
+)
+
+// Format describes the versions of the report format, and has a migration to each version after the first.
+var Format = &schema.Format{Name: "analysis report"}
+
+// Range is the range of lines in a file to which a finding applies.
+type Range struct {
+	StartLine uint32 `json:"startLine,omitempty"`
+}
+
+// Location is the file, and optionally the lines in it, to which a finding applies.
+type Location struct {
+	Path  string `json:"path,omitempty"`
+	Range *Range `json:"range,omitempty"`
+}
+
+// Note is a single finding of a static analysis tool.
+type Note struct {
+	Location    *Location `json:"location,omitempty"`
+	Category    string    `json:"category,omitempty"`
+	Description string    `json:"description"`
+	// Level is how serious the finding is, e.g. "error", "warning", or "note".
+	Level string `json:"level,omitempty"`
+}
+
+// Report represents the results of running a static analysis tool on a revision.
+//
+// The findings are either stored inline in the Notes field, or in a separate
+// file that the URL field points to.
+type Report struct {
+	Timestamp string `json:"timestamp,omitempty"`
+	URL       string `json:"url,omitempty"`
+	Status    string `json:"status,omitempty"`
+	// Agent identifies the tool that produced the report.
+	Agent string `json:"agent,omitempty"`
+	Notes []Note `json:"notes,omitempty"`
+	// Version represents the version of the metadata format.
+	Version int `json:"v,omitempty"`
+}
+
+// Write writes a report as a JSON-formatted git note.
+func (report *Report) Write() (repository.Note, error) {
+	bytes, err := json.Marshal(report)
+	return repository.Note(bytes), err
+}
+
+// LatestReports returns the latest report of each tool, sorted by the tool's name.
+func LatestReports(reports []Report) []Report {
+	latest := make(map[string]Report)
+	for _, report := range reports {
+		if previous, ok := latest[report.Agent]; !ok || previous.Timestamp <= report.Timestamp {
+			latest[report.Agent] = report
+		}
+	}
+	var result []Report
+	for _, report := range latest {
+		result = append(result, report)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Agent < result[j].Agent })
+	return result
+}
+
+// Parse parses an analysis report from a git note.
+func Parse(note repository.Note) (Report, error) {
+	bytes := []byte(note)
+	var report Report
+	err := json.Unmarshal(bytes, &report)
+	return report, err
+}
+
+// parseUpgraded parses an analysis report written in another version of the format.
+func parseUpgraded(note repository.Note) (Report, error) {
+	upgraded, err := Format.Upgrade(note)
+	if err != nil {
+		return Report{}, err
+	}
+	return Parse(upgraded)
+}
+
+// ParseAllValid takes collection of git notes and tries to parse an analysis
+// report from each one. Any notes that are not valid analysis reports get
+// ignored.
+func ParseAllValid(notes []repository.Note) []Report {
+	var reports []Report
+	for _, note := range notes {
+		report, err := Parse(note)
+		if err == nil && report.Version != FormatVersion {
+			report, err = parseUpgraded(note)
+		}
+		if err == nil {
+			switch report.Status {
+			case "", StatusLooksGoodToMe, StatusForYourInformation, StatusNeedsMoreWork:
+				reports = append(reports, report)
+			}
+		}
+	}
+	return reports
+}
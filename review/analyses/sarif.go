@@ -0,0 +1,188 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package analyses
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// The subset of the SARIF format (https://sarifweb.azurewebsites.net) that is
+// needed to convert the results of an analyzer into analysis reports.
+type sarifLog struct {
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool struct {
+		Driver struct {
+			Name  string      `json:"name"`
+			Rules []sarifRule `json:"rules"`
+		} `json:"driver"`
+	} `json:"tool"`
+	OriginalURIBaseIDs map[string]sarifArtifactLocation `json:"originalUriBaseIds"`
+	Results            []sarifResult                    `json:"results"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifArtifactLocation struct {
+	URI       string `json:"uri"`
+	URIBaseID string `json:"uriBaseId"`
+}
+
+type sarifResult struct {
+	RuleID    string       `json:"ruleId"`
+	RuleIndex *int         `json:"ruleIndex"`
+	Kind      string       `json:"kind"`
+	Level     string       `json:"level"`
+	Message   sarifMessage `json:"message"`
+	Locations []struct {
+		PhysicalLocation struct {
+			ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+			Region           struct {
+				StartLine uint32 `json:"startLine"`
+			} `json:"region"`
+		} `json:"physicalLocation"`
+	} `json:"locations"`
+}
+
+// resolveURI returns the absolute form of an artifact's URI, following its chain of base URIs.
+func (run *sarifRun) resolveURI(location sarifArtifactLocation) string {
+	uri := location.URI
+	for seen := make(map[string]bool); location.URIBaseID != "" && !seen[location.URIBaseID]; {
+		seen[location.URIBaseID] = true
+		base, ok := run.OriginalURIBaseIDs[location.URIBaseID]
+		if !ok {
+			break
+		}
+		uri = strings.TrimSuffix(base.URI, "/") + "/" + strings.TrimPrefix(uri, "/")
+		location = base
+	}
+	return uri
+}
+
+// relativePath converts the URI of an artifact into a slash-separated path
+// relative to the given root directory of the repository.
+//
+// The returned bool is false if the URI does not refer to a file in the repository.
+func relativePath(uri, root string) (string, bool) {
+	parsed, err := url.Parse(uri)
+	if err != nil || (parsed.Scheme != "" && parsed.Scheme != "file") {
+		return "", false
+	}
+	p := path.Clean(parsed.Path)
+	if path.IsAbs(p) {
+		root = path.Clean(root)
+		if !strings.HasPrefix(p, root+"/") {
+			return "", false
+		}
+		p = strings.TrimPrefix(p, root+"/")
+	}
+	if p == "." || p == ".." || strings.HasPrefix(p, "../") {
+		return "", false
+	}
+	return p, true
+}
+
+// statusForNotes returns the status of a report with the given findings.
+func statusForNotes(notes []Note) string {
+	status := StatusLooksGoodToMe
+	for _, note := range notes {
+		if note.Level == "error" {
+			return StatusNeedsMoreWork
+		}
+		status = StatusForYourInformation
+	}
+	return status
+}
+
+// FromSARIF converts a SARIF log into one analysis report for each run of an analyzer in it.
+//
+// The locations of the findings are made relative to the given root
+// directory of the repository, which must be a slash-separated absolute
+// path. Findings outside of the repository are kept, but without a location.
+func FromSARIF(data []byte, root string) ([]Report, error) {
+	var log sarifLog
+	if err := json.Unmarshal(data, &log); err != nil {
+		return nil, fmt.Errorf("Invalid SARIF file: %v", err)
+	}
+	if !strings.HasPrefix(log.Version, "2.") {
+		return nil, fmt.Errorf("Unsupported SARIF version %q; only version 2 is supported.", log.Version)
+	}
+	var reports []Report
+	for _, run := range log.Runs {
+		rules := make(map[string]sarifRule)
+		for _, rule := range run.Tool.Driver.Rules {
+			rules[rule.ID] = rule
+		}
+		var notes []Note
+		for _, result := range run.Results {
+			if result.Kind != "" && result.Kind != "fail" {
+				// Other kinds of results (e.g. "pass") are not findings.
+				continue
+			}
+			rule := rules[result.RuleID]
+			if result.RuleIndex != nil && *result.RuleIndex >= 0 && *result.RuleIndex < len(run.Tool.Driver.Rules) {
+				rule = run.Tool.Driver.Rules[*result.RuleIndex]
+			}
+			note := Note{
+				Category:    result.RuleID,
+				Description: result.Message.Text,
+				Level:       result.Level,
+			}
+			if note.Category == "" {
+				note.Category = rule.ID
+			}
+			if note.Description == "" {
+				note.Description = rule.ShortDescription.Text
+			}
+			if note.Level == "" {
+				// This is the default level that SARIF specifies.
+				note.Level = "warning"
+			}
+			if len(result.Locations) > 0 {
+				physical := result.Locations[0].PhysicalLocation
+				if p, ok := relativePath(run.resolveURI(physical.ArtifactLocation), root); ok {
+					note.Location = &Location{Path: p}
+					if physical.Region.StartLine > 0 {
+						note.Location.Range = &Range{StartLine: physical.Region.StartLine}
+					}
+				}
+			}
+			notes = append(notes, note)
+		}
+		reports = append(reports, Report{
+			Status:  statusForNotes(notes),
+			Agent:   run.Tool.Driver.Name,
+			Notes:   notes,
+			Version: FormatVersion,
+		})
+	}
+	return reports, nil
+}
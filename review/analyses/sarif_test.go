@@ -0,0 +1,75 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package analyses
+
+import (
+	"reflect"
+	"testing"
+)
+
+const testSARIF = `{
+  "version": "2.1.0",
+  "runs": [{
+    "tool": {"driver": {"name": "vet", "rules": [{"id": "V1", "shortDescription": {"text": "Unused result"}}]}},
+    "originalUriBaseIds": {"SRCROOT": {"uri": "file:///home/user/repo/"}},
+    "results": [
+      {"ruleId": "V1", "level": "error", "message": {"text": "Result is unused"},
+       "locations": [{"physicalLocation": {"artifactLocation": {"uri": "cmd/main.go", "uriBaseId": "SRCROOT"}, "region": {"startLine": 12}}}]},
+      {"ruleIndex": 0,
+       "locations": [{"physicalLocation": {"artifactLocation": {"uri": "file:///home/user/repo/lib/a%20b.go"}}}]},
+      {"ruleId": "V1", "message": {"text": "Outside"},
+       "locations": [{"physicalLocation": {"artifactLocation": {"uri": "file:///usr/lib/go/x.go"}}}]},
+      {"ruleId": "V1", "kind": "pass", "message": {"text": "Passed"}}
+    ]
+  }]
+}`
+
+func TestFromSARIF(t *testing.T) {
+	reports, err := FromSARIF([]byte(testSARIF), "/home/user/repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Report{{
+		Status: StatusNeedsMoreWork,
+		Agent:  "vet",
+		Notes: []Note{
+			{
+				Location:    &Location{Path: "cmd/main.go", Range: &Range{StartLine: 12}},
+				Category:    "V1",
+				Description: "Result is unused",
+				Level:       "error",
+			},
+			{
+				Location:    &Location{Path: "lib/a b.go"},
+				Category:    "V1",
+				Description: "Unused result",
+				Level:       "warning",
+			},
+			{
+				Category:    "V1",
+				Description: "Outside",
+				Level:       "warning",
+			},
+		},
+	}}
+	if !reflect.DeepEqual(reports, expected) {
+		t.Errorf("Unexpected reports %+v", reports)
+	}
+	if _, err := FromSARIF([]byte(`{"version": "1.0.0"}`), "/"); err == nil {
+		t.Error("Failed to reject an unsupported version of SARIF")
+	}
+}
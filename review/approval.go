@@ -0,0 +1,71 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package review
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/git-appraise/review/policy"
+)
+
+// PolicyRequirements returns the approval requirements that the policy of the
+// review's target places on the review, along with the approvals towards each.
+//
+// Approvals from the requester do not count.
+func (r *Review) PolicyRequirements() ([]policy.Requirement, error) {
+	files, err := r.ChangedFiles()
+	if err != nil {
+		return nil, err
+	}
+	p, err := policy.Load(r.Request.TargetRef, files)
+	if err != nil {
+		return nil, err
+	}
+	var approvals []string
+	for _, approver := range r.Approvers() {
+		if !strings.EqualFold(approver, r.Request.Requester) {
+			approvals = append(approvals, approver)
+		}
+	}
+	return p.Evaluate(files, approvals), nil
+}
+
+// printPolicy prints whether each of the review's approval requirements has been met.
+//
+// Nothing is printed if the changes under review cannot be determined.
+func (r *Review) printPolicy() {
+	if _, _, err := r.diffRange(); err != nil {
+		return
+	}
+	requirements, err := r.PolicyRequirements()
+	if err != nil {
+		fmt.Printf("  policy: %v\n", err)
+		return
+	}
+	if len(requirements) == 0 {
+		return
+	}
+	fmt.Println("  policy:")
+	for _, req := range requirements {
+		status := colorize("accepted", "met")
+		if !req.Met() {
+			status = colorize("rejected", "unmet")
+		}
+		fmt.Printf("    [%s] %s\n", status, req)
+	}
+}
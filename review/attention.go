@@ -0,0 +1,112 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package review
+
+import (
+	"time"
+
+	"github.com/google/git-appraise/review/comment"
+	"github.com/google/git-appraise/review/identity"
+	"github.com/google/git-appraise/review/request"
+)
+
+// identities returns the identities used to attribute reviews and comments,
+// ignoring invalid identity files so that reviews can still be read.
+func identities() *identity.Map {
+	m, _ := identity.Default()
+	return m
+}
+
+// recordActivity records the time of the given comment as its author's most
+// recent activity, unless they have been active since.
+//
+// Users are identified by their canonical email addresses.
+func recordActivity(c comment.Comment, latest map[string]time.Time) {
+	author := identities().Canonical(c.Author)
+	if t, err := parseTimestamp(c.Timestamp); err == nil && t.After(latest[author]) {
+		latest[author] = t
+	}
+}
+
+// latestByAuthor records the time of each user's most recent activity in the given comment threads.
+//
+// Edits and acknowledgements count as activity, alongside comments and replies.
+func latestByAuthor(threads []CommentThread, latest map[string]time.Time) {
+	for _, thread := range threads {
+		recordActivity(thread.Comment, latest)
+		for _, c := range thread.History {
+			recordActivity(c, latest)
+		}
+		for _, c := range thread.Acks {
+			recordActivity(c, latest)
+		}
+		latestByAuthor(thread.Children, latest)
+	}
+}
+
+// attentionSet determines whose turn it is to act on an open review, given the
+// time at which the current revision of its changes was committed, and the
+// time of each user's most recent activity on the review (as recorded by latestByAuthor).
+//
+// The requester's turn starts whenever they post a revision, update the
+// request, or comment, and ends when someone else comments afterwards, so the
+// requester is in the set if anyone has commented since then. Each reviewer is
+// in the set if they have not commented since the requester's last turn.
+//
+// The set holds the users' canonical email addresses.
+func attentionSet(r *Review, revisionTime time.Time, latest map[string]time.Time) []string {
+	people := identities()
+	author := people.Canonical(r.Request.Requester)
+
+	authorTime := latest[author]
+	if revisionTime.After(authorTime) {
+		authorTime = revisionTime
+	}
+	for _, version := range append(append([]request.Request(nil), r.History...), r.Request) {
+		if version.Requester != "" && !people.Same(version.Requester, author) {
+			continue
+		}
+		if t, err := parseTimestamp(version.Timestamp); err == nil && t.After(authorTime) {
+			authorTime = t
+		}
+	}
+
+	var attention []string
+	for user, t := range latest {
+		if user != author && t.After(authorTime) {
+			attention = append(attention, author)
+			break
+		}
+	}
+	for _, reviewer := range r.Request.Reviewers {
+		reviewer = people.Canonical(reviewer)
+		if reviewer != author && latest[reviewer].Before(authorTime) && !containsString(attention, reviewer) {
+			attention = append(attention, reviewer)
+		}
+	}
+	return attention
+}
+
+// NeedsAttentionFrom reports whether it is the given user's turn to act on the review.
+func (r *Review) NeedsAttentionFrom(email string) bool {
+	for _, user := range r.Attention {
+		if identities().Same(user, email) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,172 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package attestation generates in-toto attestations that describe how a change was reviewed.
+//
+// Each attestation is an in-toto Statement whose subjects are the commits
+// included in a review, and whose predicate records the review request,
+// the approvers, the CI results for the approved commit, and whether the
+// review satisfied the submission requirements. Attestations can optionally
+// be wrapped in a signed DSSE envelope.
+package attestation
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/git-appraise/repository"
+	"github.com/google/git-appraise/review"
+	"github.com/google/git-appraise/review/ci"
+	"github.com/google/git-appraise/review/gpg"
+	"github.com/google/git-appraise/review/request"
+)
+
+const (
+	// StatementType is the in-toto statement type that attestations conform to.
+	StatementType = "https://in-toto.io/Statement/v1"
+	// PredicateType identifies the format of the review predicate.
+	PredicateType = "https://github.com/google/git-appraise/attestation/review/v0"
+	// PayloadType is the DSSE payload type used for signed attestations.
+	PayloadType = "application/vnd.in-toto+json"
+)
+
+// Subject identifies a commit covered by an attestation.
+type Subject struct {
+	Name   string            `json:"name"`
+	Digest map[string]string `json:"digest"`
+}
+
+// Policy records whether the review met the requirements for submission.
+type Policy struct {
+	Approved  bool `json:"approved"`
+	Submitted bool `json:"submitted"`
+	CIPassed  bool `json:"ciPassed"`
+}
+
+// Predicate describes the review of the subject commits.
+type Predicate struct {
+	Revision       string          `json:"revision"`
+	Request        request.Request `json:"request"`
+	ApprovedCommit string          `json:"approvedCommit,omitempty"`
+	Approvers      []string        `json:"approvers"`
+	CI             []ci.Report     `json:"ci"`
+	Policy         Policy          `json:"policy"`
+}
+
+// Statement is an in-toto statement about a single review.
+type Statement struct {
+	Type          string    `json:"_type"`
+	Subject       []Subject `json:"subject"`
+	PredicateType string    `json:"predicateType"`
+	Predicate     Predicate `json:"predicate"`
+}
+
+// Signature is a single signature in a DSSE envelope.
+type Signature struct {
+	KeyID string `json:"keyid"`
+	Sig   string `json:"sig"`
+}
+
+// Envelope is a DSSE envelope wrapping a signed statement.
+type Envelope struct {
+	PayloadType string      `json:"payloadType"`
+	Payload     string      `json:"payload"`
+	Signatures  []Signature `json:"signatures"`
+}
+
+// New builds the attestation for the given review.
+//
+// The subjects are the commits up to the approved one, or up to the latest
+// commit of the review if it has not been approved.
+func New(r *review.Review) Statement {
+	approved := r.ApprovedCommit()
+	head := approved
+	if head == "" {
+		var err error
+		if head, err = r.HeadCommit(); err != nil {
+			head = r.Revision
+		}
+	}
+	commits := []string{r.Revision}
+	if head != r.Revision && repository.IsAncestor(r.Revision, head) {
+		commits = append(commits, repository.ListCommitsBetween(r.Revision, head)...)
+	}
+	var subjects []Subject
+	for _, commit := range commits {
+		subjects = append(subjects, Subject{
+			Name:   commit,
+			Digest: map[string]string{"gitCommit": commit},
+		})
+	}
+
+	reports := ci.ParseAllValid(repository.GetNotes(ci.Ref, head))
+	ciPassed := len(reports) > 0
+	for _, check := range ci.LatestChecks(reports) {
+		ciPassed = ciPassed && check.Status == ci.StatusSuccess
+	}
+	approvers := r.Approvers()
+	if approvers == nil {
+		approvers = []string{}
+	}
+	if reports == nil {
+		reports = []ci.Report{}
+	}
+	return Statement{
+		Type:          StatementType,
+		Subject:       subjects,
+		PredicateType: PredicateType,
+		Predicate: Predicate{
+			Revision:       r.Revision,
+			Request:        r.Request,
+			ApprovedCommit: approved,
+			Approvers:      approvers,
+			CI:             reports,
+			Policy: Policy{
+				Approved:  r.Resolved != nil && *r.Resolved,
+				Submitted: r.Submitted,
+				CIPassed:  ciPassed,
+			},
+		},
+	}
+}
+
+// preAuthEncoding computes the DSSE pre-authentication encoding of a payload.
+func preAuthEncoding(payloadType string, payload []byte) []byte {
+	return []byte(fmt.Sprintf("DSSEv1 %d %s %d %s", len(payloadType), payloadType, len(payload), payload))
+}
+
+// Sign wraps the statement in a DSSE envelope signed with the user's GPG key.
+func (s Statement) Sign() (Envelope, error) {
+	payload, err := json.Marshal(s)
+	if err != nil {
+		return Envelope{}, err
+	}
+	signature, err := gpg.SignBinary(preAuthEncoding(PayloadType, payload))
+	if err != nil {
+		return Envelope{}, err
+	}
+	return Envelope{
+		PayloadType: PayloadType,
+		Payload:     base64.StdEncoding.EncodeToString(payload),
+		Signatures: []Signature{
+			Signature{
+				KeyID: gpg.KeyID(),
+				Sig:   base64.StdEncoding.EncodeToString(signature),
+			},
+		},
+	}, nil
+}
@@ -0,0 +1,193 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package review
+
+import (
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/google/git-appraise/repository"
+	"github.com/google/git-appraise/review/request"
+)
+
+// cacheDir and cacheFile are the directory, within the git directory, and the name of the file that caches the loaded reviews.
+const (
+	cacheDir  = "appraise"
+	cacheFile = "cache.json"
+)
+
+// legacyCacheFile is where the cache used to be written, within the git directory.
+const legacyCacheFile = "appraise-cache"
+
+// cacheConfig is the git config setting that disables the cache when set to "false".
+const cacheConfig = "appraise.cache"
+
+// cacheVersion is changed whenever the way reviews are built changes, so that stale caches are ignored.
+const cacheVersion = 6
+
+// reviewCache holds the reviews built from each request ref, as of a given state of the repository.
+//
+// Reviews depend on the notes, the target and review refs, whether the clone
+// is shallow, and the identities of their users, so the cache is only valid
+// while none of those change.
+//
+// Reviews holds every review of each request ref that was read in full, while
+// Single holds the reviews that were looked up one at a time.
+type reviewCache struct {
+	Version int                 `json:"v"`
+	State   string              `json:"state"`
+	Reviews map[string][]Review `json:"reviews"`
+	Single  map[string]Review   `json:"single,omitempty"`
+}
+
+// cacheState returns the key identifying the current state of the repository.
+func cacheState() string {
+	identitiesHash := sha1.Sum([]byte(identities().Source()))
+	return repository.GetRepoStateHash() + " shallow=" + strconv.FormatBool(repository.IsShallow()) + fmt.Sprintf(" identities=%x", identitiesHash)
+}
+
+// readCacheFile decodes the given file in the cache directory, reporting whether it could be read.
+func readCacheFile(name string, cache interface{}) bool {
+	contents, err := ioutil.ReadFile(filepath.Join(repository.GetGitDir(), cacheDir, name))
+	return err == nil && json.Unmarshal(contents, cache) == nil
+}
+
+// readCache returns the cache, which is empty if it is missing or stale.
+func readCache(state string) reviewCache {
+	empty := reviewCache{Version: cacheVersion, State: state, Reviews: make(map[string][]Review), Single: make(map[string]Review)}
+	var cache reviewCache
+	if !readCacheFile(cacheFile, &cache) || cache.Version != cacheVersion || cache.State != state || cache.Reviews == nil {
+		return empty
+	}
+	if cache.Single == nil {
+		cache.Single = make(map[string]Review)
+	}
+	return cache
+}
+
+// writeCacheFile replaces the given file in the cache directory, ignoring any
+// errors since the cache is only an optimization.
+//
+// The file is written to a temporary file first, so that commands running
+// concurrently never read a partially written cache.
+func writeCacheFile(name string, cache interface{}) {
+	contents, err := json.Marshal(cache)
+	if err != nil {
+		return
+	}
+	gitDir := repository.GetGitDir()
+	os.Remove(filepath.Join(gitDir, legacyCacheFile))
+	dir := filepath.Join(gitDir, cacheDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return
+	}
+	file, err := ioutil.TempFile(dir, name)
+	if err != nil {
+		return
+	}
+	_, err = file.Write(contents)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), filepath.Join(dir, name))
+	}
+	if err != nil {
+		os.Remove(file.Name())
+	}
+}
+
+// writeCache replaces the cache of reviews.
+func writeCache(cache reviewCache) {
+	writeCacheFile(cacheFile, cache)
+}
+
+// forEachFromRef calls the given function on each review whose request is
+// stored in the given notes ref, using the cached reviews if they are current.
+//
+// Otherwise, the reviews are loaded from the notes, and cached if all of them were loaded.
+func forEachFromRef(requestRef string, f func(Review) error) error {
+	if repository.GetConfig(cacheConfig) == "false" {
+		return loadEachFromRef(requestRef, buildReview, f)
+	}
+	state := cacheState()
+	cache := readCache(state)
+	if reviews, ok := cache.Reviews[requestRef]; ok {
+		for _, review := range reviews {
+			if err := f(review); err != nil {
+				if err == repository.ErrStopIteration {
+					return nil
+				}
+				return err
+			}
+		}
+		return nil
+	}
+
+	reviews := []Review{}
+	stopped := false
+	err := loadEachFromRef(requestRef, buildReview, func(review Review) error {
+		reviews = append(reviews, review)
+		err := f(review)
+		stopped = err != nil
+		return err
+	})
+	if err != nil || stopped {
+		return err
+	}
+	cache.Reviews[requestRef] = reviews
+	writeCache(cache)
+	return nil
+}
+
+// getCached returns the specified review, using the cached reviews if they are current.
+//
+// Reviews that are not in the cache are loaded with the given function, and
+// cached if they exist.
+func getCached(revision string, load func(string) *Review) *Review {
+	if repository.GetConfig(cacheConfig) == "false" {
+		return load(revision)
+	}
+	state := cacheState()
+	cache := readCache(state)
+	if review, ok := cache.Single[revision]; ok {
+		return &review
+	}
+	active, haveActive := cache.Reviews[request.Ref]
+	archived, haveArchived := cache.Reviews[request.ArchiveRef]
+	for _, reviews := range [][]Review{active, archived} {
+		for i := range reviews {
+			if reviews[i].Revision == revision {
+				return &reviews[i]
+			}
+		}
+	}
+	if haveActive && haveArchived {
+		return nil
+	}
+	review := load(revision)
+	if review != nil {
+		cache.Single[revision] = *review
+		writeCache(cache)
+	}
+	return review
+}
@@ -0,0 +1,171 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package checklist defines the checklists attached to reviews, and the marks that check their items off.
+package checklist
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/git-appraise/repository"
+	"github.com/google/git-appraise/review/schema"
+)
+
+const (
+	// Ref defines the git-notes ref that we expect to contain checklist marks.
+	//
+	// The items of a checklist are part of the review request, while the marks
+	// annotate the first revision of the review, like the request.
+	Ref = "refs/notes/devtools/checklists"
+
+	// FormatVersion defines the latest version of the mark format supported by the tool.
+	FormatVersion = 0
+)
+
+// Format describes the versions of the mark format, and has a migration to each version after the first.
+var Format = &schema.Format{Name: "checklist mark"}
+
+// Mark records that a checklist item was checked off, or, if Unchecked is set, that it was unchecked again.
+type Mark struct {
+	Timestamp string `json:"timestamp,omitempty"`
+	Author    string `json:"author"`
+	Item      string `json:"item"`
+	Unchecked bool   `json:"unchecked,omitempty"`
+	// Version represents the version of the metadata format.
+	Version int `json:"v,omitempty"`
+}
+
+// New returns a new mark for the given item, made by the current user at the current time.
+func New(item string, unchecked bool) Mark {
+	return Mark{
+		Timestamp: strconv.FormatInt(time.Now().Unix(), 10),
+		Author:    repository.GetUserEmail(),
+		Item:      item,
+		Unchecked: unchecked,
+	}
+}
+
+// Parse parses a checklist mark from a git note.
+func Parse(note repository.Note) (Mark, error) {
+	bytes := []byte(note)
+	var mark Mark
+	err := json.Unmarshal(bytes, &mark)
+	return mark, err
+}
+
+// parseUpgraded parses a checklist mark written in another version of the format.
+func parseUpgraded(note repository.Note) (Mark, error) {
+	upgraded, err := Format.Upgrade(note)
+	if err != nil {
+		return Mark{}, err
+	}
+	return Parse(upgraded)
+}
+
+// ParseAllValid takes collection of git notes and tries to parse a checklist
+// mark from each one. Any notes that are not valid marks get ignored.
+func ParseAllValid(notes []repository.Note) []Mark {
+	var marks []Mark
+	for _, note := range notes {
+		mark, err := Parse(note)
+		if err == nil && mark.Version != FormatVersion {
+			mark, err = parseUpgraded(note)
+		}
+		if err == nil && mark.Author != "" && mark.Item != "" {
+			marks = append(marks, mark)
+		}
+	}
+	return marks
+}
+
+// Write writes a checklist mark as a JSON-formatted git note.
+func (mark *Mark) Write() (repository.Note, error) {
+	bytes, err := json.Marshal(mark)
+	return repository.Note(bytes), err
+}
+
+// ValidateItem returns an error if the given checklist item is empty or spans several lines.
+func ValidateItem(item string) error {
+	if strings.TrimSpace(item) == "" || strings.ContainsAny(item, "\r\n") {
+		return fmt.Errorf("Invalid checklist item %q; items must be a single, non-empty line", item)
+	}
+	return nil
+}
+
+// ParseTemplate returns the items of a checklist template, which has one item
+// per line. Blank lines and lines starting with "#" are ignored, as are any
+// Markdown list markers and checkboxes at the start of an item.
+func ParseTemplate(contents string) []string {
+	var items []string
+	for _, line := range strings.Split(contents, "\n") {
+		item := strings.TrimSpace(line)
+		if item == "" || strings.HasPrefix(item, "#") {
+			continue
+		}
+		for _, marker := range []string{"- ", "* ", "[ ] ", "[x] "} {
+			item = strings.TrimSpace(strings.TrimPrefix(item, marker))
+		}
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Item describes the completion state of a checklist item.
+type Item struct {
+	Text    string `json:"text"`
+	Checked bool   `json:"checked"`
+	// CheckedBy and Timestamp describe the latest mark of a checked item.
+	CheckedBy string `json:"checkedBy,omitempty"`
+	Timestamp string `json:"timestamp,omitempty"`
+}
+
+// Status returns the completion state of each of the given items, according to the latest mark for it.
+func Status(items []string, marks []Mark) []Item {
+	latest := make(map[string]Mark)
+	for _, mark := range marks {
+		if previous, ok := latest[mark.Item]; !ok || previous.Timestamp <= mark.Timestamp {
+			latest[mark.Item] = mark
+		}
+	}
+	var status []Item
+	for _, text := range items {
+		item := Item{Text: text}
+		if mark, ok := latest[text]; ok && !mark.Unchecked {
+			item.Checked = true
+			item.CheckedBy = mark.Author
+			item.Timestamp = mark.Timestamp
+		}
+		status = append(status, item)
+	}
+	return status
+}
+
+// Unchecked returns the items that have not been checked off.
+func Unchecked(status []Item) []string {
+	var unchecked []string
+	for _, item := range status {
+		if !item.Checked {
+			unchecked = append(unchecked, item.Text)
+		}
+	}
+	return unchecked
+}
@@ -0,0 +1,52 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package checklist
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseTemplate(t *testing.T) {
+	template := "# Release checklist\n\n- Tests added\n* [ ] Docs updated\n  Security review  \n"
+	expected := []string{"Tests added", "Docs updated", "Security review"}
+	if items := ParseTemplate(template); !reflect.DeepEqual(items, expected) {
+		t.Errorf("Unexpected items %q", items)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	items := []string{"tests", "docs", "security"}
+	marks := []Mark{
+		{Timestamp: "2", Author: "bob", Item: "docs", Unchecked: true},
+		{Timestamp: "1", Author: "alice", Item: "docs"},
+		{Timestamp: "1", Author: "alice", Item: "tests"},
+		{Timestamp: "3", Author: "carol", Item: "removed item"},
+	}
+	expected := []Item{
+		{Text: "tests", Checked: true, CheckedBy: "alice", Timestamp: "1"},
+		{Text: "docs"},
+		{Text: "security"},
+	}
+	status := Status(items, marks)
+	if !reflect.DeepEqual(status, expected) {
+		t.Errorf("Unexpected status %+v", status)
+	}
+	if unchecked := Unchecked(status); !reflect.DeepEqual(unchecked, []string{"docs", "security"}) {
+		t.Errorf("Unexpected unchecked items %q", unchecked)
+	}
+}
@@ -0,0 +1,49 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package review
+
+import (
+	"fmt"
+
+	"github.com/google/git-appraise/repository"
+	"github.com/google/git-appraise/review/checklist"
+)
+
+// ChecklistStatus returns the completion state of each item of the review's checklist.
+func (r *Review) ChecklistStatus() []checklist.Item {
+	if len(r.Request.Checklist) == 0 {
+		return nil
+	}
+	marks := checklist.ParseAllValid(repository.GetNotes(checklist.Ref, r.Revision))
+	return checklist.Status(r.Request.Checklist, marks)
+}
+
+// printChecklist prints the items of the review's checklist, and whether each has been checked off.
+func (r *Review) printChecklist() {
+	status := r.ChecklistStatus()
+	if len(status) == 0 {
+		return
+	}
+	fmt.Printf("  checklist: %d of %d done\n", len(status)-len(checklist.Unchecked(status)), len(status))
+	for _, item := range status {
+		if item.Checked {
+			fmt.Printf("    [%s] %s (%s)\n", colorize("accepted", "x"), item.Text, item.CheckedBy)
+		} else {
+			fmt.Printf("    [ ] %s\n", item.Text)
+		}
+	}
+}
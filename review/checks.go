@@ -0,0 +1,121 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package review
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/git-appraise/review/analyses"
+	"github.com/google/git-appraise/review/ci"
+)
+
+// checkSlot returns the color slot used for the status of a CI check.
+func checkSlot(status string) string {
+	switch status {
+	case ci.StatusSuccess:
+		return "accepted"
+	case ci.StatusFailure:
+		return "rejected"
+	}
+	return "pending"
+}
+
+// analysisSlot returns the color slot used for the status of an analysis report.
+func analysisSlot(status string) string {
+	switch status {
+	case analyses.StatusLooksGoodToMe:
+		return "accepted"
+	case analyses.StatusNeedsMoreWork:
+		return "rejected"
+	}
+	return "pending"
+}
+
+// printChecks prints a table of the latest status of each CI check of the review.
+func (r *Review) printChecks() {
+	checks := ci.LatestChecks(r.Reports)
+	if len(checks) == 0 {
+		return
+	}
+	fmt.Println("  checks:")
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, check := range checks {
+		name := check.Name
+		if name == "" {
+			name = "(unnamed)"
+		}
+		status := check.Status
+		if status == "" {
+			status = "pending"
+		}
+		var duration, required string
+		if check.Duration > 0 {
+			duration = (time.Duration(check.Duration) * time.Second).String()
+		}
+		if check.Required {
+			required = "required"
+		}
+		fields := []string{"    " + name, colorize(checkSlot(check.Status), status), duration, required, check.URL}
+		for fields[len(fields)-1] == "" {
+			fields = fields[:len(fields)-1]
+		}
+		fmt.Fprintln(w, strings.Join(fields, "\t"))
+	}
+	w.Flush()
+}
+
+// printAnalyses prints the findings of the latest analysis report of each tool that analyzed the review.
+func (r *Review) printAnalyses() {
+	reports := analyses.LatestReports(r.Analyses)
+	if len(reports) == 0 {
+		return
+	}
+	fmt.Println("  analyses:")
+	for _, report := range reports {
+		agent := report.Agent
+		if agent == "" {
+			agent = "(unnamed)"
+		}
+		summary := fmt.Sprintf("    %s %s", agent, colorize(analysisSlot(report.Status), report.Status))
+		if report.URL != "" {
+			summary += " " + report.URL
+		}
+		fmt.Println(strings.TrimRight(summary, " "))
+		for _, note := range report.Notes {
+			location := "(no location)"
+			if note.Location != nil {
+				location = note.Location.Path
+				if note.Location.Range != nil {
+					location += fmt.Sprintf(":%d", note.Location.Range.StartLine)
+				}
+			}
+			line := "      " + location + ": "
+			if note.Level != "" {
+				line += note.Level + ": "
+			}
+			line += note.Description
+			if note.Category != "" {
+				line += fmt.Sprintf(" (%s)", note.Category)
+			}
+			fmt.Println(line)
+		}
+	}
+}
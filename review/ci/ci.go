@@ -19,8 +19,10 @@ package ci
 
 import (
 	"encoding/json"
+	"sort"
 
 	"github.com/google/git-appraise/repository"
+	"github.com/google/git-appraise/review/schema"
 )
 
 const (
@@ -36,18 +38,77 @@ const (
 	FormatVersion = 0
 )
 
+// Format describes the versions of the report format, and has a migration to each version after the first.
+var Format = &schema.Format{Name: "CI report"}
+
 // Report represents a build/test status report generated by a continuous integration tool.
 //
 // Every field is optional.
+//
+// A revision may have reports for several named checks (e.g. "build", "unit
+// tests", and "lint"), and for several runs of each, of which the latest
+// one counts. Reports without a name all count as the same, unnamed check.
 type Report struct {
 	Timestamp string `json:"timestamp,omitempty"`
 	URL       string `json:"url,omitempty"`
 	Status    string `json:"status,omitempty"`
 	Agent     string `json:"agent,omitempty"`
+	// Name identifies the check that was run.
+	Name string `json:"name,omitempty"`
+	// Duration is how long the check took to run, in seconds.
+	Duration int64 `json:"duration,omitempty"`
+	// Required indicates that a review cannot be submitted unless the check succeeds.
+	Required bool `json:"required,omitempty"`
 	// Version represents the version of the metadata format.
 	Version int `json:"v,omitempty"`
 }
 
+// LatestChecks returns the latest report of each named check, sorted by name.
+func LatestChecks(reports []Report) []Report {
+	latest := make(map[string]Report)
+	for _, report := range reports {
+		if previous, ok := latest[report.Name]; !ok || previous.Timestamp <= report.Timestamp {
+			latest[report.Name] = report
+		}
+	}
+	var checks []Report
+	for _, check := range latest {
+		checks = append(checks, check)
+	}
+	sort.Slice(checks, func(i, j int) bool { return checks[i].Name < checks[j].Name })
+	return checks
+}
+
+// UnsatisfiedChecks returns the names of the required checks whose latest
+// reports are not successful, or which have not reported at all.
+//
+// Checks are required if their latest report says so, or if they are among the given names.
+func UnsatisfiedChecks(reports []Report, required []string) []string {
+	var unsatisfied []string
+	reported := make(map[string]bool)
+	for _, check := range LatestChecks(reports) {
+		reported[check.Name] = true
+		if (check.Required || containsString(required, check.Name)) && check.Status != StatusSuccess {
+			unsatisfied = append(unsatisfied, check.Name)
+		}
+	}
+	for _, name := range required {
+		if !reported[name] {
+			unsatisfied = append(unsatisfied, name)
+		}
+	}
+	return unsatisfied
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
 // Parse parses a CI report from a git note.
 func Parse(note repository.Note) (Report, error) {
 	bytes := []byte(note)
@@ -56,6 +117,15 @@ func Parse(note repository.Note) (Report, error) {
 	return report, err
 }
 
+// parseUpgraded parses a CI report written in another version of the format.
+func parseUpgraded(note repository.Note) (Report, error) {
+	upgraded, err := Format.Upgrade(note)
+	if err != nil {
+		return Report{}, err
+	}
+	return Parse(upgraded)
+}
+
 // ParseAllValid takes collection of git notes and tries to parse a CI report
 // from each one. Any notes that are not valid CI reports get ignored, as we
 // expect the git notes to be a heterogenous list, with only some of them
@@ -64,7 +134,10 @@ func ParseAllValid(notes []repository.Note) []Report {
 	var reports []Report
 	for _, note := range notes {
 		report, err := Parse(note)
-		if err == nil && report.Version == FormatVersion {
+		if err == nil && report.Version != FormatVersion {
+			report, err = parseUpgraded(note)
+		}
+		if err == nil {
 			if report.Status == "" || report.Status == StatusSuccess || report.Status == StatusFailure {
 				reports = append(reports, report)
 			}
@@ -72,3 +145,9 @@ func ParseAllValid(notes []repository.Note) []Report {
 	}
 	return reports
 }
+
+// Write writes a CI report as a JSON-formatted git note.
+func (report Report) Write() (repository.Note, error) {
+	bytes, err := json.Marshal(report)
+	return repository.Note(bytes), err
+}
@@ -0,0 +1,44 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ci
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUnsatisfiedChecks(t *testing.T) {
+	reports := []Report{
+		Report{Timestamp: "1", Name: "build", Status: StatusFailure, Required: true},
+		Report{Timestamp: "2", Name: "build", Status: StatusSuccess, Required: true},
+		Report{Timestamp: "1", Name: "lint", Status: StatusFailure},
+		Report{Timestamp: "1", Name: "test", Required: true},
+	}
+	var names []string
+	for _, check := range LatestChecks(reports) {
+		names = append(names, check.Name+":"+check.Status)
+	}
+	if expected := []string{"build:success", "lint:failure", "test:"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("Unexpected latest checks %v", names)
+	}
+	if unsatisfied := UnsatisfiedChecks(reports, nil); !reflect.DeepEqual(unsatisfied, []string{"test"}) {
+		t.Errorf("Unexpected unsatisfied checks %v", unsatisfied)
+	}
+	if unsatisfied := UnsatisfiedChecks(reports, []string{"lint", "docs"}); !reflect.DeepEqual(unsatisfied, []string{"lint", "test", "docs"}) {
+		t.Errorf("Unexpected unsatisfied checks %v", unsatisfied)
+	}
+}
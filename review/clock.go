@@ -0,0 +1,69 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package review
+
+import (
+	"github.com/google/git-appraise/repository"
+	"github.com/google/git-appraise/review/comment"
+	"github.com/google/git-appraise/review/request"
+)
+
+// happenedBefore reports whether an event with the first clock and timestamp is ordered before one with the second.
+//
+// The Lamport clocks decide the order, as they are immune to skew between the
+// authors' system clocks, and the timestamps break ties between equal clocks
+// (i.e. concurrent events). Notes written by older releases of the tool have
+// no clock, which counts as a clock of 0, so they come before every note that
+// has one, and are ordered among themselves by their timestamps.
+func happenedBefore(clock uint64, timestamp string, otherClock uint64, otherTimestamp string) bool {
+	if clock != otherClock {
+		return clock < otherClock
+	}
+	return timestamp < otherTimestamp
+}
+
+// commentBefore reports whether the first comment is ordered before the second.
+func commentBefore(c, other comment.Comment) bool {
+	return happenedBefore(c.Clock, c.Timestamp, other.Clock, other.Timestamp)
+}
+
+// requestBefore reports whether the first version of a request is ordered before the second.
+func requestBefore(r, other request.Request) bool {
+	return happenedBefore(r.Clock, r.Timestamp, other.Clock, other.Timestamp)
+}
+
+// nextClock returns the Lamport clock for a new comment or request on the
+// review, which is one more than the latest clock of its existing notes.
+//
+// The notes are read afresh, since the review may have been loaded from a
+// summary, which does not include its comments.
+func (r *Review) nextClock() uint64 {
+	var latest uint64
+	for _, ref := range []string{request.Ref, request.ArchiveRef} {
+		for _, req := range request.ParseAllValid(repository.GetNotes(ref, r.Revision)) {
+			if req.Clock > latest {
+				latest = req.Clock
+			}
+		}
+	}
+	for _, c := range comment.ParseAllValid(repository.GetNotes(comment.Ref, r.Revision)) {
+		if c.Clock > latest {
+			latest = c.Clock
+		}
+	}
+	return latest + 1
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package review
+
+import (
+	"strings"
+
+	"github.com/google/git-appraise/repository"
+)
+
+// colorConfigPrefix is the prefix of the git config settings for the colors used in the output.
+//
+// Like git's own "color.diff.<slot>" settings, each part of the output is
+// colored by "color.appraise.<slot>", e.g. "color.appraise.accepted".
+const colorConfigPrefix = "color.appraise."
+
+// resetColor is the escape sequence that ends a colored section of output.
+const resetColor = "\x1b[m"
+
+// defaultColors maps the parts of the output that can be colored to their default colors.
+var defaultColors = map[string]string{
+	"hash":      "yellow",
+	"pending":   "yellow",
+	"accepted":  "green",
+	"rejected":  "red",
+	"abandoned": "blue",
+	"overdue":   "bold red",
+	"author":    "bold",
+	"meta":      "bold",
+	"frag":      "cyan",
+	"old":       "red",
+	"new":       "green",
+	"heading":   "bold",
+	"strong":    "bold",
+	"emphasis":  "italic",
+	"code":      "cyan",
+	"quote":     "dim",
+	"keyword":   "magenta",
+	"string":    "green",
+	"comment":   "blue",
+}
+
+var (
+	colorEnabled bool
+	colorCodes   = make(map[string]string)
+)
+
+// EnableColor sets whether the output printed by this package is colored.
+func EnableColor(enabled bool) {
+	colorEnabled = enabled
+}
+
+// colorize wraps the text in the escape sequences for the color of the given slot, if color is enabled.
+//
+// The colors are looked up from the git config when first used.
+func colorize(slot, text string) string {
+	if !colorEnabled || text == "" {
+		return text
+	}
+	code, ok := colorCodes[slot]
+	if !ok {
+		code = repository.GetColor(colorConfigPrefix+slot, defaultColors[slot])
+		colorCodes[slot] = code
+	}
+	if code == "" {
+		return text
+	}
+	return code + text + resetColor
+}
+
+// colorizeDiffLine colors a line of a diff in the same way as git does.
+func colorizeDiffLine(line string) string {
+	switch {
+	case strings.HasPrefix(line, "diff ") || strings.HasPrefix(line, "index ") ||
+		strings.HasPrefix(line, "+++ ") || strings.HasPrefix(line, "--- "):
+		return colorize("meta", line)
+	case strings.HasPrefix(line, "@@"):
+		return colorize("frag", line)
+	case strings.HasPrefix(line, "+"):
+		return colorize("new", line)
+	case strings.HasPrefix(line, "-"):
+		return colorize("old", line)
+	}
+	return line
+}
+
+// ColorizeDiff colors each line of the given diff, if color is enabled.
+func ColorizeDiff(diff string) string {
+	if !colorEnabled {
+		return diff
+	}
+	lines := strings.Split(diff, "\n")
+	for i, line := range lines {
+		lines[i] = colorizeDiffLine(line)
+	}
+	return strings.Join(lines, "\n")
+}
@@ -22,6 +22,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/google/git-appraise/repository"
+	"github.com/google/git-appraise/review/gpg"
+	"github.com/google/git-appraise/review/mention"
+	"github.com/google/git-appraise/review/schema"
+	"sort"
 	"strconv"
 	"time"
 )
@@ -32,9 +36,38 @@ const Ref = "refs/notes/devtools/discuss"
 // FormatVersion defines the latest version of the comment format supported by the tool.
 const FormatVersion = 0
 
+// Format describes the versions of the comment format, and has a migration to each version after the first.
+//
+// Replies refer to comments by the hash of their latest serialization, so a
+// migration must also update the parents of any comments whose hashes it changes.
+var Format = &schema.Format{Name: "review comment"}
+
+// The severities of a comment. Only unresolved blocking comments prevent the
+// review from being submitted, while suggestions and nits are informational.
+const (
+	SeverityBlocking   = "blocking"
+	SeveritySuggestion = "suggestion"
+	SeverityNit        = "nit"
+)
+
+// Severities lists the supported severities, from the most to the least serious.
+var Severities = []string{SeverityBlocking, SeveritySuggestion, SeverityNit}
+
+// ValidateSeverity returns an error if the given severity is not one of the supported ones.
+func ValidateSeverity(severity string) error {
+	for _, s := range Severities {
+		if severity == s {
+			return nil
+		}
+	}
+	return fmt.Errorf("Invalid severity %q; must be one of %v", severity, Severities)
+}
+
 // Range represents the range of text that is under discussion.
 type Range struct {
 	StartLine uint32 `json:"startLine"`
+	// EndLine is the last line of a multi-line range, and is omitted for a single line.
+	EndLine uint32 `json:"endLine,omitempty"`
 }
 
 // Location represents the location of a comment within a commit.
@@ -44,6 +77,16 @@ type Location struct {
 	Path string `json:"path,omitempty"`
 	// If the range is omitted, then the location represents an entire file.
 	Range *Range `json:"range,omitempty"`
+	// CommitMessage indicates that the comment is about the commit's message
+	// rather than a file, in which case the path is omitted and the range (if
+	// any) refers to lines of the message.
+	CommitMessage bool `json:"commitMessage,omitempty"`
+}
+
+// IsWholeCommit reports whether the location is the commit as a whole, rather
+// than one of its files or its message.
+func (location *Location) IsWholeCommit() bool {
+	return location == nil || (location.Path == "" && !location.CommitMessage)
 }
 
 // Comment represents a review comment, and can occur in any of the following contexts:
@@ -68,18 +111,44 @@ type Comment struct {
 	// has been addressed. Otherwise, the parent is the commit, and this means that the
 	// change has been accepted. If the resolved bit is unset, then the comment is only an FYI.
 	Resolved *bool `json:"resolved,omitempty"`
+	// Original is only set on amendments, which edit or retract an earlier comment
+	// by the same author, and is the hash of that comment. Only the description of
+	// a comment can be edited, and the latest amendment to it takes effect.
+	Original string `json:"original,omitempty"`
+	// Retracted indicates that an amendment withdraws the original comment.
+	Retracted bool `json:"retracted,omitempty"`
+	// Ack is a short acknowledgement of the parent comment (e.g. "done" or "+1"),
+	// which is shown alongside that comment rather than as a reply to it.
+	Ack string `json:"ack,omitempty"`
+	// Suggestion is the text that the commenter suggests should replace the
+	// lines in the comment's location, without a trailing newline. An empty
+	// suggestion suggests deleting the lines.
+	Suggestion *string `json:"suggestion,omitempty"`
+	// Mentions are the users mentioned (as "@user") in the description.
+	Mentions []string `json:"mentions,omitempty"`
+	// Severity is one of the levels listed in Severities, and only applies to
+	// the first comment of a thread. Without it, a thread only blocks the
+	// review while its status is "needs work".
+	Severity string `json:"severity,omitempty"`
 	// Version represents the version of the metadata format.
 	Version int `json:"v,omitempty"`
+	// Clock is a Lamport clock ordering the comment among the other comments
+	// and the versions of the request on the review, as in request.Request.
+	Clock uint64 `json:"clock,omitempty"`
+	// Signature is an optional GPG signature of the comment, made with the signature field left empty.
+	Signature string `json:"signature,omitempty"`
 }
 
 // New returns a new comment with the given description message.
 //
-// The Timestamp and Author fields are automatically filled in with the current time and user.
+// The Timestamp and Author fields are automatically filled in with the current
+// time and user, and the Mentions field with the users mentioned in the message.
 func New(description string) Comment {
 	return Comment{
 		Timestamp:   strconv.FormatInt(time.Now().Unix(), 10),
 		Author:      repository.GetUserEmail(),
 		Description: description,
+		Mentions:    mention.Parse(description),
 	}
 }
 
@@ -91,15 +160,46 @@ func Parse(note repository.Note) (Comment, error) {
 	return comment, err
 }
 
+// parseUpgraded parses a review comment written in another version of the format.
+func parseUpgraded(note repository.Note) (Comment, error) {
+	upgraded, err := Format.Upgrade(note)
+	if err != nil {
+		return Comment{}, err
+	}
+	return Parse(upgraded)
+}
+
 // ParseAllValid takes collection of git notes and tries to parse a review
 // comment from each one. Any notes that are not valid review comments get
 // ignored, as we expect the git notes to be a heterogenous list, with only
 // some of them being review comments.
+//
+// Copies of the same comment are removed, as in ParseAllUnique.
 func ParseAllValid(notes []repository.Note) map[string]Comment {
+	comments, _ := ParseAllUnique(notes)
+	return comments
+}
+
+// ParseAllUnique parses the valid review comments in the given notes, keyed
+// by their hashes, keeping only one copy of each comment (as identified by its ID).
+//
+// It also returns the aliases of the kept comments, which map the hash of
+// each removed copy to the hash of the kept one, so that replies and
+// amendments referring to a removed copy can be attributed to the kept one.
+func ParseAllUnique(notes []repository.Note) (map[string]Comment, map[string]string) {
+	return dedupe(ParseAll(notes))
+}
+
+// ParseAll parses the valid review comments in the given notes, keyed by
+// their hashes, without removing copies of the same comment.
+func ParseAll(notes []repository.Note) map[string]Comment {
 	comments := make(map[string]Comment)
 	for _, note := range notes {
 		comment, err := Parse(note)
-		if err == nil && comment.Version == FormatVersion {
+		if err == nil && comment.Version != FormatVersion {
+			comment, err = parseUpgraded(note)
+		}
+		if err == nil {
 			hash, err := comment.Hash()
 			if err == nil {
 				comments[hash] = comment
@@ -109,18 +209,134 @@ func ParseAllValid(notes []repository.Note) map[string]Comment {
 	return comments
 }
 
-func (comment Comment) serialize() ([]byte, error) {
-	if len(comment.Timestamp) < 10 {
+// identity holds the fields of a comment that make up its content, which are
+// those hashed by ID. The mentions are left out, as they follow from the description.
+type identity struct {
+	Timestamp   string    `json:"timestamp,omitempty"`
+	Author      string    `json:"author,omitempty"`
+	Parent      string    `json:"parent,omitempty"`
+	Location    *Location `json:"location,omitempty"`
+	Description string    `json:"description,omitempty"`
+	Resolved    *bool     `json:"resolved,omitempty"`
+	Original    string    `json:"original,omitempty"`
+	Retracted   bool      `json:"retracted,omitempty"`
+	Ack         string    `json:"ack,omitempty"`
+	Suggestion  *string   `json:"suggestion,omitempty"`
+	Severity    string    `json:"severity,omitempty"`
+	Clock       uint64    `json:"clock,omitempty"`
+}
+
+// ID returns a content-addressed identifier of the comment.
+//
+// Unlike the hash, the ID leaves out how the comment was written (its
+// signature, format version, and mentions), so copies of the same comment,
+// such as ones imported twice from another system, share their ID. The
+// timestamp and clock are kept, so that an author repeating a comment (e.g.
+// accepting a review again after rejecting it) writes a new one.
+func (comment Comment) ID() (string, error) {
+	bytes, err := json.Marshal(identity{
+		Timestamp:   padTimestamp(comment.Timestamp),
+		Author:      comment.Author,
+		Parent:      comment.Parent,
+		Location:    comment.Location,
+		Description: comment.Description,
+		Resolved:    comment.Resolved,
+		Original:    comment.Original,
+		Retracted:   comment.Retracted,
+		Ack:         comment.Ack,
+		Suggestion:  comment.Suggestion,
+		Severity:    comment.Severity,
+		Clock:       comment.Clock,
+	})
+	return fmt.Sprintf("%x", sha1.Sum(bytes)), err
+}
+
+// NoteKey returns the ID of the comment in the given note, so that copies of
+// the same comment can be recognized when merging notes. Notes that are not
+// comments are their own keys.
+func NoteKey(note repository.Note) string {
+	comment, err := Parse(note)
+	if err != nil {
+		return string(note)
+	}
+	id, err := comment.ID()
+	if err != nil {
+		return string(note)
+	}
+	return id
+}
+
+// dedupe removes all but one copy of each comment from the given comments,
+// keyed by their hashes, and returns the remaining comments along with the
+// aliases of the removed copies.
+//
+// References to other comments are part of a comment's content, so they are
+// followed through the aliases before computing its ID, and as removing
+// duplicates can then reveal more of them, this repeats until none remain.
+func dedupe(comments map[string]Comment) (map[string]Comment, map[string]string) {
+	aliases := make(map[string]string)
+	for {
+		hashes := make([]string, 0, len(comments))
+		for hash := range comments {
+			hashes = append(hashes, hash)
+		}
+		sort.Slice(hashes, func(i, j int) bool {
+			left, right := comments[hashes[i]], comments[hashes[j]]
+			if left.Timestamp != right.Timestamp {
+				return left.Timestamp < right.Timestamp
+			}
+			return hashes[i] < hashes[j]
+		})
+		kept := make(map[string]string)
+		removed := 0
+		for _, hash := range hashes {
+			canonical := comments[hash]
+			canonical.Parent = resolveAlias(aliases, canonical.Parent)
+			canonical.Original = resolveAlias(aliases, canonical.Original)
+			id, err := canonical.ID()
+			if err != nil {
+				continue
+			}
+			if original, ok := kept[id]; ok {
+				aliases[hash] = original
+				delete(comments, hash)
+				removed++
+			} else {
+				kept[id] = hash
+			}
+		}
+		if removed == 0 {
+			return comments, aliases
+		}
+	}
+}
+
+// resolveAlias returns the hash of the kept copy of the comment with the given hash.
+func resolveAlias(aliases map[string]string, hash string) string {
+	if original, ok := aliases[hash]; ok {
+		return original
+	}
+	return hash
+}
+
+// padTimestamp returns the given timestamp reformatted to be at least 10 characters.
+func padTimestamp(timestamp string) string {
+	if len(timestamp) < 10 {
 		// To make sure that timestamps from before 2001 appear in the correct
 		// alphabetical order, we reformat the timestamp to be at least 10 characters
 		// and zero-padded.
-		time, err := strconv.ParseInt(comment.Timestamp, 10, 64)
+		time, err := strconv.ParseInt(timestamp, 10, 64)
 		if err == nil {
-			comment.Timestamp = fmt.Sprintf("%010d", time)
+			return fmt.Sprintf("%010d", time)
 		}
 		// We ignore the other case, as the comment timestamp is not in a format
 		// we expected, so we should just leave it alone.
 	}
+	return timestamp
+}
+
+func (comment Comment) serialize() ([]byte, error) {
+	comment.Timestamp = padTimestamp(comment.Timestamp)
 	return json.Marshal(comment)
 }
 
@@ -135,3 +351,32 @@ func (comment Comment) Hash() (string, error) {
 	bytes, err := comment.serialize()
 	return fmt.Sprintf("%x", sha1.Sum(bytes)), err
 }
+
+// Sign adds a GPG signature of the comment, made by the current user.
+func (comment *Comment) Sign() error {
+	comment.Signature = ""
+	payload, err := comment.serialize()
+	if err != nil {
+		return err
+	}
+	signature, err := gpg.Sign(payload)
+	if err != nil {
+		return err
+	}
+	comment.Signature = signature
+	return nil
+}
+
+// VerifySignature checks whether the comment was signed by its author.
+func (comment Comment) VerifySignature() gpg.Status {
+	signature := comment.Signature
+	if signature == "" {
+		return gpg.StatusUnsigned
+	}
+	comment.Signature = ""
+	payload, err := comment.serialize()
+	if err != nil {
+		return gpg.StatusBad
+	}
+	return gpg.Verify(payload, signature, comment.Author)
+}
@@ -0,0 +1,151 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package review
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/git-appraise/review/comment"
+	"github.com/google/git-appraise/review/request"
+)
+
+// Conflict is a set of concurrent updates to the same part of a review that disagree with each other.
+//
+// Updates are concurrent when they have the same clock, which means that
+// neither of their authors had seen the other's update. When notes are merged
+// both updates are kept, and the one with the later timestamp silently wins,
+// so conflicts need to be resolved by recording a new update. Only the latest
+// updates can conflict, as anything after them supersedes them.
+type Conflict struct {
+	// Comment is the hash of the amended comment, or empty for conflicting versions of the review request.
+	Comment string `json:"comment,omitempty"`
+	// Requests are the conflicting versions of the review request.
+	Requests []request.Request `json:"requests,omitempty"`
+	// Amendments are the conflicting amendments of the comment.
+	Amendments []comment.Comment `json:"amendments,omitempty"`
+}
+
+// latestConcurrent returns the indices of the updates with the latest clock,
+// as given by the clock function, leaving out those equal to one before them.
+//
+// Updates without clocks are never considered concurrent.
+func latestConcurrent(count int, clock func(int) uint64, equal func(int, int) bool) []int {
+	var latest uint64
+	for i := 0; i < count; i++ {
+		if clock(i) > latest {
+			latest = clock(i)
+		}
+	}
+	var concurrent []int
+	for i := 0; i < count; i++ {
+		if latest == 0 || clock(i) != latest {
+			continue
+		}
+		duplicate := false
+		for _, j := range concurrent {
+			duplicate = duplicate || equal(i, j)
+		}
+		if !duplicate {
+			concurrent = append(concurrent, i)
+		}
+	}
+	return concurrent
+}
+
+// conflictingRequests returns the latest versions of a request, if more than one of them differ.
+func conflictingRequests(versions []request.Request) []request.Request {
+	indices := latestConcurrent(len(versions), func(i int) uint64 {
+		return versions[i].Clock
+	}, func(i, j int) bool {
+		return len(RequestChanges(versions[j], versions[i])) == 0
+	})
+	if len(indices) < 2 {
+		return nil
+	}
+	var conflicting []request.Request
+	for _, i := range indices {
+		conflicting = append(conflicting, versions[i])
+	}
+	return conflicting
+}
+
+// conflictingAmendments returns the latest amendments of a comment, if more than one of them differ.
+func conflictingAmendments(amendments []comment.Comment) []comment.Comment {
+	indices := latestConcurrent(len(amendments), func(i int) uint64 {
+		return amendments[i].Clock
+	}, func(i, j int) bool {
+		return amendments[i].Description == amendments[j].Description && amendments[i].Retracted == amendments[j].Retracted
+	})
+	if len(indices) < 2 {
+		return nil
+	}
+	var conflicting []comment.Comment
+	for _, i := range indices {
+		conflicting = append(conflicting, amendments[i])
+	}
+	return conflicting
+}
+
+// Conflicts returns the concurrent updates to the review request and to its comments that disagree with each other.
+func (r *Review) Conflicts() []Conflict {
+	var conflicts []Conflict
+	versions := append(append([]request.Request(nil), r.History...), r.Request)
+	if requests := conflictingRequests(versions); requests != nil {
+		conflicts = append(conflicts, Conflict{Requests: requests})
+	}
+	var collect func(threads []CommentThread)
+	collect = func(threads []CommentThread) {
+		for _, thread := range threads {
+			// The first entry of the history is the original comment.
+			if len(thread.History) > 1 {
+				if amendments := conflictingAmendments(thread.History[1:]); amendments != nil {
+					conflicts = append(conflicts, Conflict{Comment: thread.Hash, Amendments: amendments})
+				}
+			}
+			collect(thread.Children)
+		}
+	}
+	collect(r.Comments)
+	return conflicts
+}
+
+// firstLine returns the first line of the given text, for summarizing it.
+func firstLine(text string) string {
+	return strings.SplitN(strings.TrimSpace(text), "\n", 2)[0]
+}
+
+// Alternatives describes each of the conflicting updates, in order, such as
+// `[Mon Jan  2 15:04:05 UTC 2006] "New description" (differs in labels)`.
+func (c Conflict) Alternatives() []string {
+	var alternatives []string
+	for i, version := range c.Requests {
+		alternative := fmt.Sprintf("[%s] %q", reformatTimestamp(version.Timestamp), firstLine(version.Description))
+		if changes := RequestChanges(c.Requests[0], version); i > 0 && len(changes) > 0 {
+			alternative += fmt.Sprintf(" (differs in %s)", strings.Join(changes, ", "))
+		}
+		alternatives = append(alternatives, alternative)
+	}
+	for _, amendment := range c.Amendments {
+		description := fmt.Sprintf("%q", firstLine(amendment.Description))
+		if amendment.Retracted {
+			description = "(retracted)"
+		}
+		alternatives = append(alternatives, fmt.Sprintf("[%s] %s", reformatTimestamp(amendment.Timestamp), description))
+	}
+	return alternatives
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package review
+
+import (
+	"time"
+)
+
+// Dashboard groups the open reviews that are waiting on, or for, a single user.
+type Dashboard struct {
+	// Overdue are the reviews involving the user whose due date has passed.
+	Overdue []Review
+	// Attention are the reviews where it is the user's turn to act.
+	Attention []Review
+	// Authored are the user's own reviews that are waiting for reviewers.
+	Authored []Review
+	// Requested are the reviews where the user is a reviewer, but has not yet commented.
+	Requested []Review
+	// Blocking are the reviews with unresolved comment threads that the user started.
+	Blocking []Review
+}
+
+// hasCommented returns true if the given user wrote any of the comments in the threads.
+func hasCommented(threads []CommentThread, email string) bool {
+	for _, thread := range threads {
+		if identities().Same(thread.Comment.Author, email) || hasCommented(thread.Children, email) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasUnresolvedThread returns true if the given user started any thread that is still unresolved.
+func hasUnresolvedThread(threads []CommentThread, email string) bool {
+	for _, thread := range threads {
+		if identities().Same(thread.Comment.Author, email) && thread.Resolved != nil && !*thread.Resolved {
+			return true
+		}
+		if hasUnresolvedThread(thread.Children, email) {
+			return true
+		}
+	}
+	return false
+}
+
+// PendingReviewers returns the reviewers of the review who have not commented on it.
+func (r *Review) PendingReviewers() []string {
+	var pending []string
+	for _, reviewer := range r.Request.Reviewers {
+		if !hasCommented(r.Comments, reviewer) {
+			pending = append(pending, reviewer)
+		}
+	}
+	return pending
+}
+
+// BuildDashboard selects the open reviews that need the attention of the user with the given email address.
+//
+// A review the user requested is waiting for reviewers if some of them have not
+// commented yet, or if no one has voted on it. Rejected reviews are waiting on
+// the user instead, so they are left out.
+//
+// Overdue reviews are listed in their own group as well, as of the given time.
+func BuildDashboard(reviews []Review, email string, now time.Time) Dashboard {
+	var dashboard Dashboard
+	for _, r := range reviews {
+		if r.IsClosed() {
+			continue
+		}
+		if r.IsRelevantTo(email) && r.IsOverdue(now) {
+			dashboard.Overdue = append(dashboard.Overdue, r)
+		}
+		if r.NeedsAttentionFrom(email) {
+			dashboard.Attention = append(dashboard.Attention, r)
+		}
+		if r.Request.Requester == email {
+			rejected := r.Resolved != nil && !*r.Resolved
+			if !rejected && (r.Resolved == nil || len(r.PendingReviewers()) > 0) {
+				dashboard.Authored = append(dashboard.Authored, r)
+			}
+		} else {
+			for _, reviewer := range r.PendingReviewers() {
+				if reviewer == email {
+					dashboard.Requested = append(dashboard.Requested, r)
+					break
+				}
+			}
+		}
+		if hasUnresolvedThread(r.Comments, email) {
+			dashboard.Blocking = append(dashboard.Blocking, r)
+		}
+	}
+	return dashboard
+}
@@ -0,0 +1,244 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package review
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// commentIndent is the indentation of comments shown inline within a diff.
+const commentIndent = "    "
+
+// threadAnchor identifies the file, and optionally the line, that a comment thread refers to.
+type threadAnchor struct {
+	path string
+	line uint32
+}
+
+func anchorOf(thread CommentThread) threadAnchor {
+	location := thread.Comment.Location
+	if location == nil {
+		return threadAnchor{}
+	}
+	anchor := threadAnchor{path: location.Path}
+	if location.Range != nil {
+		anchor.line = location.Range.StartLine
+	}
+	return anchor
+}
+
+// parseHunkStart returns the first line in the new version of the file covered by the given hunk header.
+//
+// Hunk headers are of the form "@@ -<old start>[,<old count>] +<new start>[,<new count>] @@".
+func parseHunkStart(header string) uint32 {
+	for _, field := range strings.Fields(header) {
+		if strings.HasPrefix(field, "+") {
+			start, err := strconv.ParseUint(strings.SplitN(field[1:], ",", 2)[0], 10, 32)
+			if err == nil {
+				return uint32(start)
+			}
+		}
+	}
+	return 0
+}
+
+// placeThreads determines where the given comment threads should be shown within a unified diff.
+//
+// The returned map is keyed by the index of the diff line after which each
+// thread should be shown. Line comments go after the line they refer to,
+// file comments go after the file's header, and comments on lines outside of
+// the diff go at the end of the file's section. Threads that are not about
+// any of the files in the diff are returned separately.
+func placeThreads(diffLines []string, threads []CommentThread) (map[int][]CommentThread, []CommentThread) {
+	byAnchor := make(map[threadAnchor][]CommentThread)
+	for _, thread := range threads {
+		anchor := anchorOf(thread)
+		byAnchor[anchor] = append(byAnchor[anchor], thread)
+	}
+	placed := make(map[int][]CommentThread)
+	place := func(index int, anchor threadAnchor) {
+		if threads, ok := byAnchor[anchor]; ok {
+			placed[index] = append(placed[index], threads...)
+			delete(byAnchor, anchor)
+		}
+	}
+	// placeRemaining places any comments on lines of the given file that did not appear in the diff.
+	placeRemaining := func(index int, path string) {
+		for anchor := range byAnchor {
+			if anchor.path == path && path != "" {
+				place(index, anchor)
+			}
+		}
+	}
+
+	var path, oldPath string
+	var line uint32
+	inHunk := false
+	for i, diffLine := range diffLines {
+		switch {
+		case strings.HasPrefix(diffLine, "diff "):
+			placeRemaining(i-1, path)
+			path, oldPath, inHunk = "", "", false
+		case !inHunk && strings.HasPrefix(diffLine, "--- "):
+			oldPath = strings.TrimPrefix(diffLine, "--- a/")
+		case !inHunk && strings.HasPrefix(diffLine, "+++ "):
+			path = strings.TrimPrefix(diffLine, "+++ b/")
+			if path == "+++ /dev/null" {
+				path = oldPath
+			}
+			place(i, threadAnchor{path: path})
+		case strings.HasPrefix(diffLine, "@@"):
+			line = parseHunkStart(diffLine)
+			inHunk = true
+		case inHunk && (strings.HasPrefix(diffLine, " ") || strings.HasPrefix(diffLine, "+")):
+			place(i, threadAnchor{path: path, line: line})
+			line++
+		}
+	}
+	placeRemaining(len(diffLines)-1, path)
+
+	var unplaced []CommentThread
+	for _, thread := range threads {
+		if _, ok := byAnchor[anchorOf(thread)]; ok {
+			unplaced = append(unplaced, thread)
+		}
+	}
+	return placed, unplaced
+}
+
+// diffHeaderPath returns the path of the file in a "diff --git a/<path> b/<path>" header line, if it is unambiguous.
+func diffHeaderPath(header string) string {
+	paths := strings.TrimPrefix(header, "diff --git ")
+	if len(paths)%2 == 0 {
+		return ""
+	}
+	oldPath, newPath := paths[:len(paths)/2], paths[len(paths)/2+1:]
+	if strings.HasPrefix(oldPath, "a/") && newPath == "b/"+oldPath[2:] {
+		return oldPath[2:]
+	}
+	return ""
+}
+
+// diffFilePaths returns the path of the file that each line of a unified diff belongs to.
+//
+// Lines before the first file's header belong to no file, and so have an empty path.
+func diffFilePaths(diffLines []string) []string {
+	paths := make([]string, len(diffLines))
+	start := 0
+	var path string
+	inHunk := false
+	for i, diffLine := range diffLines {
+		switch {
+		case strings.HasPrefix(diffLine, "diff "):
+			start, path, inHunk = i, diffHeaderPath(diffLine), false
+		case !inHunk && strings.HasPrefix(diffLine, "+++ b/"):
+			path = strings.TrimPrefix(diffLine, "+++ b/")
+		case !inHunk && strings.HasPrefix(diffLine, "--- a/") && path == "":
+			path = strings.TrimPrefix(diffLine, "--- a/")
+		default:
+			inHunk = inHunk || strings.HasPrefix(diffLine, "@@")
+			paths[i] = path
+			continue
+		}
+		for j := start; j <= i; j++ {
+			paths[j] = path
+		}
+	}
+	return paths
+}
+
+// AnnotatedDiff is the diff of the changes under review, along with the
+// comment threads placed at the parts of the diff they refer to.
+type AnnotatedDiff struct {
+	Lines []string
+	// Threads holds the threads to show after each line, keyed by the line's index.
+	Threads map[int][]CommentThread
+	// General holds the threads on the review as a whole, and Unplaced holds
+	// the threads about files that the diff does not touch.
+	General  []CommentThread
+	Unplaced []CommentThread
+}
+
+// GetAnnotatedDiff returns the diff of the changes under review, with the review's comment threads placed within it.
+func (r *Review) GetAnnotatedDiff() (*AnnotatedDiff, error) {
+	diff, err := r.GetDiff()
+	if err != nil {
+		return nil, err
+	}
+	annotated := &AnnotatedDiff{}
+	if diff != "" {
+		annotated.Lines = strings.Split(diff, "\n")
+	}
+	var located []CommentThread
+	for _, thread := range r.Comments {
+		if anchorOf(thread).path == "" {
+			annotated.General = append(annotated.General, thread)
+		} else {
+			located = append(located, thread)
+		}
+	}
+	annotated.Threads, annotated.Unplaced = placeThreads(annotated.Lines, located)
+	return annotated, nil
+}
+
+// PrintDiff prints the diff of the changes under review, with each comment
+// thread about a file or line shown beneath the part of the diff it refers to.
+//
+// Comment threads on the review as a whole are shown before the diff, and
+// threads about files that the diff does not touch are shown after it.
+//
+// The changes to the given files are collapsed to their header line, although
+// the comment threads on them are still shown.
+func (r *Review) PrintDiff(collapsed []string) error {
+	annotated, err := r.GetAnnotatedDiff()
+	if err != nil {
+		return err
+	}
+	for _, thread := range annotated.General {
+		if err := showThread(thread, "  "); err != nil {
+			return err
+		}
+	}
+	isCollapsed := make(map[string]bool)
+	for _, path := range collapsed {
+		isCollapsed[path] = true
+	}
+	paths := diffFilePaths(annotated.Lines)
+	for i, diffLine := range annotated.Lines {
+		if !isCollapsed[paths[i]] {
+			fmt.Println(colorizeDiffLine(diffLine))
+		} else if strings.HasPrefix(diffLine, "diff ") {
+			fmt.Println(colorizeDiffLine(diffLine))
+			fmt.Println(colorize("meta", "(viewed in this revision; use --show-viewed to show the changes)"))
+		}
+		for _, thread := range annotated.Threads[i] {
+			if err := showThread(thread, commentIndent); err != nil {
+				return err
+			}
+		}
+	}
+	for _, thread := range annotated.Unplaced {
+		location := thread.Comment.Location
+		fmt.Printf("Comment on %s:\n", location.Path)
+		if err := showThread(thread, commentIndent); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package review
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/git-appraise/review/comment"
+)
+
+const sampleDiff = `diff --git a/a.txt b/a.txt
+index 1111111..2222222 100644
+--- a/a.txt
++++ b/a.txt
+@@ -1,3 +1,4 @@
+ one
+-two
++2
++2.5
+ three
+diff --git a/gone.txt b/gone.txt
+deleted file mode 100644
+index 3333333..0000000
+--- a/gone.txt
++++ /dev/null
+@@ -1 +0,0 @@
+-bye`
+
+func threadAt(description, path string, line uint32) CommentThread {
+	location := &comment.Location{Path: path}
+	if line > 0 {
+		location.Range = &comment.Range{StartLine: line}
+	}
+	return CommentThread{Comment: comment.Comment{Description: description, Location: location}}
+}
+
+func TestPlaceThreads(t *testing.T) {
+	diffLines := strings.Split(sampleDiff, "\n")
+	threads := []CommentThread{
+		threadAt("file", "a.txt", 0),
+		threadAt("added", "a.txt", 3),
+		threadAt("context", "a.txt", 4),
+		threadAt("outside", "a.txt", 40),
+		threadAt("deleted", "gone.txt", 0),
+		threadAt("elsewhere", "other.txt", 1),
+	}
+	placed, unplaced := placeThreads(diffLines, threads)
+	expected := map[string]int{
+		"file":    3,
+		"added":   8,
+		"context": 9,
+		"outside": 9,
+		"deleted": 14,
+	}
+	for index, indexThreads := range placed {
+		for _, thread := range indexThreads {
+			description := thread.Comment.Description
+			if expected[description] != index {
+				t.Errorf("Thread %q placed after line %d, expected %d", description, index, expected[description])
+			}
+			delete(expected, description)
+		}
+	}
+	if len(expected) != 0 {
+		t.Errorf("Threads not placed: %v", expected)
+	}
+	if len(unplaced) != 1 || unplaced[0].Comment.Description != "elsewhere" {
+		t.Errorf("Unexpected unplaced threads: %v", unplaced)
+	}
+}
+
+func TestDiffFilePaths(t *testing.T) {
+	diffLines := strings.Split(sampleDiff+"\ndiff --git a/bin b/bin\nBinary files a/bin and b/bin differ", "\n")
+	paths := diffFilePaths(diffLines)
+	for i, expected := range []string{"a.txt", "a.txt", "a.txt", "a.txt", "a.txt", "a.txt", "a.txt", "a.txt", "a.txt", "a.txt",
+		"gone.txt", "gone.txt", "gone.txt", "gone.txt", "gone.txt", "gone.txt", "gone.txt", "bin", "bin"} {
+		if paths[i] != expected {
+			t.Errorf("Unexpected path %q for line %d (%q)", paths[i], i, diffLines[i])
+		}
+	}
+}
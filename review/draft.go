@@ -0,0 +1,167 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package review
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/git-appraise/repository"
+	"github.com/google/git-appraise/review/comment"
+	"github.com/google/git-appraise/review/gpg"
+)
+
+// draftsFile is the name of the file, within the git directory, that holds draft comments.
+//
+// Drafts are kept out of the notes refs, so that they are never shared until they are published.
+const draftsFile = "appraise-drafts"
+
+// Draft is a comment that has been written, but not yet published, along with the review it belongs to.
+type Draft struct {
+	Revision string          `json:"revision"`
+	Comment  comment.Comment `json:"comment"`
+}
+
+func draftsPath() string {
+	return filepath.Join(repository.GetGitDir(), draftsFile)
+}
+
+// loadDrafts reads all of the draft comments, for every review.
+func loadDrafts() ([]Draft, error) {
+	file, err := os.Open(draftsPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var drafts []Draft
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1<<24)
+	for scanner.Scan() {
+		var draft Draft
+		if err := json.Unmarshal(scanner.Bytes(), &draft); err == nil {
+			drafts = append(drafts, draft)
+		}
+	}
+	return drafts, scanner.Err()
+}
+
+// Drafts returns the draft comments on the review, in the order in which they were written.
+func (r *Review) Drafts() ([]Draft, error) {
+	drafts, err := loadDrafts()
+	if err != nil {
+		return nil, err
+	}
+	var reviewDrafts []Draft
+	for _, draft := range drafts {
+		if draft.Revision == r.Revision {
+			reviewDrafts = append(reviewDrafts, draft)
+		}
+	}
+	return reviewDrafts, nil
+}
+
+// AddDraft saves a comment on the review as a draft, to be published later.
+//
+// The comment is given its clock and signed now rather than when it is
+// published, so that its hash (which replies refer to) does not change.
+func (r *Review) AddDraft(c comment.Comment) error {
+	c.Clock = r.nextClock()
+	if gpg.Enabled() {
+		if err := c.Sign(); err != nil {
+			return err
+		}
+	}
+	line, err := json.Marshal(Draft{r.Revision, c})
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(draftsPath(), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// DiscardDrafts deletes all of the draft comments on the review.
+func (r *Review) DiscardDrafts() error {
+	drafts, err := loadDrafts()
+	if err != nil {
+		return err
+	}
+	var lines []string
+	for _, draft := range drafts {
+		if draft.Revision == r.Revision {
+			continue
+		}
+		line, err := json.Marshal(draft)
+		if err != nil {
+			return err
+		}
+		lines = append(lines, string(line)+"\n")
+	}
+	if lines == nil {
+		if err := os.Remove(draftsPath()); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	return ioutil.WriteFile(draftsPath(), []byte(strings.Join(lines, "")), 0644)
+}
+
+// PublishDrafts adds all of the draft comments on the review, followed by the given summary comment, at once.
+//
+// The summary is given a clock after those of the drafts, and the drafts are
+// deleted once they have been published.
+func (r *Review) PublishDrafts(summary comment.Comment) error {
+	drafts, err := r.Drafts()
+	if err != nil {
+		return err
+	}
+	summary.Clock = r.nextClock()
+	for _, draft := range drafts {
+		if draft.Comment.Clock >= summary.Clock {
+			summary.Clock = draft.Comment.Clock + 1
+		}
+	}
+	if gpg.Enabled() {
+		if err := summary.Sign(); err != nil {
+			return err
+		}
+	}
+	var notes []repository.Note
+	for _, draft := range append(drafts, Draft{r.Revision, summary}) {
+		note, err := draft.Comment.Write()
+		if err != nil {
+			return err
+		}
+		notes = append(notes, note)
+	}
+	if err := repository.AppendNotes(comment.Ref, map[string][]repository.Note{r.Revision: notes}); err != nil {
+		return err
+	}
+	return r.DiscardDrafts()
+}
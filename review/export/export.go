@@ -0,0 +1,151 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package export defines the JSON bundles used to copy reviews between repositories.
+//
+// A bundle holds the raw notes of each exported review, under every review
+// notes ref, so requests, comments, CI reports, and any other metadata are
+// carried over unchanged. Since each note is a JSON object, the notes are
+// embedded as is, which keeps the bundle readable.
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/google/git-appraise/repository"
+)
+
+// FormatVersion defines the latest version of the bundle format supported by the tool.
+const FormatVersion = 1
+
+// ObjectNotes holds the notes on a single object under a single notes ref.
+type ObjectNotes struct {
+	Ref    string            `json:"ref"`
+	Object string            `json:"object"`
+	Notes  []json.RawMessage `json:"notes"`
+}
+
+// Entry holds all of the notes belonging to a single review.
+type Entry struct {
+	Revision string        `json:"revision"`
+	Notes    []ObjectNotes `json:"notes"`
+}
+
+// Bundle is the top-level object of an exported file.
+type Bundle struct {
+	// Version represents the version of the bundle format.
+	Version   int     `json:"v"`
+	Timestamp string  `json:"timestamp"`
+	Reviews   []Entry `json:"reviews"`
+}
+
+// New returns an empty bundle of the latest version.
+func New() Bundle {
+	return Bundle{
+		Version:   FormatVersion,
+		Timestamp: strconv.FormatInt(time.Now().Unix(), 10),
+		Reviews:   []Entry{},
+	}
+}
+
+// Add adds a review to the bundle, given its notes keyed by notes ref and then by object.
+//
+// Notes that are not valid JSON are left out, as the tool ignores those anyway.
+// The number of notes added is returned.
+func (b *Bundle) Add(revision string, notes map[string]map[string][]repository.Note) int {
+	var added int
+	entry := Entry{Revision: revision, Notes: []ObjectNotes{}}
+	var refs []string
+	for ref := range notes {
+		refs = append(refs, ref)
+	}
+	sort.Strings(refs)
+	for _, ref := range refs {
+		var objects []string
+		for object := range notes[ref] {
+			objects = append(objects, object)
+		}
+		sort.Strings(objects)
+		for _, object := range objects {
+			objectNotes := ObjectNotes{Ref: ref, Object: object}
+			for _, note := range notes[ref][object] {
+				if json.Valid([]byte(note)) {
+					objectNotes.Notes = append(objectNotes.Notes, json.RawMessage(note))
+				}
+			}
+			if len(objectNotes.Notes) > 0 {
+				entry.Notes = append(entry.Notes, objectNotes)
+				added += len(objectNotes.Notes)
+			}
+		}
+	}
+	b.Reviews = append(b.Reviews, entry)
+	return added
+}
+
+// NotesByRef groups the notes in the bundle by notes ref and then by object, ready to be merged.
+//
+// The notes are compacted back to the single-line form in which notes are stored.
+func (b Bundle) NotesByRef() (map[string]map[string][]repository.Note, error) {
+	result := make(map[string]map[string][]repository.Note)
+	for _, entry := range b.Reviews {
+		for _, objectNotes := range entry.Notes {
+			if result[objectNotes.Ref] == nil {
+				result[objectNotes.Ref] = make(map[string][]repository.Note)
+			}
+			for _, note := range objectNotes.Notes {
+				var compact bytes.Buffer
+				if err := json.Compact(&compact, note); err != nil {
+					return nil, fmt.Errorf("Invalid note on %s under %s: %v", objectNotes.Object, objectNotes.Ref, err)
+				}
+				result[objectNotes.Ref][objectNotes.Object] = append(result[objectNotes.Ref][objectNotes.Object], repository.Note(compact.String()))
+			}
+		}
+	}
+	return result, nil
+}
+
+// Write writes the bundle as indented JSON.
+//
+// The notes are written without escaping any characters that they did not
+// already escape, so that compacting them again restores the original notes.
+func (b Bundle) Write(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(b)
+}
+
+// Read reads a bundle written by Write.
+//
+// Bundles written by a newer version of the tool are rejected, since they
+// may hold data that this version would silently drop.
+func Read(r io.Reader) (Bundle, error) {
+	var b Bundle
+	if err := json.NewDecoder(r).Decode(&b); err != nil {
+		return b, fmt.Errorf("Invalid review bundle: %v", err)
+	}
+	if b.Version < 1 || b.Version > FormatVersion {
+		return b, fmt.Errorf("Unsupported review bundle version %d; this tool supports up to version %d", b.Version, FormatVersion)
+	}
+	return b, nil
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package export
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/google/git-appraise/repository"
+)
+
+func TestWriteThenRead(t *testing.T) {
+	b := New()
+	added := b.Add("abcd", map[string]map[string][]repository.Note{
+		"refs/notes/devtools/reviews": map[string][]repository.Note{
+			"abcd": []repository.Note{repository.Note(`{"targetRef":"refs/heads/master"}`), repository.Note("not json")},
+		},
+		"refs/notes/devtools/discuss": map[string][]repository.Note{
+			"abcd": []repository.Note{repository.Note(`{"description":"a < b"}`)},
+		},
+		"refs/notes/devtools/ci": map[string][]repository.Note{
+			"ef01": []repository.Note{repository.Note(`{"status":"success"}`)},
+		},
+	})
+	if added != 3 {
+		t.Errorf("Unexpected number of notes added: %d", added)
+	}
+	var buffer bytes.Buffer
+	if err := b.Write(&buffer); err != nil {
+		t.Fatal(err)
+	}
+	read, err := Read(&buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	notes, err := read.NotesByRef()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(notes) != 3 || len(notes["refs/notes/devtools/reviews"]["abcd"]) != 1 {
+		t.Fatalf("Unexpected notes: %v", notes)
+	}
+	if note := string(notes["refs/notes/devtools/discuss"]["abcd"][0]); note != `{"description":"a < b"}` {
+		t.Errorf("The note was not restored exactly: %q", note)
+	}
+	if note := string(notes["refs/notes/devtools/ci"]["ef01"][0]); note != `{"status":"success"}` {
+		t.Errorf("Unexpected CI note: %q", note)
+	}
+}
+
+func TestReadRejectsNewerVersions(t *testing.T) {
+	if _, err := Read(strings.NewReader(`{"v": 99, "reviews": []}`)); err == nil {
+		t.Error("Expected a bundle from a newer version to be rejected")
+	}
+	if _, err := Read(strings.NewReader(`{"reviews": []}`)); err == nil {
+		t.Error("Expected a bundle without a version to be rejected")
+	}
+}
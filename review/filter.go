@@ -0,0 +1,130 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package review
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/git-appraise/review/request"
+)
+
+// Values for the Status field of a Filter.
+const (
+	StatusOpen      = "open"
+	StatusSubmitted = "submitted"
+	StatusAbandoned = "abandoned"
+)
+
+// Filter describes which reviews to select when listing them.
+//
+// Empty fields match every review, and a review must match all of the
+// non-empty fields in order to be selected.
+type Filter struct {
+	// Author and Reviewer are matched against the requester and reviewers (ignoring case).
+	Author   string
+	Reviewer string
+	// Status is one of StatusOpen, StatusSubmitted, or StatusAbandoned.
+	Status string
+	// Target is matched against the target ref, either in full or as a branch name.
+	Target string
+	// Since selects reviews with activity at or after the given time.
+	Since time.Time
+	// IdleSince selects the open reviews with no activity since the given time.
+	IdleSince time.Time
+	// OverdueAt selects the open reviews whose due date had passed at the given time.
+	OverdueAt time.Time
+	// Label selects reviews with the given label (ignoring case).
+	Label string
+	// Milestone selects reviews attached to the given milestone.
+	Milestone string
+	// Priority selects reviews with the given priority or a more urgent one.
+	Priority string
+	// Attention selects the open reviews where it is the given user's turn to act.
+	Attention string
+}
+
+// Validate checks that the filter's fields have supported values.
+func (f Filter) Validate() error {
+	if f.Priority != "" {
+		if err := request.ValidatePriority(f.Priority); err != nil {
+			return err
+		}
+	}
+	switch f.Status {
+	case "", StatusOpen, StatusSubmitted, StatusAbandoned:
+		return nil
+	}
+	return fmt.Errorf("Unknown status %q; it must be one of %q, %q, or %q", f.Status, StatusOpen, StatusSubmitted, StatusAbandoned)
+}
+
+// Matches reports whether the given review is selected by the filter.
+func (f Filter) Matches(r Review) bool {
+	if f.Author != "" && !identities().Same(f.Author, r.Request.Requester) {
+		return false
+	}
+	if f.Reviewer != "" {
+		found := false
+		for _, reviewer := range r.Request.Reviewers {
+			if identities().Same(f.Reviewer, reviewer) {
+				found = true
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	switch f.Status {
+	case StatusOpen:
+		if r.IsClosed() {
+			return false
+		}
+	case StatusSubmitted:
+		if !r.Submitted {
+			return false
+		}
+	case StatusAbandoned:
+		if !r.Abandoned {
+			return false
+		}
+	}
+	if f.Target != "" && f.Target != r.Request.TargetRef && "refs/heads/"+f.Target != r.Request.TargetRef {
+		return false
+	}
+	if f.Priority != "" && r.Request.PriorityRank() > (request.Request{Priority: f.Priority}).PriorityRank() {
+		return false
+	}
+	if f.Attention != "" && !r.NeedsAttentionFrom(f.Attention) {
+		return false
+	}
+	if f.Label != "" && !r.Request.HasLabel(f.Label) {
+		return false
+	}
+	if f.Milestone != "" && f.Milestone != r.Request.Milestone {
+		return false
+	}
+	if !f.Since.IsZero() && r.LastActivity().Before(f.Since) {
+		return false
+	}
+	if !f.IdleSince.IsZero() && !r.IsStale(f.IdleSince) {
+		return false
+	}
+	if !f.OverdueAt.IsZero() && !r.IsOverdue(f.OverdueAt) {
+		return false
+	}
+	return true
+}
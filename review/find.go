@@ -0,0 +1,109 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package review
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/google/git-appraise/repository"
+)
+
+// abbreviatedHashPattern matches strings that could be abbreviated commit hashes.
+var abbreviatedHashPattern = regexp.MustCompile(`^[0-9a-fA-F]{4,40}$`)
+
+// AmbiguousError is returned by Find when more than one review matches.
+type AmbiguousError struct {
+	Spec    string
+	Matches []Summary
+}
+
+func (e *AmbiguousError) Error() string {
+	var message strings.Builder
+	fmt.Fprintf(&message, "%q matches %d reviews:", e.Spec, len(e.Matches))
+	for _, match := range e.Matches {
+		r := match.Review()
+		title := strings.SplitN(strings.TrimSpace(r.Request.Description), "\n", 2)[0]
+		fmt.Fprintf(&message, "\n  %s [%s] %s", abbreviate(r.Revision), r.Status(), title)
+	}
+	return message.String()
+}
+
+// Find returns the review identified by the given string, which is one of:
+//
+// 1. A commit to which a review is attached, given as anything git can resolve.
+// 2. The name of a review's branch, or its full ref.
+// 3. An abbreviated hash of the commit to which a review is attached.
+// 4. A substring of a review's description, ignoring case.
+//
+// These are tried in order, and the first that matches any reviews is used.
+// If it matches more than one, an *AmbiguousError lists them, except that a
+// branch matching a single open review (and any closed ones) identifies it.
+// If nothing matches, the returned review is nil.
+func Find(spec string) (*Review, error) {
+	if commit, err := repository.ResolveCommit(spec); err == nil {
+		if r := Get(commit); r != nil {
+			return r, nil
+		}
+	}
+
+	var summaries []Summary
+	collect := func(s Summary) error {
+		summaries = append(summaries, s)
+		return nil
+	}
+	if err := ForEachSummary(collect); err != nil {
+		return nil, err
+	}
+	if err := ForEachArchivedSummary(collect); err != nil {
+		return nil, err
+	}
+
+	matchers := []func(Summary) bool{
+		func(s Summary) bool {
+			return s.Request.ReviewRef == spec || s.Request.ReviewRef == "refs/heads/"+spec
+		},
+		func(s Summary) bool {
+			return abbreviatedHashPattern.MatchString(spec) && strings.HasPrefix(s.Revision, strings.ToLower(spec))
+		},
+		func(s Summary) bool {
+			return strings.Contains(strings.ToLower(s.Request.Description), strings.ToLower(spec))
+		},
+	}
+	for i, matches := range matchers {
+		var found, open []Summary
+		for _, s := range summaries {
+			if matches(s) {
+				found = append(found, s)
+				if r := s.Review(); !r.IsClosed() {
+					open = append(open, s)
+				}
+			}
+		}
+		if i == 0 && len(open) == 1 {
+			found = open
+		}
+		switch {
+		case len(found) == 1:
+			return Get(found[0].Revision), nil
+		case len(found) > 1:
+			return nil, &AmbiguousError{Spec: spec, Matches: found}
+		}
+	}
+	return nil, nil
+}
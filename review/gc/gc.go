@@ -0,0 +1,111 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gc compacts the git-notes used to store reviews.
+//
+// Merging notes with the "cat_sort_uniq" strategy only removes lines that are
+// byte-for-byte identical, so the same item can accumulate multiple times if
+// it was ever serialized differently (e.g. with a different field order, or
+// separated by the blank lines that "git notes append" inserts). This package
+// rewrites the notes so that each item appears exactly once.
+package gc
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/google/git-appraise/repository"
+)
+
+// Result summarizes the changes made to a single notes ref.
+type Result struct {
+	Ref            string
+	RewrittenNotes int
+	RemovedLines   int
+}
+
+// canonicalize returns a key that is identical for semantically identical notes.
+//
+// Notes that are not valid JSON are only considered identical if they are
+// byte-for-byte identical after trimming surrounding whitespace.
+func canonicalize(note repository.Note) string {
+	trimmed := strings.TrimSpace(string(note))
+	var value interface{}
+	if err := json.Unmarshal([]byte(trimmed), &value); err != nil {
+		return trimmed
+	}
+	// Marshalling a generic value sorts object keys, which gives us a canonical form.
+	canonical, err := json.Marshal(value)
+	if err != nil {
+		return trimmed
+	}
+	return string(canonical)
+}
+
+// Dedupe removes blank lines and semantically duplicate items from a sequence of notes.
+//
+// The first occurrence of each item is kept, along with its original
+// serialization, so that hashes computed over the raw note (such as comment
+// hashes) are preserved.
+func Dedupe(notes []repository.Note) []repository.Note {
+	seen := make(map[string]bool)
+	var result []repository.Note
+	for _, note := range notes {
+		key := canonicalize(note)
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		result = append(result, note)
+	}
+	return result
+}
+
+// CollectRef deduplicates every note in the given ref.
+//
+// If dryRun is true, then the changes are computed but not written.
+func CollectRef(notesRef string, dryRun bool) (Result, error) {
+	result := Result{Ref: notesRef}
+	rewritten := make(map[string][]repository.Note)
+	for _, object := range repository.ListNotedObjects(notesRef) {
+		notes := repository.GetNotes(notesRef, object)
+		deduped := Dedupe(notes)
+		if len(deduped) < len(notes) {
+			rewritten[object] = deduped
+			result.RewrittenNotes++
+			result.RemovedLines += len(notes) - len(deduped)
+		}
+	}
+	if dryRun || len(rewritten) == 0 {
+		return result, nil
+	}
+	message := fmt.Sprintf("Notes compacted by 'git appraise gc'\n\nRemoved %d redundant lines from %d notes.\n", result.RemovedLines, result.RewrittenNotes)
+	return result, repository.RewriteNotes(notesRef, rewritten, message)
+}
+
+// Collect deduplicates the notes in every ref matching the given pattern.
+func Collect(notesRefPattern string, dryRun bool) ([]Result, error) {
+	var results []Result
+	for _, notesRef := range repository.ListRefs(notesRefPattern) {
+		result, err := CollectRef(notesRef, dryRun)
+		if err != nil {
+			return results, err
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
@@ -0,0 +1,42 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gc
+
+import (
+	"testing"
+
+	"github.com/google/git-appraise/repository"
+)
+
+func TestDedupe(t *testing.T) {
+	notes := []repository.Note{
+		repository.Note(`{"timestamp":"0123456789","targetRef":"refs/heads/master"}`),
+		repository.Note(""),
+		repository.Note(`{"targetRef":"refs/heads/master", "timestamp":"0123456789"}`),
+		repository.Note("not json"),
+		repository.Note(""),
+		repository.Note("not json "),
+		repository.Note(`{"timestamp":"0123456790","targetRef":"refs/heads/master"}`),
+	}
+	deduped := Dedupe(notes)
+	if len(deduped) != 3 {
+		t.Fatalf("Unexpected deduplicated notes: %q", deduped)
+	}
+	if string(deduped[0]) != string(notes[0]) || string(deduped[1]) != "not json" || string(deduped[2]) != string(notes[6]) {
+		t.Fatalf("Unexpected deduplicated notes: %q", deduped)
+	}
+}
@@ -0,0 +1,160 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gpg signs review notes, and verifies the signatures on them.
+//
+// Signatures are detached, ASCII-armored GPG signatures over the JSON
+// serialization of a note with its signature field left empty. The gpg
+// program and key are taken from the same git config settings that git
+// uses for signing commits ("gpg.program" and "user.signingkey").
+package gpg
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/google/git-appraise/repository"
+)
+
+// SignConfig is the git config setting that enables signing every note written by the tool.
+const SignConfig = "appraise.signNotes"
+
+// Status describes the result of verifying the signature on a note.
+type Status string
+
+const (
+	// StatusUnsigned indicates that the note does not have a signature.
+	StatusUnsigned Status = "unsigned"
+	// StatusGood indicates that the note was signed by a trusted key belonging to its author.
+	StatusGood Status = "good"
+	// StatusUntrusted indicates that the signature is valid and its key claims to
+	// belong to the note's author, but the key is not trusted, so anyone could have made it.
+	StatusUntrusted Status = "untrusted"
+	// StatusBad indicates that the signature does not match the note, or was made by someone other than its author.
+	StatusBad Status = "bad"
+	// StatusUnknown indicates that the signature could not be checked, e.g. because the public key is missing.
+	StatusUnknown Status = "unknown"
+)
+
+// Enabled returns true if the user has configured the tool to sign notes.
+func Enabled() bool {
+	return repository.GetConfig(SignConfig) == "true"
+}
+
+func program() string {
+	if program := repository.GetConfig("gpg.program"); program != "" {
+		return program
+	}
+	return "gpg"
+}
+
+// KeyID returns the configured signing key, or the empty string if gpg's default key is used.
+func KeyID() string {
+	return repository.GetConfig("user.signingkey")
+}
+
+// sign returns a detached signature of the given payload.
+func sign(payload []byte, armor bool) ([]byte, error) {
+	args := []string{"--detach-sign"}
+	if armor {
+		args = append(args, "--armor")
+	}
+	if key := KeyID(); key != "" {
+		args = append(args, "--local-user", key)
+	}
+	cmd := exec.Command(program(), args...)
+	cmd.Stdin = bytes.NewReader(payload)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to sign: %v\n%s", err, stderr.String())
+	}
+	return out, nil
+}
+
+// Sign returns an ASCII-armored detached signature of the given payload.
+func Sign(payload []byte) (string, error) {
+	signature, err := sign(payload, true)
+	return string(signature), err
+}
+
+// SignBinary returns a binary detached signature of the given payload.
+func SignBinary(payload []byte) ([]byte, error) {
+	return sign(payload, false)
+}
+
+// Verify checks that the given signature is a valid signature of the payload by the given author.
+func Verify(payload []byte, signature, author string) Status {
+	if signature == "" {
+		return StatusUnsigned
+	}
+	sigFile, err := ioutil.TempFile("", "appraise-signature")
+	if err != nil {
+		return StatusUnknown
+	}
+	defer os.Remove(sigFile.Name())
+	_, err = sigFile.WriteString(signature)
+	sigFile.Close()
+	if err != nil {
+		return StatusUnknown
+	}
+
+	cmd := exec.Command(program(), "--status-fd=1", "--verify", sigFile.Name(), "-")
+	cmd.Stdin = bytes.NewReader(payload)
+	// The exit code is non-zero for bad signatures, but the status output is what we care about.
+	out, _ := cmd.Output()
+	return parseStatus(string(out), author)
+}
+
+// parseStatus interprets the machine-readable status output of "gpg --verify".
+//
+// A signature is only good if gpg validated it and fully (or ultimately)
+// trusts its key, as otherwise anyone could create a key with the author's
+// email address.
+func parseStatus(statusOutput, author string) Status {
+	var good, valid, trusted bool
+	for _, line := range strings.Split(statusOutput, "\n") {
+		fields := strings.SplitN(line, " ", 4)
+		if len(fields) < 2 || fields[0] != "[GNUPG:]" {
+			continue
+		}
+		switch fields[1] {
+		case "BADSIG":
+			return StatusBad
+		case "GOODSIG":
+			if len(fields) == 4 && author != "" && !strings.Contains(fields[3], "<"+author+">") {
+				return StatusBad
+			}
+			good = true
+		case "VALIDSIG":
+			valid = true
+		case "TRUST_FULLY", "TRUST_ULTIMATE":
+			trusted = true
+		}
+	}
+	if !good {
+		return StatusUnknown
+	}
+	if !valid || !trusted {
+		return StatusUntrusted
+	}
+	return StatusGood
+}
@@ -0,0 +1,43 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gpg
+
+import (
+	"testing"
+)
+
+func TestParseStatus(t *testing.T) {
+	good := "[GNUPG:] NEWSIG\n[GNUPG:] GOODSIG 0123456789ABCDEF Jane Doe <jane@example.com>\n[GNUPG:] VALIDSIG ...\n[GNUPG:] TRUST_FULLY 0 pgp\n"
+	if status := parseStatus(good, "jane@example.com"); status != StatusGood {
+		t.Fatalf("Unexpected status for a good signature: %v", status)
+	}
+	untrusted := "[GNUPG:] NEWSIG\n[GNUPG:] GOODSIG 0123456789ABCDEF Jane Doe <jane@example.com>\n[GNUPG:] VALIDSIG ...\n[GNUPG:] TRUST_UNDEFINED 0 pgp\n"
+	if status := parseStatus(untrusted, "jane@example.com"); status != StatusUntrusted {
+		t.Fatalf("Unexpected status for a signature by an untrusted key: %v", status)
+	}
+	if status := parseStatus(good, "john@example.com"); status != StatusBad {
+		t.Fatalf("Unexpected status for a signature by someone else: %v", status)
+	}
+	bad := "[GNUPG:] NEWSIG\n[GNUPG:] BADSIG 0123456789ABCDEF Jane Doe <jane@example.com>\n"
+	if status := parseStatus(bad, "jane@example.com"); status != StatusBad {
+		t.Fatalf("Unexpected status for a bad signature: %v", status)
+	}
+	missingKey := "[GNUPG:] NEWSIG\n[GNUPG:] ERRSIG 0123456789ABCDEF 1 8 00 1444000000 9\n[GNUPG:] NO_PUBKEY 0123456789ABCDEF\n"
+	if status := parseStatus(missingKey, "jane@example.com"); status != StatusUnknown {
+		t.Fatalf("Unexpected status for a missing key: %v", status)
+	}
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package review
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/google/git-appraise/review/request"
+)
+
+// RequestChanges describes what differs between two versions of a review request.
+func RequestChanges(before, after request.Request) []string {
+	var changes []string
+	if before.Description != after.Description {
+		changes = append(changes, "description")
+	}
+	if before.TargetRef != after.TargetRef {
+		changes = append(changes, "target "+after.TargetRef)
+	}
+	if !reflect.DeepEqual(before.Reviewers, after.Reviewers) {
+		changes = append(changes, "reviewers")
+	}
+	if !reflect.DeepEqual(before.DependsOn, after.DependsOn) {
+		changes = append(changes, "dependencies")
+	}
+	if !reflect.DeepEqual(before.Labels, after.Labels) {
+		changes = append(changes, "labels")
+	}
+	if !reflect.DeepEqual(before.Checklist, after.Checklist) {
+		changes = append(changes, "checklist")
+	}
+	if before.Milestone != after.Milestone {
+		changes = append(changes, "milestone")
+	}
+	if before.Priority != after.Priority || before.Due != after.Due {
+		changes = append(changes, "schedule")
+	}
+	if before.Alias != after.Alias {
+		changes = append(changes, "rebased")
+	}
+	if before.SubmittedAs != after.SubmittedAs && after.SubmittedAs != "" {
+		changes = append(changes, "submitted")
+	}
+	if !before.Abandoned && after.Abandoned {
+		changes = append(changes, "abandoned")
+	}
+	if before.Abandoned && !after.Abandoned || !before.Reopened && after.Reopened || before.SubmittedAs != "" && after.SubmittedAs == "" {
+		changes = append(changes, "reopened")
+	}
+	return changes
+}
+
+// printHistory prints a line for each update made to the review request.
+func (r *Review) printHistory() {
+	if len(r.History) == 0 {
+		return
+	}
+	fmt.Println("  history:")
+	versions := append(append([]request.Request(nil), r.History...), r.Request)
+	fmt.Printf("    [%s] requested\n", reformatTimestamp(versions[0].Timestamp))
+	for i := 1; i < len(versions); i++ {
+		changes := RequestChanges(versions[i-1], versions[i])
+		if len(changes) == 0 {
+			changes = []string{"no changes"}
+		}
+		fmt.Printf("    [%s] %s\n", reformatTimestamp(versions[i].Timestamp), strings.Join(changes, ", "))
+	}
+}
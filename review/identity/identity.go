@@ -0,0 +1,214 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package identity maps the email addresses that people use to the single identity they review under.
+//
+// Identities are read from the ".appraise/identities" file at HEAD, followed
+// by the local file named by the "appraise.identities" git config setting.
+// Both use the syntax of git's mailmap files, with an optional avatar URL:
+//
+//	Jane Doe <jane@example.com> https://example.com/jane.png
+//	<jane@example.com> <jdoe@old-employer.com>
+//	Jane Doe <jane@example.com> Jane <jane@laptop.local>
+//
+// The first address on each line is the canonical one, and any later address
+// is an alias of it. Names given alongside aliases are ignored.
+package identity
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/google/git-appraise/repository"
+)
+
+const (
+	// File is the path, within the repository, of the shared identity file.
+	File = ".appraise/identities"
+	// Config is the git config setting naming a local identity file.
+	Config = "appraise.identities"
+)
+
+// Identity describes a person.
+type Identity struct {
+	// Email is the person's canonical email address.
+	Email  string
+	Name   string
+	Avatar string
+}
+
+// String returns the person's name and email address, or just the address if their name is not known.
+func (i Identity) String() string {
+	if i.Name == "" {
+		return i.Email
+	}
+	return i.Name + " <" + i.Email + ">"
+}
+
+// Map holds the known identities. A nil map knows no one, so that every
+// address is its own canonical address.
+type Map struct {
+	identities map[string]*Identity
+	// aliases maps each lower-cased address to the lower-cased canonical one.
+	aliases map[string]string
+	// source is the concatenated contents of the identity files.
+	source string
+}
+
+// addressPattern matches an optional name followed by an email address in angle brackets.
+var addressPattern = regexp.MustCompile(`\s*([^<>]*?)\s*<([^<>]+)>`)
+
+// Parse reads the given contents of an identity file into the map.
+func (m *Map) Parse(contents string) error {
+	if m.identities == nil {
+		m.identities = make(map[string]*Identity)
+		m.aliases = make(map[string]string)
+	}
+	scanner := bufio.NewScanner(strings.NewReader(contents))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if i := strings.Index(line, "#"); i >= 0 && !strings.Contains(line[:i], "://") {
+			line = strings.TrimSpace(line[:i])
+		}
+		if line == "" {
+			continue
+		}
+		matches := addressPattern.FindAllStringSubmatchIndex(line, -1)
+		if len(matches) == 0 || matches[0][0] != 0 {
+			return fmt.Errorf("Invalid line %q in the identities; it must start with an email address in angle brackets", line)
+		}
+		end := matches[len(matches)-1][1]
+		avatar := strings.TrimSpace(line[end:])
+		if avatar != "" && !strings.Contains(avatar, "://") {
+			return fmt.Errorf("Invalid avatar URL %q in the identities", avatar)
+		}
+		name := line[matches[0][2]:matches[0][3]]
+		email := strings.TrimSpace(line[matches[0][4]:matches[0][5]])
+		key := strings.ToLower(email)
+		identity, ok := m.identities[key]
+		if !ok {
+			identity = &Identity{Email: email}
+			m.identities[key] = identity
+		}
+		if name != "" {
+			identity.Name = name
+		}
+		if avatar != "" {
+			identity.Avatar = avatar
+		}
+		for _, match := range matches[1:] {
+			alias := strings.ToLower(strings.TrimSpace(line[match[4]:match[5]]))
+			if alias != key {
+				m.aliases[alias] = key
+			}
+		}
+	}
+	m.source += contents
+	return scanner.Err()
+}
+
+// Load reads the shared and local identity files.
+//
+// Missing files are skipped, so the map is empty if neither exists.
+func Load() (*Map, error) {
+	m := &Map{}
+	if contents, err := repository.GetFileContents("HEAD", File); err == nil {
+		if err := m.Parse(contents); err != nil {
+			return m, fmt.Errorf("%s: %v", File, err)
+		}
+	}
+	if path := repository.GetConfig(Config); path != "" {
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			return m, err
+		}
+		if err := m.Parse(string(contents)); err != nil {
+			return m, fmt.Errorf("%s: %v", path, err)
+		}
+	}
+	return m, nil
+}
+
+var (
+	defaultMutex  sync.Mutex
+	defaultLoaded bool
+	defaultMap    *Map
+	defaultErr    error
+)
+
+func init() {
+	repository.OnRepoSwitch(resetDefault)
+}
+
+// resetDefault forgets the identities of the previous repository.
+func resetDefault() {
+	defaultMutex.Lock()
+	defaultLoaded = false
+	defaultMap, defaultErr = nil, nil
+	defaultMutex.Unlock()
+}
+
+// Default returns the identities of the current repository, which are loaded
+// once for each repository.
+//
+// If the identity files are invalid, the identities read before the error are
+// returned, along with that error.
+func Default() (*Map, error) {
+	defaultMutex.Lock()
+	defer defaultMutex.Unlock()
+	if !defaultLoaded {
+		defaultMap, defaultErr = Load()
+		defaultLoaded = true
+	}
+	return defaultMap, defaultErr
+}
+
+// Canonical returns the canonical address of the person using the given email address.
+func (m *Map) Canonical(email string) string {
+	return m.Lookup(email).Email
+}
+
+// Lookup returns the identity of the person using the given email address.
+func (m *Map) Lookup(email string) Identity {
+	if m == nil {
+		return Identity{Email: email}
+	}
+	key := strings.ToLower(email)
+	if canonical, ok := m.aliases[key]; ok {
+		key = canonical
+	}
+	if identity, ok := m.identities[key]; ok {
+		return *identity
+	}
+	return Identity{Email: email}
+}
+
+// Same reports whether the given email addresses belong to the same person, ignoring case.
+func (m *Map) Same(a, b string) bool {
+	return strings.EqualFold(m.Canonical(a), m.Canonical(b))
+}
+
+// Source returns the contents the identities were read from, which identify the mapping.
+func (m *Map) Source() string {
+	if m == nil {
+		return ""
+	}
+	return m.source
+}
@@ -0,0 +1,71 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package identity
+
+import (
+	"testing"
+)
+
+const testIdentities = `# The team.
+Jane Doe <jane@example.com> https://example.com/jane.png
+<jane@example.com> <JDoe@old.example.com>
+Jane <jane@example.com> Jane <jane@laptop.local>
+<bob@example.com> <robert@example.com>
+`
+
+func TestParse(t *testing.T) {
+	m := &Map{}
+	if err := m.Parse(testIdentities); err != nil {
+		t.Fatal(err)
+	}
+	jane := Identity{Email: "jane@example.com", Name: "Jane", Avatar: "https://example.com/jane.png"}
+	for _, email := range []string{"jane@example.com", "jdoe@old.example.com", "jane@laptop.local"} {
+		if got := m.Lookup(email); got != jane {
+			t.Errorf("Lookup(%q) = %+v, want %+v", email, got, jane)
+		}
+	}
+	if got := m.Canonical("Robert@example.com"); got != "bob@example.com" {
+		t.Errorf("Canonical(alias) = %q", got)
+	}
+	if got := m.Canonical("carol@example.com"); got != "carol@example.com" {
+		t.Errorf("Canonical(unknown) = %q", got)
+	}
+	if !m.Same("bob@example.com", "robert@example.com") || m.Same("bob@example.com", "jane@example.com") {
+		t.Errorf("Same() did not follow the aliases")
+	}
+	if got := m.Lookup("jane@example.com").String(); got != "Jane <jane@example.com>" {
+		t.Errorf("String() = %q", got)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, contents := range []string{"jane@example.com", "Jane <jane@example.com> not-a-url"} {
+		if err := (&Map{}).Parse(contents); err == nil {
+			t.Errorf("Parse(%q) succeeded", contents)
+		}
+	}
+}
+
+func TestNilMap(t *testing.T) {
+	var m *Map
+	if got := m.Canonical("jane@example.com"); got != "jane@example.com" {
+		t.Errorf("Canonical() = %q", got)
+	}
+	if !m.Same("Jane@example.com", "jane@example.com") {
+		t.Errorf("Same() should ignore case")
+	}
+}
@@ -0,0 +1,101 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package review
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/google/git-appraise/repository"
+)
+
+// commentedRevisions returns the commits that the given threads comment upon, oldest comment first.
+//
+// If the author is not empty, then only that author's comments are included.
+func commentedRevisions(threads []CommentThread, author string) []string {
+	var comments []CommentThread
+	var collect func(threads []CommentThread)
+	collect = func(threads []CommentThread) {
+		for _, thread := range threads {
+			if thread.Comment.Location != nil && thread.Comment.Location.Commit != "" &&
+				(author == "" || thread.Comment.Author == author) {
+				comments = append(comments, thread)
+			}
+			collect(thread.Children)
+		}
+	}
+	collect(threads)
+	sort.Stable(byClock(comments))
+	var revisions []string
+	seen := make(map[string]bool)
+	for _, thread := range comments {
+		commit := thread.Comment.Location.Commit
+		if !seen[commit] {
+			seen[commit] = true
+			revisions = append(revisions, commit)
+		}
+	}
+	return revisions
+}
+
+// Revisions returns the versions of the review that have been commented upon,
+// in the order they were first commented on, followed by the current version
+// if that has not been commented upon yet.
+func (r *Review) Revisions() []string {
+	revisions := commentedRevisions(r.Comments, "")
+	if head, err := repository.ResolveCommit(r.Request.ReviewRef); err == nil {
+		for _, revision := range revisions {
+			if revision == head {
+				return revisions
+			}
+		}
+		revisions = append(revisions, head)
+	}
+	return revisions
+}
+
+// LastReviewedRevision returns the version of the review that the given user
+// most recently commented on, or an empty string if they have not commented.
+func (r *Review) LastReviewedRevision(email string) string {
+	revisions := commentedRevisions(r.Comments, email)
+	if len(revisions) == 0 {
+		return ""
+	}
+	return revisions[len(revisions)-1]
+}
+
+// GetInterdiff returns the changes between two versions of the review,
+// excluding any changes brought in by rebasing onto a newer target.
+//
+// If the older version cannot be replayed onto the newer one's base, then
+// a commit-by-commit comparison from "git range-diff" is returned instead,
+// and rangeDiff is set.
+func (r *Review) GetInterdiff(from, to string) (diff string, rangeDiff bool, err error) {
+	bases := make([]string, 2)
+	for i, revision := range []string{from, to} {
+		bases[i], err = repository.MergeBase(r.Request.TargetRef, revision)
+		if err != nil {
+			return "", false, fmt.Errorf("Cannot determine the base of %q: %v", revision, err)
+		}
+	}
+	diff, err = repository.GetInterdiff(bases[0], from, bases[1], to)
+	if err == repository.ErrInterdiffConflict {
+		diff, err = repository.GetRangeDiff(bases[0], from, bases[1], to)
+		return diff, true, err
+	}
+	return diff, false, err
+}
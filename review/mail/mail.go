@@ -0,0 +1,381 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package mail formats review requests and comments as email messages, and
+// parses replies to those messages back into comments.
+//
+// Every message has a Message-ID derived from the review's revision (and the
+// comment's hash, for comments), so that replies can be traced back to what
+// they reply to through their In-Reply-To and References headers.
+package mail
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/git-appraise/review/comment"
+	"github.com/google/git-appraise/review/request"
+)
+
+// Message is an email message about a review.
+type Message struct {
+	From       string
+	To         []string
+	Cc         []string
+	Subject    string
+	Date       time.Time
+	MessageID  string
+	InReplyTo  string
+	References []string
+	Body       string
+}
+
+// RequestID returns the Message-ID of the message for the review of the given revision.
+func RequestID(revision string) string {
+	return fmt.Sprintf("<appraise.%s@git-appraise>", revision)
+}
+
+// CommentID returns the Message-ID of the message for a comment on the review of the given revision.
+func CommentID(revision, hash string) string {
+	return fmt.Sprintf("<appraise.%s.%s@git-appraise>", revision, hash)
+}
+
+var idPattern = regexp.MustCompile(`^<appraise\.([0-9a-f]{40})(?:\.([0-9a-f]{40}))?@git-appraise>$`)
+
+// ParseID returns the revision, and the hash of the comment if any, that a
+// Message-ID was generated for, or false if it was not generated for one.
+func ParseID(id string) (string, string, bool) {
+	match := idPattern.FindStringSubmatch(strings.TrimSpace(id))
+	if match == nil {
+		return "", "", false
+	}
+	return match[1], match[2], true
+}
+
+// parseTimestamp parses the timestamp of a request or comment, falling back to the current time.
+func parseTimestamp(timestamp string) time.Time {
+	if seconds, err := strconv.ParseInt(timestamp, 10, 64); err == nil {
+		return time.Unix(seconds, 0)
+	}
+	return time.Now()
+}
+
+// summary returns the first line of a review's description.
+func summary(r request.Request) string {
+	return strings.SplitN(strings.TrimSpace(r.Description), "\n", 2)[0]
+}
+
+// RequestMessage returns the message announcing a review request on the given revision.
+func RequestMessage(revision string, r request.Request) Message {
+	var body bytes.Buffer
+	fmt.Fprintf(&body, "%s\n\n", strings.TrimSpace(r.Description))
+	fmt.Fprintf(&body, "Revision: %s\n", revision)
+	if r.ReviewRef != "" {
+		fmt.Fprintf(&body, "Review ref: %s\n", r.ReviewRef)
+	}
+	fmt.Fprintf(&body, "Target ref: %s\n", r.TargetRef)
+	if len(r.Reviewers) > 0 {
+		fmt.Fprintf(&body, "Reviewers: %s\n", strings.Join(r.Reviewers, ", "))
+	}
+	return Message{
+		From:      r.Requester,
+		Cc:        r.Reviewers,
+		Subject:   "[REVIEW] " + summary(r),
+		Date:      parseTimestamp(r.Timestamp),
+		MessageID: RequestID(revision),
+		Body:      body.String(),
+	}
+}
+
+// CommentMessage returns the message for a comment with the given hash on the
+// review of the given revision, which replies to the message for the comment's
+// parent, or for the request if it has none.
+//
+// The lines commented upon, if given, are quoted before the comment.
+func CommentMessage(revision string, r request.Request, hash string, c comment.Comment, lines []string) Message {
+	var body bytes.Buffer
+	if c.Location != nil && (c.Location.Path != "" || c.Location.CommitMessage) {
+		what := c.Location.Path
+		if c.Location.CommitMessage {
+			what = "the commit message"
+		}
+		if c.Location.Range != nil {
+			fmt.Fprintf(&body, "On %s, line %d:\n", what, c.Location.Range.StartLine)
+		} else {
+			fmt.Fprintf(&body, "On %s:\n", what)
+		}
+		for _, line := range lines {
+			fmt.Fprintf(&body, "> %s\n", line)
+		}
+		body.WriteString("\n")
+	}
+	if c.Description != "" {
+		fmt.Fprintf(&body, "%s\n", strings.TrimSpace(c.Description))
+	}
+	if c.Resolved != nil {
+		vote := "Needs more work"
+		if *c.Resolved {
+			vote = "LGTM"
+		}
+		if c.Description != "" {
+			body.WriteString("\n")
+		}
+		fmt.Fprintf(&body, "Vote: %s\n", vote)
+	}
+	inReplyTo := RequestID(revision)
+	references := []string{inReplyTo}
+	if c.Parent != "" {
+		inReplyTo = CommentID(revision, c.Parent)
+		references = append(references, inReplyTo)
+	}
+	return Message{
+		From:       c.Author,
+		Subject:    "Re: [REVIEW] " + summary(r),
+		Date:       parseTimestamp(c.Timestamp),
+		MessageID:  CommentID(revision, hash),
+		InReplyTo:  inReplyTo,
+		References: references,
+		Body:       body.String(),
+	}
+}
+
+// fromLinePattern matches the lines of a message body that would be mistaken for the start of a message in an mbox.
+var fromLinePattern = regexp.MustCompile(`(?m)^(>*From )`)
+
+// Format writes the given messages as an mbox file, which "git send-email" can send.
+func Format(w io.Writer, messages []Message) error {
+	for _, m := range messages {
+		var header bytes.Buffer
+		fmt.Fprintf(&header, "From git-appraise Mon Sep 17 00:00:00 2001\n")
+		fmt.Fprintf(&header, "From: %s\n", m.From)
+		if len(m.To) > 0 {
+			fmt.Fprintf(&header, "To: %s\n", strings.Join(m.To, ", "))
+		}
+		if len(m.Cc) > 0 {
+			fmt.Fprintf(&header, "Cc: %s\n", strings.Join(m.Cc, ", "))
+		}
+		fmt.Fprintf(&header, "Subject: %s\n", mime.QEncoding.Encode("utf-8", m.Subject))
+		fmt.Fprintf(&header, "Date: %s\n", m.Date.Format(time.RFC1123Z))
+		fmt.Fprintf(&header, "Message-ID: %s\n", m.MessageID)
+		if m.InReplyTo != "" {
+			fmt.Fprintf(&header, "In-Reply-To: %s\n", m.InReplyTo)
+		}
+		if len(m.References) > 0 {
+			fmt.Fprintf(&header, "References: %s\n", strings.Join(m.References, " "))
+		}
+		fmt.Fprintf(&header, "MIME-Version: 1.0\nContent-Type: text/plain; charset=utf-8\nContent-Transfer-Encoding: 8bit\n\n")
+		body := fromLinePattern.ReplaceAllString(m.Body, ">$1")
+		if !strings.HasSuffix(body, "\n") {
+			body += "\n"
+		}
+		if _, err := fmt.Fprintf(w, "%s%s\n", header.String(), body); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeBody returns the plain text of a message's body, decoding its transfer
+// encoding, and picking the plain text part of multipart messages.
+func decodeBody(header textHeader, body io.Reader) (string, error) {
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		mediaType = "text/plain"
+	}
+	if strings.HasPrefix(mediaType, "multipart/") {
+		reader := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				return "", nil
+			}
+			if err != nil {
+				return "", err
+			}
+			if text, err := decodeBody(part.Header, part); err != nil || text != "" {
+				return text, err
+			}
+		}
+	}
+	if mediaType != "text/plain" {
+		return "", nil
+	}
+	switch strings.ToLower(header.Get("Content-Transfer-Encoding")) {
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, &newlineStripper{body})
+	}
+	content, err := ioutil.ReadAll(body)
+	return string(content), err
+}
+
+// newlineStripper drops the line breaks of base64 encoded bodies, which the base64 decoder does not expect.
+type newlineStripper struct {
+	r io.Reader
+}
+
+func (n *newlineStripper) Read(p []byte) (int, error) {
+	count, err := n.r.Read(p)
+	kept := 0
+	for _, b := range p[:count] {
+		if b != '\r' && b != '\n' {
+			p[kept] = b
+			kept++
+		}
+	}
+	return kept, err
+}
+
+// textHeader is the part of a message or MIME part header used to decode its body.
+type textHeader interface {
+	Get(key string) string
+}
+
+// addressList returns the email addresses in a header of a message.
+func addressList(header mail.Header, key string) []string {
+	addresses, err := header.AddressList(key)
+	if err != nil {
+		return nil
+	}
+	var emails []string
+	for _, address := range addresses {
+		emails = append(emails, address.Address)
+	}
+	return emails
+}
+
+// mboxSeparatorPattern matches the lines that start messages in an mbox file.
+var mboxSeparatorPattern = regexp.MustCompile(`^From \S+`)
+
+// Parse reads the messages in an mbox file.
+func Parse(r io.Reader) ([]Message, error) {
+	var raw []string
+	var current bytes.Buffer
+	started := false
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if mboxSeparatorPattern.MatchString(line) {
+			if started {
+				raw = append(raw, current.String())
+			}
+			current.Reset()
+			started = true
+			continue
+		}
+		if !started {
+			continue
+		}
+		if strings.HasPrefix(line, ">") && strings.HasPrefix(strings.TrimLeft(line, ">"), "From ") {
+			line = line[1:]
+		}
+		current.WriteString(line)
+		current.WriteString("\n")
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if started {
+		raw = append(raw, current.String())
+	}
+
+	decoder := new(mime.WordDecoder)
+	var messages []Message
+	for _, text := range raw {
+		// Drop the blank line that separates the message from the next one.
+		if strings.HasSuffix(text, "\n\n") {
+			text = text[:len(text)-1]
+		}
+		parsed, err := mail.ReadMessage(strings.NewReader(text))
+		if err != nil {
+			return nil, err
+		}
+		body, err := decodeBody(parsed.Header, parsed.Body)
+		if err != nil {
+			return nil, err
+		}
+		subject, err := decoder.DecodeHeader(parsed.Header.Get("Subject"))
+		if err != nil {
+			subject = parsed.Header.Get("Subject")
+		}
+		m := Message{
+			From:       parsed.Header.Get("From"),
+			To:         addressList(parsed.Header, "To"),
+			Cc:         addressList(parsed.Header, "Cc"),
+			Subject:    subject,
+			MessageID:  strings.TrimSpace(parsed.Header.Get("Message-ID")),
+			InReplyTo:  strings.TrimSpace(parsed.Header.Get("In-Reply-To")),
+			References: strings.Fields(parsed.Header.Get("References")),
+			Body:       body,
+		}
+		if date, err := parsed.Header.Date(); err == nil {
+			m.Date = date
+		}
+		messages = append(messages, m)
+	}
+	return messages, nil
+}
+
+// attributionPattern matches the lines mail clients add before the text they quote.
+var attributionPattern = regexp.MustCompile(`(?i)^(on .*wrote:|.*<[^>]+> (wrote|writes):)$`)
+
+// ReplyText returns the text a reply adds to the message it replies to,
+// dropping the quoted text, the attribution lines introducing it, and the
+// reply's signature.
+func ReplyText(body string) string {
+	var lines []string
+	for _, line := range strings.Split(strings.Replace(body, "\r\n", "\n", -1), "\n") {
+		if line == "-- " {
+			break
+		}
+		if strings.HasPrefix(line, ">") || attributionPattern.MatchString(strings.TrimSpace(line)) {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	text := strings.Join(lines, "\n")
+	// Collapse the blank lines left behind where quotes were removed.
+	for strings.Contains(text, "\n\n\n") {
+		text = strings.Replace(text, "\n\n\n", "\n\n", -1)
+	}
+	return strings.TrimSpace(text)
+}
+
+// ReplyTarget returns the Message-ID a reply is a reply to, preferring its
+// In-Reply-To header and falling back to the last of its References.
+func ReplyTarget(m Message) string {
+	if m.InReplyTo != "" {
+		return strings.Fields(m.InReplyTo)[0]
+	}
+	if len(m.References) > 0 {
+		return m.References[len(m.References)-1]
+	}
+	return ""
+}
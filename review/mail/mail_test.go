@@ -0,0 +1,141 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mail
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/git-appraise/review/comment"
+	"github.com/google/git-appraise/review/request"
+)
+
+const (
+	testRevision = "0123456789abcdef0123456789abcdef01234567"
+	testHash     = "89abcdef0123456789abcdef0123456789abcdef"
+)
+
+func TestParseID(t *testing.T) {
+	if revision, hash, ok := ParseID(RequestID(testRevision)); !ok || revision != testRevision || hash != "" {
+		t.Errorf("ParseID(RequestID) = %q, %q, %v", revision, hash, ok)
+	}
+	if revision, hash, ok := ParseID(CommentID(testRevision, testHash)); !ok || revision != testRevision || hash != testHash {
+		t.Errorf("ParseID(CommentID) = %q, %q, %v", revision, hash, ok)
+	}
+	if _, _, ok := ParseID("<1234@example.com>"); ok {
+		t.Errorf("ParseID of a foreign Message-ID succeeded")
+	}
+}
+
+func TestFormatAndParse(t *testing.T) {
+	r := request.Request{
+		Timestamp:   "1000",
+		Requester:   "alice@example.com",
+		Reviewers:   []string{"bob@example.com"},
+		TargetRef:   "refs/heads/master",
+		Description: "Fix the frobnicator\n\nFrom now on it frobs.",
+	}
+	accepted := true
+	c := comment.Comment{
+		Timestamp:   "2000",
+		Author:      "bob@example.com",
+		Parent:      testHash,
+		Location:    &comment.Location{Path: "frob.go", Range: &comment.Range{StartLine: 3}},
+		Description: "Nice.",
+		Resolved:    &accepted,
+	}
+	messages := []Message{
+		RequestMessage(testRevision, r),
+		CommentMessage(testRevision, r, testHash, c, []string{"frob()"}),
+	}
+	var buffer bytes.Buffer
+	if err := Format(&buffer, messages); err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := Parse(&buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parsed) != 2 {
+		t.Fatalf("Parse returned %d messages: %v", len(parsed), parsed)
+	}
+	if parsed[0].Subject != "[REVIEW] Fix the frobnicator" || parsed[0].MessageID != RequestID(testRevision) {
+		t.Errorf("Unexpected request message: %+v", parsed[0])
+	}
+	if !strings.HasPrefix(parsed[0].Body, "Fix the frobnicator\n\nFrom now on it frobs.\n") {
+		t.Errorf("Unexpected request body: %q", parsed[0].Body)
+	}
+	reply := parsed[1]
+	if reply.InReplyTo != CommentID(testRevision, testHash) || !reply.Date.Equal(time.Unix(2000, 0)) {
+		t.Errorf("Unexpected comment message: %+v", reply)
+	}
+	want := "On frob.go, line 3:\n> frob()\n\nNice.\n\nVote: LGTM\n"
+	if reply.Body != want {
+		t.Errorf("Comment body = %q, want %q", reply.Body, want)
+	}
+}
+
+func TestParseEncodings(t *testing.T) {
+	mbox := `From someone Mon Sep 17 00:00:00 2001
+From: Carol <carol@example.com>
+Subject: =?utf-8?q?Re:_caf=C3=A9?=
+Message-ID: <1@example.com>
+In-Reply-To: <appraise.0123456789abcdef0123456789abcdef01234567@git-appraise>
+MIME-Version: 1.0
+Content-Type: multipart/alternative; boundary="b"
+
+--b
+Content-Type: text/plain; charset=utf-8
+Content-Transfer-Encoding: quoted-printable
+
+Caf=C3=A9 looks fine.
+--b
+Content-Type: text/html
+
+<p>ignored</p>
+--b--
+`
+	messages, err := Parse(strings.NewReader(mbox))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 1 {
+		t.Fatalf("Parse returned %d messages", len(messages))
+	}
+	if messages[0].Subject != "Re: café" || strings.TrimSpace(messages[0].Body) != "Café looks fine." {
+		t.Errorf("Unexpected message: %+v", messages[0])
+	}
+}
+
+func TestReplyText(t *testing.T) {
+	body := "Agreed, let's do that.\n\nOn Mon, 1 Jan 2018, Bob wrote:\n> Should we frob?\n>\n> Maybe.\n\nReviewed-by: Carol <carol@example.com>\n-- \nCarol\n"
+	want := "Agreed, let's do that.\n\nReviewed-by: Carol <carol@example.com>"
+	if got := ReplyText(body); got != want {
+		t.Errorf("ReplyText() = %q, want %q", got, want)
+	}
+}
+
+func TestReplyTarget(t *testing.T) {
+	if got := ReplyTarget(Message{InReplyTo: "<a@x>", References: []string{"<b@x>"}}); got != "<a@x>" {
+		t.Errorf("ReplyTarget with In-Reply-To = %q", got)
+	}
+	if got := ReplyTarget(Message{References: []string{"<b@x>", "<c@x>"}}); got != "<c@x>" {
+		t.Errorf("ReplyTarget with References = %q", got)
+	}
+}
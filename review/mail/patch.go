@@ -0,0 +1,199 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mail
+
+import (
+	"net/mail"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PatchSubject describes the subject of an email from "git format-patch", such as "[PATCH v2 1/3] Fix the frobnicator".
+type PatchSubject struct {
+	// Version is the version of the series, starting at 1.
+	Version int
+	// Index is the position of the patch in the series, starting at 1, or 0 for a cover letter.
+	Index int
+	// Total is the number of patches in the series.
+	Total int
+	Title string
+}
+
+var (
+	patchSubjectPattern = regexp.MustCompile(`^\[([^\]]*\bPATCH\b[^\]]*)\]\s*(.*)$`)
+	patchVersionPattern = regexp.MustCompile(`^[vV](\d+)$`)
+	patchIndexPattern   = regexp.MustCompile(`^(\d+)/(\d+)$`)
+)
+
+// ParsePatchSubject parses the subject of a patch email, and reports whether it is one.
+//
+// Replies, whose subjects start with "Re:", are not patches.
+func ParsePatchSubject(subject string) (PatchSubject, bool) {
+	match := patchSubjectPattern.FindStringSubmatch(strings.TrimSpace(subject))
+	if match == nil {
+		return PatchSubject{}, false
+	}
+	parsed := PatchSubject{Version: 1, Index: 1, Total: 1, Title: match[2]}
+	for _, field := range strings.Fields(match[1]) {
+		if version := patchVersionPattern.FindStringSubmatch(field); version != nil {
+			parsed.Version, _ = strconv.Atoi(version[1])
+		}
+		if index := patchIndexPattern.FindStringSubmatch(field); index != nil {
+			parsed.Index, _ = strconv.Atoi(index[1])
+			parsed.Total, _ = strconv.Atoi(index[2])
+		}
+	}
+	return parsed, true
+}
+
+// SplitPatch splits the body of a patch email into the rest of the commit
+// message, and the diff (preceded by its diffstat) that follows the "---" line.
+func SplitPatch(body string) (string, string) {
+	body = strings.Replace(body, "\r\n", "\n", -1)
+	if i := strings.Index(body, "\n---\n"); i >= 0 {
+		return strings.TrimSpace(body[:i]), body[i+len("\n---\n"):]
+	}
+	if strings.HasPrefix(body, "---\n") {
+		return "", body[len("---\n"):]
+	}
+	if i := strings.Index(body, "\ndiff --git "); i >= 0 {
+		return strings.TrimSpace(body[:i]), body[i+1:]
+	}
+	return strings.TrimSpace(body), ""
+}
+
+// PatchAuthor returns the author of a patch email, along with its body
+// without the "From:" line that "git format-patch" adds when the author
+// is not the sender.
+func PatchAuthor(m Message) (*mail.Address, string, error) {
+	body := m.Body
+	from := m.From
+	if strings.HasPrefix(body, "From: ") {
+		lines := strings.SplitN(body, "\n", 2)
+		from = strings.TrimPrefix(lines[0], "From: ")
+		body = ""
+		if len(lines) > 1 {
+			body = strings.TrimLeft(lines[1], "\n")
+		}
+	}
+	address, err := mail.ParseAddress(from)
+	return address, body, err
+}
+
+// shortlogPattern matches the line starting the shortlog of a cover letter, such as "Jane Doe (2):".
+var shortlogPattern = regexp.MustCompile(`(?m)^\S.* \(\d+\):$`)
+
+// CoverText returns the text of a cover letter, without the shortlog and
+// diffstat that "git format-patch --cover-letter" appends to it.
+func CoverText(body string) string {
+	text := ReplyText(body)
+	if loc := shortlogPattern.FindStringIndex(text); loc != nil {
+		text = text[:loc[0]]
+	}
+	return strings.TrimSpace(text)
+}
+
+// Series is a patch series, with the optional cover letter introducing it.
+type Series struct {
+	Cover *Message
+	// Patches are in the order they apply.
+	Patches []Message
+	Subject PatchSubject
+}
+
+// Title returns the title of the series, which is the cover letter's if it has one.
+func (s Series) Title() string {
+	if s.Cover != nil {
+		if subject, ok := ParsePatchSubject(s.Cover.Subject); ok {
+			return subject.Title
+		}
+	}
+	if len(s.Patches) > 0 {
+		subject, _ := ParsePatchSubject(s.Patches[0].Subject)
+		return subject.Title
+	}
+	return ""
+}
+
+// Complete reports whether the series has all of its patches.
+func (s Series) Complete() bool {
+	return len(s.Patches) == s.Subject.Total
+}
+
+// seriesKey returns the key grouping the messages of a series.
+//
+// Series sent with "git send-email" are threaded under their cover letter or
+// first patch, while the patches of unthreaded series, such as the files
+// written by "git format-patch" without "--thread", are grouped by their
+// version and number of patches.
+func seriesKey(m Message, subject PatchSubject) string {
+	if len(m.References) > 0 {
+		return m.References[0]
+	}
+	if target := ReplyTarget(m); target != "" {
+		return target
+	}
+	if m.MessageID != "" {
+		return m.MessageID
+	}
+	return "v" + strconv.Itoa(subject.Version) + "/" + strconv.Itoa(subject.Total)
+}
+
+// FindSeries returns the patch series among the given messages, in the order
+// they first appear, along with the other messages.
+func FindSeries(messages []Message) ([]Series, []Message) {
+	var keys []string
+	series := make(map[string]*Series)
+	var others []Message
+	for _, m := range messages {
+		subject, ok := ParsePatchSubject(m.Subject)
+		if ok && subject.Index > 0 {
+			_, diff := SplitPatch(m.Body)
+			ok = strings.Contains(diff, "diff --git ")
+		}
+		if !ok {
+			others = append(others, m)
+			continue
+		}
+		key := seriesKey(m, subject)
+		s, ok := series[key]
+		if !ok {
+			s = &Series{Subject: PatchSubject{Version: subject.Version, Total: subject.Total}}
+			series[key] = s
+			keys = append(keys, key)
+		}
+		if subject.Index == 0 {
+			cover := m
+			s.Cover = &cover
+		} else {
+			s.Patches = append(s.Patches, m)
+		}
+	}
+	var found []Series
+	for _, key := range keys {
+		s := series[key]
+		sort.SliceStable(s.Patches, func(i, j int) bool {
+			a, _ := ParsePatchSubject(s.Patches[i].Subject)
+			b, _ := ParsePatchSubject(s.Patches[j].Subject)
+			return a.Index < b.Index
+		})
+		found = append(found, *s)
+	}
+	return found, others
+}
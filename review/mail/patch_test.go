@@ -0,0 +1,99 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mail
+
+import (
+	"testing"
+)
+
+func TestParsePatchSubject(t *testing.T) {
+	cases := []struct {
+		subject string
+		want    PatchSubject
+		ok      bool
+	}{
+		{"[PATCH] Fix the frobnicator", PatchSubject{1, 1, 1, "Fix the frobnicator"}, true},
+		{"[PATCH v2 2/3] Fix the frobnicator", PatchSubject{2, 2, 3, "Fix the frobnicator"}, true},
+		{"[RFC PATCH 0/2] Frobnicate less", PatchSubject{1, 0, 2, "Frobnicate less"}, true},
+		{"Re: [PATCH 1/2] Fix the frobnicator", PatchSubject{}, false},
+		{"Fix the frobnicator", PatchSubject{}, false},
+	}
+	for _, c := range cases {
+		got, ok := ParsePatchSubject(c.subject)
+		if ok != c.ok || got != c.want {
+			t.Errorf("ParsePatchSubject(%q) = %+v, %v; want %+v, %v", c.subject, got, ok, c.want, c.ok)
+		}
+	}
+}
+
+const testPatchBody = `From: Author <author@example.com>
+
+Explain the fix.
+---
+ a.txt | 2 +-
+ 1 file changed, 1 insertion(+), 1 deletion(-)
+
+diff --git a/a.txt b/a.txt
+`
+
+func TestSplitPatch(t *testing.T) {
+	author, body, err := PatchAuthor(Message{From: "Sender <sender@example.com>", Body: testPatchBody})
+	if err != nil || author.Address != "author@example.com" {
+		t.Fatalf("PatchAuthor() = %v, %v", author, err)
+	}
+	message, diff := SplitPatch(body)
+	if message != "Explain the fix." {
+		t.Errorf("SplitPatch() message = %q", message)
+	}
+	if diff[:len(" a.txt")] != " a.txt" {
+		t.Errorf("SplitPatch() diff = %q", diff)
+	}
+}
+
+func TestCoverText(t *testing.T) {
+	body := "Two fixes.\n\nJane Doe (2):\n  First\n  Second\n\n a.txt | 2 +-\n\n-- \n2.40.0\n"
+	if text := CoverText(body); text != "Two fixes." {
+		t.Errorf("CoverText() = %q", text)
+	}
+}
+
+func TestFindSeries(t *testing.T) {
+	messages := []Message{
+		{Subject: "[PATCH 2/2] Second", MessageID: "<2@x>", References: []string{"<0@x>"}, Body: testPatchBody},
+		{Subject: "[PATCH 0/2] Cover", MessageID: "<0@x>", Body: "Two fixes."},
+		{Subject: "Re: [PATCH 1/2] First", MessageID: "<r@x>", InReplyTo: "<1@x>", References: []string{"<0@x>", "<1@x>"}, Body: "Nice."},
+		{Subject: "[PATCH 1/2] First", MessageID: "<1@x>", References: []string{"<0@x>"}, Body: testPatchBody},
+		{Subject: "[PATCH] Unrelated", MessageID: "<u@x>", Body: testPatchBody},
+		{Subject: "[PATCH 1/3] Incomplete", MessageID: "<i@x>", Body: testPatchBody},
+	}
+	series, others := FindSeries(messages)
+	if len(series) != 3 {
+		t.Fatalf("FindSeries() found %d series, want 3: %+v", len(series), series)
+	}
+	if series[0].Title() != "Cover" || !series[0].Complete() || series[0].Patches[0].MessageID != "<1@x>" {
+		t.Errorf("FindSeries() first series = %+v", series[0])
+	}
+	if series[1].Title() != "Unrelated" || !series[1].Complete() || series[1].Cover != nil {
+		t.Errorf("FindSeries() second series = %+v", series[1])
+	}
+	if series[2].Complete() {
+		t.Errorf("FindSeries() third series should be incomplete: %+v", series[2])
+	}
+	if len(others) != 1 || others[0].MessageID != "<r@x>" {
+		t.Errorf("FindSeries() others = %+v", others)
+	}
+}
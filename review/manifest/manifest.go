@@ -0,0 +1,124 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package manifest defines the release manifests used to archive the reviews that went into a release.
+package manifest
+
+import (
+	"encoding/json"
+	"html/template"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/google/git-appraise/review"
+)
+
+// FormatVersion defines the latest version of the manifest format supported by the tool.
+const FormatVersion = 0
+
+// Entry summarizes a single review included in a release.
+type Entry struct {
+	Revision    string   `json:"revision"`
+	ReviewRef   string   `json:"reviewRef,omitempty"`
+	TargetRef   string   `json:"targetRef"`
+	Requester   string   `json:"requester,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Approved    bool     `json:"approved"`
+	Approvers   []string `json:"approvers,omitempty"`
+}
+
+// Manifest lists all of the reviews whose commits are reachable from a release tag.
+type Manifest struct {
+	Timestamp string  `json:"timestamp"`
+	Tag       string  `json:"tag"`
+	Commit    string  `json:"commit"`
+	Reviews   []Entry `json:"reviews"`
+	// Version represents the version of the metadata format.
+	Version int `json:"v,omitempty"`
+}
+
+// New builds a manifest for the given tag out of the reviews that it includes.
+func New(tag, commit string, reviews []review.Review) Manifest {
+	m := Manifest{
+		Timestamp: strconv.FormatInt(time.Now().Unix(), 10),
+		Tag:       tag,
+		Commit:    commit,
+		Reviews:   []Entry{},
+	}
+	for _, r := range reviews {
+		m.Reviews = append(m.Reviews, Entry{
+			Revision:    r.Revision,
+			ReviewRef:   r.Request.ReviewRef,
+			TargetRef:   r.Request.TargetRef,
+			Requester:   r.Request.Requester,
+			Description: r.Request.Description,
+			Approved:    r.Resolved != nil && *r.Resolved,
+			Approvers:   r.Approvers(),
+		})
+	}
+	return m
+}
+
+// Unapproved returns the entries for reviews that were not accepted.
+func (m Manifest) Unapproved() []Entry {
+	var unapproved []Entry
+	for _, entry := range m.Reviews {
+		if !entry.Approved {
+			unapproved = append(unapproved, entry)
+		}
+	}
+	return unapproved
+}
+
+// Write serializes the manifest as indented JSON.
+func (m Manifest) Write() (string, error) {
+	bytes, err := json.MarshalIndent(m, "", "  ")
+	return string(bytes) + "\n", err
+}
+
+var htmlTemplate = template.Must(template.New("manifest").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Reviews included in {{.Tag}}</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; }
+td, th { border: 1px solid #999; padding: 4px 8px; text-align: left; vertical-align: top; }
+.unapproved { background: #fdd; }
+</style>
+</head>
+<body>
+<h1>Reviews included in {{.Tag}}</h1>
+<p>Commit <code>{{.Commit}}</code></p>
+<table>
+<tr><th>Revision</th><th>Requester</th><th>Description</th><th>Approvers</th></tr>
+{{range .Reviews}}<tr{{if not .Approved}} class="unapproved"{{end}}>
+<td><code>{{.Revision}}</code></td>
+<td>{{.Requester}}</td>
+<td>{{.Description}}</td>
+<td>{{if .Approved}}{{range .Approvers}}{{.}}<br>{{end}}{{else}}Not approved{{end}}</td>
+</tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// WriteHTML renders the manifest as a standalone HTML page.
+func (m Manifest) WriteHTML(w io.Writer) error {
+	return htmlTemplate.Execute(w, m)
+}
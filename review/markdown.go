@@ -0,0 +1,250 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package review
+
+import (
+	"regexp"
+	"strings"
+)
+
+// codeIndent is the indentation of the lines of a code block, once its fences are removed.
+const codeIndent = "    "
+
+var (
+	fencePattern    = regexp.MustCompile("^(```+|~~~+)\\s*([\\w+#.-]*)")
+	headingPattern  = regexp.MustCompile(`^#{1,6}\s+(.*?)(?:\s+#+)?\s*$`)
+	quotePattern    = regexp.MustCompile(`^\s*>`)
+	listItemPattern = regexp.MustCompile(`^(\s*)[-*+]\s+`)
+	codeSpanPattern = regexp.MustCompile("`+([^`\n]+)`+")
+	linkPattern     = regexp.MustCompile(`\[([^\]\n]+)\]\(([^)\s]+)\)`)
+	strongPattern   = regexp.MustCompile(`\*\*([^*\n]+)\*\*|__([^_\n]+)__`)
+	// Emphasis must not start inside a word, so that snake_case names are left alone.
+	emphasisPatterns = []*regexp.Regexp{
+		regexp.MustCompile(`(^|[^\w*])\*([^*\s](?:[^*\n]*[^*\s])?)\*`),
+		regexp.MustCompile(`(^|[^\w_])_([^_\s](?:[^_\n]*[^_\s])?)_\b`),
+	}
+)
+
+var markdownEnabled bool
+
+// EnableMarkdown sets whether the descriptions and comments printed by this package are rendered as Markdown.
+func EnableMarkdown(enabled bool) {
+	markdownEnabled = enabled
+}
+
+// formatText returns the given description or comment as it should be printed.
+func formatText(text string) string {
+	if !markdownEnabled {
+		return text
+	}
+	return RenderMarkdown(text)
+}
+
+// RenderMarkdown renders Markdown text for a terminal.
+//
+// List items get bullets, and the fences around code blocks are replaced by
+// indentation. If color is enabled, then headings, emphasis, code, and links
+// are also colored (with the Markdown syntax for them removed), and code blocks
+// in some common languages are syntax highlighted. Without color, the inline
+// syntax is left as it is, as that is the only thing that marks it out.
+func RenderMarkdown(text string) string {
+	var lines []string
+	var fence, language string
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if fence != "" {
+			if strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == "" {
+				fence = ""
+				continue
+			}
+			lines = append(lines, codeIndent+highlightCode(language, line))
+			continue
+		}
+		if match := fencePattern.FindStringSubmatch(trimmed); match != nil {
+			fence, language = match[1], strings.ToLower(match[2])
+			continue
+		}
+		lines = append(lines, renderMarkdownLine(line))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// renderMarkdownLine renders a line of Markdown text outside of any code block.
+func renderMarkdownLine(line string) string {
+	if match := listItemPattern.FindStringSubmatch(line); match != nil {
+		return match[1] + "• " + renderInlineMarkdown(line[len(match[0]):])
+	}
+	if !colorEnabled {
+		return line
+	}
+	if match := headingPattern.FindStringSubmatch(line); match != nil {
+		return colorize("heading", match[1])
+	}
+	if quotePattern.MatchString(line) {
+		return colorize("quote", line)
+	}
+	return renderInlineMarkdown(line)
+}
+
+// renderInlineMarkdown colors the code spans, links, and emphasis in a line, if color is enabled.
+func renderInlineMarkdown(line string) string {
+	if !colorEnabled {
+		return line
+	}
+	// Code spans are rendered as they are, so the rest of the syntax is only
+	// rendered in the text between them.
+	var rendered string
+	last := 0
+	for _, span := range codeSpanPattern.FindAllStringSubmatchIndex(line, -1) {
+		rendered += renderEmphasis(line[last:span[0]]) + colorize("code", line[span[2]:span[3]])
+		last = span[1]
+	}
+	return rendered + renderEmphasis(line[last:])
+}
+
+// renderEmphasis colors the links and emphasis in text that has no code spans.
+func renderEmphasis(text string) string {
+	text = replaceMatches(linkPattern, text, func(match []string) string {
+		return match[1] + " <" + colorize("code", match[2]) + ">"
+	})
+	text = replaceMatches(strongPattern, text, func(match []string) string {
+		return colorize("strong", match[1]+match[2])
+	})
+	for _, pattern := range emphasisPatterns {
+		text = replaceMatches(pattern, text, func(match []string) string {
+			return match[1] + colorize("emphasis", match[2])
+		})
+	}
+	return text
+}
+
+// replaceMatches replaces each match of the pattern with the result of calling the given function on its submatches.
+func replaceMatches(pattern *regexp.Regexp, text string, replace func([]string) string) string {
+	var result string
+	last := 0
+	for _, indices := range pattern.FindAllStringSubmatchIndex(text, -1) {
+		match := make([]string, len(indices)/2)
+		for i := range match {
+			if indices[2*i] >= 0 {
+				match[i] = text[indices[2*i]:indices[2*i+1]]
+			}
+		}
+		result += text[last:indices[0]] + replace(match)
+		last = indices[1]
+	}
+	return result + text[last:]
+}
+
+// syntax describes enough of a programming language to highlight it.
+type syntax struct {
+	keywords    map[string]bool
+	lineComment string
+	quotes      string
+}
+
+func newSyntax(keywords, lineComment, quotes string) *syntax {
+	s := &syntax{keywords: make(map[string]bool), lineComment: lineComment, quotes: quotes}
+	for _, keyword := range strings.Fields(keywords) {
+		s.keywords[keyword] = true
+	}
+	return s
+}
+
+var (
+	goSyntax = newSyntax("break case chan const continue default defer else fallthrough for func go goto if import "+
+		"interface map package range return select struct switch type var nil true false", "//", "\"'`")
+	pythonSyntax = newSyntax("and as assert async await break class continue def del elif else except finally for from "+
+		"global if import in is lambda nonlocal not or pass raise return try while with yield None True False", "#", "\"'")
+	javascriptSyntax = newSyntax("async await break case catch class const continue debugger default delete do else "+
+		"export extends finally for function if import in instanceof let new return super switch this throw try "+
+		"typeof var void while with yield null undefined true false", "//", "\"'`")
+	shellSyntax = newSyntax("case do done elif else esac export fi for function if in local return then until while", "#", "\"'")
+)
+
+// syntaxes maps the languages named on code fences to their syntax.
+var syntaxes = map[string]*syntax{
+	"go":         goSyntax,
+	"golang":     goSyntax,
+	"py":         pythonSyntax,
+	"python":     pythonSyntax,
+	"js":         javascriptSyntax,
+	"javascript": javascriptSyntax,
+	"ts":         javascriptSyntax,
+	"typescript": javascriptSyntax,
+	"sh":         shellSyntax,
+	"bash":       shellSyntax,
+	"shell":      shellSyntax,
+}
+
+func isIdentifierStart(c byte) bool {
+	return c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+func isIdentifierPart(c byte) bool {
+	return isIdentifierStart(c) || ('0' <= c && c <= '9')
+}
+
+// highlightCode colors the keywords, strings, and comments in a line of code, if color is enabled.
+//
+// Lines of code in languages without a known syntax are colored as code.
+func highlightCode(language, line string) string {
+	if !colorEnabled {
+		return line
+	}
+	s, ok := syntaxes[language]
+	if !ok {
+		return colorize("code", line)
+	}
+	var highlighted strings.Builder
+	for i := 0; i < len(line); {
+		switch c := line[i]; {
+		case s.lineComment != "" && strings.HasPrefix(line[i:], s.lineComment):
+			highlighted.WriteString(colorize("comment", line[i:]))
+			i = len(line)
+		case strings.IndexByte(s.quotes, c) >= 0:
+			end := i + 1
+			for end < len(line) && line[end] != c {
+				if line[end] == '\\' && c != '`' {
+					end++
+				}
+				end++
+			}
+			if end < len(line) {
+				end++
+			} else {
+				end = len(line)
+			}
+			highlighted.WriteString(colorize("string", line[i:end]))
+			i = end
+		case isIdentifierStart(c):
+			end := i + 1
+			for end < len(line) && isIdentifierPart(line[end]) {
+				end++
+			}
+			word := line[i:end]
+			if s.keywords[word] {
+				word = colorize("keyword", word)
+			}
+			highlighted.WriteString(word)
+			i = end
+		default:
+			highlighted.WriteByte(c)
+			i++
+		}
+	}
+	return highlighted.String()
+}
@@ -0,0 +1,59 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package review
+
+import (
+	"testing"
+)
+
+func TestRenderMarkdownWithoutColor(t *testing.T) {
+	text := "Fixes the **bug**.\n\n- one\n  * two\n\n```go\nfunc f() {}\n```\nDone."
+	expected := "Fixes the **bug**.\n\n• one\n  • two\n\n    func f() {}\nDone."
+	if rendered := RenderMarkdown(text); rendered != expected {
+		t.Errorf("Unexpected rendering %q", rendered)
+	}
+}
+
+func TestRenderMarkdownWithColor(t *testing.T) {
+	for slot := range defaultColors {
+		colorCodes[slot] = "<" + slot + ">"
+	}
+	EnableColor(true)
+	defer func() {
+		EnableColor(false)
+		colorCodes = make(map[string]string)
+	}()
+	tests := []struct {
+		text, expected string
+	}{
+		{"# Title #", "<heading>Title\x1b[m"},
+		{"> quoted", "<quote>> quoted\x1b[m"},
+		{"a **b** and *c*", "a <strong>b\x1b[m and <emphasis>c\x1b[m"},
+		{"keep snake_case_names", "keep snake_case_names"},
+		{"run `a *b* c`", "run <code>a *b* c\x1b[m"},
+		{"see [docs](http://x)", "see docs <<code>http://x\x1b[m>"},
+		{"- **x**", "• <strong>x\x1b[m"},
+		{"```\nplain\n```", "    <code>plain\x1b[m"},
+		{"```go\nreturn \"if\" // if\n```", "    <keyword>return\x1b[m <string>\"if\"\x1b[m <comment>// if\x1b[m"},
+		{"```sh\necho \"a\\\"b\" # c\n```", "    echo <string>\"a\\\"b\"\x1b[m <comment># c\x1b[m"},
+	}
+	for _, test := range tests {
+		if rendered := RenderMarkdown(test.text); rendered != test.expected {
+			t.Errorf("RenderMarkdown(%q) = %q, want %q", test.text, rendered, test.expected)
+		}
+	}
+}
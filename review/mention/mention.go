@@ -0,0 +1,75 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package mention finds the users mentioned (as "@user") in review descriptions and comments.
+package mention
+
+import (
+	"regexp"
+	"strings"
+)
+
+// mentionPattern matches a mention, which is either a user name or an email
+// address preceded by "@". The "@" must not follow a word character, so that
+// email addresses themselves are not mistaken for mentions.
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w.@+-])@(\w[\w.+-]*(?:@[\w-]+(?:\.[\w-]+)+)?)`)
+
+// inlineCodePattern matches a Markdown code span.
+var inlineCodePattern = regexp.MustCompile("`[^`\n]*`")
+
+// Parse returns the users mentioned in the given text, in the order that they
+// are first mentioned, and without the leading "@".
+//
+// Mentions inside Markdown code blocks and code spans are ignored.
+func Parse(text string) []string {
+	var mentions []string
+	seen := make(map[string]bool)
+	inCodeBlock := false
+	for _, line := range strings.Split(text, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			inCodeBlock = !inCodeBlock
+			continue
+		}
+		if inCodeBlock {
+			continue
+		}
+		line = inlineCodePattern.ReplaceAllString(line, "")
+		for _, match := range mentionPattern.FindAllStringSubmatch(line, -1) {
+			// Trailing punctuation ends the sentence rather than the name.
+			user := strings.TrimRight(match[1], ".-")
+			if user != "" && !seen[user] {
+				seen[user] = true
+				mentions = append(mentions, user)
+			}
+		}
+	}
+	return mentions
+}
+
+// Added returns the mentions that are not in the given earlier mentions.
+func Added(mentions, earlier []string) []string {
+	previous := make(map[string]bool)
+	for _, user := range earlier {
+		previous[user] = true
+	}
+	var added []string
+	for _, user := range mentions {
+		if !previous[user] {
+			added = append(added, user)
+		}
+	}
+	return added
+}
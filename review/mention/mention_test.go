@@ -0,0 +1,56 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mention
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"", nil},
+		{"No mentions here.", nil},
+		{"@alice please take a look", []string{"alice"}},
+		{"Thanks @alice, and @bob.", []string{"alice", "bob"}},
+		{"cc @alice @alice", []string{"alice"}},
+		{"Ask @carol@example.com about it.", []string{"carol@example.com"}},
+		{"Mail dave@example.com instead", nil},
+		{"(@erin)", []string{"erin"}},
+		{"Use `@Override` here", nil},
+		{"```\n@decorator\ndef f(): pass\n```\n@frank", []string{"frank"}},
+	}
+	for _, test := range tests {
+		if got := Parse(test.text); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Parse(%q) = %q, want %q", test.text, got, test.want)
+		}
+	}
+}
+
+func TestAdded(t *testing.T) {
+	got := Added([]string{"alice", "bob", "carol"}, []string{"bob"})
+	want := []string{"alice", "carol"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Added() = %q, want %q", got, want)
+	}
+	if got := Added([]string{"alice"}, []string{"alice"}); got != nil {
+		t.Errorf("Added() = %q, want none", got)
+	}
+}
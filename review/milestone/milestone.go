@@ -0,0 +1,172 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package milestone defines the internal representation of the milestones used to group reviews.
+package milestone
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/git-appraise/repository"
+	"github.com/google/git-appraise/review/request"
+	"github.com/google/git-appraise/review/schema"
+)
+
+const (
+	// Ref defines the git-notes ref that we expect to contain milestones.
+	Ref = "refs/notes/devtools/milestones"
+
+	// Object is the object annotated with the milestones.
+	//
+	// Milestones belong to the repository as a whole rather than to any
+	// commit, so they are attached to the empty tree, which every repository has.
+	Object = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+
+	// FormatVersion defines the latest version of the milestone format supported by the tool.
+	FormatVersion = 0
+)
+
+// Format describes the versions of the milestone format, and has a migration to each version after the first.
+var Format = &schema.Format{Name: "milestone"}
+
+// Milestone is a named goal (e.g. a release) that reviews can be attached to.
+//
+// Milestones are only ever appended, so the latest one with a given name is
+// the current definition of that milestone.
+type Milestone struct {
+	Timestamp string `json:"timestamp,omitempty"`
+	Name      string `json:"name"`
+	// Due is the target date of the milestone, in the request.DueDateFormat layout.
+	Due string `json:"due,omitempty"`
+	// Version represents the version of the metadata format.
+	Version int `json:"v,omitempty"`
+}
+
+// New returns a new milestone, with the Timestamp field filled in with the current time.
+func New(name, due string) Milestone {
+	return Milestone{
+		Timestamp: strconv.FormatInt(time.Now().Unix(), 10),
+		Name:      name,
+		Due:       due,
+	}
+}
+
+// ValidateName returns an error if the given milestone name is empty, or contains whitespace or commas.
+func ValidateName(name string) error {
+	if name == "" || strings.ContainsAny(name, ", \t\r\n") {
+		return fmt.Errorf("Invalid milestone %q; milestones must be non-empty and cannot contain whitespace or commas", name)
+	}
+	return nil
+}
+
+// Parse parses a milestone from a git note.
+func Parse(note repository.Note) (Milestone, error) {
+	bytes := []byte(note)
+	var m Milestone
+	err := json.Unmarshal(bytes, &m)
+	return m, err
+}
+
+// parseUpgraded parses a milestone written in another version of the format.
+func parseUpgraded(note repository.Note) (Milestone, error) {
+	upgraded, err := Format.Upgrade(note)
+	if err != nil {
+		return Milestone{}, err
+	}
+	return Parse(upgraded)
+}
+
+// ParseAllValid takes collection of git notes and tries to parse a milestone
+// from each one. Any notes that are not valid milestones get ignored.
+func ParseAllValid(notes []repository.Note) []Milestone {
+	var milestones []Milestone
+	for _, note := range notes {
+		m, err := Parse(note)
+		if err == nil && m.Version != FormatVersion {
+			m, err = parseUpgraded(note)
+		}
+		if err == nil && m.Name != "" {
+			milestones = append(milestones, m)
+		}
+	}
+	return milestones
+}
+
+// Write writes a milestone as a JSON-formatted git note.
+func (m *Milestone) Write() (repository.Note, error) {
+	bytes, err := json.Marshal(m)
+	return repository.Note(bytes), err
+}
+
+// Latest returns the latest definition of each of the given milestones,
+// sorted by target date (with those without one last), and then by name.
+func Latest(milestones []Milestone) []Milestone {
+	latest := make(map[string]Milestone)
+	for _, m := range milestones {
+		if previous, ok := latest[m.Name]; !ok || previous.Timestamp <= m.Timestamp {
+			latest[m.Name] = m
+		}
+	}
+	var result []Milestone
+	for _, m := range latest {
+		result = append(result, m)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Due != result[j].Due {
+			return result[j].Due == "" || (result[i].Due != "" && result[i].Due < result[j].Due)
+		}
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// List returns the current definition of every milestone in the repository.
+func List() []Milestone {
+	return Latest(ParseAllValid(repository.GetNotes(Ref, Object)))
+}
+
+// Get returns the current definition of the milestone with the given name, or nil if there is none.
+func Get(name string) *Milestone {
+	for _, m := range List() {
+		if m.Name == name {
+			return &m
+		}
+	}
+	return nil
+}
+
+// Save records a new or updated milestone.
+func Save(m Milestone) error {
+	if err := ValidateName(m.Name); err != nil {
+		return err
+	}
+	if m.Due != "" {
+		if _, err := request.ParseDueDate(m.Due); err != nil {
+			return err
+		}
+	}
+	note, err := m.Write()
+	if err != nil {
+		return err
+	}
+	repository.AppendNote(Ref, Object, note)
+	return nil
+}
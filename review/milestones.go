@@ -0,0 +1,68 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package review
+
+import (
+	"github.com/google/git-appraise/review/milestone"
+)
+
+// MilestoneProgress summarizes the reviews attached to a single milestone.
+type MilestoneProgress struct {
+	Milestone milestone.Milestone `json:"milestone"`
+	Open      int                 `json:"open"`
+	Submitted int                 `json:"submitted"`
+	Abandoned int                 `json:"abandoned"`
+}
+
+// Total returns the number of reviews attached to the milestone.
+func (p MilestoneProgress) Total() int {
+	return p.Open + p.Submitted + p.Abandoned
+}
+
+// SummarizeMilestones counts the open, submitted, and abandoned reviews of each of the given milestones.
+//
+// Reviews attached to milestones that have not been created are counted
+// under milestones with only a name, listed after the others.
+func SummarizeMilestones(milestones []milestone.Milestone, reviews []Review) []MilestoneProgress {
+	var progress []MilestoneProgress
+	index := make(map[string]int)
+	for _, m := range milestones {
+		index[m.Name] = len(progress)
+		progress = append(progress, MilestoneProgress{Milestone: m})
+	}
+	for _, r := range reviews {
+		name := r.Request.Milestone
+		if name == "" {
+			continue
+		}
+		i, ok := index[name]
+		if !ok {
+			i = len(progress)
+			index[name] = i
+			progress = append(progress, MilestoneProgress{Milestone: milestone.Milestone{Name: name}})
+		}
+		switch {
+		case r.Submitted:
+			progress[i].Submitted++
+		case r.Abandoned:
+			progress[i].Abandoned++
+		default:
+			progress[i].Open++
+		}
+	}
+	return progress
+}
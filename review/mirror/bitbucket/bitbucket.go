@@ -0,0 +1,388 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package bitbucket synchronizes the pull requests of Bitbucket Cloud and
+// Bitbucket Server (Data Center) with git-appraise reviews, importing their
+// comments and approvals, and exporting git-appraise comments and votes back
+// to them.
+//
+// The two products have different APIs, which are each wrapped in an
+// implementation of the api interface, so that the synchronization itself is
+// shared.
+package bitbucket
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/git-appraise/repository"
+	"github.com/google/git-appraise/review"
+	"github.com/google/git-appraise/review/comment"
+	"github.com/google/git-appraise/review/mirror"
+	"github.com/google/git-appraise/review/request"
+)
+
+// The states of pull requests.
+const (
+	StateOpen     = "OPEN"
+	StateMerged   = "MERGED"
+	StateDeclined = "DECLINED"
+)
+
+// PullRequest is a pull request, in the form common to both APIs.
+type PullRequest struct {
+	ID          int
+	Title       string
+	Description string
+	// Author and Reviewers are email addresses.
+	Author       string
+	Reviewers    []string
+	State        string
+	Created      time.Time
+	Updated      time.Time
+	TargetBranch string
+	// MergeCommit is the commit that merged the pull request, if it has been merged.
+	MergeCommit string
+	// sourceBranch is the branch being merged, if it is in the same repository.
+	sourceBranch string
+}
+
+// Comment is a comment on a pull request, in the form common to both APIs.
+type Comment struct {
+	ID       string
+	ParentID string
+	Author   string
+	Text     string
+	Created  time.Time
+	// Path and Line give the line commented upon, in the given commit, for comments on lines.
+	Path   string
+	Line   uint32
+	Commit string
+}
+
+// Vote is the current approval, or request for changes, of a user.
+type Vote struct {
+	Author   string
+	Approved bool
+	// Time is when the vote was cast.
+	Time time.Time
+}
+
+// api is the part of a Bitbucket API used for synchronizing pull requests.
+type api interface {
+	// listPullRequests returns the pull requests updated since the given time, or all of them if it is zero.
+	listPullRequests(since time.Time) ([]PullRequest, error)
+	getPullRequest(id int) (PullRequest, error)
+	// commits returns the commits of a pull request, oldest first.
+	commits(pr PullRequest) ([]string, error)
+	// comments returns the comments on a pull request, each after the comment it replies to.
+	// Comments on lines that do not say which commit they are on are taken to be on the given head.
+	comments(pr PullRequest, head string) ([]Comment, error)
+	votes(pr PullRequest) ([]Vote, error)
+	// postComment posts a comment, replying to the given comment, or on the
+	// given line, if any, and returns the ID of the new comment.
+	postComment(pr PullRequest, text, parentID, path string, line uint32) (string, error)
+	vote(pr PullRequest, approve bool) error
+	// refspecs returns the refspecs that fetch the heads of the given pull requests into their review refs.
+	refspecs(prs []PullRequest) []string
+}
+
+// Mirror synchronizes the pull requests of a single Bitbucket repository.
+type Mirror struct {
+	api api
+	// remote is the git remote that the pull requests' commits are fetched from.
+	remote string
+}
+
+// newClient returns a client for the API at the given URL, which authenticates
+// with the given username and password, or with the given token as a bearer
+// token if there is no username.
+func newClient(apiURL, username, token string) *mirror.Client {
+	client := mirror.NewClient(apiURL)
+	if username != "" {
+		credentials := base64.StdEncoding.EncodeToString([]byte(username + ":" + token))
+		client.Header.Set("Authorization", "Basic "+credentials)
+	} else if token != "" {
+		client.Header.Set("Authorization", "Bearer "+token)
+	}
+	return client
+}
+
+// IsCloud reports whether the given URL, if any, is that of Bitbucket Cloud rather than of a Bitbucket Server.
+func IsCloud(serverURL string) bool {
+	if serverURL == "" {
+		return true
+	}
+	u, err := url.Parse(serverURL)
+	return err == nil && (u.Hostname() == "bitbucket.org" || strings.HasSuffix(u.Hostname(), ".bitbucket.org"))
+}
+
+var cloudRemotePattern = regexp.MustCompile(`bitbucket\.org[:/]([^/]+/[^/]+?)(?:\.git)?/?$`)
+
+// RepoFromURL returns the repository that the git remote URL points to, as
+// "workspace/slug" for Bitbucket Cloud, or as "PROJECT/slug" for the Bitbucket
+// Server at the given URL, if it points to one.
+func RepoFromURL(serverURL, remoteURL string) string {
+	if IsCloud(serverURL) {
+		if match := cloudRemotePattern.FindStringSubmatch(remoteURL); match != nil {
+			return match[1]
+		}
+		return ""
+	}
+	u, err := url.Parse(serverURL)
+	if err != nil || u.Hostname() == "" {
+		return ""
+	}
+	// HTTP URLs are of the form ".../scm/project/slug.git", and SSH ones ":7999/project/slug.git".
+	pattern := regexp.MustCompile(regexp.QuoteMeta(u.Hostname()) + `(?::\d+)?[:/](?:.*/)?([^/]+)/([^/]+?)(?:\.git)?/?$`)
+	match := pattern.FindStringSubmatch(remoteURL)
+	if match == nil {
+		return ""
+	}
+	return strings.ToUpper(match[1]) + "/" + match[2]
+}
+
+// ReviewRef returns the ref that the head of a pull request is fetched into.
+func ReviewRef(id int) string {
+	return fmt.Sprintf("refs/pull-requests/%d/from", id)
+}
+
+var reviewRefPattern = regexp.MustCompile(`^refs/pull-requests/(\d+)/from$`)
+
+// PullRequestID returns the ID of the pull request that a review ref was fetched for, if it was.
+func PullRequestID(reviewRef string) (int, bool) {
+	match := reviewRefPattern.FindStringSubmatch(reviewRef)
+	if match == nil {
+		return 0, false
+	}
+	id, err := strconv.Atoi(match[1])
+	return id, err == nil
+}
+
+// ListPullRequests returns the pull requests updated since the given time, or all of them if it is zero.
+func (m *Mirror) ListPullRequests(since time.Time) ([]PullRequest, error) {
+	return m.api.listPullRequests(since)
+}
+
+// GetPullRequest returns the pull request with the given ID.
+func (m *Mirror) GetPullRequest(id int) (PullRequest, error) {
+	return m.api.getPullRequest(id)
+}
+
+// FetchHeads fetches the heads of the given pull requests, so that their commits can be annotated.
+func (m *Mirror) FetchHeads(prs []PullRequest) error {
+	refspecs := m.api.refspecs(prs)
+	if len(refspecs) == 0 {
+		return nil
+	}
+	if err := repository.FetchRefs(m.remote, refspecs...); err != nil {
+		return fmt.Errorf("Failed to fetch the pull requests from %q: %v", m.remote, err)
+	}
+	return nil
+}
+
+// Imported describes the comments that a pull request has on Bitbucket.
+type Imported struct {
+	// Revision is the first commit of the pull request, which its review is attached to.
+	Revision string
+	// OnBitbucket maps the hashes of the review's comments that are also on
+	// Bitbucket, whether they were imported from there or exported to there,
+	// to their IDs there.
+	OnBitbucket map[string]string
+}
+
+// convertRequest returns the versions of the review request for a pull request:
+// the request as it was opened, and, if the pull request has been merged or
+// declined, the request as of then.
+//
+// Neither API says when a pull request was closed, so the time of its last
+// update is used for that.
+func convertRequest(pr PullRequest) []request.Request {
+	opened := request.Request{
+		Timestamp:   mirror.Timestamp(pr.Created),
+		ReviewRef:   ReviewRef(pr.ID),
+		TargetRef:   "refs/heads/" + pr.TargetBranch,
+		Requester:   pr.Author,
+		Reviewers:   pr.Reviewers,
+		Description: strings.TrimSpace(pr.Title + "\n\n" + pr.Description),
+	}
+	opened.UpdateMentions()
+	requests := []request.Request{opened}
+	switch pr.State {
+	case StateMerged:
+		merged := opened
+		merged.Timestamp = mirror.Timestamp(pr.Updated)
+		merged.SubmittedAs = pr.MergeCommit
+		// Bitbucket Cloud abbreviates the hashes of merge commits.
+		if commit, err := repository.ResolveCommit(pr.MergeCommit); err == nil && pr.MergeCommit != "" {
+			merged.SubmittedAs = commit
+		}
+		requests = append(requests, merged)
+	case StateDeclined:
+		declined := opened
+		declined.Timestamp = mirror.Timestamp(pr.Updated)
+		declined.Abandoned = true
+		requests = append(requests, declined)
+	}
+	return requests
+}
+
+// convertComment returns the git-appraise comment for a comment that is not
+// a reply, or for a reply to the comment with the given hash.
+func convertComment(c Comment, parent string) comment.Comment {
+	converted := mirror.NewComment(mirror.Timestamp(c.Created), c.Author, c.Text)
+	if parent != "" {
+		converted.Parent = parent
+	} else if c.Path != "" {
+		converted.Location = &comment.Location{Commit: c.Commit, Path: c.Path}
+		if c.Line > 0 {
+			converted.Location.Range = &comment.Range{StartLine: c.Line}
+		}
+	}
+	return converted
+}
+
+// Import adds the notes mirroring a pull request, its comments, and its
+// current approvals and requests for changes to the batch.
+//
+// Votes by users who exported a vote from git-appraise are not imported,
+// since the exported vote already records them.
+func (m *Mirror) Import(pr PullRequest, batch *mirror.Batch) (*Imported, error) {
+	commits, err := m.api.commits(pr)
+	if err != nil {
+		return nil, err
+	}
+	if len(commits) == 0 {
+		return nil, fmt.Errorf("The pull request #%d has no commits.", pr.ID)
+	}
+	imported := &Imported{
+		Revision:    commits[0],
+		OnBitbucket: make(map[string]string),
+	}
+	for _, r := range convertRequest(pr) {
+		if err := batch.AddRequest(imported.Revision, r); err != nil {
+			return nil, err
+		}
+	}
+
+	comments, err := m.api.comments(pr, commits[len(commits)-1])
+	if err != nil {
+		return nil, err
+	}
+	votes := mirror.Votes(imported.Revision)
+	exportedVoters := make(map[string]bool)
+	hashes := make(map[string]string)
+	for _, c := range comments {
+		hash, text := mirror.ParseMarker(c.Text)
+		if hash != "" {
+			if votes[hash] {
+				exportedVoters[c.Author] = true
+			}
+		} else {
+			c.Text = text
+			var err error
+			if hash, err = batch.AddComment(imported.Revision, convertComment(c, hashes[c.ParentID])); err != nil {
+				return nil, err
+			}
+		}
+		hashes[c.ID] = hash
+		imported.OnBitbucket[hash] = c.ID
+	}
+
+	current, err := m.api.votes(pr)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(current, func(i, j int) bool { return current[i].Author < current[j].Author })
+	for _, vote := range current {
+		if exportedVoters[vote.Author] || vote.Time.IsZero() {
+			continue
+		}
+		approved := vote.Approved
+		c := mirror.NewComment(mirror.Timestamp(vote.Time), vote.Author, "")
+		c.Resolved = &approved
+		hash, err := batch.AddComment(imported.Revision, c)
+		if err != nil {
+			return nil, err
+		}
+		imported.OnBitbucket[hash] = ""
+	}
+	return imported, nil
+}
+
+// Export posts the comments and votes of the current user on the review of a
+// pull request that are not on Bitbucket yet, and returns how many were posted.
+//
+// Votes are posted as comments, and also approve the pull request or request
+// changes to it. Comments on lines that Bitbucket rejects are posted as
+// comments on the whole pull request instead.
+func (m *Mirror) Export(pr PullRequest, imported *Imported) (int, error) {
+	r := review.Get(imported.Revision)
+	if r == nil {
+		return 0, fmt.Errorf("There is no review for the pull request #%d.", pr.ID)
+	}
+	me := repository.GetUserEmail()
+	var posted int
+	var export func(threads []review.CommentThread, parent string) error
+	export = func(threads []review.CommentThread, parent string) error {
+		for _, thread := range threads {
+			c := thread.Comment
+			if _, ok := imported.OnBitbucket[thread.Hash]; !ok && strings.EqualFold(c.Author, me) && !c.Retracted {
+				if text := mirror.ExportText(c); text != "" {
+					id, err := m.post(pr, thread, imported.OnBitbucket[parent], mirror.AddMarker(text, thread.Hash))
+					if err != nil {
+						return err
+					}
+					imported.OnBitbucket[thread.Hash] = id
+					posted++
+				}
+			}
+			if err := export(thread.Children, thread.Hash); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	err := export(r.Comments, "")
+	return posted, err
+}
+
+// post posts a single comment, replying to the comment with the given ID, if any, and returns the new comment's ID.
+func (m *Mirror) post(pr PullRequest, thread review.CommentThread, parentID, text string) (string, error) {
+	c := thread.Comment
+	if parentID != "" {
+		return m.api.postComment(pr, text, parentID, "", 0)
+	}
+	if c.Resolved != nil && c.Location.IsWholeCommit() {
+		id, err := m.api.postComment(pr, text, "", "", 0)
+		if err != nil {
+			return "", err
+		}
+		return id, m.api.vote(pr, *c.Resolved)
+	}
+	if c.Location != nil && c.Location.Path != "" && c.Location.Range != nil {
+		if id, err := m.api.postComment(pr, text, "", c.Location.Path, c.Location.Range.StartLine); err == nil {
+			return id, nil
+		}
+	}
+	return m.api.postComment(pr, text, "", "", 0)
+}
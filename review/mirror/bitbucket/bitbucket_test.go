@@ -0,0 +1,100 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bitbucket
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/git-appraise/review/comment"
+)
+
+func TestRepoFromURL(t *testing.T) {
+	tests := []struct {
+		serverURL string
+		remoteURL string
+		want      string
+	}{
+		{"", "git@bitbucket.org:team/repo.git", "team/repo"},
+		{"https://bitbucket.org", "https://alice@bitbucket.org/team/repo.git", "team/repo"},
+		{"", "https://github.com/team/repo.git", ""},
+		{"https://git.example.com", "https://git.example.com/scm/proj/repo.git", "PROJ/repo"},
+		{"https://git.example.com", "ssh://git@git.example.com:7999/proj/repo.git", "PROJ/repo"},
+		{"https://git.example.com", "https://bitbucket.org/team/repo.git", ""},
+	}
+	for _, test := range tests {
+		if got := RepoFromURL(test.serverURL, test.remoteURL); got != test.want {
+			t.Errorf("RepoFromURL(%q, %q) = %q, want %q", test.serverURL, test.remoteURL, got, test.want)
+		}
+	}
+}
+
+func TestPullRequestID(t *testing.T) {
+	if id, ok := PullRequestID(ReviewRef(42)); !ok || id != 42 {
+		t.Errorf("PullRequestID(%q) = %d, %v", ReviewRef(42), id, ok)
+	}
+	if _, ok := PullRequestID("refs/heads/feature"); ok {
+		t.Error("Expected no pull request for a branch")
+	}
+}
+
+func TestConvertRequest(t *testing.T) {
+	pr := PullRequest{
+		ID:           4,
+		Title:        "Fix the frobnicator",
+		Description:  "cc @carol",
+		Author:       "alice@example.com",
+		Reviewers:    []string{"bob@example.com"},
+		State:        StateDeclined,
+		Created:      time.Unix(1000, 0),
+		Updated:      time.Unix(2000, 0),
+		TargetBranch: "main",
+	}
+	requests := convertRequest(pr)
+	if len(requests) != 2 {
+		t.Fatalf("Unexpected requests: %+v", requests)
+	}
+	opened, declined := requests[0], requests[1]
+	if opened.Timestamp != "1000" || opened.ReviewRef != "refs/pull-requests/4/from" || opened.TargetRef != "refs/heads/main" ||
+		opened.Requester != "alice@example.com" || opened.Description != "Fix the frobnicator\n\ncc @carol" || opened.Abandoned {
+		t.Errorf("Unexpected request: %+v", opened)
+	}
+	if !reflect.DeepEqual(opened.Mentions, []string{"carol"}) {
+		t.Errorf("Unexpected mentions: %v", opened.Mentions)
+	}
+	if declined.Timestamp != "2000" || !declined.Abandoned {
+		t.Errorf("Unexpected request for the declined pull request: %+v", declined)
+	}
+}
+
+func TestConvertComment(t *testing.T) {
+	c := Comment{Author: "bob@example.com", Text: "Why?", Created: time.Unix(1000, 0), Path: "a.go", Line: 3, Commit: "abc"}
+	want := &comment.Location{Commit: "abc", Path: "a.go", Range: &comment.Range{StartLine: 3}}
+	if got := convertComment(c, ""); !reflect.DeepEqual(got.Location, want) || got.Parent != "" || got.Timestamp != "1000" {
+		t.Errorf("Unexpected comment on a line: %+v", got)
+	}
+	if got := convertComment(c, "parent"); got.Location != nil || got.Parent != "parent" {
+		t.Errorf("Unexpected reply: %+v", got)
+	}
+}
+
+func TestServerTime(t *testing.T) {
+	if got, want := serverTime(1577836800123), time.Date(2020, 1, 1, 0, 0, 0, 123000000, time.UTC); !got.Equal(want) {
+		t.Errorf("serverTime = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,314 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bitbucket
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/google/git-appraise/review/mirror"
+)
+
+// CloudURL is the URL of the API of Bitbucket Cloud.
+const CloudURL = "https://api.bitbucket.org/2.0"
+
+// cloudDomain is the domain of the email addresses given to Bitbucket Cloud users.
+const cloudDomain = "users.noreply.bitbucket.org"
+
+type cloudUser struct {
+	Nickname  string `json:"nickname"`
+	AccountID string `json:"account_id"`
+}
+
+func (u cloudUser) email() string {
+	if u.Nickname != "" {
+		return mirror.Email(u.Nickname, cloudDomain)
+	}
+	return mirror.Email(u.AccountID, cloudDomain)
+}
+
+type cloudPullRequest struct {
+	ID          int       `json:"id"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	State       string    `json:"state"`
+	CreatedOn   time.Time `json:"created_on"`
+	UpdatedOn   time.Time `json:"updated_on"`
+	Author      cloudUser `json:"author"`
+	Source      struct {
+		Branch struct {
+			Name string `json:"name"`
+		} `json:"branch"`
+		Repository *struct {
+			FullName string `json:"full_name"`
+		} `json:"repository"`
+	} `json:"source"`
+	Destination struct {
+		Branch struct {
+			Name string `json:"name"`
+		} `json:"branch"`
+	} `json:"destination"`
+	MergeCommit *struct {
+		Hash string `json:"hash"`
+	} `json:"merge_commit"`
+	Reviewers []cloudUser `json:"reviewers"`
+}
+
+type cloudComment struct {
+	ID        int64     `json:"id"`
+	CreatedOn time.Time `json:"created_on"`
+	User      cloudUser `json:"user"`
+	Deleted   bool      `json:"deleted"`
+	Content   struct {
+		Raw string `json:"raw"`
+	} `json:"content"`
+	Inline *struct {
+		Path string `json:"path"`
+		To   uint32 `json:"to"`
+	} `json:"inline"`
+	Parent *struct {
+		ID int64 `json:"id"`
+	} `json:"parent"`
+}
+
+type cloudParticipant struct {
+	User     cloudUser `json:"user"`
+	Approved bool      `json:"approved"`
+	State    string    `json:"state"`
+}
+
+type cloudEvent struct {
+	Date time.Time `json:"date"`
+	User cloudUser `json:"user"`
+}
+
+type cloudActivity struct {
+	Approval         *cloudEvent `json:"approval"`
+	ChangesRequested *cloudEvent `json:"changes_requested"`
+}
+
+// cloud is the API of Bitbucket Cloud.
+type cloud struct {
+	client *mirror.Client
+	// repo is the repository, as "workspace/slug".
+	repo string
+}
+
+// NewCloud returns a mirror of the given repository ("workspace/slug") on
+// Bitbucket Cloud, using the API at the given URL, which fetches commits from
+// the given git remote.
+//
+// It authenticates with the given username and app password, or with the
+// given access token if there is no username.
+func NewCloud(apiURL, username, token, repo, remote string) *Mirror {
+	return &Mirror{api: &cloud{client: newClient(apiURL, username, token), repo: repo}, remote: remote}
+}
+
+// getAll fetches every page of a list, following the "next" links of the pages.
+func (c *cloud) getAll(path string, items interface{}) error {
+	var all []json.RawMessage
+	for path != "" {
+		var page struct {
+			Values []json.RawMessage `json:"values"`
+			Next   string            `json:"next"`
+		}
+		if _, err := c.client.Get(path, &page); err != nil {
+			return err
+		}
+		all = append(all, page.Values...)
+		path = page.Next
+	}
+	encoded, err := json.Marshal(all)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(encoded, items)
+}
+
+func (c *cloud) path(format string, args ...interface{}) string {
+	return "/repositories/" + c.repo + fmt.Sprintf(format, args...)
+}
+
+func (c *cloud) convert(pr cloudPullRequest) PullRequest {
+	var reviewers []string
+	for _, reviewer := range pr.Reviewers {
+		reviewers = append(reviewers, reviewer.email())
+	}
+	converted := PullRequest{
+		ID:           pr.ID,
+		Title:        pr.Title,
+		Description:  pr.Description,
+		Author:       pr.Author.email(),
+		Reviewers:    reviewers,
+		State:        pr.State,
+		Created:      pr.CreatedOn,
+		Updated:      pr.UpdatedOn,
+		TargetBranch: pr.Destination.Branch.Name,
+	}
+	if pr.MergeCommit != nil {
+		converted.MergeCommit = pr.MergeCommit.Hash
+	}
+	// Only branches of the repository itself can be fetched, rather than those of forks.
+	if pr.Source.Repository != nil && pr.Source.Repository.FullName == c.repo {
+		converted.sourceBranch = pr.Source.Branch.Name
+	}
+	return converted
+}
+
+func (c *cloud) listPullRequests(since time.Time) ([]PullRequest, error) {
+	path := c.path("/pullrequests?state=OPEN&state=MERGED&state=DECLINED&state=SUPERSEDED&pagelen=50")
+	if !since.IsZero() {
+		path += "&q=" + url.QueryEscape(fmt.Sprintf("updated_on >= %s", since.UTC().Format(time.RFC3339)))
+	}
+	var prs []cloudPullRequest
+	if err := c.getAll(path, &prs); err != nil {
+		return nil, err
+	}
+	var converted []PullRequest
+	for _, pr := range prs {
+		converted = append(converted, c.convert(pr))
+	}
+	return converted, nil
+}
+
+func (c *cloud) getPullRequest(id int) (PullRequest, error) {
+	var pr cloudPullRequest
+	_, err := c.client.Get(c.path("/pullrequests/%d", id), &pr)
+	return c.convert(pr), err
+}
+
+func (c *cloud) commits(pr PullRequest) ([]string, error) {
+	var commits []struct {
+		Hash string `json:"hash"`
+	}
+	if err := c.getAll(c.path("/pullrequests/%d/commits", pr.ID), &commits); err != nil {
+		return nil, err
+	}
+	// The commits are listed newest first.
+	var hashes []string
+	for i := len(commits) - 1; i >= 0; i-- {
+		hashes = append(hashes, commits[i].Hash)
+	}
+	return hashes, nil
+}
+
+func (c *cloud) comments(pr PullRequest, head string) ([]Comment, error) {
+	var comments []cloudComment
+	if err := c.getAll(c.path("/pullrequests/%d/comments?pagelen=100", pr.ID), &comments); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(comments, func(i, j int) bool { return comments[i].ID < comments[j].ID })
+	var converted []Comment
+	for _, comment := range comments {
+		if comment.Deleted {
+			continue
+		}
+		cc := Comment{
+			ID:      strconv.FormatInt(comment.ID, 10),
+			Author:  comment.User.email(),
+			Text:    comment.Content.Raw,
+			Created: comment.CreatedOn,
+		}
+		if comment.Parent != nil {
+			cc.ParentID = strconv.FormatInt(comment.Parent.ID, 10)
+		}
+		if comment.Inline != nil {
+			cc.Path, cc.Line, cc.Commit = comment.Inline.Path, comment.Inline.To, head
+		}
+		converted = append(converted, cc)
+	}
+	return converted, nil
+}
+
+func (c *cloud) votes(pr PullRequest) ([]Vote, error) {
+	var full struct {
+		Participants []cloudParticipant `json:"participants"`
+	}
+	if _, err := c.client.Get(c.path("/pullrequests/%d", pr.ID), &full); err != nil {
+		return nil, err
+	}
+	var activities []cloudActivity
+	if err := c.getAll(c.path("/pullrequests/%d/activity?pagelen=50", pr.ID), &activities); err != nil {
+		return nil, err
+	}
+	approvedAt := make(map[string]time.Time)
+	changesRequestedAt := make(map[string]time.Time)
+	for _, activity := range activities {
+		if e := activity.Approval; e != nil && e.Date.After(approvedAt[e.User.email()]) {
+			approvedAt[e.User.email()] = e.Date
+		}
+		if e := activity.ChangesRequested; e != nil && e.Date.After(changesRequestedAt[e.User.email()]) {
+			changesRequestedAt[e.User.email()] = e.Date
+		}
+	}
+	var votes []Vote
+	for _, participant := range full.Participants {
+		author := participant.User.email()
+		switch {
+		case participant.Approved || participant.State == "approved":
+			votes = append(votes, Vote{Author: author, Approved: true, Time: approvedAt[author]})
+		case participant.State == "changes_requested":
+			votes = append(votes, Vote{Author: author, Approved: false, Time: changesRequestedAt[author]})
+		}
+	}
+	return votes, nil
+}
+
+func (c *cloud) postComment(pr PullRequest, text, parentID, path string, line uint32) (string, error) {
+	fields := map[string]interface{}{"content": map[string]string{"raw": text}}
+	if parentID != "" {
+		id, err := strconv.ParseInt(parentID, 10, 64)
+		if err != nil {
+			return "", err
+		}
+		fields["parent"] = map[string]int64{"id": id}
+	} else if path != "" {
+		fields["inline"] = map[string]interface{}{"path": path, "to": line}
+	}
+	var created struct {
+		ID int64 `json:"id"`
+	}
+	if _, err := c.client.Do("POST", c.path("/pullrequests/%d/comments", pr.ID), fields, &created); err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(created.ID, 10), nil
+}
+
+func (c *cloud) vote(pr PullRequest, approve bool) error {
+	action := "request-changes"
+	if approve {
+		action = "approve"
+	}
+	_, err := c.client.Do("POST", c.path("/pullrequests/%d/%s", pr.ID, action), nil, nil)
+	return err
+}
+
+// refspecs fetches the source branches of open pull requests. Those of closed pull
+// requests are often deleted, and merged ones are in their target branches.
+func (c *cloud) refspecs(prs []PullRequest) []string {
+	var refspecs []string
+	for _, pr := range prs {
+		if pr.sourceBranch != "" && pr.State == StateOpen {
+			refspecs = append(refspecs, fmt.Sprintf("+refs/heads/%s:%s", pr.sourceBranch, ReviewRef(pr.ID)))
+		}
+	}
+	return refspecs
+}
@@ -0,0 +1,342 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bitbucket
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/git-appraise/review/mirror"
+)
+
+type serverUser struct {
+	Name         string `json:"name"`
+	Slug         string `json:"slug"`
+	EmailAddress string `json:"emailAddress"`
+}
+
+// email returns the email address of a Bitbucket Server user, or one in the
+// given domain if the user's address is hidden.
+func (u serverUser) email(domain string) string {
+	if u.EmailAddress != "" {
+		return u.EmailAddress
+	}
+	return mirror.Email(u.Name, domain)
+}
+
+type serverParticipant struct {
+	User   serverUser `json:"user"`
+	Status string     `json:"status"`
+}
+
+type serverPullRequest struct {
+	ID          int                 `json:"id"`
+	Title       string              `json:"title"`
+	Description string              `json:"description"`
+	State       string              `json:"state"`
+	CreatedDate int64               `json:"createdDate"`
+	UpdatedDate int64               `json:"updatedDate"`
+	Author      serverParticipant   `json:"author"`
+	Reviewers   []serverParticipant `json:"reviewers"`
+	ToRef       struct {
+		DisplayID string `json:"displayId"`
+	} `json:"toRef"`
+	Properties struct {
+		MergeCommit *struct {
+			ID string `json:"id"`
+		} `json:"mergeCommit"`
+	} `json:"properties"`
+}
+
+type serverComment struct {
+	ID          int64           `json:"id"`
+	Text        string          `json:"text"`
+	Author      serverUser      `json:"author"`
+	CreatedDate int64           `json:"createdDate"`
+	Comments    []serverComment `json:"comments"`
+}
+
+type serverActivity struct {
+	Action        string         `json:"action"`
+	CreatedDate   int64          `json:"createdDate"`
+	User          serverUser     `json:"user"`
+	Comment       *serverComment `json:"comment"`
+	CommentAnchor *struct {
+		Path   string `json:"path"`
+		Line   uint32 `json:"line"`
+		ToHash string `json:"toHash"`
+	} `json:"commentAnchor"`
+}
+
+// serverTime converts a timestamp of the Bitbucket Server API, in milliseconds.
+func serverTime(millis int64) time.Time {
+	return time.Unix(0, millis*int64(time.Millisecond))
+}
+
+// server is the API of Bitbucket Server.
+type server struct {
+	client *mirror.Client
+	// project and slug identify the repository.
+	project, slug string
+	// username is the slug of the user, which is needed to vote.
+	username string
+	// domain is the domain of the email addresses given to users whose address is hidden.
+	domain string
+}
+
+// NewServer returns a mirror of the given repository ("PROJECT/slug") on the
+// Bitbucket Server at the given URL, which fetches commits from the given git
+// remote.
+//
+// It authenticates with the given username and password, or with the given
+// access token if there is no username.
+func NewServer(serverURL, username, token, repo, remote string) *Mirror {
+	serverURL = strings.TrimSuffix(serverURL, "/")
+	s := &server{
+		client:   newClient(serverURL+"/rest/api/1.0", username, token),
+		username: username,
+		domain:   "users.noreply.bitbucket",
+	}
+	if parts := strings.SplitN(repo, "/", 2); len(parts) == 2 {
+		s.project, s.slug = parts[0], parts[1]
+	}
+	if u, err := url.Parse(serverURL); err == nil && u.Hostname() != "" {
+		s.domain = "users.noreply." + u.Hostname()
+	}
+	return &Mirror{api: s, remote: remote}
+}
+
+// getAll fetches every page of a list, following the pages' "nextPageStart".
+func (s *server) getAll(path string, items interface{}) error {
+	var all []json.RawMessage
+	separator := "?"
+	if strings.Contains(path, "?") {
+		separator = "&"
+	}
+	for start := 0; ; {
+		var page struct {
+			Values        []json.RawMessage `json:"values"`
+			IsLastPage    bool              `json:"isLastPage"`
+			NextPageStart int               `json:"nextPageStart"`
+		}
+		if _, err := s.client.Get(fmt.Sprintf("%s%slimit=100&start=%d", path, separator, start), &page); err != nil {
+			return err
+		}
+		all = append(all, page.Values...)
+		if page.IsLastPage || len(page.Values) == 0 {
+			break
+		}
+		start = page.NextPageStart
+	}
+	encoded, err := json.Marshal(all)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(encoded, items)
+}
+
+func (s *server) path(format string, args ...interface{}) string {
+	return fmt.Sprintf("/projects/%s/repos/%s", url.PathEscape(s.project), url.PathEscape(s.slug)) + fmt.Sprintf(format, args...)
+}
+
+func (s *server) convert(pr serverPullRequest) PullRequest {
+	var reviewers []string
+	for _, reviewer := range pr.Reviewers {
+		reviewers = append(reviewers, reviewer.User.email(s.domain))
+	}
+	converted := PullRequest{
+		ID:           pr.ID,
+		Title:        pr.Title,
+		Description:  pr.Description,
+		Author:       pr.Author.User.email(s.domain),
+		Reviewers:    reviewers,
+		State:        pr.State,
+		Created:      serverTime(pr.CreatedDate),
+		Updated:      serverTime(pr.UpdatedDate),
+		TargetBranch: pr.ToRef.DisplayID,
+	}
+	if pr.Properties.MergeCommit != nil {
+		converted.MergeCommit = pr.Properties.MergeCommit.ID
+	}
+	return converted
+}
+
+// listPullRequests lists the pull requests, filtering them by the time of their
+// last update here, since the API cannot do that.
+func (s *server) listPullRequests(since time.Time) ([]PullRequest, error) {
+	var prs []serverPullRequest
+	if err := s.getAll(s.path("/pull-requests?state=ALL&order=NEWEST"), &prs); err != nil {
+		return nil, err
+	}
+	var converted []PullRequest
+	for _, pr := range prs {
+		if c := s.convert(pr); !c.Updated.Before(since) {
+			converted = append(converted, c)
+		}
+	}
+	return converted, nil
+}
+
+func (s *server) getPullRequest(id int) (PullRequest, error) {
+	var pr serverPullRequest
+	_, err := s.client.Get(s.path("/pull-requests/%d", id), &pr)
+	return s.convert(pr), err
+}
+
+func (s *server) commits(pr PullRequest) ([]string, error) {
+	var commits []struct {
+		ID string `json:"id"`
+	}
+	if err := s.getAll(s.path("/pull-requests/%d/commits", pr.ID), &commits); err != nil {
+		return nil, err
+	}
+	// The commits are listed newest first.
+	var hashes []string
+	for i := len(commits) - 1; i >= 0; i-- {
+		hashes = append(hashes, commits[i].ID)
+	}
+	return hashes, nil
+}
+
+// activities returns the activities of a pull request, oldest first.
+func (s *server) activities(pr PullRequest) ([]serverActivity, error) {
+	var activities []serverActivity
+	if err := s.getAll(s.path("/pull-requests/%d/activities", pr.ID), &activities); err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(activities)-1; i < j; i, j = i+1, j-1 {
+		activities[i], activities[j] = activities[j], activities[i]
+	}
+	return activities, nil
+}
+
+func (s *server) comments(pr PullRequest, head string) ([]Comment, error) {
+	activities, err := s.activities(pr)
+	if err != nil {
+		return nil, err
+	}
+	var converted []Comment
+	var add func(c serverComment, parentID string)
+	add = func(c serverComment, parentID string) {
+		id := strconv.FormatInt(c.ID, 10)
+		converted = append(converted, Comment{
+			ID:       id,
+			ParentID: parentID,
+			Author:   c.Author.email(s.domain),
+			Text:     c.Text,
+			Created:  serverTime(c.CreatedDate),
+		})
+		for _, reply := range c.Comments {
+			add(reply, id)
+		}
+	}
+	for _, activity := range activities {
+		if activity.Action != "COMMENTED" || activity.Comment == nil {
+			continue
+		}
+		first := len(converted)
+		add(*activity.Comment, "")
+		if anchor := activity.CommentAnchor; anchor != nil {
+			converted[first].Path, converted[first].Line, converted[first].Commit = anchor.Path, anchor.Line, anchor.ToHash
+			if converted[first].Commit == "" {
+				converted[first].Commit = head
+			}
+		}
+	}
+	return converted, nil
+}
+
+// votes returns the current votes of the reviewers, as of the latest activity
+// in which they approved the pull request or marked it as needing work.
+func (s *server) votes(pr PullRequest) ([]Vote, error) {
+	var full serverPullRequest
+	if _, err := s.client.Get(s.path("/pull-requests/%d", pr.ID), &full); err != nil {
+		return nil, err
+	}
+	activities, err := s.activities(pr)
+	if err != nil {
+		return nil, err
+	}
+	approvedAt := make(map[string]time.Time)
+	needsWorkAt := make(map[string]time.Time)
+	for _, activity := range activities {
+		switch activity.Action {
+		case "APPROVED":
+			approvedAt[activity.User.email(s.domain)] = serverTime(activity.CreatedDate)
+		case "REVIEWED":
+			needsWorkAt[activity.User.email(s.domain)] = serverTime(activity.CreatedDate)
+		}
+	}
+	var votes []Vote
+	for _, reviewer := range full.Reviewers {
+		author := reviewer.User.email(s.domain)
+		switch reviewer.Status {
+		case "APPROVED":
+			votes = append(votes, Vote{Author: author, Approved: true, Time: approvedAt[author]})
+		case "NEEDS_WORK":
+			votes = append(votes, Vote{Author: author, Approved: false, Time: needsWorkAt[author]})
+		}
+	}
+	return votes, nil
+}
+
+func (s *server) postComment(pr PullRequest, text, parentID, path string, line uint32) (string, error) {
+	fields := map[string]interface{}{"text": text}
+	if parentID != "" {
+		id, err := strconv.ParseInt(parentID, 10, 64)
+		if err != nil {
+			return "", err
+		}
+		fields["parent"] = map[string]int64{"id": id}
+	} else if path != "" {
+		fields["anchor"] = map[string]interface{}{
+			"path":     path,
+			"line":     line,
+			"lineType": "ADDED",
+			"fileType": "TO",
+			"diffType": "EFFECTIVE",
+		}
+	}
+	var created struct {
+		ID int64 `json:"id"`
+	}
+	if _, err := s.client.Do("POST", s.path("/pull-requests/%d/comments", pr.ID), fields, &created); err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(created.ID, 10), nil
+}
+
+func (s *server) vote(pr PullRequest, approve bool) error {
+	if s.username == "" {
+		return errors.New("Voting on Bitbucket Server requires a username.")
+	}
+	status := "NEEDS_WORK"
+	if approve {
+		status = "APPROVED"
+	}
+	_, err := s.client.Do("PUT", s.path("/pull-requests/%d/participants/%s", pr.ID, url.PathEscape(s.username)), map[string]string{"status": status}, nil)
+	return err
+}
+
+func (s *server) refspecs(prs []PullRequest) []string {
+	return []string{"+refs/pull-requests/*/from:refs/pull-requests/*/from"}
+}
@@ -0,0 +1,160 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mirror
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// Client is a minimal client for the JSON APIs of code review systems.
+type Client struct {
+	// BaseURL is prepended to the paths of requests that are not full URLs.
+	BaseURL string
+	// Header holds the headers sent with every request, such as the credentials.
+	Header http.Header
+	// ResponsePrefix is stripped from responses before they are parsed, for
+	// APIs that guard their JSON against cross-site script inclusion.
+	ResponsePrefix string
+	HTTPClient     *http.Client
+}
+
+// NewClient returns a client for the API at the given URL.
+func NewClient(baseURL string) *Client {
+	return &Client{
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		Header:     make(http.Header),
+		HTTPClient: http.DefaultClient,
+	}
+}
+
+// Do sends a request with the given body, if any, encoded as JSON, and decodes
+// the JSON response into the given result, if any.
+//
+// Responses with a status other than 2xx are returned as errors.
+func (c *Client) Do(method, path string, body, result interface{}) (*http.Response, error) {
+	url := path
+	if !strings.HasPrefix(path, "http://") && !strings.HasPrefix(path, "https://") {
+		url = c.BaseURL + path
+	}
+	var reqBody *bytes.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reqBody = bytes.NewReader(encoded)
+	} else {
+		reqBody = bytes.NewReader(nil)
+	}
+	req, err := http.NewRequest(method, url, reqBody)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range c.Header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return resp, err
+	}
+	if resp.StatusCode/100 != 2 {
+		message := strings.TrimSpace(string(respBody))
+		if len(message) > 200 {
+			message = message[:200] + "..."
+		}
+		return resp, fmt.Errorf("%s %s: %s: %s", method, url, resp.Status, message)
+	}
+	if result != nil {
+		respBody = bytes.TrimPrefix(respBody, []byte(c.ResponsePrefix))
+		if err := json.Unmarshal(respBody, result); err != nil {
+			return resp, fmt.Errorf("%s %s: invalid response: %v", method, url, err)
+		}
+	}
+	return resp, nil
+}
+
+// Get fetches the given path, and decodes the JSON response into the given result.
+func (c *Client) Get(path string, result interface{}) (*http.Response, error) {
+	return c.Do("GET", path, nil, result)
+}
+
+// linkPattern matches the link to the next page in a "Link" header.
+var linkPattern = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+
+// NextLink returns the URL of the next page of a paginated response, from its
+// "Link" header, or an empty string if it is the last page.
+func NextLink(resp *http.Response) string {
+	if match := linkPattern.FindStringSubmatch(resp.Header.Get("Link")); match != nil {
+		return match[1]
+	}
+	return ""
+}
+
+// GetAllPages fetches each page of a paginated list, following the "Link"
+// headers, and calls the given function with the body of each page, which is
+// a JSON array.
+func (c *Client) GetAllPages(path string, page func(json.RawMessage) error) error {
+	for path != "" {
+		var body json.RawMessage
+		resp, err := c.Get(path, &body)
+		if err != nil {
+			return err
+		}
+		if err := page(body); err != nil {
+			return err
+		}
+		path = NextLink(resp)
+	}
+	return nil
+}
+
+// GetAll fetches every page of a paginated list, and decodes the concatenation
+// of their items into the given slice.
+func (c *Client) GetAll(path string, items interface{}) error {
+	var elements []json.RawMessage
+	err := c.GetAllPages(path, func(page json.RawMessage) error {
+		var pageElements []json.RawMessage
+		if err := json.Unmarshal(page, &pageElements); err != nil {
+			return err
+		}
+		elements = append(elements, pageElements...)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	all, err := json.Marshal(elements)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(all, items)
+}
@@ -0,0 +1,437 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gerrit imports Gerrit changes, with their patch sets, comments, and
+// Code-Review votes, into git-appraise reviews.
+//
+// Each change becomes a review of the commit of its first patch set. Every
+// later patch set adds a version of the review request whose alias is the
+// patch set's commit, and comments stay attached to the commits of the patch
+// sets they were made on, so the mapping between revisions and patch sets is
+// preserved.
+package gerrit
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/git-appraise/repository"
+	"github.com/google/git-appraise/review/comment"
+	"github.com/google/git-appraise/review/mirror"
+	"github.com/google/git-appraise/review/request"
+)
+
+const (
+	// responsePrefix guards the responses of the Gerrit API against cross-site script inclusion.
+	responsePrefix = ")]}'"
+
+	// timeLayout is the layout of the timestamps in the Gerrit API, which are in UTC.
+	timeLayout = "2006-01-02 15:04:05.999999999"
+
+	// codeReview is the label holding the review votes.
+	codeReview = "Code-Review"
+
+	// Paths of the comments that are not on a file.
+	commitMessagePath = "/COMMIT_MSG"
+	patchSetLevelPath = "/PATCHSET_LEVEL"
+
+	// pageSize is the number of changes requested at a time.
+	pageSize = 100
+)
+
+// Time is a timestamp in the Gerrit API.
+type Time struct {
+	time.Time
+}
+
+// UnmarshalJSON parses a timestamp in the Gerrit API's format.
+func (t *Time) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	parsed, err := time.Parse(timeLayout, s)
+	if err != nil {
+		return err
+	}
+	t.Time = parsed
+	return nil
+}
+
+type account struct {
+	AccountID int    `json:"_account_id"`
+	Username  string `json:"username"`
+	Email     string `json:"email"`
+}
+
+type commitInfo struct {
+	Message string `json:"message"`
+}
+
+type revision struct {
+	Number   int        `json:"_number"`
+	Created  Time       `json:"created"`
+	Uploader account    `json:"uploader"`
+	Ref      string     `json:"ref"`
+	Commit   commitInfo `json:"commit"`
+}
+
+type approval struct {
+	account
+	Value int   `json:"value"`
+	Date  *Time `json:"date"`
+}
+
+type label struct {
+	All []approval `json:"all"`
+}
+
+type message struct {
+	Author         *account `json:"author"`
+	Date           Time     `json:"date"`
+	Message        string   `json:"message"`
+	RevisionNumber int      `json:"_revision_number"`
+}
+
+// Change is the part of a Gerrit change that is imported.
+type Change struct {
+	Number          int                  `json:"_number"`
+	Project         string               `json:"project"`
+	Branch          string               `json:"branch"`
+	Subject         string               `json:"subject"`
+	Status          string               `json:"status"`
+	Created         Time                 `json:"created"`
+	Updated         Time                 `json:"updated"`
+	Submitted       *Time                `json:"submitted"`
+	Owner           account              `json:"owner"`
+	CurrentRevision string               `json:"current_revision"`
+	Revisions       map[string]revision  `json:"revisions"`
+	Labels          map[string]label     `json:"labels"`
+	Messages        []message            `json:"messages"`
+	Reviewers       map[string][]account `json:"reviewers"`
+	MoreChanges     bool                 `json:"_more_changes"`
+}
+
+type commentRange struct {
+	StartLine uint32 `json:"start_line"`
+	EndLine   uint32 `json:"end_line"`
+}
+
+type inlineComment struct {
+	ID         string        `json:"id"`
+	InReplyTo  string        `json:"in_reply_to"`
+	PatchSet   int           `json:"patch_set"`
+	Side       string        `json:"side"`
+	Line       uint32        `json:"line"`
+	Range      *commentRange `json:"range"`
+	Message    string        `json:"message"`
+	Updated    Time          `json:"updated"`
+	Author     account       `json:"author"`
+	Unresolved *bool         `json:"unresolved"`
+	path       string
+}
+
+// Importer imports the changes of a single Gerrit project.
+type Importer struct {
+	client *mirror.Client
+	// project is the name of the project.
+	project string
+	// domain is the domain of the email addresses given to Gerrit users without one.
+	domain string
+	// remote is the git remote that the patch sets are fetched from.
+	remote string
+}
+
+// New returns an importer of the given project on the Gerrit server at the
+// given URL, authenticating with the given username and HTTP password, if
+// any, which fetches patch sets from the given git remote.
+func New(serverURL, username, password, project, remote string) *Importer {
+	serverURL = strings.TrimSuffix(serverURL, "/")
+	apiURL := serverURL
+	if username != "" {
+		apiURL += "/a"
+	}
+	client := mirror.NewClient(apiURL)
+	client.ResponsePrefix = responsePrefix
+	if username != "" {
+		credentials := base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+		client.Header.Set("Authorization", "Basic "+credentials)
+	}
+	domain := "users.noreply.gerrit"
+	if u, err := url.Parse(serverURL); err == nil && u.Hostname() != "" {
+		domain = "users.noreply." + u.Hostname()
+	}
+	return &Importer{client: client, project: project, domain: domain, remote: remote}
+}
+
+// ProjectFromURL returns the name of the project on the Gerrit server at the
+// given URL that the git remote URL points to, if it does point to one.
+func ProjectFromURL(serverURL, remoteURL string) string {
+	u, err := url.Parse(serverURL)
+	if err != nil || u.Hostname() == "" {
+		return ""
+	}
+	pattern := regexp.MustCompile(regexp.QuoteMeta(u.Hostname()) + `(?::\d+)?[:/](.+?)(?:\.git)?/?$`)
+	match := pattern.FindStringSubmatch(remoteURL)
+	if match == nil {
+		return ""
+	}
+	// Authenticated HTTP URLs have an "/a/" prefix.
+	return strings.TrimPrefix(strings.TrimPrefix(match[1], "/"), "a/")
+}
+
+// query returns the changes matching a query, with everything that is imported.
+func (i *Importer) query(q string) ([]Change, error) {
+	var all []Change
+	for start := 0; ; start += pageSize {
+		path := fmt.Sprintf("/changes/?q=%s&o=ALL_REVISIONS&o=ALL_COMMITS&o=DETAILED_ACCOUNTS&o=DETAILED_LABELS&o=MESSAGES&n=%d&S=%d",
+			url.QueryEscape(q), pageSize, start)
+		var changes []Change
+		if _, err := i.client.Get(path, &changes); err != nil {
+			return nil, err
+		}
+		all = append(all, changes...)
+		if len(changes) == 0 || !changes[len(changes)-1].MoreChanges {
+			return all, nil
+		}
+	}
+}
+
+// ListChanges returns all of the project's changes.
+func (i *Importer) ListChanges() ([]Change, error) {
+	return i.query("project:" + i.project)
+}
+
+// GetChange returns the change with the given number.
+func (i *Importer) GetChange(number int) (Change, error) {
+	changes, err := i.query(fmt.Sprintf("project:%s change:%d", i.project, number))
+	if err != nil {
+		return Change{}, err
+	}
+	if len(changes) == 0 {
+		return Change{}, fmt.Errorf("There is no change %d in the project %q.", number, i.project)
+	}
+	return changes[0], nil
+}
+
+// FetchPatchSets fetches the patch sets of all of the changes, so that their commits can be annotated.
+func (i *Importer) FetchPatchSets() error {
+	if err := repository.FetchRefs(i.remote, "+refs/changes/*:refs/changes/*"); err != nil {
+		return fmt.Errorf("Failed to fetch the patch sets from %q: %v", i.remote, err)
+	}
+	return nil
+}
+
+// email returns the email address used for a Gerrit account.
+func (i *Importer) email(a account) string {
+	if a.Email != "" {
+		return a.Email
+	}
+	if a.Username != "" {
+		return mirror.Email(a.Username, i.domain)
+	}
+	return mirror.Email(fmt.Sprintf("account-%d", a.AccountID), i.domain)
+}
+
+// patchSets returns the commits of a change's patch sets, indexed by their numbers.
+func patchSets(change Change) map[int]string {
+	commits := make(map[int]string)
+	for commit, r := range change.Revisions {
+		commits[r.Number] = commit
+	}
+	return commits
+}
+
+// revisionAt returns the commit of the latest patch set of a change uploaded by the given time.
+func revisionAt(change Change, commits map[int]string, t time.Time) string {
+	var latest int
+	for number, commit := range commits {
+		if number > latest && !change.Revisions[commit].Created.After(t) {
+			latest = number
+		}
+	}
+	if latest == 0 {
+		latest = 1
+	}
+	return commits[latest]
+}
+
+// convertRequest returns the versions of the review request for a change: one
+// for each patch set, and, if the change has been merged or abandoned, one as
+// of then.
+func (i *Importer) convertRequest(change Change, commits map[int]string) []request.Request {
+	var reviewers []string
+	for _, a := range change.Reviewers["REVIEWER"] {
+		if a.AccountID != change.Owner.AccountID {
+			reviewers = append(reviewers, i.email(a))
+		}
+	}
+	var numbers []int
+	for number := range commits {
+		numbers = append(numbers, number)
+	}
+	sort.Ints(numbers)
+
+	var requests []request.Request
+	for _, number := range numbers {
+		commit := commits[number]
+		r := request.Request{
+			Timestamp:   mirror.Timestamp(change.Revisions[commit].Created.Time),
+			ReviewRef:   change.Revisions[commit].Ref,
+			TargetRef:   "refs/heads/" + change.Branch,
+			Requester:   i.email(change.Owner),
+			Reviewers:   reviewers,
+			Description: strings.TrimSpace(change.Revisions[commit].Commit.Message),
+		}
+		if r.Description == "" {
+			r.Description = change.Subject
+		}
+		if len(requests) > 0 {
+			r.Alias = commit
+		} else {
+			r.Timestamp = mirror.Timestamp(change.Created.Time)
+		}
+		r.UpdateMentions()
+		requests = append(requests, r)
+	}
+	if len(requests) == 0 {
+		return nil
+	}
+	latest := requests[len(requests)-1]
+	switch change.Status {
+	case "MERGED":
+		latest.Timestamp = mirror.Timestamp(change.Updated.Time)
+		if change.Submitted != nil {
+			latest.Timestamp = mirror.Timestamp(change.Submitted.Time)
+		}
+		latest.SubmittedAs = change.CurrentRevision
+		requests = append(requests, latest)
+	case "ABANDONED":
+		latest.Timestamp = mirror.Timestamp(change.Updated.Time)
+		latest.Abandoned = true
+		requests = append(requests, latest)
+	}
+	return requests
+}
+
+// uploadedPattern matches the messages that Gerrit adds for each new patch set.
+var uploadedPattern = regexp.MustCompile(`^Uploaded patch set \d+\.?$`)
+
+// convertInline returns the comment for an inline comment.
+func (i *Importer) convertInline(ic inlineComment, commits map[int]string) comment.Comment {
+	c := mirror.NewComment(mirror.Timestamp(ic.Updated.Time), i.email(ic.Author), ic.Message)
+	c.Location = &comment.Location{Commit: commits[ic.PatchSet]}
+	switch ic.path {
+	case patchSetLevelPath:
+		return c
+	case commitMessagePath:
+		c.Location.CommitMessage = true
+	default:
+		c.Location.Path = ic.path
+	}
+	// Comments on the parent side are on lines of the base, rather than of the patch set.
+	if ic.Side == "PARENT" {
+		return c
+	}
+	if ic.Range != nil && ic.Range.EndLine > ic.Range.StartLine {
+		c.Location.Range = &comment.Range{StartLine: ic.Range.StartLine, EndLine: ic.Range.EndLine}
+	} else if ic.Line > 0 {
+		c.Location.Range = &comment.Range{StartLine: ic.Line}
+	}
+	return c
+}
+
+// Import adds the notes for a change, its patch sets, messages, inline
+// comments, and Code-Review votes to the batch, and returns the revision that
+// the review is attached to.
+func (i *Importer) Import(change Change, batch *mirror.Batch) (string, error) {
+	commits := patchSets(change)
+	revision, ok := commits[1]
+	if !ok {
+		return "", fmt.Errorf("The change %d has no first patch set.", change.Number)
+	}
+	for _, r := range i.convertRequest(change, commits) {
+		if err := batch.AddRequest(revision, r); err != nil {
+			return "", err
+		}
+	}
+
+	for _, m := range change.Messages {
+		if m.Author == nil || uploadedPattern.MatchString(strings.TrimSpace(m.Message)) {
+			continue
+		}
+		c := mirror.NewComment(mirror.Timestamp(m.Date.Time), i.email(*m.Author), m.Message)
+		c.Location = &comment.Location{Commit: commits[m.RevisionNumber]}
+		if _, err := batch.AddComment(revision, c); err != nil {
+			return "", err
+		}
+	}
+
+	var byPath map[string][]inlineComment
+	if _, err := i.client.Get(fmt.Sprintf("/changes/%s~%d/comments", url.PathEscape(i.project), change.Number), &byPath); err != nil {
+		return "", err
+	}
+	var inline []inlineComment
+	for path, comments := range byPath {
+		for _, ic := range comments {
+			ic.path = path
+			inline = append(inline, ic)
+		}
+	}
+	// Replies are always newer than what they reply to, so this adds parents first.
+	sort.SliceStable(inline, func(a, b int) bool {
+		if !inline[a].Updated.Equal(inline[b].Updated.Time) {
+			return inline[a].Updated.Before(inline[b].Updated.Time)
+		}
+		return inline[a].ID < inline[b].ID
+	})
+	hashes := make(map[string]string)
+	for _, ic := range inline {
+		c := i.convertInline(ic, commits)
+		if ic.InReplyTo != "" {
+			c.Parent = hashes[ic.InReplyTo]
+			if ic.Unresolved != nil && !*ic.Unresolved {
+				resolved := true
+				c.Resolved = &resolved
+			}
+		}
+		hash, err := batch.AddComment(revision, c)
+		if err != nil {
+			return "", err
+		}
+		hashes[ic.ID] = hash
+	}
+
+	for _, vote := range change.Labels[codeReview].All {
+		if vote.Value == 0 || vote.Date == nil {
+			continue
+		}
+		resolved := vote.Value > 0
+		c := mirror.NewComment(mirror.Timestamp(vote.Date.Time), i.email(vote.account), fmt.Sprintf("%s%+d", codeReview, vote.Value))
+		c.Location = &comment.Location{Commit: revisionAt(change, commits, vote.Date.Time)}
+		c.Resolved = &resolved
+		if _, err := batch.AddComment(revision, c); err != nil {
+			return "", err
+		}
+	}
+	return revision, nil
+}
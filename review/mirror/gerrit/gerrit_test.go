@@ -0,0 +1,135 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gerrit
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/git-appraise/review/comment"
+)
+
+func TestTimeUnmarshal(t *testing.T) {
+	var parsed Time
+	if err := json.Unmarshal([]byte(`"2013-02-01 09:59:32.126000000"`), &parsed); err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2013, 2, 1, 9, 59, 32, 126000000, time.UTC); !parsed.Equal(want) {
+		t.Errorf("Parsed %v, want %v", parsed, want)
+	}
+	if err := json.Unmarshal([]byte(`"yesterday"`), &parsed); err == nil {
+		t.Error("Expected an error for an invalid timestamp")
+	}
+}
+
+func TestProjectFromURL(t *testing.T) {
+	tests := []struct {
+		serverURL string
+		remoteURL string
+		want      string
+	}{
+		{"https://review.example.com", "https://review.example.com/tools/appraise", "tools/appraise"},
+		{"https://review.example.com", "https://review.example.com/a/appraise.git", "appraise"},
+		{"https://review.example.com", "ssh://alice@review.example.com:29418/appraise", "appraise"},
+		{"https://review.example.com", "https://github.com/google/git-appraise", ""},
+	}
+	for _, test := range tests {
+		if got := ProjectFromURL(test.serverURL, test.remoteURL); got != test.want {
+			t.Errorf("ProjectFromURL(%q, %q) = %q, want %q", test.serverURL, test.remoteURL, got, test.want)
+		}
+	}
+}
+
+func testChange() Change {
+	at := func(day int) Time {
+		return Time{time.Date(2020, 1, day, 0, 0, 0, 0, time.UTC)}
+	}
+	submitted := at(6)
+	return Change{
+		Number:          1,
+		Branch:          "master",
+		Subject:         "Add b",
+		Status:          "MERGED",
+		Created:         at(1),
+		Updated:         at(7),
+		Submitted:       &submitted,
+		Owner:           account{AccountID: 1, Email: "alice@example.com"},
+		CurrentRevision: "ps2",
+		Revisions: map[string]revision{
+			"ps1": {Number: 1, Created: at(1), Ref: "refs/changes/01/1/1", Commit: commitInfo{Message: "Add b\n"}},
+			"ps2": {Number: 2, Created: at(3), Ref: "refs/changes/01/1/2", Commit: commitInfo{Message: "Add b, amended\n"}},
+		},
+		Reviewers: map[string][]account{"REVIEWER": {{AccountID: 1}, {AccountID: 2, Username: "bob"}}},
+	}
+}
+
+func TestConvertRequest(t *testing.T) {
+	i := New("https://review.example.com", "", "", "appraise", "origin")
+	change := testChange()
+	requests := i.convertRequest(change, patchSets(change))
+	if len(requests) != 3 {
+		t.Fatalf("Unexpected requests: %+v", requests)
+	}
+	first, second, merged := requests[0], requests[1], requests[2]
+	if first.Timestamp != "1577836800" || first.ReviewRef != "refs/changes/01/1/1" || first.Alias != "" ||
+		first.Requester != "alice@example.com" || first.Description != "Add b" {
+		t.Errorf("Unexpected first request: %+v", first)
+	}
+	if !reflect.DeepEqual(first.Reviewers, []string{"bob@users.noreply.review.example.com"}) {
+		t.Errorf("Unexpected reviewers: %v", first.Reviewers)
+	}
+	if second.ReviewRef != "refs/changes/01/1/2" || second.Alias != "ps2" || second.Description != "Add b, amended" {
+		t.Errorf("Unexpected request for the second patch set: %+v", second)
+	}
+	if merged.SubmittedAs != "ps2" || merged.Timestamp != "1578268800" || merged.Alias != "ps2" {
+		t.Errorf("Unexpected request for the merge: %+v", merged)
+	}
+}
+
+func TestRevisionAt(t *testing.T) {
+	change := testChange()
+	commits := patchSets(change)
+	tests := map[int]string{1: "ps1", 2: "ps1", 3: "ps2", 5: "ps2"}
+	for day, want := range tests {
+		if got := revisionAt(change, commits, time.Date(2020, 1, day, 0, 0, 0, 0, time.UTC)); got != want {
+			t.Errorf("revisionAt(day %d) = %q, want %q", day, got, want)
+		}
+	}
+}
+
+func TestConvertInline(t *testing.T) {
+	i := New("https://review.example.com", "", "", "appraise", "origin")
+	commits := map[int]string{1: "ps1", 2: "ps2"}
+	tests := []struct {
+		ic   inlineComment
+		want *comment.Location
+	}{
+		{inlineComment{path: "a.go", PatchSet: 2, Line: 3}, &comment.Location{Commit: "ps2", Path: "a.go", Range: &comment.Range{StartLine: 3}}},
+		{inlineComment{path: "a.go", PatchSet: 1, Line: 5, Range: &commentRange{StartLine: 3, EndLine: 5}},
+			&comment.Location{Commit: "ps1", Path: "a.go", Range: &comment.Range{StartLine: 3, EndLine: 5}}},
+		{inlineComment{path: "a.go", PatchSet: 1, Line: 3, Side: "PARENT"}, &comment.Location{Commit: "ps1", Path: "a.go"}},
+		{inlineComment{path: commitMessagePath, PatchSet: 1, Line: 1}, &comment.Location{Commit: "ps1", CommitMessage: true, Range: &comment.Range{StartLine: 1}}},
+		{inlineComment{path: patchSetLevelPath, PatchSet: 2}, &comment.Location{Commit: "ps2"}},
+	}
+	for _, test := range tests {
+		if got := i.convertInline(test.ic, commits).Location; !reflect.DeepEqual(got, test.want) {
+			t.Errorf("convertInline(%+v) at %+v, want %+v", test.ic, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,425 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package github mirrors GitHub pull requests into git-appraise reviews, and
+// exports git-appraise comments and votes back to the pull requests.
+package github
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/git-appraise/repository"
+	"github.com/google/git-appraise/review"
+	"github.com/google/git-appraise/review/ci"
+	"github.com/google/git-appraise/review/comment"
+	"github.com/google/git-appraise/review/mirror"
+	"github.com/google/git-appraise/review/request"
+)
+
+const (
+	// DefaultURL is the URL of the API of github.com.
+	DefaultURL = "https://api.github.com"
+
+	// emailDomain is the domain of the email addresses given to GitHub users.
+	emailDomain = "users.noreply.github.com"
+
+	// agent identifies the CI reports mirrored from commit statuses.
+	agent = "github"
+)
+
+type user struct {
+	Login string `json:"login"`
+}
+
+type branch struct {
+	Ref string `json:"ref"`
+	SHA string `json:"sha"`
+}
+
+// PullRequest is the part of a GitHub pull request that is mirrored.
+type PullRequest struct {
+	Number             int        `json:"number"`
+	Title              string     `json:"title"`
+	Body               string     `json:"body"`
+	User               user       `json:"user"`
+	State              string     `json:"state"`
+	CreatedAt          time.Time  `json:"created_at"`
+	ClosedAt           *time.Time `json:"closed_at"`
+	MergedAt           *time.Time `json:"merged_at"`
+	MergeCommitSHA     string     `json:"merge_commit_sha"`
+	Head               branch     `json:"head"`
+	Base               branch     `json:"base"`
+	RequestedReviewers []user     `json:"requested_reviewers"`
+}
+
+type commit struct {
+	SHA string `json:"sha"`
+}
+
+type reviewComment struct {
+	ID                int64     `json:"id"`
+	InReplyToID       int64     `json:"in_reply_to_id"`
+	User              user      `json:"user"`
+	Body              string    `json:"body"`
+	Path              string    `json:"path"`
+	OriginalCommitID  string    `json:"original_commit_id"`
+	OriginalLine      uint32    `json:"original_line"`
+	OriginalStartLine uint32    `json:"original_start_line"`
+	CreatedAt         time.Time `json:"created_at"`
+}
+
+type issueComment struct {
+	ID        int64     `json:"id"`
+	User      user      `json:"user"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type pullReview struct {
+	ID          int64     `json:"id"`
+	User        user      `json:"user"`
+	Body        string    `json:"body"`
+	State       string    `json:"state"`
+	CommitID    string    `json:"commit_id"`
+	SubmittedAt time.Time `json:"submitted_at"`
+}
+
+type commitStatus struct {
+	Context   string    `json:"context"`
+	State     string    `json:"state"`
+	TargetURL string    `json:"target_url"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type combinedStatus struct {
+	Statuses []commitStatus `json:"statuses"`
+}
+
+// Mirror mirrors the pull requests of a single GitHub repository.
+type Mirror struct {
+	client *mirror.Client
+	// repo is the repository, as "owner/name".
+	repo string
+	// remote is the git remote that the pull requests' commits are fetched from.
+	remote string
+}
+
+// New returns a mirror of the given repository ("owner/name"), using the API
+// at the given URL with the given token (if any), which fetches commits from
+// the given git remote.
+func New(url, token, repo, remote string) *Mirror {
+	client := mirror.NewClient(url)
+	client.Header.Set("Accept", "application/vnd.github+json")
+	if token != "" {
+		client.Header.Set("Authorization", "Bearer "+token)
+	}
+	return &Mirror{client: client, repo: repo, remote: remote}
+}
+
+// remoteURLPattern matches the URLs of GitHub repositories, in either the HTTPS or the SSH form.
+var remoteURLPattern = regexp.MustCompile(`github\.com[:/]([^/]+/[^/]+?)(?:\.git)?/?$`)
+
+// RepoFromURL returns the "owner/name" of the GitHub repository at the given URL, if it is one.
+func RepoFromURL(url string) string {
+	if match := remoteURLPattern.FindStringSubmatch(url); match != nil {
+		return match[1]
+	}
+	return ""
+}
+
+// ReviewRef returns the ref that the head of a pull request is fetched into.
+func ReviewRef(number int) string {
+	return fmt.Sprintf("refs/pull/%d/head", number)
+}
+
+// ListPullRequests returns all of the repository's pull requests, open or closed.
+func (m *Mirror) ListPullRequests() ([]PullRequest, error) {
+	var prs []PullRequest
+	err := m.client.GetAll(fmt.Sprintf("/repos/%s/pulls?state=all&per_page=100", m.repo), &prs)
+	return prs, err
+}
+
+// GetPullRequest returns the pull request with the given number.
+func (m *Mirror) GetPullRequest(number int) (PullRequest, error) {
+	var pr PullRequest
+	_, err := m.client.Get(fmt.Sprintf("/repos/%s/pulls/%d", m.repo, number), &pr)
+	return pr, err
+}
+
+// FetchHeads fetches the heads of all of the pull requests, so that their commits can be annotated.
+func (m *Mirror) FetchHeads() error {
+	if err := repository.FetchRefs(m.remote, "+refs/pull/*/head:refs/pull/*/head"); err != nil {
+		return fmt.Errorf("Failed to fetch the pull requests from %q: %v", m.remote, err)
+	}
+	return nil
+}
+
+// Imported describes the comments that a pull request has on GitHub.
+type Imported struct {
+	// Revision is the first commit of the pull request, which its review is attached to.
+	Revision string
+	// OnGitHub holds the hashes of the review's comments that are also on GitHub,
+	// whether they were imported from there or exported to there.
+	OnGitHub map[string]bool
+	// reviewComments maps the hashes of comments on lines to their IDs on GitHub, for posting replies.
+	reviewComments map[string]int64
+}
+
+// convertRequest returns the versions of the review request for a pull request:
+// the request as it was opened, and, if the pull request has been merged or
+// closed, the request as of then.
+func convertRequest(pr PullRequest) []request.Request {
+	description := strings.TrimSpace(pr.Title + "\n\n" + pr.Body)
+	var reviewers []string
+	for _, reviewer := range pr.RequestedReviewers {
+		reviewers = append(reviewers, reviewer.Login)
+	}
+	opened := request.Request{
+		Timestamp:   mirror.Timestamp(pr.CreatedAt),
+		ReviewRef:   ReviewRef(pr.Number),
+		TargetRef:   "refs/heads/" + pr.Base.Ref,
+		Requester:   mirror.Email(pr.User.Login, emailDomain),
+		Reviewers:   mirror.Emails(reviewers, emailDomain),
+		Description: description,
+	}
+	opened.UpdateMentions()
+	requests := []request.Request{opened}
+	switch {
+	case pr.MergedAt != nil:
+		merged := opened
+		merged.Timestamp = mirror.Timestamp(*pr.MergedAt)
+		merged.SubmittedAs = pr.MergeCommitSHA
+		requests = append(requests, merged)
+	case pr.ClosedAt != nil:
+		closed := opened
+		closed.Timestamp = mirror.Timestamp(*pr.ClosedAt)
+		closed.Abandoned = true
+		requests = append(requests, closed)
+	}
+	return requests
+}
+
+// convertStatus returns the CI report for a commit status, or false if the status is still pending.
+func convertStatus(status commitStatus) (ci.Report, bool) {
+	report := ci.Report{
+		Timestamp: mirror.Timestamp(status.UpdatedAt),
+		URL:       status.TargetURL,
+		Agent:     agent,
+		Name:      status.Context,
+	}
+	switch status.State {
+	case "success":
+		report.Status = ci.StatusSuccess
+	case "failure", "error":
+		report.Status = ci.StatusFailure
+	default:
+		return report, false
+	}
+	return report, true
+}
+
+// Import adds the notes mirroring a pull request, its comments, reviews, and
+// the statuses of its head commit to the batch.
+func (m *Mirror) Import(pr PullRequest, batch *mirror.Batch) (*Imported, error) {
+	var commits []commit
+	if _, err := m.client.Get(fmt.Sprintf("/repos/%s/pulls/%d/commits?per_page=1", m.repo, pr.Number), &commits); err != nil {
+		return nil, err
+	}
+	if len(commits) == 0 {
+		return nil, fmt.Errorf("The pull request #%d has no commits.", pr.Number)
+	}
+	imported := &Imported{
+		Revision:       commits[0].SHA,
+		OnGitHub:       make(map[string]bool),
+		reviewComments: make(map[string]int64),
+	}
+	for _, r := range convertRequest(pr) {
+		if err := batch.AddRequest(imported.Revision, r); err != nil {
+			return nil, err
+		}
+	}
+
+	var reviewComments []reviewComment
+	if err := m.client.GetAll(fmt.Sprintf("/repos/%s/pulls/%d/comments?per_page=100", m.repo, pr.Number), &reviewComments); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(reviewComments, func(i, j int) bool { return reviewComments[i].ID < reviewComments[j].ID })
+	hashes := make(map[int64]string)
+	for _, rc := range reviewComments {
+		hash, body := mirror.ParseMarker(rc.Body)
+		if hash == "" {
+			c := mirror.NewComment(mirror.Timestamp(rc.CreatedAt), mirror.Email(rc.User.Login, emailDomain), body)
+			c.Location = &comment.Location{Commit: rc.OriginalCommitID, Path: rc.Path}
+			if rc.OriginalLine > 0 {
+				c.Location.Range = &comment.Range{StartLine: rc.OriginalLine}
+				if rc.OriginalStartLine > 0 && rc.OriginalStartLine < rc.OriginalLine {
+					c.Location.Range = &comment.Range{StartLine: rc.OriginalStartLine, EndLine: rc.OriginalLine}
+				}
+			}
+			if rc.InReplyToID != 0 {
+				c.Parent = hashes[rc.InReplyToID]
+			}
+			var err error
+			if hash, err = batch.AddComment(imported.Revision, c); err != nil {
+				return nil, err
+			}
+		}
+		hashes[rc.ID] = hash
+		imported.OnGitHub[hash] = true
+		imported.reviewComments[hash] = rc.ID
+	}
+
+	var issueComments []issueComment
+	if err := m.client.GetAll(fmt.Sprintf("/repos/%s/issues/%d/comments?per_page=100", m.repo, pr.Number), &issueComments); err != nil {
+		return nil, err
+	}
+	for _, ic := range issueComments {
+		hash, body := mirror.ParseMarker(ic.Body)
+		if hash == "" {
+			c := mirror.NewComment(mirror.Timestamp(ic.CreatedAt), mirror.Email(ic.User.Login, emailDomain), body)
+			var err error
+			if hash, err = batch.AddComment(imported.Revision, c); err != nil {
+				return nil, err
+			}
+		}
+		imported.OnGitHub[hash] = true
+	}
+
+	var reviews []pullReview
+	if err := m.client.GetAll(fmt.Sprintf("/repos/%s/pulls/%d/reviews?per_page=100", m.repo, pr.Number), &reviews); err != nil {
+		return nil, err
+	}
+	for _, pr := range reviews {
+		hash, body := mirror.ParseMarker(pr.Body)
+		if hash == "" {
+			c := mirror.NewComment(mirror.Timestamp(pr.SubmittedAt), mirror.Email(pr.User.Login, emailDomain), body)
+			c.Location = &comment.Location{Commit: pr.CommitID}
+			switch pr.State {
+			case "APPROVED", "CHANGES_REQUESTED":
+				resolved := pr.State == "APPROVED"
+				c.Resolved = &resolved
+			case "COMMENTED":
+				// The review's line comments are mirrored on their own, so
+				// only its summary, if it has one, is a comment.
+				if body == "" {
+					continue
+				}
+			default:
+				continue
+			}
+			var err error
+			if hash, err = batch.AddComment(imported.Revision, c); err != nil {
+				return nil, err
+			}
+		}
+		imported.OnGitHub[hash] = true
+	}
+
+	var status combinedStatus
+	if _, err := m.client.Get(fmt.Sprintf("/repos/%s/commits/%s/status", m.repo, pr.Head.SHA), &status); err != nil {
+		return nil, err
+	}
+	for _, s := range status.Statuses {
+		if report, ok := convertStatus(s); ok {
+			if err := batch.AddReport(pr.Head.SHA, report); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return imported, nil
+}
+
+// Export posts the comments and votes of the current user on the review of a
+// pull request that are not on GitHub yet, and returns how many were posted.
+//
+// Comments on lines are posted as review comments, votes as reviews that
+// approve or request changes, and the other comments as comments on the pull
+// request. Comments on lines that GitHub rejects, such as lines outside of the
+// pull request's diff, are posted as comments on the pull request instead.
+func (m *Mirror) Export(pr PullRequest, imported *Imported) (int, error) {
+	r := review.Get(imported.Revision)
+	if r == nil {
+		return 0, fmt.Errorf("There is no review for the pull request #%d.", pr.Number)
+	}
+	me := repository.GetUserEmail()
+	var posted int
+	var export func(threads []review.CommentThread, parent string) error
+	export = func(threads []review.CommentThread, parent string) error {
+		for _, thread := range threads {
+			c := thread.Comment
+			if !imported.OnGitHub[thread.Hash] && strings.EqualFold(c.Author, me) && !c.Retracted {
+				if text := mirror.ExportText(c); text != "" {
+					id, err := m.post(pr, thread, parent, imported, mirror.AddMarker(text, thread.Hash))
+					if err != nil {
+						return err
+					}
+					imported.OnGitHub[thread.Hash] = true
+					if id != 0 {
+						imported.reviewComments[thread.Hash] = id
+					}
+					posted++
+				}
+			}
+			if err := export(thread.Children, thread.Hash); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	err := export(r.Comments, "")
+	return posted, err
+}
+
+// post posts a single comment, and returns its ID if it is a review comment on a line.
+func (m *Mirror) post(pr PullRequest, thread review.CommentThread, parent string, imported *Imported, body string) (int64, error) {
+	c := thread.Comment
+	var created struct {
+		ID int64 `json:"id"`
+	}
+	if parentID, ok := imported.reviewComments[parent]; ok && parent != "" {
+		path := fmt.Sprintf("/repos/%s/pulls/%d/comments/%d/replies", m.repo, pr.Number, parentID)
+		_, err := m.client.Do("POST", path, map[string]interface{}{"body": body}, &created)
+		return created.ID, err
+	}
+	if parent == "" && c.Resolved != nil && c.Location.IsWholeCommit() {
+		event := "REQUEST_CHANGES"
+		if *c.Resolved {
+			event = "APPROVE"
+		}
+		path := fmt.Sprintf("/repos/%s/pulls/%d/reviews", m.repo, pr.Number)
+		_, err := m.client.Do("POST", path, map[string]interface{}{"commit_id": pr.Head.SHA, "body": body, "event": event}, nil)
+		return 0, err
+	}
+	if parent == "" && c.Location != nil && c.Location.Path != "" && c.Location.Range != nil {
+		line := c.Location.Range.StartLine
+		fields := map[string]interface{}{"body": body, "commit_id": c.Location.Commit, "path": c.Location.Path, "side": "RIGHT"}
+		if end := c.Location.Range.EndLine; end > line {
+			fields["start_line"], line = line, end
+		}
+		fields["line"] = line
+		path := fmt.Sprintf("/repos/%s/pulls/%d/comments", m.repo, pr.Number)
+		if _, err := m.client.Do("POST", path, fields, &created); err == nil {
+			return created.ID, nil
+		}
+	}
+	path := fmt.Sprintf("/repos/%s/issues/%d/comments", m.repo, pr.Number)
+	_, err := m.client.Do("POST", path, map[string]interface{}{"body": body}, nil)
+	return 0, err
+}
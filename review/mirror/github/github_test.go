@@ -0,0 +1,114 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package github
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/git-appraise/review/ci"
+	"github.com/google/git-appraise/review/mirror"
+)
+
+func TestMarkerRoundTrip(t *testing.T) {
+	hash := "0123456789abcdef0123456789abcdef01234567"
+	marked := mirror.AddMarker("Looks good.\n", hash)
+	gotHash, gotText := mirror.ParseMarker(marked)
+	if gotHash != hash || gotText != "Looks good." {
+		t.Errorf("ParseMarker(%q) = %q, %q", marked, gotHash, gotText)
+	}
+	if gotHash, gotText := mirror.ParseMarker("Plain text"); gotHash != "" || gotText != "Plain text" {
+		t.Errorf("ParseMarker of unmarked text = %q, %q", gotHash, gotText)
+	}
+}
+
+func TestRepoFromURL(t *testing.T) {
+	tests := map[string]string{
+		"https://github.com/google/git-appraise.git": "google/git-appraise",
+		"https://github.com/google/git-appraise":     "google/git-appraise",
+		"git@github.com:google/git-appraise.git":     "google/git-appraise",
+		"https://gitlab.com/google/git-appraise.git": "",
+		"": "",
+	}
+	for url, want := range tests {
+		if got := RepoFromURL(url); got != want {
+			t.Errorf("RepoFromURL(%q) = %q, want %q", url, got, want)
+		}
+	}
+}
+
+func TestConvertRequest(t *testing.T) {
+	created := time.Unix(1000, 0)
+	merged := time.Unix(2000, 0)
+	pr := PullRequest{
+		Number:             7,
+		Title:              "Fix the frobnicator",
+		Body:               "cc @carol",
+		User:               user{Login: "alice"},
+		CreatedAt:          created,
+		Base:               branch{Ref: "master"},
+		RequestedReviewers: []user{{Login: "bob"}},
+	}
+	requests := convertRequest(pr)
+	if len(requests) != 1 {
+		t.Fatalf("Unexpected requests for an open pull request: %v", requests)
+	}
+	opened := requests[0]
+	if opened.Timestamp != "1000" || opened.ReviewRef != "refs/pull/7/head" || opened.TargetRef != "refs/heads/master" ||
+		opened.Requester != "alice@users.noreply.github.com" || opened.Description != "Fix the frobnicator\n\ncc @carol" {
+		t.Errorf("Unexpected request: %+v", opened)
+	}
+	if len(opened.Reviewers) != 1 || opened.Reviewers[0] != "bob@users.noreply.github.com" {
+		t.Errorf("Unexpected reviewers: %v", opened.Reviewers)
+	}
+	if len(opened.Mentions) != 1 || opened.Mentions[0] != "carol" {
+		t.Errorf("Unexpected mentions: %v", opened.Mentions)
+	}
+
+	pr.MergedAt = &merged
+	pr.ClosedAt = &merged
+	pr.MergeCommitSHA = "abc"
+	requests = convertRequest(pr)
+	if len(requests) != 2 || requests[1].Timestamp != "2000" || requests[1].SubmittedAs != "abc" || requests[1].Abandoned {
+		t.Errorf("Unexpected requests for a merged pull request: %+v", requests)
+	}
+
+	pr.MergedAt = nil
+	requests = convertRequest(pr)
+	if len(requests) != 2 || !requests[1].Abandoned || requests[1].SubmittedAs != "" {
+		t.Errorf("Unexpected requests for a closed pull request: %+v", requests)
+	}
+}
+
+func TestConvertStatus(t *testing.T) {
+	tests := []struct {
+		state      string
+		wantStatus string
+		wantOK     bool
+	}{
+		{"success", ci.StatusSuccess, true},
+		{"failure", ci.StatusFailure, true},
+		{"error", ci.StatusFailure, true},
+		{"pending", "", false},
+	}
+	for _, test := range tests {
+		report, ok := convertStatus(commitStatus{Context: "ci/build", State: test.state, TargetURL: "https://ci.example.com/1"})
+		if ok != test.wantOK || (ok && (report.Status != test.wantStatus || report.Name != "ci/build" || report.Agent != agent)) {
+			t.Errorf("convertStatus(%q) = %+v, %v", test.state, report, ok)
+		}
+	}
+}
@@ -0,0 +1,445 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gitlab synchronizes GitLab merge requests with git-appraise reviews,
+// importing their discussions and approvals, and exporting git-appraise
+// comments and votes back to them.
+package gitlab
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/git-appraise/repository"
+	"github.com/google/git-appraise/review"
+	"github.com/google/git-appraise/review/comment"
+	"github.com/google/git-appraise/review/mirror"
+	"github.com/google/git-appraise/review/request"
+)
+
+// DefaultURL is the URL of gitlab.com.
+const DefaultURL = "https://gitlab.com"
+
+// approvedNote is the body of the system notes recording approvals.
+const approvedNote = "approved this merge request"
+
+type user struct {
+	Username string `json:"username"`
+}
+
+type diffRefs struct {
+	BaseSHA  string `json:"base_sha"`
+	HeadSHA  string `json:"head_sha"`
+	StartSHA string `json:"start_sha"`
+}
+
+// MergeRequest is the part of a GitLab merge request that is mirrored.
+type MergeRequest struct {
+	IID             int        `json:"iid"`
+	Title           string     `json:"title"`
+	Description     string     `json:"description"`
+	Author          user       `json:"author"`
+	State           string     `json:"state"`
+	CreatedAt       time.Time  `json:"created_at"`
+	MergedAt        *time.Time `json:"merged_at"`
+	ClosedAt        *time.Time `json:"closed_at"`
+	TargetBranch    string     `json:"target_branch"`
+	SHA             string     `json:"sha"`
+	MergeCommitSHA  string     `json:"merge_commit_sha"`
+	SquashCommitSHA string     `json:"squash_commit_sha"`
+	Reviewers       []user     `json:"reviewers"`
+	DiffRefs        diffRefs   `json:"diff_refs"`
+}
+
+type commit struct {
+	ID string `json:"id"`
+}
+
+type linePosition struct {
+	NewLine uint32 `json:"new_line"`
+}
+
+type position struct {
+	HeadSHA   string `json:"head_sha"`
+	NewPath   string `json:"new_path"`
+	OldPath   string `json:"old_path"`
+	NewLine   uint32 `json:"new_line"`
+	LineRange *struct {
+		Start linePosition `json:"start"`
+		End   linePosition `json:"end"`
+	} `json:"line_range"`
+}
+
+type note struct {
+	ID         int64      `json:"id"`
+	Body       string     `json:"body"`
+	Author     user       `json:"author"`
+	CreatedAt  time.Time  `json:"created_at"`
+	System     bool       `json:"system"`
+	Position   *position  `json:"position"`
+	Resolvable bool       `json:"resolvable"`
+	Resolved   bool       `json:"resolved"`
+	ResolvedBy *user      `json:"resolved_by"`
+	ResolvedAt *time.Time `json:"resolved_at"`
+}
+
+type discussion struct {
+	ID    string `json:"id"`
+	Notes []note `json:"notes"`
+}
+
+type approvals struct {
+	ApprovedBy []struct {
+		User user `json:"user"`
+	} `json:"approved_by"`
+}
+
+// Mirror synchronizes the merge requests of a single GitLab project.
+type Mirror struct {
+	client *mirror.Client
+	// project is the path of the project, e.g. "group/name".
+	project string
+	// domain is the domain of the email addresses given to GitLab users.
+	domain string
+	// remote is the git remote that the merge requests' commits are fetched from.
+	remote string
+}
+
+// New returns a mirror of the given project on the GitLab instance at the
+// given URL, using the given token (if any), which fetches commits from the
+// given git remote.
+func New(instanceURL, token, project, remote string) *Mirror {
+	client := mirror.NewClient(strings.TrimSuffix(instanceURL, "/") + "/api/v4")
+	if token != "" {
+		client.Header.Set("PRIVATE-TOKEN", token)
+	}
+	domain := "users.noreply.gitlab.com"
+	if u, err := url.Parse(instanceURL); err == nil && u.Hostname() != "" && u.Hostname() != "gitlab.com" {
+		domain = "users.noreply." + u.Hostname()
+	}
+	return &Mirror{client: client, project: project, domain: domain, remote: remote}
+}
+
+// ProjectFromURL returns the path of the project on the GitLab instance at the
+// given URL that the git remote URL points to, if it does point to one.
+func ProjectFromURL(instanceURL, remoteURL string) string {
+	u, err := url.Parse(instanceURL)
+	if err != nil || u.Hostname() == "" {
+		return ""
+	}
+	pattern := regexp.MustCompile(regexp.QuoteMeta(u.Hostname()) + `(?::\d+)?[:/](.+?/[^/]+?)(?:\.git)?/?$`)
+	if match := pattern.FindStringSubmatch(remoteURL); match != nil {
+		return strings.TrimPrefix(match[1], "/")
+	}
+	return ""
+}
+
+// ReviewRef returns the ref that the head of a merge request is fetched into.
+func ReviewRef(iid int) string {
+	return fmt.Sprintf("refs/merge-requests/%d/head", iid)
+}
+
+// path returns the API path of a resource of the project.
+func (m *Mirror) path(format string, args ...interface{}) string {
+	return "/projects/" + url.PathEscape(m.project) + fmt.Sprintf(format, args...)
+}
+
+// ListMergeRequests returns all of the project's merge requests, open or closed.
+func (m *Mirror) ListMergeRequests() ([]MergeRequest, error) {
+	var mrs []MergeRequest
+	err := m.client.GetAll(m.path("/merge_requests?state=all&per_page=100"), &mrs)
+	return mrs, err
+}
+
+// GetMergeRequest returns the merge request with the given IID.
+func (m *Mirror) GetMergeRequest(iid int) (MergeRequest, error) {
+	var mr MergeRequest
+	_, err := m.client.Get(m.path("/merge_requests/%d", iid), &mr)
+	return mr, err
+}
+
+// FetchHeads fetches the heads of all of the merge requests, so that their commits can be annotated.
+func (m *Mirror) FetchHeads() error {
+	if err := repository.FetchRefs(m.remote, "+refs/merge-requests/*/head:refs/merge-requests/*/head"); err != nil {
+		return fmt.Errorf("Failed to fetch the merge requests from %q: %v", m.remote, err)
+	}
+	return nil
+}
+
+// Imported describes the comments that a merge request has on GitLab.
+type Imported struct {
+	// Revision is the first commit of the merge request, which its review is attached to.
+	Revision string
+	// OnGitLab holds the hashes of the review's comments that are also on GitLab,
+	// whether they were imported from there or exported to there.
+	OnGitLab map[string]bool
+	// discussions maps the hashes of the comments that start discussions to
+	// the discussions' IDs, for posting replies.
+	discussions map[string]string
+}
+
+// convertRequest returns the versions of the review request for a merge request:
+// the request as it was opened, and, if the merge request has been merged or
+// closed, the request as of then.
+func (m *Mirror) convertRequest(mr MergeRequest) []request.Request {
+	var reviewers []string
+	for _, reviewer := range mr.Reviewers {
+		reviewers = append(reviewers, reviewer.Username)
+	}
+	opened := request.Request{
+		Timestamp:   mirror.Timestamp(mr.CreatedAt),
+		ReviewRef:   ReviewRef(mr.IID),
+		TargetRef:   "refs/heads/" + mr.TargetBranch,
+		Requester:   mirror.Email(mr.Author.Username, m.domain),
+		Reviewers:   mirror.Emails(reviewers, m.domain),
+		Description: strings.TrimSpace(mr.Title + "\n\n" + mr.Description),
+	}
+	opened.UpdateMentions()
+	requests := []request.Request{opened}
+	switch {
+	case mr.MergedAt != nil:
+		merged := opened
+		merged.Timestamp = mirror.Timestamp(*mr.MergedAt)
+		merged.SubmittedAs = mr.MergeCommitSHA
+		if merged.SubmittedAs == "" {
+			merged.SubmittedAs = mr.SquashCommitSHA
+		}
+		requests = append(requests, merged)
+	case mr.ClosedAt != nil:
+		closed := opened
+		closed.Timestamp = mirror.Timestamp(*mr.ClosedAt)
+		closed.Abandoned = true
+		requests = append(requests, closed)
+	}
+	return requests
+}
+
+// convertLocation returns the location of a comment on a diff.
+func convertLocation(p *position) *comment.Location {
+	if p == nil {
+		return nil
+	}
+	location := &comment.Location{Commit: p.HeadSHA, Path: p.NewPath}
+	if location.Path == "" {
+		location.Path = p.OldPath
+	}
+	if p.LineRange != nil && p.LineRange.Start.NewLine > 0 && p.LineRange.End.NewLine > p.LineRange.Start.NewLine {
+		location.Range = &comment.Range{StartLine: p.LineRange.Start.NewLine, EndLine: p.LineRange.End.NewLine}
+	} else if p.NewLine > 0 {
+		location.Range = &comment.Range{StartLine: p.NewLine}
+	}
+	return location
+}
+
+// Import adds the notes mirroring a merge request, its discussions, and its
+// approvals to the batch.
+//
+// Resolving a discussion is mirrored as a reply that resolves the thread, and
+// each current approval as an approving vote as of when it was given.
+// Approvals by users who exported a vote from git-appraise are not imported,
+// since the exported vote already records them.
+func (m *Mirror) Import(mr MergeRequest, batch *mirror.Batch) (*Imported, error) {
+	var commits []commit
+	if err := m.client.GetAll(m.path("/merge_requests/%d/commits?per_page=100", mr.IID), &commits); err != nil {
+		return nil, err
+	}
+	if len(commits) == 0 {
+		return nil, fmt.Errorf("The merge request !%d has no commits.", mr.IID)
+	}
+	// The commits are listed newest first.
+	imported := &Imported{
+		Revision:    commits[len(commits)-1].ID,
+		OnGitLab:    make(map[string]bool),
+		discussions: make(map[string]string),
+	}
+	for _, r := range m.convertRequest(mr) {
+		if err := batch.AddRequest(imported.Revision, r); err != nil {
+			return nil, err
+		}
+	}
+
+	var discussions []discussion
+	if err := m.client.GetAll(m.path("/merge_requests/%d/discussions?per_page=100", mr.IID), &discussions); err != nil {
+		return nil, err
+	}
+	votes := mirror.Votes(imported.Revision)
+	exportedVoters := make(map[string]bool)
+	approved := make(map[string]time.Time)
+	for _, d := range discussions {
+		var root string
+		for i, n := range d.Notes {
+			if n.System {
+				if n.Body == approvedNote && n.CreatedAt.After(approved[n.Author.Username]) {
+					approved[n.Author.Username] = n.CreatedAt
+				}
+				continue
+			}
+			hash, body := mirror.ParseMarker(n.Body)
+			if hash != "" {
+				if votes[hash] {
+					exportedVoters[n.Author.Username] = true
+				}
+			} else {
+				c := mirror.NewComment(mirror.Timestamp(n.CreatedAt), mirror.Email(n.Author.Username, m.domain), body)
+				if i == 0 {
+					c.Location = convertLocation(n.Position)
+				} else {
+					c.Parent = root
+				}
+				var err error
+				if hash, err = batch.AddComment(imported.Revision, c); err != nil {
+					return nil, err
+				}
+			}
+			imported.OnGitLab[hash] = true
+			if i == 0 {
+				root = hash
+				imported.discussions[hash] = d.ID
+			}
+		}
+		if len(d.Notes) == 0 || root == "" {
+			continue
+		}
+		if first := d.Notes[0]; first.Resolvable && first.Resolved && first.ResolvedBy != nil && first.ResolvedAt != nil {
+			resolved := true
+			c := mirror.NewComment(mirror.Timestamp(*first.ResolvedAt), mirror.Email(first.ResolvedBy.Username, m.domain), "")
+			c.Parent = root
+			c.Resolved = &resolved
+			hash, err := batch.AddComment(imported.Revision, c)
+			if err != nil {
+				return nil, err
+			}
+			imported.OnGitLab[hash] = true
+		}
+	}
+
+	var current approvals
+	if _, err := m.client.Get(m.path("/merge_requests/%d/approvals", mr.IID), &current); err != nil {
+		return nil, err
+	}
+	var approvers []string
+	for _, approval := range current.ApprovedBy {
+		username := approval.User.Username
+		if _, ok := approved[username]; ok && !exportedVoters[username] {
+			approvers = append(approvers, username)
+		}
+	}
+	sort.Strings(approvers)
+	for _, username := range approvers {
+		resolved := true
+		c := mirror.NewComment(mirror.Timestamp(approved[username]), mirror.Email(username, m.domain), "")
+		c.Resolved = &resolved
+		hash, err := batch.AddComment(imported.Revision, c)
+		if err != nil {
+			return nil, err
+		}
+		imported.OnGitLab[hash] = true
+	}
+	return imported, nil
+}
+
+// Export posts the comments and votes of the current user on the review of a
+// merge request that are not on GitLab yet, and returns how many were posted.
+//
+// Threads are posted as discussions, on the diff if they are on a line of the
+// merge request's head, and replies as notes in the discussions they reply to.
+// Replies that resolve a thread also resolve its discussion. Votes are posted
+// as notes, and approving votes also approve the merge request, while votes
+// that need more work withdraw your approval.
+func (m *Mirror) Export(mr MergeRequest, imported *Imported) (int, error) {
+	r := review.Get(imported.Revision)
+	if r == nil {
+		return 0, fmt.Errorf("There is no review for the merge request !%d.", mr.IID)
+	}
+	me := repository.GetUserEmail()
+	var posted int
+	var export func(threads []review.CommentThread, parent string) error
+	export = func(threads []review.CommentThread, parent string) error {
+		for _, thread := range threads {
+			c := thread.Comment
+			if !imported.OnGitLab[thread.Hash] && strings.EqualFold(c.Author, me) && !c.Retracted {
+				if text := mirror.ExportText(c); text != "" {
+					if err := m.post(mr, thread, parent, imported, mirror.AddMarker(text, thread.Hash)); err != nil {
+						return err
+					}
+					imported.OnGitLab[thread.Hash] = true
+					posted++
+				}
+			}
+			if err := export(thread.Children, thread.Hash); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	err := export(r.Comments, "")
+	return posted, err
+}
+
+// post posts a single comment.
+func (m *Mirror) post(mr MergeRequest, thread review.CommentThread, parent string, imported *Imported, body string) error {
+	c := thread.Comment
+	if discussionID, ok := imported.discussions[parent]; ok && parent != "" {
+		if _, err := m.client.Do("POST", m.path("/merge_requests/%d/discussions/%s/notes", mr.IID, discussionID), map[string]interface{}{"body": body}, nil); err != nil {
+			return err
+		}
+		if c.Resolved != nil && *c.Resolved {
+			_, err := m.client.Do("PUT", m.path("/merge_requests/%d/discussions/%s?resolved=true", mr.IID, discussionID), nil, nil)
+			return err
+		}
+		return nil
+	}
+	if parent == "" && c.Resolved != nil && c.Location.IsWholeCommit() {
+		if _, err := m.client.Do("POST", m.path("/merge_requests/%d/notes", mr.IID), map[string]interface{}{"body": body}, nil); err != nil {
+			return err
+		}
+		if *c.Resolved {
+			_, err := m.client.Do("POST", m.path("/merge_requests/%d/approve", mr.IID), nil, nil)
+			return err
+		}
+		// Withdrawing an approval fails if there is none, which is fine.
+		m.client.Do("POST", m.path("/merge_requests/%d/unapprove", mr.IID), nil, nil)
+		return nil
+	}
+	var created discussion
+	fields := map[string]interface{}{"body": body}
+	if parent == "" && c.Location != nil && c.Location.Path != "" && c.Location.Range != nil && c.Location.Commit == mr.DiffRefs.HeadSHA {
+		position := map[string]interface{}{
+			"position_type": "text",
+			"base_sha":      mr.DiffRefs.BaseSHA,
+			"start_sha":     mr.DiffRefs.StartSHA,
+			"head_sha":      mr.DiffRefs.HeadSHA,
+			"old_path":      c.Location.Path,
+			"new_path":      c.Location.Path,
+			"new_line":      c.Location.Range.StartLine,
+		}
+		withPosition := map[string]interface{}{"body": body, "position": position}
+		if _, err := m.client.Do("POST", m.path("/merge_requests/%d/discussions", mr.IID), withPosition, &created); err == nil {
+			imported.discussions[thread.Hash] = created.ID
+			return nil
+		}
+		// Lines outside of the diff cannot be commented upon, so fall back to a discussion of the whole merge request.
+	}
+	if _, err := m.client.Do("POST", m.path("/merge_requests/%d/discussions", mr.IID), fields, &created); err != nil {
+		return err
+	}
+	imported.discussions[thread.Hash] = created.ID
+	return nil
+}
@@ -0,0 +1,94 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitlab
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/git-appraise/review/comment"
+)
+
+func TestProjectFromURL(t *testing.T) {
+	tests := []struct {
+		instanceURL string
+		remoteURL   string
+		want        string
+	}{
+		{"https://gitlab.com", "https://gitlab.com/group/name.git", "group/name"},
+		{"https://gitlab.com", "git@gitlab.com:group/sub/name.git", "group/sub/name"},
+		{"https://git.example.com", "ssh://git@git.example.com:2222/group/name", "group/name"},
+		{"https://gitlab.com", "https://github.com/group/name.git", ""},
+		{"https://gitlab.com", "", ""},
+	}
+	for _, test := range tests {
+		if got := ProjectFromURL(test.instanceURL, test.remoteURL); got != test.want {
+			t.Errorf("ProjectFromURL(%q, %q) = %q, want %q", test.instanceURL, test.remoteURL, got, test.want)
+		}
+	}
+}
+
+func TestConvertRequest(t *testing.T) {
+	m := New("https://git.example.com", "", "group/name", "origin")
+	merged := time.Unix(2000, 0)
+	mr := MergeRequest{
+		IID:             3,
+		Title:           "Fix the frobnicator",
+		Author:          user{Username: "alice"},
+		CreatedAt:       time.Unix(1000, 0),
+		MergedAt:        &merged,
+		TargetBranch:    "main",
+		SquashCommitSHA: "abc",
+		Reviewers:       []user{{Username: "bob"}},
+	}
+	requests := m.convertRequest(mr)
+	if len(requests) != 2 {
+		t.Fatalf("Unexpected requests for a merged merge request: %+v", requests)
+	}
+	opened := requests[0]
+	if opened.Timestamp != "1000" || opened.ReviewRef != "refs/merge-requests/3/head" || opened.TargetRef != "refs/heads/main" ||
+		opened.Requester != "alice@users.noreply.git.example.com" || opened.Description != "Fix the frobnicator" {
+		t.Errorf("Unexpected request: %+v", opened)
+	}
+	if !reflect.DeepEqual(opened.Reviewers, []string{"bob@users.noreply.git.example.com"}) {
+		t.Errorf("Unexpected reviewers: %v", opened.Reviewers)
+	}
+	if requests[1].Timestamp != "2000" || requests[1].SubmittedAs != "abc" {
+		t.Errorf("Unexpected merged request: %+v", requests[1])
+	}
+}
+
+func TestConvertLocation(t *testing.T) {
+	if location := convertLocation(nil); location != nil {
+		t.Errorf("Unexpected location for a general note: %+v", location)
+	}
+	p := &position{HeadSHA: "abc", OldPath: "old.go", NewLine: 7}
+	want := &comment.Location{Commit: "abc", Path: "old.go", Range: &comment.Range{StartLine: 7}}
+	if got := convertLocation(p); !reflect.DeepEqual(got, want) {
+		t.Errorf("convertLocation(%+v) = %+v, want %+v", p, got, want)
+	}
+	p.NewPath = "new.go"
+	p.LineRange = &struct {
+		Start linePosition `json:"start"`
+		End   linePosition `json:"end"`
+	}{Start: linePosition{NewLine: 5}, End: linePosition{NewLine: 7}}
+	want = &comment.Location{Commit: "abc", Path: "new.go", Range: &comment.Range{StartLine: 5, EndLine: 7}}
+	if got := convertLocation(p); !reflect.DeepEqual(got, want) {
+		t.Errorf("convertLocation(%+v) = %+v, want %+v", p, got, want)
+	}
+}
@@ -0,0 +1,220 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package mirror holds the parts shared by the bridges that mirror reviews
+// between other code review systems and git-appraise notes.
+//
+// Mirrored notes are built deterministically from the other system's data, and
+// notes that are already present are never appended again, so mirroring the
+// same reviews repeatedly only adds what changed. Comments exported to the other
+// system carry a marker with the hash of the original comment, so that they are
+// recognized, rather than imported a second time, when mirroring back.
+package mirror
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/git-appraise/repository"
+	"github.com/google/git-appraise/review/ci"
+	"github.com/google/git-appraise/review/comment"
+	"github.com/google/git-appraise/review/mention"
+	"github.com/google/git-appraise/review/request"
+)
+
+// Timestamp formats a time in the form used by the timestamps of notes.
+func Timestamp(t time.Time) string {
+	return strconv.FormatInt(t.Unix(), 10)
+}
+
+// Email returns the email address used for a user of another system.
+//
+// Users that are already identified by an email address keep it, and the
+// others are given an address in the given domain.
+func Email(user, domain string) string {
+	if user == "" || strings.Contains(user, "@") {
+		return user
+	}
+	return user + "@" + domain
+}
+
+// Emails returns the email addresses used for several users of another system.
+func Emails(users []string, domain string) []string {
+	var emails []string
+	for _, user := range users {
+		emails = append(emails, Email(user, domain))
+	}
+	return emails
+}
+
+// NewComment returns a mirrored comment, with its mentions filled in.
+func NewComment(timestamp, author, description string) comment.Comment {
+	return comment.Comment{
+		Timestamp:   timestamp,
+		Author:      author,
+		Description: description,
+		Mentions:    mention.Parse(description),
+	}
+}
+
+// ExportText returns the text to post for an exported comment, or an empty
+// string if there is nothing to post. Votes without a message get a stock one.
+func ExportText(c comment.Comment) string {
+	if c.Description != "" {
+		return c.Description
+	}
+	if c.Resolved == nil {
+		return ""
+	}
+	if *c.Resolved {
+		return "LGTM"
+	}
+	return "Needs work"
+}
+
+// Votes returns the hashes of the votes on the review of the given revision.
+//
+// Hosts that record votes without a message cannot carry the marker of an
+// exported vote, so this is used to recognize the users who exported votes.
+func Votes(revision string) map[string]bool {
+	votes := make(map[string]bool)
+	for hash, c := range comment.ParseAllValid(repository.GetNotes(comment.Ref, revision)) {
+		if c.Resolved != nil {
+			votes[hash] = true
+		}
+	}
+	return votes
+}
+
+// markerPattern matches the marker added to exported comments.
+var markerPattern = regexp.MustCompile(`\s*<!-- git-appraise:([0-9a-f]{40}) -->\s*$`)
+
+// AddMarker returns the text of a comment being exported, with a marker of the comment's hash.
+func AddMarker(text, hash string) string {
+	return strings.TrimSpace(text) + "\n\n<!-- git-appraise:" + hash + " -->"
+}
+
+// ParseMarker returns the hash of the comment that the text was exported
+// from, or an empty string if it was not exported from a comment, along with
+// the text without the marker.
+func ParseMarker(text string) (string, string) {
+	match := markerPattern.FindStringSubmatchIndex(text)
+	if match == nil {
+		return "", text
+	}
+	return text[match[2]:match[3]], text[:match[0]]
+}
+
+// Batch collects the notes of mirrored reviews, leaving out the notes that are
+// already present, so that they can all be written at once.
+type Batch struct {
+	existing map[string]map[string]repository.Note
+	notes    map[string]map[string][]repository.Note
+	count    int
+}
+
+// NewBatch returns an empty batch of notes.
+func NewBatch() *Batch {
+	return &Batch{
+		existing: make(map[string]map[string]repository.Note),
+		notes:    make(map[string]map[string][]repository.Note),
+	}
+}
+
+// noteKey identifies a note under the given ref, so that copies of the same comment are only added once.
+func noteKey(notesRef string, note repository.Note) string {
+	if notesRef == comment.Ref {
+		return comment.NoteKey(note)
+	}
+	return string(note)
+}
+
+// Add adds a note to the batch, unless the revision already has it, and reports whether it was added.
+//
+// Comments that the revision already has a copy of (e.g. with another signature) are not added either.
+func (b *Batch) Add(notesRef, revision string, note repository.Note) bool {
+	key := notesRef + " " + revision
+	if b.existing[key] == nil {
+		b.existing[key] = make(map[string]repository.Note)
+		for _, existing := range repository.GetNotes(notesRef, revision) {
+			b.existing[key][noteKey(notesRef, existing)] = existing
+		}
+	}
+	if _, ok := b.existing[key][noteKey(notesRef, note)]; ok {
+		return false
+	}
+	b.existing[key][noteKey(notesRef, note)] = note
+	if b.notes[notesRef] == nil {
+		b.notes[notesRef] = make(map[string][]repository.Note)
+	}
+	b.notes[notesRef][revision] = append(b.notes[notesRef][revision], note)
+	b.count++
+	return true
+}
+
+// AddRequest adds a version of the review request for the given revision.
+func (b *Batch) AddRequest(revision string, r request.Request) error {
+	note, err := r.Write()
+	if err != nil {
+		return err
+	}
+	b.Add(request.Ref, revision, note)
+	return nil
+}
+
+// AddComment adds a comment on the review of the given revision, and returns the comment's hash.
+//
+// If the revision already has a copy of the comment, then the hash of that copy is returned instead.
+func (b *Batch) AddComment(revision string, c comment.Comment) (string, error) {
+	note, err := c.Write()
+	if err != nil {
+		return "", err
+	}
+	if !b.Add(comment.Ref, revision, note) {
+		if existing, err := comment.Parse(b.existing[comment.Ref+" "+revision][noteKey(comment.Ref, note)]); err == nil {
+			c = existing
+		}
+	}
+	return c.Hash()
+}
+
+// AddReport adds a CI report on the given commit.
+func (b *Batch) AddReport(commit string, report ci.Report) error {
+	note, err := report.Write()
+	if err != nil {
+		return err
+	}
+	b.Add(ci.Ref, commit, note)
+	return nil
+}
+
+// Len returns the number of notes in the batch.
+func (b *Batch) Len() int {
+	return b.count
+}
+
+// Write appends the notes in the batch.
+func (b *Batch) Write() error {
+	for notesRef, notes := range b.notes {
+		if err := repository.AppendNotes(notesRef, notes); err != nil {
+			return fmt.Errorf("Failed to write the mirrored notes to %s: %v", notesRef, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,432 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package phabricator imports the reviews of landed Phabricator Differential
+// revisions, read through the Conduit API, as git-appraise reviews of the
+// commits they landed as.
+package phabricator
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/git-appraise/repository"
+	"github.com/google/git-appraise/review/comment"
+	"github.com/google/git-appraise/review/mirror"
+	"github.com/google/git-appraise/review/request"
+)
+
+// Revision is the part of a Differential revision that is imported.
+type Revision struct {
+	ID     int    `json:"id"`
+	PHID   string `json:"phid"`
+	Fields struct {
+		Title        string `json:"title"`
+		Summary      string `json:"summary"`
+		AuthorPHID   string `json:"authorPHID"`
+		DateCreated  int64  `json:"dateCreated"`
+		DateModified int64  `json:"dateModified"`
+		Status       struct {
+			Value string `json:"value"`
+		} `json:"status"`
+	} `json:"fields"`
+	Attachments struct {
+		Reviewers struct {
+			Reviewers []struct {
+				ReviewerPHID string `json:"reviewerPHID"`
+			} `json:"reviewers"`
+		} `json:"reviewers"`
+	} `json:"attachments"`
+}
+
+type transactionComment struct {
+	PHID    string `json:"phid"`
+	Removed bool   `json:"removed"`
+	Content struct {
+		Raw string `json:"raw"`
+	} `json:"content"`
+}
+
+type transaction struct {
+	ID          int64                `json:"id"`
+	Type        string               `json:"type"`
+	AuthorPHID  string               `json:"authorPHID"`
+	DateCreated int64                `json:"dateCreated"`
+	Comments    []transactionComment `json:"comments"`
+	Fields      struct {
+		Path               string `json:"path"`
+		Line               uint32 `json:"line"`
+		Length             uint32 `json:"length"`
+		ReplyToCommentPHID string `json:"replyToCommentPHID"`
+	} `json:"fields"`
+}
+
+// Importer imports the revisions of a Phabricator instance.
+type Importer struct {
+	serverURL  string
+	token      string
+	httpClient *http.Client
+	// domain is the domain of the email addresses given to Phabricator users.
+	domain string
+	// usernames caches the usernames of users, by their PHIDs.
+	usernames map[string]string
+}
+
+// New returns an importer from the Phabricator instance at the given URL, using the given Conduit API token.
+func New(serverURL, token string) *Importer {
+	serverURL = strings.TrimSuffix(serverURL, "/")
+	domain := "users.noreply.phabricator"
+	if u, err := url.Parse(serverURL); err == nil && u.Hostname() != "" {
+		domain = "users.noreply." + u.Hostname()
+	}
+	return &Importer{
+		serverURL:  serverURL,
+		token:      token,
+		httpClient: http.DefaultClient,
+		domain:     domain,
+		usernames:  make(map[string]string),
+	}
+}
+
+// call calls a Conduit API method, and decodes its result into the given value.
+func (i *Importer) call(method string, params map[string]interface{}, result interface{}) error {
+	withToken := map[string]interface{}{"__conduit__": map[string]string{"token": i.token}}
+	for key, value := range params {
+		withToken[key] = value
+	}
+	encoded, err := json.Marshal(withToken)
+	if err != nil {
+		return err
+	}
+	form := url.Values{"params": {string(encoded)}, "output": {"json"}, "__conduit__": {"1"}}
+	resp, err := i.httpClient.PostForm(i.serverURL+"/api/"+method, form)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s: %s", method, resp.Status)
+	}
+	var response struct {
+		Result    json.RawMessage `json:"result"`
+		ErrorCode *string         `json:"error_code"`
+		ErrorInfo *string         `json:"error_info"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return fmt.Errorf("%s: invalid response: %v", method, err)
+	}
+	if response.ErrorCode != nil {
+		info := ""
+		if response.ErrorInfo != nil {
+			info = *response.ErrorInfo
+		}
+		return fmt.Errorf("%s: %s: %s", method, *response.ErrorCode, info)
+	}
+	return json.Unmarshal(response.Result, result)
+}
+
+// search calls a "*.search" method, fetching every page of its results into the given slice.
+func (i *Importer) search(method string, params map[string]interface{}, items interface{}) error {
+	var all []json.RawMessage
+	for after := ""; ; {
+		paged := map[string]interface{}{"limit": 100}
+		for key, value := range params {
+			paged[key] = value
+		}
+		if after != "" {
+			paged["after"] = after
+		}
+		var page struct {
+			Data   []json.RawMessage `json:"data"`
+			Cursor struct {
+				After *string `json:"after"`
+			} `json:"cursor"`
+		}
+		if err := i.call(method, paged, &page); err != nil {
+			return err
+		}
+		all = append(all, page.Data...)
+		if page.Cursor.After == nil || *page.Cursor.After == "" {
+			break
+		}
+		after = *page.Cursor.After
+	}
+	encoded, err := json.Marshal(all)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(encoded, items)
+}
+
+// RepositoryPHID returns the PHID of the repository with the given PHID, callsign, or short name.
+func (i *Importer) RepositoryPHID(name string) (string, error) {
+	if strings.HasPrefix(name, "PHID-") {
+		return name, nil
+	}
+	for _, constraint := range []string{"callsigns", "shortNames"} {
+		var repos []struct {
+			PHID string `json:"phid"`
+		}
+		params := map[string]interface{}{"constraints": map[string]interface{}{constraint: []string{name}}}
+		if err := i.search("diffusion.repository.search", params, &repos); err != nil {
+			return "", err
+		}
+		if len(repos) > 0 {
+			return repos[0].PHID, nil
+		}
+	}
+	return "", fmt.Errorf("There is no repository %q.", name)
+}
+
+// ListRevisions returns the revisions of the repository with the given PHID,
+// or of every repository if there is none, or only the revision with the given
+// ID if it is not zero.
+func (i *Importer) ListRevisions(repositoryPHID string, id int) ([]Revision, error) {
+	constraints := make(map[string]interface{})
+	if repositoryPHID != "" {
+		constraints["repositoryPHIDs"] = []string{repositoryPHID}
+	}
+	if id != 0 {
+		constraints["ids"] = []int{id}
+	}
+	params := map[string]interface{}{
+		"constraints": constraints,
+		"attachments": map[string]bool{"reviewers": true},
+		"order":       "oldest",
+	}
+	var revisions []Revision
+	err := i.search("differential.revision.search", params, &revisions)
+	return revisions, err
+}
+
+// LandedCommits returns the hashes of the commits that the given revisions
+// landed as, indexed by the revisions' PHIDs. Revisions that landed as more
+// than one commit are mapped to the first of them that is present locally.
+func (i *Importer) LandedCommits(revisions []Revision) (map[string]string, error) {
+	if len(revisions) == 0 {
+		return nil, nil
+	}
+	var phids []string
+	for _, r := range revisions {
+		phids = append(phids, r.PHID)
+	}
+	var edges []struct {
+		SourcePHID      string `json:"sourcePHID"`
+		DestinationPHID string `json:"destinationPHID"`
+	}
+	params := map[string]interface{}{"sourcePHIDs": phids, "types": []string{"revision.commit"}}
+	if err := i.search("edge.search", params, &edges); err != nil {
+		return nil, err
+	}
+	if len(edges) == 0 {
+		return nil, nil
+	}
+	var commitPHIDs []string
+	for _, edge := range edges {
+		commitPHIDs = append(commitPHIDs, edge.DestinationPHID)
+	}
+	var commits []struct {
+		PHID   string `json:"phid"`
+		Fields struct {
+			Identifier string `json:"identifier"`
+		} `json:"fields"`
+	}
+	params = map[string]interface{}{"constraints": map[string]interface{}{"phids": commitPHIDs}}
+	if err := i.search("diffusion.commit.search", params, &commits); err != nil {
+		return nil, err
+	}
+	hashes := make(map[string]string)
+	for _, c := range commits {
+		hashes[c.PHID] = c.Fields.Identifier
+	}
+	landed := make(map[string]string)
+	for _, edge := range edges {
+		if _, ok := landed[edge.SourcePHID]; ok {
+			continue
+		}
+		if commit, err := repository.ResolveCommit(hashes[edge.DestinationPHID]); err == nil && hashes[edge.DestinationPHID] != "" {
+			landed[edge.SourcePHID] = commit
+		}
+	}
+	return landed, nil
+}
+
+// emails returns the email addresses of the users with the given PHIDs,
+// leaving out the PHIDs of anything else, such as projects.
+func (i *Importer) emails(phids []string) ([]string, error) {
+	var missing []string
+	for _, phid := range phids {
+		if _, ok := i.usernames[phid]; !ok && strings.HasPrefix(phid, "PHID-USER-") {
+			missing = append(missing, phid)
+		}
+	}
+	if len(missing) > 0 {
+		var users []struct {
+			PHID   string `json:"phid"`
+			Fields struct {
+				Username string `json:"username"`
+			} `json:"fields"`
+		}
+		params := map[string]interface{}{"constraints": map[string]interface{}{"phids": missing}}
+		if err := i.search("user.search", params, &users); err != nil {
+			return nil, err
+		}
+		for _, user := range users {
+			i.usernames[user.PHID] = user.Fields.Username
+		}
+	}
+	var emails []string
+	for _, phid := range phids {
+		if username := i.usernames[phid]; username != "" {
+			emails = append(emails, mirror.Email(username, i.domain))
+		}
+	}
+	return emails, nil
+}
+
+// email returns the email address of the user with the given PHID, or an error if it is not a user.
+func (i *Importer) email(phid string) (string, error) {
+	emails, err := i.emails([]string{phid})
+	if err != nil {
+		return "", err
+	}
+	if len(emails) == 0 {
+		return "", fmt.Errorf("%s is not a user.", phid)
+	}
+	return emails[0], nil
+}
+
+// convertRequest returns the versions of the review request for a revision
+// that landed as the given commit: the request as it was created, and as of
+// its landing.
+//
+// Phabricator does not say when a revision landed, so the time it was last
+// modified is used for that.
+func (i *Importer) convertRequest(r Revision, commit, targetRef string) ([]request.Request, error) {
+	requester, err := i.email(r.Fields.AuthorPHID)
+	if err != nil {
+		return nil, err
+	}
+	var reviewerPHIDs []string
+	for _, reviewer := range r.Attachments.Reviewers.Reviewers {
+		reviewerPHIDs = append(reviewerPHIDs, reviewer.ReviewerPHID)
+	}
+	reviewers, err := i.emails(reviewerPHIDs)
+	if err != nil {
+		return nil, err
+	}
+	created := request.Request{
+		Timestamp:   mirror.Timestamp(time.Unix(r.Fields.DateCreated, 0)),
+		TargetRef:   targetRef,
+		Requester:   requester,
+		Reviewers:   reviewers,
+		Description: strings.TrimSpace(fmt.Sprintf("%s\n\n%s\n\nDifferential Revision: %s/D%d", r.Fields.Title, r.Fields.Summary, i.serverURL, r.ID)),
+	}
+	created.UpdateMentions()
+	landed := created
+	landed.Timestamp = mirror.Timestamp(time.Unix(r.Fields.DateModified, 0))
+	landed.SubmittedAs = commit
+	return []request.Request{created, landed}, nil
+}
+
+// Import adds the notes for a revision, which landed as the given commit on
+// the given target ref, and for its comments, inline comments, acceptances,
+// and requests for changes, to the batch.
+func (i *Importer) Import(r Revision, commit, targetRef string, batch *mirror.Batch) error {
+	requests, err := i.convertRequest(r, commit, targetRef)
+	if err != nil {
+		return err
+	}
+	for _, req := range requests {
+		if err := batch.AddRequest(commit, req); err != nil {
+			return err
+		}
+	}
+
+	var transactions []transaction
+	params := map[string]interface{}{"objectIdentifier": r.PHID}
+	if err := i.search("transaction.search", params, &transactions); err != nil {
+		return err
+	}
+	// Transactions are listed newest first, and replies must follow what they reply to.
+	sort.SliceStable(transactions, func(a, b int) bool {
+		if transactions[a].DateCreated != transactions[b].DateCreated {
+			return transactions[a].DateCreated < transactions[b].DateCreated
+		}
+		return transactions[a].ID < transactions[b].ID
+	})
+	hashes := make(map[string]string)
+	for _, t := range transactions {
+		var text, phid string
+		// The comment's versions are listed newest first.
+		if len(t.Comments) > 0 {
+			if t.Comments[0].Removed {
+				continue
+			}
+			text, phid = t.Comments[0].Content.Raw, t.Comments[0].PHID
+		}
+		var resolved *bool
+		switch t.Type {
+		case "comment", "inline":
+			if text == "" {
+				continue
+			}
+		case "accept", "request-changes":
+			accepted := t.Type == "accept"
+			resolved = &accepted
+		default:
+			continue
+		}
+		author, err := i.email(t.AuthorPHID)
+		if err != nil {
+			// Transactions by bots and applications have no user to attribute them to.
+			continue
+		}
+		c := mirror.NewComment(mirror.Timestamp(time.Unix(t.DateCreated, 0)), author, text)
+		c.Resolved = resolved
+		if t.Type == "inline" {
+			if parent := hashes[t.Fields.ReplyToCommentPHID]; parent != "" {
+				c.Parent = parent
+			} else {
+				c.Location = &comment.Location{Commit: commit, Path: t.Fields.Path}
+				if t.Fields.Line > 0 {
+					c.Location.Range = &comment.Range{StartLine: t.Fields.Line}
+					if t.Fields.Length > 1 {
+						c.Location.Range.EndLine = t.Fields.Line + t.Fields.Length - 1
+					}
+				}
+			}
+		}
+		hash, err := batch.AddComment(commit, c)
+		if err != nil {
+			return err
+		}
+		if phid != "" {
+			hashes[phid] = hash
+		}
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package phabricator
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestConvertRequest(t *testing.T) {
+	i := New("https://phab.example.com/", "token")
+	i.usernames["PHID-USER-a"] = "alice"
+	i.usernames["PHID-USER-b"] = "bob"
+	var r Revision
+	r.ID = 12
+	r.Fields.Title = "Fix the frobnicator"
+	r.Fields.Summary = "cc @carol"
+	r.Fields.AuthorPHID = "PHID-USER-a"
+	r.Fields.DateCreated = 1000
+	r.Fields.DateModified = 2000
+	for _, phid := range []string{"PHID-USER-b", "PHID-PROJ-x"} {
+		r.Attachments.Reviewers.Reviewers = append(r.Attachments.Reviewers.Reviewers, struct {
+			ReviewerPHID string `json:"reviewerPHID"`
+		}{phid})
+	}
+	requests, err := i.convertRequest(r, "abc", "refs/heads/master")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(requests) != 2 {
+		t.Fatalf("Unexpected requests: %+v", requests)
+	}
+	created, landed := requests[0], requests[1]
+	wantDescription := "Fix the frobnicator\n\ncc @carol\n\nDifferential Revision: https://phab.example.com/D12"
+	if created.Timestamp != "1000" || created.TargetRef != "refs/heads/master" || created.Requester != "alice@users.noreply.phab.example.com" ||
+		created.Description != wantDescription || created.SubmittedAs != "" {
+		t.Errorf("Unexpected request: %+v", created)
+	}
+	if !reflect.DeepEqual(created.Reviewers, []string{"bob@users.noreply.phab.example.com"}) {
+		t.Errorf("Unexpected reviewers: %v", created.Reviewers)
+	}
+	if !reflect.DeepEqual(created.Mentions, []string{"carol"}) {
+		t.Errorf("Unexpected mentions: %v", created.Mentions)
+	}
+	if landed.Timestamp != "2000" || landed.SubmittedAs != "abc" {
+		t.Errorf("Unexpected request for the landing: %+v", landed)
+	}
+}
@@ -0,0 +1,122 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package nudge defines the records of reminders sent about reviews that have gone stale.
+package nudge
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/google/git-appraise/repository"
+	"github.com/google/git-appraise/review/schema"
+)
+
+const (
+	// Ref defines the git-notes ref that we expect to contain nudges.
+	//
+	// Nudges annotate the first revision of the review, like its request.
+	// They are kept apart from the comments, so that they do not count as
+	// activity on the review.
+	Ref = "refs/notes/devtools/nudges"
+
+	// FormatVersion defines the latest version of the nudge format supported by the tool.
+	FormatVersion = 0
+)
+
+// Format describes the versions of the nudge format, and has a migration to each version after the first.
+var Format = &schema.Format{Name: "nudge"}
+
+// Nudge records that the users whose turn it was to act on a stale review were reminded about it.
+type Nudge struct {
+	Timestamp  string   `json:"timestamp,omitempty"`
+	Author     string   `json:"author,omitempty"`
+	Recipients []string `json:"recipients,omitempty"`
+	// Idle is how long the review had been idle for, in seconds.
+	Idle int64 `json:"idle,omitempty"`
+	// Version represents the version of the metadata format.
+	Version int `json:"v,omitempty"`
+}
+
+// New returns a new nudge, sent by the current user at the given time.
+func New(recipients []string, now time.Time, idle time.Duration) Nudge {
+	return Nudge{
+		Timestamp:  strconv.FormatInt(now.Unix(), 10),
+		Author:     repository.GetUserEmail(),
+		Recipients: recipients,
+		Idle:       int64(idle / time.Second),
+	}
+}
+
+// Time returns the time at which the nudge was sent, or the zero time if that is not known.
+func (n Nudge) Time() time.Time {
+	seconds, err := strconv.ParseInt(n.Timestamp, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Unix(seconds, 0)
+}
+
+// Parse parses a nudge from a git note.
+func Parse(note repository.Note) (Nudge, error) {
+	bytes := []byte(note)
+	var n Nudge
+	err := json.Unmarshal(bytes, &n)
+	return n, err
+}
+
+// parseUpgraded parses a nudge written in another version of the format.
+func parseUpgraded(note repository.Note) (Nudge, error) {
+	upgraded, err := Format.Upgrade(note)
+	if err != nil {
+		return Nudge{}, err
+	}
+	return Parse(upgraded)
+}
+
+// ParseAllValid takes collection of git notes and tries to parse a nudge
+// from each one. Any notes that are not valid nudges get ignored.
+func ParseAllValid(notes []repository.Note) []Nudge {
+	var nudges []Nudge
+	for _, note := range notes {
+		n, err := Parse(note)
+		if err == nil && n.Version != FormatVersion {
+			n, err = parseUpgraded(note)
+		}
+		if err == nil && n.Timestamp != "" {
+			nudges = append(nudges, n)
+		}
+	}
+	return nudges
+}
+
+// Write writes a nudge as a JSON-formatted git note.
+func (n *Nudge) Write() (repository.Note, error) {
+	bytes, err := json.Marshal(n)
+	return repository.Note(bytes), err
+}
+
+// LastNudged returns the time of the latest of the given nudges, or the zero time if there are none.
+func LastNudged(nudges []Nudge) time.Time {
+	var latest time.Time
+	for _, n := range nudges {
+		if t := n.Time(); t.After(latest) {
+			latest = t
+		}
+	}
+	return latest
+}
@@ -0,0 +1,324 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package policy defines the approval policy that reviews must satisfy before they are submitted.
+//
+// The policy is checked in to the repository, and is read from the target of
+// each review, so that a review cannot change the policy that applies to it.
+// It consists of two parts, both optional:
+//
+// 1. The ".appraise/policy" file, each line of which is a rule of the form
+// "<pattern> <count> [<approver>...]". If any of the files changed by a
+// review match the pattern, then the review needs that many approvals from the
+// listed approvers (or from anyone, if none are listed).
+//
+// 2. OWNERS files, each line of which is the email address of an owner of the
+// files in its directory and its subdirectories. Every changed file needs an
+// approval from one of its owners. A line reading "set noparent" stops the
+// owners of parent directories from counting.
+//
+// In both, blank lines and lines starting with "#" are ignored.
+package policy
+
+import (
+	"bufio"
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/google/git-appraise/repository"
+)
+
+const (
+	// File is the path of the file holding the policy's rules.
+	File = ".appraise/policy"
+	// OwnersFile is the name of the files listing the owners of each directory.
+	OwnersFile = "OWNERS"
+	// noParent is the line in an OWNERS file that stops the owners of parent directories from counting.
+	noParent = "set noparent"
+)
+
+// Rule requires a number of approvals for changes to the files matching a pattern.
+type Rule struct {
+	Pattern string
+	Count   int
+	// Approvers are the users whose approvals count, or empty if anyone's do.
+	Approvers []string
+}
+
+// Requirement is a number of approvals that a review needs for some of its files.
+type Requirement struct {
+	// Source is where the requirement comes from, e.g. a rule or an OWNERS file.
+	Source    string   `json:"source"`
+	Files     []string `json:"files"`
+	Count     int      `json:"count"`
+	Approvers []string `json:"approvers,omitempty"`
+	// Approvals are the approvals that count towards the requirement.
+	Approvals []string `json:"approvals,omitempty"`
+}
+
+// Met reports whether the requirement has enough approvals.
+func (req Requirement) Met() bool {
+	return len(req.Approvals) >= req.Count
+}
+
+// String explains the requirement, e.g. `2 approvals from any of a@example.com, b@example.com for foo.go (rule "*.go"); has 1`.
+func (req Requirement) String() string {
+	approvals := "approval"
+	if req.Count != 1 {
+		approvals += "s"
+	}
+	from := "anyone"
+	if len(req.Approvers) > 0 {
+		from = "any of " + strings.Join(req.Approvers, ", ")
+	}
+	files := strings.Join(req.Files, ", ")
+	if len(req.Files) > 3 {
+		files = fmt.Sprintf("%s, and %d more files", strings.Join(req.Files[:3], ", "), len(req.Files)-3)
+	}
+	explanation := fmt.Sprintf("%d %s from %s for %s (%s); has %d", req.Count, approvals, from, files, req.Source, len(req.Approvals))
+	if len(req.Approvals) > 0 {
+		explanation += " (" + strings.Join(req.Approvals, ", ") + ")"
+	}
+	return explanation
+}
+
+// Policy is the set of approval requirements that apply to a target ref.
+type Policy struct {
+	Rules []Rule
+	// Owners maps each directory with an OWNERS file ("" for the root) to the contents of that file.
+	Owners map[string]string
+}
+
+// readLines returns the lines of a policy or OWNERS file that are not blank or comments.
+func readLines(contents string) []string {
+	var lines []string
+	scanner := bufio.NewScanner(strings.NewReader(contents))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// ParseRules parses the contents of the policy file.
+func ParseRules(contents string) ([]Rule, error) {
+	var rules []Rule
+	for _, line := range readLines(contents) {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("Invalid rule %q in %s; it must be of the form \"<pattern> <count> [<approver>...]\"", line, File)
+		}
+		count, err := strconv.Atoi(fields[1])
+		if err != nil || count < 0 {
+			return nil, fmt.Errorf("Invalid number of approvals %q in %s", fields[1], File)
+		}
+		if len(fields) > 2 && count > len(fields)-2 {
+			return nil, fmt.Errorf("The rule %q in %s requires more approvals than there are approvers", line, File)
+		}
+		if _, err := patternRegexp(fields[0]); err != nil {
+			return nil, fmt.Errorf("Invalid pattern %q in %s: %v", fields[0], File, err)
+		}
+		rules = append(rules, Rule{Pattern: fields[0], Count: count, Approvers: fields[2:]})
+	}
+	return rules, nil
+}
+
+// patternRegexp converts a gitignore-style pattern into a regular expression matching slash-separated paths.
+//
+// Patterns without a slash match files with that name in any directory, and
+// patterns ending in a slash match everything under that directory. "*"
+// matches within a single path segment, and "**" matches across segments.
+func patternRegexp(pattern string) (*regexp.Regexp, error) {
+	anchored := strings.Contains(strings.TrimSuffix(pattern, "/"), "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+	if strings.HasSuffix(pattern, "/") {
+		pattern += "**"
+	}
+	var expr strings.Builder
+	if !anchored {
+		expr.WriteString("(?:.*/)?")
+	}
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			expr.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			expr.WriteString(".*")
+			i++
+		case c == '*':
+			expr.WriteString("[^/]*")
+		case c == '?':
+			expr.WriteString("[^/]")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return regexp.Compile("^" + expr.String() + "$")
+}
+
+// matchPattern reports whether the given slash-separated path matches the pattern.
+func matchPattern(pattern, file string) bool {
+	re, err := patternRegexp(pattern)
+	return err == nil && re.MatchString(file)
+}
+
+// Dirs returns the directories ("" for the root) in which OWNERS files could
+// apply to the given files, so that a caller can read the files that exist.
+func Dirs(files []string) []string {
+	seen := make(map[string]bool)
+	var dirs []string
+	for _, file := range files {
+		for dir := path.Dir(file); ; dir = path.Dir(dir) {
+			if dir == "." || dir == "/" {
+				dir = ""
+			}
+			if !seen[dir] {
+				seen[dir] = true
+				dirs = append(dirs, dir)
+			}
+			if dir == "" {
+				break
+			}
+		}
+	}
+	return dirs
+}
+
+// Load reads the policy that applies to changes to the given files from the given ref.
+//
+// Only the OWNERS files that could apply to the given files are read.
+func Load(ref string, files []string) (Policy, error) {
+	p := Policy{Owners: make(map[string]string)}
+	if contents, err := repository.GetFileContents(ref, File); err == nil {
+		rules, err := ParseRules(contents)
+		if err != nil {
+			return p, err
+		}
+		p.Rules = rules
+	}
+	for _, dir := range Dirs(files) {
+		if contents, err := repository.GetFileContents(ref, path.Join(dir, OwnersFile)); err == nil {
+			p.Owners[dir] = contents
+		}
+	}
+	return p, nil
+}
+
+// owners returns the owners of the given file, along with the OWNERS files that list them.
+func (p Policy) owners(file string) ([]string, []string) {
+	var owners, sources []string
+	for dir := path.Dir(file); ; dir = path.Dir(dir) {
+		if dir == "." || dir == "/" {
+			dir = ""
+		}
+		if contents, ok := p.Owners[dir]; ok {
+			sources = append(sources, path.Join(dir, OwnersFile))
+			stop := false
+			for _, line := range readLines(contents) {
+				if line == noParent {
+					stop = true
+				} else {
+					owners = append(owners, line)
+				}
+			}
+			if stop {
+				break
+			}
+		}
+		if dir == "" {
+			break
+		}
+	}
+	return owners, sources
+}
+
+// countApprovals returns the approvals that are from the given approvers, or all of them if no approvers are given.
+func countApprovals(approvals, approvers []string) []string {
+	if len(approvers) == 0 {
+		return approvals
+	}
+	var counted []string
+	for _, approval := range approvals {
+		for _, approver := range approvers {
+			if strings.EqualFold(approval, approver) {
+				counted = append(counted, approval)
+				break
+			}
+		}
+	}
+	return counted
+}
+
+// Evaluate returns the requirements that apply to a review changing the
+// given files, along with which of the given approvals count towards each.
+func (p Policy) Evaluate(files, approvals []string) []Requirement {
+	var requirements []Requirement
+	for _, rule := range p.Rules {
+		req := Requirement{
+			Source:    fmt.Sprintf("rule %q", rule.Pattern),
+			Count:     rule.Count,
+			Approvers: rule.Approvers,
+		}
+		for _, file := range files {
+			if matchPattern(rule.Pattern, file) {
+				req.Files = append(req.Files, file)
+			}
+		}
+		if req.Files != nil {
+			req.Approvals = countApprovals(approvals, rule.Approvers)
+			requirements = append(requirements, req)
+		}
+	}
+	// Files with the same owners share a single requirement.
+	byOwners := make(map[string]int)
+	for _, file := range files {
+		owners, sources := p.owners(file)
+		if owners == nil {
+			continue
+		}
+		key := strings.Join(owners, " ")
+		i, ok := byOwners[key]
+		if !ok {
+			i = len(requirements)
+			byOwners[key] = i
+			requirements = append(requirements, Requirement{
+				Source:    strings.Join(sources, ", "),
+				Count:     1,
+				Approvers: owners,
+				Approvals: countApprovals(approvals, owners),
+			})
+		}
+		requirements[i].Files = append(requirements[i].Files, file)
+	}
+	return requirements
+}
+
+// Unmet returns the requirements that do not have enough approvals.
+func Unmet(requirements []Requirement) []Requirement {
+	var unmet []Requirement
+	for _, req := range requirements {
+		if !req.Met() {
+			unmet = append(unmet, req)
+		}
+	}
+	return unmet
+}
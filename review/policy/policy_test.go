@@ -0,0 +1,93 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package policy
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMatchPattern(t *testing.T) {
+	cases := []struct {
+		pattern, file string
+		match         bool
+	}{
+		{"*", "a/b.go", true},
+		{"*.go", "a/b.go", true},
+		{"*.go", "a/b.txt", false},
+		{"/*.go", "a/b.go", false},
+		{"/*.go", "b.go", true},
+		{"docs/", "docs/a/b.md", true},
+		{"docs/", "src/docs/a.md", true},
+		{"src/*.go", "src/a/b.go", false},
+		{"src/**/*.go", "src/a/b.go", true},
+		{"src/**/*.go", "src/b.go", true},
+		{"README?md", "README.md", true},
+	}
+	for _, c := range cases {
+		if match := matchPattern(c.pattern, c.file); match != c.match {
+			t.Errorf("matchPattern(%q, %q) = %v, expected %v", c.pattern, c.file, match, c.match)
+		}
+	}
+}
+
+func TestParseRules(t *testing.T) {
+	rules, err := ParseRules("# comment\n\n* 1\nsecurity/ 2 a@example.com b@example.com\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Rule{
+		{Pattern: "*", Count: 1, Approvers: []string{}},
+		{Pattern: "security/", Count: 2, Approvers: []string{"a@example.com", "b@example.com"}},
+	}
+	if !reflect.DeepEqual(rules, expected) {
+		t.Errorf("Unexpected rules %+v", rules)
+	}
+	for _, invalid := range []string{"*", "* x", "* -1", "* 2 a@example.com"} {
+		if _, err := ParseRules(invalid); err == nil {
+			t.Errorf("Failed to reject the invalid rule %q", invalid)
+		}
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	p := Policy{
+		Rules: []Rule{
+			{Pattern: "*.md", Count: 1},
+			{Pattern: "security/", Count: 2, Approvers: []string{"a@example.com", "b@example.com"}},
+		},
+		Owners: map[string]string{
+			"":     "root@example.com\n",
+			"lib":  "# Library owners\nlib@example.com\n",
+			"vend": "set noparent\nvend@example.com\n",
+		},
+	}
+	files := []string{"lib/x.go", "lib/y/z.go", "vend/v.go", "security/s.go"}
+	requirements := p.Evaluate(files, []string{"A@example.com", "root@example.com"})
+	expected := []Requirement{
+		{Source: `rule "security/"`, Files: []string{"security/s.go"}, Count: 2, Approvers: []string{"a@example.com", "b@example.com"}, Approvals: []string{"A@example.com"}},
+		{Source: "lib/OWNERS, OWNERS", Files: []string{"lib/x.go", "lib/y/z.go"}, Count: 1, Approvers: []string{"lib@example.com", "root@example.com"}, Approvals: []string{"root@example.com"}},
+		{Source: "vend/OWNERS", Files: []string{"vend/v.go"}, Count: 1, Approvers: []string{"vend@example.com"}},
+		{Source: "OWNERS", Files: []string{"security/s.go"}, Count: 1, Approvers: []string{"root@example.com"}, Approvals: []string{"root@example.com"}},
+	}
+	if !reflect.DeepEqual(requirements, expected) {
+		t.Errorf("Unexpected requirements %+v", requirements)
+	}
+	if unmet := Unmet(requirements); len(unmet) != 2 || unmet[0].Source != `rule "security/"` || unmet[1].Source != "vend/OWNERS" {
+		t.Errorf("Unexpected unmet requirements %+v", unmet)
+	}
+}
@@ -0,0 +1,127 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package review
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// PorcelainVersion is the version of the porcelain output format.
+//
+// The format of a version never changes. Fields may only be appended to the
+// end of a line, and lines of new kinds may be added, so scripts should
+// ignore any they do not recognize.
+const PorcelainVersion = 1
+
+// PorcelainHeader is the first line of porcelain output.
+var PorcelainHeader = fmt.Sprintf("# appraise porcelain v%d", PorcelainVersion)
+
+// porcelainEscaper escapes the characters that would break up the fields or lines of porcelain output.
+var porcelainEscaper = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`)
+
+// porcelainLine joins the fields into a tab-separated line, escaping them as needed.
+func porcelainLine(fields ...string) string {
+	for i, field := range fields {
+		fields[i] = porcelainEscaper.Replace(field)
+	}
+	return strings.Join(fields, "\t") + "\n"
+}
+
+// Status describes the state of the review in a single word: "submitted",
+// "abandoned", "accepted", "rejected", or "pending".
+func (r *Review) Status() string {
+	switch {
+	case r.Submitted:
+		return "submitted"
+	case r.Abandoned:
+		return "abandoned"
+	case r.Resolved == nil:
+		return "pending"
+	case *r.Resolved:
+		return "accepted"
+	}
+	return "rejected"
+}
+
+// porcelainCommentStatus describes a comment's resolved bit in a single word.
+func porcelainCommentStatus(thread CommentThread) string {
+	switch {
+	case thread.Comment.Retracted:
+		return "retracted"
+	case thread.Comment.Resolved == nil:
+		return "fyi"
+	case *thread.Comment.Resolved:
+		return "lgtm"
+	}
+	return "needswork"
+}
+
+// WritePorcelainSummary writes the line describing the review:
+//
+//	review <revision> <status> <requester> <target ref> <review ref> <timestamp> <description> [<repository>]
+//
+// The repository is only written for reviews listed from federated repositories.
+func (r *Review) WritePorcelainSummary(w io.Writer) error {
+	fields := []string{"review", r.Revision, r.Status(), r.Request.Requester,
+		r.Request.TargetRef, r.Request.ReviewRef, r.Request.Timestamp, r.Request.Description}
+	if r.Repository != "" {
+		fields = append(fields, r.Repository)
+	}
+	_, err := io.WriteString(w, porcelainLine(fields...))
+	return err
+}
+
+// writePorcelainThreads writes a line for each comment in the threads:
+//
+//	comment <hash> <parent hash> <timestamp> <author> <status> <path> <line> <description>
+func writePorcelainThreads(w io.Writer, threads []CommentThread, parent string) error {
+	for _, thread := range threads {
+		c := thread.Comment
+		var path, line string
+		if c.Location != nil {
+			path = c.Location.Path
+			if c.Location.Range != nil && c.Location.Range.StartLine > 0 {
+				line = strconv.FormatUint(uint64(c.Location.Range.StartLine), 10)
+			}
+		}
+		if _, err := io.WriteString(w, porcelainLine("comment", thread.Hash, parent, c.Timestamp, c.Author,
+			porcelainCommentStatus(thread), path, line, c.Description)); err != nil {
+			return err
+		}
+		if err := writePorcelainThreads(w, thread.Children, thread.Hash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WritePorcelainDetails writes the review line, followed by a line for each
+// reviewer ("reviewer <email>") and each comment.
+func (r *Review) WritePorcelainDetails(w io.Writer) error {
+	if err := r.WritePorcelainSummary(w); err != nil {
+		return err
+	}
+	for _, reviewer := range r.Request.Reviewers {
+		if _, err := io.WriteString(w, porcelainLine("reviewer", reviewer)); err != nil {
+			return err
+		}
+	}
+	return writePorcelainThreads(w, r.Comments, "")
+}
@@ -19,17 +19,43 @@ package request
 
 import (
 	"encoding/json"
+	"fmt"
 	"github.com/google/git-appraise/repository"
+	"github.com/google/git-appraise/review/gpg"
+	"github.com/google/git-appraise/review/mention"
+	"github.com/google/git-appraise/review/schema"
 	"strconv"
+	"strings"
 	"time"
 )
 
 // Ref defines the git-notes ref that we expect to contain review requests.
 const Ref = "refs/notes/devtools/reviews"
 
+// ArchiveRef defines the git-notes ref that holds the review requests of closed reviews
+// that have been moved out of the way, so that they no longer slow down listing open reviews.
+const ArchiveRef = "refs/notes/devtools/archive"
+
 // FormatVersion defines the latest version of the request format supported by the tool.
 const FormatVersion = 0
 
+// Format describes the versions of the request format, and has a migration to each version after the first.
+var Format = &schema.Format{Name: "review request"}
+
+// DueDateFormat is the layout used for the due date of a review request.
+const DueDateFormat = "2006-01-02"
+
+// The strategies with which a review can be submitted.
+const (
+	SubmitFastForward = "fast-forward"
+	SubmitMerge       = "merge"
+	SubmitRebase      = "rebase"
+	SubmitSquash      = "squash"
+)
+
+// Priorities lists the supported priority levels, from the most to the least urgent.
+var Priorities = []string{"P0", "P1", "P2", "P3", "P4"}
+
 // Request represents an initial request for a code review.
 //
 // Every field except for TargetRef is optional.
@@ -43,16 +69,52 @@ type Request struct {
 	Requester   string   `json:"requester,omitempty"`
 	Reviewers   []string `json:"reviewers,omitempty"`
 	Description string   `json:"description,omitempty"`
+	// Mentions are the users mentioned (as "@user") in the description.
+	Mentions []string `json:"mentions,omitempty"`
+	// Priority is one of the levels listed in Priorities, and Due is a date in the DueDateFormat layout.
+	Priority string `json:"priority,omitempty"`
+	Due      string `json:"due,omitempty"`
+	// Labels are free-form names used to categorize reviews (e.g. "security").
+	Labels []string `json:"labels,omitempty"`
+	// Milestone is the name of the milestone (e.g. a release) that the review is attached to.
+	Milestone string `json:"milestone,omitempty"`
+	// Checklist lists the items that must be checked off before the review is
+	// complete. The marks checking them off are kept in the checklist package's ref.
+	Checklist []string `json:"checklist,omitempty"`
+	// DependsOn lists the revisions of the reviews that must be submitted before this one.
+	DependsOn []string `json:"dependsOn,omitempty"`
 	// Version represents the version of the metadata format.
 	Version int `json:"v,omitempty"`
+	// Clock is a Lamport clock ordering the versions of the request and the
+	// comments on the review: it is greater than the clock of everything that
+	// its author had seen on the review, regardless of the wall-clock time.
+	// It is missing from notes written by older releases of the tool.
+	Clock uint64 `json:"clock,omitempty"`
+	// SubmitStrategy is one of the Submit* constants, and SubmittedAs is the commit
+	// on the target ref that incorporates the review, for reviews that have been submitted.
+	SubmitStrategy string `json:"submitStrategy,omitempty"`
+	SubmittedAs    string `json:"submittedAs,omitempty"`
+	// Alias is the first commit of the review after it was last rebased.
+	// The review itself stays attached to its original first commit.
+	Alias string `json:"alias,omitempty"`
+	// Abandoned indicates that the review was closed without being submitted.
+	Abandoned bool `json:"abandoned,omitempty"`
+	// Reopened indicates that the review was reopened after being submitted (e.g.
+	// because the change was reverted), so it is only considered submitted again
+	// once a later submission records SubmittedAs.
+	Reopened bool `json:"reopened,omitempty"`
+	// Signature is an optional GPG signature of the request, made with the signature field left empty.
+	Signature string `json:"signature,omitempty"`
 }
 
 // New returns a new request.
 //
-// The Timestamp and Requester fields are automatically filled in with the current time and user.
+// The Timestamp and Requester fields are automatically filled in with the
+// current time and user, and the Clock is started at one.
 func New(reviewers []string, reviewRef, targetRef, description string) Request {
 	return Request{
 		Timestamp:   strconv.FormatInt(time.Now().Unix(), 10),
+		Clock:       1,
 		Requester:   repository.GetUserEmail(),
 		Reviewers:   reviewers,
 		ReviewRef:   reviewRef,
@@ -61,6 +123,64 @@ func New(reviewers []string, reviewRef, targetRef, description string) Request {
 	}
 }
 
+// UpdateMentions sets the Mentions field to the users mentioned in the description.
+//
+// This must be called whenever the description is changed.
+func (r *Request) UpdateMentions() {
+	r.Mentions = mention.Parse(r.Description)
+}
+
+// PriorityRank returns the position of the request's priority in the Priorities list.
+//
+// Requests without a (recognized) priority rank after all of the known levels.
+func (request Request) PriorityRank() int {
+	for rank, priority := range Priorities {
+		if request.Priority == priority {
+			return rank
+		}
+	}
+	return len(Priorities)
+}
+
+// ValidatePriority returns an error if the given priority is not one of the supported levels.
+func ValidatePriority(priority string) error {
+	for _, p := range Priorities {
+		if priority == p {
+			return nil
+		}
+	}
+	return fmt.Errorf("Invalid priority %q; must be one of %v", priority, Priorities)
+}
+
+// ValidateLabel returns an error if the given label is empty, or contains whitespace or commas.
+func ValidateLabel(label string) error {
+	if label == "" || strings.ContainsAny(label, ", \t\r\n") {
+		return fmt.Errorf("Invalid label %q; labels must be non-empty and cannot contain whitespace or commas", label)
+	}
+	return nil
+}
+
+// HasLabel reports whether the request has the given label, ignoring case.
+func (request Request) HasLabel(label string) bool {
+	for _, l := range request.Labels {
+		if strings.EqualFold(l, label) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseDueDate parses a due date, returning the time at which the review becomes overdue.
+//
+// Reviews are due by the end of the given day, in the local time zone.
+func ParseDueDate(due string) (time.Time, error) {
+	day, err := time.ParseInLocation(DueDateFormat, due, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Invalid due date %q; must be of the form YYYY-MM-DD", due)
+	}
+	return day.AddDate(0, 0, 1), nil
+}
+
 // Parse parses a review request from a git note.
 func Parse(note repository.Note) (Request, error) {
 	bytes := []byte(note)
@@ -70,6 +190,15 @@ func Parse(note repository.Note) (Request, error) {
 	return request, err
 }
 
+// parseUpgraded parses a review request written in another version of the format.
+func parseUpgraded(note repository.Note) (Request, error) {
+	upgraded, err := Format.Upgrade(note)
+	if err != nil {
+		return Request{}, err
+	}
+	return Parse(upgraded)
+}
+
 // ParseAllValid takes collection of git notes and tries to parse a review
 // request from each one. Any notes that are not valid review requests get
 // ignored, as we expect the git notes to be a heterogenous list, with only
@@ -78,7 +207,10 @@ func ParseAllValid(notes []repository.Note) []Request {
 	var requests []Request
 	for _, note := range notes {
 		request, err := Parse(note)
-		if err == nil && request.Version == FormatVersion && request.TargetRef != "" {
+		if err == nil && request.Version != FormatVersion {
+			request, err = parseUpgraded(note)
+		}
+		if err == nil && request.TargetRef != "" {
 			requests = append(requests, request)
 		}
 	}
@@ -90,3 +222,32 @@ func (request *Request) Write() (repository.Note, error) {
 	bytes, err := json.Marshal(request)
 	return repository.Note(bytes), err
 }
+
+// Sign adds a GPG signature of the request, made by the current user.
+func (request *Request) Sign() error {
+	request.Signature = ""
+	payload, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	signature, err := gpg.Sign(payload)
+	if err != nil {
+		return err
+	}
+	request.Signature = signature
+	return nil
+}
+
+// VerifySignature checks whether the request was signed by its requester.
+func (request Request) VerifySignature() gpg.Status {
+	signature := request.Signature
+	if signature == "" {
+		return gpg.StatusUnsigned
+	}
+	request.Signature = ""
+	payload, err := json.Marshal(request)
+	if err != nil {
+		return gpg.StatusBad
+	}
+	return gpg.Verify(payload, signature, request.Requester)
+}
@@ -21,10 +21,14 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"log"
+	"runtime"
 	"sort"
 	"github.com/google/git-appraise/repository"
+	"github.com/google/git-appraise/review/analyses"
 	"github.com/google/git-appraise/review/ci"
 	"github.com/google/git-appraise/review/comment"
+	"github.com/google/git-appraise/review/gpg"
 	"github.com/google/git-appraise/review/request"
 	"strconv"
 	"strings"
@@ -36,6 +40,8 @@ const (
 	reviewTemplate = `[%s] %s
   "%s"
 `
+	// Template for printing a submodule changed by a code review.
+	submoduleTemplate = "  submodule %s: %s\n"
 	// Template for printing a single comment.
 	commentTemplate = `[%s] %s
   %s %s "%s"
@@ -50,11 +56,22 @@ const (
 // FYI only, and that there are no unaddressed comments. If it is set to true,
 // then that means that there are no unaddressed comments, and that the root
 // comment has its resolved bit set to true.
+//
+// The SignatureStatus field is only set once signatures have been verified.
+//
+// If the comment has been edited or retracted, then the Comment field holds
+// its latest version, and the History field holds the original comment
+// followed by the amendments made to it, oldest first.
+//
+// The Acks field holds the acknowledgements of the comment, oldest first.
 type CommentThread struct {
-	Hash     string          `json:"hash,omitempty"`
-	Comment  comment.Comment `json:"comment"`
-	Children []CommentThread `json:"children,omitempty"`
-	Resolved *bool           `json:"resolved,omitempty"`
+	Hash            string            `json:"hash,omitempty"`
+	Comment         comment.Comment   `json:"comment"`
+	History         []comment.Comment `json:"history,omitempty"`
+	Acks            []comment.Comment `json:"acks,omitempty"`
+	Children        []CommentThread   `json:"children,omitempty"`
+	Resolved        *bool             `json:"resolved,omitempty"`
+	SignatureStatus gpg.Status        `json:"signatureStatus,omitempty"`
 }
 
 // Review represents the entire state of a code review.
@@ -66,22 +83,62 @@ type CommentThread struct {
 // Reviews also include a list of build-and-test status reports. Those
 // correspond to either the current commit in the review ref (for pending
 // reviews), or to the last commented-upon commit (for submitted reviews).
+//
+// The Archived field indicates that the review request was read from the
+// archive ref rather than from the ref holding active reviews.
+//
+// The SignatureStatus field describes the signature on the review request,
+// and is only set once signatures have been verified.
+//
+// The Incomplete field indicates that the repository is a shallow clone
+// which lacks the history needed to tell whether the review was submitted.
+//
+// The Abandoned field indicates that the review was closed without having
+// been submitted.
+//
+// The Threads field counts the discussion threads by their resolution.
+//
+// The History field holds the earlier versions of the review request, oldest
+// first, since updating a request appends a new version of it.
+//
+// The Attention field lists the users whose turn it is to act on an open
+// review: the reviewers once the requester has posted a revision, and the
+// requester once a reviewer has commented.
+//
+// The Overdue field is only set when the review is formatted as JSON, since it
+// depends on the current time. The Repository field is only set by listings
+// that span several repositories, to the path of the one holding the review.
 type Review struct {
-	Revision  string          `json:"revision"`
-	Request   request.Request `json:"request"`
-	Comments  []CommentThread `json:"comments,omitempty"`
-	Resolved  *bool           `json:"resolved,omitempty"`
-	Submitted bool            `json:"submitted"`
-	Reports   []ci.Report     `json:"reports,omitempty"`
+	Revision        string            `json:"revision"`
+	Request         request.Request   `json:"request"`
+	Comments        []CommentThread   `json:"comments,omitempty"`
+	Resolved        *bool             `json:"resolved,omitempty"`
+	Submitted       bool              `json:"submitted"`
+	Incomplete      bool              `json:"incomplete,omitempty"`
+	Archived        bool              `json:"archived,omitempty"`
+	Abandoned       bool              `json:"abandoned,omitempty"`
+	Threads         ThreadCounts      `json:"threads"`
+	Reports         []ci.Report       `json:"reports,omitempty"`
+	Analyses        []analyses.Report `json:"analyses,omitempty"`
+	SignatureStatus gpg.Status        `json:"signatureStatus,omitempty"`
+
+	History    []request.Request `json:"history,omitempty"`
+	Attention  []string          `json:"attention,omitempty"`
+	Overdue    bool              `json:"overdue,omitempty"`
+	Repository string            `json:"repository,omitempty"`
+
+	// activity is the time of the latest activity, for reviews built from a
+	// Summary, which do not have their comments.
+	activity time.Time
 }
 
-type byTimestamp []CommentThread
+type byClock []CommentThread
 
-// Interface methods for sorting comment threads by timestamp
-func (threads byTimestamp) Len() int      { return len(threads) }
-func (threads byTimestamp) Swap(i, j int) { threads[i], threads[j] = threads[j], threads[i] }
-func (threads byTimestamp) Less(i, j int) bool {
-	return threads[i].Comment.Timestamp < threads[j].Comment.Timestamp
+// Interface methods for sorting comment threads by their clocks, falling back to their timestamps
+func (threads byClock) Len() int      { return len(threads) }
+func (threads byClock) Swap(i, j int) { threads[i], threads[j] = threads[j], threads[i] }
+func (threads byClock) Less(i, j int) bool {
+	return commentBefore(threads[i].Comment, threads[j].Comment)
 }
 
 // updateThreadsStatus calculates the aggregate status of a sequence of comment threads.
@@ -90,10 +147,11 @@ func (threads byTimestamp) Less(i, j int) bool {
 //
 // This has the side-effect of setting the "Resolved" field of all descendant comment threads.
 func updateThreadsStatus(threads []CommentThread) *bool {
-	sort.Sort(byTimestamp(threads))
+	sort.Sort(byClock(threads))
 	noUnresolved := true
 	var result *bool
-	for _, thread := range threads {
+	for i := range threads {
+		thread := &threads[i]
 		thread.updateResolvedStatus()
 		if thread.Resolved != nil {
 			noUnresolved = noUnresolved && *thread.Resolved
@@ -129,6 +187,8 @@ func (thread *CommentThread) updateResolvedStatus() {
 type mutableThread struct {
 	Hash     string
 	Comment  comment.Comment
+	History  []comment.Comment
+	Acks     []comment.Comment
 	Children []*mutableThread
 }
 
@@ -143,17 +203,56 @@ func fixMutableThread(mutableThread *mutableThread) CommentThread {
 	return CommentThread{
 		Hash:     mutableThread.Hash,
 		Comment:  mutableThread.Comment,
+		History:  mutableThread.History,
+		Acks:     mutableThread.Acks,
 		Children: children,
 	}
 }
 
+// applyAmendment edits or retracts the comment of a thread, as long as the amendment was made by its author.
+//
+// A retracted comment cannot be edited any further.
+func (thread *mutableThread) applyAmendment(amendment comment.Comment) {
+	if amendment.Author != thread.Comment.Author || thread.Comment.Retracted {
+		return
+	}
+	if thread.History == nil {
+		thread.History = []comment.Comment{thread.Comment}
+	}
+	thread.History = append(thread.History, amendment)
+	if amendment.Retracted {
+		thread.Comment.Retracted = true
+		thread.Comment.Description = ""
+		thread.Comment.Resolved = nil
+		thread.Comment.Mentions = nil
+	} else {
+		thread.Comment.Description = amendment.Description
+		thread.Comment.Mentions = amendment.Mentions
+	}
+}
+
 // This function builds the comment thread tree from the log-based list of comments.
 //
 // Since the comments can be processed in any order, this uses an internal mutable
 // data structure, and then converts it to the proper CommentThread structure at the end.
-func buildCommentThreads(commentsByHash map[string]comment.Comment) []CommentThread {
+func buildCommentThreads(commentsByHash map[string]comment.Comment, aliases map[string]string) []CommentThread {
+	resolve := func(hash string) string {
+		if original, ok := aliases[hash]; ok {
+			return original
+		}
+		return hash
+	}
 	threadsByHash := make(map[string]*mutableThread)
+	var amendments, acks []CommentThread
 	for hash, comment := range commentsByHash {
+		if comment.Original != "" {
+			amendments = append(amendments, CommentThread{Hash: hash, Comment: comment})
+			continue
+		}
+		if comment.Ack != "" && comment.Parent != "" {
+			acks = append(acks, CommentThread{Hash: hash, Comment: comment})
+			continue
+		}
 		thread, ok := threadsByHash[hash]
 		if !ok {
 			thread = &mutableThread{
@@ -163,12 +262,24 @@ func buildCommentThreads(commentsByHash map[string]comment.Comment) []CommentThr
 			threadsByHash[hash] = thread
 		}
 	}
+	sort.Sort(byClock(amendments))
+	for _, amendment := range amendments {
+		if thread, ok := threadsByHash[resolve(amendment.Comment.Original)]; ok {
+			thread.applyAmendment(amendment.Comment)
+		}
+	}
+	sort.Sort(byClock(acks))
+	for _, ack := range acks {
+		if thread, ok := threadsByHash[resolve(ack.Comment.Parent)]; ok {
+			thread.Acks = append(thread.Acks, ack.Comment)
+		}
+	}
 	var rootHashes []string
 	for hash, thread := range threadsByHash {
 		if thread.Comment.Parent == "" {
 			rootHashes = append(rootHashes, hash)
 		} else {
-			parent, ok := threadsByHash[thread.Comment.Parent]
+			parent, ok := threadsByHash[resolve(thread.Comment.Parent)]
 			if ok {
 				parent.Children = append(parent.Children, thread)
 			}
@@ -181,52 +292,249 @@ func buildCommentThreads(commentsByHash map[string]comment.Comment) []CommentThr
 	return threads
 }
 
-// loadComments reads in the log-structured sequence of comments for a review,
+// loadComments parses the log-structured sequence of comments for a review,
 // and then builds the corresponding tree-structured comment threads.
-func (r *Review) loadComments() []CommentThread {
-	commentNotes := repository.GetNotes(comment.Ref, r.Revision)
-	commentsByHash := comment.ParseAllValid(commentNotes)
-	return buildCommentThreads(commentsByHash)
+func loadComments(commentNotes []repository.Note) []CommentThread {
+	commentsByHash, aliases := comment.ParseAllUnique(commentNotes)
+	return buildCommentThreads(commentsByHash, aliases)
 }
 
-// Get returns the specified code review.
+// latestRequest returns the most recent of the given (non-empty) list of
+// requests, along with the earlier versions of it, oldest first.
 //
-// If no review request exists, the returned review is nil.
-func Get(revision string) *Review {
-	requestNotes := repository.GetNotes(request.Ref, revision)
+// The requests are ordered by their clocks, falling back to their timestamps,
+// and when those are equal, later entries in the list win.
+func latestRequest(requests []request.Request) (request.Request, []request.Request) {
+	sorted := append([]request.Request(nil), requests...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return requestBefore(sorted[i], sorted[j])
+	})
+	last := len(sorted) - 1
+	return sorted[last], sorted[:last]
+}
+
+// getFromRef returns the code review whose request is stored in the given notes ref.
+//
+// If no review request exists in that ref, the returned review is nil.
+func getFromRef(requestRef, revision string) *Review {
+	requestNotes := repository.GetNotes(requestRef, revision)
+	if len(requestNotes) == 0 {
+		return nil
+	}
+	return buildReview(revision, requestNotes, repository.GetNotes(comment.Ref, revision))
+}
+
+// buildReview returns the code review for the given revision with the given request and comment notes.
+//
+// If none of the notes are valid review requests, the returned review is nil.
+func buildReview(revision string, requestNotes, commentNotes []repository.Note) *Review {
 	requests := request.ParseAllValid(requestNotes)
 	if requests == nil {
 		return nil
 	}
-	review := Review{
-		Revision: revision,
-		Request:  requests[len(requests)-1],
-	}
-	review.Comments = review.loadComments()
-	review.Resolved = updateThreadsStatus(review.Comments)
-	review.Submitted = repository.IsAncestor(revision, review.Request.TargetRef)
+	review := Review{Revision: revision}
+	review.Request, review.History = latestRequest(requests)
+	review.Comments = loadComments(commentNotes)
+	updateThreadsStatus(review.Comments)
+	review.Resolved = aggregateVotes(review.Comments)
+	review.Threads = countThreads(review.Comments)
+	latest := make(map[string]time.Time)
+	latestByAuthor(review.Comments, latest)
+	review.updateStatus(latest)
 	// TODO(ojarjur): Optionally fetch the CI status of the last commit
 	// in the review for which there are comments.
 	return &review
 }
 
-// ListAll returns all reviews stored in the git-notes.
-func ListAll() []Review {
-	var reviews []Review
-	for _, revision := range repository.ListNotedRevisions(request.Ref) {
-		review := Get(revision)
-		if review != nil {
-			reviews = append(reviews, *review)
+// updateStatus sets whether the review has been submitted or abandoned and,
+// if it is still open, whose turn it is to act on it, given the time of each
+// user's most recent activity on the review.
+func (review *Review) updateStatus(latest map[string]time.Time) {
+	var submitted bool
+	var err error
+	if review.Request.Reopened {
+		// The review's commits were already merged once, so only a later submission counts.
+		if review.Request.SubmittedAs != "" {
+			submitted, err = repository.CheckAncestor(review.Request.SubmittedAs, review.Request.TargetRef)
 		}
+	} else {
+		submitted, err = repository.CheckAncestor(review.Revision, review.Request.TargetRef)
+		// Rebased and squashed reviews are incorporated into the target by different commits.
+		for _, other := range []string{review.Request.Alias, review.Request.SubmittedAs} {
+			if !submitted && err == nil && other != "" {
+				submitted, err = repository.CheckAncestor(other, review.Request.TargetRef)
+			}
+		}
+	}
+	review.Submitted = submitted
+	review.Incomplete = err == repository.ErrShallowHistory
+	review.Abandoned = review.Request.Abandoned && !submitted
+	if !review.IsClosed() {
+		// The review ref may not exist locally, in which case only the notes are considered.
+		revisionTime, _ := repository.GetCommitTime(review.Request.ReviewRef)
+		review.Attention = attentionSet(review, revisionTime, latest)
+	}
+}
+
+// Get returns the specified code review.
+//
+// Active reviews are checked first, followed by archived ones. If no review
+// request exists in either, the returned review is nil.
+func Get(revision string) *Review {
+	return getCached(revision, loadReview)
+}
+
+// loadReview returns the specified code review, reading it from the notes.
+func loadReview(revision string) *Review {
+	if review := getFromRef(request.Ref, revision); review != nil {
+		return review
+	}
+	review := getFromRef(request.ArchiveRef, revision)
+	if review != nil {
+		review.Archived = true
+	}
+	return review
+}
+
+// loadWorkers is the number of reviews that are built concurrently, as each one runs several git commands.
+var loadWorkers = 2 * runtime.NumCPU()
+
+// pendingReview is a review whose request notes have been read, and which is being built by a worker.
+type pendingReview struct {
+	revision string
+	notes    []repository.Note
+	result   chan *Review
+}
+
+// loadEachFromRef calls the given function on each review whose request is stored in the given notes ref.
+//
+// The request notes are read in order, along with all of the comment notes,
+// while a bounded pool of workers builds the reviews from them using build
+// (such as buildReview), and f is called on the reviews in the order of their notes.
+func loadEachFromRef(requestRef string, build func(revision string, requestNotes, commentNotes []repository.Note) *Review, f func(Review) error) error {
+	commentNotes, err := repository.GetAllNotes(comment.Ref)
+	if err != nil {
+		return err
+	}
+	jobs := make(chan pendingReview, loadWorkers)
+	ordered := make(chan pendingReview, loadWorkers)
+	stop := make(chan struct{})
+	for i := 0; i < loadWorkers; i++ {
+		go func() {
+			for job := range jobs {
+				job.result <- build(job.revision, job.notes, commentNotes[job.revision])
+			}
+		}()
+	}
+
+	readErr := make(chan error, 1)
+	go func() {
+		defer close(jobs)
+		defer close(ordered)
+		var current *pendingReview
+		flush := func() error {
+			if current == nil {
+				return nil
+			}
+			job := *current
+			current = nil
+			select {
+			case ordered <- job:
+			case <-stop:
+				return repository.ErrStopIteration
+			}
+			jobs <- job
+			return nil
+		}
+		err := repository.ForEachNote(requestRef, func(noteRevision string, note repository.Note) error {
+			if current == nil || noteRevision != current.revision {
+				if err := flush(); err != nil {
+					return err
+				}
+				current = &pendingReview{revision: noteRevision, result: make(chan *Review, 1)}
+			}
+			current.notes = append(current.notes, note)
+			return nil
+		})
+		if err == nil {
+			err = flush()
+		}
+		readErr <- err
+	}()
+
+	var callErr error
+	for job := range ordered {
+		if callErr != nil {
+			continue
+		}
+		review := <-job.result
+		if review == nil {
+			continue
+		}
+		if requestRef == request.ArchiveRef {
+			review.Archived = true
+		}
+		if callErr = f(*review); callErr != nil {
+			close(stop)
+		}
+	}
+	err = <-readErr
+	if callErr != nil {
+		if callErr == repository.ErrStopIteration {
+			return nil
+		}
+		return callErr
+	}
+	if err == repository.ErrStopIteration {
+		return nil
+	}
+	return err
+}
+
+// ForEach calls the given function on each review stored in the git-notes, excluding archived reviews.
+//
+// Reviews are loaded a few at a time, so returning repository.ErrStopIteration
+// from the function avoids loading most of the remaining reviews. Any other
+// error stops the iteration and is returned.
+func ForEach(f func(Review) error) error {
+	return forEachFromRef(request.Ref, f)
+}
+
+// ForEachArchived calls the given function on each review that has been moved to the archive.
+//
+// It stops early in the same way as ForEach.
+func ForEachArchived(f func(Review) error) error {
+	return forEachFromRef(request.ArchiveRef, f)
+}
+
+// listFromRef returns all reviews whose requests are stored in the given notes ref.
+func listFromRef(requestRef string) []Review {
+	var reviews []Review
+	err := forEachFromRef(requestRef, func(review Review) error {
+		reviews = append(reviews, review)
+		return nil
+	})
+	if err != nil {
+		log.Fatal(err)
 	}
 	return reviews
 }
 
-// ListOpen returns all reviews that are not yet incorporated into their target refs.
+// ListAll returns all reviews stored in the git-notes, excluding archived reviews.
+func ListAll() []Review {
+	return listFromRef(request.Ref)
+}
+
+// ListArchived returns all of the reviews that have been moved to the archive.
+func ListArchived() []Review {
+	return listFromRef(request.ArchiveRef)
+}
+
+// ListOpen returns all reviews that are neither incorporated into their target refs nor abandoned.
 func ListOpen() []Review {
 	var openReviews []Review
 	for _, review := range ListAll() {
-		if !review.Submitted {
+		if !review.IsClosed() {
 			openReviews = append(openReviews, review)
 		}
 	}
@@ -252,22 +560,334 @@ func GetCurrent() (*Review, error) {
 		return nil, fmt.Errorf("There are %d open reviews for the ref \"%s\"", len(matchingReviews), reviewRef)
 	}
 	r := &matchingReviews[0]
-	reports := ci.ParseAllValid(repository.GetNotes(ci.Ref, currentCommit))
-	r.Reports = reports
+	r.Reports = ci.ParseAllValid(repository.GetNotes(ci.Ref, currentCommit))
+	r.Analyses = analyses.ParseAllValid(repository.GetNotes(analyses.Ref, currentCommit))
 	return r, nil
 }
 
+// LoadReports loads the CI and analysis reports for the current commit of the review ref.
+//
+// If the review ref does not exist, then no reports are loaded.
+func (r *Review) LoadReports() {
+	if commit, err := repository.ResolveCommit(r.Request.ReviewRef); err == nil {
+		r.Reports = ci.ParseAllValid(repository.GetNotes(ci.Ref, commit))
+		r.Analyses = analyses.ParseAllValid(repository.GetNotes(analyses.Ref, commit))
+	}
+}
+
 // PrintSummary prints a single-line summary of a review.
 func (r *Review) PrintSummary() {
-	statusString := "pending"
+	statusString := colorize("pending", "pending")
 	if r.Resolved != nil {
 		if *r.Resolved {
-			statusString = "accepted"
+			statusString = colorize("accepted", "accepted")
 		} else {
-			statusString = "rejected"
+			statusString = colorize("rejected", "rejected")
+		}
+	}
+	if r.Abandoned {
+		statusString += ", " + colorize("abandoned", "abandoned")
+	}
+	if r.Archived {
+		statusString += ", archived"
+	}
+	if r.Incomplete {
+		statusString += ", submission unknown"
+	}
+	if r.Request.Priority != "" {
+		statusString += ", " + r.Request.Priority
+	}
+	if r.Request.Due != "" {
+		statusString += ", due " + r.Request.Due
+	}
+	if len(r.Request.Labels) > 0 {
+		statusString += ", labels: " + strings.Join(r.Request.Labels, " ")
+	}
+	if r.Request.Milestone != "" {
+		statusString += ", milestone " + r.Request.Milestone
+	}
+	if r.IsOverdue(time.Now()) {
+		statusString += ", " + colorize("overdue", "OVERDUE")
+	}
+	if len(r.Attention) > 0 {
+		statusString += ", waiting on " + strings.Join(r.Attention, " ")
+	}
+	if r.SignatureStatus != "" {
+		statusString += ", signature: " + string(r.SignatureStatus)
+	}
+	fmt.Printf(reviewTemplate, statusString, colorize("hash", r.Revision), formatText(r.Request.Description))
+	r.printSubmoduleChanges()
+}
+
+// FirstCommit returns the current first commit of the review, which differs
+// from the commit the review is attached to if the review has been rebased.
+func (r *Review) FirstCommit() string {
+	if r.Request.Alias != "" {
+		return r.Request.Alias
+	}
+	return r.Revision
+}
+
+// HeadCommit returns the latest commit of the review.
+//
+// The review ref may not exist locally (e.g. when the review was found by its
+// hash in a clone that only fetched the notes), in which case the matching
+// remote-tracking branches are tried, followed by the review's first commit.
+func (r *Review) HeadCommit() (string, error) {
+	if commit, err := repository.ResolveCommit(r.Request.ReviewRef); err == nil {
+		return commit, nil
+	}
+	if branch := strings.TrimPrefix(r.Request.ReviewRef, "refs/heads/"); branch != r.Request.ReviewRef {
+		for _, remote := range repository.ListRemotes() {
+			if commit, err := repository.ResolveCommit("refs/remotes/" + remote + "/" + branch); err == nil {
+				return commit, nil
+			}
 		}
 	}
-	fmt.Printf(reviewTemplate, statusString, r.Revision, r.Request.Description)
+	if commit, err := repository.ResolveCommit(r.FirstCommit()); err == nil {
+		return commit, nil
+	}
+	return "", fmt.Errorf("Unable to find the commits of the review %s, as neither %q nor %s exist locally", r.Revision, r.Request.ReviewRef, r.FirstCommit())
+}
+
+// diffRange returns the commits between which the changes under review were made.
+func (r *Review) diffRange() (string, string, error) {
+	from, err := repository.ResolveCommit(r.FirstCommit() + "^")
+	if err != nil {
+		return "", "", err
+	}
+	to, err := repository.ResolveCommit(r.Request.ReviewRef)
+	if err != nil {
+		return "", "", err
+	}
+	return from, to, nil
+}
+
+// Commits returns the commits under review, oldest first.
+//
+// If those cannot be determined (e.g. because the review ref has been
+// deleted), then only the first commit is returned.
+func (r *Review) Commits() []string {
+	from, to, err := r.diffRange()
+	if err != nil {
+		return []string{r.Revision}
+	}
+	commits := repository.ListCommitsBetween(from, to)
+	if commits == nil {
+		return []string{r.Revision}
+	}
+	return commits
+}
+
+// ChangedFiles returns the paths of the files changed by the review.
+func (r *Review) ChangedFiles() ([]string, error) {
+	from, to, err := r.diffRange()
+	if err != nil {
+		return nil, fmt.Errorf("Cannot determine the changes under review: %v", err)
+	}
+	return repository.ListChangedFiles(from, to)
+}
+
+// GetDiff returns the diff of the changes under review.
+func (r *Review) GetDiff() (string, error) {
+	from, to, err := r.diffRange()
+	if err != nil {
+		return "", fmt.Errorf("Cannot determine the changes under review: %v", err)
+	}
+	return repository.GetDiff(from, to)
+}
+
+// printSubmoduleChanges prints the submodules whose pointers are changed by the review, if any.
+//
+// Nothing is printed if the changes under review cannot be determined (e.g.
+// because the review ref has been deleted since the review was submitted).
+func (r *Review) printSubmoduleChanges() {
+	from, to, err := r.diffRange()
+	if err != nil {
+		return
+	}
+	changes, err := repository.ListSubmoduleChanges(from, to)
+	if err != nil {
+		return
+	}
+	for _, change := range changes {
+		switch {
+		case change.OldCommit == "":
+			fmt.Printf(submoduleTemplate, change.Path, "added at "+abbreviate(change.NewCommit))
+		case change.NewCommit == "":
+			fmt.Printf(submoduleTemplate, change.Path, "removed")
+		default:
+			description := abbreviate(change.OldCommit) + ".." + abbreviate(change.NewCommit)
+			if commits, err := repository.ListSubmoduleCommits(change); err == nil {
+				description += fmt.Sprintf(" (%d commits)", len(commits))
+			}
+			fmt.Printf(submoduleTemplate, change.Path, description)
+		}
+	}
+}
+
+// abbreviate shortens a commit hash for display.
+func abbreviate(commit string) string {
+	if len(commit) > 7 {
+		return commit[:7]
+	}
+	return commit
+}
+
+// parseTimestamp parses a timestamp string of the form "0123456789".
+func parseTimestamp(timestamp string) (time.Time, error) {
+	parsedTimestamp, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(parsedTimestamp, 0), nil
+}
+
+// lastThreadActivity returns the latest timestamp of any comment in the given threads.
+func lastThreadActivity(threads []CommentThread) time.Time {
+	var latest time.Time
+	for _, thread := range threads {
+		if t, err := parseTimestamp(thread.Comment.Timestamp); err == nil && t.After(latest) {
+			latest = t
+		}
+		if t := lastThreadActivity(thread.Children); t.After(latest) {
+			latest = t
+		}
+	}
+	return latest
+}
+
+// LastActivity returns the time of the most recent request or comment in the review.
+//
+// Timestamps that are not in the format we expect are ignored, so the zero
+// time is returned if none of them can be parsed.
+func (r *Review) LastActivity() time.Time {
+	if !r.activity.IsZero() {
+		return r.activity
+	}
+	latest := lastThreadActivity(r.Comments)
+	if t, err := parseTimestamp(r.Request.Timestamp); err == nil && t.After(latest) {
+		latest = t
+	}
+	return latest
+}
+
+// IsStale reports whether the review is open, but has had no activity since the given time.
+func (r *Review) IsStale(idleSince time.Time) bool {
+	return !r.IsClosed() && r.LastActivity().Before(idleSince)
+}
+
+// latestVotes returns the most recent vote of each user on the given comment threads.
+//
+// Votes are the resolved bits of top-level comments, since replies use that
+// bit to mark the parent comment as addressed rather than to judge the change.
+// Suggestions and nits are only informational, so they are not votes either.
+func latestVotes(threads []CommentThread) map[string]comment.Comment {
+	votes := make(map[string]comment.Comment)
+	for _, thread := range threads {
+		c := thread.Comment
+		if c.Resolved != nil && !isInformational(c) {
+			if previous, ok := votes[c.Author]; !ok || !commentBefore(c, previous) {
+				votes[c.Author] = c
+			}
+		}
+	}
+	return votes
+}
+
+// aggregateVotes calculates the status of a review from the latest vote of each user.
+//
+// The review is rejected if anyone's latest vote is to reject it, accepted if
+// there are votes and all of them accept it, and pending if there are no votes.
+func aggregateVotes(threads []CommentThread) *bool {
+	var result *bool
+	for _, vote := range latestVotes(threads) {
+		accepted := *vote.Resolved
+		if !accepted {
+			return &accepted
+		}
+		result = &accepted
+	}
+	return result
+}
+
+// votersWithVote returns the sorted list of users whose most recent vote on the review matches the given one.
+func (r *Review) votersWithVote(accepted bool) []string {
+	var voters []string
+	for author, vote := range latestVotes(r.Comments) {
+		if *vote.Resolved == accepted {
+			voters = append(voters, author)
+		}
+	}
+	sort.Strings(voters)
+	return voters
+}
+
+// ApprovedCommit returns the commit that the latest of the current votes to
+// accept the review was made on.
+//
+// This is empty unless the review is accepted, so an approval that has been
+// retracted, or that is outweighed by a later rejection, does not count. Votes
+// that do not name a commit approve the review's latest commit.
+func (r *Review) ApprovedCommit() string {
+	var latest *comment.Comment
+	for _, vote := range latestVotes(r.Comments) {
+		if !*vote.Resolved {
+			return ""
+		}
+		if latest == nil || commentBefore(*latest, vote) {
+			accepted := vote
+			latest = &accepted
+		}
+	}
+	if latest == nil {
+		return ""
+	}
+	if latest.Location != nil && latest.Location.Commit != "" {
+		return latest.Location.Commit
+	}
+	head, err := r.HeadCommit()
+	if err != nil {
+		return ""
+	}
+	return head
+}
+
+// Approvers returns the sorted list of users whose most recent vote on the review was to accept it.
+func (r *Review) Approvers() []string {
+	return r.votersWithVote(true)
+}
+
+// Rejecters returns the sorted list of users whose most recent vote on the review was to reject it.
+func (r *Review) Rejecters() []string {
+	return r.votersWithVote(false)
+}
+
+// Archive moves the review's request out of the ref holding active reviews and into the archive.
+//
+// The comments on the review are left in place, as those are keyed by the
+// same revision and will still be found when the archived review is loaded.
+func (r *Review) Archive() {
+	if r.Archived {
+		return
+	}
+	for _, note := range repository.GetNotes(request.Ref, r.Revision) {
+		repository.AppendNote(request.ArchiveRef, r.Revision, note)
+	}
+	repository.RemoveNotes(request.Ref, r.Revision)
+	r.Archived = true
+}
+
+// Unarchive moves the review's request out of the archive and back into the ref holding active reviews.
+func (r *Review) Unarchive() {
+	if !r.Archived {
+		return
+	}
+	for _, note := range repository.GetNotes(request.ArchiveRef, r.Revision) {
+		repository.AppendNote(request.Ref, r.Revision, note)
+	}
+	repository.RemoveNotes(request.ArchiveRef, r.Revision)
+	r.Archived = false
 }
 
 // reformatTimestamp takes a timestamp string of the form "0123456789" and changes it
@@ -275,35 +895,68 @@ func (r *Review) PrintSummary() {
 //
 // Timestamps that are not in the format we expect are left alone.
 func reformatTimestamp(timestamp string) string {
-	parsedTimestamp, err := strconv.ParseInt(timestamp, 10, 64)
+	t, err := parseTimestamp(timestamp)
 	if err != nil {
 		// The timestamp is an unexpected format, so leave it alone
 		return timestamp
 	}
-	t := time.Unix(parsedTimestamp, 0)
 	return t.Format(time.UnixDate)
 }
 
 // showThread prints the given comment thread, indented by the given prefix string.
 func showThread(thread CommentThread, indent string) error {
 	comment := thread.Comment
-	threadHash, err := comment.Hash()
-	if err != nil {
-		return err
+	threadHash := thread.Hash
+	if threadHash == "" {
+		var err error
+		if threadHash, err = comment.Hash(); err != nil {
+			return err
+		}
 	}
 
 	timestamp := reformatTimestamp(comment.Timestamp)
 	statusString := "fyi"
 	if comment.Resolved != nil {
 		if *comment.Resolved {
-			statusString = "lgtm"
+			statusString = colorize("accepted", "lgtm")
 		} else {
-			statusString = "needs work"
+			statusString = colorize("rejected", "needs work")
 		}
 	}
+	if comment.Severity != "" {
+		statusString += ", " + comment.Severity
+	}
+	if comment.Retracted {
+		statusString = "retracted"
+	} else if thread.History != nil {
+		statusString += ", edited"
+	}
+	if thread.SignatureStatus != "" {
+		statusString += ", signature: " + string(thread.SignatureStatus)
+	}
 
-	threadDetails := fmt.Sprintf(commentTemplate, timestamp, threadHash, comment.Author, statusString, comment.Description)
+	threadHeader := colorize("hash", threadHash)
+	if location := comment.Location; location != nil && location.CommitMessage {
+		threadHeader += " on the commit message"
+		if location.Range != nil {
+			threadHeader += fmt.Sprintf(", line %d", location.Range.StartLine)
+		}
+	}
+	threadDetails := fmt.Sprintf(commentTemplate, timestamp, threadHeader, colorize("author", comment.Author), statusString, formatText(comment.Description))
 	fmt.Print(indent + strings.Replace(threadDetails, "\n", "\n"+indent, 1))
+	if comment.Suggestion != nil && comment.Location != nil && !comment.Retracted {
+		fmt.Printf("%s  suggested edit of %s:\n", indent, comment.Location.Path)
+		if *comment.Suggestion == "" {
+			fmt.Printf("%s    (delete the lines)\n", indent)
+		} else {
+			for _, line := range strings.Split(*comment.Suggestion, "\n") {
+				fmt.Printf("%s    %s\n", indent, colorize("new", "+"+line))
+			}
+		}
+	}
+	if thread.Acks != nil {
+		fmt.Printf("%s  %s\n", indent, formatAcks(thread.Acks))
+	}
 	for _, child := range thread.Children {
 		err := showThread(child, indent+"  ")
 		if err != nil {
@@ -313,21 +966,61 @@ func showThread(thread CommentThread, indent string) error {
 	return nil
 }
 
+// formatAcks summarizes the acknowledgements of a comment on a single line, e.g. "done (alice), +1 (bob, carol)".
+func formatAcks(acks []comment.Comment) string {
+	var texts []string
+	authors := make(map[string][]string)
+	for _, ack := range acks {
+		if authors[ack.Ack] == nil {
+			texts = append(texts, ack.Ack)
+		}
+		if !containsString(authors[ack.Ack], ack.Author) {
+			authors[ack.Ack] = append(authors[ack.Ack], ack.Author)
+		}
+	}
+	var summaries []string
+	for _, text := range texts {
+		summaries = append(summaries, fmt.Sprintf("%s (%s)", text, strings.Join(authors[text], ", ")))
+	}
+	return strings.Join(summaries, ", ")
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
 // PrintDetails prints a multi-line overview of a review, including all comments.
 func (r *Review) PrintDetails() error {
 	r.PrintSummary()
+	if len(r.Request.Reviewers) > 0 {
+		fmt.Printf("  reviewers: %s\n", strings.Join(r.Request.Reviewers, ", "))
+	}
+	if r.Threads != (ThreadCounts{}) {
+		fmt.Printf("  threads: %s\n", r.Threads)
+	}
+	r.printDependencies()
+	r.printPolicy()
+	r.printChecklist()
+	r.printHistory()
 	for _, thread := range r.Comments {
 		err := showThread(thread, "  ")
 		if err != nil {
 			return err
 		}
 	}
-	// TODO(ojarjur): If there are CI status reports for the last commit, then show them.
+	r.printChecks()
+	r.printAnalyses()
 	return nil
 }
 
 // PrintJson pretty prints a review (including comments) formatted as JSON.
 func (r *Review) PrintJson() error {
+	r.Overdue = r.IsOverdue(time.Now())
 	jsonBytes, err := json.Marshal(*r)
 	if err != nil {
 		return err
@@ -341,8 +1034,254 @@ func (r *Review) PrintJson() error {
 	return nil
 }
 
+// UpdateRequest records a new version of the review request, which supersedes the current one.
+//
+// The timestamp of the new request is set to the current time, and its clock
+// to one after the latest on the review, so that it sorts after the existing
+// requests once notes are merged.
+func (r *Review) UpdateRequest(newRequest request.Request) error {
+	newRequest.Timestamp = strconv.FormatInt(time.Now().Unix(), 10)
+	newRequest.Clock = r.nextClock()
+	newRequest.Signature = ""
+	if gpg.Enabled() {
+		if err := newRequest.Sign(); err != nil {
+			return err
+		}
+	}
+	note, err := newRequest.Write()
+	if err != nil {
+		return err
+	}
+	requestRef := request.Ref
+	if r.Archived {
+		requestRef = request.ArchiveRef
+	}
+	repository.AppendNote(requestRef, r.Revision, note)
+	r.Request = newRequest
+	return nil
+}
+
+// countComments returns the number of comments in the given threads, including replies.
+func countComments(threads []CommentThread) int {
+	count := len(threads)
+	for _, thread := range threads {
+		count += countComments(thread.Children)
+	}
+	return count
+}
+
+// SquashMessage returns the commit message for squashing the review into a single commit.
+//
+// The message is the review description, followed by a summary of the discussion.
+func (r *Review) SquashMessage() string {
+	message := strings.TrimSpace(r.Request.Description) + "\n\n"
+	message += fmt.Sprintf("Squashed from the review of %s.\n", r.Revision)
+	if approvers := r.Approvers(); approvers != nil {
+		message += "Accepted by: " + strings.Join(approvers, ", ") + "\n"
+	}
+	if rejecters := r.Rejecters(); rejecters != nil {
+		message += "Rejected by: " + strings.Join(rejecters, ", ") + "\n"
+	}
+	if len(r.Comments) > 0 {
+		message += fmt.Sprintf("Discussion: %d comments in %d threads.\n", countComments(r.Comments), len(r.Comments))
+	}
+	return message
+}
+
+// IsClosed returns true if the review has either been submitted or abandoned.
+func (r *Review) IsClosed() bool {
+	return r.Submitted || r.Abandoned
+}
+
+// IsOverdue returns true if the review is still open and its due date has passed.
+func (r *Review) IsOverdue(now time.Time) bool {
+	if r.IsClosed() || r.Request.Due == "" {
+		return false
+	}
+	deadline, err := request.ParseDueDate(r.Request.Due)
+	return err == nil && now.After(deadline)
+}
+
+type byUrgency struct {
+	reviews []Review
+	now     time.Time
+}
+
+// Interface methods for sorting reviews by urgency.
+//
+// Overdue reviews come first, followed by the rest in order of priority, then
+// due date (with reviews that have no due date last), then request time.
+func (u byUrgency) Len() int      { return len(u.reviews) }
+func (u byUrgency) Swap(i, j int) { u.reviews[i], u.reviews[j] = u.reviews[j], u.reviews[i] }
+func (u byUrgency) Less(i, j int) bool {
+	left, right := u.reviews[i], u.reviews[j]
+	if leftOverdue, rightOverdue := left.IsOverdue(u.now), right.IsOverdue(u.now); leftOverdue != rightOverdue {
+		return leftOverdue
+	}
+	if leftRank, rightRank := left.Request.PriorityRank(), right.Request.PriorityRank(); leftRank != rightRank {
+		return leftRank < rightRank
+	}
+	if left.Request.Due != right.Request.Due {
+		if left.Request.Due == "" || right.Request.Due == "" {
+			return right.Request.Due == ""
+		}
+		return left.Request.Due < right.Request.Due
+	}
+	return left.Request.Timestamp < right.Request.Timestamp
+}
+
+// SortByUrgency sorts the given reviews so that the ones needing attention soonest come first.
+func SortByUrgency(reviews []Review, now time.Time) {
+	sort.Stable(byUrgency{reviews, now})
+}
+
+// Keys by which reviews can be sorted with Sort.
+const (
+	SortByTime     = "time"
+	SortByActivity = "activity"
+	SortByAuthor   = "author"
+	SortByPriority = "priority"
+)
+
+// SortKeys lists the supported keys for Sort.
+var SortKeys = []string{SortByTime, SortByActivity, SortByAuthor, SortByPriority}
+
+type byRequestTime []Review
+
+// Interface methods for sorting reviews by request time, most recent first.
+func (reviews byRequestTime) Len() int      { return len(reviews) }
+func (reviews byRequestTime) Swap(i, j int) { reviews[i], reviews[j] = reviews[j], reviews[i] }
+func (reviews byRequestTime) Less(i, j int) bool {
+	return reviews[i].Request.Timestamp > reviews[j].Request.Timestamp
+}
+
+type byLastActivity []Review
+
+// Interface methods for sorting reviews by their last activity, most recent first.
+func (reviews byLastActivity) Len() int      { return len(reviews) }
+func (reviews byLastActivity) Swap(i, j int) { reviews[i], reviews[j] = reviews[j], reviews[i] }
+func (reviews byLastActivity) Less(i, j int) bool {
+	return reviews[i].LastActivity().After(reviews[j].LastActivity())
+}
+
+type byAuthor []Review
+
+// Interface methods for sorting reviews alphabetically by requester, and then by request time.
+func (reviews byAuthor) Len() int      { return len(reviews) }
+func (reviews byAuthor) Swap(i, j int) { reviews[i], reviews[j] = reviews[j], reviews[i] }
+func (reviews byAuthor) Less(i, j int) bool {
+	if reviews[i].Request.Requester != reviews[j].Request.Requester {
+		return reviews[i].Request.Requester < reviews[j].Request.Requester
+	}
+	return byRequestTime(reviews).Less(i, j)
+}
+
+type byPriority []Review
+
+// Interface methods for sorting reviews by priority, most urgent first, and then by request time.
+func (reviews byPriority) Len() int      { return len(reviews) }
+func (reviews byPriority) Swap(i, j int) { reviews[i], reviews[j] = reviews[j], reviews[i] }
+func (reviews byPriority) Less(i, j int) bool {
+	leftRank, rightRank := reviews[i].Request.PriorityRank(), reviews[j].Request.PriorityRank()
+	if leftRank != rightRank {
+		return leftRank < rightRank
+	}
+	return byRequestTime(reviews).Less(i, j)
+}
+
+// Sort sorts the given reviews by one of the keys in SortKeys.
+func Sort(reviews []Review, key string) error {
+	switch key {
+	case SortByTime:
+		sort.Stable(byRequestTime(reviews))
+	case SortByActivity:
+		sort.Stable(byLastActivity(reviews))
+	case SortByAuthor:
+		sort.Stable(byAuthor(reviews))
+	case SortByPriority:
+		sort.Stable(byPriority(reviews))
+	default:
+		return fmt.Errorf("Unknown sort key %q; it must be one of %s", key, strings.Join(SortKeys, ", "))
+	}
+	return nil
+}
+
+// verifyThreadSignatures sets the signature status of every comment in the given threads.
+func verifyThreadSignatures(threads []CommentThread) {
+	for i := range threads {
+		if threads[i].History == nil {
+			threads[i].SignatureStatus = threads[i].Comment.VerifySignature()
+		} else {
+			// The current version of an edited comment was never signed as such,
+			// so the original comment and every amendment are checked instead.
+			threads[i].SignatureStatus = gpg.StatusGood
+			for _, version := range threads[i].History {
+				if status := version.VerifySignature(); status != gpg.StatusGood {
+					threads[i].SignatureStatus = status
+					break
+				}
+			}
+		}
+		verifyThreadSignatures(threads[i].Children)
+	}
+}
+
+// VerifySignatures checks the signatures on the review request and all of its comments.
+func (r *Review) VerifySignatures() {
+	r.SignatureStatus = r.Request.VerifySignature()
+	verifyThreadSignatures(r.Comments)
+}
+
+// RequireSignaturesConfig is the git config setting that, when "true", makes
+// accepting and submitting reviews verify the signatures of their commits.
+const RequireSignaturesConfig = "appraise.requireSignatures"
+
+// CheckCommitSignatures returns an error listing the commits of the review that
+// lack a valid signature, if either verify is set or the repository requires
+// signatures. The action ("accepting" or "submitting") is used in the error.
+func (r *Review) CheckCommitSignatures(verify bool, action string) error {
+	if !verify && repository.GetConfig(RequireSignaturesConfig) != "true" {
+		return nil
+	}
+	var unsigned []string
+	for _, commit := range r.Commits() {
+		if err := repository.VerifyCommit(commit); err != nil {
+			unsigned = append(unsigned, "  "+commit+" "+strings.SplitN(repository.GetCommitMessage(commit), "\n", 2)[0])
+		}
+	}
+	if len(unsigned) > 0 {
+		return fmt.Errorf("Not %s the review as these commits do not have valid signatures:\n%s", action, strings.Join(unsigned, "\n"))
+	}
+	return nil
+}
+
+// CheckAcceptance returns an error if the given comment accepts the review,
+// but the repository requires signatures that its commits lack.
+//
+// Every way of adding comments to a review must check them with this.
+func (r *Review) CheckAcceptance(c comment.Comment) error {
+	if c.Parent != "" || c.Resolved == nil || !*c.Resolved || isInformational(c) {
+		return nil
+	}
+	return r.CheckCommitSignatures(false, "accepting")
+}
+
 // AddComment adds the given comment to the review.
-func (r *Review) AddComment(c comment.Comment) error {
+//
+// The comment's clock is set to one after the latest on the review, and if
+// the user has enabled note signing, then the comment is signed. Both are set
+// on the given comment, so that its hash matches the note that was written.
+// Comments that accept the review are checked with CheckAcceptance first.
+func (r *Review) AddComment(c *comment.Comment) error {
+	if err := r.CheckAcceptance(*c); err != nil {
+		return err
+	}
+	c.Clock = r.nextClock()
+	if gpg.Enabled() {
+		if err := c.Sign(); err != nil {
+			return err
+		}
+	}
 	commentNote, err := c.Write()
 	if err != nil {
 		return err
@@ -17,9 +17,17 @@ limitations under the License.
 package review
 
 import (
+	"fmt"
 	"sort"
+	"github.com/google/git-appraise/repository"
+	"github.com/google/git-appraise/review/ci"
 	"github.com/google/git-appraise/review/comment"
+	"github.com/google/git-appraise/review/milestone"
+	"github.com/google/git-appraise/review/request"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestCommentSorting(t *testing.T) {
@@ -49,13 +57,13 @@ func TestCommentSorting(t *testing.T) {
 			},
 		},
 	}
-	sort.Sort(byTimestamp(sampleThreads))
+	sort.Sort(byClock(sampleThreads))
 	descriptions := []string{}
 	for _, thread := range sampleThreads {
 		descriptions = append(descriptions, thread.Comment.Description)
 	}
 	if !(descriptions[0] == "First" && descriptions[1] == "Second" && descriptions[2] == "Third" && descriptions[3] == "Fourth") {
-		t.Fatalf("Comment thread ordering failed. Got %s", sampleThreads)
+		t.Fatalf("Comment thread ordering failed. Got %v", sampleThreads)
 	}
 }
 
@@ -507,29 +515,967 @@ func TestBuildCommentThreads(t *testing.T) {
 		childHash: child,
 		leafHash:  leaf,
 	}
-	threads := buildCommentThreads(commentsByHash)
+	threads := buildCommentThreads(commentsByHash, nil)
 	if len(threads) != 1 {
-		t.Fatal("Unexpected threads: %v", threads)
+		t.Fatalf("Unexpected threads: %v", threads)
 	}
 	rootThread := threads[0]
 	if rootThread.Comment.Description != "root" {
-		t.Fatal("Unexpected root thread: %v", rootThread)
+		t.Fatalf("Unexpected root thread: %v", rootThread)
 	}
 	if len(rootThread.Children) != 1 {
-		t.Fatal("Unexpected root children: %v", rootThread.Children)
+		t.Fatalf("Unexpected root children: %v", rootThread.Children)
 	}
 	rootChild := rootThread.Children[0]
 	if rootChild.Comment.Description != "child" {
-		t.Fatal("Unexpected child: %v", rootChild)
+		t.Fatalf("Unexpected child: %v", rootChild)
 	}
 	if len(rootChild.Children) != 1 {
-		t.Fatal("Unexpected leaves: %v", rootChild.Children)
+		t.Fatalf("Unexpected leaves: %v", rootChild.Children)
 	}
 	threadLeaf := rootChild.Children[0]
 	if threadLeaf.Comment.Description != "leaf" {
-		t.Fatal("Unexpected leaf: %v", threadLeaf)
+		t.Fatalf("Unexpected leaf: %v", threadLeaf)
 	}
 	if len(threadLeaf.Children) != 0 {
-		t.Fatal("Unexpected leaf children: %v", threadLeaf.Children)
+		t.Fatalf("Unexpected leaf children: %v", threadLeaf.Children)
+	}
+}
+
+func TestSortByUrgency(t *testing.T) {
+	now := time.Date(2015, time.October, 15, 12, 0, 0, 0, time.Local)
+	reviews := []Review{
+		Review{Revision: "none", Request: request.Request{Timestamp: "0000000001"}},
+		Review{Revision: "p2", Request: request.Request{Timestamp: "0000000002", Priority: "P2"}},
+		Review{Revision: "p0-later", Request: request.Request{Timestamp: "0000000003", Priority: "P0", Due: "2015-11-01"}},
+		Review{Revision: "overdue", Request: request.Request{Timestamp: "0000000004", Priority: "P4", Due: "2015-10-14"}},
+		Review{Revision: "p0-sooner", Request: request.Request{Timestamp: "0000000005", Priority: "P0", Due: "2015-10-20"}},
+		Review{Revision: "due-today", Request: request.Request{Timestamp: "0000000006", Due: "2015-10-15"}},
+		Review{Revision: "submitted", Submitted: true, Request: request.Request{Timestamp: "0000000007", Due: "2015-10-01"}},
+	}
+	SortByUrgency(reviews, now)
+	expected := []string{"overdue", "p0-sooner", "p0-later", "p2", "submitted", "due-today", "none"}
+	for i, r := range reviews {
+		if r.Revision != expected[i] {
+			t.Fatalf("Unexpected order at position %d: got %q, expected %q", i, r.Revision, expected[i])
+		}
+	}
+}
+
+func TestFilterMatches(t *testing.T) {
+	r := Review{
+		Revision:  "abc",
+		Submitted: true,
+		Request: request.Request{
+			Timestamp: "0000001000",
+			Requester: "Alice@example.com",
+			Reviewers: []string{"bob@example.com", "carol@example.com"},
+			TargetRef: "refs/heads/master",
+			Labels:    []string{"security"},
+			Priority:  "P1",
+		},
+	}
+	matching := []Filter{
+		Filter{},
+		Filter{Author: "alice@example.com"},
+		Filter{Reviewer: "carol@example.com"},
+		Filter{Status: StatusSubmitted},
+		Filter{Target: "master"},
+		Filter{Target: "refs/heads/master"},
+		Filter{Since: time.Unix(1000, 0)},
+		Filter{Label: "Security"},
+		Filter{Priority: "P2"},
+		Filter{Priority: "P1"},
+		Filter{Author: "alice@example.com", Reviewer: "bob@example.com", Status: StatusSubmitted, Target: "master"},
+	}
+	for _, f := range matching {
+		if !f.Matches(r) {
+			t.Errorf("Expected the filter %+v to match the review", f)
+		}
+	}
+	nonMatching := []Filter{
+		Filter{Author: "bob@example.com"},
+		Filter{Reviewer: "alice@example.com"},
+		Filter{Status: StatusOpen},
+		Filter{Target: "refs/heads/other"},
+		Filter{Label: "release-blocker"},
+		Filter{Priority: "P0"},
+		Filter{Since: time.Unix(1001, 0)},
+		Filter{Author: "alice@example.com", Status: StatusOpen},
+	}
+	for _, f := range nonMatching {
+		if f.Matches(r) {
+			t.Errorf("Expected the filter %+v not to match the review", f)
+		}
+	}
+	if err := (Filter{Status: "closed"}).Validate(); err == nil {
+		t.Errorf("Expected an unknown status to be rejected")
+	}
+}
+
+func TestSort(t *testing.T) {
+	reviews := []Review{
+		Review{Revision: "b-old", Request: request.Request{Timestamp: "0000000001", Requester: "b", Priority: "P1"}},
+		Review{Revision: "a-new", Request: request.Request{Timestamp: "0000000003", Requester: "a"}},
+		Review{
+			Revision: "b-commented",
+			Request:  request.Request{Timestamp: "0000000002", Requester: "b"},
+			Comments: []CommentThread{CommentThread{Comment: comment.Comment{Timestamp: "0000000005"}}},
+		},
+	}
+	expectedOrders := map[string][]string{
+		SortByTime:     []string{"a-new", "b-commented", "b-old"},
+		SortByActivity: []string{"b-commented", "a-new", "b-old"},
+		SortByAuthor:   []string{"a-new", "b-commented", "b-old"},
+		SortByPriority: []string{"b-old", "a-new", "b-commented"},
+	}
+	for key, expected := range expectedOrders {
+		sorted := append([]Review(nil), reviews...)
+		if err := Sort(sorted, key); err != nil {
+			t.Fatal(err)
+		}
+		for i, r := range sorted {
+			if r.Revision != expected[i] {
+				t.Errorf("Unexpected order for %q at position %d: got %q, expected %q", key, i, r.Revision, expected[i])
+			}
+		}
+	}
+	if err := Sort(reviews, "size"); err == nil {
+		t.Errorf("Expected an unknown sort key to be rejected")
+	}
+}
+
+func TestAggregateVotes(t *testing.T) {
+	accept, reject := true, false
+	vote := func(author, timestamp string, resolved *bool) CommentThread {
+		return CommentThread{Comment: comment.Comment{Author: author, Timestamp: timestamp, Resolved: resolved}}
+	}
+	if status := aggregateVotes([]CommentThread{vote("a", "1", nil)}); status != nil {
+		t.Errorf("Expected no votes to leave the review pending, got %v", *status)
+	}
+	changedMind := []CommentThread{vote("a", "1", &reject), vote("a", "2", &accept), vote("b", "1", &accept)}
+	if status := aggregateVotes(changedMind); status == nil || !*status {
+		t.Errorf("Expected a later acceptance to override an earlier rejection")
+	}
+	oneRejection := []CommentThread{vote("a", "2", &accept), vote("b", "3", &reject)}
+	if status := aggregateVotes(oneRejection); status == nil || *status {
+		t.Errorf("Expected any outstanding rejection to reject the review")
+	}
+	r := Review{Comments: append(changedMind, vote("c", "4", &reject))}
+	if approvers := r.Approvers(); len(approvers) != 2 || approvers[0] != "a" || approvers[1] != "b" {
+		t.Errorf("Unexpected approvers: %v", approvers)
+	}
+	if rejecters := r.Rejecters(); len(rejecters) != 1 || rejecters[0] != "c" {
+		t.Errorf("Unexpected rejecters: %v", rejecters)
+	}
+}
+
+func TestSquashMessage(t *testing.T) {
+	accept := true
+	r := Review{
+		Revision: "abc",
+		Request:  request.Request{Description: "Fix the bug\n"},
+		Comments: []CommentThread{
+			CommentThread{
+				Comment:  comment.Comment{Author: "a", Timestamp: "1", Resolved: &accept},
+				Children: []CommentThread{CommentThread{Comment: comment.Comment{Author: "b", Timestamp: "2"}}},
+			},
+		},
+	}
+	expected := "Fix the bug\n\nSquashed from the review of abc.\nAccepted by: a\nDiscussion: 2 comments in 1 threads.\n"
+	if message := r.SquashMessage(); message != expected {
+		t.Errorf("Unexpected squash message: %q", message)
+	}
+}
+
+func TestUpdateThreadsStatusSetsTopLevelThreads(t *testing.T) {
+	rejected := false
+	threads := []CommentThread{CommentThread{Comment: comment.Comment{Timestamp: "1", Resolved: &rejected}}}
+	updateThreadsStatus(threads)
+	threads[0].validateRejected(t)
+}
+
+func TestBuildDashboard(t *testing.T) {
+	reject := false
+	me := "me@example.com"
+	thread := func(author string, resolved *bool) CommentThread {
+		return CommentThread{Comment: comment.Comment{Author: author, Resolved: resolved}, Resolved: resolved}
+	}
+	reviews := []Review{
+		Review{Revision: "mine-waiting", Request: request.Request{Requester: me, Reviewers: []string{"a"}}},
+		Review{
+			Revision: "mine-rejected",
+			Request:  request.Request{Requester: me, Reviewers: []string{"a"}},
+			Comments: []CommentThread{thread("a", &reject)},
+			Resolved: &reject,
+		},
+		Review{Revision: "mine-submitted", Submitted: true, Request: request.Request{Requester: me}},
+		Review{Revision: "asked", Request: request.Request{Requester: "a", Reviewers: []string{me}}},
+		Review{
+			Revision: "answered",
+			Request:  request.Request{Requester: "a", Reviewers: []string{me}},
+			Comments: []CommentThread{thread(me, nil)},
+		},
+		Review{
+			Revision: "blocked",
+			Request:  request.Request{Requester: "a"},
+			Comments: []CommentThread{thread(me, &reject)},
+			Resolved: &reject,
+		},
+		Review{
+			Revision: "late",
+			Request:  request.Request{Requester: "a", Due: "2000-01-01"},
+			Comments: []CommentThread{thread(me, nil)},
+		},
+		Review{Revision: "late-unrelated", Request: request.Request{Requester: "a", Due: "2000-01-01"}},
+	}
+	dashboard := BuildDashboard(reviews, me, time.Date(2000, 1, 3, 0, 0, 0, 0, time.UTC))
+	revisions := func(reviews []Review) []string {
+		var result []string
+		for _, r := range reviews {
+			result = append(result, r.Revision)
+		}
+		return result
+	}
+	expected := map[string][]string{
+		"authored":  []string{"mine-waiting"},
+		"requested": []string{"asked"},
+		"blocking":  []string{"blocked"},
+		"overdue":   []string{"late"},
+	}
+	actual := map[string][]string{
+		"authored":  revisions(dashboard.Authored),
+		"requested": revisions(dashboard.Requested),
+		"blocking":  revisions(dashboard.Blocking),
+		"overdue":   revisions(dashboard.Overdue),
+	}
+	for section, want := range expected {
+		got := actual[section]
+		if len(got) != len(want) || (len(got) > 0 && got[0] != want[0]) {
+			t.Errorf("Unexpected %s reviews: got %v, expected %v", section, got, want)
+		}
+	}
+}
+
+func TestCountThreads(t *testing.T) {
+	accept, reject := true, false
+	file := &comment.Location{Path: "a.go"}
+	reply := func(timestamp string, resolved *bool) CommentThread {
+		return CommentThread{Comment: comment.Comment{Timestamp: timestamp, Resolved: resolved}}
+	}
+	threads := []CommentThread{
+		// A vote on the review as a whole is not a discussion thread.
+		CommentThread{Comment: comment.Comment{Timestamp: "1", Resolved: &reject}},
+		// An FYI comment stays open until it is resolved.
+		CommentThread{Comment: comment.Comment{Timestamp: "1", Location: file}},
+		CommentThread{
+			Comment:  comment.Comment{Timestamp: "1"},
+			Children: []CommentThread{reply("2", &accept)},
+		},
+		// A comment needing work blocks until it is resolved, and the latest reply wins.
+		CommentThread{Comment: comment.Comment{Timestamp: "1", Location: file, Resolved: &reject}},
+		CommentThread{
+			Comment:  comment.Comment{Timestamp: "1", Location: file, Resolved: &reject},
+			Children: []CommentThread{reply("3", &accept), reply("2", &reject)},
+		},
+		CommentThread{
+			Comment:  comment.Comment{Timestamp: "1"},
+			Children: []CommentThread{reply("2", &accept), reply("3", &reject), reply("4", nil)},
+		},
+	}
+	expected := ThreadCounts{Open: 3, Blocking: 2, Resolved: 2}
+	if counts := countThreads(threads); counts != expected {
+		t.Errorf("Unexpected thread counts: got %+v, expected %+v", counts, expected)
+	}
+	if summary := expected.String(); summary != "3 open (2 blocking), 2 resolved" {
+		t.Errorf("Unexpected summary: %q", summary)
+	}
+}
+
+func TestCountThreadsBySeverity(t *testing.T) {
+	accept, reject := true, false
+	file := &comment.Location{Path: "a.go"}
+	thread := func(severity string, resolved *bool) CommentThread {
+		return CommentThread{Comment: comment.Comment{Timestamp: "1", Location: file, Severity: severity, Resolved: resolved}}
+	}
+	threads := []CommentThread{
+		// A blocking comment blocks until it is resolved, even without needing work.
+		thread(comment.SeverityBlocking, nil),
+		thread(comment.SeverityBlocking, &reject),
+		thread(comment.SeverityBlocking, &accept),
+		// Suggestions and nits never block, even when they need work.
+		thread(comment.SeveritySuggestion, &reject),
+		thread(comment.SeverityNit, &reject),
+		thread(comment.SeverityNit, nil),
+	}
+	expected := ThreadCounts{Open: 5, Blocking: 2, Resolved: 1}
+	if counts := countThreads(threads); counts != expected {
+		t.Errorf("Unexpected thread counts: got %+v, expected %+v", counts, expected)
+	}
+}
+
+func TestCommentAmendments(t *testing.T) {
+	reject := false
+	comments := map[string]comment.Comment{
+		"a":        comment.Comment{Timestamp: "1", Author: "alice", Description: "tpyo", Resolved: &reject},
+		"b":        comment.Comment{Timestamp: "1", Author: "alice", Description: "withdrawn", Resolved: &reject},
+		"edit-1":   comment.Comment{Timestamp: "2", Author: "alice", Original: "a", Description: "typo"},
+		"edit-2":   comment.Comment{Timestamp: "3", Author: "alice", Original: "a", Description: "typo!"},
+		"forgery":  comment.Comment{Timestamp: "4", Author: "mallory", Original: "a", Description: "lgtm"},
+		"retract":  comment.Comment{Timestamp: "2", Author: "alice", Original: "b", Retracted: true},
+		"too-late": comment.Comment{Timestamp: "3", Author: "alice", Original: "b", Description: "back"},
+	}
+	threads := buildCommentThreads(comments, nil)
+	if len(threads) != 2 {
+		t.Fatalf("Expected the amendments to be left out of the threads, got %d threads", len(threads))
+	}
+	for _, thread := range threads {
+		switch thread.Hash {
+		case "a":
+			if thread.Comment.Description != "typo!" || len(thread.History) != 3 {
+				t.Errorf("Unexpected edited comment: %+v", thread)
+			}
+		case "b":
+			if !thread.Comment.Retracted || thread.Comment.Description != "" || thread.Comment.Resolved != nil {
+				t.Errorf("Unexpected retracted comment: %+v", thread)
+			}
+		}
+	}
+}
+
+func TestCommentAcks(t *testing.T) {
+	comments := map[string]comment.Comment{
+		"a":    comment.Comment{Timestamp: "1", Author: "alice", Description: "Fix this"},
+		"ack1": comment.Comment{Timestamp: "2", Author: "bob", Parent: "a", Ack: "done"},
+		"ack2": comment.Comment{Timestamp: "3", Author: "carol", Parent: "a", Ack: "+1"},
+		"ack3": comment.Comment{Timestamp: "4", Author: "dave", Parent: "a", Ack: "+1"},
+		"ack4": comment.Comment{Timestamp: "5", Author: "dave", Parent: "a", Ack: "+1"},
+	}
+	threads := buildCommentThreads(comments, nil)
+	if len(threads) != 1 || len(threads[0].Children) != 0 || len(threads[0].Acks) != 4 {
+		t.Fatalf("Expected the acks to be attached to the comment rather than replies, got %+v", threads)
+	}
+	if summary := formatAcks(threads[0].Acks); summary != "done (bob), +1 (carol, dave)" {
+		t.Errorf("Unexpected acks summary: %q", summary)
+	}
+}
+
+func TestCommentedRevisions(t *testing.T) {
+	at := func(author, timestamp, commit string, children ...CommentThread) CommentThread {
+		return CommentThread{
+			Comment:  comment.Comment{Author: author, Timestamp: timestamp, Location: &comment.Location{Commit: commit}},
+			Children: children,
+		}
+	}
+	threads := []CommentThread{
+		at("alice", "3", "v2", at("bob", "4", "v3")),
+		at("bob", "1", "v1"),
+		at("alice", "2", "v1"),
+	}
+	if revisions := commentedRevisions(threads, ""); len(revisions) != 3 || revisions[0] != "v1" || revisions[1] != "v2" || revisions[2] != "v3" {
+		t.Errorf("Unexpected revisions: %v", revisions)
+	}
+	r := Review{Comments: threads}
+	if last := r.LastReviewedRevision("alice"); last != "v2" {
+		t.Errorf("Unexpected last reviewed revision: %q", last)
+	}
+	if last := r.LastReviewedRevision("carol"); last != "" {
+		t.Errorf("Expected no reviewed revision, got %q", last)
+	}
+}
+
+func TestSearchComments(t *testing.T) {
+	threads := []CommentThread{
+		CommentThread{
+			Hash:    "a",
+			Comment: comment.Comment{Author: "alice", Description: "Please rename this Variable", Location: &comment.Location{Path: "src/main.go"}},
+			Children: []CommentThread{
+				CommentThread{Hash: "b", Comment: comment.Comment{Author: "bob", Description: "Which variable?"}},
+			},
+		},
+		CommentThread{Hash: "c", Comment: comment.Comment{Author: "carol", Description: "LGTM"}},
+	}
+	r := Review{Revision: "rev", Comments: threads}
+	hitHashes := func(hits []SearchHit) string {
+		var hashes []string
+		for _, hit := range hits {
+			hashes = append(hashes, hit.Hash)
+		}
+		return strings.Join(hashes, ",")
+	}
+	tests := []struct {
+		query    SearchQuery
+		expected string
+	}{
+		{SearchQuery{Text: "variable"}, "a,b"},
+		{SearchQuery{Text: "variable", Author: "Bob"}, "b"},
+		{SearchQuery{Text: "variable", Path: "src"}, "a"},
+		{SearchQuery{Text: "variable", Path: "src/main.go"}, "a"},
+		{SearchQuery{Text: "variable", Path: "sr"}, ""},
+		{SearchQuery{Text: "nothing"}, ""},
+	}
+	for _, test := range tests {
+		if hashes := hitHashes(r.searchComments(test.query, r.Comments)); hashes != test.expected {
+			t.Errorf("Unexpected hits for %+v: %q, expected %q", test.query, hashes, test.expected)
+		}
+	}
+}
+
+func TestComputeStats(t *testing.T) {
+	accepted := true
+	reviews := []Review{
+		Review{
+			Request: request.Request{Timestamp: "1000", Requester: "alice", Reviewers: []string{"bob", "carol"}},
+			Comments: []CommentThread{
+				CommentThread{Comment: comment.Comment{Timestamp: "1060", Author: "alice", Description: "Ping"}},
+				CommentThread{Comment: comment.Comment{Timestamp: "1600", Author: "bob", Resolved: &accepted}},
+			},
+			Resolved:  &accepted,
+			Submitted: true,
+		},
+		Review{
+			Request: request.Request{Timestamp: "2000", Requester: "bob", Reviewers: []string{"carol"}},
+			Comments: []CommentThread{
+				CommentThread{
+					Comment:  comment.Comment{Timestamp: "2200", Author: "carol", Description: "Question"},
+					Children: []CommentThread{CommentThread{Comment: comment.Comment{Timestamp: "2300", Author: "bob", Description: "Answer"}}},
+				},
+			},
+		},
+	}
+	stats := ComputeStats(reviews, func(r Review) int { return len(r.Comments) })
+	if stats.Reviews != 2 || stats.Open != 1 || stats.Submitted != 1 {
+		t.Errorf("Unexpected review counts: %+v", stats)
+	}
+	if stats.Approved != 1 || stats.MedianTurnaround != 600 {
+		t.Errorf("Unexpected turnaround: %+v", stats)
+	}
+	if stats.Commented != 2 || stats.MedianTimeToFirstComment != 400 {
+		t.Errorf("Unexpected time to first comment: %+v", stats)
+	}
+	if stats.AverageRevisions != 1.5 {
+		t.Errorf("Unexpected average revisions: %v", stats.AverageRevisions)
+	}
+	expectedLoads := []ReviewerLoad{
+		ReviewerLoad{Reviewer: "bob", Assigned: 1, Pending: 0, Comments: 2},
+		ReviewerLoad{Reviewer: "carol", Assigned: 2, Pending: 0, Comments: 1},
+	}
+	if !reflect.DeepEqual(stats.Reviewers, expectedLoads) {
+		t.Errorf("Unexpected reviewer loads: %+v", stats.Reviewers)
+	}
+}
+
+func TestListActivity(t *testing.T) {
+	accepted := true
+	r := Review{
+		Revision: "rev",
+		Request:  request.Request{Timestamp: "1", Requester: "alice", Reviewers: []string{"bob"}},
+		Comments: []CommentThread{
+			CommentThread{
+				Hash:     "a",
+				Comment:  comment.Comment{Author: "bob", Description: "Why?"},
+				Children: []CommentThread{CommentThread{Hash: "b", Comment: comment.Comment{Author: "alice", Description: "Because", Resolved: &accepted}}},
+			},
+			CommentThread{Hash: "c", Comment: comment.Comment{Author: "bob", Resolved: &accepted}},
+			CommentThread{Hash: "d", Comment: comment.Comment{Author: "bob", Retracted: true}},
+		},
+	}
+	var kinds []string
+	for _, event := range r.ListActivity() {
+		kinds = append(kinds, event.Kind+" "+event.Key)
+	}
+	expected := []string{"request rev:request:1", "comment rev:a", "comment rev:b", "approval rev:c"}
+	if !reflect.DeepEqual(kinds, expected) {
+		t.Errorf("Unexpected activity: %v", kinds)
+	}
+	if !r.IsRelevantTo("Bob") || r.IsRelevantTo("carol") {
+		t.Error("Unexpected relevance of the review")
+	}
+}
+
+func TestListEvents(t *testing.T) {
+	r := Review{
+		Revision: "rev",
+		History:  []request.Request{request.Request{Timestamp: "1", Requester: "alice", Description: "Old"}},
+		Request:  request.Request{Timestamp: "5", Requester: "alice", Description: "New", SubmittedAs: "merge"},
+		Comments: []CommentThread{
+			CommentThread{Hash: "a", Comment: comment.Comment{Timestamp: "3", Author: "bob", Description: "Why?"}},
+		},
+		Reports: []ci.Report{ci.Report{Timestamp: "2", Status: ci.StatusSuccess, Name: "unit"}},
+	}
+	var kinds []string
+	for _, event := range r.ListEvents() {
+		kinds = append(kinds, event.Kind+" "+event.Key+" "+event.Timestamp)
+	}
+	expected := []string{"request rev:request 1", "ci rev:ci:unit:2 2", "comment rev:a 3", "submit rev:submit:merge 5"}
+	if !reflect.DeepEqual(kinds, expected) {
+		t.Errorf("Unexpected events: %v", kinds)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	accepted := true
+	r := Review{
+		Revision: "rev",
+		Request:  request.Request{Timestamp: "1", Requester: "alice", Reviewers: []string{"bob"}},
+		Comments: []CommentThread{
+			CommentThread{Hash: "a", Comment: comment.Comment{Timestamp: "7", Author: "bob", Resolved: &accepted}},
+		},
+		Resolved:  &accepted,
+		Attention: []string{"alice"},
+	}
+	summary := r.Summarize()
+	if summary.LastActivity != 7 || summary.Revision != "rev" || !*summary.Resolved {
+		t.Fatalf("Unexpected summary: %+v", summary)
+	}
+	listed := summary.Review()
+	if listed.Comments != nil || !listed.LastActivity().Equal(r.LastActivity()) || !listed.NeedsAttentionFrom("alice") {
+		t.Errorf("Unexpected review from the summary: %+v", listed)
+	}
+	if !(Filter{Reviewer: "bob", Status: StatusOpen}).Matches(listed) {
+		t.Errorf("The review from the summary was not matched by the filter")
+	}
+}
+
+func TestScanComments(t *testing.T) {
+	accepted, rejected := true, false
+	vote := comment.Comment{Timestamp: "0000000002", Author: "carol", Resolved: &rejected}
+	voteHash, err := vote.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var notes []repository.Note
+	for _, c := range []comment.Comment{
+		comment.Comment{Timestamp: "0000000001", Author: "bob", Resolved: &accepted},
+		vote,
+		comment.Comment{Timestamp: "0000000003", Author: "carol", Original: voteHash, Retracted: true},
+		comment.Comment{Timestamp: "0000000004", Author: "alice", Parent: voteHash, Description: "Why?"},
+	} {
+		note, err := c.Write()
+		if err != nil {
+			t.Fatal(err)
+		}
+		notes = append(notes, note)
+	}
+	resolved, latest, activity := scanComments(notes)
+	threads := loadComments(notes)
+	if full := aggregateVotes(threads); resolved == nil || full == nil || *resolved != *full || !*resolved {
+		t.Errorf("Expected the retracted vote to be left out, got %v", resolved)
+	}
+	if activity.Unix() != 4 || latest["carol"].Unix() != 3 {
+		t.Errorf("Unexpected activity times %v and %v", activity, latest)
+	}
+}
+
+func TestAmbiguousError(t *testing.T) {
+	err := &AmbiguousError{Spec: "fix", Matches: []Summary{
+		Summary{Revision: "0123456789", Request: request.Request{Description: "Fix the frobnicator\n\nDetails"}},
+		Summary{Revision: "abcdef0123", Request: request.Request{Description: "Fix the tests"}, Submitted: true},
+	}}
+	expected := "\"fix\" matches 2 reviews:\n  0123456 [pending] Fix the frobnicator\n  abcdef0 [submitted] Fix the tests"
+	if err.Error() != expected {
+		t.Errorf("Unexpected error message: %q", err.Error())
+	}
+}
+
+func TestClockOrdering(t *testing.T) {
+	accept, reject := true, false
+	// The reply was written on a machine whose clock is behind, but after the reviewer saw the comment.
+	root := comment.Comment{Timestamp: "0000000200", Clock: 2, Author: "a", Resolved: &reject}
+	reply := comment.Comment{Timestamp: "0000000100", Clock: 3, Author: "b", Parent: "root", Resolved: &accept}
+	thread := CommentThread{Comment: root, Children: []CommentThread{{Comment: reply}}}
+	if status := ThreadStatus(thread); status == nil || !*status {
+		t.Errorf("Expected the reply to resolve the thread despite its earlier timestamp")
+	}
+	later := comment.Comment{Timestamp: "0000000050", Clock: 4, Author: "c", Parent: "root", Resolved: &reject}
+	thread.Children = append(thread.Children, CommentThread{Comment: later})
+	if status := ThreadStatus(thread); status == nil || *status {
+		t.Errorf("Expected the reply with the latest clock to reopen the thread")
+	}
+	votes := []CommentThread{
+		{Comment: comment.Comment{Timestamp: "0000000200", Clock: 2, Author: "a", Resolved: &reject}},
+		{Comment: comment.Comment{Timestamp: "0000000100", Clock: 5, Author: "a", Resolved: &accept}},
+	}
+	if status := aggregateVotes(votes); status == nil || !*status {
+		t.Errorf("Expected the vote with the later clock to count")
+	}
+	// Notes without a clock come before those with one, whatever their timestamps.
+	votes[1].Comment.Clock = 0
+	votes[1].Comment.Timestamp = "0000000300"
+	if status := aggregateVotes(votes); status == nil || *status {
+		t.Errorf("Expected the vote with a clock to count over a legacy vote")
+	}
+	original := request.Request{Timestamp: "2", Clock: 1, Description: "Old"}
+	amended := request.Request{Timestamp: "1", Clock: 2, Description: "New"}
+	if latest, _ := latestRequest([]request.Request{amended, original}); latest.Description != "New" {
+		t.Errorf("Expected the request with the later clock to win, got %+v", latest)
+	}
+}
+
+func TestConflicts(t *testing.T) {
+	original := request.Request{Timestamp: "1", Clock: 1, Description: "Original"}
+	first := request.Request{Timestamp: "2", Clock: 2, Description: "First"}
+	second := request.Request{Timestamp: "3", Clock: 2, Description: "Second"}
+	r := Review{Request: second, History: []request.Request{original, first}}
+	conflicts := r.Conflicts()
+	if len(conflicts) != 1 || len(conflicts[0].Requests) != 2 || conflicts[0].Requests[0].Description != "First" {
+		t.Fatalf("Unexpected conflicts: %+v", conflicts)
+	}
+	if alternatives := conflicts[0].Alternatives(); len(alternatives) != 2 || !strings.HasSuffix(alternatives[1], `"Second" (differs in description)`) {
+		t.Errorf("Unexpected alternatives: %q", alternatives)
+	}
+	// Concurrent updates that agree do not conflict, and neither do updates that saw each other.
+	second.Description = "First"
+	r = Review{Request: second, History: []request.Request{original, first}}
+	if conflicts := r.Conflicts(); len(conflicts) != 0 {
+		t.Errorf("Unexpected conflicts between identical updates: %+v", conflicts)
+	}
+	resolved := request.Request{Timestamp: "4", Clock: 3, Description: "Resolved"}
+	r = Review{Request: resolved, History: []request.Request{original, first, second}}
+	if conflicts := r.Conflicts(); len(conflicts) != 0 {
+		t.Errorf("Unexpected conflicts after a resolution: %+v", conflicts)
+	}
+	// Concurrent amendments of a comment conflict too, unless they have no clocks.
+	c := comment.Comment{Timestamp: "1", Clock: 1, Author: "a", Description: "typo"}
+	edit := func(description string, clock uint64) comment.Comment {
+		return comment.Comment{Timestamp: "2", Clock: clock, Author: "a", Original: "hash", Description: description}
+	}
+	thread := CommentThread{Hash: "hash", Comment: c, History: []comment.Comment{c, edit("fixed", 2), edit("fixed again", 2)}}
+	r = Review{Request: original, Comments: []CommentThread{thread}}
+	if conflicts := r.Conflicts(); len(conflicts) != 1 || conflicts[0].Comment != "hash" || len(conflicts[0].Amendments) != 2 {
+		t.Errorf("Unexpected conflicts between amendments: %+v", conflicts)
+	}
+	thread.History = []comment.Comment{c, edit("fixed", 0), edit("fixed again", 0)}
+	r.Comments = []CommentThread{thread}
+	if conflicts := r.Conflicts(); len(conflicts) != 0 {
+		t.Errorf("Unexpected conflicts between legacy amendments: %+v", conflicts)
+	}
+}
+
+func TestDuplicateComments(t *testing.T) {
+	original := comment.Comment{Timestamp: "0000000001", Author: "a", Description: "Typo @b"}
+	imported := original
+	imported.Mentions = []string{"b"}
+	importedHash, err := imported.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	originalHash, err := original.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The same reply was imported twice, once for each copy of the comment.
+	reply := comment.Comment{Timestamp: "0000000006", Author: "b", Parent: importedHash, Description: "Fixed"}
+	replyCopy := comment.Comment{Timestamp: "0000000006", Author: "b", Parent: originalHash, Description: "Fixed"}
+	var notes []repository.Note
+	for _, c := range []comment.Comment{imported, reply, original, replyCopy} {
+		note, err := c.Write()
+		if err != nil {
+			t.Fatal(err)
+		}
+		notes = append(notes, note)
+	}
+	threads := loadComments(notes)
+	if len(threads) != 1 {
+		t.Fatalf("Expected a single copy of the comment, got %+v", threads)
+	}
+	if children := threads[0].Children; len(children) != 1 {
+		t.Errorf("Expected a single copy of the reply, got %+v", children)
+	}
+	originalID, _ := original.ID()
+	if importedID, _ := imported.ID(); originalID != importedID {
+		t.Errorf("Expected copies of a comment to share their ID")
+	}
+}
+
+func TestMixedClockOrdering(t *testing.T) {
+	// Ordering clocked notes by their clocks and legacy ones by their
+	// timestamps would make these three notes a cycle.
+	first := comment.Comment{Timestamp: "0000000200", Description: "legacy"}
+	second := comment.Comment{Timestamp: "0000000300", Clock: 1, Description: "first clock"}
+	third := comment.Comment{Timestamp: "0000000100", Clock: 2, Description: "second clock"}
+	orders := [][]comment.Comment{
+		{first, second, third},
+		{first, third, second},
+		{second, first, third},
+		{second, third, first},
+		{third, first, second},
+		{third, second, first},
+	}
+	for _, order := range orders {
+		var threads []CommentThread
+		for _, c := range order {
+			threads = append(threads, CommentThread{Comment: c})
+		}
+		sort.Sort(byClock(threads))
+		if threads[0].Comment.Description != "legacy" || threads[1].Comment.Description != "first clock" || threads[2].Comment.Description != "second clock" {
+			t.Errorf("Unexpected order of mixed notes: %+v", threads)
+		}
+	}
+}
+
+func TestRepeatedVotes(t *testing.T) {
+	accepted, rejected := true, false
+	var notes []repository.Note
+	for i, resolved := range []*bool{&accepted, &rejected, &accepted} {
+		c := comment.Comment{Timestamp: fmt.Sprintf("%010d", i+1), Author: "a", Resolved: resolved, Clock: uint64(i + 1)}
+		note, err := c.Write()
+		if err != nil {
+			t.Fatal(err)
+		}
+		notes = append(notes, note)
+	}
+	threads := loadComments(notes)
+	if len(threads) != 3 {
+		t.Fatalf("Expected each vote to be kept, got %+v", threads)
+	}
+	if status := aggregateVotes(threads); status == nil || !*status {
+		t.Errorf("Expected the review to be accepted again, got %v", status)
+	}
+	if comment.NoteKey(notes[0]) == comment.NoteKey(notes[2]) {
+		t.Errorf("Expected repeated votes not to be merged as copies")
+	}
+}
+
+func TestApprovedCommit(t *testing.T) {
+	accepted, rejected := true, false
+	vote := func(clock uint64, author string, resolved *bool, commit string) CommentThread {
+		return CommentThread{Comment: comment.Comment{
+			Timestamp: fmt.Sprintf("%010d", clock),
+			Clock:     clock,
+			Author:    author,
+			Resolved:  resolved,
+			Location:  &comment.Location{Commit: commit},
+		}}
+	}
+	r := Review{Comments: []CommentThread{
+		vote(1, "a", &accepted, "c1"),
+		vote(2, "b", &accepted, "c2"),
+	}}
+	if commit := r.ApprovedCommit(); commit != "c2" {
+		t.Errorf("Expected the latest approval to be of c2, got %q", commit)
+	}
+
+	// A later rejection by anyone outweighs the approvals.
+	r.Comments = append(r.Comments, vote(3, "b", &rejected, "c3"))
+	if commit := r.ApprovedCommit(); commit != "" {
+		t.Errorf("Expected a rejected review not to have an approved commit, got %q", commit)
+	}
+
+	// An approval that was retracted no longer counts.
+	r.Comments = []CommentThread{vote(1, "a", &accepted, "c1")}
+	r.Comments[0].Comment.Retracted = true
+	r.Comments[0].Comment.Resolved = nil
+	if commit := r.ApprovedCommit(); commit != "" {
+		t.Errorf("Expected a retracted approval not to count, got %q", commit)
+	}
+}
+
+func TestRequestHistory(t *testing.T) {
+	original := request.Request{Timestamp: "1", TargetRef: "refs/heads/master", Description: "Old"}
+	amended := request.Request{Timestamp: "2", TargetRef: "refs/heads/release", Description: "New", Reviewers: []string{"bob"}}
+	abandoned := amended
+	abandoned.Timestamp = "2"
+	abandoned.Abandoned = true
+	latest, history := latestRequest([]request.Request{amended, original, abandoned})
+	if !latest.Abandoned || len(history) != 2 || history[0].Description != "Old" || history[1].Abandoned {
+		t.Fatalf("Unexpected request history: %+v, %+v", latest, history)
+	}
+	changes := RequestChanges(original, amended)
+	if expected := []string{"description", "target refs/heads/release", "reviewers"}; !reflect.DeepEqual(changes, expected) {
+		t.Errorf("Unexpected changes: %v", changes)
+	}
+	if changes := RequestChanges(amended, abandoned); !reflect.DeepEqual(changes, []string{"abandoned"}) {
+		t.Errorf("Unexpected changes: %v", changes)
+	}
+	reopened := abandoned
+	reopened.Abandoned = false
+	if changes := RequestChanges(abandoned, reopened); !reflect.DeepEqual(changes, []string{"reopened"}) {
+		t.Errorf("Unexpected changes: %v", changes)
+	}
+}
+
+func TestWritePorcelainDetails(t *testing.T) {
+	accept := true
+	r := Review{
+		Revision: "abc",
+		Request: request.Request{
+			Timestamp:   "1",
+			Requester:   "alice",
+			Reviewers:   []string{"bob"},
+			TargetRef:   "refs/heads/master",
+			ReviewRef:   "refs/heads/feature",
+			Description: "Fix\tthings\nand a \\ path",
+		},
+		Comments: []CommentThread{
+			CommentThread{
+				Hash: "c1",
+				Comment: comment.Comment{
+					Timestamp:   "2",
+					Author:      "bob",
+					Location:    &comment.Location{Path: "a.go", Range: &comment.Range{StartLine: 3}},
+					Description: "Why?",
+				},
+				Children: []CommentThread{
+					CommentThread{Hash: "c2", Comment: comment.Comment{Timestamp: "3", Author: "alice", Resolved: &accept, Description: "Because."}},
+				},
+			},
+		},
+	}
+	var out strings.Builder
+	if err := r.WritePorcelainDetails(&out); err != nil {
+		t.Fatal(err)
+	}
+	expected := "review\tabc\tpending\talice\trefs/heads/master\trefs/heads/feature\t1\tFix\\tthings\\nand a \\\\ path\n" +
+		"reviewer\tbob\n" +
+		"comment\tc1\t\t2\tbob\tfyi\ta.go\t3\tWhy?\n" +
+		"comment\tc2\tc1\t3\talice\tlgtm\t\t\tBecause.\n"
+	if out.String() != expected {
+		t.Errorf("Unexpected porcelain output:\n%q\nexpected:\n%q", out.String(), expected)
+	}
+}
+
+func TestColorizeDiff(t *testing.T) {
+	diff := "diff --git a/a.go b/a.go\n@@ -1 +1 @@\n-old\n+new\n context"
+	if ColorizeDiff(diff) != diff {
+		t.Errorf("Unexpected colors when color is disabled")
+	}
+	for slot := range defaultColors {
+		colorCodes[slot] = "<" + slot + ">"
+	}
+	EnableColor(true)
+	defer func() {
+		EnableColor(false)
+		colorCodes = make(map[string]string)
+	}()
+	expected := "<meta>diff --git a/a.go b/a.go\x1b[m\n<frag>@@ -1 +1 @@\x1b[m\n<old>-old\x1b[m\n<new>+new\x1b[m\n context"
+	if colored := ColorizeDiff(diff); colored != expected {
+		t.Errorf("Unexpected colored diff %q", colored)
+	}
+}
+
+func TestCommitMessageCommentsAreNotVotes(t *testing.T) {
+	reject := false
+	message := CommentThread{Comment: comment.Comment{Resolved: &reject, Location: &comment.Location{CommitMessage: true}}}
+	if isVote(message) {
+		t.Errorf("A comment on the commit message was counted as a vote on the review")
+	}
+	if counts := countThreads([]CommentThread{message}); counts.Blocking != 1 {
+		t.Errorf("Unexpected thread counts %+v", counts)
+	}
+	general := CommentThread{Comment: comment.Comment{Resolved: &reject, Location: &comment.Location{Commit: "abc"}}}
+	if !isVote(general) {
+		t.Errorf("A comment on the whole commit was not counted as a vote on the review")
+	}
+}
+
+// attentionOf returns the attention set of the review, given the time of its current revision.
+func attentionOf(r *Review, revisionTime time.Time) []string {
+	latest := make(map[string]time.Time)
+	latestByAuthor(r.Comments, latest)
+	return attentionSet(r, revisionTime, latest)
+}
+
+func TestAttentionSet(t *testing.T) {
+	r := Review{
+		Request: request.Request{Timestamp: "0000000010", Requester: "alice", Reviewers: []string{"bob", "carol"}},
+	}
+	if attention := attentionOf(&r, time.Time{}); !reflect.DeepEqual(attention, []string{"bob", "carol"}) {
+		t.Errorf("Unexpected attention set for a new review: %v", attention)
+	}
+	r.Comments = []CommentThread{
+		CommentThread{Comment: comment.Comment{Timestamp: "0000000020", Author: "bob"}},
+	}
+	if attention := attentionOf(&r, time.Time{}); !reflect.DeepEqual(attention, []string{"alice", "carol"}) {
+		t.Errorf("Unexpected attention set after a reviewer commented: %v", attention)
+	}
+	if attention := attentionOf(&r, time.Unix(30, 0)); !reflect.DeepEqual(attention, []string{"bob", "carol"}) {
+		t.Errorf("Unexpected attention set after a new revision: %v", attention)
+	}
+	r.Comments[0].Children = []CommentThread{
+		CommentThread{Comment: comment.Comment{Timestamp: "0000000040", Author: "carol"}},
+	}
+	if attention := attentionOf(&r, time.Unix(30, 0)); !reflect.DeepEqual(attention, []string{"alice", "bob"}) {
+		t.Errorf("Unexpected attention set after another reviewer replied: %v", attention)
+	}
+}
+
+func TestDependencyOrder(t *testing.T) {
+	reviews := map[string]*Review{
+		"a": &Review{Revision: "a"},
+		"b": &Review{Revision: "b", Request: request.Request{DependsOn: []string{"a"}}},
+		"c": &Review{Revision: "c", Request: request.Request{DependsOn: []string{"b", "a"}}},
+	}
+	get := func(revision string) *Review { return reviews[revision] }
+	ordered, err := dependencyOrder(&Review{Revision: "d", Request: request.Request{DependsOn: []string{"c"}}}, get)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var revisions []string
+	for _, r := range ordered {
+		revisions = append(revisions, r.Revision)
+	}
+	if !reflect.DeepEqual(revisions, []string{"a", "b", "c"}) {
+		t.Errorf("Unexpected dependency order %v", revisions)
+	}
+	reviews["a"].Request.DependsOn = []string{"c"}
+	if _, err := dependencyOrder(reviews["c"], get); err == nil {
+		t.Errorf("Expected a cycle of dependencies to be rejected")
+	}
+	if _, err := dependencyOrder(&Review{Revision: "e", Request: request.Request{DependsOn: []string{"missing"}}}, get); err == nil {
+		t.Errorf("Expected a missing dependency to be rejected")
+	}
+}
+
+func TestSummarizeMilestones(t *testing.T) {
+	milestones := milestone.Latest([]milestone.Milestone{
+		milestone.Milestone{Timestamp: "0000000010", Name: "v2"},
+		milestone.Milestone{Timestamp: "0000000010", Name: "v1", Due: "2015-02-01"},
+		milestone.Milestone{Timestamp: "0000000020", Name: "v1", Due: "2015-01-01"},
+	})
+	reviews := []Review{
+		Review{Request: request.Request{Milestone: "v1"}},
+		Review{Request: request.Request{Milestone: "v1"}, Submitted: true},
+		Review{Request: request.Request{Milestone: "v2"}, Abandoned: true},
+		Review{Request: request.Request{Milestone: "v3"}},
+		Review{},
+	}
+	expected := []MilestoneProgress{
+		MilestoneProgress{Milestone: milestones[0], Open: 1, Submitted: 1},
+		MilestoneProgress{Milestone: milestones[1], Abandoned: 1},
+		MilestoneProgress{Milestone: milestone.Milestone{Name: "v3"}, Open: 1},
+	}
+	if progress := SummarizeMilestones(milestones, reviews); !reflect.DeepEqual(progress, expected) {
+		t.Errorf("Unexpected milestone progress %+v", progress)
+	}
+	if milestones[0].Name != "v1" || milestones[0].Due != "2015-01-01" {
+		t.Errorf("Unexpected latest milestone %+v", milestones[0])
+	}
+}
+
+func TestApplySuggestion(t *testing.T) {
+	suggestion := "B1\nB2"
+	c := comment.Comment{
+		Location:   &comment.Location{Path: "a.txt", Range: &comment.Range{StartLine: 2}},
+		Suggestion: &suggestion,
+	}
+	original := "a\nb\nc\n"
+	if edited, err := ApplySuggestion(c, original, original); err != nil || edited != "a\nB1\nB2\nc\n" {
+		t.Errorf("Unexpected result of applying a suggestion: %q, %v", edited, err)
+	}
+	if edited, err := ApplySuggestion(c, original, "z\na\nb\nc\n"); err != nil || edited != "z\na\nB1\nB2\nc\n" {
+		t.Errorf("Unexpected result of applying a suggestion to moved lines: %q, %v", edited, err)
+	}
+	if _, err := ApplySuggestion(c, original, "a\nx\nc\n"); err == nil {
+		t.Errorf("Expected a suggestion for changed lines to be rejected")
+	}
+	if _, err := ApplySuggestion(c, original, "b\nz\nb\n"); err == nil {
+		t.Errorf("Expected a suggestion for ambiguous lines to be rejected")
+	}
+	deletion := ""
+	c.Suggestion = &deletion
+	c.Location.Range.EndLine = 3
+	if edited, err := ApplySuggestion(c, original, original); err != nil || edited != "a\n" {
+		t.Errorf("Unexpected result of applying a deletion: %q, %v", edited, err)
 	}
 }
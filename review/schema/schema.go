@@ -0,0 +1,172 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package schema handles the versions of the formats in which notes are stored.
+//
+// Every kind of note records the version of its format in its "v" field,
+// which is omitted for version 0. Notes written in an older version are
+// upgraded to the latest one when read, while notes written in a newer
+// version (by a newer release of the tool) are skipped with a warning, since
+// they may not mean what this release of the tool would take them to mean.
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/google/git-appraise/repository"
+)
+
+// ErrNewerVersion is returned for notes written in a newer version of their format than is supported.
+var ErrNewerVersion = errors.New("The note uses a newer format than this tool supports")
+
+// Migration upgrades the fields of a note from one version of its format to the next.
+type Migration func(fields map[string]json.RawMessage) error
+
+// Format describes the versions of one kind of note.
+type Format struct {
+	// Name describes the kind of note, e.g. "review request".
+	Name string
+	// Migrations holds the upgrade from each version to the next, so that
+	// Migrations[0] upgrades version 0 to version 1, and the latest version
+	// is the number of migrations.
+	Migrations []Migration
+
+	warnOnce sync.Once
+}
+
+// Latest returns the latest version of the format.
+func (f *Format) Latest() int {
+	return len(f.Migrations)
+}
+
+// Version returns the format version that the given note was written in.
+func Version(note repository.Note) (int, error) {
+	var versioned struct {
+		Version int `json:"v"`
+	}
+	err := json.Unmarshal([]byte(note), &versioned)
+	return versioned.Version, err
+}
+
+// Upgrade returns the given note in the latest version of the format.
+//
+// Notes already in the latest version are returned unchanged. For notes in a
+// newer version, a warning is printed (only once), and ErrNewerVersion is returned.
+func (f *Format) Upgrade(note repository.Note) (repository.Note, error) {
+	version, err := Version(note)
+	if err != nil {
+		return nil, err
+	}
+	latest := f.Latest()
+	if version == latest {
+		return note, nil
+	}
+	if version > latest {
+		f.warnOnce.Do(func() {
+			fmt.Fprintf(os.Stderr, "Warning: ignoring %s notes in version %d of their format, as only versions up to %d are supported. Upgrade git-appraise to read them.\n", f.Name, version, latest)
+		})
+		return nil, ErrNewerVersion
+	}
+	if version < 0 {
+		return nil, fmt.Errorf("Invalid format version %d", version)
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(note), &fields); err != nil {
+		return nil, err
+	}
+	for ; version < latest; version++ {
+		if err := f.Migrations[version](fields); err != nil {
+			return nil, fmt.Errorf("Failed to upgrade a %s note from version %d: %v", f.Name, version, err)
+		}
+	}
+	fields["v"] = json.RawMessage(fmt.Sprint(latest))
+	upgraded, err := json.Marshal(fields)
+	return repository.Note(upgraded), err
+}
+
+// Validate checks that the given note is a well-formed note of this format.
+//
+// The note is upgraded to the latest version, and then strictly decoded into
+// the given value, which should be a pointer to the type used for this kind of
+// note. Unlike the lenient parsing used when reading notes, any unknown field
+// or field of the wrong type is reported, along with the name of that field.
+func (f *Format) Validate(note repository.Note, into interface{}) error {
+	var parsed interface{}
+	if err := json.Unmarshal([]byte(note), &parsed); err != nil {
+		return describeError(err)
+	}
+	if _, ok := parsed.(map[string]interface{}); !ok {
+		return fmt.Errorf("expected a JSON object, found %s", describeValue(parsed))
+	}
+	version, err := Version(note)
+	if err != nil {
+		return describeError(err)
+	}
+	if latest := f.Latest(); version > latest {
+		return fmt.Errorf("unknown version %d of the %s format; only versions up to %d are supported", version, f.Name, latest)
+	}
+	if version < 0 {
+		return fmt.Errorf("field \"v\": invalid format version %d", version)
+	}
+	upgraded, err := f.Upgrade(note)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(upgraded))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(into); err != nil {
+		return describeError(err)
+	}
+	return nil
+}
+
+// describeError rewords an error from decoding JSON to name the offending field or position.
+func describeError(err error) error {
+	switch e := err.(type) {
+	case *json.SyntaxError:
+		return fmt.Errorf("invalid JSON at byte %d: %v", e.Offset, e)
+	case *json.UnmarshalTypeError:
+		return fmt.Errorf("field %q: expected %v, found a JSON %s", e.Field, e.Type, e.Value)
+	}
+	message := strings.TrimPrefix(err.Error(), "json: ")
+	if strings.HasPrefix(message, "unknown field ") {
+		return fmt.Errorf("field %s: not part of the format", strings.TrimPrefix(message, "unknown field "))
+	}
+	return errors.New(message)
+}
+
+// describeValue names the kind of a decoded JSON value, for error messages.
+func describeValue(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case []interface{}:
+		return "an array"
+	case string:
+		return "a string"
+	case float64:
+		return "a number"
+	case bool:
+		return "a boolean"
+	}
+	return "an object"
+}
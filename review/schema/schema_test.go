@@ -0,0 +1,76 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package schema
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/git-appraise/repository"
+)
+
+func TestUpgrade(t *testing.T) {
+	format := &Format{
+		Name: "test",
+		Migrations: []Migration{
+			func(fields map[string]json.RawMessage) error {
+				fields["renamed"] = fields["old"]
+				delete(fields, "old")
+				return nil
+			},
+		},
+	}
+	current := repository.Note(`{"renamed":"x","v":1}`)
+	if upgraded, err := format.Upgrade(current); err != nil || string(upgraded) != string(current) {
+		t.Errorf("Unexpected upgrade of a current note: %q, %v", upgraded, err)
+	}
+	upgraded, err := format.Upgrade(repository.Note(`{"old":"x"}`))
+	if err != nil || string(upgraded) != `{"renamed":"x","v":1}` {
+		t.Errorf("Unexpected upgrade of an old note: %q, %v", upgraded, err)
+	}
+	if _, err := format.Upgrade(repository.Note(`{"v":2}`)); err != ErrNewerVersion {
+		t.Errorf("Expected a newer note to be rejected, got %v", err)
+	}
+	if _, err := format.Upgrade(repository.Note(`not json`)); err == nil {
+		t.Errorf("Expected an invalid note to be rejected")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	format := &Format{Name: "test"}
+	type note struct {
+		Version int    `json:"v,omitempty"`
+		Text    string `json:"text"`
+	}
+	if err := format.Validate(repository.Note(`{"text":"x"}`), new(note)); err != nil {
+		t.Errorf("Unexpected error validating a valid note: %v", err)
+	}
+	invalid := map[string]string{
+		`{"text":1}`:           `field "text": expected string, found a JSON number`,
+		`{"text":"x","bad":1}`: `field "bad": not part of the format`,
+		`{"v":1}`:              `unknown version 1 of the test format; only versions up to 0 are supported`,
+		`{"v":-1}`:             `field "v": invalid format version -1`,
+		`["text"]`:             `expected a JSON object, found an array`,
+		`{"text":`:             `invalid JSON at byte 8: unexpected end of JSON input`,
+	}
+	for input, expected := range invalid {
+		err := format.Validate(repository.Note(input), new(note))
+		if err == nil || err.Error() != expected {
+			t.Errorf("Unexpected error validating %q: got %v, want %q", input, err, expected)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package review
+
+import (
+	"strings"
+
+	"github.com/google/git-appraise/repository"
+)
+
+// The kinds of text that a search can match.
+const (
+	HitDescription = "description"
+	HitCommit      = "commit"
+	HitComment     = "comment"
+)
+
+// SearchQuery describes the text to search for, and optionally where to look for it.
+type SearchQuery struct {
+	// Text is matched against the searched text, ignoring case.
+	Text string
+	// Author restricts the matches to those written by the given user (ignoring case).
+	Author string
+	// Path restricts the matches to comments on the given file or directory,
+	// and to the descriptions and commits of reviews that change it.
+	Path string
+}
+
+// SearchHit is a single match of a search.
+type SearchHit struct {
+	Revision string `json:"revision"`
+	// Kind is one of HitDescription, HitCommit, or HitComment.
+	Kind string `json:"kind"`
+	// Hash is the hash of the matching commit or comment.
+	Hash   string `json:"hash,omitempty"`
+	Author string `json:"author,omitempty"`
+	Path   string `json:"path,omitempty"`
+	Text   string `json:"text"`
+}
+
+// matchesText reports whether the text contains the query, ignoring case.
+func (q SearchQuery) matchesText(text string) bool {
+	return strings.Contains(strings.ToLower(text), strings.ToLower(q.Text))
+}
+
+func (q SearchQuery) matchesAuthor(author string) bool {
+	return q.Author == "" || strings.EqualFold(q.Author, author)
+}
+
+// matchesPath reports whether the path is the queried file, or within the queried directory.
+func (q SearchQuery) matchesPath(path string) bool {
+	dir := strings.TrimSuffix(q.Path, "/")
+	return q.Path == "" || path == dir || strings.HasPrefix(path, dir+"/")
+}
+
+// searchComments returns the comments in the threads that match the query.
+func (r *Review) searchComments(q SearchQuery, threads []CommentThread) []SearchHit {
+	var hits []SearchHit
+	for _, thread := range threads {
+		c := thread.Comment
+		var path string
+		if c.Location != nil {
+			path = c.Location.Path
+		}
+		if q.matchesText(c.Description) && q.matchesAuthor(c.Author) && q.matchesPath(path) {
+			hits = append(hits, SearchHit{r.Revision, HitComment, thread.Hash, c.Author, path, c.Description})
+		}
+		hits = append(hits, r.searchComments(q, thread.Children)...)
+	}
+	return hits
+}
+
+// changesPath reports whether the review changes anything at the given path.
+func (r *Review) changesPath(path string) bool {
+	from, to, err := r.diffRange()
+	return err == nil && repository.HasChanges(from, to, path)
+}
+
+// Search returns the parts of the review that match the query: its
+// description, the messages of its commits, and its comments.
+func (r *Review) Search(q SearchQuery) []SearchHit {
+	var hits []SearchHit
+	requestMatches := q.matchesAuthor(r.Request.Requester) && (q.Path == "" || r.changesPath(q.Path))
+	if requestMatches {
+		if q.matchesText(r.Request.Description) {
+			hits = append(hits, SearchHit{r.Revision, HitDescription, "", r.Request.Requester, "", r.Request.Description})
+		}
+		if from, to, err := r.diffRange(); err == nil {
+			for _, commit := range repository.ListCommitsBetween(from, to) {
+				if message := repository.GetCommitMessage(commit); q.matchesText(message) {
+					hits = append(hits, SearchHit{r.Revision, HitCommit, commit, r.Request.Requester, "", message})
+				}
+			}
+		}
+	}
+	return append(hits, r.searchComments(q, r.Comments)...)
+}
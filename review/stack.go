@@ -0,0 +1,83 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package review
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Dependencies returns the reviews that the review depends on, directly or
+// indirectly, in the order in which they have to be submitted.
+//
+// An error is returned if a dependency is not a review, or if the reviews depend on each other in a cycle.
+func (r *Review) Dependencies() ([]Review, error) {
+	return dependencyOrder(r, Get)
+}
+
+// dependencyOrder orders the dependencies of the given review so that each comes after the ones it depends on.
+func dependencyOrder(r *Review, get func(revision string) *Review) ([]Review, error) {
+	var ordered []Review
+	// Reviews are marked as visiting while their dependencies are being
+	// ordered, and as done once they have been added to the result.
+	visiting := map[string]bool{r.Revision: true}
+	done := make(map[string]bool)
+	var visit func(dependent *Review) error
+	visit = func(dependent *Review) error {
+		for _, revision := range dependent.Request.DependsOn {
+			if done[revision] {
+				continue
+			}
+			if visiting[revision] {
+				return fmt.Errorf("The review %s is part of a cycle of dependencies.", revision)
+			}
+			dependency := get(revision)
+			if dependency == nil {
+				return fmt.Errorf("The review %s depends on %s, which is not a review.", dependent.Revision, revision)
+			}
+			visiting[revision] = true
+			if err := visit(dependency); err != nil {
+				return err
+			}
+			visiting[revision] = false
+			done[revision] = true
+			ordered = append(ordered, *dependency)
+		}
+		return nil
+	}
+	if err := visit(r); err != nil {
+		return nil, err
+	}
+	return ordered, nil
+}
+
+// printDependencies prints the chain of reviews that the review depends on, in submission order.
+func (r *Review) printDependencies() {
+	if len(r.Request.DependsOn) == 0 {
+		return
+	}
+	dependencies, err := r.Dependencies()
+	if err != nil {
+		fmt.Printf("  depends on: %v\n", err)
+		return
+	}
+	fmt.Println("  depends on:")
+	for _, dependency := range dependencies {
+		subject := strings.SplitN(dependency.Request.Description, "\n", 2)[0]
+		fmt.Printf("    [%s] %s %q\n", dependency.Status(), colorize("hash", dependency.Revision), subject)
+	}
+}
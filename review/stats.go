@@ -0,0 +1,184 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package review
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// ReviewerLoad summarizes the reviews assigned to a single reviewer.
+type ReviewerLoad struct {
+	Reviewer string `json:"reviewer"`
+	// Assigned is the number of reviews listing the reviewer.
+	Assigned int `json:"assigned"`
+	// Pending is the number of open reviews the reviewer has not commented on yet.
+	Pending int `json:"pending"`
+	// Comments is the number of comments the reviewer wrote, on any review.
+	Comments int `json:"comments"`
+}
+
+// Stats summarizes how a set of reviews progressed.
+//
+// Durations are given in seconds, and are zero when no review had the
+// corresponding event.
+type Stats struct {
+	Reviews   int `json:"reviews"`
+	Open      int `json:"open"`
+	Submitted int `json:"submitted"`
+	Abandoned int `json:"abandoned"`
+	// Approved is the number of reviews whose turnaround time is known.
+	Approved int `json:"approved"`
+	// MedianTurnaround is the median time from a request to its approval.
+	MedianTurnaround int64 `json:"medianTurnaroundSeconds"`
+	// Commented is the number of reviews with a comment from someone other than the requester.
+	Commented int `json:"commented"`
+	// MedianTimeToFirstComment is the median time from a request to the first such comment.
+	MedianTimeToFirstComment int64 `json:"medianTimeToFirstCommentSeconds"`
+	// AverageRevisions is the mean number of versions of each review.
+	AverageRevisions float64        `json:"averageRevisions"`
+	Reviewers        []ReviewerLoad `json:"reviewers"`
+}
+
+// RequestTime returns the time at which the review was requested, or the zero time if that is not known.
+func (r *Review) RequestTime() time.Time {
+	t, err := parseTimestamp(r.Request.Timestamp)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// firstCommentTime returns the time of the earliest comment not written by the given author.
+func firstCommentTime(threads []CommentThread, author string) time.Time {
+	var earliest time.Time
+	for _, thread := range threads {
+		if !identities().Same(thread.Comment.Author, author) {
+			if t, err := parseTimestamp(thread.Comment.Timestamp); err == nil && (earliest.IsZero() || t.Before(earliest)) {
+				earliest = t
+			}
+		}
+		if t := firstCommentTime(thread.Children, author); !t.IsZero() && (earliest.IsZero() || t.Before(earliest)) {
+			earliest = t
+		}
+	}
+	return earliest
+}
+
+// approvalTime returns the time at which the review became accepted, or the
+// zero time if it is not currently accepted.
+func (r *Review) approvalTime() time.Time {
+	if r.Resolved == nil || !*r.Resolved {
+		return time.Time{}
+	}
+	var latest time.Time
+	for _, vote := range latestVotes(r.Comments) {
+		if t, err := parseTimestamp(vote.Timestamp); err == nil && t.After(latest) {
+			latest = t
+		}
+	}
+	return latest
+}
+
+// countCommentsByAuthor adds the number of comments written by each author in the threads to the given counts.
+func countCommentsByAuthor(threads []CommentThread, counts map[string]int) {
+	for _, thread := range threads {
+		counts[strings.ToLower(identities().Canonical(thread.Comment.Author))]++
+		countCommentsByAuthor(thread.Children, counts)
+	}
+}
+
+// medianSeconds returns the median of the given durations, in seconds.
+func medianSeconds(durations []time.Duration) int64 {
+	if len(durations) == 0 {
+		return 0
+	}
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	middle := len(durations) / 2
+	median := durations[middle]
+	if len(durations)%2 == 0 {
+		median = (durations[middle-1] + durations[middle]) / 2
+	}
+	return int64(median / time.Second)
+}
+
+// ComputeStats summarizes the given reviews.
+//
+// The number of versions of each review is given by the revisions function,
+// which is normally a call to the review's Revisions method.
+func ComputeStats(reviews []Review, revisions func(Review) int) Stats {
+	stats := Stats{Reviews: len(reviews), Reviewers: []ReviewerLoad{}}
+	var turnarounds, firstComments []time.Duration
+	var totalRevisions int
+	loads := make(map[string]*ReviewerLoad)
+	comments := make(map[string]int)
+	for _, r := range reviews {
+		switch {
+		case r.Submitted:
+			stats.Submitted++
+		case r.Abandoned:
+			stats.Abandoned++
+		default:
+			stats.Open++
+		}
+		totalRevisions += revisions(r)
+		countCommentsByAuthor(r.Comments, comments)
+
+		if requested := r.RequestTime(); !requested.IsZero() {
+			if approved := r.approvalTime(); !approved.IsZero() && !approved.Before(requested) {
+				turnarounds = append(turnarounds, approved.Sub(requested))
+			}
+			if commented := firstCommentTime(r.Comments, r.Request.Requester); !commented.IsZero() && !commented.Before(requested) {
+				firstComments = append(firstComments, commented.Sub(requested))
+			}
+		}
+
+		pending := r.PendingReviewers()
+		for _, reviewer := range r.Request.Reviewers {
+			key := strings.ToLower(identities().Canonical(reviewer))
+			load, ok := loads[key]
+			if !ok {
+				load = &ReviewerLoad{Reviewer: identities().Canonical(reviewer)}
+				loads[key] = load
+			}
+			load.Assigned++
+			if !r.IsClosed() && containsString(pending, reviewer) {
+				load.Pending++
+			}
+		}
+	}
+
+	stats.Approved = len(turnarounds)
+	stats.MedianTurnaround = medianSeconds(turnarounds)
+	stats.Commented = len(firstComments)
+	stats.MedianTimeToFirstComment = medianSeconds(firstComments)
+	if len(reviews) > 0 {
+		stats.AverageRevisions = float64(totalRevisions) / float64(len(reviews))
+	}
+	for key, load := range loads {
+		load.Comments = comments[key]
+		stats.Reviewers = append(stats.Reviewers, *load)
+	}
+	sort.Slice(stats.Reviewers, func(i, j int) bool {
+		if stats.Reviewers[i].Pending != stats.Reviewers[j].Pending {
+			return stats.Reviewers[i].Pending > stats.Reviewers[j].Pending
+		}
+		return stats.Reviewers[i].Reviewer < stats.Reviewers[j].Reviewer
+	})
+	return stats
+}
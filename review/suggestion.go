@@ -0,0 +1,102 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package review
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/git-appraise/review/comment"
+)
+
+// SuggestedLines returns the lines of the given file contents that a comment at the given location refers to.
+func SuggestedLines(location *comment.Location, contents string) ([]string, error) {
+	if location == nil || location.Path == "" || location.Range == nil {
+		return nil, errors.New("Suggested edits must refer to lines of a file.")
+	}
+	start := int(location.Range.StartLine)
+	end := int(location.Range.EndLine)
+	if end < start {
+		end = start
+	}
+	lines := strings.Split(strings.TrimSuffix(contents, "\n"), "\n")
+	if start < 1 || end > len(lines) {
+		return nil, fmt.Errorf("The lines %d-%d are past the end of %s.", start, end, location.Path)
+	}
+	return lines[start-1 : end], nil
+}
+
+// ApplySuggestion applies the edit suggested by a comment to the current
+// contents of the file it refers to, given the contents of that file in the
+// commit that was commented upon.
+//
+// If the lines have moved since then, the edit is applied wherever they now
+// are, provided that they appear exactly once.
+func ApplySuggestion(c comment.Comment, original, current string) (string, error) {
+	if c.Suggestion == nil {
+		return "", errors.New("The comment does not suggest an edit.")
+	}
+	old, err := SuggestedLines(c.Location, original)
+	if err != nil {
+		return "", err
+	}
+	var replacement []string
+	if *c.Suggestion != "" {
+		replacement = strings.Split(*c.Suggestion, "\n")
+	}
+
+	trailingNewline := strings.HasSuffix(current, "\n")
+	lines := strings.Split(strings.TrimSuffix(current, "\n"), "\n")
+	matchesAt := func(i int) bool {
+		if i < 0 || i+len(old) > len(lines) {
+			return false
+		}
+		for j, line := range old {
+			if lines[i+j] != line {
+				return false
+			}
+		}
+		return true
+	}
+	position := int(c.Location.Range.StartLine) - 1
+	if !matchesAt(position) {
+		var matches []int
+		for i := range lines {
+			if matchesAt(i) {
+				matches = append(matches, i)
+			}
+		}
+		if len(matches) == 0 {
+			return "", fmt.Errorf("The suggested lines of %s have changed since the suggestion was made.", c.Location.Path)
+		}
+		if len(matches) > 1 {
+			return "", fmt.Errorf("The suggested lines of %s have moved, and now appear %d times.", c.Location.Path, len(matches))
+		}
+		position = matches[0]
+	}
+
+	var edited []string
+	edited = append(edited, lines[:position]...)
+	edited = append(edited, replacement...)
+	edited = append(edited, lines[position+len(old):]...)
+	result := strings.Join(edited, "\n")
+	if trailingNewline && len(edited) > 0 {
+		result += "\n"
+	}
+	return result, nil
+}
@@ -0,0 +1,206 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package review
+
+import (
+	"time"
+
+	"github.com/google/git-appraise/repository"
+	"github.com/google/git-appraise/review/comment"
+	"github.com/google/git-appraise/review/request"
+)
+
+// summaryFile is the name of the file, within the cache directory, that caches the review summaries.
+const summaryFile = "summaries.json"
+
+// Summary is the lightweight form of a review used to list it: its request
+// and status, without its comment threads (or the counts of them), reports,
+// or request history.
+type Summary struct {
+	Revision   string          `json:"revision"`
+	Request    request.Request `json:"request"`
+	Resolved   *bool           `json:"resolved,omitempty"`
+	Submitted  bool            `json:"submitted"`
+	Incomplete bool            `json:"incomplete,omitempty"`
+	Archived   bool            `json:"archived,omitempty"`
+	Abandoned  bool            `json:"abandoned,omitempty"`
+	Attention  []string        `json:"attention,omitempty"`
+	// LastActivity is the time of the latest request or comment, in seconds since the epoch.
+	LastActivity int64 `json:"lastActivity"`
+}
+
+// Summarize returns the summary of the review.
+func (r *Review) Summarize() Summary {
+	return Summary{
+		Revision:     r.Revision,
+		Request:      r.Request,
+		Resolved:     r.Resolved,
+		Submitted:    r.Submitted,
+		Incomplete:   r.Incomplete,
+		Archived:     r.Archived,
+		Abandoned:    r.Abandoned,
+		Attention:    r.Attention,
+		LastActivity: r.LastActivity().Unix(),
+	}
+}
+
+// Review returns a review with the fields of the summary, which can be
+// filtered, sorted, and printed like a fully loaded one, but has no comments.
+func (s Summary) Review() Review {
+	return Review{
+		Revision:   s.Revision,
+		Request:    s.Request,
+		Resolved:   s.Resolved,
+		Submitted:  s.Submitted,
+		Incomplete: s.Incomplete,
+		Archived:   s.Archived,
+		Abandoned:  s.Abandoned,
+		Attention:  s.Attention,
+		activity:   time.Unix(s.LastActivity, 0),
+	}
+}
+
+// scanComments returns the status of a review from the latest vote of each
+// user in the given comment notes, along with the time of each user's most
+// recent activity and that of the latest comment.
+//
+// Unlike loadComments, this does not build the comment threads, so only the
+// retractions of votes are applied, and copies of a comment are not removed
+// (which does not change the votes or times).
+func scanComments(commentNotes []repository.Note) (*bool, map[string]time.Time, time.Time) {
+	comments := comment.ParseAll(commentNotes)
+	latest := make(map[string]time.Time)
+	retractedBy := make(map[string]string)
+	var activity time.Time
+	for _, c := range comments {
+		recordActivity(c, latest)
+		if c.Original != "" {
+			if c.Retracted {
+				retractedBy[c.Original] = c.Author
+			}
+			continue
+		}
+		if c.Ack != "" && c.Parent != "" {
+			continue
+		}
+		if t, err := parseTimestamp(c.Timestamp); err == nil && t.After(activity) {
+			activity = t
+		}
+	}
+	var votes []CommentThread
+	for hash, c := range comments {
+		// As in applyAmendment, only the author of a vote can retract it.
+		if c.Parent == "" && c.Original == "" && c.Resolved != nil && retractedBy[hash] != c.Author {
+			votes = append(votes, CommentThread{Hash: hash, Comment: c})
+		}
+	}
+	return aggregateVotes(votes), latest, activity
+}
+
+// buildSummaryReview returns the review for the given revision with only
+// the fields kept in its summary, built from the given request and comment notes.
+//
+// If none of the notes are valid review requests, the returned review is nil.
+func buildSummaryReview(revision string, requestNotes, commentNotes []repository.Note) *Review {
+	requests := request.ParseAllValid(requestNotes)
+	if requests == nil {
+		return nil
+	}
+	review := Review{Revision: revision}
+	review.Request, review.History = latestRequest(requests)
+	var latest map[string]time.Time
+	review.Resolved, latest, review.activity = scanComments(commentNotes)
+	review.updateStatus(latest)
+	if t, err := parseTimestamp(review.Request.Timestamp); err == nil && t.After(review.activity) {
+		review.activity = t
+	}
+	return &review
+}
+
+// summaryCache holds the summaries of the reviews of each request ref, as of
+// a given state of the repository, in the same way as reviewCache.
+//
+// It is kept apart from the reviews, so that listing them does not have to
+// read their comments from the cache either.
+type summaryCache struct {
+	Version   int                  `json:"v"`
+	State     string               `json:"state"`
+	Summaries map[string][]Summary `json:"summaries"`
+}
+
+// forEachSummaryFromRef calls the given function on the summary of each
+// review whose request is stored in the given notes ref.
+//
+// The cached summaries are used if they are current. Otherwise, they are
+// built from the notes without loading the reviews in full, and cached if
+// all of them were built.
+func forEachSummaryFromRef(requestRef string, f func(Summary) error) error {
+	summarize := func(r Review) error {
+		return f(r.Summarize())
+	}
+	if repository.GetConfig(cacheConfig) == "false" {
+		return loadEachFromRef(requestRef, buildSummaryReview, summarize)
+	}
+	state := cacheState()
+	var cache summaryCache
+	if !readCacheFile(summaryFile, &cache) || cache.Version != cacheVersion || cache.State != state || cache.Summaries == nil {
+		cache = summaryCache{Version: cacheVersion, State: state, Summaries: make(map[string][]Summary)}
+	}
+	if summaries, ok := cache.Summaries[requestRef]; ok {
+		for _, summary := range summaries {
+			if err := f(summary); err != nil {
+				if err == repository.ErrStopIteration {
+					return nil
+				}
+				return err
+			}
+		}
+		return nil
+	}
+
+	summaries := []Summary{}
+	stopped := false
+	err := loadEachFromRef(requestRef, buildSummaryReview, func(r Review) error {
+		summary := r.Summarize()
+		summaries = append(summaries, summary)
+		err := f(summary)
+		stopped = err != nil
+		return err
+	})
+	if err != nil || stopped {
+		return err
+	}
+	cache.Summaries[requestRef] = summaries
+	writeCacheFile(summaryFile, cache)
+	return nil
+}
+
+// ForEachSummary calls the given function on the summary of each review
+// stored in the git-notes, excluding archived reviews.
+//
+// It stops early in the same way as ForEach.
+func ForEachSummary(f func(Summary) error) error {
+	return forEachSummaryFromRef(request.Ref, f)
+}
+
+// ForEachArchivedSummary calls the given function on the summary of each
+// review that has been moved to the archive.
+//
+// It stops early in the same way as ForEach.
+func ForEachArchivedSummary(f func(Summary) error) error {
+	return forEachSummaryFromRef(request.ArchiveRef, f)
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package review
+
+import (
+	"fmt"
+
+	"github.com/google/git-appraise/review/comment"
+)
+
+// ThreadCounts summarizes the discussion threads of a review.
+//
+// Every open thread needs to be addressed, but only the blocking ones (which
+// are a subset of the open ones) prevent the review from being submitted.
+// An open thread is blocking if its severity is "blocking", or if it has no
+// severity and its status is "needs work".
+type ThreadCounts struct {
+	Open     int `json:"open"`
+	Blocking int `json:"blocking"`
+	Resolved int `json:"resolved"`
+}
+
+// isVote reports whether the root of a thread is only a vote on the review as a whole.
+func isVote(thread CommentThread) bool {
+	c := thread.Comment
+	return c.Resolved != nil && c.Location.IsWholeCommit()
+}
+
+// ThreadStatus returns the resolution of a discussion thread, which is nil while it is still open.
+//
+// The latest of the thread's root comment and its direct replies to have the
+// resolved bit set decides the status: a reply that sets it to true resolves
+// the thread, and one that sets it to false reopens it and makes it blocking.
+// Replies always come after the root comment that they reply to, and are
+// ordered among themselves by their clocks, falling back to their timestamps.
+func ThreadStatus(thread CommentThread) *bool {
+	status := thread.Comment.Resolved
+	var latest *comment.Comment
+	for i := range thread.Children {
+		c := &thread.Children[i].Comment
+		if c.Resolved != nil && (latest == nil || !commentBefore(*c, *latest)) {
+			latest = c
+		}
+	}
+	if latest != nil {
+		status = latest.Resolved
+	}
+	return status
+}
+
+// isInformational reports whether the severity of a comment means that it never gates the review.
+func isInformational(c comment.Comment) bool {
+	return c.Severity == comment.SeveritySuggestion || c.Severity == comment.SeverityNit
+}
+
+// isBlocking reports whether an open thread with the given status prevents the review from being submitted.
+func isBlocking(thread CommentThread, status *bool) bool {
+	if thread.Comment.Severity == comment.SeverityBlocking {
+		return true
+	}
+	return !isInformational(thread.Comment) && status != nil && !*status
+}
+
+// countThreads counts the open, blocking, and resolved discussion threads, leaving out votes.
+func countThreads(threads []CommentThread) ThreadCounts {
+	var counts ThreadCounts
+	for _, thread := range threads {
+		if isVote(thread) || thread.Comment.Retracted {
+			continue
+		}
+		status := ThreadStatus(thread)
+		if status != nil && *status {
+			counts.Resolved++
+			continue
+		}
+		counts.Open++
+		if isBlocking(thread, status) {
+			counts.Blocking++
+		}
+	}
+	return counts
+}
+
+// String returns a summary of the counts, such as "2 open (1 blocking), 3 resolved".
+func (counts ThreadCounts) String() string {
+	summary := fmt.Sprintf("%d open", counts.Open)
+	if counts.Blocking > 0 {
+		summary += fmt.Sprintf(" (%d blocking)", counts.Blocking)
+	}
+	return summary + fmt.Sprintf(", %d resolved", counts.Resolved)
+}
@@ -0,0 +1,157 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package transport encodes review notes as plain text patches, so that they
+// can be exchanged over email or any other channel that can carry text.
+//
+// Since review notes are only ever merged using the "cat_sort_uniq" strategy,
+// a patch only needs to list the lines to add to the notes of each object.
+// The encoding is an mbox file with one message per notes ref, which can be
+// sent with "git send-email". Each message body has the following form:
+//
+//	notes-ref refs/notes/devtools/discuss
+//	object <hash of the annotated object>
+//	+<note line>
+//	+<note line>
+//	object <hash of another annotated object>
+//	+<note line>
+//
+// Any other lines (such as mail headers and signatures) are ignored when parsing.
+package transport
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/git-appraise/repository"
+)
+
+const (
+	refPrefix    = "notes-ref "
+	objectPrefix = "object "
+	notePrefix   = "+"
+)
+
+// objectPattern matches the full hash of an annotated object.
+var objectPattern = regexp.MustCompile("^[0-9a-f]{40}$")
+
+// Patch represents the notes to add under a single notes ref.
+type Patch struct {
+	Ref string
+	// Notes maps from the hash of an annotated object to the notes to add for it.
+	Notes map[string][]repository.Note
+}
+
+// Size returns the number of notes in the patch.
+func (p Patch) Size() int {
+	var size int
+	for _, notes := range p.Notes {
+		size += len(notes)
+	}
+	return size
+}
+
+// Format writes the given patches as an mbox file with one message per patch.
+//
+// Empty patches are skipped.
+func Format(w io.Writer, author string, patches []Patch) error {
+	var nonEmpty []Patch
+	for _, patch := range patches {
+		if patch.Size() > 0 {
+			nonEmpty = append(nonEmpty, patch)
+		}
+	}
+	date := time.Now().Format(time.RFC1123Z)
+	for i, patch := range nonEmpty {
+		if _, err := fmt.Fprintf(w, "From git-appraise Mon Sep 17 00:00:00 2001\nFrom: %s\nDate: %s\nSubject: [APPRAISE NOTES %d/%d] %s\n\n%s%s\n",
+			author, date, i+1, len(nonEmpty), patch.Ref, refPrefix, patch.Ref); err != nil {
+			return err
+		}
+		var objects []string
+		for object := range patch.Notes {
+			objects = append(objects, object)
+		}
+		sort.Strings(objects)
+		for _, object := range objects {
+			if len(patch.Notes[object]) == 0 {
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "%s%s\n", objectPrefix, object); err != nil {
+				return err
+			}
+			for _, note := range patch.Notes[object] {
+				if _, err := fmt.Fprintf(w, "%s%s\n", notePrefix, note); err != nil {
+					return err
+				}
+			}
+		}
+		if _, err := fmt.Fprint(w, "-- \ngit-appraise\n\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Parse reads the patches from a file written by Format.
+//
+// Patches for the same ref are combined. Objects that are not given by their
+// full hashes are rejected, along with the rest of the patches.
+func Parse(r io.Reader) ([]Patch, error) {
+	var patches []Patch
+	patchIndex := make(map[string]int)
+	current := -1
+	object := ""
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		switch {
+		case strings.HasPrefix(line, refPrefix):
+			ref := strings.TrimSpace(strings.TrimPrefix(line, refPrefix))
+			index, ok := patchIndex[ref]
+			if !ok {
+				index = len(patches)
+				patchIndex[ref] = index
+				patches = append(patches, Patch{Ref: ref, Notes: make(map[string][]repository.Note)})
+			}
+			current = index
+			object = ""
+		case strings.HasPrefix(line, objectPrefix):
+			if current < 0 {
+				return nil, fmt.Errorf("Found an object before any notes ref: %q", line)
+			}
+			object = strings.TrimSpace(strings.TrimPrefix(line, objectPrefix))
+			if !objectPattern.MatchString(object) {
+				return nil, fmt.Errorf("Invalid object %q: it must be a full object hash", object)
+			}
+		case strings.HasPrefix(line, notePrefix):
+			if current < 0 || object == "" {
+				continue
+			}
+			notes := patches[current].Notes
+			notes[object] = append(notes[object], repository.Note(strings.TrimPrefix(line, notePrefix)))
+		case line == "-- ":
+			current = -1
+			object = ""
+		}
+	}
+	return patches, scanner.Err()
+}
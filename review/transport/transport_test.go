@@ -0,0 +1,82 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transport
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/google/git-appraise/repository"
+)
+
+const (
+	abcd = "abcd000000000000000000000000000000000000"
+	ef01 = "ef01000000000000000000000000000000000000"
+)
+
+func TestFormatThenParse(t *testing.T) {
+	patches := []Patch{
+		Patch{
+			Ref: "refs/notes/devtools/reviews",
+			Notes: map[string][]repository.Note{
+				abcd: []repository.Note{repository.Note(`{"targetRef":"refs/heads/master"}`)},
+			},
+		},
+		Patch{
+			Ref:   "refs/notes/devtools/ci",
+			Notes: map[string][]repository.Note{},
+		},
+		Patch{
+			Ref: "refs/notes/devtools/discuss",
+			Notes: map[string][]repository.Note{
+				abcd: []repository.Note{repository.Note(`{"description":"one"}`), repository.Note(`{"description":"two"}`)},
+				ef01: []repository.Note{repository.Note(`{"description":"three"}`)},
+			},
+		},
+	}
+	var buffer bytes.Buffer
+	if err := Format(&buffer, "user@example.com", patches); err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := Parse(&buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parsed) != 2 {
+		t.Fatalf("Unexpected patches: %v", parsed)
+	}
+	if parsed[0].Ref != "refs/notes/devtools/reviews" || parsed[0].Size() != 1 {
+		t.Fatalf("Unexpected first patch: %v", parsed[0])
+	}
+	discuss := parsed[1]
+	if discuss.Ref != "refs/notes/devtools/discuss" || discuss.Size() != 3 {
+		t.Fatalf("Unexpected second patch: %v", discuss)
+	}
+	if string(discuss.Notes[abcd][1]) != `{"description":"two"}` {
+		t.Fatalf("Unexpected notes: %v", discuss.Notes[abcd])
+	}
+}
+
+func TestParseRejectsInvalidObjects(t *testing.T) {
+	for _, object := range []string{"abcd", "HEAD", "../../etc/passwd", "ABCD000000000000000000000000000000000000", abcd + "00"} {
+		patch := "notes-ref refs/notes/devtools/discuss\nobject " + abcd + "\n+{}\nobject " + object + "\n+{}\n"
+		if patches, err := Parse(strings.NewReader(patch)); err == nil {
+			t.Errorf("Expected an error for the object %q, got %v", object, patches)
+		}
+	}
+}
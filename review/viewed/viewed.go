@@ -0,0 +1,129 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package viewed defines the markers that reviewers use to track which files of a revision they have viewed.
+package viewed
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/git-appraise/repository"
+	"github.com/google/git-appraise/review/schema"
+)
+
+const (
+	// Ref defines the git-notes ref that we expect to contain viewed markers.
+	//
+	// Markers annotate the revision in which the files were viewed, so that
+	// they no longer apply once a new revision of the review is posted.
+	Ref = "refs/notes/devtools/viewed"
+
+	// FormatVersion defines the latest version of the marker format supported by the tool.
+	FormatVersion = 0
+)
+
+// Format describes the versions of the marker format, and has a migration to each version after the first.
+var Format = &schema.Format{Name: "viewed marker"}
+
+// Marker records that a reviewer has viewed a file, or, if Unmarked is set, that they want to view it again.
+type Marker struct {
+	Timestamp string `json:"timestamp,omitempty"`
+	Reviewer  string `json:"reviewer"`
+	Path      string `json:"path"`
+	Unmarked  bool   `json:"unmarked,omitempty"`
+	// Version represents the version of the metadata format.
+	Version int `json:"v,omitempty"`
+}
+
+// New returns a new marker for the given file, made by the current user at the current time.
+func New(path string, unmarked bool) Marker {
+	return Marker{
+		Timestamp: strconv.FormatInt(time.Now().Unix(), 10),
+		Reviewer:  repository.GetUserEmail(),
+		Path:      path,
+		Unmarked:  unmarked,
+	}
+}
+
+// Parse parses a viewed marker from a git note.
+func Parse(note repository.Note) (Marker, error) {
+	bytes := []byte(note)
+	var marker Marker
+	err := json.Unmarshal(bytes, &marker)
+	return marker, err
+}
+
+// parseUpgraded parses a viewed marker written in another version of the format.
+func parseUpgraded(note repository.Note) (Marker, error) {
+	upgraded, err := Format.Upgrade(note)
+	if err != nil {
+		return Marker{}, err
+	}
+	return Parse(upgraded)
+}
+
+// ParseAllValid takes collection of git notes and tries to parse a viewed
+// marker from each one. Any notes that are not valid markers get ignored.
+func ParseAllValid(notes []repository.Note) []Marker {
+	var markers []Marker
+	for _, note := range notes {
+		marker, err := Parse(note)
+		if err == nil && marker.Version != FormatVersion {
+			marker, err = parseUpgraded(note)
+		}
+		if err == nil && marker.Reviewer != "" && marker.Path != "" {
+			markers = append(markers, marker)
+		}
+	}
+	return markers
+}
+
+// Write writes a viewed marker as a JSON-formatted git note.
+func (marker *Marker) Write() (repository.Note, error) {
+	bytes, err := json.Marshal(marker)
+	return repository.Note(bytes), err
+}
+
+// ViewedBy returns the files that the given reviewer has viewed, according to
+// their latest marker for each file, sorted by path.
+func ViewedBy(markers []Marker, reviewer string) []string {
+	latest := make(map[string]Marker)
+	for _, marker := range markers {
+		if !strings.EqualFold(marker.Reviewer, reviewer) {
+			continue
+		}
+		if previous, ok := latest[marker.Path]; !ok || previous.Timestamp <= marker.Timestamp {
+			latest[marker.Path] = marker
+		}
+	}
+	var paths []string
+	for path, marker := range latest {
+		if !marker.Unmarked {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// Load returns the files of the given revision that the given reviewer has viewed.
+func Load(revision, reviewer string) []string {
+	return ViewedBy(ParseAllValid(repository.GetNotes(Ref, revision)), reviewer)
+}
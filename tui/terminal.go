@@ -0,0 +1,238 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tui
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Escape sequences understood by ANSI terminals.
+const (
+	enterAltScreen = "\x1b[?1049h\x1b[?25l"
+	leaveAltScreen = "\x1b[?25h\x1b[?1049l"
+	moveHome       = "\x1b[H"
+	clearLine      = "\x1b[K"
+
+	styleReset   = "\x1b[0m"
+	styleBold    = "\x1b[1m"
+	styleReverse = "\x1b[7m"
+	styleRed     = "\x1b[31m"
+	styleGreen   = "\x1b[32m"
+	styleYellow  = "\x1b[33m"
+	styleCyan    = "\x1b[36m"
+)
+
+// The names returned by readKey for keys that do not produce a character.
+const (
+	keyUp        = "up"
+	keyDown      = "down"
+	keyPageUp    = "pgup"
+	keyPageDown  = "pgdown"
+	keyEnter     = "enter"
+	keyEscape    = "esc"
+	keyBackspace = "backspace"
+	keyInterrupt = "ctrl-c"
+)
+
+// line is a single line of text to draw, along with the style in which to draw it.
+type line struct {
+	text  string
+	style string
+}
+
+// terminal is the controlling terminal, switched into raw mode for full-screen drawing.
+type terminal struct {
+	tty *os.File
+	// saved holds the settings to restore when leaving raw mode.
+	saved string
+}
+
+// stty runs the stty command on the given terminal.
+func stty(tty *os.File, args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = tty
+	out, err := cmd.Output()
+	return strings.TrimSpace(string(out)), err
+}
+
+// openTerminal switches the controlling terminal to the alternate screen in raw mode.
+func openTerminal() (*terminal, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return nil, errors.New("The tui command must be run from a terminal.")
+	}
+	saved, err := stty(tty, "-g")
+	if err != nil {
+		tty.Close()
+		return nil, fmt.Errorf("Failed to read the terminal settings: %v", err)
+	}
+	t := &terminal{tty: tty, saved: saved}
+	if err := t.enter(); err != nil {
+		tty.Close()
+		return nil, err
+	}
+	return t, nil
+}
+
+func (t *terminal) enter() error {
+	if _, err := stty(t.tty, "raw", "-echo"); err != nil {
+		return fmt.Errorf("Failed to set up the terminal: %v", err)
+	}
+	fmt.Fprint(t.tty, enterAltScreen)
+	return nil
+}
+
+func (t *terminal) leave() {
+	fmt.Fprint(t.tty, leaveAltScreen)
+	stty(t.tty, t.saved)
+}
+
+// close restores the terminal to the state it was in before openTerminal.
+func (t *terminal) close() {
+	t.leave()
+	t.tty.Close()
+}
+
+// suspend restores the normal terminal while running the given function,
+// e.g. so that the output of git commands can be seen, and then waits for
+// a key press before returning to the full-screen display.
+func (t *terminal) suspend(f func() error) error {
+	t.leave()
+	err := f()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+	}
+	fmt.Fprint(t.tty, "\nPress any key to continue.")
+	if enterErr := t.enter(); enterErr != nil {
+		return enterErr
+	}
+	t.readKey()
+	return err
+}
+
+// size returns the number of rows and columns of the terminal.
+func (t *terminal) size() (int, int) {
+	rows, cols := 24, 80
+	if out, err := stty(t.tty, "size"); err == nil {
+		if fields := strings.Fields(out); len(fields) == 2 {
+			if n, err := strconv.Atoi(fields[0]); err == nil && n > 2 {
+				rows = n
+			}
+			if n, err := strconv.Atoi(fields[1]); err == nil && n > 10 {
+				cols = n
+			}
+		}
+	}
+	return rows, cols
+}
+
+// readKey waits for a key press, and returns either the character typed or the name of the key.
+func (t *terminal) readKey() (string, error) {
+	buf := make([]byte, 16)
+	n, err := t.tty.Read(buf)
+	if err != nil {
+		return "", err
+	}
+	switch key := string(buf[:n]); key {
+	case "\x1b[A", "\x1bOA":
+		return keyUp, nil
+	case "\x1b[B", "\x1bOB":
+		return keyDown, nil
+	case "\x1b[5~":
+		return keyPageUp, nil
+	case "\x1b[6~":
+		return keyPageDown, nil
+	case "\r", "\n":
+		return keyEnter, nil
+	case "\x1b":
+		return keyEscape, nil
+	case "\x7f", "\b":
+		return keyBackspace, nil
+	case "\x03":
+		return keyInterrupt, nil
+	default:
+		return key, nil
+	}
+}
+
+// fit truncates or pads the text to exactly the given number of columns.
+func fit(text string, width int) string {
+	text = strings.Replace(text, "\t", "    ", -1)
+	if count := utf8.RuneCountInString(text); count < width {
+		return text + strings.Repeat(" ", width-count)
+	}
+	return string([]rune(text)[:width])
+}
+
+// draw redraws the whole screen, showing the lines from the given offset
+// followed by a status line at the bottom.
+func (t *terminal) draw(lines []line, offset int, status string) {
+	rows, cols := t.size()
+	var out strings.Builder
+	out.WriteString(moveHome)
+	for row := 0; row < rows-1; row++ {
+		if i := offset + row; i < len(lines) {
+			out.WriteString(lines[i].style + fit(lines[i].text, cols) + styleReset)
+		} else {
+			out.WriteString(clearLine)
+		}
+		out.WriteString("\r\n")
+	}
+	out.WriteString(styleReverse + fit(status, cols) + styleReset)
+	fmt.Fprint(t.tty, out.String())
+}
+
+// prompt reads a line of text typed on the status line.
+//
+// The second result is false if the user cancelled by pressing escape.
+func (t *terminal) prompt(lines []line, offset int, label string) (string, bool) {
+	var input []rune
+	for {
+		t.draw(lines, offset, label+string(input)+"_")
+		key, err := t.readKey()
+		if err != nil {
+			return "", false
+		}
+		switch key {
+		case keyEnter:
+			return strings.TrimSpace(string(input)), true
+		case keyEscape, keyInterrupt:
+			return "", false
+		case keyBackspace:
+			if len(input) > 0 {
+				input = input[:len(input)-1]
+			}
+		case keyUp, keyDown, keyPageUp, keyPageDown:
+		default:
+			if strings.HasPrefix(key, "\x1b") {
+				// Ignore any other special keys.
+				continue
+			}
+			for _, r := range key {
+				if r >= ' ' {
+					input = append(input, r)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,455 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package tui provides a full-screen, keyboard-driven view of the code reviews in a repository.
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/git-appraise/repository"
+	"github.com/google/git-appraise/review"
+	"github.com/google/git-appraise/review/comment"
+)
+
+const (
+	listHelp   = "j/k: move  enter: open  o: toggle open/all  g: refresh  q: quit"
+	reviewHelp = "j/k/space/b: scroll  n/N: next/prev comment  c: comment  r: reply  v: resolve  a: accept  x: reject  s: submit  q: back"
+)
+
+// Actions holds the operations on reviews that are implemented outside of this package.
+type Actions struct {
+	// Submit incorporates an accepted review into its target ref.
+	Submit func(r *review.Review) error
+}
+
+// app holds the state of the interface.
+type app struct {
+	term    *terminal
+	actions Actions
+	// message is shown on the status line until the next key press.
+	message string
+}
+
+// Run shows the interface on the controlling terminal until the user quits.
+func Run(actions Actions) error {
+	term, err := openTerminal()
+	if err != nil {
+		return err
+	}
+	defer term.close()
+	a := &app{term: term, actions: actions}
+	return a.showList()
+}
+
+// status returns the text for the status line, which is the pending message if there is one.
+func (a *app) status(help string) string {
+	if a.message != "" {
+		message := a.message
+		a.message = ""
+		return message
+	}
+	return help
+}
+
+// pageSize returns the number of lines shown at once.
+func (a *app) pageSize() int {
+	rows, _ := a.term.size()
+	return rows - 1
+}
+
+// scrollTo returns the offset at which to show the lines so that the given line is visible.
+func (a *app) scrollTo(offset, index int) int {
+	if index < offset {
+		return index
+	}
+	if page := a.pageSize(); index >= offset+page {
+		return index - page + 1
+	}
+	return offset
+}
+
+// reviewStatus describes the state of a review in a single word.
+func reviewStatus(r review.Review) string {
+	switch {
+	case r.Submitted:
+		return "submitted"
+	case r.Abandoned:
+		return "abandoned"
+	case r.Resolved == nil:
+		return "pending"
+	case *r.Resolved:
+		return "accepted"
+	}
+	return "rejected"
+}
+
+// firstLine returns the first non-empty line of the text.
+func firstLine(text string) string {
+	return strings.SplitN(strings.TrimSpace(text), "\n", 2)[0]
+}
+
+// showList shows the list of reviews, until the user quits.
+func (a *app) showList() error {
+	showAll := false
+	selected, offset := 0, 0
+	for {
+		reviews := review.ListAll()
+		if !showAll {
+			reviews = review.ListOpen()
+		}
+		review.Sort(reviews, review.SortByActivity)
+		if selected >= len(reviews) {
+			selected = len(reviews) - 1
+		}
+		if selected < 0 {
+			selected = 0
+		}
+
+		reload := false
+		for !reload {
+			var lines []line
+			for i, r := range reviews {
+				text := fmt.Sprintf("[%-9s] %.7s  %s  (%s)", reviewStatus(r), r.Revision, firstLine(r.Request.Description), r.Request.Requester)
+				style := ""
+				if i == selected {
+					style = styleReverse
+				}
+				lines = append(lines, line{text, style})
+			}
+			if len(lines) == 0 {
+				lines = append(lines, line{"There are no reviews.", ""})
+			}
+			offset = a.scrollTo(offset, selected)
+			a.term.draw(lines, offset, a.status(listHelp))
+
+			key, err := a.term.readKey()
+			if err != nil {
+				return err
+			}
+			switch key {
+			case "q", keyEscape, keyInterrupt:
+				return nil
+			case "j", keyDown:
+				if selected < len(reviews)-1 {
+					selected++
+				}
+			case "k", keyUp:
+				if selected > 0 {
+					selected--
+				}
+			case " ", keyPageDown:
+				selected += a.pageSize()
+				if selected >= len(reviews) {
+					selected = len(reviews) - 1
+				}
+			case "b", keyPageUp:
+				selected -= a.pageSize()
+				if selected < 0 {
+					selected = 0
+				}
+			case "o":
+				showAll = !showAll
+				selected, offset = 0, 0
+				reload = true
+			case "g":
+				reload = true
+			case keyEnter:
+				if len(reviews) > 0 {
+					if err := a.showReview(reviews[selected].Revision); err != nil {
+						return err
+					}
+					reload = true
+				}
+			}
+		}
+	}
+}
+
+// commentEntry records where a comment is shown in the review view.
+type commentEntry struct {
+	index int
+	hash  string
+	// root is the hash of the top-level comment of the thread.
+	root string
+}
+
+// reviewView is the rendered text of a single review.
+type reviewView struct {
+	lines    []line
+	comments []commentEntry
+}
+
+func (v *reviewView) add(text, style string) {
+	v.lines = append(v.lines, line{text, style})
+}
+
+// threadStatus describes the state of a top-level comment thread.
+func threadStatus(thread review.CommentThread) string {
+	c := thread.Comment
+	if c.Resolved != nil && c.Location.IsWholeCommit() {
+		if *c.Resolved {
+			return "accepted"
+		}
+		return "rejected"
+	}
+	status := review.ThreadStatus(thread)
+	switch {
+	case status == nil:
+		return "open"
+	case *status:
+		return "resolved"
+	}
+	return "blocking"
+}
+
+// addThread renders a comment thread, with its replies indented beneath it.
+func (v *reviewView) addThread(thread review.CommentThread, root, indent string) {
+	c := thread.Comment
+	if root == "" {
+		root = thread.Hash
+	}
+	v.comments = append(v.comments, commentEntry{len(v.lines), thread.Hash, root})
+	header := fmt.Sprintf("%s%s", indent, c.Author)
+	if thread.Hash == root {
+		header += " [" + threadStatus(thread) + "]"
+	}
+	if c.Location != nil && c.Location.Path != "" {
+		header += " on " + c.Location.Path
+		if c.Location.Range != nil {
+			header += fmt.Sprintf(":%d", c.Location.Range.StartLine)
+		}
+	} else if c.Location != nil && c.Location.CommitMessage {
+		header += " on the commit message"
+		if c.Location.Range != nil {
+			header += fmt.Sprintf(", line %d", c.Location.Range.StartLine)
+		}
+	}
+	switch {
+	case c.Retracted:
+		header += " (retracted)"
+	case len(thread.History) > 1:
+		header += " (edited)"
+	}
+	v.add(header, styleYellow+styleBold)
+	for _, descriptionLine := range strings.Split(strings.TrimSpace(c.Description), "\n") {
+		if descriptionLine != "" {
+			v.add(indent+"  "+descriptionLine, styleYellow)
+		}
+	}
+	if len(thread.Acks) > 0 {
+		var acks []string
+		for _, ack := range thread.Acks {
+			acks = append(acks, fmt.Sprintf("%s (%s)", ack.Ack, ack.Author))
+		}
+		v.add(indent+"  acks: "+strings.Join(acks, ", "), styleYellow)
+	}
+	for _, child := range thread.Children {
+		v.addThread(child, root, indent+"    ")
+	}
+}
+
+// diffStyle returns the style in which to show a line of a diff.
+func diffStyle(diffLine string) string {
+	switch {
+	case strings.HasPrefix(diffLine, "diff ") || strings.HasPrefix(diffLine, "@@") ||
+		strings.HasPrefix(diffLine, "+++ ") || strings.HasPrefix(diffLine, "--- "):
+		return styleCyan
+	case strings.HasPrefix(diffLine, "+"):
+		return styleGreen
+	case strings.HasPrefix(diffLine, "-"):
+		return styleRed
+	}
+	return ""
+}
+
+// renderReview lays out the details of the review, followed by its diff with the comment threads shown inline.
+func renderReview(r *review.Review) *reviewView {
+	v := &reviewView{}
+	v.add(fmt.Sprintf("[%s] %s", reviewStatus(*r), r.Revision), styleBold)
+	v.add(fmt.Sprintf("%s -> %s, requested by %s", r.Request.ReviewRef, r.Request.TargetRef, r.Request.Requester), "")
+	if len(r.Request.Reviewers) > 0 {
+		v.add("reviewers: "+strings.Join(r.Request.Reviewers, ", "), "")
+	}
+	v.add("threads: "+r.Threads.String(), "")
+	v.add("", "")
+	for _, descriptionLine := range strings.Split(strings.TrimSpace(r.Request.Description), "\n") {
+		v.add("  "+descriptionLine, "")
+	}
+	v.add("", "")
+
+	annotated, err := r.GetAnnotatedDiff()
+	if err != nil {
+		for _, thread := range r.Comments {
+			v.addThread(thread, "", "")
+		}
+		v.add("", "")
+		v.add(fmt.Sprintf("The diff cannot be shown: %v", err), styleRed)
+		return v
+	}
+	for _, thread := range annotated.General {
+		v.addThread(thread, "", "")
+	}
+	for i, diffLine := range annotated.Lines {
+		v.add(diffLine, diffStyle(diffLine))
+		for _, thread := range annotated.Threads[i] {
+			v.addThread(thread, "", "    ")
+		}
+	}
+	for _, thread := range annotated.Unplaced {
+		v.addThread(thread, "", "    ")
+	}
+	return v
+}
+
+// addComment adds a comment on the latest commit of the review.
+func addComment(r *review.Review, c comment.Comment) error {
+	location := comment.Location{Commit: r.FirstCommit()}
+	if commit, err := repository.ResolveCommit(r.Request.ReviewRef); err == nil {
+		location.Commit = commit
+	}
+	c.Location = &location
+	// Other commands may be modifying the reviews at the same time.
+	unlock, err := repository.Lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return r.AddComment(&c)
+}
+
+// showReview shows a single review, until the user goes back to the list.
+func (a *app) showReview(revision string) error {
+	offset, selected := 0, -1
+	for {
+		r := review.Get(revision)
+		if r == nil {
+			a.message = "The review no longer exists."
+			return nil
+		}
+		v := renderReview(r)
+		if selected >= len(v.comments) {
+			selected = len(v.comments) - 1
+		}
+
+		reload := false
+		for !reload {
+			lines := v.lines
+			if selected >= 0 {
+				lines = append([]line(nil), v.lines...)
+				entry := v.comments[selected]
+				lines[entry.index].style += styleReverse
+			}
+			page := a.pageSize()
+			if maxOffset := len(lines) - page; offset > maxOffset {
+				offset = maxOffset
+			}
+			if offset < 0 {
+				offset = 0
+			}
+			a.term.draw(lines, offset, a.status(reviewHelp))
+
+			key, err := a.term.readKey()
+			if err != nil {
+				return err
+			}
+			switch key {
+			case "q", keyEscape, keyInterrupt:
+				return nil
+			case "j", keyDown:
+				offset++
+			case "k", keyUp:
+				offset--
+			case " ", keyPageDown:
+				offset += page
+			case "b", keyPageUp:
+				offset -= page
+			case "n", "N":
+				if len(v.comments) == 0 {
+					a.message = "There are no comments."
+					break
+				}
+				if key == "n" {
+					selected = (selected + 1) % len(v.comments)
+				} else if selected <= 0 {
+					selected = len(v.comments) - 1
+				} else {
+					selected--
+				}
+				offset = a.scrollTo(offset, v.comments[selected].index)
+			case "c", "r", "v", "a", "x":
+				reload = a.commentForKey(r, v, selected, key, lines, offset)
+			case "s":
+				if answer, ok := a.term.prompt(lines, offset, "Submit this review into "+r.Request.TargetRef+"? (y/n) "); ok && answer == "y" {
+					if err := a.term.suspend(func() error { return a.actions.Submit(r) }); err != nil {
+						a.message = "Failed to submit: " + err.Error()
+					} else {
+						a.message = "Submitted."
+					}
+					reload = true
+				}
+			}
+		}
+	}
+}
+
+// commentForKey handles the keys that add a comment to the review, returning whether one was added.
+func (a *app) commentForKey(r *review.Review, v *reviewView, selected int, key string, lines []line, offset int) bool {
+	var parent string
+	if key == "r" || key == "v" {
+		if selected < 0 {
+			a.message = "Select a comment with n/N first."
+			return false
+		}
+		parent = v.comments[selected].hash
+		if key == "v" {
+			parent = v.comments[selected].root
+		}
+	}
+	labels := map[string]string{
+		"c": "Comment: ",
+		"r": "Reply: ",
+		"v": "Resolve with message (optional): ",
+		"a": "Accept with message (optional): ",
+		"x": "Reject with message: ",
+	}
+	message, ok := a.term.prompt(lines, offset, labels[key])
+	if !ok {
+		return false
+	}
+	c := comment.New(message)
+	c.Parent = parent
+	switch key {
+	case "v", "a":
+		resolved := true
+		c.Resolved = &resolved
+	case "x":
+		resolved := false
+		c.Resolved = &resolved
+	default:
+		if message == "" {
+			a.message = "The comment is empty."
+			return false
+		}
+	}
+	if err := addComment(r, c); err != nil {
+		a.message = "Failed to add the comment: " + err.Error()
+		return false
+	}
+	a.message = "Comment added."
+	return true
+}
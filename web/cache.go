@@ -0,0 +1,223 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package web
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/google/git-appraise/repository"
+	"github.com/google/git-appraise/review"
+	"github.com/google/git-appraise/review/analyses"
+	"github.com/google/git-appraise/review/ci"
+	"github.com/google/git-appraise/review/comment"
+	"github.com/google/git-appraise/review/identity"
+	"github.com/google/git-appraise/review/request"
+)
+
+// pageCacheDir is the directory, within the git directory, that caches the pages rendered by export-site.
+const pageCacheDir = "appraise/pages"
+
+// pageCacheVersion is changed whenever the templates or the data given to
+// them change, so that pages rendered by other releases are not reused.
+const pageCacheVersion = 1
+
+// reviewNotesRefs are the notes refs holding the requests and comments of reviews.
+var reviewNotesRefs = []string{request.Ref, request.ArchiveRef, comment.Ref}
+
+// reportNotesRefs are the notes refs holding the reports shown for the latest commit of a review.
+var reportNotesRefs = []string{ci.Ref, analyses.Ref}
+
+// renderIndex records the state of the repository that the page of a review
+// is rendered from, so that pages can be reused for as long as it is unchanged.
+//
+// The notes are identified by the hashes of their blobs, so building the
+// index only lists the notes of each ref rather than reading them.
+type renderIndex struct {
+	// notes holds the note blob of each annotated object, keyed by the notes ref and then the object.
+	notes map[string]map[string]string
+	// tips holds the commit that each ref points to.
+	tips map[string]string
+	// base covers the settings that affect every page.
+	base string
+}
+
+// newRenderIndex returns the index of the current state of the repository.
+func newRenderIndex() (*renderIndex, error) {
+	index := &renderIndex{
+		notes: make(map[string]map[string]string),
+		tips:  repository.GetRefTips("refs/"),
+	}
+	for _, ref := range append(append([]string(nil), reviewNotesRefs...), reportNotesRefs...) {
+		blobs, err := repository.GetNoteBlobs(ref)
+		if err != nil {
+			return nil, err
+		}
+		index.notes[ref] = blobs
+	}
+	var identities string
+	if people, err := identity.Default(); err == nil {
+		identities = people.Source()
+	}
+	index.base = renderBase(repository.IsShallow(), identities)
+	return index, nil
+}
+
+// renderBase returns the part of the key that is shared by every page, given
+// whether the repository is shallow and the contents of its identity files.
+func renderBase(shallow bool, identities string) string {
+	return fmt.Sprintf("v%d shallow=%t identities=%x", pageCacheVersion, shallow, sha1.Sum([]byte(identities)))
+}
+
+// tip returns the commit that the given ref points to, or the empty string if it does not exist.
+func (index *renderIndex) tip(ref string) string {
+	if commit, ok := index.tips[ref]; ok {
+		return commit
+	}
+	if strings.HasPrefix(ref, "refs/") {
+		return ""
+	}
+	commit, _ := repository.ResolveCommit(ref)
+	return commit
+}
+
+// key returns the key of the page of the given review.
+//
+// Besides the review's notes, the key covers the commits of its review ref
+// (which determine its diff and CI reports) and target ref (which determines
+// whether it has been submitted).
+func (index *renderIndex) key(r *review.Review) string {
+	h := sha1.New()
+	fmt.Fprintf(h, "%s\n%s %s\n", index.base, r.Revision, r.FirstCommit())
+	for _, ref := range reviewNotesRefs {
+		fmt.Fprintf(h, "%s %s\n", ref, index.notes[ref][r.Revision])
+	}
+	head := index.tip(r.Request.ReviewRef)
+	fmt.Fprintf(h, "%s %s\n%s %s\n", r.Request.ReviewRef, head, r.Request.TargetRef, index.tip(r.Request.TargetRef))
+	for _, ref := range reportNotesRefs {
+		fmt.Fprintf(h, "%s %s\n", ref, index.notes[ref][head])
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// pageCache holds rendered review pages by their keys, so that regenerating
+// them only renders the reviews that have changed.
+//
+// The web server keeps its pages in memory, as they include the server's form
+// token, while export-site keeps them in a directory to reuse them across runs.
+// Setting "appraise.cache" to "false" disables both.
+type pageCache struct {
+	// dir is the directory holding the pages, or empty to keep them in memory.
+	dir      string
+	disabled bool
+	mu       sync.Mutex
+	// pages holds the latest page of each review that is kept in memory, keyed by its revision.
+	pages map[string]cachedPage
+	used  map[string]bool
+}
+
+// cachedPage is a rendered page along with its key.
+type cachedPage struct {
+	key      string
+	contents []byte
+}
+
+// newPageCache returns an empty cache, which keeps its pages in the given directory, if any.
+func newPageCache(dir string) *pageCache {
+	return &pageCache{
+		dir:      dir,
+		disabled: repository.GetConfig("appraise.cache") == "false",
+		pages:    make(map[string]cachedPage),
+		used:     make(map[string]bool),
+	}
+}
+
+// page returns the page of the given review with the given key, rendering it
+// with the given function unless it is cached.
+func (c *pageCache) page(r *review.Review, key string, render func() ([]byte, error)) ([]byte, error) {
+	if c.disabled {
+		return render()
+	}
+	c.mu.Lock()
+	c.used[key] = true
+	cached, ok := c.pages[r.Revision]
+	c.mu.Unlock()
+	if ok && cached.key == key {
+		return cached.contents, nil
+	}
+	if c.dir != "" {
+		if page, err := ioutil.ReadFile(filepath.Join(c.dir, key+".html")); err == nil {
+			return page, nil
+		}
+	}
+	page, err := render()
+	if err != nil {
+		return nil, err
+	}
+	if c.dir != "" {
+		c.write(key, page)
+	} else {
+		c.mu.Lock()
+		c.pages[r.Revision] = cachedPage{key, page}
+		c.mu.Unlock()
+	}
+	return page, nil
+}
+
+// write stores the page with the given key in the cache directory, ignoring
+// any errors since the cache is only an optimization.
+func (c *pageCache) write(key string, page []byte) {
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return
+	}
+	file, err := ioutil.TempFile(c.dir, key)
+	if err != nil {
+		return
+	}
+	_, err = file.Write(page)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), filepath.Join(c.dir, key+".html"))
+	}
+	if err != nil {
+		os.Remove(file.Name())
+	}
+}
+
+// prune removes the pages that have not been used from the cache directory,
+// so that it only holds the pages of the latest state of each review.
+func (c *pageCache) prune() {
+	if c.disabled || c.dir == "" {
+		return
+	}
+	files, err := ioutil.ReadDir(c.dir)
+	if err != nil {
+		return
+	}
+	for _, file := range files {
+		if !c.used[strings.TrimSuffix(file.Name(), ".html")] {
+			os.Remove(filepath.Join(c.dir, file.Name()))
+		}
+	}
+}
@@ -0,0 +1,156 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package web
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/git-appraise/review"
+	"github.com/google/git-appraise/review/analyses"
+	"github.com/google/git-appraise/review/ci"
+	"github.com/google/git-appraise/review/comment"
+	"github.com/google/git-appraise/review/request"
+)
+
+const (
+	testRevision = "1111111111111111111111111111111111111111"
+	testHead     = "2222222222222222222222222222222222222222"
+	testTarget   = "3333333333333333333333333333333333333333"
+)
+
+func testIndex() *renderIndex {
+	return &renderIndex{
+		notes: map[string]map[string]string{
+			request.Ref:        {testRevision: "request-blob"},
+			request.ArchiveRef: {},
+			comment.Ref:        {testRevision: "comment-blob"},
+			ci.Ref:             {testHead: "ci-blob"},
+			analyses.Ref:       {},
+		},
+		tips: map[string]string{
+			"refs/heads/feature": testHead,
+			"refs/heads/master":  testTarget,
+		},
+		base: renderBase(false, ""),
+	}
+}
+
+func TestRenderIndexKey(t *testing.T) {
+	r := &review.Review{
+		Revision: testRevision,
+		Request: request.Request{
+			ReviewRef: "refs/heads/feature",
+			TargetRef: "refs/heads/master",
+		},
+	}
+	key := testIndex().key(r)
+	if unchanged := testIndex().key(r); unchanged != key {
+		t.Fatalf("The key of an unchanged review changed from %q to %q", key, unchanged)
+	}
+
+	changes := map[string]func(index *renderIndex){
+		"a changed comment": func(index *renderIndex) {
+			index.notes[comment.Ref][testRevision] = "updated-comment-blob"
+		},
+		"a moved target ref": func(index *renderIndex) {
+			index.tips["refs/heads/master"] = testHead
+		},
+		"a moved review ref": func(index *renderIndex) {
+			index.tips["refs/heads/feature"] = testTarget
+		},
+		"a new CI report": func(index *renderIndex) {
+			index.notes[ci.Ref][testHead] = "updated-ci-blob"
+		},
+		"a changed identity file": func(index *renderIndex) {
+			index.base = renderBase(false, "Jane Doe <jane@example.com> <jdoe@example.com>\n")
+		},
+		"a shallow clone": func(index *renderIndex) {
+			index.base = renderBase(true, "")
+		},
+	}
+	for description, change := range changes {
+		index := testIndex()
+		change(index)
+		if index.key(r) == key {
+			t.Errorf("The key did not change after %s", description)
+		}
+	}
+
+	// Comments on other reviews do not affect the key.
+	index := testIndex()
+	index.notes[comment.Ref][testTarget] = "other-comment-blob"
+	if index.key(r) != key {
+		t.Errorf("The key changed after a comment on another review")
+	}
+}
+
+func TestPageCachePrune(t *testing.T) {
+	dir := t.TempDir()
+	c := &pageCache{
+		dir:   dir,
+		pages: make(map[string]cachedPage),
+		used:  make(map[string]bool),
+	}
+	render := func(contents string) func() ([]byte, error) {
+		return func() ([]byte, error) {
+			return []byte(contents), nil
+		}
+	}
+	r := &review.Review{Revision: testRevision}
+	if _, err := c.page(r, "old", render("old page")); err != nil {
+		t.Fatal(err)
+	}
+
+	// A later run only uses the page with the new key.
+	c = &pageCache{
+		dir:   dir,
+		pages: make(map[string]cachedPage),
+		used:  make(map[string]bool),
+	}
+	page, err := c.page(r, "new", render("new page"))
+	if err != nil || string(page) != "new page" {
+		t.Fatalf("Unexpected page: %q, %v", page, err)
+	}
+	c.prune()
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Name() != "new.html" {
+		var names []string
+		for _, file := range files {
+			names = append(names, file.Name())
+		}
+		t.Fatalf("Unexpected files after pruning: %v", names)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "old.html")); !os.IsNotExist(err) {
+		t.Fatalf("The unused page was not removed: %v", err)
+	}
+
+	// Cached pages are reused without rendering them again.
+	page, err = c.page(r, "new", func() ([]byte, error) {
+		t.Fatal("A cached page was rendered again")
+		return nil, nil
+	})
+	if err != nil || string(page) != "new page" {
+		t.Fatalf("Unexpected cached page: %q, %v", page, err)
+	}
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package web
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/google/git-appraise/repository"
+	"github.com/google/git-appraise/review"
+)
+
+// siteReviewDir is the directory of an exported site holding a page for each review.
+const siteReviewDir = "review"
+
+// ExportSite renders every review into a static, read-only HTML site in the
+// given directory, and returns the number of reviews exported.
+//
+// The site links its pages with relative URLs, so that it can be published
+// under any path of a web server. The list of reviews is in "index.html", and
+// each review is in "review/<revision>.html".
+//
+// The rendered pages are cached, so that exporting again only renders the
+// reviews that have changed since.
+func ExportSite(dir string) (int, error) {
+	if err := os.MkdirAll(filepath.Join(dir, siteReviewDir), 0755); err != nil {
+		return 0, err
+	}
+	// Links on the list go down into the review directory, and links on the reviews go back up.
+	listTemplates, err := parseTemplates(
+		func() string { return "index.html" },
+		func(revision string) string { return siteReviewDir + "/" + revision + ".html" })
+	if err != nil {
+		return 0, err
+	}
+	reviewTemplates, err := parseTemplates(
+		func() string { return "../index.html" },
+		func(revision string) string { return revision + ".html" })
+	if err != nil {
+		return 0, err
+	}
+
+	reviews := review.ListAll()
+	review.Sort(reviews, review.SortByActivity)
+	var list bytes.Buffer
+	if err := listTemplates.ExecuteTemplate(&list, "list", reviews); err != nil {
+		return 0, err
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "index.html"), list.Bytes(), 0644); err != nil {
+		return 0, err
+	}
+	index, err := newRenderIndex()
+	if err != nil {
+		return 0, err
+	}
+	cache := newPageCache(filepath.Join(repository.GetGitDir(), pageCacheDir))
+	for i := range reviews {
+		r := &reviews[i]
+		page, err := cache.page(r, index.key(r), func() ([]byte, error) {
+			var page bytes.Buffer
+			err := reviewTemplates.ExecuteTemplate(&page, "review", newReviewPage(r, ""))
+			return page.Bytes(), err
+		})
+		if err != nil {
+			return i, err
+		}
+		path := filepath.Join(dir, siteReviewDir, r.Revision+".html")
+		if err := ioutil.WriteFile(path, page, 0644); err != nil {
+			return i, err
+		}
+	}
+	cache.prune()
+	return len(reviews), nil
+}
@@ -0,0 +1,133 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package web
+
+// pageTemplates defines the HTML templates for every page that is served or exported.
+//
+// Pages rendered without a form token are read-only, and leave out the forms for posting comments.
+const pageTemplates = `
+{{define "header"}}<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+td, th { padding: 0.2em 1em; text-align: left; }
+pre { margin: 0; }
+.diff { font-family: monospace; border: 1px solid #ccc; padding: 0.5em; }
+.added { background: #e6ffe6; }
+.removed { background: #ffe6e6; }
+.header { color: #666; font-weight: bold; }
+.thread { font-family: sans-serif; border-left: 3px solid #88a; margin: 0.3em 0 0.3em 1.5em; padding-left: 0.5em; }
+.meta { color: #666; font-size: smaller; }
+.avatar { width: 1.2em; height: 1.2em; border-radius: 50%; vertical-align: middle; margin-right: 0.2em; }
+</style>
+</head>
+<body>
+{{end}}
+
+{{define "footer"}}</body>
+</html>
+{{end}}
+
+{{define "person"}}<span title="{{.Email}}">{{with .Avatar}}<img class="avatar" src="{{.}}" alt="">{{end}}{{if .Name}}{{.Name}}{{else}}{{.Email}}{{end}}</span>{{end}}
+
+{{define "list"}}{{template "header" "Reviews"}}
+<h1>Reviews</h1>
+<table>
+<tr><th>Status</th><th>Description</th><th>Requester</th><th>Requested</th></tr>
+{{range .}}<tr>
+<td>{{status .}}</td>
+<td><a href="{{reviewURL .Revision}}">{{.Request.Description}}</a></td>
+<td>{{template "person" (person .Request.Requester)}}</td>
+<td>{{time .Request.Timestamp}}</td>
+</tr>
+{{else}}<tr><td colspan="4">There are no reviews.</td></tr>
+{{end}}</table>
+{{template "footer"}}{{end}}
+
+{{define "thread"}}<div class="thread">
+<div class="meta">{{template "person" (person .Thread.Comment.Author)}}, {{time .Thread.Comment.Timestamp}}{{with .Thread.Comment.Resolved}}{{if .}}, accepted{{else}}, rejected{{end}}{{end}}</div>
+<div>{{.Thread.Comment.Description}}</div>
+{{with .Thread.Acks}}<div class="meta">{{range $i, $ack := .}}{{if $i}}, {{end}}{{$ack.Ack}} ({{template "person" (person $ack.Author)}}){{end}}</div>{{end}}
+{{if .Token}}<details><summary class="meta">Reply</summary>
+<form method="POST" action="{{reviewURL .Revision}}/comment">
+<input type="hidden" name="token" value="{{.Token}}">
+<input type="hidden" name="parent" value="{{.Thread.Hash}}">
+{{with .Thread.Comment.Location}}<input type="hidden" name="path" value="{{.Path}}">{{with .Range}}<input type="hidden" name="line" value="{{.StartLine}}">{{end}}{{end}}
+<textarea name="message" rows="3" cols="60"></textarea><br>
+<input type="submit" value="Reply">
+</form>
+</details>{{end}}
+{{$page := .}}{{range .Thread.Children}}{{template "thread" (threadData $page.Revision $page.Token .)}}{{end}}
+</div>
+{{end}}
+
+{{define "review"}}{{template "header" .Review.Request.Description}}
+{{$revision := .Review.Revision}}{{$token := .Token}}
+<p><a href="{{indexURL}}">All reviews</a></p>
+<h1>{{.Review.Request.Description}}</h1>
+<table>
+<tr><th>Status</th><td>{{status .Review}}</td></tr>
+<tr><th>Revision</th><td>{{.Review.Revision}}</td></tr>
+<tr><th>Requester</th><td>{{template "person" (person .Review.Request.Requester)}}</td></tr>
+<tr><th>Reviewers</th><td>{{range $i, $r := .Review.Request.Reviewers}}{{if $i}}, {{end}}{{template "person" (person $r)}}{{end}}</td></tr>
+<tr><th>Threads</th><td>{{.Review.Threads}}</td></tr>
+<tr><th>Review ref</th><td>{{.Review.Request.ReviewRef}}</td></tr>
+<tr><th>Target ref</th><td>{{.Review.Request.TargetRef}}</td></tr>
+</table>
+
+<h2>Comments</h2>
+{{if .Diff}}{{range .Diff.General}}{{template "thread" (threadData $revision $token .)}}{{end}}
+{{else}}{{range .Review.Comments}}{{template "thread" (threadData $revision $token .)}}{{end}}{{end}}
+
+{{if $token}}<h3>Add a comment</h3>
+<form method="POST" action="{{reviewURL $revision}}/comment">
+<input type="hidden" name="token" value="{{$token}}">
+<label>File <input name="path"></label>
+<label>Line <input name="line" size="5"></label><br>
+<textarea name="message" rows="4" cols="80"></textarea><br>
+<label><input type="radio" name="vote" value="" checked> Comment</label>
+<label><input type="radio" name="vote" value="accept"> Accept</label>
+<label><input type="radio" name="vote" value="reject"> Reject</label><br>
+<input type="submit" value="Post">
+</form>{{end}}
+
+{{with .Checks}}<h2>Checks</h2>
+<table>
+<tr><th>Check</th><th>Status</th><th>Agent</th><th>Reported</th></tr>
+{{range .}}<tr>
+<td>{{if .URL}}<a href="{{.URL}}">{{or .Name "(unnamed)"}}</a>{{else}}{{or .Name "(unnamed)"}}{{end}}</td>
+<td class="{{if eq .Status "success"}}added{{else if eq .Status "failure"}}removed{{end}}">{{or .Status "pending"}}</td>
+<td>{{.Agent}}</td>
+<td>{{time .Timestamp}}</td>
+</tr>
+{{end}}</table>
+{{end}}
+
+<h2>Changes</h2>
+{{with .DiffError}}<p>{{.}}</p>{{end}}
+{{with .Diff}}{{$diff := .}}<div class="diff">
+{{range $i, $line := .Lines}}<pre class="{{lineClass $line}}">{{$line}}</pre>
+{{range threads $diff $i}}{{template "thread" (threadData $revision $token .)}}{{end}}{{end}}
+</div>
+{{range .Unplaced}}<p>Comment on {{.Comment.Location.Path}}:</p>{{template "thread" (threadData $revision $token .)}}{{end}}
+{{end}}
+{{template "footer"}}{{end}}
+`
@@ -0,0 +1,258 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package web serves a browser-based view of the code reviews in a repository.
+package web
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/git-appraise/repository"
+	"github.com/google/git-appraise/review"
+	"github.com/google/git-appraise/review/ci"
+	"github.com/google/git-appraise/review/comment"
+	"github.com/google/git-appraise/review/identity"
+)
+
+// reviewPathPrefix is the path prefix under which individual reviews are served.
+const reviewPathPrefix = "/review/"
+
+// server holds the state shared by the HTTP handlers.
+type server struct {
+	templates *template.Template
+	// token is included in every form we serve, so that other sites cannot post comments on the user's behalf.
+	token string
+	// pages caches the rendered pages of reviews.
+	pages *pageCache
+}
+
+// reviewPage is the data used to render a single review.
+type reviewPage struct {
+	Review *review.Review
+	Diff   *review.AnnotatedDiff
+	// DiffError explains why the diff could not be shown.
+	DiffError string
+	// Checks are the latest CI reports of each check.
+	Checks []ci.Report
+	// Token is empty for read-only pages, which have no forms.
+	Token string
+}
+
+// threadData is the data used to render a comment thread, along with the forms for replying to it.
+type threadData struct {
+	Revision string
+	Token    string
+	Thread   review.CommentThread
+}
+
+// formatTimestamp converts a timestamp from the notes into a human-readable date.
+func formatTimestamp(timestamp string) string {
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return timestamp
+	}
+	return time.Unix(seconds, 0).Format(time.RFC1123)
+}
+
+// status describes the state of a review in a single word.
+func status(r review.Review) string {
+	switch {
+	case r.Submitted:
+		return "submitted"
+	case r.Abandoned:
+		return "abandoned"
+	case r.Resolved == nil:
+		return "pending"
+	case *r.Resolved:
+		return "accepted"
+	}
+	return "rejected"
+}
+
+// lineClass returns the CSS class for a line of a diff.
+func lineClass(line string) string {
+	switch {
+	case strings.HasPrefix(line, "diff ") || strings.HasPrefix(line, "@@") ||
+		strings.HasPrefix(line, "+++ ") || strings.HasPrefix(line, "--- "):
+		return "header"
+	case strings.HasPrefix(line, "+"):
+		return "added"
+	case strings.HasPrefix(line, "-"):
+		return "removed"
+	}
+	return ""
+}
+
+// person returns the identity of the user with the given email address.
+func person(email string) identity.Identity {
+	people, _ := identity.Default()
+	return people.Lookup(email)
+}
+
+// parseTemplates returns the page templates, which link to the list of
+// reviews and to each review with the given functions.
+func parseTemplates(indexURL func() string, reviewURL func(revision string) string) (*template.Template, error) {
+	return template.New("").Funcs(template.FuncMap{
+		"time":      formatTimestamp,
+		"status":    status,
+		"lineClass": lineClass,
+		"indexURL":  indexURL,
+		"reviewURL": reviewURL,
+		"person":    person,
+		"threads":   func(d *review.AnnotatedDiff, i int) []review.CommentThread { return d.Threads[i] },
+		"threadData": func(revision, token string, thread review.CommentThread) threadData {
+			return threadData{revision, token, thread}
+		},
+	}).Parse(pageTemplates)
+}
+
+// newReviewPage returns the data used to render a review, with the given form token.
+func newReviewPage(r *review.Review, token string) reviewPage {
+	if r.Reports == nil {
+		r.LoadReports()
+	}
+	page := reviewPage{Review: r, Checks: ci.LatestChecks(r.Reports), Token: token}
+	if diff, err := r.GetAnnotatedDiff(); err != nil {
+		page.DiffError = err.Error()
+	} else {
+		page.Diff = diff
+	}
+	return page
+}
+
+// Serve runs an HTTP server for browsing the reviews in the current repository on the given address.
+func Serve(addr string) error {
+	tokenBytes := make([]byte, 16)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return err
+	}
+	templates, err := parseTemplates(
+		func() string { return "/" },
+		func(revision string) string { return reviewPathPrefix + revision })
+	if err != nil {
+		return err
+	}
+	s := &server{templates: templates, token: hex.EncodeToString(tokenBytes), pages: newPageCache("")}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.serveList)
+	mux.HandleFunc(reviewPathPrefix, s.serveReview)
+	return http.ListenAndServe(addr, mux)
+}
+
+func (s *server) render(w http.ResponseWriter, name string, data interface{}) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := s.templates.ExecuteTemplate(w, name, data); err != nil {
+		log.Print(err)
+	}
+}
+
+// serveList renders the list of reviews.
+func (s *server) serveList(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path != "/" {
+		http.NotFound(w, req)
+		return
+	}
+	reviews := review.ListAll()
+	review.Sort(reviews, review.SortByActivity)
+	s.render(w, "list", reviews)
+}
+
+// serveReview renders a single review, or handles a comment posted on it.
+func (s *server) serveReview(w http.ResponseWriter, req *http.Request) {
+	revision := strings.TrimSuffix(strings.TrimPrefix(req.URL.Path, reviewPathPrefix), "/comment")
+	r := review.Get(revision)
+	if r == nil {
+		http.NotFound(w, req)
+		return
+	}
+	if req.Method == "POST" {
+		if err := s.postComment(r, req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Redirect(w, req, reviewPathPrefix+r.Revision, http.StatusSeeOther)
+		return
+	}
+	index, err := newRenderIndex()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	page, err := s.pages.page(r, index.key(r), func() ([]byte, error) {
+		var page bytes.Buffer
+		err := s.templates.ExecuteTemplate(&page, "review", newReviewPage(r, s.token))
+		return page.Bytes(), err
+	})
+	if err != nil {
+		log.Print(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(page)
+}
+
+// postComment adds the comment described by the submitted form to the review.
+func (s *server) postComment(r *review.Review, req *http.Request) error {
+	if req.FormValue("token") != s.token {
+		return errors.New("The form has expired; reload the page and try again.")
+	}
+	location := comment.Location{Commit: r.FirstCommit()}
+	if commit, err := repository.ResolveCommit(r.Request.ReviewRef); err == nil {
+		location.Commit = commit
+	}
+	if path := req.FormValue("path"); path != "" {
+		location.Path = path
+		if line := req.FormValue("line"); line != "" {
+			startLine, err := strconv.ParseUint(line, 10, 32)
+			if err != nil {
+				return err
+			}
+			location.Range = &comment.Range{StartLine: uint32(startLine)}
+		}
+	}
+	c := comment.New(req.FormValue("message"))
+	c.Location = &location
+	c.Parent = req.FormValue("parent")
+	switch req.FormValue("vote") {
+	case "accept":
+		accepted := true
+		c.Resolved = &accepted
+	case "reject":
+		rejected := false
+		c.Resolved = &rejected
+	}
+	if c.Description == "" && c.Resolved == nil {
+		return errors.New("The comment is empty.")
+	}
+
+	// Comments may be posted while other commands are running.
+	unlock, err := repository.Lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return r.AddComment(&c)
+}